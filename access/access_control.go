@@ -1,25 +1,299 @@
 package access
 
-type DeviceTypeResolver struct {
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+// DeviceTypeResolver 判断端点上是否存在某个设备类型，用于匹配设置了设备类型的 Target
+type DeviceTypeResolver interface {
+	IsDeviceTypeOnEndpoint(deviceType lib.DeviceTypeId, endpoint lib.EndpointId) bool
+}
+
+// ChangeType 条目的变化类型，取值与 AccessControlEntryChanged 事件一致
+type ChangeType uint8
+
+const (
+	ChangeTypeChanged ChangeType = 0
+	ChangeTypeAdded   ChangeType = 1
+	ChangeTypeRemoved ChangeType = 2
+)
+
+// EntryListener 条目变化的回调，subjectDescriptor 为修改条目的主体，不是由请求修改时为 nil
+type EntryListener interface {
+	OnEntryChanged(subjectDescriptor *SubjectDescriptor, fabricIndex lib.FabricIndex, index int, entry *Entry, changeType ChangeType)
 }
 
 type AccessControler interface {
 	Init(delegate Delegate, resolver DeviceTypeResolver) error
+	Finish()
+
+	AddEntryListener(listener EntryListener)
+	RemoveEntryListener(listener EntryListener)
+
+	GetEntryCount(fabricIndex lib.FabricIndex) int
+	Entries(fabricIndex lib.FabricIndex) []Entry
+	CreateEntry(subjectDescriptor *SubjectDescriptor, entry Entry) (int, error)
+	ReadEntry(fabricIndex lib.FabricIndex, index int) (Entry, error)
+	UpdateEntry(subjectDescriptor *SubjectDescriptor, index int, entry Entry) error
+	DeleteEntry(subjectDescriptor *SubjectDescriptor, fabricIndex lib.FabricIndex, index int) error
+
+	// Check 检查主体是否拥有访问请求路径所需的权限，没有权限时返回 ChipErrorAccessDenied
+	Check(subjectDescriptor SubjectDescriptor, requestPath RequestPath, requestPrivilege Privilege) error
 }
 
 type AccessControl struct {
-	mDelegate Delegate
+	mMutex              sync.RWMutex
+	mDelegate           Delegate
+	mDeviceTypeResolver DeviceTypeResolver
+	mEntryListeners     []EntryListener
 }
 
 func NewAccessControl() *AccessControl {
 	return &AccessControl{}
 }
 
-func (c *AccessControl) Init(delegate Delegate, d DeviceTypeResolver) error {
+func (c *AccessControl) Init(delegate Delegate, resolver DeviceTypeResolver) error {
+	if delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	if err := delegate.Init(); err != nil {
+		return err
+	}
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
 	c.mDelegate = delegate
+	c.mDeviceTypeResolver = resolver
+	return nil
+}
+
+func (c *AccessControl) Finish() {
+	c.mMutex.Lock()
+	delegate := c.mDelegate
+	c.mDelegate = nil
+	c.mMutex.Unlock()
+	if delegate != nil {
+		delegate.Finish()
+	}
+}
+
+func (c *AccessControl) AddEntryListener(listener EntryListener) {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	for _, l := range c.mEntryListeners {
+		if l == listener {
+			return
+		}
+	}
+	c.mEntryListeners = append(c.mEntryListeners, listener)
+}
+
+func (c *AccessControl) RemoveEntryListener(listener EntryListener) {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	for i, l := range c.mEntryListeners {
+		if l == listener {
+			c.mEntryListeners = append(c.mEntryListeners[:i], c.mEntryListeners[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *AccessControl) IsInitialized() bool {
+	return c.delegate() != nil
+}
+
+func (c *AccessControl) GetEntryCount(fabricIndex lib.FabricIndex) int {
+	delegate := c.delegate()
+	if delegate == nil {
+		return 0
+	}
+	return delegate.GetEntryCount(fabricIndex)
+}
+
+func (c *AccessControl) Entries(fabricIndex lib.FabricIndex) []Entry {
+	delegate := c.delegate()
+	if delegate == nil {
+		return nil
+	}
+	return delegate.Entries(fabricIndex)
+}
+
+func (c *AccessControl) CreateEntry(subjectDescriptor *SubjectDescriptor, entry Entry) (int, error) {
+	delegate := c.delegate()
+	if delegate == nil {
+		return 0, internal.ChipErrorIncorrectState
+	}
+	if !entry.IsValid() {
+		return 0, internal.ChipErrorInvalidArgument
+	}
+	index, err := delegate.CreateEntry(entry)
+	if err != nil {
+		return 0, err
+	}
+	c.notifyEntryChanged(subjectDescriptor, entry.FabricIndex, index, &entry, ChangeTypeAdded)
+	return index, nil
+}
+
+func (c *AccessControl) ReadEntry(fabricIndex lib.FabricIndex, index int) (Entry, error) {
+	delegate := c.delegate()
+	if delegate == nil {
+		return Entry{}, internal.ChipErrorIncorrectState
+	}
+	return delegate.ReadEntry(fabricIndex, index)
+}
+
+func (c *AccessControl) UpdateEntry(subjectDescriptor *SubjectDescriptor, index int, entry Entry) error {
+	delegate := c.delegate()
+	if delegate == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !entry.IsValid() {
+		return internal.ChipErrorInvalidArgument
+	}
+	if err := delegate.UpdateEntry(index, entry); err != nil {
+		return err
+	}
+	c.notifyEntryChanged(subjectDescriptor, entry.FabricIndex, index, &entry, ChangeTypeChanged)
+	return nil
+}
+
+func (c *AccessControl) DeleteEntry(subjectDescriptor *SubjectDescriptor, fabricIndex lib.FabricIndex, index int) error {
+	delegate := c.delegate()
+	if delegate == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	entry, err := delegate.ReadEntry(fabricIndex, index)
+	if err != nil {
+		return err
+	}
+	if err = delegate.DeleteEntry(fabricIndex, index); err != nil {
+		return err
+	}
+	c.notifyEntryChanged(subjectDescriptor, fabricIndex, index, &entry, ChangeTypeRemoved)
 	return nil
 }
 
+// notifyEntryChanged 不持有锁调用监听者，监听者可以再读取条目
+func (c *AccessControl) notifyEntryChanged(subjectDescriptor *SubjectDescriptor, fabricIndex lib.FabricIndex, index int, entry *Entry, changeType ChangeType) {
+	c.mMutex.RLock()
+	listeners := append([]EntryListener(nil), c.mEntryListeners...)
+	c.mMutex.RUnlock()
+	for _, listener := range listeners {
+		listener.OnEntryChanged(subjectDescriptor, fabricIndex, index, entry, changeType)
+	}
+}
+
+func (c *AccessControl) Check(subjectDescriptor SubjectDescriptor, requestPath RequestPath, requestPrivilege Privilege) error {
+	c.mMutex.RLock()
+	delegate := c.mDelegate
+	resolver := c.mDeviceTypeResolver
+	c.mMutex.RUnlock()
+	if delegate == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !requestPrivilege.IsValid() {
+		return internal.ChipErrorInvalidArgument
+	}
+
+	switch subjectDescriptor.AuthMode {
+	case AuthModePase:
+		// 配对过程中的 PASE 会话拥有隐式的 Administer 权限
+		if subjectDescriptor.IsCommissioning {
+			return nil
+		}
+	case AuthModeCase:
+		if !subjectDescriptor.Subject.IsOperationalNodeId() {
+			return c.deny(subjectDescriptor, requestPath, requestPrivilege)
+		}
+	case AuthModeGroup:
+		if !subjectDescriptor.Subject.IsGroupId() {
+			return c.deny(subjectDescriptor, requestPath, requestPrivilege)
+		}
+	default:
+		return c.deny(subjectDescriptor, requestPath, requestPrivilege)
+	}
+	if !subjectDescriptor.FabricIndex.IsValidFabricIndex() {
+		return c.deny(subjectDescriptor, requestPath, requestPrivilege)
+	}
+
+	for _, entry := range delegate.Entries(subjectDescriptor.FabricIndex) {
+		if entry.AuthMode != subjectDescriptor.AuthMode || !entry.Privilege.Grants(requestPrivilege) {
+			continue
+		}
+		if !matchSubjects(&entry, &subjectDescriptor) || !matchTargets(&entry, requestPath, resolver) {
+			continue
+		}
+		return nil
+	}
+	return c.deny(subjectDescriptor, requestPath, requestPrivilege)
+}
+
+func (c *AccessControl) deny(subjectDescriptor SubjectDescriptor, requestPath RequestPath, requestPrivilege Privilege) error {
+	log.Infof("AccessControl: denied %s subject 0x%016X on fabric %d to cluster 0x%08X endpoint %d with privilege %s",
+		subjectDescriptor.AuthMode, uint64(subjectDescriptor.Subject), subjectDescriptor.FabricIndex,
+		uint32(requestPath.Cluster), requestPath.Endpoint, requestPrivilege)
+	return internal.ChipErrorAccessDenied
+}
+
+func (c *AccessControl) delegate() Delegate {
+	c.mMutex.RLock()
+	defer c.mMutex.RUnlock()
+	return c.mDelegate
+}
+
+// matchSubjects CASE 主体可以通过节点ID或者 CAT 匹配，CAT 的版本不能低于条目要求的版本
+func matchSubjects(entry *Entry, subjectDescriptor *SubjectDescriptor) bool {
+	if len(entry.Subjects) == 0 {
+		return true
+	}
+	for _, subject := range entry.Subjects {
+		if subject == subjectDescriptor.Subject {
+			return true
+		}
+		if entry.AuthMode == AuthModeCase && subjectDescriptor.Cats.CheckSubjectAgainstCATs(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTargets Target 中设置的字段都需要匹配
+func matchTargets(entry *Entry, requestPath RequestPath, resolver DeviceTypeResolver) bool {
+	if len(entry.Targets) == 0 {
+		return true
+	}
+	for _, target := range entry.Targets {
+		if target.Flags&TargetFlagCluster != 0 && target.Cluster != requestPath.Cluster {
+			continue
+		}
+		if target.Flags&TargetFlagEndpoint != 0 && target.Endpoint != requestPath.Endpoint {
+			continue
+		}
+		if target.Flags&TargetFlagDeviceType != 0 &&
+			(resolver == nil || !resolver.IsDeviceTypeOnEndpoint(target.DeviceType, requestPath.Endpoint)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+var (
+	sAccessControl      AccessControler
+	sAccessControlMutex sync.RWMutex
+)
+
 func SetAccessControl(a AccessControler) {
+	sAccessControlMutex.Lock()
+	defer sAccessControlMutex.Unlock()
+	sAccessControl = a
+}
 
+func GetAccessControl() AccessControler {
+	sAccessControlMutex.RLock()
+	defer sAccessControlMutex.RUnlock()
+	return sAccessControl
 }
@@ -0,0 +1,182 @@
+package access
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"testing"
+)
+
+const (
+	testNode1 lib.NodeId = 0x0000_0000_0000_0011
+	testNode2 lib.NodeId = 0x0000_0000_0000_0022
+)
+
+type testDeviceTypeResolver map[lib.EndpointId]lib.DeviceTypeId
+
+func (r testDeviceTypeResolver) IsDeviceTypeOnEndpoint(deviceType lib.DeviceTypeId, endpoint lib.EndpointId) bool {
+	return r[endpoint] == deviceType
+}
+
+func newTestAccessControl(t *testing.T, entries ...Entry) *AccessControl {
+	t.Helper()
+	ac := NewAccessControl()
+	if err := ac.Init(NewExampleAccessControlDelegate(), testDeviceTypeResolver{1: 0x0100}); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if _, err := ac.CreateEntry(nil, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ac
+}
+
+func caseSubject(fabricIndex lib.FabricIndex, node lib.NodeId) SubjectDescriptor {
+	return SubjectDescriptor{FabricIndex: fabricIndex, AuthMode: AuthModeCase, Subject: node}
+}
+
+func TestPrivilegeGrants(t *testing.T) {
+	for _, tc := range []struct {
+		granted, requested Privilege
+		expected           bool
+	}{
+		{PrivilegeAdminister, PrivilegeView, true},
+		{PrivilegeAdminister, PrivilegeProxyView, true},
+		{PrivilegeManage, PrivilegeOperate, true},
+		{PrivilegeManage, PrivilegeAdminister, false},
+		{PrivilegeManage, PrivilegeProxyView, false},
+		{PrivilegeOperate, PrivilegeView, true},
+		{PrivilegeOperate, PrivilegeManage, false},
+		{PrivilegeProxyView, PrivilegeView, true},
+		{PrivilegeProxyView, PrivilegeOperate, false},
+		{PrivilegeView, PrivilegeProxyView, false},
+	} {
+		if tc.granted.Grants(tc.requested) != tc.expected {
+			t.Errorf("%s grants %s: expected %v", tc.granted, tc.requested, tc.expected)
+		}
+	}
+}
+
+func TestAccessControlCheckCase(t *testing.T) {
+	ac := newTestAccessControl(t,
+		Entry{FabricIndex: 1, Privilege: PrivilegeAdminister, AuthMode: AuthModeCase, Subjects: []lib.NodeId{testNode1}},
+		Entry{FabricIndex: 1, Privilege: PrivilegeOperate, AuthMode: AuthModeCase, Subjects: []lib.NodeId{testNode2},
+			Targets: []Target{{Flags: TargetFlagCluster | TargetFlagEndpoint, Cluster: 0x0006, Endpoint: 1}}},
+	)
+	onOff := RequestPath{Cluster: 0x0006, Endpoint: 1}
+	levelControl := RequestPath{Cluster: 0x0008, Endpoint: 1}
+
+	for _, tc := range []struct {
+		name       string
+		subject    SubjectDescriptor
+		path       RequestPath
+		privilege  Privilege
+		expectedOk bool
+	}{
+		{"admin manages", caseSubject(1, testNode1), levelControl, PrivilegeManage, true},
+		{"admin on other fabric", caseSubject(2, testNode1), levelControl, PrivilegeView, false},
+		{"operator views", caseSubject(1, testNode2), onOff, PrivilegeView, true},
+		{"operator operates", caseSubject(1, testNode2), onOff, PrivilegeOperate, true},
+		{"operator manages", caseSubject(1, testNode2), onOff, PrivilegeManage, false},
+		{"operator other cluster", caseSubject(1, testNode2), levelControl, PrivilegeView, false},
+		{"operator other endpoint", caseSubject(1, testNode2), RequestPath{Cluster: 0x0006, Endpoint: 2}, PrivilegeView, false},
+		{"unknown node", caseSubject(1, 0x33), onOff, PrivilegeView, false},
+		{"group subject with CASE entry", SubjectDescriptor{FabricIndex: 1, AuthMode: AuthModeGroup, Subject: lib.NodeIdFromGroupId(1)}, onOff, PrivilegeView, false},
+	} {
+		err := ac.Check(tc.subject, tc.path, tc.privilege)
+		if tc.expectedOk && err != nil {
+			t.Errorf("%s: expected access, got %v", tc.name, err)
+		}
+		if !tc.expectedOk && err != internal.ChipErrorAccessDenied {
+			t.Errorf("%s: expected access denied, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestAccessControlCheckPase(t *testing.T) {
+	ac := newTestAccessControl(t)
+	path := RequestPath{Cluster: 0x001F, Endpoint: 0}
+	commissioning := SubjectDescriptor{AuthMode: AuthModePase, IsCommissioning: true}
+	if err := ac.Check(commissioning, path, PrivilegeAdminister); err != nil {
+		t.Errorf("PASE during commissioning must be an implicit admin, got %v", err)
+	}
+	if err := ac.Check(SubjectDescriptor{FabricIndex: 1, AuthMode: AuthModePase}, path, PrivilegeView); err != internal.ChipErrorAccessDenied {
+		t.Errorf("PASE outside commissioning must be denied, got %v", err)
+	}
+}
+
+func TestAccessControlCheckGroupAndCAT(t *testing.T) {
+	const cat lib.CASEAuthTag = 0xABCD_0001
+	ac := newTestAccessControl(t,
+		Entry{FabricIndex: 1, Privilege: PrivilegeOperate, AuthMode: AuthModeGroup, Subjects: []lib.NodeId{lib.NodeIdFromGroupId(0x0101)},
+			Targets: []Target{{Flags: TargetFlagDeviceType, DeviceType: 0x0100}}},
+		Entry{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModeCase, Subjects: []lib.NodeId{lib.NodeIdFromCASEAuthTag(cat)}},
+	)
+	group := SubjectDescriptor{FabricIndex: 1, AuthMode: AuthModeGroup, Subject: lib.NodeIdFromGroupId(0x0101)}
+	if err := ac.Check(group, RequestPath{Cluster: 0x0006, Endpoint: 1}, PrivilegeOperate); err != nil {
+		t.Errorf("group on matching device type must be allowed, got %v", err)
+	}
+	if err := ac.Check(group, RequestPath{Cluster: 0x0006, Endpoint: 2}, PrivilegeOperate); err != internal.ChipErrorAccessDenied {
+		t.Errorf("group on other device type must be denied, got %v", err)
+	}
+
+	subject := caseSubject(1, testNode2)
+	if err := ac.Check(subject, RequestPath{Cluster: 0x0006, Endpoint: 1}, PrivilegeView); err != internal.ChipErrorAccessDenied {
+		t.Errorf("node without CAT must be denied, got %v", err)
+	}
+	subject.Cats = lib.CATValues{0x1234_0001, cat}
+	if err := ac.Check(subject, RequestPath{Cluster: 0x0006, Endpoint: 1}, PrivilegeView); err != nil {
+		t.Errorf("node with CAT must be allowed, got %v", err)
+	}
+	subject.Cats = lib.CATValues{0xABCD_0003}
+	if err := ac.Check(subject, RequestPath{Cluster: 0x0006, Endpoint: 1}, PrivilegeView); err != nil {
+		t.Errorf("node with newer CAT version must be allowed, got %v", err)
+	}
+
+	ac = newTestAccessControl(t,
+		Entry{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModeCase, Subjects: []lib.NodeId{lib.NodeIdFromCASEAuthTag(0xABCD_0002)}})
+	subject.Cats = lib.CATValues{cat}
+	if err := ac.Check(subject, RequestPath{Cluster: 0x0006, Endpoint: 1}, PrivilegeView); err != internal.ChipErrorAccessDenied {
+		t.Errorf("node with older CAT version must be denied, got %v", err)
+	}
+}
+
+func TestAccessControlEntryValidation(t *testing.T) {
+	ac := newTestAccessControl(t)
+	for _, entry := range []Entry{
+		{FabricIndex: 0, Privilege: PrivilegeView, AuthMode: AuthModeCase},
+		{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModePase},
+		{FabricIndex: 1, Privilege: PrivilegeAdminister, AuthMode: AuthModeGroup},
+		{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModeCase, Subjects: []lib.NodeId{lib.NodeIdFromGroupId(1)}},
+		{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModeGroup, Subjects: []lib.NodeId{testNode1}},
+		{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModeCase, Targets: []Target{{}}},
+		{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModeCase, Targets: []Target{{Flags: TargetFlagEndpoint | TargetFlagDeviceType}}},
+	} {
+		if _, err := ac.CreateEntry(nil, entry); err != internal.ChipErrorInvalidArgument {
+			t.Errorf("entry %+v must be rejected, got %v", entry, err)
+		}
+	}
+
+	entry := Entry{FabricIndex: 1, Privilege: PrivilegeView, AuthMode: AuthModeCase}
+	for i := 0; i < kExampleMaxEntriesPerFabric; i++ {
+		if index, err := ac.CreateEntry(nil, entry); err != nil || index != i {
+			t.Fatalf("unexpected index %d, %v", index, err)
+		}
+	}
+	if _, err := ac.CreateEntry(nil, entry); err != internal.ChipErrorNoMemory {
+		t.Errorf("expected NoMemory, got %v", err)
+	}
+	entry.Privilege = PrivilegeManage
+	if err := ac.UpdateEntry(nil, 1, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := ac.DeleteEntry(nil, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := ac.ReadEntry(1, 0); err != nil || read.Privilege != PrivilegeManage {
+		t.Errorf("unexpected entry %+v, %v", read, err)
+	}
+	if ac.GetEntryCount(1) != kExampleMaxEntriesPerFabric-1 {
+		t.Errorf("unexpected entry count %d", ac.GetEntryCount(1))
+	}
+}
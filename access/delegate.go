@@ -1,4 +1,22 @@
 package access
 
+import "github.com/galenliu/chip/lib"
+
+// Delegate 保存 ACL 条目，条目按 Fabric 分开，索引为条目在 Fabric 中的位置
 type Delegate interface {
+	Init() error
+	Finish()
+
+	GetMaxEntriesPerFabric() int
+	GetMaxSubjectsPerEntry() int
+	GetMaxTargetsPerEntry() int
+
+	GetEntryCount(fabricIndex lib.FabricIndex) int
+	// Entries 返回 Fabric 的所有条目的副本
+	Entries(fabricIndex lib.FabricIndex) []Entry
+	// CreateEntry 在 Fabric 的条目末尾添加条目，返回条目的索引
+	CreateEntry(entry Entry) (int, error)
+	ReadEntry(fabricIndex lib.FabricIndex, index int) (Entry, error)
+	UpdateEntry(index int, entry Entry) error
+	DeleteEntry(fabricIndex lib.FabricIndex, index int) error
 }
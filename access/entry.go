@@ -0,0 +1,79 @@
+package access
+
+import (
+	"github.com/galenliu/chip/lib"
+)
+
+// TargetFlags 标记 Target 中设置了哪些字段
+type TargetFlags uint8
+
+const (
+	TargetFlagCluster TargetFlags = 1 << iota
+	TargetFlagEndpoint
+	TargetFlagDeviceType
+)
+
+// Target 条目作用的集群、端点或者设备类型，端点和设备类型不能同时设置
+type Target struct {
+	Flags      TargetFlags
+	Cluster    lib.ClusterId
+	Endpoint   lib.EndpointId
+	DeviceType lib.DeviceTypeId
+}
+
+func (t Target) IsValid() bool {
+	if t.Flags == 0 || t.Flags&^(TargetFlagCluster|TargetFlagEndpoint|TargetFlagDeviceType) != 0 {
+		return false
+	}
+	return t.Flags&(TargetFlagEndpoint|TargetFlagDeviceType) != TargetFlagEndpoint|TargetFlagDeviceType
+}
+
+// Entry ACL 条目，没有 Subject 时匹配所有主体，没有 Target 时匹配所有目标
+type Entry struct {
+	FabricIndex lib.FabricIndex
+	Privilege   Privilege
+	AuthMode    AuthMode
+	// Subjects CASE 条目为运行节点ID或者 CAT，组条目为组的 NodeId
+	Subjects []lib.NodeId
+	Targets  []Target
+}
+
+// IsValid ACL 中只能保存 CASE 和组条目，组条目不能授予 Administer
+func (e *Entry) IsValid() bool {
+	if !e.FabricIndex.IsValidFabricIndex() || !e.Privilege.IsValid() {
+		return false
+	}
+	switch e.AuthMode {
+	case AuthModeCase:
+		for _, subject := range e.Subjects {
+			if !subject.IsOperationalNodeId() && !(subject.IsCASEAuthTag() && subject.CASEAuthTag().IsValid()) {
+				return false
+			}
+		}
+	case AuthModeGroup:
+		if e.Privilege == PrivilegeAdminister {
+			return false
+		}
+		for _, subject := range e.Subjects {
+			if !subject.IsGroupId() || subject.GroupId() == lib.KUndefinedGroupId {
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	for _, target := range e.Targets {
+		if !target.IsValid() {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone 复制条目，调用者修改返回值不会影响保存的条目
+func (e *Entry) Clone() Entry {
+	entry := *e
+	entry.Subjects = append([]lib.NodeId(nil), e.Subjects...)
+	entry.Targets = append([]Target(nil), e.Targets...)
+	return entry
+}
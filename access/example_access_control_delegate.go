@@ -1,5 +1,123 @@
 package access
 
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"sync"
+)
+
+const (
+	kExampleMaxEntriesPerFabric = 4
+	kExampleMaxSubjectsPerEntry = 4
+	kExampleMaxTargetsPerEntry  = 3
+)
+
+// ExampleAccessControlDelegate 在内存中保存 ACL 条目
+type ExampleAccessControlDelegate struct {
+	mMutex   sync.Mutex
+	mEntries map[lib.FabricIndex][]Entry
+}
+
+func NewExampleAccessControlDelegate() *ExampleAccessControlDelegate {
+	return &ExampleAccessControlDelegate{mEntries: make(map[lib.FabricIndex][]Entry)}
+}
+
 func GetAccessControlDelegate() Delegate {
+	return NewExampleAccessControlDelegate()
+}
+
+func (d *ExampleAccessControlDelegate) Init() error {
+	return nil
+}
+
+func (d *ExampleAccessControlDelegate) Finish() {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	d.mEntries = make(map[lib.FabricIndex][]Entry)
+}
+
+func (d *ExampleAccessControlDelegate) GetMaxEntriesPerFabric() int {
+	return kExampleMaxEntriesPerFabric
+}
+
+func (d *ExampleAccessControlDelegate) GetMaxSubjectsPerEntry() int {
+	return kExampleMaxSubjectsPerEntry
+}
+
+func (d *ExampleAccessControlDelegate) GetMaxTargetsPerEntry() int {
+	return kExampleMaxTargetsPerEntry
+}
+
+func (d *ExampleAccessControlDelegate) GetEntryCount(fabricIndex lib.FabricIndex) int {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	return len(d.mEntries[fabricIndex])
+}
+
+func (d *ExampleAccessControlDelegate) Entries(fabricIndex lib.FabricIndex) []Entry {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	entries := make([]Entry, 0, len(d.mEntries[fabricIndex]))
+	for i := range d.mEntries[fabricIndex] {
+		entries = append(entries, d.mEntries[fabricIndex][i].Clone())
+	}
+	return entries
+}
+
+func (d *ExampleAccessControlDelegate) CreateEntry(entry Entry) (int, error) {
+	if err := d.checkLimits(&entry); err != nil {
+		return 0, err
+	}
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	if len(d.mEntries[entry.FabricIndex]) >= kExampleMaxEntriesPerFabric {
+		return 0, internal.ChipErrorNoMemory
+	}
+	d.mEntries[entry.FabricIndex] = append(d.mEntries[entry.FabricIndex], entry.Clone())
+	return len(d.mEntries[entry.FabricIndex]) - 1, nil
+}
+
+func (d *ExampleAccessControlDelegate) ReadEntry(fabricIndex lib.FabricIndex, index int) (Entry, error) {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	entries := d.mEntries[fabricIndex]
+	if index < 0 || index >= len(entries) {
+		return Entry{}, internal.ChipErrorNotFound
+	}
+	return entries[index].Clone(), nil
+}
+
+func (d *ExampleAccessControlDelegate) UpdateEntry(index int, entry Entry) error {
+	if err := d.checkLimits(&entry); err != nil {
+		return err
+	}
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	entries := d.mEntries[entry.FabricIndex]
+	if index < 0 || index >= len(entries) {
+		return internal.ChipErrorNotFound
+	}
+	entries[index] = entry.Clone()
+	return nil
+}
+
+func (d *ExampleAccessControlDelegate) DeleteEntry(fabricIndex lib.FabricIndex, index int) error {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	entries := d.mEntries[fabricIndex]
+	if index < 0 || index >= len(entries) {
+		return internal.ChipErrorNotFound
+	}
+	d.mEntries[fabricIndex] = append(entries[:index], entries[index+1:]...)
+	if len(d.mEntries[fabricIndex]) == 0 {
+		delete(d.mEntries, fabricIndex)
+	}
+	return nil
+}
+
+func (d *ExampleAccessControlDelegate) checkLimits(entry *Entry) error {
+	if len(entry.Subjects) > kExampleMaxSubjectsPerEntry || len(entry.Targets) > kExampleMaxTargetsPerEntry {
+		return internal.ChipErrorNoMemory
+	}
 	return nil
 }
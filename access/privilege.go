@@ -0,0 +1,71 @@
+package access
+
+// Privilege 访问权限，取值与 Access Control 集群一致
+type Privilege uint8
+
+const (
+	PrivilegeView       Privilege = 1
+	PrivilegeProxyView  Privilege = 2
+	PrivilegeOperate    Privilege = 3
+	PrivilegeManage     Privilege = 4
+	PrivilegeAdminister Privilege = 5
+)
+
+func (p Privilege) IsValid() bool {
+	return p >= PrivilegeView && p <= PrivilegeAdminister
+}
+
+// Grants 判断授予 p 时是否也授予 requested：Administer 包含所有权限，Manage 包含 Operate，Operate 包含 View，ProxyView 包含 View
+func (p Privilege) Grants(requested Privilege) bool {
+	if !p.IsValid() || !requested.IsValid() {
+		return false
+	}
+	switch p {
+	case PrivilegeAdminister:
+		return true
+	case PrivilegeProxyView:
+		return requested == PrivilegeProxyView || requested == PrivilegeView
+	default:
+		return requested != PrivilegeProxyView && requested <= p
+	}
+}
+
+func (p Privilege) String() string {
+	switch p {
+	case PrivilegeView:
+		return "View"
+	case PrivilegeProxyView:
+		return "ProxyView"
+	case PrivilegeOperate:
+		return "Operate"
+	case PrivilegeManage:
+		return "Manage"
+	case PrivilegeAdminister:
+		return "Administer"
+	default:
+		return "Unknown"
+	}
+}
+
+// AuthMode 认证方式，取值与 Access Control 集群一致
+type AuthMode uint8
+
+const (
+	AuthModeNone  AuthMode = 0
+	AuthModePase  AuthMode = 1
+	AuthModeCase  AuthMode = 2
+	AuthModeGroup AuthMode = 3
+)
+
+func (m AuthMode) String() string {
+	switch m {
+	case AuthModePase:
+		return "PASE"
+	case AuthModeCase:
+		return "CASE"
+	case AuthModeGroup:
+		return "Group"
+	default:
+		return "None"
+	}
+}
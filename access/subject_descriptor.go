@@ -0,0 +1,21 @@
+package access
+
+import "github.com/galenliu/chip/lib"
+
+// SubjectDescriptor 发起请求的主体，由会话得到
+type SubjectDescriptor struct {
+	FabricIndex lib.FabricIndex
+	AuthMode    AuthMode
+	// Subject CASE 为对端的运行节点ID，组为组的 NodeId，PASE 不使用
+	Subject lib.NodeId
+	// Cats CASE 对端 NOC 中的 CAT
+	Cats lib.CATValues
+	// IsCommissioning 配对过程中的 PASE 会话拥有隐式的 Administer 权限
+	IsCommissioning bool
+}
+
+// RequestPath 请求访问的集群和端点
+type RequestPath struct {
+	Cluster  lib.ClusterId
+	Endpoint lib.EndpointId
+}
@@ -15,7 +15,11 @@ func (c *command) intCommission() (err error) {
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
 
 			deviceOption := config.NewDeviceOptions()
-			deviceOption, _ = deviceOption.Init(c.config)
+			deviceOption, err = deviceOption.Init(c.config)
+			if err != nil {
+				log.Infof(err.Error())
+				return err
+			}
 			err = app.Init(deviceOption)
 			if err != nil {
 				log.Infof(err.Error())
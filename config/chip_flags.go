@@ -78,6 +78,6 @@ func HandleCHIPConfig(cmd *cobra.Command) {
 
 	cmd.Flags().Int8Var(&InetConfigEnableTcpEndpoint,
 		InetConfigEnableTcpEndpointName,
-		ChipDeviceConfigDiscoveryNoTimeout,
+		InetConfigEnableTcpEndpoint,
 		InetConfigEnableTcpEndpointUsage)
 }
@@ -114,6 +114,31 @@ var (
 		"interface-id",
 		"interface-id",
 		"A interface id to advertise on.\n"}
+
+	DeviceOptionDacCert = Flag{
+		"dac-cert",
+		"",
+		"A file containing the Device Attestation Certificate in DER or PEM format. If omitted, the example test credentials are used.\n"}
+
+	DeviceOptionDacKey = Flag{
+		"dac-key",
+		"",
+		"A file containing the Device Attestation private key in DER or PEM format.\n"}
+
+	DeviceOptionPaiCert = Flag{
+		"pai-cert",
+		"",
+		"A file containing the Product Attestation Intermediate certificate in DER or PEM format.\n"}
+
+	DeviceOptionCertificationDeclaration = Flag{
+		"certification-declaration",
+		"",
+		"A file containing the CMS-signed Certification Declaration.\n"}
+
+	DeviceOptionFirmwareInformation = Flag{
+		"firmware-information",
+		"",
+		"A file containing the optional firmware information for device attestation.\n"}
 )
 
 type DeviceOptions struct {
@@ -136,6 +161,11 @@ type DeviceOptions struct {
 	TraceStreamToLogEnabled   bool
 	TraceStreamFilename       string
 	TestEventTriggerEnableKey []byte
+	DacCertPath               string
+	DacKeyPath                string
+	PaiCertPath               string
+	CdPath                    string
+	FirmwareInformationPath   string
 	DacProvider               dac.DeviceAttestationCredentialsProvider
 }
 
@@ -207,6 +237,21 @@ func SetDeviceOptions(c *cobra.Command) {
 	c.Flags().String(DeviceOptionInterfaceId.Key,
 		cast.ToString(DeviceOptionInterfaceId.DefaultValue),
 		DeviceOptionInterfaceId.Usage)
+	c.Flags().String(DeviceOptionDacCert.Key,
+		cast.ToString(DeviceOptionDacCert.DefaultValue),
+		DeviceOptionDacCert.Usage)
+	c.Flags().String(DeviceOptionDacKey.Key,
+		cast.ToString(DeviceOptionDacKey.DefaultValue),
+		DeviceOptionDacKey.Usage)
+	c.Flags().String(DeviceOptionPaiCert.Key,
+		cast.ToString(DeviceOptionPaiCert.DefaultValue),
+		DeviceOptionPaiCert.Usage)
+	c.Flags().String(DeviceOptionCertificationDeclaration.Key,
+		cast.ToString(DeviceOptionCertificationDeclaration.DefaultValue),
+		DeviceOptionCertificationDeclaration.Usage)
+	c.Flags().String(DeviceOptionFirmwareInformation.Key,
+		cast.ToString(DeviceOptionFirmwareInformation.DefaultValue),
+		DeviceOptionFirmwareInformation.Usage)
 }
 
 func (d *DeviceOptions) Init(config *viper.Viper) (*DeviceOptions, error) {
@@ -225,5 +270,30 @@ func (d *DeviceOptions) Init(config *viper.Viper) (*DeviceOptions, error) {
 	GetDeviceOptionsInstance().TraceStreamDecodeEnabled = false
 	GetDeviceOptionsInstance().TraceStreamToLogEnabled = false
 
+	GetDeviceOptionsInstance().DacCertPath = config.GetString(DeviceOptionDacCert.Key)
+	GetDeviceOptionsInstance().DacKeyPath = config.GetString(DeviceOptionDacKey.Key)
+	GetDeviceOptionsInstance().PaiCertPath = config.GetString(DeviceOptionPaiCert.Key)
+	GetDeviceOptionsInstance().CdPath = config.GetString(DeviceOptionCertificationDeclaration.Key)
+	GetDeviceOptionsInstance().FirmwareInformationPath = config.GetString(DeviceOptionFirmwareInformation.Key)
+	provider, err := GetDeviceOptionsInstance().newDacProvider()
+	if err != nil {
+		return d, err
+	}
+	GetDeviceOptionsInstance().DacProvider = provider
+
 	return d, nil
 }
+
+// newDacProvider 指定了 DAC 证书时从文件加载凭证，否则使用示例的测试凭证
+func (d *DeviceOptions) newDacProvider() (dac.DeviceAttestationCredentialsProvider, error) {
+	if d.DacCertPath == "" {
+		return dac.NewExampleDACProvider()
+	}
+	return dac.NewFileDACProvider(dac.FileDACProviderParams{
+		DacCertPath:                  d.DacCertPath,
+		DacKeyPath:                   d.DacKeyPath,
+		PaiCertPath:                  d.PaiCertPath,
+		CertificationDeclarationPath: d.CdPath,
+		FirmwareInformationPath:      d.FirmwareInformationPath,
+	})
+}
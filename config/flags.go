@@ -6,6 +6,7 @@ import (
 
 var (
 	ChipConfigEnableSessionResumption                         = false
+	InetConfigEnableIpv4                                      = true
 	ChipDeviceConfigDeviceVendorId                     uint16 = 0xFFF1
 	ChipDeviceConfigDeviceProductName                         = "TEST_PRODUCT"
 	ChipDeviceConfigDeviceProductId                    uint16 = 0x8001
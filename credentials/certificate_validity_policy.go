@@ -1,4 +1,60 @@
 package credentials
 
-type CertificateValidityPolicy interface {
+import (
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/internal"
+)
+
+// CertificateValidityPolicy 证书有效期策略，验证证书链时对每个证书的有效期检查结果调用一次，
+// 定义在 certs 中以便证书链验证使用
+type CertificateValidityPolicy = certs.CertificateValidityPolicy
+
+// StrictCertificateValidityPolicy 只接受在可信的当前时间有效的证书
+type StrictCertificateValidityPolicy struct{}
+
+func NewStrictCertificateValidityPolicy() *StrictCertificateValidityPolicy {
+	return &StrictCertificateValidityPolicy{}
+}
+
+func (p *StrictCertificateValidityPolicy) ApplyCertificateValidityPolicy(cert *certs.ChipCertificateData, depth uint8, result certs.CertificateValidityResult) error {
+	switch result {
+	case certs.CertificateValidityValid:
+		return nil
+	case certs.CertificateValidityNotYetValid:
+		return internal.ChipErrorCertNotValidYet
+	case certs.CertificateValidityExpired, certs.CertificateValidityExpiredAtLastKnownGoodTime:
+		return internal.ChipErrorCertExpired
+	default:
+		// 没有可信的当前时间，无法确认证书已经生效
+		return internal.ChipErrorInvalidTime
+	}
+}
+
+// IgnoreCertificateExpiryPolicy 不检查证书是否过期，只拒绝在当前时间还未生效的证书
+type IgnoreCertificateExpiryPolicy struct{}
+
+func NewIgnoreCertificateExpiryPolicy() *IgnoreCertificateExpiryPolicy {
+	return &IgnoreCertificateExpiryPolicy{}
+}
+
+func (p *IgnoreCertificateExpiryPolicy) ApplyCertificateValidityPolicy(cert *certs.ChipCertificateData, depth uint8, result certs.CertificateValidityResult) error {
+	if result == certs.CertificateValidityNotYetValid {
+		return internal.ChipErrorCertNotValidYet
+	}
+	return nil
+}
+
+// LastKnownGoodTimeCertificateValidityPolicy 在默认策略的基础上，
+// 没有可信的当前时间时拒绝在最后已知的正确时间已经过期的证书
+type LastKnownGoodTimeCertificateValidityPolicy struct{}
+
+func NewLastKnownGoodTimeCertificateValidityPolicy() *LastKnownGoodTimeCertificateValidityPolicy {
+	return &LastKnownGoodTimeCertificateValidityPolicy{}
+}
+
+func (p *LastKnownGoodTimeCertificateValidityPolicy) ApplyCertificateValidityPolicy(cert *certs.ChipCertificateData, depth uint8, result certs.CertificateValidityResult) error {
+	if result == certs.CertificateValidityExpiredAtLastKnownGoodTime {
+		return internal.ChipErrorCertExpired
+	}
+	return certs.ApplyDefaultCertificateValidityPolicy(result)
 }
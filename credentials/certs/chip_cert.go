@@ -0,0 +1,657 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"time"
+)
+
+const (
+	// KMaxCHIPCertLength Matter TLV 证书的最大长度
+	KMaxCHIPCertLength = 400
+	// KMaxDERCertLength X.509 DER 证书的最大长度
+	KMaxDERCertLength = 600
+	// KKeyIdentifierLength SubjectKeyId 和 AuthorityKeyId 的长度
+	KKeyIdentifierLength = 20
+	// KMaxCertificateSerialNumberLength 证书序列号的最大长度
+	KMaxCertificateSerialNumberLength = 20
+
+	// KChipEpochSecondsSinceUnixEpoch Matter 纪元 2000-01-01 00:00:00 UTC 的 Unix 时间
+	KChipEpochSecondsSinceUnixEpoch = 946684800
+	// KNullCertTime not-after 为该值表示证书没有明确的过期时间
+	KNullCertTime uint32 = 0
+)
+
+// Matter TLV 证书的标签
+const (
+	tagSerialNumber        uint8 = 1
+	tagSignatureAlgorithm  uint8 = 2
+	tagIssuer              uint8 = 3
+	tagNotBefore           uint8 = 4
+	tagNotAfter            uint8 = 5
+	tagSubject             uint8 = 6
+	tagPublicKeyAlgorithm  uint8 = 7
+	tagEllipticCurveId     uint8 = 8
+	tagEllipticCurvePublic uint8 = 9
+	tagExtensions          uint8 = 10
+	tagECDSASignature      uint8 = 11
+
+	// 扩展的标签
+	tagBasicConstraints       uint8 = 1
+	tagKeyUsage               uint8 = 2
+	tagExtendedKeyUsage       uint8 = 3
+	tagSubjectKeyIdentifier   uint8 = 4
+	tagAuthorityKeyIdentifier uint8 = 5
+	tagFutureExtension        uint8 = 6
+
+	// BasicConstraints 的标签
+	tagBasicConstraintsIsCA              uint8 = 1
+	tagBasicConstraintsPathLenConstraint uint8 = 2
+)
+
+// 证书中的算法标识，Matter 只支持 ECDSA-SHA256 和 prime256v1
+const (
+	kSignatureAlgorithmECDSAWithSHA256 uint64 = 1
+	kPublicKeyAlgorithmECPublicKey     uint64 = 1
+	kEllipticCurvePrime256v1           uint64 = 1
+)
+
+// CertFlags 证书解码后的状态
+type CertFlags uint16
+
+const (
+	CertFlagExtPresentBasicConstraints CertFlags = 1 << iota
+	CertFlagExtPresentKeyUsage
+	CertFlagExtPresentExtendedKeyUsage
+	CertFlagExtPresentSubjectKeyId
+	CertFlagExtPresentAuthKeyId
+	CertFlagExtPresentFutureIsCritical
+	CertFlagIsCA
+	CertFlagPathLenConstraintPresent
+	CertFlagIsTrustAnchor
+	CertFlagTBSHashPresent
+)
+
+func (f CertFlags) Has(flags CertFlags) bool {
+	return f&flags == flags
+}
+
+// KeyUsageFlags KeyUsage 扩展的位，与 X.509 中 BIT STRING 的位序号对应
+type KeyUsageFlags uint16
+
+const (
+	KeyUsageDigitalSignature KeyUsageFlags = 1 << iota
+	KeyUsageNonRepudiation
+	KeyUsageKeyEncipherment
+	KeyUsageDataEncipherment
+	KeyUsageKeyAgreement
+	KeyUsageKeyCertSign
+	KeyUsageCRLSign
+	KeyUsageEncipherOnly
+	KeyUsageDecipherOnly
+
+	keyUsageAll KeyUsageFlags = 1<<9 - 1
+)
+
+func (f KeyUsageFlags) Has(flags KeyUsageFlags) bool {
+	return f&flags == flags
+}
+
+// KeyPurpose ExtendedKeyUsage 中的用途，值为 TLV 中的编码
+type KeyPurpose uint8
+
+const (
+	KeyPurposeServerAuth      KeyPurpose = 1
+	KeyPurposeClientAuth      KeyPurpose = 2
+	KeyPurposeCodeSigning     KeyPurpose = 3
+	KeyPurposeEmailProtection KeyPurpose = 4
+	KeyPurposeTimeStamping    KeyPurpose = 5
+	KeyPurposeOCSPSigning     KeyPurpose = 6
+)
+
+// KeyPurposeFlags 证书包含的用途集合
+type KeyPurposeFlags uint8
+
+func (p KeyPurpose) Flag() KeyPurposeFlags {
+	return 1 << (p - 1)
+}
+
+func (f KeyPurposeFlags) Has(flags KeyPurposeFlags) bool {
+	return f&flags == flags
+}
+
+// ChipCertificateData 解码后的 Matter 证书
+type ChipCertificateData struct {
+	// Certificate 证书的 TLV 编码
+	Certificate  []byte
+	SerialNumber []byte
+	IssuerDN     ChipDN
+	SubjectDN    ChipDN
+	// NotBeforeTime NotAfterTime 为 Matter 纪元的秒数
+	NotBeforeTime     uint32
+	NotAfterTime      uint32
+	PublicKey         crypto.P256PublicKey
+	SubjectKeyId      []byte
+	AuthKeyId         []byte
+	CertFlags         CertFlags
+	KeyUsageFlags     KeyUsageFlags
+	KeyPurposes       []KeyPurpose
+	PathLenConstraint uint8
+	// FutureExtensions 无法转换为 TLV 的扩展，保存完整的 DER 编码
+	FutureExtensions [][]byte
+	Signature        crypto.P256ECDSASignature
+	// TBSHash X.509 TBSCertificate 的 SHA256
+	TBSHash [crypto.KSHA256HashLength]byte
+}
+
+// KeyPurposeFlags 证书包含的用途集合
+func (c *ChipCertificateData) KeyPurposeFlags() KeyPurposeFlags {
+	var flags KeyPurposeFlags
+	for _, purpose := range c.KeyPurposes {
+		flags |= purpose.Flag()
+	}
+	return flags
+}
+
+// IsSelfSigned 颁发者与主题相同，并且 AuthorityKeyId 与 SubjectKeyId 相同
+func (c *ChipCertificateData) IsSelfSigned() bool {
+	return c.IssuerDN.IsEqual(&c.SubjectDN) && string(c.AuthKeyId) == string(c.SubjectKeyId)
+}
+
+// ChipEpochToTime Matter 纪元的秒数转换为时间
+func ChipEpochToTime(chipEpochTime uint32) time.Time {
+	return time.Unix(int64(chipEpochTime)+KChipEpochSecondsSinceUnixEpoch, 0).UTC()
+}
+
+// TimeToChipEpoch 时间转换为 Matter 纪元的秒数，超出范围时返回错误
+func TimeToChipEpoch(t time.Time) (uint32, error) {
+	seconds := t.Unix() - KChipEpochSecondsSinceUnixEpoch
+	if seconds < 0 || seconds > 0xFFFFFFFF {
+		return 0, internal.ChipErrorInvalidArgument
+	}
+	return uint32(seconds), nil
+}
+
+// DecodeChipCert 解码 TLV 证书，并计算 TBS 的摘要用于验证签名
+func DecodeChipCert(chipCert []byte) (*ChipCertificateData, error) {
+	if len(chipCert) > KMaxCHIPCertLength {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	cert := &ChipCertificateData{Certificate: append([]byte{}, chipCert...)}
+	r := tlv.NewReader(chipCert)
+	if err := r.NextExpect(tlv.TypeStructure, tlv.AnonymousTag()); err != nil {
+		return nil, err
+	}
+	if err := r.EnterContainer(); err != nil {
+		return nil, err
+	}
+	if err := decodeChipCertFields(r, cert); err != nil {
+		return nil, err
+	}
+	if err := r.ExitContainer(); err != nil {
+		return nil, err
+	}
+	if err := r.Next(); err != internal.ChipErrorEndOfTLV {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	tbs, err := encodeTBSCert(cert)
+	if err != nil {
+		return nil, err
+	}
+	cert.TBSHash = sha256.Sum256(tbs)
+	cert.CertFlags |= CertFlagTBSHashPresent
+	return cert, nil
+}
+
+func decodeChipCertFields(r *tlv.Reader, cert *ChipCertificateData) error {
+	var err error
+	if err = r.NextExpect(tlv.TypeByteString, tlv.ContextTag(tagSerialNumber)); err != nil {
+		return err
+	}
+	if cert.SerialNumber, err = r.GetBytes(); err != nil {
+		return err
+	}
+	if len(cert.SerialNumber) == 0 || len(cert.SerialNumber) > KMaxCertificateSerialNumberLength {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	if err = expectUint(r, tagSignatureAlgorithm, kSignatureAlgorithmECDSAWithSHA256, internal.ChipErrorUnsupportedSignatureType); err != nil {
+		return err
+	}
+	if err = r.NextExpect(tlv.TypeList, tlv.ContextTag(tagIssuer)); err != nil {
+		return err
+	}
+	if err = cert.IssuerDN.decodeTLV(r); err != nil {
+		return err
+	}
+	if cert.NotBeforeTime, err = getUint32(r, tagNotBefore); err != nil {
+		return err
+	}
+	if cert.NotAfterTime, err = getUint32(r, tagNotAfter); err != nil {
+		return err
+	}
+	if err = r.NextExpect(tlv.TypeList, tlv.ContextTag(tagSubject)); err != nil {
+		return err
+	}
+	if err = cert.SubjectDN.decodeTLV(r); err != nil {
+		return err
+	}
+	if err = expectUint(r, tagPublicKeyAlgorithm, kPublicKeyAlgorithmECPublicKey, internal.ChipErrorUnsupportedCertFormat); err != nil {
+		return err
+	}
+	if err = expectUint(r, tagEllipticCurveId, kEllipticCurvePrime256v1, internal.ChipErrorUnsupportedEllipticCurve); err != nil {
+		return err
+	}
+	if err = r.NextExpect(tlv.TypeByteString, tlv.ContextTag(tagEllipticCurvePublic)); err != nil {
+		return err
+	}
+	pubkey, err := r.GetBytes()
+	if err != nil {
+		return err
+	}
+	if cert.PublicKey, err = crypto.NewP256PublicKey(pubkey); err != nil {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	if err = r.NextExpect(tlv.TypeList, tlv.ContextTag(tagExtensions)); err != nil {
+		return err
+	}
+	if err = decodeExtensions(r, cert); err != nil {
+		return err
+	}
+	if err = r.NextExpect(tlv.TypeByteString, tlv.ContextTag(tagECDSASignature)); err != nil {
+		return err
+	}
+	signature, err := r.GetBytes()
+	if err != nil {
+		return err
+	}
+	if len(signature) != crypto.KP256ECDSASignatureLength {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	copy(cert.Signature[:], signature)
+	if err = r.Next(); err != internal.ChipErrorEndOfTLV {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	return nil
+}
+
+func expectUint(r *tlv.Reader, tag uint8, expected uint64, mismatch error) error {
+	if err := r.NextExpect(tlv.TypeUnsignedInteger, tlv.ContextTag(tag)); err != nil {
+		return err
+	}
+	value, err := r.GetUint()
+	if err != nil {
+		return err
+	}
+	if value != expected {
+		return mismatch
+	}
+	return nil
+}
+
+func getUint32(r *tlv.Reader, tag uint8) (uint32, error) {
+	if err := r.NextExpect(tlv.TypeUnsignedInteger, tlv.ContextTag(tag)); err != nil {
+		return 0, err
+	}
+	value, err := r.GetUint()
+	if err != nil {
+		return 0, err
+	}
+	if value > 0xFFFFFFFF {
+		return 0, internal.ChipErrorUnsupportedCertFormat
+	}
+	return uint32(value), nil
+}
+
+// decodeExtensions 解码扩展列表，每种扩展最多出现一次，扩展按标签递增的顺序排列
+func decodeExtensions(r *tlv.Reader, cert *ChipCertificateData) error {
+	if err := r.EnterContainer(); err != nil {
+		return err
+	}
+	var lastTag uint8
+	for {
+		err := r.Next()
+		if err == internal.ChipErrorEndOfTLV {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !r.GetTag().IsContext() {
+			return internal.ChipErrorUnexpectedTLVElement
+		}
+		tag := uint8(r.GetTag().GetNumber())
+		if tag < lastTag || (tag == lastTag && tag != tagFutureExtension) {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		lastTag = tag
+		if err = decodeExtension(r, tag, cert); err != nil {
+			return err
+		}
+	}
+	return r.ExitContainer()
+}
+
+func decodeExtension(r *tlv.Reader, tag uint8, cert *ChipCertificateData) error {
+	switch tag {
+	case tagBasicConstraints:
+		if r.GetType() != tlv.TypeStructure {
+			return internal.ChipErrorWrongTLVType
+		}
+		if err := r.EnterContainer(); err != nil {
+			return err
+		}
+		if err := r.NextExpect(tlv.TypeBoolean, tlv.ContextTag(tagBasicConstraintsIsCA)); err != nil {
+			return err
+		}
+		isCA, err := r.GetBool()
+		if err != nil {
+			return err
+		}
+		if isCA {
+			cert.CertFlags |= CertFlagIsCA
+		}
+		err = r.Next()
+		if err == nil {
+			if r.GetTag() != tlv.ContextTag(tagBasicConstraintsPathLenConstraint) {
+				return internal.ChipErrorUnexpectedTLVElement
+			}
+			var pathLen uint64
+			if pathLen, err = r.GetUint(); err != nil {
+				return err
+			}
+			if pathLen > 0xFF || !isCA {
+				return internal.ChipErrorUnsupportedCertFormat
+			}
+			cert.PathLenConstraint = uint8(pathLen)
+			cert.CertFlags |= CertFlagPathLenConstraintPresent
+			err = r.Next()
+		}
+		if err != internal.ChipErrorEndOfTLV {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		if err = r.ExitContainer(); err != nil {
+			return err
+		}
+		cert.CertFlags |= CertFlagExtPresentBasicConstraints
+	case tagKeyUsage:
+		keyUsage, err := r.GetUint()
+		if err != nil {
+			return err
+		}
+		if keyUsage == 0 || keyUsage&^uint64(keyUsageAll) != 0 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		cert.KeyUsageFlags = KeyUsageFlags(keyUsage)
+		cert.CertFlags |= CertFlagExtPresentKeyUsage
+	case tagExtendedKeyUsage:
+		if r.GetType() != tlv.TypeArray {
+			return internal.ChipErrorWrongTLVType
+		}
+		if err := r.EnterContainer(); err != nil {
+			return err
+		}
+		for {
+			err := r.Next()
+			if err == internal.ChipErrorEndOfTLV {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			purpose, err := r.GetUint()
+			if err != nil {
+				return err
+			}
+			if purpose < uint64(KeyPurposeServerAuth) || purpose > uint64(KeyPurposeOCSPSigning) {
+				return internal.ChipErrorUnsupportedCertFormat
+			}
+			cert.KeyPurposes = append(cert.KeyPurposes, KeyPurpose(purpose))
+		}
+		if len(cert.KeyPurposes) == 0 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		if err := r.ExitContainer(); err != nil {
+			return err
+		}
+		cert.CertFlags |= CertFlagExtPresentExtendedKeyUsage
+	case tagSubjectKeyIdentifier, tagAuthorityKeyIdentifier:
+		keyId, err := r.GetBytes()
+		if err != nil {
+			return err
+		}
+		if len(keyId) != KKeyIdentifierLength {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		if tag == tagSubjectKeyIdentifier {
+			cert.SubjectKeyId = keyId
+			cert.CertFlags |= CertFlagExtPresentSubjectKeyId
+		} else {
+			cert.AuthKeyId = keyId
+			cert.CertFlags |= CertFlagExtPresentAuthKeyId
+		}
+	case tagFutureExtension:
+		extension, err := r.GetBytes()
+		if err != nil {
+			return err
+		}
+		critical, err := parseFutureExtension(extension)
+		if err != nil {
+			return err
+		}
+		if critical {
+			cert.CertFlags |= CertFlagExtPresentFutureIsCritical
+		}
+		cert.FutureExtensions = append(cert.FutureExtensions, extension)
+	default:
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	return nil
+}
+
+// EncodeChipCert 将证书数据编码为 TLV 格式
+func EncodeChipCert(cert *ChipCertificateData) ([]byte, error) {
+	w := tlv.NewWriter()
+	if err := encodeChipCert(w, cert); err != nil {
+		return nil, err
+	}
+	data, err := w.Finalize()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > KMaxCHIPCertLength {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	return data, nil
+}
+
+func encodeChipCert(w *tlv.Writer, cert *ChipCertificateData) error {
+	if err := w.StartStructure(tlv.AnonymousTag()); err != nil {
+		return err
+	}
+	if err := w.PutBytes(tlv.ContextTag(tagSerialNumber), cert.SerialNumber); err != nil {
+		return err
+	}
+	if err := w.PutUint(tlv.ContextTag(tagSignatureAlgorithm), kSignatureAlgorithmECDSAWithSHA256); err != nil {
+		return err
+	}
+	if err := cert.IssuerDN.encodeTLV(w, tlv.ContextTag(tagIssuer)); err != nil {
+		return err
+	}
+	if err := w.PutUint(tlv.ContextTag(tagNotBefore), uint64(cert.NotBeforeTime)); err != nil {
+		return err
+	}
+	if err := w.PutUint(tlv.ContextTag(tagNotAfter), uint64(cert.NotAfterTime)); err != nil {
+		return err
+	}
+	if err := cert.SubjectDN.encodeTLV(w, tlv.ContextTag(tagSubject)); err != nil {
+		return err
+	}
+	if err := w.PutUint(tlv.ContextTag(tagPublicKeyAlgorithm), kPublicKeyAlgorithmECPublicKey); err != nil {
+		return err
+	}
+	if err := w.PutUint(tlv.ContextTag(tagEllipticCurveId), kEllipticCurvePrime256v1); err != nil {
+		return err
+	}
+	if err := w.PutBytes(tlv.ContextTag(tagEllipticCurvePublic), cert.PublicKey[:]); err != nil {
+		return err
+	}
+	if err := encodeExtensions(w, cert); err != nil {
+		return err
+	}
+	if err := w.PutBytes(tlv.ContextTag(tagECDSASignature), cert.Signature[:]); err != nil {
+		return err
+	}
+	return w.EndContainer()
+}
+
+func encodeExtensions(w *tlv.Writer, cert *ChipCertificateData) error {
+	if err := w.StartList(tlv.ContextTag(tagExtensions)); err != nil {
+		return err
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentBasicConstraints) {
+		if err := w.StartStructure(tlv.ContextTag(tagBasicConstraints)); err != nil {
+			return err
+		}
+		if err := w.PutBool(tlv.ContextTag(tagBasicConstraintsIsCA), cert.CertFlags.Has(CertFlagIsCA)); err != nil {
+			return err
+		}
+		if cert.CertFlags.Has(CertFlagPathLenConstraintPresent) {
+			if err := w.PutUint(tlv.ContextTag(tagBasicConstraintsPathLenConstraint), uint64(cert.PathLenConstraint)); err != nil {
+				return err
+			}
+		}
+		if err := w.EndContainer(); err != nil {
+			return err
+		}
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentKeyUsage) {
+		if err := w.PutUint(tlv.ContextTag(tagKeyUsage), uint64(cert.KeyUsageFlags)); err != nil {
+			return err
+		}
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentExtendedKeyUsage) {
+		if err := w.StartArray(tlv.ContextTag(tagExtendedKeyUsage)); err != nil {
+			return err
+		}
+		for _, purpose := range cert.KeyPurposes {
+			if err := w.PutUint(tlv.AnonymousTag(), uint64(purpose)); err != nil {
+				return err
+			}
+		}
+		if err := w.EndContainer(); err != nil {
+			return err
+		}
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentSubjectKeyId) {
+		if err := w.PutBytes(tlv.ContextTag(tagSubjectKeyIdentifier), cert.SubjectKeyId); err != nil {
+			return err
+		}
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentAuthKeyId) {
+		if err := w.PutBytes(tlv.ContextTag(tagAuthorityKeyIdentifier), cert.AuthKeyId); err != nil {
+			return err
+		}
+	}
+	for _, extension := range cert.FutureExtensions {
+		if err := w.PutBytes(tlv.ContextTag(tagFutureExtension), extension); err != nil {
+			return err
+		}
+	}
+	return w.EndContainer()
+}
+
+// ExtractNodeIdFabricIdFromOpCert 从 NOC 中获取节点ID和FabricId
+func ExtractNodeIdFabricIdFromOpCert(opCert *ChipCertificateData) (lib.NodeId, lib.FabricId, error) {
+	certType, err := opCert.SubjectDN.GetCertType()
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, err
+	}
+	if certType != CertTypeNode {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, internal.ChipErrorWrongCertType
+	}
+	nodeId, err := opCert.SubjectDN.GetCertChipId()
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, err
+	}
+	fabricId, err := opCert.SubjectDN.GetCertFabricId()
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, err
+	}
+	return lib.NodeId(nodeId), fabricId, nil
+}
+
+// ExtractNodeIdFabricIdFromOpCertBytes 从 TLV 编码的 NOC 中获取节点ID和FabricId
+func ExtractNodeIdFabricIdFromOpCertBytes(opCert []byte) (lib.NodeId, lib.FabricId, error) {
+	cert, err := DecodeChipCert(opCert)
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, err
+	}
+	return ExtractNodeIdFabricIdFromOpCert(cert)
+}
+
+// ExtractFabricIdFromCert 获取证书主题中的 FabricId，RCAC 和 ICAC 可以没有 FabricId
+func ExtractFabricIdFromCert(cert *ChipCertificateData) (lib.FabricId, error) {
+	fabricId, err := cert.SubjectDN.GetCertFabricId()
+	if err != nil {
+		return lib.KUndefinedFabricId, err
+	}
+	if fabricId == lib.KUndefinedFabricId {
+		return lib.KUndefinedFabricId, internal.ChipErrorNotFound
+	}
+	return fabricId, nil
+}
+
+// ExtractCATsFromOpCert 获取 NOC 主题中的 CAT
+func ExtractCATsFromOpCert(opCert []byte) (lib.CATValues, error) {
+	cert, err := DecodeChipCert(opCert)
+	if err != nil {
+		return lib.CATValues{}, err
+	}
+	certType, err := cert.SubjectDN.GetCertType()
+	if err != nil {
+		return lib.CATValues{}, err
+	}
+	if certType != CertTypeNode {
+		return lib.CATValues{}, internal.ChipErrorWrongCertType
+	}
+	cats, err := cert.SubjectDN.GetCATs()
+	if err != nil {
+		return lib.CATValues{}, err
+	}
+	if !cats.AreValid() {
+		return lib.CATValues{}, internal.ChipErrorWrongCertDN
+	}
+	return cats, nil
+}
+
+// ExtractPublicKeyFromChipCert 获取 TLV 证书中的公钥
+func ExtractPublicKeyFromChipCert(chipCert []byte) (crypto.P256PublicKey, error) {
+	cert, err := DecodeChipCert(chipCert)
+	if err != nil {
+		return crypto.P256PublicKey{}, err
+	}
+	return cert.PublicKey, nil
+}
+
+// ExtractSKIDFromChipCert 获取 TLV 证书中的 SubjectKeyId
+func ExtractSKIDFromChipCert(chipCert []byte) ([]byte, error) {
+	cert, err := DecodeChipCert(chipCert)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.CertFlags.Has(CertFlagExtPresentSubjectKeyId) {
+		return nil, internal.ChipErrorNotFound
+	}
+	return cert.SubjectKeyId, nil
+}
+
+// VerifyCertSignature 用颁发者的公钥验证证书的签名
+func VerifyCertSignature(cert *ChipCertificateData, signer *ChipCertificateData) error {
+	if !cert.CertFlags.Has(CertFlagTBSHashPresent) {
+		return internal.ChipErrorInvalidArgument
+	}
+	return signer.PublicKey.ECDSAValidateHashSignature(cert.TBSHash[:], cert.Signature)
+}
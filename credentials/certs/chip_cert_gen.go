@@ -0,0 +1,96 @@
+package certs
+
+import (
+	"crypto/sha1"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+)
+
+// X509CertRequestParams 生成证书的参数，有效期为 Matter 纪元的秒数，ValidityEnd 为0表示没有明确的过期时间
+type X509CertRequestParams struct {
+	SerialNumber  int64
+	ValidityStart uint32
+	ValidityEnd   uint32
+	SubjectDN     ChipDN
+	IssuerDN      ChipDN
+}
+
+// NewRootX509Cert 生成自签名的 RCAC，返回 X.509 DER 证书
+func NewRootX509Cert(params *X509CertRequestParams, issuerKeypair *crypto.P256Keypair) ([]byte, error) {
+	if !params.SubjectDN.IsEqual(&params.IssuerDN) {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return newChipX509Cert(params, CertTypeRoot, issuerKeypair.Pubkey(), issuerKeypair)
+}
+
+// NewICAX509Cert 生成由 RCAC 签发的 ICAC
+func NewICAX509Cert(params *X509CertRequestParams, subjectPubkey crypto.P256PublicKey, issuerKeypair *crypto.P256Keypair) ([]byte, error) {
+	return newChipX509Cert(params, CertTypeICA, subjectPubkey, issuerKeypair)
+}
+
+// NewNodeOperationalX509Cert 生成由 RCAC 或者 ICAC 签发的 NOC
+func NewNodeOperationalX509Cert(params *X509CertRequestParams, subjectPubkey crypto.P256PublicKey, issuerKeypair *crypto.P256Keypair) ([]byte, error) {
+	return newChipX509Cert(params, CertTypeNode, subjectPubkey, issuerKeypair)
+}
+
+func newChipX509Cert(params *X509CertRequestParams, certType CertType, subjectPubkey crypto.P256PublicKey, issuerKeypair *crypto.P256Keypair) ([]byte, error) {
+	if params.SerialNumber < 0 || (params.ValidityEnd != KNullCertTime && params.ValidityEnd < params.ValidityStart) {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	subjectType, err := params.SubjectDN.GetCertType()
+	if err != nil {
+		return nil, err
+	}
+	issuerType, err := params.IssuerDN.GetCertType()
+	if err != nil {
+		return nil, err
+	}
+	if subjectType != certType {
+		return nil, internal.ChipErrorWrongCertType
+	}
+	switch certType {
+	case CertTypeRoot, CertTypeICA:
+		if issuerType != CertTypeRoot {
+			return nil, internal.ChipErrorWrongCertType
+		}
+	case CertTypeNode:
+		if issuerType != CertTypeRoot && issuerType != CertTypeICA {
+			return nil, internal.ChipErrorWrongCertType
+		}
+	}
+
+	cert := &ChipCertificateData{
+		SerialNumber:  encodeDERUint(uint64(params.SerialNumber)),
+		IssuerDN:      params.IssuerDN,
+		SubjectDN:     params.SubjectDN,
+		NotBeforeTime: params.ValidityStart,
+		NotAfterTime:  params.ValidityEnd,
+		PublicKey:     subjectPubkey,
+		SubjectKeyId:  keyIdentifier(subjectPubkey),
+		AuthKeyId:     keyIdentifier(issuerKeypair.Pubkey()),
+		CertFlags: CertFlagExtPresentBasicConstraints | CertFlagExtPresentKeyUsage |
+			CertFlagExtPresentSubjectKeyId | CertFlagExtPresentAuthKeyId,
+	}
+	if certType == CertTypeNode {
+		cert.KeyUsageFlags = KeyUsageDigitalSignature
+		cert.KeyPurposes = []KeyPurpose{KeyPurposeClientAuth, KeyPurposeServerAuth}
+		cert.CertFlags |= CertFlagExtPresentExtendedKeyUsage
+	} else {
+		cert.KeyUsageFlags = KeyUsageKeyCertSign | KeyUsageCRLSign
+		cert.CertFlags |= CertFlagIsCA
+	}
+	tbs, err := encodeTBSCert(cert)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Signature, err = issuerKeypair.ECDSASignMsg(tbs); err != nil {
+		return nil, err
+	}
+	return encodeX509Cert(cert)
+}
+
+// keyIdentifier RFC 5280 第4.2.1.2节的方法1，公钥的 SHA-1
+func keyIdentifier(pubkey crypto.P256PublicKey) []byte {
+	digest := sha1.Sum(pubkey[:])
+	return digest[:]
+}
@@ -0,0 +1,270 @@
+package certs
+
+import (
+	"bytes"
+	"github.com/galenliu/chip/internal"
+	"time"
+)
+
+// KMaxCertificateChainLength 证书链的最大长度，RCAC、ICAC、NOC
+const KMaxCertificateChainLength = 3
+
+// CertificateValidityResult 证书有效期检查的结果
+type CertificateValidityResult uint8
+
+const (
+	CertificateValidityValid CertificateValidityResult = iota
+	CertificateValidityNotYetValid
+	CertificateValidityExpired
+	// CertificateValidityNotExpiredAtLastKnownGoodTime 当前时间未知，证书在最后已知的正确时间没有过期
+	CertificateValidityNotExpiredAtLastKnownGoodTime
+	// CertificateValidityExpiredAtLastKnownGoodTime 当前时间未知，证书在最后已知的正确时间已经过期
+	CertificateValidityExpiredAtLastKnownGoodTime
+	CertificateValidityTimeUnknown
+)
+
+// CertificateValidityPolicy 决定证书链中每个证书的有效期检查结果是否可以接受
+type CertificateValidityPolicy interface {
+	ApplyCertificateValidityPolicy(cert *ChipCertificateData, depth uint8, result CertificateValidityResult) error
+}
+
+// ApplyDefaultCertificateValidityPolicy 默认的策略，只拒绝在当前时间还未生效或者已经过期的证书，
+// 默认不根据最后已知的正确时间拒绝证书
+func ApplyDefaultCertificateValidityPolicy(result CertificateValidityResult) error {
+	switch result {
+	case CertificateValidityNotYetValid:
+		return internal.ChipErrorCertNotValidYet
+	case CertificateValidityExpired:
+		return internal.ChipErrorCertExpired
+	default:
+		return nil
+	}
+}
+
+// ValidationContext 验证证书链的参数，TrustAnchor 在验证成功后指向信任锚
+type ValidationContext struct {
+	// EffectiveTime 检查有效期使用的时间，零值表示当前时间未知
+	EffectiveTime time.Time
+	// EffectiveTimeIsLastKnownGood EffectiveTime 是最后已知的正确时间，而不是当前时间
+	EffectiveTimeIsLastKnownGood bool
+	// RequiredKeyUsages RequiredKeyPurposes RequiredCertType 对证书链中叶子证书的要求
+	RequiredKeyUsages   KeyUsageFlags
+	RequiredKeyPurposes KeyPurposeFlags
+	RequiredCertType    CertType
+	// ValidityPolicy 为 nil 时使用 ApplyDefaultCertificateValidityPolicy
+	ValidityPolicy CertificateValidityPolicy
+
+	TrustAnchor *ChipCertificateData
+}
+
+func (c *ValidationContext) Reset() {
+	*c = ValidationContext{}
+}
+
+// SetEffectiveTime 使用当前时间检查证书有效期
+func (c *ValidationContext) SetEffectiveTime(currentTime time.Time) {
+	c.EffectiveTime = currentTime
+	c.EffectiveTimeIsLastKnownGood = false
+}
+
+// SetEffectiveTimeFromLastKnownGoodTime 没有可信的当前时间时，使用最后已知的正确时间检查证书有效期
+func (c *ValidationContext) SetEffectiveTimeFromLastKnownGoodTime(lastKnownGoodTime time.Time) {
+	c.EffectiveTime = lastKnownGoodTime
+	c.EffectiveTimeIsLastKnownGood = true
+}
+
+// CertDecodeFlags 加载证书时的选项
+type CertDecodeFlags uint8
+
+const (
+	// CertDecodeFlagIsTrustAnchor 证书是信任锚，必须是自签名的根证书
+	CertDecodeFlagIsTrustAnchor CertDecodeFlags = 1 << iota
+)
+
+// ChipCertificateSet 用于验证证书链的证书集合
+type ChipCertificateSet struct {
+	mCerts []*ChipCertificateData
+}
+
+func NewChipCertificateSet() *ChipCertificateSet {
+	return &ChipCertificateSet{}
+}
+
+// LoadCert 解码并加入一个 TLV 证书，证书必须包含 SubjectKeyId 和 AuthorityKeyId
+func (s *ChipCertificateSet) LoadCert(chipCert []byte, flags CertDecodeFlags) (*ChipCertificateData, error) {
+	cert, err := DecodeChipCert(chipCert)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.CertFlags.Has(CertFlagExtPresentSubjectKeyId | CertFlagExtPresentAuthKeyId) {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	if cert.CertFlags.Has(CertFlagIsCA) && !cert.KeyUsageFlags.Has(KeyUsageKeyCertSign) {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	if flags&CertDecodeFlagIsTrustAnchor != 0 {
+		if !cert.IsSelfSigned() {
+			return nil, internal.ChipErrorCertNotTrusted
+		}
+		cert.CertFlags |= CertFlagIsTrustAnchor
+	}
+	if len(s.mCerts) >= KMaxCertificateChainLength {
+		return nil, internal.ChipErrorNoMemory
+	}
+	s.mCerts = append(s.mCerts, cert)
+	return cert, nil
+}
+
+func (s *ChipCertificateSet) GetCertCount() int {
+	return len(s.mCerts)
+}
+
+func (s *ChipCertificateSet) GetCertSet() []*ChipCertificateData {
+	return s.mCerts
+}
+
+// GetLastCert 最后加载的证书
+func (s *ChipCertificateSet) GetLastCert() *ChipCertificateData {
+	if len(s.mCerts) == 0 {
+		return nil
+	}
+	return s.mCerts[len(s.mCerts)-1]
+}
+
+// FindCert 根据 SubjectKeyId 查找证书
+func (s *ChipCertificateSet) FindCert(subjectKeyId []byte) *ChipCertificateData {
+	for _, cert := range s.mCerts {
+		if bytes.Equal(cert.SubjectKeyId, subjectKeyId) {
+			return cert
+		}
+	}
+	return nil
+}
+
+// ValidateCert 验证证书以及它到信任锚的证书链
+func (s *ChipCertificateSet) ValidateCert(cert *ChipCertificateData, context *ValidationContext) error {
+	context.TrustAnchor = nil
+	return s.validateCert(cert, context, 0)
+}
+
+// FindValidCert 在集合中查找主题和 SubjectKeyId 匹配，并且能验证到信任锚的证书
+func (s *ChipCertificateSet) FindValidCert(subjectDN *ChipDN, subjectKeyId []byte, context *ValidationContext) (*ChipCertificateData, error) {
+	context.TrustAnchor = nil
+	return s.findValidCert(subjectDN, subjectKeyId, context, 0)
+}
+
+func (s *ChipCertificateSet) findValidCert(subjectDN *ChipDN, subjectKeyId []byte, context *ValidationContext, depth uint8) (*ChipCertificateData, error) {
+	err := internal.ChipErrorCertNotFound
+	if depth > 0 {
+		err = internal.ChipErrorCACertNotFound
+	}
+	for _, cert := range s.mCerts {
+		if !cert.SubjectDN.IsEqual(subjectDN) || !bytes.Equal(cert.SubjectKeyId, subjectKeyId) {
+			continue
+		}
+		if err = s.validateCert(cert, context, depth); err == nil {
+			return cert, nil
+		}
+	}
+	return nil, err
+}
+
+func (s *ChipCertificateSet) validateCert(cert *ChipCertificateData, context *ValidationContext, depth uint8) error {
+	if int(depth) >= KMaxCertificateChainLength {
+		return internal.ChipErrorCertPathTooLong
+	}
+	// 不认识的关键扩展
+	if cert.CertFlags.Has(CertFlagExtPresentFutureIsCritical) {
+		return internal.ChipErrorCertUsageNotAllowed
+	}
+	if depth > 0 {
+		// 颁发者必须是 CA，并且允许签发证书
+		if !cert.CertFlags.Has(CertFlagExtPresentBasicConstraints|CertFlagIsCA) || !cert.KeyUsageFlags.Has(KeyUsageKeyCertSign) {
+			return internal.ChipErrorCertUsageNotAllowed
+		}
+		if cert.CertFlags.Has(CertFlagPathLenConstraintPresent) && depth-1 > cert.PathLenConstraint {
+			return internal.ChipErrorCertPathLenConstraintExceeded
+		}
+	} else {
+		if context.RequiredCertType != CertTypeNotSpecified {
+			certType, err := cert.SubjectDN.GetCertType()
+			if err != nil {
+				return err
+			}
+			if certType != context.RequiredCertType {
+				return internal.ChipErrorWrongCertType
+			}
+		}
+		if !cert.KeyUsageFlags.Has(context.RequiredKeyUsages) || !cert.KeyPurposeFlags().Has(context.RequiredKeyPurposes) {
+			return internal.ChipErrorCertUsageNotAllowed
+		}
+	}
+
+	result := certificateValidity(cert, context)
+	var err error
+	if context.ValidityPolicy != nil {
+		err = context.ValidityPolicy.ApplyCertificateValidityPolicy(cert, depth, result)
+	} else {
+		err = ApplyDefaultCertificateValidityPolicy(result)
+	}
+	if err != nil {
+		return err
+	}
+
+	if cert.CertFlags.Has(CertFlagIsTrustAnchor) {
+		context.TrustAnchor = cert
+		return nil
+	}
+	// 不是信任锚的自签名证书
+	if cert.IsSelfSigned() {
+		return internal.ChipErrorCertNotTrusted
+	}
+	issuer, err := s.findValidCert(&cert.IssuerDN, cert.AuthKeyId, context, depth+1)
+	if err != nil {
+		return err
+	}
+	return VerifyCertSignature(cert, issuer)
+}
+
+// certificateValidity 最后已知的正确时间早于当前时间，只能用来判断证书是否已经过期
+func certificateValidity(cert *ChipCertificateData, context *ValidationContext) CertificateValidityResult {
+	effectiveTime := context.EffectiveTime
+	if effectiveTime.IsZero() {
+		return CertificateValidityTimeUnknown
+	}
+	if context.EffectiveTimeIsLastKnownGood {
+		if cert.NotAfterTime != KNullCertTime && effectiveTime.After(ChipEpochToTime(cert.NotAfterTime)) {
+			return CertificateValidityExpiredAtLastKnownGoodTime
+		}
+		return CertificateValidityNotExpiredAtLastKnownGoodTime
+	}
+	if effectiveTime.Before(ChipEpochToTime(cert.NotBeforeTime)) {
+		return CertificateValidityNotYetValid
+	}
+	if cert.NotAfterTime != KNullCertTime && effectiveTime.After(ChipEpochToTime(cert.NotAfterTime)) {
+		return CertificateValidityExpired
+	}
+	return CertificateValidityValid
+}
+
+// ValidateChipRCAC 检查 RCAC 是自签名的 CA 证书，并验证它的签名
+func ValidateChipRCAC(rcac []byte) error {
+	cert, err := DecodeChipCert(rcac)
+	if err != nil {
+		return err
+	}
+	certType, err := cert.SubjectDN.GetCertType()
+	if err != nil {
+		return err
+	}
+	if certType != CertTypeRoot {
+		return internal.ChipErrorWrongCertType
+	}
+	if !cert.CertFlags.Has(CertFlagExtPresentSubjectKeyId|CertFlagExtPresentAuthKeyId) || !cert.IsSelfSigned() {
+		return internal.ChipErrorCertNotTrusted
+	}
+	if !cert.CertFlags.Has(CertFlagExtPresentBasicConstraints|CertFlagIsCA) || !cert.KeyUsageFlags.Has(KeyUsageKeyCertSign) {
+		return internal.ChipErrorCertUsageNotAllowed
+	}
+	return VerifyCertSignature(cert, cert)
+}
@@ -0,0 +1,200 @@
+package certs
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"testing"
+	"time"
+)
+
+// 证书链的有效期内
+var testEffectiveTime = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+type testValidityPolicy struct {
+	mResults []CertificateValidityResult
+}
+
+func (p *testValidityPolicy) ApplyCertificateValidityPolicy(cert *ChipCertificateData, depth uint8, result CertificateValidityResult) error {
+	p.mResults = append(p.mResults, result)
+	return nil
+}
+
+func loadTestChain(t *testing.T, chain *testCertChain, withICAC bool) (*ChipCertificateSet, *ChipCertificateData) {
+	t.Helper()
+	set := NewChipCertificateSet()
+	if _, err := set.LoadCert(chain.rcac, CertDecodeFlagIsTrustAnchor); err != nil {
+		t.Fatal(err)
+	}
+	if withICAC {
+		if _, err := set.LoadCert(chain.icac, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noc, err := set.LoadCert(chain.noc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set, noc
+}
+
+func newOpCertContext() *ValidationContext {
+	return &ValidationContext{
+		EffectiveTime:       testEffectiveTime,
+		RequiredKeyUsages:   KeyUsageDigitalSignature,
+		RequiredKeyPurposes: KeyPurposeClientAuth.Flag() | KeyPurposeServerAuth.Flag(),
+		RequiredCertType:    CertTypeNode,
+	}
+}
+
+func TestChipCertificateSetValidate(t *testing.T) {
+	chain := newTestCertChain(t, testNodeId, testFabricId, lib.CATValues{})
+	set, noc := loadTestChain(t, chain, true)
+	context := newOpCertContext()
+	found, err := set.FindValidCert(&noc.SubjectDN, noc.SubjectKeyId, context)
+	if err != nil || found != noc {
+		t.Fatalf("NOC must validate: %v", err)
+	}
+	if context.TrustAnchor != set.GetCertSet()[0] {
+		t.Errorf("trust anchor must be the RCAC")
+	}
+	if err = ValidateChipRCAC(chain.rcac); err != nil {
+		t.Errorf("RCAC must be valid: %v", err)
+	}
+	if err = ValidateChipRCAC(chain.icac); err != internal.ChipErrorWrongCertType {
+		t.Errorf("ICAC is not a RCAC, got %v", err)
+	}
+
+	// 缺少 ICAC
+	set, noc = loadTestChain(t, chain, false)
+	if err = set.ValidateCert(noc, newOpCertContext()); err != internal.ChipErrorCACertNotFound {
+		t.Errorf("missing ICAC must fail, got %v", err)
+	}
+
+	// 要求的证书类型或者用途不匹配
+	set, noc = loadTestChain(t, chain, true)
+	icac := set.FindCert(noc.AuthKeyId)
+	if err = set.ValidateCert(icac, newOpCertContext()); err != internal.ChipErrorWrongCertType {
+		t.Errorf("ICAC is not a NOC, got %v", err)
+	}
+	context = newOpCertContext()
+	context.RequiredKeyPurposes |= KeyPurposeCodeSigning.Flag()
+	if err = set.ValidateCert(noc, context); err != internal.ChipErrorCertUsageNotAllowed {
+		t.Errorf("missing key purpose must fail, got %v", err)
+	}
+
+	// RCAC 没有作为信任锚加载
+	untrusted := NewChipCertificateSet()
+	for _, cert := range [][]byte{chain.rcac, chain.icac, chain.noc} {
+		if _, err = untrusted.LoadCert(cert, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = untrusted.ValidateCert(untrusted.GetLastCert(), newOpCertContext()); err != internal.ChipErrorCertNotTrusted {
+		t.Errorf("chain without trust anchor must fail, got %v", err)
+	}
+	if _, err = NewChipCertificateSet().LoadCert(chain.icac, CertDecodeFlagIsTrustAnchor); err != internal.ChipErrorCertNotTrusted {
+		t.Errorf("ICAC cannot be a trust anchor, got %v", err)
+	}
+
+	// 其它 Fabric 的 ICAC 签发的 NOC
+	other := newTestCertChain(t, testNodeId, testFabricId, lib.CATValues{})
+	set = NewChipCertificateSet()
+	for _, cert := range [][]byte{chain.rcac, chain.icac} {
+		if _, err = set.LoadCert(cert, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if noc, err = set.LoadCert(other.noc, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = set.ValidateCert(noc, newOpCertContext()); err != internal.ChipErrorCACertNotFound {
+		t.Errorf("NOC from another fabric must fail, got %v", err)
+	}
+}
+
+func TestChipCertificateSetValidity(t *testing.T) {
+	chain := newTestCertChain(t, testNodeId, testFabricId, lib.CATValues{})
+	set, noc := loadTestChain(t, chain, true)
+
+	context := newOpCertContext()
+	context.EffectiveTime = time.Date(2032, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := set.ValidateCert(noc, context); err != internal.ChipErrorCertExpired {
+		t.Errorf("expired chain must fail, got %v", err)
+	}
+	context.EffectiveTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := set.ValidateCert(noc, context); err != internal.ChipErrorCertNotValidYet {
+		t.Errorf("chain not yet valid must fail, got %v", err)
+	}
+	// 默认策略在时间未知时接受证书
+	context.EffectiveTime = time.Time{}
+	if err := set.ValidateCert(noc, context); err != nil {
+		t.Errorf("unknown time must be accepted by default: %v", err)
+	}
+
+	// 最后已知的正确时间只用来判断是否过期
+	context.SetEffectiveTimeFromLastKnownGoodTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := set.ValidateCert(noc, context); err != nil {
+		t.Errorf("last known good time before notBefore must be accepted: %v", err)
+	}
+	context.SetEffectiveTimeFromLastKnownGoodTime(time.Date(2032, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := set.ValidateCert(noc, context); err != nil {
+		t.Errorf("default policy must not enforce last known good time: %v", err)
+	}
+
+	policy := &testValidityPolicy{}
+	context.ValidityPolicy = policy
+	if err := set.ValidateCert(noc, context); err != nil || policy.mResults[0] != CertificateValidityExpiredAtLastKnownGoodTime {
+		t.Errorf("unexpected result %v: %v", policy.mResults, err)
+	}
+	policy.mResults = nil
+	context.SetEffectiveTime(testEffectiveTime)
+	if err := set.ValidateCert(noc, context); err != nil || policy.mResults[0] != CertificateValidityValid {
+		t.Errorf("unexpected result %v: %v", policy.mResults, err)
+	}
+
+	policy.mResults = nil
+	context.SetEffectiveTime(time.Date(2032, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := set.ValidateCert(noc, context); err != nil {
+		t.Errorf("policy must be able to accept expired certificates: %v", err)
+	}
+	if len(policy.mResults) != 3 || policy.mResults[0] != CertificateValidityExpired {
+		t.Errorf("policy must be applied to every certificate, got %v", policy.mResults)
+	}
+}
+
+func TestChipCertificateSetPathLenConstraint(t *testing.T) {
+	chain := newTestCertChain(t, testNodeId, testFabricId, lib.CATValues{})
+	rcac, err := DecodeChipCert(chain.rcac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重新签发 pathLen 为0的 RCAC，不允许再有 ICAC
+	rcac.CertFlags |= CertFlagPathLenConstraintPresent
+	rcac.PathLenConstraint = 0
+	constrained := signTestCert(t, rcac, chain.rootKeypair)
+	if err = ValidateChipRCAC(constrained); err != nil {
+		t.Fatal(err)
+	}
+	set := NewChipCertificateSet()
+	if _, err = set.LoadCert(constrained, CertDecodeFlagIsTrustAnchor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = set.LoadCert(chain.icac, 0); err != nil {
+		t.Fatal(err)
+	}
+	noc, err := set.LoadCert(chain.noc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = set.ValidateCert(noc, newOpCertContext()); err != internal.ChipErrorCertPathLenConstraintExceeded {
+		t.Errorf("path length constraint must be enforced, got %v", err)
+	}
+
+	// RCAC 签名错误
+	rcac.Signature[10] ^= 0xFF
+	if corrupted, err := EncodeChipCert(rcac); err != nil {
+		t.Fatal(err)
+	} else if err = ValidateChipRCAC(corrupted); err != internal.ChipErrorInvalidSignature {
+		t.Errorf("corrupted RCAC signature must fail, got %v", err)
+	}
+}
@@ -0,0 +1,420 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"testing"
+	"time"
+)
+
+const (
+	testNodeId   lib.NodeId   = 0xDEDEDEDE00010001
+	testFabricId lib.FabricId = 0xFAB000000000001D
+)
+
+type testCertChain struct {
+	rootKeypair *crypto.P256Keypair
+	icaKeypair  *crypto.P256Keypair
+	nodeKeypair *crypto.P256Keypair
+	// 证书的 X.509 DER 编码
+	rcacDER, icacDER, nocDER []byte
+	// 证书的 TLV 编码
+	rcac, icac, noc []byte
+}
+
+func newTestKeypair(t *testing.T) *crypto.P256Keypair {
+	t.Helper()
+	keypair := crypto.NewP256Keypair()
+	if err := keypair.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return keypair
+}
+
+func mustAdd(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestDN(t *testing.T, attrType AttributeType, value uint64) ChipDN {
+	t.Helper()
+	var dn ChipDN
+	mustAdd(t, dn.AddAttribute(attrType, value))
+	return dn
+}
+
+// newTestCertChain 生成 RCAC -> ICAC -> NOC 的证书链，有效期为 2021 年到 2031 年
+func newTestCertChain(t *testing.T, nodeId lib.NodeId, fabricId lib.FabricId, cats lib.CATValues) *testCertChain {
+	t.Helper()
+	chain := &testCertChain{rootKeypair: newTestKeypair(t), icaKeypair: newTestKeypair(t), nodeKeypair: newTestKeypair(t)}
+	start, _ := TimeToChipEpoch(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	end, _ := TimeToChipEpoch(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	rootDN := newTestDN(t, AttributeTypeMatterRCACId, 0xCACACACA00000001)
+	mustAdd(t, rootDN.AddAttribute(AttributeTypeMatterFabricId, uint64(fabricId)))
+	icaDN := newTestDN(t, AttributeTypeMatterICACId, 0xCACACACA00000002)
+	nodeDN := newTestDN(t, AttributeTypeMatterNodeId, uint64(nodeId))
+	mustAdd(t, nodeDN.AddAttribute(AttributeTypeMatterFabricId, uint64(fabricId)))
+	mustAdd(t, nodeDN.AddCATs(cats))
+
+	var err error
+	params := &X509CertRequestParams{SerialNumber: 1, ValidityStart: start, ValidityEnd: end, SubjectDN: rootDN, IssuerDN: rootDN}
+	if chain.rcacDER, err = NewRootX509Cert(params, chain.rootKeypair); err != nil {
+		t.Fatal(err)
+	}
+	params = &X509CertRequestParams{SerialNumber: 2, ValidityStart: start, ValidityEnd: end, SubjectDN: icaDN, IssuerDN: rootDN}
+	if chain.icacDER, err = NewICAX509Cert(params, chain.icaKeypair.Pubkey(), chain.rootKeypair); err != nil {
+		t.Fatal(err)
+	}
+	params = &X509CertRequestParams{SerialNumber: 0x8000, ValidityStart: start, ValidityEnd: end, SubjectDN: nodeDN, IssuerDN: icaDN}
+	if chain.nocDER, err = NewNodeOperationalX509Cert(params, chain.nodeKeypair.Pubkey(), chain.icaKeypair); err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range []struct {
+		der []byte
+		out *[]byte
+	}{{chain.rcacDER, &chain.rcac}, {chain.icacDER, &chain.icac}, {chain.nocDER, &chain.noc}} {
+		if *pair.out, err = ConvertX509CertToChipCert(pair.der); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chain
+}
+
+// signTestCert 对手工构造的证书签名并编码为 TLV
+func signTestCert(t *testing.T, cert *ChipCertificateData, issuerKeypair *crypto.P256Keypair) []byte {
+	t.Helper()
+	tbs, err := encodeTBSCert(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Signature, err = issuerKeypair.ECDSASignMsg(tbs); err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncodeChipCert(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestChipCertX509RoundTrip(t *testing.T) {
+	chain := newTestCertChain(t, testNodeId, testFabricId, lib.CATValues{0xABCD0001})
+	for _, pair := range [][2][]byte{{chain.rcac, chain.rcacDER}, {chain.icac, chain.icacDER}, {chain.noc, chain.nocDER}} {
+		der, err := ConvertChipCertToX509Cert(pair[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(der, pair[1]) {
+			t.Errorf("X.509 round trip mismatch")
+		}
+		if len(pair[0]) >= len(pair[1]) {
+			t.Errorf("TLV certificate must be smaller than DER: %d >= %d", len(pair[0]), len(pair[1]))
+		}
+	}
+
+	// 生成的证书可以被标准库解析和验证
+	root, err := x509.ParseCertificate(chain.rcacDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ica, err := x509.ParseCertificate(chain.icacDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noc, err := x509.ParseCertificate(chain.nocDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = root.CheckSignatureFrom(root); err != nil {
+		t.Errorf("root signature: %v", err)
+	}
+	if err = ica.CheckSignatureFrom(root); err != nil {
+		t.Errorf("ICA signature: %v", err)
+	}
+	if err = noc.CheckSignatureFrom(ica); err != nil {
+		t.Errorf("NOC signature: %v", err)
+	}
+	if !root.IsCA || noc.IsCA || noc.KeyUsage != x509.KeyUsageDigitalSignature || root.KeyUsage != x509.KeyUsageCertSign|x509.KeyUsageCRLSign {
+		t.Errorf("unexpected basic constraints or key usage")
+	}
+	if len(noc.ExtKeyUsage) != 2 || noc.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth || noc.ExtKeyUsage[1] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("unexpected extended key usage %v", noc.ExtKeyUsage)
+	}
+	if !bytes.Equal(noc.AuthorityKeyId, ica.SubjectKeyId) || noc.SerialNumber.Int64() != 0x8000 {
+		t.Errorf("unexpected key identifiers or serial number")
+	}
+	if noc.NotBefore.Year() != 2021 || noc.NotAfter.Year() != 2031 {
+		t.Errorf("unexpected validity %v %v", noc.NotBefore, noc.NotAfter)
+	}
+
+	// 标准库解析出的 DER 与转换结果一致
+	converted, err := ConvertX509CertToChipCert(noc.Raw)
+	if err != nil || !bytes.Equal(converted, chain.noc) {
+		t.Errorf("DER to TLV conversion mismatch: %v", err)
+	}
+}
+
+// connectedhomeip 的测试根证书 Chip-Test-PAA-NoVID-Cert ("Matter Test PAA")，
+// DER 为上游文件的内容，TLV 为按 Matter 规范逐字段编码的结果
+const (
+	kTestPAACertDER = "3082019130820137a00302010202070b8fbaa8dd86ee300a06082a8648ce3d040302301a3118301606035504030c0f4d61747465722054657374205041413020170d3231303632383134323334335a180f39393939313233313233353935395a301a3118301606035504030c0f4d61747465722054657374205041413059301306072a8648ce3d020106082a8648ce3d0301070342000410ef02a81a87b68121fba8d31978f807a317e50aa8a828446828914b933de8edd4a5c39c9ff71a4ce3647fd7f62653b7d2495fcba4c0f47f876880039e07204aa366306430120603551d130101ff040830060101ff020101300e0603551d0f0101ff040403020106301d0603551d0e04160414785ce705b86b8f4e6fc793aa60cb43ea696882d5301f0603551d23041830168014785ce705b86b8f4e6fc793aa60cb43ea696882d5300a06082a8648ce3d0403020348003045022100b9efdb3ea06a52ec0bf01e61daed2c2d156ddb6cf014101dab798fac05fa47e5022060061d3e35d60d9d4b0d448dad7612f7e85c582e3fc312dc18794dd373715e5d"
+	kTestPAACertTLV = "153001070b8fbaa8dd86ee24020137032c010f4d6174746572205465737420504141182604ef976c2824050037062c010f4d6174746572205465737420504141182407012408013009410410ef02a81a87b68121fba8d31978f807a317e50aa8a828446828914b933de8edd4a5c39c9ff71a4ce3647fd7f62653b7d2495fcba4c0f47f876880039e07204a370a3501290124020118240260300414785ce705b86b8f4e6fc793aa60cb43ea696882d5300514785ce705b86b8f4e6fc793aa60cb43ea696882d518300b40b9efdb3ea06a52ec0bf01e61daed2c2d156ddb6cf014101dab798fac05fa47e560061d3e35d60d9d4b0d448dad7612f7e85c582e3fc312dc18794dd373715e5d18"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestChipCertKnownVector(t *testing.T) {
+	der := mustDecodeHex(t, kTestPAACertDER)
+	chipCert := mustDecodeHex(t, kTestPAACertTLV)
+
+	converted, err := ConvertX509CertToChipCert(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(converted, chipCert) {
+		t.Errorf("DER to TLV mismatch:\n got %x\nwant %x", converted, chipCert)
+	}
+	convertedDER, err := ConvertChipCertToX509Cert(chipCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(convertedDER, der) {
+		t.Errorf("TLV to DER mismatch:\n got %x\nwant %x", convertedDER, der)
+	}
+
+	// 上游证书的签名可以被标准库验证
+	x509Cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = x509Cert.CheckSignatureFrom(x509Cert); err != nil {
+		t.Errorf("self signature: %v", err)
+	}
+
+	cert, err := DecodeChipCert(chipCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dn ChipDN
+	mustAdd(t, dn.AddAttributeString(AttributeTypeCommonName, "Matter Test PAA", false))
+	if !cert.SubjectDN.IsEqual(&dn) || !cert.IssuerDN.IsEqual(&dn) {
+		t.Errorf("unexpected subject %v or issuer %v", cert.SubjectDN.GetRDNs(), cert.IssuerDN.GetRDNs())
+	}
+	if !bytes.Equal(cert.SerialNumber, mustDecodeHex(t, "0b8fbaa8dd86ee")) {
+		t.Errorf("unexpected serial number %x", cert.SerialNumber)
+	}
+	if !ChipEpochToTime(cert.NotBeforeTime).Equal(time.Date(2021, 6, 28, 14, 23, 43, 0, time.UTC)) || cert.NotAfterTime != 0 {
+		t.Errorf("unexpected validity %d %d", cert.NotBeforeTime, cert.NotAfterTime)
+	}
+	if !bytes.Equal(cert.PublicKey[:], mustDecodeHex(t, "0410ef02a81a87b68121fba8d31978f807a317e50aa8a828446828914b933de8edd4a5c39c9ff71a4ce3647fd7f62653b7d2495fcba4c0f47f876880039e07204a")) {
+		t.Errorf("unexpected public key")
+	}
+	keyId := mustDecodeHex(t, "785ce705b86b8f4e6fc793aa60cb43ea696882d5")
+	if !bytes.Equal(cert.SubjectKeyId, keyId) || !bytes.Equal(cert.AuthKeyId, keyId) || !cert.IsSelfSigned() {
+		t.Errorf("unexpected key identifiers %x %x", cert.SubjectKeyId, cert.AuthKeyId)
+	}
+	if !cert.CertFlags.Has(CertFlagIsCA|CertFlagPathLenConstraintPresent) || cert.PathLenConstraint != 1 ||
+		cert.KeyUsageFlags != KeyUsageKeyCertSign|KeyUsageCRLSign {
+		t.Errorf("unexpected basic constraints or key usage")
+	}
+}
+
+func TestChipCertOptionalFields(t *testing.T) {
+	keypair := newTestKeypair(t)
+	var subject ChipDN
+	mustAdd(t, subject.AddAttributeString(AttributeTypeCommonName, "Matter Test", true))
+	mustAdd(t, subject.AddAttributeString(AttributeTypeOrganizationName, "组织", false))
+	mustAdd(t, subject.AddAttributeString(AttributeTypeDomainComponent, "example", false))
+	mustAdd(t, subject.AddAttribute(AttributeTypeMatterRCACId, 1))
+	// 2050 年之后使用 GeneralizedTime
+	notBefore, _ := TimeToChipEpoch(time.Date(2055, 6, 1, 12, 0, 0, 0, time.UTC))
+	futureExtension := encodeX509Extension([]int{1, 2, 3, 4}, false, derElement(derOctetString, []byte("future")))
+	cert := &ChipCertificateData{
+		SerialNumber:      []byte{0x01, 0x02, 0x03},
+		IssuerDN:          subject,
+		SubjectDN:         subject,
+		NotBeforeTime:     notBefore,
+		NotAfterTime:      KNullCertTime,
+		PublicKey:         keypair.Pubkey(),
+		SubjectKeyId:      keyIdentifier(keypair.Pubkey()),
+		AuthKeyId:         keyIdentifier(keypair.Pubkey()),
+		KeyUsageFlags:     KeyUsageKeyCertSign | KeyUsageDecipherOnly,
+		PathLenConstraint: 1,
+		FutureExtensions:  [][]byte{futureExtension},
+		CertFlags: CertFlagExtPresentBasicConstraints | CertFlagIsCA | CertFlagPathLenConstraintPresent |
+			CertFlagExtPresentKeyUsage | CertFlagExtPresentSubjectKeyId | CertFlagExtPresentAuthKeyId,
+	}
+	chipCert := signTestCert(t, cert, keypair)
+	der, err := ConvertChipCertToX509Cert(chipCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = parsed.CheckSignatureFrom(parsed); err != nil {
+		t.Errorf("signature: %v", err)
+	}
+	if parsed.Subject.CommonName != "Matter Test" || parsed.MaxPathLen != 1 || parsed.NotAfter.Year() != 9999 || parsed.NotBefore.Year() != 2055 {
+		t.Errorf("unexpected parsed certificate %v %d %v", parsed.Subject, parsed.MaxPathLen, parsed.NotAfter)
+	}
+	if parsed.KeyUsage != x509.KeyUsageCertSign|x509.KeyUsageDecipherOnly {
+		t.Errorf("unexpected key usage %v", parsed.KeyUsage)
+	}
+	back, err := ConvertX509CertToChipCert(der)
+	if err != nil || !bytes.Equal(back, chipCert) {
+		t.Fatalf("round trip mismatch: %v", err)
+	}
+	decoded, err := DecodeChipCert(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.SubjectDN.IsEqual(&subject) || len(decoded.FutureExtensions) != 1 || decoded.CertFlags.Has(CertFlagExtPresentFutureIsCritical) {
+		t.Errorf("unexpected decoded certificate")
+	}
+	if err = VerifyCertSignature(decoded, decoded); err != nil {
+		t.Errorf("decoded signature: %v", err)
+	}
+}
+
+func TestExtractFromOpCert(t *testing.T) {
+	cats := lib.CATValues{0x00010001, 0xFFFF0002}
+	chain := newTestCertChain(t, testNodeId, testFabricId, cats)
+	nodeId, fabricId, err := ExtractNodeIdFabricIdFromOpCertBytes(chain.noc)
+	if err != nil || nodeId != testNodeId || fabricId != testFabricId {
+		t.Errorf("unexpected node %x fabric %x: %v", nodeId, fabricId, err)
+	}
+	extracted, err := ExtractCATsFromOpCert(chain.noc)
+	if err != nil || extracted != cats {
+		t.Errorf("unexpected CATs %v: %v", extracted, err)
+	}
+	if _, _, err = ExtractNodeIdFabricIdFromOpCertBytes(chain.icac); err != internal.ChipErrorWrongCertType {
+		t.Errorf("ICAC is not an operational certificate, got %v", err)
+	}
+	rcac, err := DecodeChipCert(chain.rcac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fabricId, err = ExtractFabricIdFromCert(rcac); err != nil || fabricId != testFabricId {
+		t.Errorf("unexpected RCAC fabric %x: %v", fabricId, err)
+	}
+	icac, err := DecodeChipCert(chain.icac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ExtractFabricIdFromCert(icac); err != internal.ChipErrorNotFound {
+		t.Errorf("ICAC without fabric id must fail, got %v", err)
+	}
+	pubkey, err := ExtractPublicKeyFromChipCert(chain.noc)
+	if err != nil || pubkey != chain.nodeKeypair.Pubkey() {
+		t.Errorf("unexpected public key: %v", err)
+	}
+	skid, err := ExtractSKIDFromChipCert(chain.icac)
+	if err != nil || !bytes.Equal(skid, keyIdentifier(chain.icaKeypair.Pubkey())) {
+		t.Errorf("unexpected SKID: %v", err)
+	}
+}
+
+func TestChipDNGetCertType(t *testing.T) {
+	tests := []struct {
+		name     string
+		attrs    [][2]uint64
+		certType CertType
+		err      error
+	}{
+		{"root", [][2]uint64{{uint64(AttributeTypeMatterRCACId), 1}}, CertTypeRoot, nil},
+		{"node", [][2]uint64{{uint64(AttributeTypeMatterNodeId), 1}, {uint64(AttributeTypeMatterFabricId), 1}}, CertTypeNode, nil},
+		{"node without fabric", [][2]uint64{{uint64(AttributeTypeMatterNodeId), 1}}, CertTypeNotSpecified, internal.ChipErrorWrongCertDN},
+		{"non operational node", [][2]uint64{{uint64(AttributeTypeMatterNodeId), 0xFFFFFFFF00000001}, {uint64(AttributeTypeMatterFabricId), 1}},
+			CertTypeNotSpecified, internal.ChipErrorWrongNodeId},
+		{"two identities", [][2]uint64{{uint64(AttributeTypeMatterRCACId), 1}, {uint64(AttributeTypeMatterICACId), 2}}, CertTypeNotSpecified, internal.ChipErrorWrongCertDN},
+		{"CAT in root", [][2]uint64{{uint64(AttributeTypeMatterRCACId), 1}, {uint64(AttributeTypeMatterCASEAuthTag), 1}}, CertTypeNotSpecified, internal.ChipErrorWrongCertDN},
+		{"zero fabric", [][2]uint64{{uint64(AttributeTypeMatterICACId), 1}, {uint64(AttributeTypeMatterFabricId), 0}}, CertTypeNotSpecified, internal.ChipErrorWrongCertDN},
+	}
+	for _, test := range tests {
+		var dn ChipDN
+		for _, attr := range test.attrs {
+			mustAdd(t, dn.AddAttribute(AttributeType(attr[0]), attr[1]))
+		}
+		certType, err := dn.GetCertType()
+		if certType != test.certType || err != test.err {
+			t.Errorf("%s: got %v %v", test.name, certType, err)
+		}
+	}
+
+	var dn ChipDN
+	if err := dn.AddAttribute(AttributeTypeCommonName, 1); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("standard attribute must be a string")
+	}
+	if err := dn.AddAttribute(AttributeTypeMatterCASEAuthTag, 0x100000000); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("CAT must fit in 32 bits")
+	}
+	for i := 0; i < KMaxRDNAttributes; i++ {
+		mustAdd(t, dn.AddAttributeString(AttributeTypeCommonName, "name", false))
+	}
+	if err := dn.AddAttributeString(AttributeTypeCommonName, "name", false); err != internal.ChipErrorNoMemory {
+		t.Errorf("too many attributes must fail")
+	}
+}
+
+func TestDecodeChipCertErrors(t *testing.T) {
+	chain := newTestCertChain(t, testNodeId, testFabricId, lib.CATValues{})
+	if _, err := DecodeChipCert(chain.noc[:len(chain.noc)-1]); err == nil {
+		t.Errorf("truncated certificate must fail")
+	}
+	if _, err := DecodeChipCert(append(append([]byte{}, chain.noc...), chain.noc...)); err != internal.ChipErrorUnsupportedCertFormat {
+		t.Errorf("trailing data must fail, got %v", err)
+	}
+
+	// 签名算法和曲线的标签后是一字节的值
+	cert := append([]byte{}, chain.noc...)
+	index := bytes.Index(cert, []byte{0x24, tagSignatureAlgorithm, 0x01})
+	cert[index+2] = 0x02
+	if _, err := DecodeChipCert(cert); err != internal.ChipErrorUnsupportedSignatureType {
+		t.Errorf("unknown signature algorithm must fail, got %v", err)
+	}
+	cert = append([]byte{}, chain.noc...)
+	index = bytes.Index(cert, []byte{0x24, tagEllipticCurveId, 0x01})
+	cert[index+2] = 0x02
+	if _, err := DecodeChipCert(cert); err != internal.ChipErrorUnsupportedEllipticCurve {
+		t.Errorf("unknown curve must fail, got %v", err)
+	}
+
+	if _, err := ConvertX509CertToChipCert(chain.nocDER[:len(chain.nocDER)-2]); err != internal.ChipErrorUnsupportedCertFormat {
+		t.Errorf("truncated DER must fail, got %v", err)
+	}
+	// 修改 TBS 中 NOC 的 notAfter 导致签名无法验证
+	der := append([]byte{}, chain.nocDER...)
+	index = bytes.Index(der, []byte("310101000000Z"))
+	der[index+1] = '2'
+	converted, err := ConvertX509CertToChipCert(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeChipCert(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	icac, err := DecodeChipCert(chain.icac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyCertSignature(decoded, icac); err != internal.ChipErrorInvalidSignature {
+		t.Errorf("modified certificate must not verify, got %v", err)
+	}
+}
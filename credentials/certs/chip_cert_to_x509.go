@@ -0,0 +1,184 @@
+package certs
+
+import (
+	"encoding/asn1"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+)
+
+var (
+	oidSigAlgoECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidPubKeyAlgoECPublicKey  = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidEllipticCurvePrime256  = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+
+	oidExtensionBasicConstraints       = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionKeyUsage               = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage       = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionSubjectKeyIdentifier   = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+	keyPurposeOIDs = map[KeyPurpose]asn1.ObjectIdentifier{
+		KeyPurposeServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+		KeyPurposeClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+		KeyPurposeCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+		KeyPurposeEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+		KeyPurposeTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+		KeyPurposeOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	}
+)
+
+const (
+	kX509CertificateVersion3 = 2
+	// kX509NoWellDefinedExpirationDate 证书没有明确过期时间时使用的 notAfter
+	kX509NoWellDefinedExpirationDate = "99991231235959Z"
+)
+
+// ConvertChipCertToX509Cert 将 Matter TLV 证书转换为 X.509 DER 证书
+func ConvertChipCertToX509Cert(chipCert []byte) ([]byte, error) {
+	cert, err := DecodeChipCert(chipCert)
+	if err != nil {
+		return nil, err
+	}
+	return encodeX509Cert(cert)
+}
+
+func encodeX509Cert(cert *ChipCertificateData) ([]byte, error) {
+	tbs, err := encodeTBSCert(cert)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypto.EcdsaRawSignatureToAsn1(cert.Signature)
+	if err != nil {
+		return nil, err
+	}
+	x509Cert := derElement(derSequence,
+		tbs,
+		derElement(derSequence, derObjectIdentifier(oidSigAlgoECDSAWithSHA256)),
+		derElement(derBitString, []byte{0}, signature),
+	)
+	if len(x509Cert) > KMaxDERCertLength {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	return x509Cert, nil
+}
+
+// encodeTBSCert 编码 X.509 的 TBSCertificate，证书的签名是对它的签名
+func encodeTBSCert(cert *ChipCertificateData) ([]byte, error) {
+	notBefore, err := encodeX509Time(cert.NotBeforeTime)
+	if err != nil {
+		return nil, err
+	}
+	notAfter, err := encodeX509Time(cert.NotAfterTime)
+	if err != nil {
+		return nil, err
+	}
+	contents := [][]byte{
+		derElement(derContext0, derElement(derInteger, []byte{kX509CertificateVersion3})),
+		derElement(derInteger, cert.SerialNumber),
+		derElement(derSequence, derObjectIdentifier(oidSigAlgoECDSAWithSHA256)),
+		cert.IssuerDN.encodeASN1(),
+		derElement(derSequence, notBefore, notAfter),
+		cert.SubjectDN.encodeASN1(),
+		derElement(derSequence,
+			derElement(derSequence, derObjectIdentifier(oidPubKeyAlgoECPublicKey), derObjectIdentifier(oidEllipticCurvePrime256)),
+			derElement(derBitString, []byte{0}, cert.PublicKey[:]),
+		),
+	}
+	if extensions := encodeX509Extensions(cert); len(extensions) > 0 {
+		contents = append(contents, derElement(derContext3, derElement(derSequence, extensions...)))
+	}
+	return derElement(derSequence, contents...), nil
+}
+
+// encodeX509Time 2050年之前使用 UTCTime，之后使用 GeneralizedTime
+func encodeX509Time(chipEpochTime uint32) ([]byte, error) {
+	if chipEpochTime == KNullCertTime {
+		return derElement(derGeneralizedTime, []byte(kX509NoWellDefinedExpirationDate)), nil
+	}
+	t := ChipEpochToTime(chipEpochTime)
+	if t.Year() < 2050 {
+		return derElement(derUTCTime, []byte(t.Format("060102150405Z"))), nil
+	}
+	return derElement(derGeneralizedTime, []byte(t.Format("20060102150405Z"))), nil
+}
+
+func encodeX509Extension(oid asn1.ObjectIdentifier, critical bool, value []byte) []byte {
+	if critical {
+		return derElement(derSequence, derObjectIdentifier(oid), derElement(derBoolean, []byte{0xFF}), derElement(derOctetString, value))
+	}
+	return derElement(derSequence, derObjectIdentifier(oid), derElement(derOctetString, value))
+}
+
+func encodeX509Extensions(cert *ChipCertificateData) [][]byte {
+	var extensions [][]byte
+	if cert.CertFlags.Has(CertFlagExtPresentBasicConstraints) {
+		var contents [][]byte
+		if cert.CertFlags.Has(CertFlagIsCA) {
+			contents = append(contents, derElement(derBoolean, []byte{0xFF}))
+		}
+		if cert.CertFlags.Has(CertFlagPathLenConstraintPresent) {
+			contents = append(contents, derElement(derInteger, encodeDERUint(uint64(cert.PathLenConstraint))))
+		}
+		extensions = append(extensions, encodeX509Extension(oidExtensionBasicConstraints, true, derElement(derSequence, contents...)))
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentKeyUsage) {
+		extensions = append(extensions, encodeX509Extension(oidExtensionKeyUsage, true, encodeKeyUsageBitString(cert.KeyUsageFlags)))
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentExtendedKeyUsage) {
+		var purposes [][]byte
+		for _, purpose := range cert.KeyPurposes {
+			purposes = append(purposes, derObjectIdentifier(keyPurposeOIDs[purpose]))
+		}
+		extensions = append(extensions, encodeX509Extension(oidExtensionExtendedKeyUsage, true, derElement(derSequence, purposes...)))
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentSubjectKeyId) {
+		extensions = append(extensions, encodeX509Extension(oidExtensionSubjectKeyIdentifier, false, derElement(derOctetString, cert.SubjectKeyId)))
+	}
+	if cert.CertFlags.Has(CertFlagExtPresentAuthKeyId) {
+		extensions = append(extensions, encodeX509Extension(oidExtensionAuthorityKeyIdentifier, false,
+			derElement(derSequence, derElement(derContextPrimitive0, cert.AuthKeyId))))
+	}
+	return append(extensions, cert.FutureExtensions...)
+}
+
+// encodeDERUint 非负整数的 DER INTEGER 内容
+func encodeDERUint(value uint64) []byte {
+	var b []byte
+	for ; value > 0; value >>= 8 {
+		b = append([]byte{byte(value)}, b...)
+	}
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+// encodeKeyUsageBitString KeyUsage 的第 i 位对应 BIT STRING 的第 i 位，去掉末尾为0的位
+func encodeKeyUsageBitString(flags KeyUsageFlags) []byte {
+	var bits []byte
+	for i := 0; i < 9; i++ {
+		if flags&(1<<i) == 0 {
+			continue
+		}
+		for len(bits) <= i/8 {
+			bits = append(bits, 0)
+		}
+		bits[i/8] |= 0x80 >> (i % 8)
+	}
+	unused := 0
+	if len(bits) > 0 {
+		for last := bits[len(bits)-1]; last&(1<<unused) == 0; unused++ {
+		}
+	}
+	return derElement(derBitString, []byte{byte(unused)}, bits)
+}
+
+// parseFutureExtension 检查未知扩展的格式，返回它是否为关键扩展
+func parseFutureExtension(extension []byte) (bool, error) {
+	raw, err := derParse(extension)
+	if err != nil {
+		return false, err
+	}
+	_, critical, _, err := parseX509Extension(raw)
+	return critical, err
+}
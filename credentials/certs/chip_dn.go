@@ -0,0 +1,468 @@
+package certs
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// KMaxRDNAttributes 证书 DN 中最多的属性数量
+const KMaxRDNAttributes = 5
+
+// kPrintableStringTagFlag TLV 标签加上该值表示属性在 X.509 中使用 PrintableString 编码
+const kPrintableStringTagFlag uint8 = 0x80
+
+// AttributeType DN 属性的类型，值为属性在 Matter TLV 证书中的标签号
+type AttributeType uint8
+
+const (
+	AttributeTypeCommonName             AttributeType = 1
+	AttributeTypeSurname                AttributeType = 2
+	AttributeTypeSerialNumber           AttributeType = 3
+	AttributeTypeCountryName            AttributeType = 4
+	AttributeTypeLocalityName           AttributeType = 5
+	AttributeTypeStateOrProvinceName    AttributeType = 6
+	AttributeTypeOrganizationName       AttributeType = 7
+	AttributeTypeOrganizationalUnitName AttributeType = 8
+	AttributeTypeTitle                  AttributeType = 9
+	AttributeTypeName                   AttributeType = 10
+	AttributeTypeGivenName              AttributeType = 11
+	AttributeTypeInitials               AttributeType = 12
+	AttributeTypeGenerationQualifier    AttributeType = 13
+	AttributeTypeDNQualifier            AttributeType = 14
+	AttributeTypePseudonym              AttributeType = 15
+	AttributeTypeDomainComponent        AttributeType = 16
+
+	AttributeTypeMatterNodeId            AttributeType = 17
+	AttributeTypeMatterFirmwareSigningId AttributeType = 18
+	AttributeTypeMatterICACId            AttributeType = 19
+	AttributeTypeMatterRCACId            AttributeType = 20
+	AttributeTypeMatterFabricId          AttributeType = 21
+	AttributeTypeMatterCASEAuthTag       AttributeType = 22
+)
+
+var attributeTypeOIDs = map[AttributeType]asn1.ObjectIdentifier{
+	AttributeTypeCommonName:             {2, 5, 4, 3},
+	AttributeTypeSurname:                {2, 5, 4, 4},
+	AttributeTypeSerialNumber:           {2, 5, 4, 5},
+	AttributeTypeCountryName:            {2, 5, 4, 6},
+	AttributeTypeLocalityName:           {2, 5, 4, 7},
+	AttributeTypeStateOrProvinceName:    {2, 5, 4, 8},
+	AttributeTypeOrganizationName:       {2, 5, 4, 10},
+	AttributeTypeOrganizationalUnitName: {2, 5, 4, 11},
+	AttributeTypeTitle:                  {2, 5, 4, 12},
+	AttributeTypeName:                   {2, 5, 4, 41},
+	AttributeTypeGivenName:              {2, 5, 4, 42},
+	AttributeTypeInitials:               {2, 5, 4, 43},
+	AttributeTypeGenerationQualifier:    {2, 5, 4, 44},
+	AttributeTypeDNQualifier:            {2, 5, 4, 46},
+	AttributeTypePseudonym:              {2, 5, 4, 65},
+	AttributeTypeDomainComponent:        {0, 9, 2342, 19200300, 100, 1, 25},
+
+	AttributeTypeMatterNodeId:            {1, 3, 6, 1, 4, 1, 37244, 1, 1},
+	AttributeTypeMatterFirmwareSigningId: {1, 3, 6, 1, 4, 1, 37244, 1, 2},
+	AttributeTypeMatterICACId:            {1, 3, 6, 1, 4, 1, 37244, 1, 3},
+	AttributeTypeMatterRCACId:            {1, 3, 6, 1, 4, 1, 37244, 1, 4},
+	AttributeTypeMatterFabricId:          {1, 3, 6, 1, 4, 1, 37244, 1, 5},
+	AttributeTypeMatterCASEAuthTag:       {1, 3, 6, 1, 4, 1, 37244, 1, 6},
+}
+
+// IsMatterAttribute Matter 定义的属性，值为整数，在 X.509 中编码为大写十六进制的 UTF8String
+func (t AttributeType) IsMatterAttribute() bool {
+	return t >= AttributeTypeMatterNodeId && t <= AttributeTypeMatterCASEAuthTag
+}
+
+func (t AttributeType) isValid() bool {
+	return t >= AttributeTypeCommonName && t <= AttributeTypeMatterCASEAuthTag
+}
+
+// matterAttributeHexLength Matter 属性在 X.509 中的十六进制字符数
+func (t AttributeType) matterAttributeHexLength() int {
+	if t == AttributeTypeMatterCASEAuthTag {
+		return 8
+	}
+	return 16
+}
+
+func attributeTypeFromOID(oid asn1.ObjectIdentifier) (AttributeType, bool) {
+	for attrType, attrOID := range attributeTypeOIDs {
+		if attrOID.Equal(oid) {
+			return attrType, true
+		}
+	}
+	return 0, false
+}
+
+// CertType 由主题 DN 决定的证书类型
+type CertType uint8
+
+const (
+	CertTypeNotSpecified CertType = iota
+	CertTypeRoot
+	CertTypeICA
+	CertTypeNode
+	CertTypeFirmwareSigning
+)
+
+func (t CertType) String() string {
+	switch t {
+	case CertTypeRoot:
+		return "RCAC"
+	case CertTypeICA:
+		return "ICAC"
+	case CertTypeNode:
+		return "NOC"
+	case CertTypeFirmwareSigning:
+		return "FirmwareSigning"
+	default:
+		return "NotSpecified"
+	}
+}
+
+// ChipRDN DN 中的一个属性，Matter 属性使用 ChipVal，其它属性使用 String
+type ChipRDN struct {
+	Type              AttributeType
+	ChipVal           uint64
+	String            string
+	IsPrintableString bool
+}
+
+// ChipDN 证书的主题或颁发者，每个 RDN 只包含一个属性
+type ChipDN struct {
+	mRDNs []ChipRDN
+}
+
+// AddAttribute 添加一个 Matter 属性
+func (d *ChipDN) AddAttribute(attrType AttributeType, value uint64) error {
+	if !attrType.IsMatterAttribute() {
+		return internal.ChipErrorInvalidArgument
+	}
+	if attrType == AttributeTypeMatterCASEAuthTag && value > 0xFFFFFFFF {
+		return internal.ChipErrorInvalidArgument
+	}
+	return d.addRDN(ChipRDN{Type: attrType, ChipVal: value})
+}
+
+// AddAttributeString 添加一个字符串属性，isPrintable 表示在 X.509 中使用 PrintableString 编码
+func (d *ChipDN) AddAttributeString(attrType AttributeType, value string, isPrintable bool) error {
+	if !attrType.isValid() || attrType.IsMatterAttribute() || !utf8.ValidString(value) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if isPrintable && attrType == AttributeTypeDomainComponent {
+		return internal.ChipErrorInvalidArgument
+	}
+	return d.addRDN(ChipRDN{Type: attrType, String: value, IsPrintableString: isPrintable})
+}
+
+// AddCATs 添加 NOC 主题中的 CAT，值为0的位置被忽略
+func (d *ChipDN) AddCATs(cats lib.CATValues) error {
+	for _, cat := range cats {
+		if cat == 0 {
+			continue
+		}
+		if err := d.AddAttribute(AttributeTypeMatterCASEAuthTag, uint64(cat)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *ChipDN) addRDN(rdn ChipRDN) error {
+	if len(d.mRDNs) >= KMaxRDNAttributes {
+		return internal.ChipErrorNoMemory
+	}
+	d.mRDNs = append(d.mRDNs, rdn)
+	return nil
+}
+
+func (d *ChipDN) RDNCount() int {
+	return len(d.mRDNs)
+}
+
+// GetRDNs 返回 DN 中属性的拷贝
+func (d *ChipDN) GetRDNs() []ChipRDN {
+	return append([]ChipRDN{}, d.mRDNs...)
+}
+
+func (d *ChipDN) IsEmpty() bool {
+	return len(d.mRDNs) == 0
+}
+
+// IsEqual 两个 DN 的属性及其顺序完全相同
+func (d *ChipDN) IsEqual(other *ChipDN) bool {
+	if len(d.mRDNs) != len(other.mRDNs) {
+		return false
+	}
+	for i := range d.mRDNs {
+		if d.mRDNs[i] != other.mRDNs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetCertType 根据 DN 中的 Matter 属性确定证书类型，
+// NOC 必须包含 FabricId，只有 NOC 可以包含 CAT
+func (d *ChipDN) GetCertType() (CertType, error) {
+	certType := CertTypeNotSpecified
+	fabricIdPresent := false
+	catsPresent := false
+	setType := func(t CertType) error {
+		if certType != CertTypeNotSpecified {
+			return internal.ChipErrorWrongCertDN
+		}
+		certType = t
+		return nil
+	}
+	for _, rdn := range d.mRDNs {
+		var err error
+		switch rdn.Type {
+		case AttributeTypeMatterRCACId:
+			err = setType(CertTypeRoot)
+		case AttributeTypeMatterICACId:
+			err = setType(CertTypeICA)
+		case AttributeTypeMatterNodeId:
+			if !lib.NodeId(rdn.ChipVal).IsOperationalNodeId() {
+				return CertTypeNotSpecified, internal.ChipErrorWrongNodeId
+			}
+			err = setType(CertTypeNode)
+		case AttributeTypeMatterFirmwareSigningId:
+			err = setType(CertTypeFirmwareSigning)
+		case AttributeTypeMatterFabricId:
+			if fabricIdPresent || rdn.ChipVal == uint64(lib.KUndefinedFabricId) {
+				return CertTypeNotSpecified, internal.ChipErrorWrongCertDN
+			}
+			fabricIdPresent = true
+		case AttributeTypeMatterCASEAuthTag:
+			catsPresent = true
+		}
+		if err != nil {
+			return CertTypeNotSpecified, err
+		}
+	}
+	if certType == CertTypeNode {
+		if !fabricIdPresent {
+			return CertTypeNotSpecified, internal.ChipErrorWrongCertDN
+		}
+	} else if catsPresent {
+		return CertTypeNotSpecified, internal.ChipErrorWrongCertDN
+	}
+	return certType, nil
+}
+
+// GetCertChipId 返回 RCAC、ICAC、NOC 或固件签名证书的 Matter ID
+func (d *ChipDN) GetCertChipId() (uint64, error) {
+	var chipId uint64
+	found := false
+	for _, rdn := range d.mRDNs {
+		switch rdn.Type {
+		case AttributeTypeMatterRCACId, AttributeTypeMatterICACId, AttributeTypeMatterNodeId, AttributeTypeMatterFirmwareSigningId:
+			if found {
+				return 0, internal.ChipErrorWrongCertDN
+			}
+			chipId, found = rdn.ChipVal, true
+		}
+	}
+	if !found {
+		return 0, internal.ChipErrorWrongCertDN
+	}
+	return chipId, nil
+}
+
+// GetCertFabricId 返回 DN 中的 FabricId，没有时返回 KUndefinedFabricId
+func (d *ChipDN) GetCertFabricId() (lib.FabricId, error) {
+	fabricId := lib.KUndefinedFabricId
+	for _, rdn := range d.mRDNs {
+		if rdn.Type != AttributeTypeMatterFabricId {
+			continue
+		}
+		if fabricId != lib.KUndefinedFabricId {
+			return lib.KUndefinedFabricId, internal.ChipErrorWrongCertDN
+		}
+		fabricId = lib.FabricId(rdn.ChipVal)
+	}
+	return fabricId, nil
+}
+
+// GetCATs 返回 DN 中的 CAT
+func (d *ChipDN) GetCATs() (lib.CATValues, error) {
+	var cats lib.CATValues
+	count := 0
+	for _, rdn := range d.mRDNs {
+		if rdn.Type != AttributeTypeMatterCASEAuthTag {
+			continue
+		}
+		if count >= lib.KMaxSubjectCATAttributeCount {
+			return cats, internal.ChipErrorWrongCertDN
+		}
+		cats[count] = lib.CASEAuthTag(rdn.ChipVal)
+		count++
+	}
+	return cats, nil
+}
+
+// encodeTLV 将 DN 编码为 TLV 列表
+func (d *ChipDN) encodeTLV(w *tlv.Writer, tag tlv.Tag) error {
+	if err := w.StartList(tag); err != nil {
+		return err
+	}
+	for _, rdn := range d.mRDNs {
+		var err error
+		if rdn.Type.IsMatterAttribute() {
+			err = w.PutUint(tlv.ContextTag(uint8(rdn.Type)), rdn.ChipVal)
+		} else {
+			tagNum := uint8(rdn.Type)
+			if rdn.IsPrintableString {
+				tagNum |= kPrintableStringTagFlag
+			}
+			err = w.PutString(tlv.ContextTag(tagNum), rdn.String)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return w.EndContainer()
+}
+
+// decodeTLV 从当前的 TLV 列表元素解码 DN
+func (d *ChipDN) decodeTLV(r *tlv.Reader) error {
+	if r.GetType() != tlv.TypeList {
+		return internal.ChipErrorWrongTLVType
+	}
+	if err := r.EnterContainer(); err != nil {
+		return err
+	}
+	d.mRDNs = nil
+	for {
+		err := r.Next()
+		if err == internal.ChipErrorEndOfTLV {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !r.GetTag().IsContext() {
+			return internal.ChipErrorUnexpectedTLVElement
+		}
+		tagNum := uint8(r.GetTag().GetNumber())
+		attrType := AttributeType(tagNum &^ kPrintableStringTagFlag)
+		isPrintable := tagNum&kPrintableStringTagFlag != 0
+		if !attrType.isValid() || (isPrintable && attrType.IsMatterAttribute()) {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		if attrType.IsMatterAttribute() {
+			value, err := r.GetUint()
+			if err != nil {
+				return err
+			}
+			err = d.AddAttribute(attrType, value)
+		} else {
+			value, err := r.GetString()
+			if err != nil {
+				return err
+			}
+			err = d.AddAttributeString(attrType, value, isPrintable)
+		}
+		if err != nil {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+	}
+	return r.ExitContainer()
+}
+
+// encodeASN1 将 DN 编码为 X.509 的 Name
+func (d *ChipDN) encodeASN1() []byte {
+	var rdns [][]byte
+	for _, rdn := range d.mRDNs {
+		var value []byte
+		switch {
+		case rdn.Type.IsMatterAttribute():
+			value = derElement(derUTF8String, []byte(fmt.Sprintf("%0*X", rdn.Type.matterAttributeHexLength(), rdn.ChipVal)))
+		case rdn.IsPrintableString:
+			value = derElement(derPrintableString, []byte(rdn.String))
+		case rdn.Type == AttributeTypeDomainComponent:
+			value = derElement(derIA5String, []byte(rdn.String))
+		default:
+			value = derElement(derUTF8String, []byte(rdn.String))
+		}
+		attr := derElement(derSequence, derObjectIdentifier(attributeTypeOIDs[rdn.Type]), value)
+		rdns = append(rdns, derElement(derSet, attr))
+	}
+	return derElement(derSequence, rdns...)
+}
+
+// decodeASN1 从 X.509 的 Name 解码 DN，每个 RDN 只能有一个属性
+func (d *ChipDN) decodeASN1(name asn1.RawValue) error {
+	if derIdentifier(name) != derSequence {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	rdns, err := derChildren(name)
+	if err != nil {
+		return err
+	}
+	d.mRDNs = nil
+	for _, rdn := range rdns {
+		if derIdentifier(rdn) != derSet {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		attrs, err := derChildren(rdn)
+		if err != nil {
+			return err
+		}
+		if len(attrs) != 1 || derIdentifier(attrs[0]) != derSequence {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		fields, err := derChildren(attrs[0])
+		if err != nil {
+			return err
+		}
+		if len(fields) != 2 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		oid, err := derParseOID(fields[0])
+		if err != nil {
+			return err
+		}
+		attrType, ok := attributeTypeFromOID(oid)
+		if !ok {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		if err := d.addASN1Attribute(attrType, fields[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *ChipDN) addASN1Attribute(attrType AttributeType, value asn1.RawValue) error {
+	valueTag := derIdentifier(value)
+	if attrType.IsMatterAttribute() {
+		str := string(value.Bytes)
+		if valueTag != derUTF8String || len(str) != attrType.matterAttributeHexLength() || strings.ToUpper(str) != str {
+			return internal.ChipErrorWrongCertDN
+		}
+		chipVal, err := strconv.ParseUint(str, 16, 64)
+		if err != nil {
+			return internal.ChipErrorWrongCertDN
+		}
+		if err := d.AddAttribute(attrType, chipVal); err != nil {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		return nil
+	}
+	switch {
+	case attrType == AttributeTypeDomainComponent && valueTag == derIA5String:
+	case attrType != AttributeTypeDomainComponent && (valueTag == derUTF8String || valueTag == derPrintableString):
+	default:
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	if err := d.AddAttributeString(attrType, string(value.Bytes), valueTag == derPrintableString); err != nil {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package certs
+
+import (
+	"encoding/asn1"
+	"github.com/galenliu/chip/internal"
+)
+
+// X.509 转换用到的 DER 标签
+const (
+	derBoolean         byte = 0x01
+	derInteger         byte = 0x02
+	derBitString       byte = 0x03
+	derOctetString     byte = 0x04
+	derOID             byte = 0x06
+	derUTF8String      byte = 0x0C
+	derPrintableString byte = 0x13
+	derIA5String       byte = 0x16
+	derUTCTime         byte = 0x17
+	derGeneralizedTime byte = 0x18
+	derSequence        byte = 0x30
+	derSet             byte = 0x31
+	// derContext0 [0] 构造类型，用于证书版本
+	derContext0 byte = 0xA0
+	// derContext3 [3] 构造类型，用于证书扩展
+	derContext3 byte = 0xA3
+	// derContextPrimitive0 [0] IMPLICIT 基本类型，用于 AuthorityKeyIdentifier
+	derContextPrimitive0 byte = 0x80
+)
+
+// derElement 编码一个 DER 元素，内容为 contents 的拼接
+func derElement(tag byte, contents ...[]byte) []byte {
+	length := 0
+	for _, content := range contents {
+		length += len(content)
+	}
+	out := append([]byte{tag}, derLength(length)...)
+	for _, content := range contents {
+		out = append(out, content...)
+	}
+	return out
+}
+
+func derLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var b []byte
+	for ; length > 0; length >>= 8 {
+		b = append([]byte{byte(length)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func derObjectIdentifier(oid asn1.ObjectIdentifier) []byte {
+	data, _ := asn1.Marshal(oid)
+	return data
+}
+
+// derParse 解析一个完整的 DER 元素，不允许有多余的数据
+func derParse(data []byte) (asn1.RawValue, error) {
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(data, &raw)
+	if err != nil || len(rest) != 0 {
+		return raw, internal.ChipErrorUnsupportedCertFormat
+	}
+	return raw, nil
+}
+
+// derChildren 返回构造类型元素的子元素
+func derChildren(raw asn1.RawValue) ([]asn1.RawValue, error) {
+	if !raw.IsCompound {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	var children []asn1.RawValue
+	rest := raw.Bytes
+	for len(rest) > 0 {
+		var child asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &child); err != nil {
+			return nil, internal.ChipErrorUnsupportedCertFormat
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// derIdentifier 元素的标识字节，只支持单字节的标签号
+func derIdentifier(raw asn1.RawValue) byte {
+	identifier := byte(raw.Class<<6) | byte(raw.Tag)
+	if raw.IsCompound {
+		identifier |= 0x20
+	}
+	return identifier
+}
+
+func derParseOID(raw asn1.RawValue) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	if derIdentifier(raw) != derOID {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	if _, err := asn1.Unmarshal(raw.FullBytes, &oid); err != nil {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	return oid, nil
+}
@@ -0,0 +1,372 @@
+package certs
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"time"
+)
+
+// ConvertX509CertToChipCert 将 X.509 DER 证书转换为 Matter TLV 证书，
+// 证书必须符合 Matter 的证书格式，转换后重新编码的 TBSCertificate 必须与原证书相同，以保证签名仍然有效
+func ConvertX509CertToChipCert(x509Cert []byte) ([]byte, error) {
+	if len(x509Cert) > KMaxDERCertLength {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	raw, err := derParse(x509Cert)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := derChildren(raw)
+	if err != nil {
+		return nil, err
+	}
+	if derIdentifier(raw) != derSequence || len(fields) != 3 {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	cert := &ChipCertificateData{}
+	if err = decodeTBSCert(fields[0], cert); err != nil {
+		return nil, err
+	}
+	if err = decodeSignatureAlgorithm(fields[1]); err != nil {
+		return nil, err
+	}
+	signature := fields[2]
+	if derIdentifier(signature) != derBitString || len(signature.Bytes) < 1 || signature.Bytes[0] != 0 {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	if cert.Signature, err = crypto.EcdsaAsn1SignatureToRaw(signature.Bytes[1:]); err != nil {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	tbs, err := encodeTBSCert(cert)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tbs, fields[0].FullBytes) {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	return EncodeChipCert(cert)
+}
+
+func decodeTBSCert(raw asn1.RawValue, cert *ChipCertificateData) error {
+	fields, err := derChildren(raw)
+	if err != nil {
+		return err
+	}
+	if derIdentifier(raw) != derSequence || len(fields) < 7 || len(fields) > 8 {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	// 版本必须是 v3
+	version := fields[0]
+	if derIdentifier(version) != derContext0 || !bytes.Equal(version.Bytes, []byte{derInteger, 1, kX509CertificateVersion3}) {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	serialNumber := fields[1]
+	if derIdentifier(serialNumber) != derInteger || len(serialNumber.Bytes) == 0 || len(serialNumber.Bytes) > KMaxCertificateSerialNumberLength {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	cert.SerialNumber = append([]byte{}, serialNumber.Bytes...)
+	if err = decodeSignatureAlgorithm(fields[2]); err != nil {
+		return err
+	}
+	if err = cert.IssuerDN.decodeASN1(fields[3]); err != nil {
+		return err
+	}
+	if err = decodeValidity(fields[4], cert); err != nil {
+		return err
+	}
+	if err = cert.SubjectDN.decodeASN1(fields[5]); err != nil {
+		return err
+	}
+	if err = decodeSubjectPublicKeyInfo(fields[6], cert); err != nil {
+		return err
+	}
+	if len(fields) == 8 {
+		return decodeX509Extensions(fields[7], cert)
+	}
+	return nil
+}
+
+func decodeSignatureAlgorithm(raw asn1.RawValue) error {
+	fields, err := derChildren(raw)
+	if err != nil {
+		return err
+	}
+	if derIdentifier(raw) != derSequence || len(fields) != 1 {
+		return internal.ChipErrorUnsupportedSignatureType
+	}
+	oid, err := derParseOID(fields[0])
+	if err != nil {
+		return err
+	}
+	if !oid.Equal(oidSigAlgoECDSAWithSHA256) {
+		return internal.ChipErrorUnsupportedSignatureType
+	}
+	return nil
+}
+
+func decodeValidity(raw asn1.RawValue, cert *ChipCertificateData) error {
+	fields, err := derChildren(raw)
+	if err != nil {
+		return err
+	}
+	if derIdentifier(raw) != derSequence || len(fields) != 2 {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	if cert.NotBeforeTime, err = decodeX509Time(fields[0]); err != nil {
+		return err
+	}
+	cert.NotAfterTime, err = decodeX509Time(fields[1])
+	return err
+}
+
+// decodeX509Time 解析 UTCTime 或 GeneralizedTime，99991231235959Z 表示没有明确的过期时间
+func decodeX509Time(raw asn1.RawValue) (uint32, error) {
+	value := string(raw.Bytes)
+	switch derIdentifier(raw) {
+	case derUTCTime:
+		if len(value) != 13 {
+			return 0, internal.ChipErrorUnsupportedCertFormat
+		}
+		// RFC 5280 中 UTCTime 的年份 50-99 表示 19xx，早于 Matter 纪元
+		if value[0] >= '5' {
+			return 0, internal.ChipErrorUnsupportedCertFormat
+		}
+		value = "20" + value
+	case derGeneralizedTime:
+		if value == kX509NoWellDefinedExpirationDate {
+			return KNullCertTime, nil
+		}
+		if len(value) != 15 {
+			return 0, internal.ChipErrorUnsupportedCertFormat
+		}
+	default:
+		return 0, internal.ChipErrorUnsupportedCertFormat
+	}
+	t, err := time.Parse("20060102150405Z", value)
+	if err != nil {
+		return 0, internal.ChipErrorUnsupportedCertFormat
+	}
+	chipEpochTime, err := TimeToChipEpoch(t)
+	if err != nil {
+		return 0, internal.ChipErrorUnsupportedCertFormat
+	}
+	return chipEpochTime, nil
+}
+
+func decodeSubjectPublicKeyInfo(raw asn1.RawValue, cert *ChipCertificateData) error {
+	fields, err := derChildren(raw)
+	if err != nil {
+		return err
+	}
+	if derIdentifier(raw) != derSequence || len(fields) != 2 {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	algorithm, err := derChildren(fields[0])
+	if err != nil {
+		return err
+	}
+	if len(algorithm) != 2 {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	algoOID, err := derParseOID(algorithm[0])
+	if err != nil {
+		return err
+	}
+	if !algoOID.Equal(oidPubKeyAlgoECPublicKey) {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	curveOID, err := derParseOID(algorithm[1])
+	if err != nil {
+		return err
+	}
+	if !curveOID.Equal(oidEllipticCurvePrime256) {
+		return internal.ChipErrorUnsupportedEllipticCurve
+	}
+	publicKey := fields[1]
+	if derIdentifier(publicKey) != derBitString || len(publicKey.Bytes) < 1 || publicKey.Bytes[0] != 0 {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	if cert.PublicKey, err = crypto.NewP256PublicKey(publicKey.Bytes[1:]); err != nil {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	return nil
+}
+
+// parseX509Extension 解析 Extension ::= SEQUENCE { extnID, critical BOOLEAN DEFAULT FALSE, extnValue OCTET STRING }
+func parseX509Extension(raw asn1.RawValue) (asn1.ObjectIdentifier, bool, asn1.RawValue, error) {
+	var value asn1.RawValue
+	fields, err := derChildren(raw)
+	if err != nil {
+		return nil, false, value, err
+	}
+	if derIdentifier(raw) != derSequence || len(fields) < 2 || len(fields) > 3 {
+		return nil, false, value, internal.ChipErrorUnsupportedCertFormat
+	}
+	oid, err := derParseOID(fields[0])
+	if err != nil {
+		return nil, false, value, err
+	}
+	critical := false
+	if len(fields) == 3 {
+		// DER 中默认值 FALSE 不编码
+		if derIdentifier(fields[1]) != derBoolean || !bytes.Equal(fields[1].Bytes, []byte{0xFF}) {
+			return nil, false, value, internal.ChipErrorUnsupportedCertFormat
+		}
+		critical = true
+	}
+	if derIdentifier(fields[len(fields)-1]) != derOctetString {
+		return nil, false, value, internal.ChipErrorUnsupportedCertFormat
+	}
+	if value, err = derParse(fields[len(fields)-1].Bytes); err != nil {
+		return nil, false, value, err
+	}
+	return oid, critical, value, nil
+}
+
+func decodeX509Extensions(raw asn1.RawValue, cert *ChipCertificateData) error {
+	if derIdentifier(raw) != derContext3 {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	wrapper, err := derChildren(raw)
+	if err != nil {
+		return err
+	}
+	if len(wrapper) != 1 || derIdentifier(wrapper[0]) != derSequence {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	extensions, err := derChildren(wrapper[0])
+	if err != nil {
+		return err
+	}
+	for _, extension := range extensions {
+		oid, critical, value, err := parseX509Extension(extension)
+		if err != nil {
+			return err
+		}
+		if err = decodeX509Extension(oid, critical, value, extension.FullBytes, cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeX509Extension(oid asn1.ObjectIdentifier, critical bool, value asn1.RawValue, extension []byte, cert *ChipCertificateData) error {
+	// Matter 要求 BasicConstraints、KeyUsage、ExtendedKeyUsage 为关键扩展，密钥标识符为非关键扩展
+	present := func(flag CertFlags, mustBeCritical bool) error {
+		if cert.CertFlags.Has(flag) || critical != mustBeCritical {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		cert.CertFlags |= flag
+		return nil
+	}
+	switch {
+	case oid.Equal(oidExtensionBasicConstraints):
+		if err := present(CertFlagExtPresentBasicConstraints, true); err != nil {
+			return err
+		}
+		fields, err := derChildren(value)
+		if err != nil {
+			return err
+		}
+		if derIdentifier(value) != derSequence || len(fields) > 2 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		if len(fields) > 0 && derIdentifier(fields[0]) == derBoolean {
+			if !bytes.Equal(fields[0].Bytes, []byte{0xFF}) {
+				return internal.ChipErrorUnsupportedCertFormat
+			}
+			cert.CertFlags |= CertFlagIsCA
+			fields = fields[1:]
+		}
+		if len(fields) == 1 {
+			var pathLen int
+			if _, err := asn1.Unmarshal(fields[0].FullBytes, &pathLen); err != nil || pathLen < 0 || pathLen > 0xFF {
+				return internal.ChipErrorUnsupportedCertFormat
+			}
+			if !cert.CertFlags.Has(CertFlagIsCA) {
+				return internal.ChipErrorUnsupportedCertFormat
+			}
+			cert.PathLenConstraint = uint8(pathLen)
+			cert.CertFlags |= CertFlagPathLenConstraintPresent
+		} else if len(fields) != 0 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+	case oid.Equal(oidExtensionKeyUsage):
+		if err := present(CertFlagExtPresentKeyUsage, true); err != nil {
+			return err
+		}
+		if derIdentifier(value) != derBitString || len(value.Bytes) < 2 || len(value.Bytes) > 3 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		for i, b := range value.Bytes[1:] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					cert.KeyUsageFlags |= 1 << (i*8 + bit)
+				}
+			}
+		}
+		if cert.KeyUsageFlags == 0 || cert.KeyUsageFlags&^keyUsageAll != 0 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+	case oid.Equal(oidExtensionExtendedKeyUsage):
+		if err := present(CertFlagExtPresentExtendedKeyUsage, true); err != nil {
+			return err
+		}
+		purposes, err := derChildren(value)
+		if err != nil {
+			return err
+		}
+		if derIdentifier(value) != derSequence || len(purposes) == 0 {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		for _, raw := range purposes {
+			purposeOID, err := derParseOID(raw)
+			if err != nil {
+				return err
+			}
+			purpose, ok := keyPurposeFromOID(purposeOID)
+			if !ok {
+				return internal.ChipErrorUnsupportedCertFormat
+			}
+			cert.KeyPurposes = append(cert.KeyPurposes, purpose)
+		}
+	case oid.Equal(oidExtensionSubjectKeyIdentifier):
+		if err := present(CertFlagExtPresentSubjectKeyId, false); err != nil {
+			return err
+		}
+		if derIdentifier(value) != derOctetString || len(value.Bytes) != KKeyIdentifierLength {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		cert.SubjectKeyId = append([]byte{}, value.Bytes...)
+	case oid.Equal(oidExtensionAuthorityKeyIdentifier):
+		if err := present(CertFlagExtPresentAuthKeyId, false); err != nil {
+			return err
+		}
+		fields, err := derChildren(value)
+		if err != nil {
+			return err
+		}
+		if derIdentifier(value) != derSequence || len(fields) != 1 || derIdentifier(fields[0]) != derContextPrimitive0 ||
+			len(fields[0].Bytes) != KKeyIdentifierLength {
+			return internal.ChipErrorUnsupportedCertFormat
+		}
+		cert.AuthKeyId = append([]byte{}, fields[0].Bytes...)
+	default:
+		if critical {
+			cert.CertFlags |= CertFlagExtPresentFutureIsCritical
+		}
+		cert.FutureExtensions = append(cert.FutureExtensions, append([]byte{}, extension...))
+	}
+	return nil
+}
+
+func keyPurposeFromOID(oid asn1.ObjectIdentifier) (KeyPurpose, bool) {
+	for purpose, purposeOID := range keyPurposeOIDs {
+		if purposeOID.Equal(oid) {
+			return purpose, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package dac
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib/tlv"
+)
+
+const (
+	// KAttestationElementsMaxSize TLV 编码的认证元素的最大长度
+	KAttestationElementsMaxSize = 900
+	// KAttestationNonceLength AttestationRequest 中随机数的长度
+	KAttestationNonceLength = 32
+)
+
+// AttestationElements 设备对 AttestationRequest 的应答内容，设备使用 DAC 私钥对
+// 认证元素 || AttestationChallenge 签名
+type AttestationElements struct {
+	CertificationDeclaration []byte `tlv:"1"`
+	AttestationNonce         []byte `tlv:"2"`
+	Timestamp                uint32 `tlv:"3"`
+	FirmwareInformation      []byte `tlv:"4,omitempty"`
+}
+
+// ConstructAttestationElements 编码认证元素，firmwareInformation 可以为空
+func ConstructAttestationElements(certificationDeclaration, attestationNonce []byte, timestamp uint32, firmwareInformation []byte) ([]byte, error) {
+	if len(certificationDeclaration) == 0 || len(attestationNonce) != KAttestationNonceLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	data, err := tlv.Marshal(&AttestationElements{
+		CertificationDeclaration: certificationDeclaration,
+		AttestationNonce:         attestationNonce,
+		Timestamp:                timestamp,
+		FirmwareInformation:      firmwareInformation,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > KAttestationElementsMaxSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return data, nil
+}
+
+// DeconstructAttestationElements 解码认证元素
+func DeconstructAttestationElements(data []byte) (*AttestationElements, error) {
+	if len(data) == 0 || len(data) > KAttestationElementsMaxSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	elements := &AttestationElements{}
+	if err := tlv.Unmarshal(data, elements); err != nil {
+		return nil, err
+	}
+	if len(elements.CertificationDeclaration) == 0 || len(elements.AttestationNonce) != KAttestationNonceLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return elements, nil
+}
@@ -0,0 +1,140 @@
+package dac
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AttestationTrustStore 由 SubjectKeyIdentifier 查找受信任的 PAA 证书
+type AttestationTrustStore interface {
+	// GetProductAttestationAuthorityCert 返回 DER 编码的 PAA 证书，没有时返回 ChipErrorCACertNotFound
+	GetProductAttestationAuthorityCert(skid []byte) ([]byte, error)
+}
+
+// FileAttestationTrustStore 从目录加载 DER 或者 PEM 格式的 PAA 证书
+type FileAttestationTrustStore struct {
+	mPaaCerts map[string][]byte
+}
+
+// NewFileAttestationTrustStore 加载目录中的 .der 和 .pem 文件，无法解析的文件被忽略
+func NewFileAttestationTrustStore(dir string) (*FileAttestationTrustStore, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileAttestationTrustStore{mPaaCerts: make(map[string][]byte)}
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (extension != ".der" && extension != ".pem") {
+			continue
+		}
+		cert, err := loadCertificate(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Warnf("AttestationTrustStore: skip %s: %s", entry.Name(), err.Error())
+			continue
+		}
+		if err = store.AddPaaCert(cert); err != nil {
+			log.Warnf("AttestationTrustStore: skip %s: %s", entry.Name(), err.Error())
+		}
+	}
+	return store, nil
+}
+
+// AddPaaCert 添加 DER 编码的 PAA 证书，证书必须是包含 SubjectKeyIdentifier 的 CA 证书
+func (s *FileAttestationTrustStore) AddPaaCert(der []byte) error {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	if !cert.IsCA || len(cert.SubjectKeyId) != kKeyIdentifierLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	if s.mPaaCerts == nil {
+		s.mPaaCerts = make(map[string][]byte)
+	}
+	s.mPaaCerts[hex.EncodeToString(cert.SubjectKeyId)] = append([]byte(nil), der...)
+	return nil
+}
+
+func (s *FileAttestationTrustStore) Count() int {
+	return len(s.mPaaCerts)
+}
+
+func (s *FileAttestationTrustStore) GetProductAttestationAuthorityCert(skid []byte) ([]byte, error) {
+	if len(skid) != kKeyIdentifierLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	cert, ok := s.mPaaCerts[hex.EncodeToString(skid)]
+	if !ok {
+		return nil, internal.ChipErrorCACertNotFound
+	}
+	return append([]byte(nil), cert...), nil
+}
+
+// CertificationDeclarationKeyStore 由 CMS 中的 KeyIdentifier 查找认证声明的签名公钥
+type CertificationDeclarationKeyStore interface {
+	LookupVerifyingKey(keyId []byte) (crypto.P256PublicKey, error)
+}
+
+// CsaCdKeysTrustStore 在内存中保存受信任的认证声明签名公钥
+type CsaCdKeysTrustStore struct {
+	mMutex sync.RWMutex
+	mKeys  map[string]crypto.P256PublicKey
+}
+
+func NewCsaCdKeysTrustStore() *CsaCdKeysTrustStore {
+	return &CsaCdKeysTrustStore{mKeys: make(map[string]crypto.P256PublicKey)}
+}
+
+func (s *CsaCdKeysTrustStore) AddTrustedKey(keyId []byte, publicKey crypto.P256PublicKey) error {
+	if len(keyId) != kKeyIdentifierLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mKeys[hex.EncodeToString(keyId)] = publicKey
+	return nil
+}
+
+// AddTrustedKeyFromCert 添加 DER 编码的签名证书中的公钥，KeyIdentifier 为证书的 SubjectKeyIdentifier
+func (s *CsaCdKeysTrustStore) AddTrustedKeyFromCert(der []byte) error {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return internal.ChipErrorUnsupportedCertFormat
+	}
+	publicKey, err := extractPublicKeyFromX509Cert(der)
+	if err != nil {
+		return err
+	}
+	return s.AddTrustedKey(cert.SubjectKeyId, publicKey)
+}
+
+// AddTrustedKeyFromFile 添加 DER 或者 PEM 格式的签名证书
+func (s *CsaCdKeysTrustStore) AddTrustedKeyFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return s.AddTrustedKeyFromCert(data)
+}
+
+func (s *CsaCdKeysTrustStore) LookupVerifyingKey(keyId []byte) (crypto.P256PublicKey, error) {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	publicKey, ok := s.mKeys[hex.EncodeToString(keyId)]
+	if !ok {
+		return crypto.P256PublicKey{}, internal.ChipErrorCACertNotFound
+	}
+	return publicKey, nil
+}
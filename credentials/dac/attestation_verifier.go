@@ -0,0 +1,404 @@
+package dac
+
+import (
+	"bytes"
+	"crypto/x509"
+	"github.com/galenliu/chip/crypto"
+	"strconv"
+	"time"
+)
+
+// AttestationVerificationResult 设备认证的验证结果
+type AttestationVerificationResult uint16
+
+const (
+	AttestationVerificationSuccess AttestationVerificationResult = iota
+
+	AttestationVerificationPaaUntrusted
+	AttestationVerificationPaaNotFound
+	AttestationVerificationPaaExpired
+	AttestationVerificationPaaSignatureInvalid
+	AttestationVerificationPaaFormatInvalid
+
+	AttestationVerificationPaiExpired
+	AttestationVerificationPaiSignatureInvalid
+	AttestationVerificationPaiFormatInvalid
+	AttestationVerificationPaiVendorIdMismatch
+	AttestationVerificationPaiAuthorityNotFound
+	AttestationVerificationPaiMissing
+
+	AttestationVerificationDacExpired
+	AttestationVerificationDacSignatureInvalid
+	AttestationVerificationDacFormatInvalid
+	AttestationVerificationDacVendorIdMismatch
+	AttestationVerificationDacProductIdMismatch
+	AttestationVerificationDacAuthorityNotFound
+
+	AttestationVerificationAttestationSignatureInvalid
+	AttestationVerificationAttestationElementsMalformed
+	AttestationVerificationAttestationNonceMismatch
+
+	AttestationVerificationCertificationDeclarationNoKeyId
+	AttestationVerificationCertificationDeclarationNoCertificateFound
+	AttestationVerificationCertificationDeclarationInvalidSignature
+	AttestationVerificationCertificationDeclarationInvalidFormat
+	AttestationVerificationCertificationDeclarationInvalidVendorId
+	AttestationVerificationCertificationDeclarationInvalidProductId
+	AttestationVerificationCertificationDeclarationInvalidPAA
+
+	AttestationVerificationInvalidArgument
+	AttestationVerificationNotImplemented
+)
+
+var attestationVerificationResultNames = map[AttestationVerificationResult]string{
+	AttestationVerificationSuccess:                                    "Success",
+	AttestationVerificationPaaUntrusted:                               "PaaUntrusted",
+	AttestationVerificationPaaNotFound:                                "PaaNotFound",
+	AttestationVerificationPaaExpired:                                 "PaaExpired",
+	AttestationVerificationPaaSignatureInvalid:                        "PaaSignatureInvalid",
+	AttestationVerificationPaaFormatInvalid:                           "PaaFormatInvalid",
+	AttestationVerificationPaiExpired:                                 "PaiExpired",
+	AttestationVerificationPaiSignatureInvalid:                        "PaiSignatureInvalid",
+	AttestationVerificationPaiFormatInvalid:                           "PaiFormatInvalid",
+	AttestationVerificationPaiVendorIdMismatch:                        "PaiVendorIdMismatch",
+	AttestationVerificationPaiAuthorityNotFound:                       "PaiAuthorityNotFound",
+	AttestationVerificationPaiMissing:                                 "PaiMissing",
+	AttestationVerificationDacExpired:                                 "DacExpired",
+	AttestationVerificationDacSignatureInvalid:                        "DacSignatureInvalid",
+	AttestationVerificationDacFormatInvalid:                           "DacFormatInvalid",
+	AttestationVerificationDacVendorIdMismatch:                        "DacVendorIdMismatch",
+	AttestationVerificationDacProductIdMismatch:                       "DacProductIdMismatch",
+	AttestationVerificationDacAuthorityNotFound:                       "DacAuthorityNotFound",
+	AttestationVerificationAttestationSignatureInvalid:                "AttestationSignatureInvalid",
+	AttestationVerificationAttestationElementsMalformed:               "AttestationElementsMalformed",
+	AttestationVerificationAttestationNonceMismatch:                   "AttestationNonceMismatch",
+	AttestationVerificationCertificationDeclarationNoKeyId:            "CertificationDeclarationNoKeyId",
+	AttestationVerificationCertificationDeclarationNoCertificateFound: "CertificationDeclarationNoCertificateFound",
+	AttestationVerificationCertificationDeclarationInvalidSignature:   "CertificationDeclarationInvalidSignature",
+	AttestationVerificationCertificationDeclarationInvalidFormat:      "CertificationDeclarationInvalidFormat",
+	AttestationVerificationCertificationDeclarationInvalidVendorId:    "CertificationDeclarationInvalidVendorId",
+	AttestationVerificationCertificationDeclarationInvalidProductId:   "CertificationDeclarationInvalidProductId",
+	AttestationVerificationCertificationDeclarationInvalidPAA:         "CertificationDeclarationInvalidPAA",
+	AttestationVerificationInvalidArgument:                            "InvalidArgument",
+	AttestationVerificationNotImplemented:                             "NotImplemented",
+}
+
+func (r AttestationVerificationResult) String() string {
+	if name, ok := attestationVerificationResultNames[r]; ok {
+		return name
+	}
+	return "Unknown(" + strconv.Itoa(int(r)) + ")"
+}
+
+// AttestationInfo 委任方收到的 AttestationResponse 以及设备的证书链，
+// VendorId 和 ProductId 从设备的 Basic Information 集群读取
+type AttestationInfo struct {
+	AttestationElements  []byte
+	AttestationChallenge []byte
+	// AttestationSignature r || s 格式的签名
+	AttestationSignature []byte
+	PaiDer               []byte
+	DacDer               []byte
+	AttestationNonce     []byte
+	VendorId             uint16
+	ProductId            uint16
+}
+
+// DeviceInfoForAttestation 验证认证声明内容时需要的设备信息，PID 为 0 表示证书中没有 PID
+type DeviceInfoForAttestation struct {
+	VendorId     uint16
+	ProductId    uint16
+	DacVendorId  uint16
+	DacProductId uint16
+	PaiVendorId  uint16
+	PaiProductId uint16
+	PaaVendorId  uint16
+	PaaSkid      []byte
+}
+
+type DeviceAttestationVerifier interface {
+	// VerifyAttestationInformation 验证证书链、认证签名和认证声明
+	VerifyAttestationInformation(info AttestationInfo) AttestationVerificationResult
+	// ValidateCertificationDeclarationSignature 验证 CMS 签名，返回认证声明的内容
+	ValidateCertificationDeclarationSignature(cmsEnvelope []byte) ([]byte, AttestationVerificationResult)
+	// ValidateCertificateDeclarationPayload 检查认证声明的内容与设备信息是否一致
+	ValidateCertificateDeclarationPayload(certDeclBuffer []byte, firmwareInfo []byte, deviceInfo DeviceInfoForAttestation) AttestationVerificationResult
+}
+
+// DefaultDACVerifier 使用 PAA 信任库和认证声明签名公钥验证设备认证
+type DefaultDACVerifier struct {
+	mAttestationTrustStore AttestationTrustStore
+	mCdKeysTrustStore      CertificationDeclarationKeyStore
+	mNow                   func() time.Time
+}
+
+func NewDefaultDACVerifier(paaRootStore AttestationTrustStore, cdKeysStore CertificationDeclarationKeyStore) *DefaultDACVerifier {
+	return &DefaultDACVerifier{
+		mAttestationTrustStore: paaRootStore,
+		mCdKeysTrustStore:      cdKeysStore,
+		mNow:                   time.Now,
+	}
+}
+
+func (v *DefaultDACVerifier) VerifyAttestationInformation(info AttestationInfo) AttestationVerificationResult {
+	if len(info.AttestationElements) == 0 || len(info.AttestationChallenge) == 0 ||
+		len(info.AttestationSignature) != crypto.KP256ECDSASignatureLength || len(info.AttestationNonce) != KAttestationNonceLength {
+		return AttestationVerificationInvalidArgument
+	}
+	if len(info.PaiDer) == 0 {
+		return AttestationVerificationPaiMissing
+	}
+	if len(info.DacDer) == 0 {
+		return AttestationVerificationInvalidArgument
+	}
+	dac, err := x509.ParseCertificate(info.DacDer)
+	if err != nil {
+		return AttestationVerificationDacFormatInvalid
+	}
+	pai, err := x509.ParseCertificate(info.PaiDer)
+	if err != nil {
+		return AttestationVerificationPaiFormatInvalid
+	}
+
+	dacVendorId, dacProductId, ok := extractVidPidFromX509Cert(dac)
+	if !ok || dacVendorId == 0 || dacProductId == 0 {
+		return AttestationVerificationDacFormatInvalid
+	}
+	paiVendorId, paiProductId, ok := extractVidPidFromX509Cert(pai)
+	if !ok {
+		return AttestationVerificationPaiFormatInvalid
+	}
+	if paiVendorId != 0 && paiVendorId != dacVendorId {
+		return AttestationVerificationDacVendorIdMismatch
+	}
+	if paiProductId != 0 && paiProductId != dacProductId {
+		return AttestationVerificationDacProductIdMismatch
+	}
+
+	// 设备使用 DAC 私钥对 认证元素 || AttestationChallenge 签名
+	dacPublicKey, err := extractPublicKeyFromX509Cert(info.DacDer)
+	if err != nil {
+		return AttestationVerificationDacFormatInvalid
+	}
+	var signature crypto.P256ECDSASignature
+	copy(signature[:], info.AttestationSignature)
+	message := append(append([]byte(nil), info.AttestationElements...), info.AttestationChallenge...)
+	if dacPublicKey.ECDSAValidateMsgSignature(message, signature) != nil {
+		return AttestationVerificationAttestationSignatureInvalid
+	}
+
+	if len(pai.AuthorityKeyId) != kKeyIdentifierLength {
+		return AttestationVerificationPaiFormatInvalid
+	}
+	if v.mAttestationTrustStore == nil {
+		return AttestationVerificationPaaNotFound
+	}
+	paaDer, err := v.mAttestationTrustStore.GetProductAttestationAuthorityCert(pai.AuthorityKeyId)
+	if err != nil {
+		return AttestationVerificationPaaNotFound
+	}
+	paa, err := x509.ParseCertificate(paaDer)
+	if err != nil {
+		return AttestationVerificationPaaFormatInvalid
+	}
+	paaVendorId, _, ok := extractVidPidFromX509Cert(paa)
+	if !ok {
+		return AttestationVerificationPaaFormatInvalid
+	}
+	if paaVendorId != 0 && paaVendorId != dacVendorId {
+		return AttestationVerificationPaiVendorIdMismatch
+	}
+	if result := v.validateCertificateChain(paa, pai, dac); result != AttestationVerificationSuccess {
+		return result
+	}
+
+	elements, err := DeconstructAttestationElements(info.AttestationElements)
+	if err != nil {
+		return AttestationVerificationAttestationElementsMalformed
+	}
+	if !bytes.Equal(elements.AttestationNonce, info.AttestationNonce) {
+		return AttestationVerificationAttestationNonceMismatch
+	}
+	cdContent, result := v.ValidateCertificationDeclarationSignature(elements.CertificationDeclaration)
+	if result != AttestationVerificationSuccess {
+		return result
+	}
+	return v.ValidateCertificateDeclarationPayload(cdContent, elements.FirmwareInformation, DeviceInfoForAttestation{
+		VendorId:     info.VendorId,
+		ProductId:    info.ProductId,
+		DacVendorId:  dacVendorId,
+		DacProductId: dacProductId,
+		PaiVendorId:  paiVendorId,
+		PaiProductId: paiProductId,
+		PaaVendorId:  paaVendorId,
+		PaaSkid:      paa.SubjectKeyId,
+	})
+}
+
+// validateCertificateChain 检查 DAC → PAI → PAA 的签名、有效期和 CA 约束
+func (v *DefaultDACVerifier) validateCertificateChain(paa, pai, dac *x509.Certificate) AttestationVerificationResult {
+	now := v.mNow()
+	if !paa.IsCA || len(paa.SubjectKeyId) != kKeyIdentifierLength {
+		return AttestationVerificationPaaFormatInvalid
+	}
+	if !isCertValidAt(paa, now) {
+		return AttestationVerificationPaaExpired
+	}
+	if paa.CheckSignatureFrom(paa) != nil {
+		return AttestationVerificationPaaSignatureInvalid
+	}
+
+	if !pai.IsCA || len(pai.SubjectKeyId) != kKeyIdentifierLength {
+		return AttestationVerificationPaiFormatInvalid
+	}
+	if !bytes.Equal(pai.AuthorityKeyId, paa.SubjectKeyId) {
+		return AttestationVerificationPaiAuthorityNotFound
+	}
+	if !isCertValidAt(pai, now) {
+		return AttestationVerificationPaiExpired
+	}
+	if pai.CheckSignatureFrom(paa) != nil {
+		return AttestationVerificationPaiSignatureInvalid
+	}
+
+	if dac.IsCA {
+		return AttestationVerificationDacFormatInvalid
+	}
+	if !bytes.Equal(dac.AuthorityKeyId, pai.SubjectKeyId) {
+		return AttestationVerificationDacAuthorityNotFound
+	}
+	if !isCertValidAt(dac, now) {
+		return AttestationVerificationDacExpired
+	}
+	if dac.CheckSignatureFrom(pai) != nil {
+		return AttestationVerificationDacSignatureInvalid
+	}
+	return AttestationVerificationSuccess
+}
+
+func (v *DefaultDACVerifier) ValidateCertificationDeclarationSignature(cmsEnvelope []byte) ([]byte, AttestationVerificationResult) {
+	if len(cmsEnvelope) == 0 || len(cmsEnvelope) > KCertificationDeclarationMaxSize {
+		return nil, AttestationVerificationCertificationDeclarationInvalidFormat
+	}
+	keyId, err := CMSExtractKeyId(cmsEnvelope)
+	if err != nil {
+		return nil, AttestationVerificationCertificationDeclarationNoKeyId
+	}
+	if v.mCdKeysTrustStore == nil {
+		return nil, AttestationVerificationCertificationDeclarationNoCertificateFound
+	}
+	publicKey, err := v.mCdKeysTrustStore.LookupVerifyingKey(keyId)
+	if err != nil {
+		return nil, AttestationVerificationCertificationDeclarationNoCertificateFound
+	}
+	content, err := CMSVerify(cmsEnvelope, publicKey)
+	if err != nil {
+		return nil, AttestationVerificationCertificationDeclarationInvalidSignature
+	}
+	return content, AttestationVerificationSuccess
+}
+
+// ValidateCertificateDeclarationPayload 认证声明指定了 DAC 来源时，DAC 和 PAI 的 VID/PID 必须与来源一致，
+// 否则必须与认证声明的 VID 和 PID 列表一致。固件信息目前不检查
+func (v *DefaultDACVerifier) ValidateCertificateDeclarationPayload(certDeclBuffer []byte, firmwareInfo []byte,
+	deviceInfo DeviceInfoForAttestation) AttestationVerificationResult {
+	cd, err := DecodeCertificationElements(certDeclBuffer)
+	if err != nil {
+		return AttestationVerificationCertificationDeclarationInvalidFormat
+	}
+	if cd.VendorId != deviceInfo.VendorId {
+		return AttestationVerificationCertificationDeclarationInvalidVendorId
+	}
+	if !cd.HasProductId(deviceInfo.ProductId) {
+		return AttestationVerificationCertificationDeclarationInvalidProductId
+	}
+
+	if cd.IsDacOriginPresent() {
+		if deviceInfo.DacVendorId != cd.DacOriginVendorId || (deviceInfo.PaiVendorId != 0 && deviceInfo.PaiVendorId != cd.DacOriginVendorId) {
+			return AttestationVerificationDacVendorIdMismatch
+		}
+		if deviceInfo.DacProductId != cd.DacOriginProductId || (deviceInfo.PaiProductId != 0 && deviceInfo.PaiProductId != cd.DacOriginProductId) {
+			return AttestationVerificationDacProductIdMismatch
+		}
+	} else {
+		if deviceInfo.DacVendorId != cd.VendorId || (deviceInfo.PaiVendorId != 0 && deviceInfo.PaiVendorId != cd.VendorId) {
+			return AttestationVerificationDacVendorIdMismatch
+		}
+		if !cd.HasProductId(deviceInfo.DacProductId) || (deviceInfo.PaiProductId != 0 && !cd.HasProductId(deviceInfo.PaiProductId)) {
+			return AttestationVerificationDacProductIdMismatch
+		}
+	}
+
+	if len(cd.AuthorizedPAAList) != 0 {
+		authorized := false
+		for _, keyId := range cd.AuthorizedPAAList {
+			if bytes.Equal(keyId, deviceInfo.PaaSkid) {
+				authorized = true
+				break
+			}
+		}
+		if !authorized {
+			return AttestationVerificationCertificationDeclarationInvalidPAA
+		}
+	}
+	return AttestationVerificationSuccess
+}
+
+// UnimplementedDACVerifier 没有设置验证器时使用
+type UnimplementedDACVerifier struct {
+}
+
+func (u UnimplementedDACVerifier) VerifyAttestationInformation(AttestationInfo) AttestationVerificationResult {
+	return AttestationVerificationNotImplemented
+}
+
+func (u UnimplementedDACVerifier) ValidateCertificationDeclarationSignature([]byte) ([]byte, AttestationVerificationResult) {
+	return nil, AttestationVerificationNotImplemented
+}
+
+func (u UnimplementedDACVerifier) ValidateCertificateDeclarationPayload([]byte, []byte, DeviceInfoForAttestation) AttestationVerificationResult {
+	return AttestationVerificationNotImplemented
+}
+
+var gDacVerifier DeviceAttestationVerifier
+
+func SetDeviceAttestationVerifier(verifier DeviceAttestationVerifier) {
+	gDacVerifier = verifier
+}
+
+// GetDeviceAttestationVerifier 没有设置时返回 UnimplementedDACVerifier
+func GetDeviceAttestationVerifier() DeviceAttestationVerifier {
+	if gDacVerifier == nil {
+		return UnimplementedDACVerifier{}
+	}
+	return gDacVerifier
+}
+
+// extractVidPidFromX509Cert 从主题中读取 Matter VID 和 PID 属性，不存在时为 0，格式错误时返回 false
+func extractVidPidFromX509Cert(cert *x509.Certificate) (vendorId uint16, productId uint16, ok bool) {
+	for _, name := range cert.Subject.Names {
+		var target *uint16
+		switch {
+		case name.Type.Equal(oidMatterVendorId):
+			target = &vendorId
+		case name.Type.Equal(oidMatterProductId):
+			target = &productId
+		default:
+			continue
+		}
+		value, isString := name.Value.(string)
+		if !isString || len(value) != 4 {
+			return 0, 0, false
+		}
+		parsed, err := strconv.ParseUint(value, 16, 16)
+		if err != nil || *target != 0 {
+			return 0, 0, false
+		}
+		*target = uint16(parsed)
+	}
+	return vendorId, productId, true
+}
+
+func isCertValidAt(cert *x509.Certificate, now time.Time) bool {
+	return !now.Before(cert.NotBefore) && !now.After(cert.NotAfter)
+}
@@ -0,0 +1,211 @@
+package dac
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testAttestationEnv struct {
+	mCredentials *DevelopmentAttestationCredentials
+	mTrustStore  *FileAttestationTrustStore
+	mCdKeys      *CsaCdKeysTrustStore
+	mVerifier    *DefaultDACVerifier
+}
+
+func newTestAttestationEnv(t *testing.T) *testAttestationEnv {
+	t.Helper()
+	credentials, err := ExampleDevelopmentCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	paa := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: credentials.PaaCert})
+	if err = os.WriteFile(filepath.Join(dir, "paa.pem"), paa, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "broken.der"), []byte{0x30, 0x00}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	trustStore, err := NewFileAttestationTrustStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trustStore.Count() != 1 {
+		t.Fatalf("expected one PAA, got %d", trustStore.Count())
+	}
+	cdKeys := NewCsaCdKeysTrustStore()
+	if err = cdKeys.AddTrustedKeyFromCert(credentials.CdSigningCert); err != nil {
+		t.Fatal(err)
+	}
+	return &testAttestationEnv{
+		mCredentials: credentials,
+		mTrustStore:  trustStore,
+		mCdKeys:      cdKeys,
+		mVerifier:    NewDefaultDACVerifier(trustStore, cdKeys),
+	}
+}
+
+// newAttestationInfo 模拟设备对 AttestationRequest 的应答
+func newAttestationInfo(t *testing.T, credentials *DevelopmentAttestationCredentials, cd []byte) AttestationInfo {
+	t.Helper()
+	nonce := make([]byte, KAttestationNonceLength)
+	challenge := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	_, _ = rand.Read(challenge)
+	elements, err := ConstructAttestationElements(cd, nonce, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := credentials.DacKeypair.ECDSASignMsg(append(append([]byte(nil), elements...), challenge...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return AttestationInfo{
+		AttestationElements:  elements,
+		AttestationChallenge: challenge,
+		AttestationSignature: signature[:],
+		PaiDer:               credentials.PaiCert,
+		DacDer:               credentials.DacCert,
+		AttestationNonce:     nonce,
+		VendorId:             KTestVendorId,
+		ProductId:            KTestProductId,
+	}
+}
+
+func expectResult(t *testing.T, name string, expected, actual AttestationVerificationResult) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("%s: expected %s, got %s", name, expected, actual)
+	}
+}
+
+func TestDefaultDACVerifier(t *testing.T) {
+	env := newTestAttestationEnv(t)
+	credentials := env.mCredentials
+	verifier := env.mVerifier
+
+	info := newAttestationInfo(t, credentials, credentials.CertificationDeclaration)
+	expectResult(t, "valid attestation", AttestationVerificationSuccess, verifier.VerifyAttestationInformation(info))
+
+	modified := info
+	modified.AttestationNonce = make([]byte, KAttestationNonceLength)
+	expectResult(t, "nonce", AttestationVerificationAttestationNonceMismatch, verifier.VerifyAttestationInformation(modified))
+
+	modified = info
+	modified.AttestationChallenge = []byte("other challenge")
+	expectResult(t, "signature", AttestationVerificationAttestationSignatureInvalid, verifier.VerifyAttestationInformation(modified))
+
+	modified = info
+	modified.PaiDer = nil
+	expectResult(t, "missing PAI", AttestationVerificationPaiMissing, verifier.VerifyAttestationInformation(modified))
+
+	modified = info
+	modified.VendorId = 0xFFF2
+	expectResult(t, "basic information VID", AttestationVerificationCertificationDeclarationInvalidVendorId, verifier.VerifyAttestationInformation(modified))
+
+	modified = info
+	modified.ProductId = 0x8001
+	expectResult(t, "basic information PID", AttestationVerificationCertificationDeclarationInvalidProductId, verifier.VerifyAttestationInformation(modified))
+
+	expectResult(t, "untrusted PAA", AttestationVerificationPaaNotFound,
+		NewDefaultDACVerifier(&FileAttestationTrustStore{}, env.mCdKeys).VerifyAttestationInformation(info))
+	expectResult(t, "unknown CD signing key", AttestationVerificationCertificationDeclarationNoCertificateFound,
+		NewDefaultDACVerifier(env.mTrustStore, NewCsaCdKeysTrustStore()).VerifyAttestationInformation(info))
+
+	expired := NewDefaultDACVerifier(env.mTrustStore, env.mCdKeys)
+	expired.mNow = func() time.Time { return time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC) }
+	expectResult(t, "not yet valid", AttestationVerificationPaaExpired, expired.VerifyAttestationInformation(info))
+}
+
+func TestDefaultDACVerifierForeignChain(t *testing.T) {
+	env := newTestAttestationEnv(t)
+	other := newTestAttestationCredentials(t)
+	if err := env.mTrustStore.AddPaaCert(other.PaaCert); err != nil {
+		t.Fatal(err)
+	}
+
+	// 另一条证书链的 DAC 不是由设备提供的 PAI 签发的
+	info := newAttestationInfo(t, other, env.mCredentials.CertificationDeclaration)
+	info.PaiDer = env.mCredentials.PaiCert
+	expectResult(t, "foreign DAC", AttestationVerificationDacAuthorityNotFound, env.mVerifier.VerifyAttestationInformation(info))
+
+	// 认证声明由不受信任的秘钥签名
+	info = newAttestationInfo(t, other, other.CertificationDeclaration)
+	expectResult(t, "foreign CD", AttestationVerificationCertificationDeclarationNoCertificateFound, env.mVerifier.VerifyAttestationInformation(info))
+}
+
+func TestCertificationDeclarationSignature(t *testing.T) {
+	env := newTestAttestationEnv(t)
+	cd := env.mCredentials.CertificationDeclaration
+
+	content, result := env.mVerifier.ValidateCertificationDeclarationSignature(cd)
+	expectResult(t, "valid CD", AttestationVerificationSuccess, result)
+	extracted, err := CMSExtractContent(cd)
+	if err != nil || !bytes.Equal(extracted, content) {
+		t.Errorf("extracted content mismatch: %v", err)
+	}
+
+	// 修改签名的内容
+	tampered := append([]byte(nil), cd...)
+	tampered[bytes.Index(tampered, content)+len(content)-1] ^= 0x01
+	_, result = env.mVerifier.ValidateCertificationDeclarationSignature(tampered)
+	expectResult(t, "tampered CD", AttestationVerificationCertificationDeclarationInvalidSignature, result)
+
+	_, result = env.mVerifier.ValidateCertificationDeclarationSignature([]byte{0x30, 0x03, 0x02, 0x01, 0x01})
+	expectResult(t, "malformed CD", AttestationVerificationCertificationDeclarationNoKeyId, result)
+}
+
+func TestCertificationDeclarationPayload(t *testing.T) {
+	verifier := NewDefaultDACVerifier(nil, nil)
+	paaSkid := make([]byte, kKeyIdentifierLength)
+	paaSkid[0] = 0x01
+	deviceInfo := DeviceInfoForAttestation{
+		VendorId:     KTestVendorId,
+		ProductId:    KTestProductId,
+		DacVendorId:  KTestVendorId,
+		DacProductId: KTestProductId,
+		PaiVendorId:  KTestVendorId,
+		PaaSkid:      paaSkid,
+	}
+	encode := func(elements CertificationElements) []byte {
+		data, err := EncodeCertificationElements(elements)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	elements := CertificationElements{
+		VendorId:      KTestVendorId,
+		ProductIds:    []uint16{KTestProductId},
+		CertificateId: "ZIG20141ZB330001-24",
+	}
+	expectResult(t, "matching payload", AttestationVerificationSuccess, verifier.ValidateCertificateDeclarationPayload(encode(elements), nil, deviceInfo))
+
+	mismatched := deviceInfo
+	mismatched.DacProductId = 0x8001
+	expectResult(t, "DAC PID", AttestationVerificationDacProductIdMismatch, verifier.ValidateCertificateDeclarationPayload(encode(elements), nil, mismatched))
+
+	// DAC 来自另一个厂商时，DAC 的 VID/PID 必须与来源一致
+	origin := elements
+	origin.DacOriginVendorId = 0xFFF2
+	origin.DacOriginProductId = 0x8010
+	expectResult(t, "DAC origin", AttestationVerificationDacVendorIdMismatch, verifier.ValidateCertificateDeclarationPayload(encode(origin), nil, deviceInfo))
+	fromOrigin := deviceInfo
+	fromOrigin.DacVendorId, fromOrigin.DacProductId, fromOrigin.PaiVendorId = 0xFFF2, 0x8010, 0xFFF2
+	expectResult(t, "DAC from origin", AttestationVerificationSuccess, verifier.ValidateCertificateDeclarationPayload(encode(origin), nil, fromOrigin))
+
+	authorized := elements
+	authorized.AuthorizedPAAList = [][]byte{make([]byte, kKeyIdentifierLength)}
+	expectResult(t, "unauthorized PAA", AttestationVerificationCertificationDeclarationInvalidPAA,
+		verifier.ValidateCertificateDeclarationPayload(encode(authorized), nil, deviceInfo))
+	authorized.AuthorizedPAAList = append(authorized.AuthorizedPAAList, paaSkid)
+	expectResult(t, "authorized PAA", AttestationVerificationSuccess, verifier.ValidateCertificateDeclarationPayload(encode(authorized), nil, deviceInfo))
+
+	expectResult(t, "malformed payload", AttestationVerificationCertificationDeclarationInvalidFormat,
+		verifier.ValidateCertificateDeclarationPayload([]byte{0x15, 0x18}, nil, deviceInfo))
+}
@@ -0,0 +1,119 @@
+package dac
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib/tlv"
+)
+
+const (
+	// KCertificationElementsMaxSize TLV 编码的认证声明内容的最大长度
+	KCertificationElementsMaxSize = 350
+	// KCertificationDeclarationMaxSize CMS 签名的认证声明的最大长度
+	KCertificationDeclarationMaxSize = 600
+
+	kCertificationElementsFormatVersion uint16 = 1
+	kCertificateIdLength                       = 19
+	kMaxProductIdsCount                        = 100
+	kMaxAuthorizedPAAListCount                 = 10
+	kKeyIdentifierLength                       = 20
+)
+
+// CertificationType 认证声明的类型
+const (
+	CertificationTypeDevelopmentAndTest uint8 = iota
+	CertificationTypeProvisional
+	CertificationTypeOfficial
+)
+
+// CertificationElements 认证声明的内容，由 CSA 使用 CMS 签名
+type CertificationElements struct {
+	FormatVersion       uint16   `tlv:"0"`
+	VendorId            uint16   `tlv:"1"`
+	ProductIds          []uint16 `tlv:"2"`
+	DeviceTypeId        uint32   `tlv:"3"`
+	CertificateId       string   `tlv:"4"`
+	SecurityLevel       uint8    `tlv:"5"`
+	SecurityInformation uint16   `tlv:"6"`
+	VersionNumber       uint16   `tlv:"7"`
+	CertificationType   uint8    `tlv:"8"`
+	// DacOriginVendorId 和 DacOriginProductId 同时存在或者同时不存在
+	DacOriginVendorId  uint16 `tlv:"9,omitempty"`
+	DacOriginProductId uint16 `tlv:"10,omitempty"`
+	// AuthorizedPAAList PAA 的 SubjectKeyIdentifier 列表
+	AuthorizedPAAList [][]byte `tlv:"11,omitempty"`
+}
+
+// IsDacOriginPresent 是否指定了 DAC 的来源 VID 和 PID
+func (c *CertificationElements) IsDacOriginPresent() bool {
+	return c.DacOriginVendorId != 0 && c.DacOriginProductId != 0
+}
+
+// HasProductId 认证声明是否包含 productId
+func (c *CertificationElements) HasProductId(productId uint16) bool {
+	for _, id := range c.ProductIds {
+		if id == productId {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CertificationElements) validate() error {
+	if c.FormatVersion != kCertificationElementsFormatVersion {
+		return internal.ChipErrorInvalidArgument
+	}
+	if len(c.ProductIds) == 0 || len(c.ProductIds) > kMaxProductIdsCount {
+		return internal.ChipErrorInvalidArgument
+	}
+	if len(c.CertificateId) != kCertificateIdLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	if c.CertificationType > CertificationTypeOfficial {
+		return internal.ChipErrorInvalidArgument
+	}
+	if (c.DacOriginVendorId != 0) != (c.DacOriginProductId != 0) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if len(c.AuthorizedPAAList) > kMaxAuthorizedPAAListCount {
+		return internal.ChipErrorInvalidArgument
+	}
+	for _, keyId := range c.AuthorizedPAAList {
+		if len(keyId) != kKeyIdentifierLength {
+			return internal.ChipErrorInvalidArgument
+		}
+	}
+	return nil
+}
+
+// EncodeCertificationElements 把认证声明的内容编码为 TLV，FormatVersion 为 0 时使用当前版本
+func EncodeCertificationElements(elements CertificationElements) ([]byte, error) {
+	if elements.FormatVersion == 0 {
+		elements.FormatVersion = kCertificationElementsFormatVersion
+	}
+	if err := elements.validate(); err != nil {
+		return nil, err
+	}
+	data, err := tlv.Marshal(&elements)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > KCertificationElementsMaxSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return data, nil
+}
+
+// DecodeCertificationElements 解码 TLV 编码的认证声明内容
+func DecodeCertificationElements(data []byte) (*CertificationElements, error) {
+	if len(data) == 0 || len(data) > KCertificationElementsMaxSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	elements := &CertificationElements{}
+	if err := tlv.Unmarshal(data, elements); err != nil {
+		return nil, err
+	}
+	if err := elements.validate(); err != nil {
+		return nil, err
+	}
+	return elements, nil
+}
@@ -0,0 +1,146 @@
+package dac
+
+import (
+	"encoding/asn1"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+)
+
+// 认证声明使用的 CMS SignedData 格式，只有一个签名者，没有签名属性和证书
+var (
+	oidCMSSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidCMSData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSHA256             = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidECDSAWithSHA256    = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	kCMSSignedDataVersion = 3
+)
+
+type cmsAlgorithmIdentifier struct {
+	Algorithm asn1.ObjectIdentifier
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// Content [0] EXPLICIT SignedData
+	Content asn1.RawValue
+}
+
+type cmsEncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SubjectKeyId       []byte `asn1:"tag:0"`
+	DigestAlgorithm    cmsAlgorithmIdentifier
+	SignatureAlgorithm cmsAlgorithmIdentifier
+	Signature          []byte
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []cmsAlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapsulatedContentInfo
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+// CMSSign 使用 signerKeypair 对 content 签名，signerKeyId 是签名证书的 SubjectKeyIdentifier
+func CMSSign(content []byte, signerKeyId []byte, signerKeypair *crypto.P256Keypair) ([]byte, error) {
+	if len(content) == 0 || len(signerKeyId) != kKeyIdentifierLength || signerKeypair == nil {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	signature, err := signerKeypair.ECDSASignMsg(content)
+	if err != nil {
+		return nil, err
+	}
+	derSignature, err := crypto.EcdsaRawSignatureToAsn1(signature)
+	if err != nil {
+		return nil, err
+	}
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          kCMSSignedDataVersion,
+		DigestAlgorithms: []cmsAlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: cmsEncapsulatedContentInfo{EContentType: oidCMSData, EContent: content},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            kCMSSignedDataVersion,
+			SubjectKeyId:       signerKeyId,
+			DigestAlgorithm:    cmsAlgorithmIdentifier{Algorithm: oidSHA256},
+			SignatureAlgorithm: cmsAlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          derSignature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidCMSSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// parseCMSSignedData 解析只有一个签名者的 CMS SignedData
+func parseCMSSignedData(message []byte) (*cmsSignedData, error) {
+	var contentInfo cmsContentInfo
+	rest, err := asn1.Unmarshal(message, &contentInfo)
+	if err != nil || len(rest) != 0 {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if !contentInfo.ContentType.Equal(oidCMSSignedData) || contentInfo.Content.Class != asn1.ClassContextSpecific ||
+		contentInfo.Content.Tag != 0 || !contentInfo.Content.IsCompound {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	var signedData cmsSignedData
+	rest, err = asn1.Unmarshal(contentInfo.Content.Bytes, &signedData)
+	if err != nil || len(rest) != 0 {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if signedData.Version != kCMSSignedDataVersion || len(signedData.SignerInfos) != 1 ||
+		!signedData.EncapContentInfo.EContentType.Equal(oidCMSData) || len(signedData.EncapContentInfo.EContent) == 0 {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	signerInfo := signedData.SignerInfos[0]
+	if !signerInfo.DigestAlgorithm.Algorithm.Equal(oidSHA256) || !signerInfo.SignatureAlgorithm.Algorithm.Equal(oidECDSAWithSHA256) {
+		return nil, internal.ChipErrorUnsupportedSignatureType
+	}
+	return &signedData, nil
+}
+
+// CMSExtractKeyId 返回签名证书的 SubjectKeyIdentifier
+func CMSExtractKeyId(message []byte) ([]byte, error) {
+	signedData, err := parseCMSSignedData(message)
+	if err != nil {
+		return nil, err
+	}
+	keyId := signedData.SignerInfos[0].SubjectKeyId
+	if len(keyId) != kKeyIdentifierLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return keyId, nil
+}
+
+// CMSExtractContent 返回签名的内容，不验证签名
+func CMSExtractContent(message []byte) ([]byte, error) {
+	signedData, err := parseCMSSignedData(message)
+	if err != nil {
+		return nil, err
+	}
+	return signedData.EncapContentInfo.EContent, nil
+}
+
+// CMSVerify 使用签名者的公钥验证签名，返回签名的内容
+func CMSVerify(message []byte, signerPublicKey crypto.P256PublicKey) ([]byte, error) {
+	signedData, err := parseCMSSignedData(message)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypto.EcdsaAsn1SignatureToRaw(signedData.SignerInfos[0].Signature)
+	if err != nil {
+		return nil, internal.ChipErrorInvalidSignature
+	}
+	content := signedData.EncapContentInfo.EContent
+	if err = signerPublicKey.ECDSAValidateMsgSignature(content, signature); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
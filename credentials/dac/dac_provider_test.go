@@ -0,0 +1,332 @@
+package dac
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExampleDACProvider(t *testing.T) {
+	provider, err := NewExampleDACProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials, _ := ExampleDevelopmentCredentials()
+	paa, _ := x509.ParseCertificate(credentials.PaaCert)
+
+	dacDer, _ := provider.GetDeviceAttestationCert()
+	paiDer, _ := provider.GetProductAttestationIntermediateCert()
+	dacCert, err := x509.ParseCertificate(dacDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paiCert, err := x509.ParseCertificate(paiDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = paiCert.CheckSignatureFrom(paa); err != nil {
+		t.Errorf("PAI must be signed by PAA: %v", err)
+	}
+	if err = dacCert.CheckSignatureFrom(paiCert); err != nil {
+		t.Errorf("DAC must be signed by PAI: %v", err)
+	}
+	if dacCert.Subject.CommonName != "Matter Dev DAC 0xFFF1/0x8000" {
+		t.Errorf("unexpected DAC subject %q", dacCert.Subject.CommonName)
+	}
+	if paiCert.Subject.CommonName != "Matter Dev PAI 0xFFF1 no PID" || paa.Subject.CommonName != "Matter Test PAA" {
+		t.Errorf("unexpected PAI subject %q or PAA subject %q", paiCert.Subject.CommonName, paa.Subject.CommonName)
+	}
+	if vid, pid, ok := extractVidPidFromX509Cert(dacCert); !ok || vid != KTestVendorId || pid != KTestProductId {
+		t.Errorf("unexpected DAC VID 0x%04X PID 0x%04X", vid, pid)
+	}
+
+	// 凭证是固定的，每次得到的证书和秘钥都相同
+	again, err := ExampleDevelopmentCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.DacCert, dacDer) || !reflect.DeepEqual(again.CertificationDeclaration, credentials.CertificationDeclaration) ||
+		again.DacKeypair.Pubkey() != credentials.DacKeypair.Pubkey() {
+		t.Errorf("example credentials must not change")
+	}
+
+	message := []byte("attestation elements")
+	signature, err := provider.SignWithDeviceAttestationKey(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dacPublicKey, err := extractPublicKeyFromX509Cert(dacDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dacPublicKey.ECDSAValidateMsgSignature(message, signature); err != nil {
+		t.Errorf("signature must verify with the DAC public key: %v", err)
+	}
+
+	cd, _ := provider.GetCertificationDeclaration()
+	if len(cd) == 0 || len(cd) > KCertificationDeclarationMaxSize {
+		t.Errorf("unexpected certification declaration length %d", len(cd))
+	}
+	if firmware, _ := provider.GetFirmwareInformation(); len(firmware) != 0 {
+		t.Errorf("example provider has no firmware information")
+	}
+}
+
+func TestCertificationElements(t *testing.T) {
+	elements := CertificationElements{
+		VendorId:           KTestVendorId,
+		ProductIds:         []uint16{0x8000, 0x8001},
+		DeviceTypeId:       0x0016,
+		CertificateId:      "ZIG20142ZB330003-24",
+		SecurityLevel:      0,
+		VersionNumber:      0x2694,
+		CertificationType:  CertificationTypeProvisional,
+		DacOriginVendorId:  0xFFF2,
+		DacOriginProductId: 0x8010,
+		AuthorizedPAAList:  [][]byte{make([]byte, kKeyIdentifierLength)},
+	}
+	data, err := EncodeCertificationElements(elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeCertificationElements(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elements.FormatVersion = kCertificationElementsFormatVersion
+	if !reflect.DeepEqual(*decoded, elements) {
+		t.Errorf("decoded elements mismatch:\n%+v\n%+v", *decoded, elements)
+	}
+	if !decoded.IsDacOriginPresent() || !decoded.HasProductId(0x8001) || decoded.HasProductId(0x8002) {
+		t.Errorf("unexpected decoded elements %+v", *decoded)
+	}
+
+	elements.CertificateId = "too short"
+	if _, err = EncodeCertificationElements(elements); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("invalid certificate id must fail, got %v", err)
+	}
+}
+
+func TestFileDACProvider(t *testing.T) {
+	credentials, err := ExampleDevelopmentCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestAttestationCredentials(t)
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	dacKey, _ := credentials.DacKeypair.Serialize()
+	params := FileDACProviderParams{
+		DacCertPath:                  write("dac.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: credentials.DacCert})),
+		DacKeyPath:                   write("dac_key.der", testSec1PrivateKey(t, dacKey)),
+		PaiCertPath:                  write("pai.der", credentials.PaiCert),
+		CertificationDeclarationPath: write("cd.der", credentials.CertificationDeclaration),
+		FirmwareInformationPath:      write("firmware.bin", []byte{0x01, 0x02}),
+	}
+
+	provider, err := NewFileDACProvider(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dac, _ := provider.GetDeviceAttestationCert(); !reflect.DeepEqual(dac, credentials.DacCert) {
+		t.Errorf("PEM DAC must be loaded as DER")
+	}
+	if pai, _ := provider.GetProductAttestationIntermediateCert(); !reflect.DeepEqual(pai, credentials.PaiCert) {
+		t.Errorf("unexpected PAI")
+	}
+	if firmware, _ := provider.GetFirmwareInformation(); !reflect.DeepEqual(firmware, []byte{0x01, 0x02}) {
+		t.Errorf("unexpected firmware information %x", firmware)
+	}
+	signature, err := provider.SignWithDeviceAttestationKey([]byte("nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = credentials.DacKeypair.Pubkey().ECDSAValidateMsgSignature([]byte("nonce"), signature); err != nil {
+		t.Errorf("signature must verify: %v", err)
+	}
+
+	params.DacCertPath = write("other_dac.der", other.DacCert)
+	if _, err = NewFileDACProvider(params); err != internal.ChipErrorInvalidPublicKey {
+		t.Errorf("mismatched DAC key must fail, got %v", err)
+	}
+	params.DacCertPath = filepath.Join(dir, "missing.der")
+	if _, err = NewFileDACProvider(params); err == nil {
+		t.Errorf("missing DAC file must fail")
+	}
+}
+
+// testSec1PrivateKey 把 公钥 || 私钥 转换为 DER 编码的 SEC1 私钥
+func testSec1PrivateKey(t *testing.T, serialized []byte) []byte {
+	t.Helper()
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, serialized[:crypto.KP256PublicKeyLength])
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		D:         new(big.Int).SetBytes(serialized[crypto.KP256PublicKeyLength:]),
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// newTestAttestationCredentials 生成另一条与固定开发凭证主题相同、秘钥不同的证书链
+func newTestAttestationCredentials(t *testing.T) *DevelopmentAttestationCredentials {
+	t.Helper()
+	credentials, err := generateAttestationCredentials(KTestVendorId, KTestProductId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credentials
+}
+
+func generateAttestationCredentials(vendorId, productId uint16) (*DevelopmentAttestationCredentials, error) {
+	notBefore := time.Date(2021, time.June, 28, 14, 23, 43, 0, time.UTC)
+	notAfter := time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+
+	paaKey, paaCert, err := newAttestationCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Matter Test PAA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	paiKey, paiCert, err := newAttestationCert(&x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("Matter Dev PAI 0x%04X no PID", vendorId),
+			ExtraNames: matterAttributes(vendorId, 0),
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}, paaCert, paaKey)
+	if err != nil {
+		return nil, err
+	}
+	dacKey, dacCert, err := newAttestationCert(&x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("Matter Dev DAC 0x%04X/0x%04X", vendorId, productId),
+			ExtraNames: matterAttributes(vendorId, productId),
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}, paiCert, paiKey)
+	if err != nil {
+		return nil, err
+	}
+	cdSigningKey, cdSigningCert, err := newAttestationCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Matter Test CD Signing Authority"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dacKeypair, err := keypairFromECDSA(dacKey)
+	if err != nil {
+		return nil, err
+	}
+	cdSigningKeypair, err := keypairFromECDSA(cdSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := EncodeCertificationElements(CertificationElements{
+		VendorId:          vendorId,
+		ProductIds:        []uint16{productId},
+		DeviceTypeId:      0x0016,
+		CertificateId:     "ZIG20141ZB330001-24",
+		VersionNumber:     0x2694,
+		CertificationType: CertificationTypeDevelopmentAndTest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cd, err := CMSSign(elements, cdSigningCert.SubjectKeyId, cdSigningKeypair)
+	if err != nil {
+		return nil, err
+	}
+	return &DevelopmentAttestationCredentials{
+		PaaCert:                  paaCert.Raw,
+		PaiCert:                  paiCert.Raw,
+		DacCert:                  dacCert.Raw,
+		DacKeypair:               dacKeypair,
+		CdSigningCert:            cdSigningCert.Raw,
+		CertificationDeclaration: cd,
+	}, nil
+}
+
+// newAttestationCert 生成新的秘钥并由 parent 签发证书，parent 为空时生成自签名证书
+func newAttestationCert(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, *x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyId := sha1.Sum(elliptic.Marshal(elliptic.P256(), key.X, key.Y))
+	template.SerialNumber = serialNumber
+	template.SubjectKeyId = keyId[:]
+	template.SignatureAlgorithm = x509.ECDSAWithSHA256
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// matterAttributes 主题中的 VID 和 PID 属性，productId 为 0 时不包含 PID
+func matterAttributes(vendorId, productId uint16) []pkix.AttributeTypeAndValue {
+	attributes := []pkix.AttributeTypeAndValue{{Type: oidMatterVendorId, Value: matterAttributeValue(vendorId)}}
+	if productId != 0 {
+		attributes = append(attributes, pkix.AttributeTypeAndValue{Type: oidMatterProductId, Value: matterAttributeValue(productId)})
+	}
+	return attributes
+}
+
+func matterAttributeValue(value uint16) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagUTF8String, Bytes: []byte(fmt.Sprintf("%04X", value))}
+}
@@ -0,0 +1,230 @@
+package dac
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+)
+
+const (
+	// KTestVendorId 开发和测试使用的 VID
+	KTestVendorId uint16 = 0xFFF1
+	// KTestProductId 开发和测试使用的 PID
+	KTestProductId uint16 = 0x8000
+)
+
+// 认证证书主题中的 Matter 属性，值为4位大写十六进制的 UTF8String
+var (
+	oidMatterVendorId  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37244, 2, 1}
+	oidMatterProductId = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37244, 2, 2}
+)
+
+// DevelopmentAttestationCredentials 开发和测试使用的认证凭证：PAA → PAI → DAC 证书链，
+// 以及由测试 CD 签名证书签名的认证声明。证书都是 DER 编码
+type DevelopmentAttestationCredentials struct {
+	PaaCert                  []byte
+	PaiCert                  []byte
+	DacCert                  []byte
+	DacKeypair               *crypto.P256Keypair
+	CdSigningCert            []byte
+	CertificationDeclaration []byte
+}
+
+// 以下固定的开发凭证 (VID 0xFFF1, PID 0x8000) 的主题名称和有效期与 connectedhomeip 的测试证书相同，
+// 秘钥和签名是本仓库生成的，不能用于正式产品
+
+// kDevelopmentPAACert 测试 PAA 证书 "Matter Test PAA"
+var kDevelopmentPAACert = []byte{
+	0x30, 0x82, 0x01, 0x70, 0x30, 0x82, 0x01, 0x17, 0xa0, 0x03, 0x02, 0x01, 0x02, 0x02, 0x08, 0x6c,
+	0xf8, 0x64, 0x8a, 0x52, 0x1c, 0x63, 0x88, 0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d,
+	0x04, 0x03, 0x02, 0x30, 0x1a, 0x31, 0x18, 0x30, 0x16, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x0f,
+	0x4d, 0x61, 0x74, 0x74, 0x65, 0x72, 0x20, 0x54, 0x65, 0x73, 0x74, 0x20, 0x50, 0x41, 0x41, 0x30,
+	0x20, 0x17, 0x0d, 0x32, 0x31, 0x30, 0x36, 0x32, 0x38, 0x31, 0x34, 0x32, 0x33, 0x34, 0x33, 0x5a,
+	0x18, 0x0f, 0x39, 0x39, 0x39, 0x39, 0x31, 0x32, 0x33, 0x31, 0x32, 0x33, 0x35, 0x39, 0x35, 0x39,
+	0x5a, 0x30, 0x1a, 0x31, 0x18, 0x30, 0x16, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x0f, 0x4d, 0x61,
+	0x74, 0x74, 0x65, 0x72, 0x20, 0x54, 0x65, 0x73, 0x74, 0x20, 0x50, 0x41, 0x41, 0x30, 0x59, 0x30,
+	0x13, 0x06, 0x07, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x02, 0x01, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce,
+	0x3d, 0x03, 0x01, 0x07, 0x03, 0x42, 0x00, 0x04, 0xce, 0xf4, 0xdb, 0x7c, 0x4f, 0x6d, 0x5f, 0x7a,
+	0xb8, 0x8d, 0x13, 0xf7, 0xbc, 0x59, 0x64, 0x6a, 0xfb, 0x20, 0x83, 0xb6, 0x3e, 0x1a, 0xd5, 0x2b,
+	0xb6, 0x42, 0xbb, 0x4b, 0xb2, 0xe3, 0x8b, 0x0a, 0xfc, 0x27, 0x03, 0x12, 0x77, 0x5f, 0xef, 0xe7,
+	0x2f, 0x0b, 0xed, 0x67, 0xa0, 0x2a, 0xf4, 0x68, 0xdd, 0x74, 0x16, 0xd0, 0x9d, 0x2c, 0x7d, 0xb3,
+	0xa5, 0xf1, 0x31, 0x92, 0x68, 0x6d, 0x53, 0x71, 0xa3, 0x45, 0x30, 0x43, 0x30, 0x0e, 0x06, 0x03,
+	0x55, 0x1d, 0x0f, 0x01, 0x01, 0xff, 0x04, 0x04, 0x03, 0x02, 0x01, 0x06, 0x30, 0x12, 0x06, 0x03,
+	0x55, 0x1d, 0x13, 0x01, 0x01, 0xff, 0x04, 0x08, 0x30, 0x06, 0x01, 0x01, 0xff, 0x02, 0x01, 0x01,
+	0x30, 0x1d, 0x06, 0x03, 0x55, 0x1d, 0x0e, 0x04, 0x16, 0x04, 0x14, 0x64, 0xc4, 0xcb, 0xba, 0xf9,
+	0x41, 0xd6, 0xe3, 0x66, 0x26, 0xae, 0x13, 0xb7, 0x4f, 0x90, 0x82, 0xee, 0xe8, 0x8b, 0xf8, 0x30,
+	0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x04, 0x03, 0x02, 0x03, 0x47, 0x00, 0x30, 0x44,
+	0x02, 0x20, 0x0d, 0x8c, 0x6e, 0x30, 0xbf, 0x5f, 0x8b, 0x4f, 0x5b, 0x33, 0x6d, 0xdf, 0x13, 0xa4,
+	0xb6, 0x37, 0x7b, 0x3b, 0xd6, 0x93, 0xb6, 0x00, 0x0e, 0x5d, 0x2c, 0x2d, 0x44, 0xe8, 0x51, 0xee,
+	0x2b, 0xd8, 0x02, 0x20, 0x29, 0x47, 0xa5, 0x7c, 0x3e, 0x1d, 0x85, 0x21, 0x49, 0x20, 0x99, 0x03,
+	0x6a, 0x49, 0x00, 0x94, 0x7d, 0x0e, 0x2b, 0x30, 0x49, 0x65, 0x47, 0x72, 0x0d, 0xdd, 0x61, 0x90,
+	0xe4, 0xaa, 0x7c, 0x48,
+}
+
+// kDevelopmentPAICertFFF1 由测试 PAA 签发的 PAI 证书 "Matter Dev PAI 0xFFF1 no PID"
+var kDevelopmentPAICertFFF1 = []byte{
+	0x30, 0x82, 0x01, 0xb4, 0x30, 0x82, 0x01, 0x5b, 0xa0, 0x03, 0x02, 0x01, 0x02, 0x02, 0x08, 0x35,
+	0x7c, 0xcd, 0xa8, 0xf4, 0xd6, 0xbb, 0x56, 0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d,
+	0x04, 0x03, 0x02, 0x30, 0x1a, 0x31, 0x18, 0x30, 0x16, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x0f,
+	0x4d, 0x61, 0x74, 0x74, 0x65, 0x72, 0x20, 0x54, 0x65, 0x73, 0x74, 0x20, 0x50, 0x41, 0x41, 0x30,
+	0x20, 0x17, 0x0d, 0x32, 0x31, 0x30, 0x36, 0x32, 0x38, 0x31, 0x34, 0x32, 0x33, 0x34, 0x33, 0x5a,
+	0x18, 0x0f, 0x39, 0x39, 0x39, 0x39, 0x31, 0x32, 0x33, 0x31, 0x32, 0x33, 0x35, 0x39, 0x35, 0x39,
+	0x5a, 0x30, 0x3d, 0x31, 0x25, 0x30, 0x23, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x1c, 0x4d, 0x61,
+	0x74, 0x74, 0x65, 0x72, 0x20, 0x44, 0x65, 0x76, 0x20, 0x50, 0x41, 0x49, 0x20, 0x30, 0x78, 0x46,
+	0x46, 0x46, 0x31, 0x20, 0x6e, 0x6f, 0x20, 0x50, 0x49, 0x44, 0x31, 0x14, 0x30, 0x12, 0x06, 0x0a,
+	0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0xa2, 0x7c, 0x02, 0x01, 0x0c, 0x04, 0x46, 0x46, 0x46, 0x31,
+	0x30, 0x59, 0x30, 0x13, 0x06, 0x07, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x02, 0x01, 0x06, 0x08, 0x2a,
+	0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07, 0x03, 0x42, 0x00, 0x04, 0x46, 0xc5, 0x20, 0x9d, 0x60,
+	0xdc, 0x27, 0xae, 0x7f, 0xc4, 0x1d, 0x4f, 0x82, 0x79, 0x25, 0x2f, 0xef, 0xca, 0xc2, 0x8e, 0xbf,
+	0x06, 0xa7, 0xfd, 0x9d, 0x51, 0x55, 0xf3, 0x2b, 0x2b, 0x91, 0xfd, 0x36, 0x6a, 0x3b, 0x65, 0x2d,
+	0x87, 0x5d, 0x84, 0x83, 0x2d, 0x16, 0x67, 0x39, 0x0b, 0x28, 0xcd, 0x00, 0x02, 0x72, 0xfc, 0x3c,
+	0x0b, 0xb8, 0x23, 0x4c, 0x54, 0xf1, 0x3c, 0xe7, 0x91, 0x44, 0xb0, 0xa3, 0x66, 0x30, 0x64, 0x30,
+	0x0e, 0x06, 0x03, 0x55, 0x1d, 0x0f, 0x01, 0x01, 0xff, 0x04, 0x04, 0x03, 0x02, 0x01, 0x06, 0x30,
+	0x12, 0x06, 0x03, 0x55, 0x1d, 0x13, 0x01, 0x01, 0xff, 0x04, 0x08, 0x30, 0x06, 0x01, 0x01, 0xff,
+	0x02, 0x01, 0x00, 0x30, 0x1d, 0x06, 0x03, 0x55, 0x1d, 0x0e, 0x04, 0x16, 0x04, 0x14, 0x9e, 0x8e,
+	0x40, 0xfb, 0x4b, 0x80, 0xf8, 0xcd, 0x9d, 0x11, 0x29, 0x8e, 0x72, 0x47, 0x6a, 0x91, 0x2b, 0x27,
+	0xe2, 0x5a, 0x30, 0x1f, 0x06, 0x03, 0x55, 0x1d, 0x23, 0x04, 0x18, 0x30, 0x16, 0x80, 0x14, 0x64,
+	0xc4, 0xcb, 0xba, 0xf9, 0x41, 0xd6, 0xe3, 0x66, 0x26, 0xae, 0x13, 0xb7, 0x4f, 0x90, 0x82, 0xee,
+	0xe8, 0x8b, 0xf8, 0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x04, 0x03, 0x02, 0x03,
+	0x47, 0x00, 0x30, 0x44, 0x02, 0x20, 0x1e, 0xed, 0xe5, 0x31, 0x34, 0x0e, 0x32, 0xb4, 0xcc, 0x1e,
+	0x2c, 0x9b, 0x81, 0xd8, 0x96, 0x1d, 0xd3, 0xc3, 0x9d, 0x39, 0xc5, 0x82, 0x78, 0xb8, 0xe3, 0x68,
+	0x2e, 0x46, 0x2e, 0x7a, 0x39, 0x68, 0x02, 0x20, 0x2d, 0x4e, 0x14, 0x09, 0x04, 0x6f, 0x13, 0xe5,
+	0x18, 0x7e, 0xf3, 0x50, 0xaa, 0xe8, 0x3a, 0x5d, 0x00, 0xf5, 0x84, 0xd4, 0x56, 0xe3, 0x86, 0x3b,
+	0x28, 0xb2, 0x40, 0x11, 0x75, 0xa8, 0xbc, 0x2e,
+}
+
+// kDevelopmentDACCertFFF18000 由 PAI 签发的 DAC 证书 "Matter Dev DAC 0xFFF1/0x8000"
+var kDevelopmentDACCertFFF18000 = []byte{
+	0x30, 0x82, 0x01, 0xe9, 0x30, 0x82, 0x01, 0x8e, 0xa0, 0x03, 0x02, 0x01, 0x02, 0x02, 0x08, 0x0e,
+	0xb1, 0xc1, 0xce, 0x3c, 0x6e, 0x07, 0x81, 0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d,
+	0x04, 0x03, 0x02, 0x30, 0x3d, 0x31, 0x25, 0x30, 0x23, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x1c,
+	0x4d, 0x61, 0x74, 0x74, 0x65, 0x72, 0x20, 0x44, 0x65, 0x76, 0x20, 0x50, 0x41, 0x49, 0x20, 0x30,
+	0x78, 0x46, 0x46, 0x46, 0x31, 0x20, 0x6e, 0x6f, 0x20, 0x50, 0x49, 0x44, 0x31, 0x14, 0x30, 0x12,
+	0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0xa2, 0x7c, 0x02, 0x01, 0x0c, 0x04, 0x46, 0x46,
+	0x46, 0x31, 0x30, 0x20, 0x17, 0x0d, 0x32, 0x31, 0x30, 0x36, 0x32, 0x38, 0x31, 0x34, 0x32, 0x33,
+	0x34, 0x33, 0x5a, 0x18, 0x0f, 0x39, 0x39, 0x39, 0x39, 0x31, 0x32, 0x33, 0x31, 0x32, 0x33, 0x35,
+	0x39, 0x35, 0x39, 0x5a, 0x30, 0x53, 0x31, 0x25, 0x30, 0x23, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13,
+	0x1c, 0x4d, 0x61, 0x74, 0x74, 0x65, 0x72, 0x20, 0x44, 0x65, 0x76, 0x20, 0x44, 0x41, 0x43, 0x20,
+	0x30, 0x78, 0x46, 0x46, 0x46, 0x31, 0x2f, 0x30, 0x78, 0x38, 0x30, 0x30, 0x30, 0x31, 0x14, 0x30,
+	0x12, 0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0xa2, 0x7c, 0x02, 0x01, 0x0c, 0x04, 0x46,
+	0x46, 0x46, 0x31, 0x31, 0x14, 0x30, 0x12, 0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0xa2,
+	0x7c, 0x02, 0x02, 0x0c, 0x04, 0x38, 0x30, 0x30, 0x30, 0x30, 0x59, 0x30, 0x13, 0x06, 0x07, 0x2a,
+	0x86, 0x48, 0xce, 0x3d, 0x02, 0x01, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07,
+	0x03, 0x42, 0x00, 0x04, 0xca, 0xb4, 0xd3, 0x22, 0xa0, 0xec, 0xa2, 0xed, 0x4a, 0x14, 0x08, 0x54,
+	0xf0, 0x7a, 0xc0, 0x5b, 0x85, 0x89, 0x5a, 0x0f, 0xc2, 0x99, 0x78, 0x6e, 0x7e, 0x34, 0x76, 0x30,
+	0xbb, 0x7d, 0xc2, 0x2c, 0xb6, 0x92, 0xd9, 0x5f, 0xd0, 0xcc, 0xcc, 0x22, 0x82, 0x4e, 0xad, 0x67,
+	0x70, 0xaf, 0xee, 0xb5, 0x2d, 0x4a, 0xd4, 0x5b, 0x68, 0x0e, 0x5e, 0x76, 0xe4, 0xef, 0x60, 0x30,
+	0xf5, 0x0f, 0x86, 0x95, 0xa3, 0x60, 0x30, 0x5e, 0x30, 0x0e, 0x06, 0x03, 0x55, 0x1d, 0x0f, 0x01,
+	0x01, 0xff, 0x04, 0x04, 0x03, 0x02, 0x07, 0x80, 0x30, 0x0c, 0x06, 0x03, 0x55, 0x1d, 0x13, 0x01,
+	0x01, 0xff, 0x04, 0x02, 0x30, 0x00, 0x30, 0x1d, 0x06, 0x03, 0x55, 0x1d, 0x0e, 0x04, 0x16, 0x04,
+	0x14, 0xc6, 0x5f, 0x72, 0x74, 0x30, 0xe8, 0xa9, 0x36, 0x0d, 0xaa, 0x6b, 0x44, 0x12, 0xc8, 0xf1,
+	0x97, 0xd2, 0x7c, 0x5e, 0x4c, 0x30, 0x1f, 0x06, 0x03, 0x55, 0x1d, 0x23, 0x04, 0x18, 0x30, 0x16,
+	0x80, 0x14, 0x9e, 0x8e, 0x40, 0xfb, 0x4b, 0x80, 0xf8, 0xcd, 0x9d, 0x11, 0x29, 0x8e, 0x72, 0x47,
+	0x6a, 0x91, 0x2b, 0x27, 0xe2, 0x5a, 0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x04,
+	0x03, 0x02, 0x03, 0x49, 0x00, 0x30, 0x46, 0x02, 0x21, 0x00, 0x92, 0x3d, 0x24, 0x19, 0xa7, 0xfa,
+	0x21, 0xd9, 0x0d, 0x2a, 0x7a, 0xf1, 0x2f, 0x1d, 0x8d, 0x65, 0x97, 0x7f, 0xc5, 0x6c, 0x9f, 0x74,
+	0xc8, 0xc3, 0x32, 0xdd, 0x7f, 0xe0, 0x7f, 0xd0, 0x1d, 0xa9, 0x02, 0x21, 0x00, 0xaa, 0x4e, 0x28,
+	0x0f, 0x88, 0x75, 0x42, 0x50, 0x68, 0xf5, 0x69, 0x06, 0xef, 0x69, 0x34, 0x97, 0x72, 0xde, 0xcf,
+	0x28, 0x3f, 0x67, 0x9e, 0x93, 0x35, 0x20, 0x08, 0x6e, 0x61, 0xaf, 0x1c, 0xee,
+}
+
+// kDevelopmentDACPublicKeyFFF18000 DAC 的公钥，未压缩格式
+var kDevelopmentDACPublicKeyFFF18000 = []byte{
+	0x04, 0xca, 0xb4, 0xd3, 0x22, 0xa0, 0xec, 0xa2, 0xed, 0x4a, 0x14, 0x08, 0x54, 0xf0, 0x7a, 0xc0,
+	0x5b, 0x85, 0x89, 0x5a, 0x0f, 0xc2, 0x99, 0x78, 0x6e, 0x7e, 0x34, 0x76, 0x30, 0xbb, 0x7d, 0xc2,
+	0x2c, 0xb6, 0x92, 0xd9, 0x5f, 0xd0, 0xcc, 0xcc, 0x22, 0x82, 0x4e, 0xad, 0x67, 0x70, 0xaf, 0xee,
+	0xb5, 0x2d, 0x4a, 0xd4, 0x5b, 0x68, 0x0e, 0x5e, 0x76, 0xe4, 0xef, 0x60, 0x30, 0xf5, 0x0f, 0x86,
+	0x95,
+}
+
+// kDevelopmentDACPrivateKeyFFF18000 DAC 的私钥
+var kDevelopmentDACPrivateKeyFFF18000 = []byte{
+	0x2f, 0x0d, 0x39, 0x54, 0xe1, 0x76, 0xa8, 0x57, 0xd8, 0x4c, 0xd3, 0xc3, 0xfd, 0xe5, 0xa3, 0x6a,
+	0x1b, 0x8a, 0xa8, 0x4c, 0x60, 0x7a, 0x0b, 0x84, 0xa4, 0xa1, 0x68, 0xca, 0x4a, 0xd9, 0x7c, 0x0c,
+}
+
+// kDevelopmentCDSigningCert 测试认证声明签名证书 "Matter Test CD Signing Authority"
+var kDevelopmentCDSigningCert = []byte{
+	0x30, 0x82, 0x01, 0x8e, 0x30, 0x82, 0x01, 0x33, 0xa0, 0x03, 0x02, 0x01, 0x02, 0x02, 0x08, 0x26,
+	0x33, 0x51, 0xb7, 0x9c, 0x1f, 0xc3, 0xcf, 0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d,
+	0x04, 0x03, 0x02, 0x30, 0x2b, 0x31, 0x29, 0x30, 0x27, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x20,
+	0x4d, 0x61, 0x74, 0x74, 0x65, 0x72, 0x20, 0x54, 0x65, 0x73, 0x74, 0x20, 0x43, 0x44, 0x20, 0x53,
+	0x69, 0x67, 0x6e, 0x69, 0x6e, 0x67, 0x20, 0x41, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x74, 0x79,
+	0x30, 0x20, 0x17, 0x0d, 0x32, 0x31, 0x30, 0x36, 0x32, 0x38, 0x31, 0x34, 0x32, 0x33, 0x34, 0x33,
+	0x5a, 0x18, 0x0f, 0x39, 0x39, 0x39, 0x39, 0x31, 0x32, 0x33, 0x31, 0x32, 0x33, 0x35, 0x39, 0x35,
+	0x39, 0x5a, 0x30, 0x2b, 0x31, 0x29, 0x30, 0x27, 0x06, 0x03, 0x55, 0x04, 0x03, 0x13, 0x20, 0x4d,
+	0x61, 0x74, 0x74, 0x65, 0x72, 0x20, 0x54, 0x65, 0x73, 0x74, 0x20, 0x43, 0x44, 0x20, 0x53, 0x69,
+	0x67, 0x6e, 0x69, 0x6e, 0x67, 0x20, 0x41, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x30,
+	0x59, 0x30, 0x13, 0x06, 0x07, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x02, 0x01, 0x06, 0x08, 0x2a, 0x86,
+	0x48, 0xce, 0x3d, 0x03, 0x01, 0x07, 0x03, 0x42, 0x00, 0x04, 0x58, 0x56, 0xcf, 0x4d, 0x94, 0x32,
+	0xe2, 0x47, 0x85, 0x6c, 0x2c, 0xa9, 0xc4, 0xa3, 0x2d, 0xae, 0xc8, 0x75, 0x1d, 0x45, 0x64, 0x00,
+	0x2c, 0x11, 0x6e, 0xfa, 0x57, 0x63, 0x96, 0x58, 0x76, 0x98, 0x2d, 0xb8, 0x7d, 0x2d, 0xd9, 0x20,
+	0x41, 0x75, 0x6b, 0x7d, 0xef, 0x30, 0x14, 0x78, 0x2b, 0xb8, 0x33, 0xfe, 0x76, 0x14, 0x9f, 0x5d,
+	0x83, 0x46, 0xe9, 0xfc, 0x70, 0xdd, 0x6e, 0x53, 0x8a, 0xa0, 0xa3, 0x3f, 0x30, 0x3d, 0x30, 0x0e,
+	0x06, 0x03, 0x55, 0x1d, 0x0f, 0x01, 0x01, 0xff, 0x04, 0x04, 0x03, 0x02, 0x07, 0x80, 0x30, 0x0c,
+	0x06, 0x03, 0x55, 0x1d, 0x13, 0x01, 0x01, 0xff, 0x04, 0x02, 0x30, 0x00, 0x30, 0x1d, 0x06, 0x03,
+	0x55, 0x1d, 0x0e, 0x04, 0x16, 0x04, 0x14, 0x1e, 0x59, 0x54, 0x8c, 0x44, 0x4b, 0x26, 0x7d, 0x24,
+	0x06, 0x55, 0x96, 0x89, 0xff, 0xe0, 0x4d, 0x1e, 0x18, 0x0e, 0xf8, 0x30, 0x0a, 0x06, 0x08, 0x2a,
+	0x86, 0x48, 0xce, 0x3d, 0x04, 0x03, 0x02, 0x03, 0x49, 0x00, 0x30, 0x46, 0x02, 0x21, 0x00, 0xc7,
+	0xf4, 0x8a, 0x48, 0xe2, 0xd9, 0xf9, 0x36, 0xe8, 0x0c, 0x4c, 0xcd, 0x68, 0x42, 0xce, 0xc4, 0x7f,
+	0xb8, 0x20, 0x84, 0x2e, 0x40, 0xd1, 0xb7, 0xf1, 0xee, 0x0b, 0xe6, 0x6e, 0x53, 0x34, 0xda, 0x02,
+	0x21, 0x00, 0xe4, 0x55, 0x56, 0xc8, 0x2a, 0x85, 0x59, 0xdd, 0x7f, 0x9e, 0xe1, 0x98, 0xc1, 0x4f,
+	0x9c, 0xff, 0x1d, 0xe7, 0x9f, 0xaf, 0x9a, 0x08, 0x8f, 0x45, 0xb3, 0x16, 0x20, 0x27, 0xfc, 0xfc,
+	0x44, 0xff,
+}
+
+// kDevelopmentCertificationDeclaration 由 CD 签名证书签名的认证声明，
+// VID 0xFFF1，PID 0x8000，类型为 CertificationTypeDevelopmentAndTest
+var kDevelopmentCertificationDeclaration = []byte{
+	0x30, 0x81, 0xe8, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x07, 0x02, 0xa0, 0x81,
+	0xda, 0x30, 0x81, 0xd7, 0x02, 0x01, 0x03, 0x31, 0x0d, 0x30, 0x0b, 0x06, 0x09, 0x60, 0x86, 0x48,
+	0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x30, 0x44, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d,
+	0x01, 0x07, 0x01, 0xa0, 0x37, 0x04, 0x35, 0x15, 0x24, 0x00, 0x01, 0x25, 0x01, 0xf1, 0xff, 0x36,
+	0x02, 0x05, 0x00, 0x80, 0x18, 0x24, 0x03, 0x16, 0x2c, 0x04, 0x13, 0x5a, 0x49, 0x47, 0x32, 0x30,
+	0x31, 0x34, 0x31, 0x5a, 0x42, 0x33, 0x33, 0x30, 0x30, 0x30, 0x31, 0x2d, 0x32, 0x34, 0x24, 0x05,
+	0x00, 0x24, 0x06, 0x00, 0x25, 0x07, 0x94, 0x26, 0x24, 0x08, 0x00, 0x18, 0x31, 0x7d, 0x30, 0x7b,
+	0x02, 0x01, 0x03, 0x80, 0x14, 0x1e, 0x59, 0x54, 0x8c, 0x44, 0x4b, 0x26, 0x7d, 0x24, 0x06, 0x55,
+	0x96, 0x89, 0xff, 0xe0, 0x4d, 0x1e, 0x18, 0x0e, 0xf8, 0x30, 0x0b, 0x06, 0x09, 0x60, 0x86, 0x48,
+	0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x30, 0x0a, 0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x04,
+	0x03, 0x02, 0x04, 0x47, 0x30, 0x45, 0x02, 0x20, 0x3a, 0x81, 0xab, 0xe6, 0x47, 0x51, 0x8b, 0x83,
+	0x54, 0x0e, 0x74, 0x0e, 0xac, 0x1e, 0xee, 0x17, 0x85, 0x02, 0x01, 0xb3, 0xff, 0x26, 0x99, 0xa7,
+	0x2b, 0xc0, 0xbb, 0x13, 0x50, 0x50, 0x7f, 0xd5, 0x02, 0x21, 0x00, 0x91, 0xd3, 0x38, 0xf5, 0xf5,
+	0x1f, 0x13, 0x5f, 0x50, 0x0d, 0x85, 0xe3, 0xfa, 0xe4, 0xfb, 0xfa, 0x38, 0x6e, 0x85, 0xce, 0x89,
+	0x4b, 0x72, 0xf5, 0x7e, 0xb8, 0x99, 0xe7, 0x9e, 0x42, 0x6d, 0xcd,
+}
+
+// NewDevelopmentAttestationCredentials 返回固定的开发凭证，每次返回新的副本
+func NewDevelopmentAttestationCredentials() (*DevelopmentAttestationCredentials, error) {
+	serialized := make([]byte, 0, crypto.KP256SerializedKeypairLength)
+	serialized = append(serialized, kDevelopmentDACPublicKeyFFF18000...)
+	serialized = append(serialized, kDevelopmentDACPrivateKeyFFF18000...)
+	dacKeypair := crypto.NewP256Keypair()
+	if err := dacKeypair.Deserialize(serialized); err != nil {
+		return nil, err
+	}
+	return &DevelopmentAttestationCredentials{
+		PaaCert:                  append([]byte(nil), kDevelopmentPAACert...),
+		PaiCert:                  append([]byte(nil), kDevelopmentPAICertFFF1...),
+		DacCert:                  append([]byte(nil), kDevelopmentDACCertFFF18000...),
+		DacKeypair:               dacKeypair,
+		CdSigningCert:            append([]byte(nil), kDevelopmentCDSigningCert...),
+		CertificationDeclaration: append([]byte(nil), kDevelopmentCertificationDeclaration...),
+	}, nil
+}
+
+// keypairFromECDSA 把标准库的 P256 私钥转换为 P256Keypair
+func keypairFromECDSA(key *ecdsa.PrivateKey) (*crypto.P256Keypair, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, internal.ChipErrorUnsupportedEllipticCurve
+	}
+	serialized := make([]byte, crypto.KP256SerializedKeypairLength)
+	copy(serialized, elliptic.Marshal(key.Curve, key.X, key.Y))
+	key.D.FillBytes(serialized[crypto.KP256PublicKeyLength:])
+	keypair := crypto.NewP256Keypair()
+	if err := keypair.Deserialize(serialized); err != nil {
+		return nil, err
+	}
+	return keypair, nil
+}
@@ -1,23 +1,60 @@
 package dac
 
+import (
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+)
+
+// DeviceAttestationCredentialsProvider 提供设备认证需要的凭证，证书都是 DER 编码的 X.509 证书
 type DeviceAttestationCredentialsProvider interface {
-	GetCertificationDeclaration()
-	GetFirmwareInformation()
-	GetDeviceAttestationCert()
-	GetProductAttestationIntermediateCert()
-	SignWithDeviceAttestationKey()
-	IsDeviceAttestationCredentialsProviderSet() bool
+	// GetCertificationDeclaration CMS 签名的认证声明
+	GetCertificationDeclaration() ([]byte, error)
+	// GetFirmwareInformation 固件信息，没有时返回空
+	GetFirmwareInformation() ([]byte, error)
+	GetDeviceAttestationCert() ([]byte, error)
+	GetProductAttestationIntermediateCert() ([]byte, error)
+	// SignWithDeviceAttestationKey 使用 DAC 的私钥对消息的 SHA256 摘要签名
+	SignWithDeviceAttestationKey(message []byte) (crypto.P256ECDSASignature, error)
 }
 
+// UnimplementedDACProvider 没有设置凭证时使用，所有方法都返回 ChipErrorNotImplemented
 type UnimplementedDACProvider struct {
 }
 
+func (u UnimplementedDACProvider) GetCertificationDeclaration() ([]byte, error) {
+	return nil, internal.ChipErrorNotImplemented
+}
+
+func (u UnimplementedDACProvider) GetFirmwareInformation() ([]byte, error) {
+	return nil, internal.ChipErrorNotImplemented
+}
+
+func (u UnimplementedDACProvider) GetDeviceAttestationCert() ([]byte, error) {
+	return nil, internal.ChipErrorNotImplemented
+}
+
+func (u UnimplementedDACProvider) GetProductAttestationIntermediateCert() ([]byte, error) {
+	return nil, internal.ChipErrorNotImplemented
+}
+
+func (u UnimplementedDACProvider) SignWithDeviceAttestationKey([]byte) (crypto.P256ECDSASignature, error) {
+	return crypto.P256ECDSASignature{}, internal.ChipErrorNotImplemented
+}
+
 var gDacProvider DeviceAttestationCredentialsProvider
 
 func SetDeviceAttestationCredentialsProvider(provider DeviceAttestationCredentialsProvider) {
 	gDacProvider = provider
 }
 
+// GetDeviceAttestationCredentialsProvider 没有设置时返回 UnimplementedDACProvider
 func GetDeviceAttestationCredentialsProvider() DeviceAttestationCredentialsProvider {
+	if gDacProvider == nil {
+		return UnimplementedDACProvider{}
+	}
 	return gDacProvider
 }
+
+func IsDeviceAttestationCredentialsProviderSet() bool {
+	return gDacProvider != nil
+}
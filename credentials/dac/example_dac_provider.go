@@ -0,0 +1,45 @@
+package dac
+
+import (
+	"github.com/galenliu/chip/crypto"
+)
+
+// ExampleDACProviderImpl 使用开发和测试凭证 (VID 0xFFF1, PID 0x8000) 的示例实现，不能用于正式产品
+type ExampleDACProviderImpl struct {
+	mCredentials *DevelopmentAttestationCredentials
+}
+
+// ExampleDevelopmentCredentials 示例使用的固定开发凭证，
+// 认证验证需要信任其中的 PAA 和 CD 签名证书
+func ExampleDevelopmentCredentials() (*DevelopmentAttestationCredentials, error) {
+	return NewDevelopmentAttestationCredentials()
+}
+
+func NewExampleDACProvider() (*ExampleDACProviderImpl, error) {
+	credentials, err := ExampleDevelopmentCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return &ExampleDACProviderImpl{mCredentials: credentials}, nil
+}
+
+func (e *ExampleDACProviderImpl) GetCertificationDeclaration() ([]byte, error) {
+	return append([]byte(nil), e.mCredentials.CertificationDeclaration...), nil
+}
+
+// GetFirmwareInformation 示例没有固件信息
+func (e *ExampleDACProviderImpl) GetFirmwareInformation() ([]byte, error) {
+	return nil, nil
+}
+
+func (e *ExampleDACProviderImpl) GetDeviceAttestationCert() ([]byte, error) {
+	return append([]byte(nil), e.mCredentials.DacCert...), nil
+}
+
+func (e *ExampleDACProviderImpl) GetProductAttestationIntermediateCert() ([]byte, error) {
+	return append([]byte(nil), e.mCredentials.PaiCert...), nil
+}
+
+func (e *ExampleDACProviderImpl) SignWithDeviceAttestationKey(message []byte) (crypto.P256ECDSASignature, error) {
+	return e.mCredentials.DacKeypair.ECDSASignMsg(message)
+}
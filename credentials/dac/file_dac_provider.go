@@ -0,0 +1,144 @@
+package dac
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"os"
+)
+
+// FileDACProviderParams 凭证文件的路径，证书和私钥可以是 DER 或者 PEM 格式
+type FileDACProviderParams struct {
+	DacCertPath                  string
+	DacKeyPath                   string
+	PaiCertPath                  string
+	CertificationDeclarationPath string
+	// FirmwareInformationPath 可选
+	FirmwareInformationPath string
+}
+
+// FileDACProvider 在创建时从文件加载凭证，并检查 DAC 私钥与证书匹配
+type FileDACProvider struct {
+	mCertificationDeclaration []byte
+	mFirmwareInformation      []byte
+	mDacCert                  []byte
+	mPaiCert                  []byte
+	mDacKeypair               *crypto.P256Keypair
+}
+
+func NewFileDACProvider(params FileDACProviderParams) (*FileDACProvider, error) {
+	if params.DacCertPath == "" || params.DacKeyPath == "" || params.PaiCertPath == "" || params.CertificationDeclarationPath == "" {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	p := &FileDACProvider{}
+	var err error
+	if p.mDacCert, err = loadCertificate(params.DacCertPath); err != nil {
+		return nil, err
+	}
+	if p.mPaiCert, err = loadCertificate(params.PaiCertPath); err != nil {
+		return nil, err
+	}
+	if p.mDacKeypair, err = loadKeypair(params.DacKeyPath); err != nil {
+		return nil, err
+	}
+	if p.mCertificationDeclaration, err = os.ReadFile(params.CertificationDeclarationPath); err != nil {
+		return nil, err
+	}
+	if len(p.mCertificationDeclaration) == 0 || len(p.mCertificationDeclaration) > KCertificationDeclarationMaxSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if params.FirmwareInformationPath != "" {
+		if p.mFirmwareInformation, err = os.ReadFile(params.FirmwareInformationPath); err != nil {
+			return nil, err
+		}
+	}
+
+	dacPublicKey, err := extractPublicKeyFromX509Cert(p.mDacCert)
+	if err != nil {
+		return nil, err
+	}
+	if dacPublicKey != p.mDacKeypair.Pubkey() {
+		return nil, internal.ChipErrorInvalidPublicKey
+	}
+	return p, nil
+}
+
+func (p *FileDACProvider) GetCertificationDeclaration() ([]byte, error) {
+	return append([]byte(nil), p.mCertificationDeclaration...), nil
+}
+
+func (p *FileDACProvider) GetFirmwareInformation() ([]byte, error) {
+	return append([]byte(nil), p.mFirmwareInformation...), nil
+}
+
+func (p *FileDACProvider) GetDeviceAttestationCert() ([]byte, error) {
+	return append([]byte(nil), p.mDacCert...), nil
+}
+
+func (p *FileDACProvider) GetProductAttestationIntermediateCert() ([]byte, error) {
+	return append([]byte(nil), p.mPaiCert...), nil
+}
+
+func (p *FileDACProvider) SignWithDeviceAttestationKey(message []byte) (crypto.P256ECDSASignature, error) {
+	return p.mDacKeypair.ECDSASignMsg(message)
+}
+
+// loadCertificate 读取 DER 或者 PEM 格式的证书，返回 DER 编码
+func loadCertificate(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, internal.ChipErrorUnsupportedCertFormat
+		}
+		data = block.Bytes
+	}
+	if len(data) == 0 || len(data) > certs.KMaxDERCertLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if _, err = x509.ParseCertificate(data); err != nil {
+		return nil, internal.ChipErrorUnsupportedCertFormat
+	}
+	return data, nil
+}
+
+// loadKeypair 读取 DER 或者 PEM 格式的 SEC1 或 PKCS#8 私钥
+func loadKeypair(path string) (*crypto.P256Keypair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	key, err := x509.ParseECPrivateKey(data)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(data)
+		if pkcs8Err != nil {
+			return nil, internal.ChipErrorInvalidArgument
+		}
+		var ok bool
+		if key, ok = parsed.(*ecdsa.PrivateKey); !ok {
+			return nil, internal.ChipErrorUnsupportedEllipticCurve
+		}
+	}
+	return keypairFromECDSA(key)
+}
+
+func extractPublicKeyFromX509Cert(der []byte) (crypto.P256PublicKey, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return crypto.P256PublicKey{}, internal.ChipErrorUnsupportedCertFormat
+	}
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return crypto.P256PublicKey{}, internal.ChipErrorUnsupportedEllipticCurve
+	}
+	return crypto.NewP256PublicKey(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+}
@@ -1,12 +1,14 @@
 package credentials
 
 import (
+	"encoding/binary"
 	"github.com/galenliu/chip/crypto"
 	"github.com/galenliu/chip/device"
+	"github.com/galenliu/chip/internal"
 	"github.com/galenliu/chip/lib"
 )
 
-type FabricIndex uint8
+type FabricIndex = lib.FabricIndex
 
 type FabricInfoProvider interface {
 	GetFabricLabel() string
@@ -29,6 +31,11 @@ type FabricInfoProvider interface {
 	HasOperationalKey() bool
 }
 
+// KFabricLabelMaxLengthInBytes Fabric 标签的最大长度
+const KFabricLabelMaxLengthInBytes = 32
+
+var kCompressedFabricInfo = []byte("CompressedFabric")
+
 type FabricInfo struct {
 	mFabricLabel         string
 	mRootPublicKey       crypto.P256PublicKey
@@ -37,26 +44,54 @@ type FabricInfo struct {
 	mFabricIndex         FabricIndex
 	mCompressedFabriceId lib.CompressedFabricId
 	mVendorId            lib.VendorId
+
+	// mOperationalKey 不使用运行秘钥库时Fabric自己持有的运行秘钥
+	mOperationalKey                   *crypto.P256Keypair
+	mHasExternallyOwnedOperationalKey bool
 }
 
 func (info *FabricInfo) GetFabricLabel() string {
-	//TODO implement me
-	panic("implement me")
+	return info.mFabricLabel
 }
 
 func (info *FabricInfo) SetFabricLabel(label string) {
-	//TODO implement me
-	panic("implement me")
+	info.mFabricLabel = label
+}
+
+// Init 使用初始化参数设置Fabric的身份
+func (info *FabricInfo) Init(params *FabricInfoInitParams) error {
+	if params.FabricIndex == lib.KUndefinedFabricIndex || !params.NodeId.IsOperationalNodeId() {
+		return internal.ChipErrorInvalidArgument
+	}
+	info.mNodeId = params.NodeId
+	info.mFabricId = params.FabriceId
+	info.mFabricIndex = params.FabricIndex
+	info.mCompressedFabriceId = params.CompressedFabricId
+	info.mRootPublicKey = params.RootPublicKey
+	info.mVendorId = lib.VendorId(params.VendorId)
+	info.mOperationalKey = params.OperationalKeypair
+	info.mHasExternallyOwnedOperationalKey = params.HasExternallyOwnedKeypair
+	return nil
+}
+
+func (info *FabricInfo) Reset() {
+	*info = FabricInfo{}
+}
+
+func (info *FabricInfo) GetRootPubkey() crypto.P256PublicKey {
+	return info.mRootPublicKey
+}
+
+func (info *FabricInfo) GetNodeId() lib.NodeId {
+	return info.mNodeId
 }
 
 func (info *FabricInfo) GetScopedNodeId() lib.ScopedNodeId {
-	//TODO implement me
-	panic("implement me")
+	return lib.NewScopedNodeId(info.mNodeId, info.mFabricIndex)
 }
 
 func (info *FabricInfo) GetScopedNodeIdForNode(node lib.NodeId) lib.ScopedNodeId {
-	//TODO implement me
-	panic("implement me")
+	return lib.NewScopedNodeId(node, info.mFabricIndex)
 }
 
 func (info *FabricInfo) GetPeerIdForNode(id lib.NodeId) device.PeerId {
@@ -80,13 +115,20 @@ func (info *FabricInfo) GetVendorId() lib.VendorId {
 }
 
 func (info *FabricInfo) IsInitialized() bool {
-	//TODO implement me
-	panic("implement me")
+	return info.mFabricIndex != lib.KUndefinedFabricIndex && info.mNodeId.IsOperationalNodeId()
 }
 
+// HasOperationalKey Fabric 是否持有自己的运行秘钥，否则使用运行秘钥库签名
 func (info *FabricInfo) HasOperationalKey() bool {
-	//TODO implement me
-	panic("implement me")
+	return info.mOperationalKey != nil
+}
+
+// SignWithOpKeypair 使用Fabric持有的运行秘钥签名
+func (info *FabricInfo) SignWithOpKeypair(message []byte) (crypto.P256ECDSASignature, error) {
+	if info.mOperationalKey == nil {
+		return crypto.P256ECDSASignature{}, internal.ChipErrorKeyNotFound
+	}
+	return info.mOperationalKey.ECDSASignMsg(message)
 }
 
 func (info *FabricInfo) GetPeerId() device.PeerId {
@@ -100,6 +142,17 @@ type FabricInfoInitParams struct {
 	CompressedFabricId        lib.CompressedFabricId
 	RootPublicKey             crypto.P256PublicKey
 	VendorId                  uint16
-	OperationalKeypair        crypto.P256Keypair
+	OperationalKeypair        *crypto.P256Keypair
 	HasExternallyOwnedKeypair bool
 }
+
+// GenerateCompressedFabricId 压缩FabricID = HKDF(根公钥去掉 0x04 前缀, FabricID 大端, "CompressedFabric")
+func GenerateCompressedFabricId(rootPublicKey crypto.P256PublicKey, fabricId lib.FabricId) (lib.CompressedFabricId, error) {
+	var salt [8]byte
+	binary.BigEndian.PutUint64(salt[:], uint64(fabricId))
+	out, err := crypto.HKDFSHA256(rootPublicKey[1:], salt[:], kCompressedFabricInfo, len(salt))
+	if err != nil {
+		return 0, err
+	}
+	return lib.CompressedFabricId(binary.BigEndian.Uint64(out)), nil
+}
@@ -1,24 +1,43 @@
 package credentials
 
 import (
+	"github.com/galenliu/chip/credentials/certs"
 	"github.com/galenliu/chip/crypto"
 	storage2 "github.com/galenliu/chip/crypto/persistent_storage"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
 	"github.com/galenliu/chip/storage"
+	log "github.com/sirupsen/logrus"
+	"sync"
 	"time"
 )
 
 type FabricTableInitParams struct {
-	Storage             storage.StorageDelegate
+	Storage             storage.PersistentStorageDelegate
 	OperationalKeystore storage2.PersistentStorageOperationalKeystore
 	OpCertStore         PersistentStorageOpCertStore
+	// FirmwareBuildTime 最后已知的正确时间的下限，零值表示 Matter 纪元
+	FirmwareBuildTime time.Time
+	// CertificateValidityPolicy 验证对端证书链时使用的有效期策略，为 nil 时使用默认策略
+	CertificateValidityPolicy CertificateValidityPolicy
 }
 
+// FabricTableDelegate 监听 FabricTable 的变化，回调时不持有 FabricTable 的锁
 type FabricTableDelegate interface {
+	// FabricWillBeRemoved Fabric 即将被删除，此时仍然可以读取它的数据
+	FabricWillBeRemoved(fabricTable *FabricTable, fabricIndex FabricIndex)
+	// OnFabricRemoved Fabric 已经被删除，需要清理其它 Fabric 范围的数据
+	OnFabricRemoved(fabricTable *FabricTable, fabricIndex FabricIndex)
+	// OnFabricCommitted 新增或者更新的 Fabric 已经提交
+	OnFabricCommitted(fabricTable *FabricTable, fabricIndex FabricIndex)
+	// OnFabricUpdated 新增或者更新了待提交的 Fabric
+	OnFabricUpdated(fabricTable *FabricTable, fabricIndex FabricIndex)
 }
 
 type FabricTableProvider interface {
-	Init(FabricTableInitParams) error
-	Delete(index FabricIndex)
+	Init(params *FabricTableInitParams) error
+	Delete(index FabricIndex) error
 	DeleteAllFabrics() error
 	GetDeletedFabricFromCommitMarker() FabricIndex
 	ClearCommitMarker()
@@ -35,40 +54,1046 @@ type FabricTableProvider interface {
 	FetchPendingNonFabricAssociatedRootCert() ([]byte, error)
 	FetchICACert(index FabricIndex) ([]byte, error)
 	FetchNOCCert(index FabricIndex) ([]byte, error)
-	FetchRootPubkey(index FabricIndex) ([]byte, error)
-	FetchCATs(index FabricIndex) ([]byte, error)
+	FetchRootPubkey(index FabricIndex) (crypto.P256PublicKey, error)
+	FetchCATs(index FabricIndex) (lib.CATValues, error)
 
-	SignWithOpKeypair(FabricIndex) crypto.P256ECDSASignature
+	SignWithOpKeypair(fabricIndex FabricIndex, message []byte) (crypto.P256ECDSASignature, error)
+
+	AddNewPendingTrustedRootCert(rcac []byte) error
+	AddNewPendingFabricWithOperationalKeystore(noc, icac []byte, vendorId lib.VendorId) (FabricIndex, error)
+	AddNewPendingFabricWithProvidedOpKey(noc, icac []byte, vendorId lib.VendorId, opKeypair *crypto.P256Keypair, isExistingOpKeyExternallyOwned bool) (FabricIndex, error)
+	UpdatePendingFabricWithOperationalKeystore(fabricIndex FabricIndex, noc, icac []byte) error
+	UpdatePendingFabricWithProvidedOpKey(fabricIndex FabricIndex, noc, icac []byte, opKeypair *crypto.P256Keypair, isExistingOpKeyExternallyOwned bool) error
+	CommitPendingFabricData() error
+	RevertPendingFabricData()
+	RevertPendingOpCertsExceptRoot()
 }
 
+var _ FabricTableProvider = (*FabricTable)(nil)
+
+type fabricIndexInfo struct {
+	// NextAvailableFabricIndex 为 KUndefinedFabricIndex 时表示没有可用的 FabricIndex
+	NextAvailableFabricIndex uint8    `tlv:"1"`
+	FabricIndices            []uint16 `tlv:"2"`
+}
+
+type fabricMetadata struct {
+	VendorId    uint16 `tlv:"0"`
+	FabricLabel string `tlv:"1"`
+}
+
+type fabricTableCommitMarker struct {
+	FabricIndex uint8 `tlv:"1"`
+	IsAddition  bool  `tlv:"2"`
+}
+
+// FabricTable 保存设备加入的所有 Fabric。
+// 新增和更新 Fabric 先进入待提交状态，CommitPendingFabricData 时写入存储，
+// 提交过程中保存提交标记，启动时发现标记说明上次提交没有完成，删除对应的 Fabric
 type FabricTable struct {
-	mState []FabricInfo
+	mMutex               sync.RWMutex
+	mStates              []FabricInfo
+	mStorage             storage.PersistentStorageDelegate
+	mOperationalKeystore storage2.PersistentStorageOperationalKeystore
+	mOpCertStore         PersistentStorageOpCertStore
+	mValidityPolicy      CertificateValidityPolicy
+	mLastKnownGoodTime   *LastKnownGoodTime
+	mDelegates           []FabricTableDelegate
+
+	// mPendingFabric 更新中的 Fabric，提交后替换 mStates 中的数据
+	mPendingFabric               FabricInfo
+	mFabricIndexWithPendingState FabricIndex
+	mIsTrustedRootPending        bool
+	mIsAddPending                bool
+	mIsUpdatePending             bool
+
+	mNextAvailableFabricIndex   FabricIndex
+	mDeletedFabricIndexFromInit FabricIndex
 }
 
 func NewFabricTable() *FabricTable {
-	return &FabricTable{}
+	return &FabricTable{mLastKnownGoodTime: NewLastKnownGoodTime(), mNextAvailableFabricIndex: lib.KMinValidFabricIndex}
 }
 
-func (f FabricTable) FabricCount() int {
-	return len(f.mState)
+func NewFabricTableInitParams() *FabricTableInitParams {
+	return &FabricTableInitParams{}
 }
 
-func (f FabricTable) Init(params *FabricTableInitParams) (err error) {
-	return
+// Init 从存储中加载已提交的 Fabric，上次提交没有完成时删除提交中的 Fabric
+func (f *FabricTable) Init(params *FabricTableInitParams) error {
+	if params == nil || params.Storage == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	f.mMutex.Lock()
+	f.mStorage = params.Storage
+	f.mOperationalKeystore = params.OperationalKeystore
+	f.mOpCertStore = params.OpCertStore
+	f.mValidityPolicy = params.CertificateValidityPolicy
+	f.mStates = nil
+	f.resetPendingStateLocked()
+	f.mNextAvailableFabricIndex = lib.KMinValidFabricIndex
+	f.mDeletedFabricIndexFromInit = lib.KUndefinedFabricIndex
+	if err := f.mLastKnownGoodTime.Init(params.Storage, params.FirmwareBuildTime); err != nil {
+		f.mMutex.Unlock()
+		return err
+	}
+	if err := f.loadFabricsLocked(); err != nil {
+		f.mMutex.Unlock()
+		return err
+	}
+	var marker fabricTableCommitMarker
+	err := f.readLocked(storage.FabricTableCommitMarkerKey(), &marker)
+	f.mMutex.Unlock()
+	if err == internal.ChipErrorPersistedStorageValueNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fabricIndex := FabricIndex(marker.FabricIndex)
+	log.Warnf("FabricTable: found commit marker for fabric index %d (addition: %v), removing incomplete fabric data", fabricIndex, marker.IsAddition)
+	if err = f.Delete(fabricIndex); err != nil && err != internal.ChipErrorNotFound {
+		log.Errorf("FabricTable: failed to remove fabric %d from commit marker: %v", fabricIndex, err)
+	}
+	f.mDeletedFabricIndexFromInit = fabricIndex
+	f.ClearCommitMarker()
+	return nil
 }
 
-func (f FabricTable) GetFabricInfos() []FabricInfo {
-	return f.mState
+func (f *FabricTable) loadFabricsLocked() error {
+	var indexInfo fabricIndexInfo
+	err := f.readLocked(storage.FabricIndexInfo(), &indexInfo)
+	if err == internal.ChipErrorPersistedStorageValueNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.mNextAvailableFabricIndex = FabricIndex(indexInfo.NextAvailableFabricIndex)
+	for _, index := range indexInfo.FabricIndices {
+		fabricIndex := FabricIndex(index)
+		var info FabricInfo
+		if err = f.loadFabricLocked(fabricIndex, &info); err != nil {
+			log.Errorf("FabricTable: failed to load fabric %d: %v", fabricIndex, err)
+			continue
+		}
+		f.mStates = append(f.mStates, info)
+	}
+	return nil
 }
 
-func (f FabricTable) DeleteAllFabrics() {
+// loadFabricLocked 由保存的元数据和证书恢复 Fabric 的身份
+func (f *FabricTable) loadFabricLocked(fabricIndex FabricIndex, info *FabricInfo) error {
+	if f.mOpCertStore == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	var metadata fabricMetadata
+	if err := f.readLocked(storage.FabricMetadata(uint8(fabricIndex)), &metadata); err != nil {
+		return err
+	}
+	noc := f.mOpCertStore.GetCertificate(fabricIndex, CertChainElementNoc)
+	rcac := f.mOpCertStore.GetCertificate(fabricIndex, CertChainElementRcac)
+	if len(noc) == 0 || len(rcac) == 0 {
+		return internal.ChipErrorNotFound
+	}
+	nodeId, fabricId, err := certs.ExtractNodeIdFabricIdFromOpCertBytes(noc)
+	if err != nil {
+		return err
+	}
+	rootPubkey, err := certs.ExtractPublicKeyFromChipCert(rcac)
+	if err != nil {
+		return err
+	}
+	compressedFabricId, err := GenerateCompressedFabricId(rootPubkey, fabricId)
+	if err != nil {
+		return err
+	}
+	err = info.Init(&FabricInfoInitParams{
+		NodeId:             nodeId,
+		FabriceId:          fabricId,
+		FabricIndex:        fabricIndex,
+		CompressedFabricId: compressedFabricId,
+		RootPublicKey:      rootPubkey,
+		VendorId:           metadata.VendorId,
+	})
+	if err != nil {
+		return err
+	}
+	info.SetFabricLabel(metadata.FabricLabel)
+	return nil
+}
 
+func (f *FabricTable) FabricCount() uint8 {
+	f.mMutex.RLock()
+	defer f.mMutex.RUnlock()
+	return uint8(len(f.mStates))
 }
 
-func (f FabricTable) AddFabricDelegate(delegate ServerFabricDelegate) {
+// GetFabricInfos 所有的 Fabric，更新中的 Fabric 使用待提交的数据
+func (f *FabricTable) GetFabricInfos() []FabricInfo {
+	f.mMutex.RLock()
+	defer f.mMutex.RUnlock()
+	infos := make([]FabricInfo, len(f.mStates))
+	copy(infos, f.mStates)
+	if f.mIsUpdatePending {
+		for i := range infos {
+			if infos[i].GetFabricIndex() == f.mFabricIndexWithPendingState {
+				infos[i] = f.mPendingFabric
+			}
+		}
+	}
+	return infos
+}
 
+// FindFabricWithIndex 查找 FabricIndex 对应的Fabric，不存在时返回 nil
+func (f *FabricTable) FindFabricWithIndex(fabricIndex FabricIndex) *FabricInfo {
+	f.mMutex.RLock()
+	defer f.mMutex.RUnlock()
+	return f.findFabricWithIndexLocked(fabricIndex)
 }
 
-func NewFabricTableInitParams() *FabricTableInitParams {
-	return &FabricTableInitParams{}
+// FindFabric 查找根公钥和 FabricId 相同的 Fabric
+func (f *FabricTable) FindFabric(rootPubkey crypto.P256PublicKey, fabricId lib.FabricId) *FabricInfo {
+	f.mMutex.RLock()
+	defer f.mMutex.RUnlock()
+	return f.findFabricLocked(rootPubkey, fabricId)
+}
+
+// FindFabricWithCompressedId 查找压缩FabricID对应的Fabric
+func (f *FabricTable) FindFabricWithCompressedId(compressedFabricId lib.CompressedFabricId) *FabricInfo {
+	f.mMutex.RLock()
+	defer f.mMutex.RUnlock()
+	for i := range f.mStates {
+		if info := f.fabricLocked(i); info.GetCompressedFabricId() == compressedFabricId {
+			return info
+		}
+	}
+	return nil
+}
+
+func (f *FabricTable) findFabricWithIndexLocked(fabricIndex FabricIndex) *FabricInfo {
+	for i := range f.mStates {
+		if f.mStates[i].GetFabricIndex() == fabricIndex {
+			return f.fabricLocked(i)
+		}
+	}
+	return nil
+}
+
+func (f *FabricTable) findFabricLocked(rootPubkey crypto.P256PublicKey, fabricId lib.FabricId) *FabricInfo {
+	for i := range f.mStates {
+		if info := f.fabricLocked(i); info.GetFabricId() == fabricId && info.GetRootPubkey() == rootPubkey {
+			return info
+		}
+	}
+	return nil
+}
+
+func (f *FabricTable) fabricLocked(i int) *FabricInfo {
+	if f.mIsUpdatePending && f.mStates[i].GetFabricIndex() == f.mFabricIndexWithPendingState {
+		return &f.mPendingFabric
+	}
+	return &f.mStates[i]
+}
+
+func (f *FabricTable) AddFabricDelegate(delegate FabricTableDelegate) error {
+	if delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	for _, d := range f.mDelegates {
+		if d == delegate {
+			return nil
+		}
+	}
+	f.mDelegates = append(f.mDelegates, delegate)
+	return nil
+}
+
+func (f *FabricTable) RemoveFabricDelegate(delegate FabricTableDelegate) {
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	for i, d := range f.mDelegates {
+		if d == delegate {
+			f.mDelegates = append(f.mDelegates[:i], f.mDelegates[i+1:]...)
+			return
+		}
+	}
+}
+
+func (f *FabricTable) notifyDelegates(notify func(delegate FabricTableDelegate)) {
+	f.mMutex.RLock()
+	delegates := make([]FabricTableDelegate, len(f.mDelegates))
+	copy(delegates, f.mDelegates)
+	f.mMutex.RUnlock()
+	for _, delegate := range delegates {
+		notify(delegate)
+	}
+}
+
+// PeekFabricIndexForNextAddition 下一个新增的 Fabric 将使用的 FabricIndex，用于提前生成运行秘钥对
+func (f *FabricTable) PeekFabricIndexForNextAddition() (FabricIndex, error) {
+	f.mMutex.RLock()
+	defer f.mMutex.RUnlock()
+	if f.mIsAddPending || f.mIsTrustedRootPending {
+		return f.mFabricIndexWithPendingState, nil
+	}
+	if f.mNextAvailableFabricIndex == lib.KUndefinedFabricIndex {
+		return lib.KUndefinedFabricIndex, internal.ChipErrorNoMemory
+	}
+	return f.mNextAvailableFabricIndex, nil
+}
+
+// AddNewPendingTrustedRootCert 为下一个新增的 Fabric 保存待提交的根证书
+func (f *FabricTable) AddNewPendingTrustedRootCert(rcac []byte) error {
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	if f.mOpCertStore == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if f.mIsTrustedRootPending || f.mIsAddPending || f.mIsUpdatePending {
+		return internal.ChipErrorIncorrectState
+	}
+	if f.mNextAvailableFabricIndex == lib.KUndefinedFabricIndex {
+		return internal.ChipErrorNoMemory
+	}
+	if err := certs.ValidateChipRCAC(rcac); err != nil {
+		return err
+	}
+	if err := f.mOpCertStore.AddNewTrustedRootCertForFabric(f.mNextAvailableFabricIndex, rcac); err != nil {
+		return err
+	}
+	f.mFabricIndexWithPendingState = f.mNextAvailableFabricIndex
+	f.mIsTrustedRootPending = true
+	return nil
+}
+
+// AddNewPendingFabricWithOperationalKeystore 使用运行秘钥库中待提交的秘钥对新增 Fabric
+func (f *FabricTable) AddNewPendingFabricWithOperationalKeystore(noc, icac []byte, vendorId lib.VendorId) (FabricIndex, error) {
+	return f.addNewPendingFabric(noc, icac, vendorId, nil, false)
+}
+
+// AddNewPendingFabricWithProvidedOpKey 使用调用者提供的运行秘钥新增 Fabric，
+// isExistingOpKeyExternallyOwned 表示秘钥的生命周期由调用者管理
+func (f *FabricTable) AddNewPendingFabricWithProvidedOpKey(noc, icac []byte, vendorId lib.VendorId, opKeypair *crypto.P256Keypair,
+	isExistingOpKeyExternallyOwned bool) (FabricIndex, error) {
+	if opKeypair == nil {
+		return lib.KUndefinedFabricIndex, internal.ChipErrorInvalidArgument
+	}
+	return f.addNewPendingFabric(noc, icac, vendorId, opKeypair, isExistingOpKeyExternallyOwned)
+}
+
+func (f *FabricTable) addNewPendingFabric(noc, icac []byte, vendorId lib.VendorId, opKeypair *crypto.P256Keypair,
+	isExistingOpKeyExternallyOwned bool) (FabricIndex, error) {
+	f.mMutex.Lock()
+	if !f.mIsTrustedRootPending || f.mIsAddPending || f.mIsUpdatePending {
+		f.mMutex.Unlock()
+		return lib.KUndefinedFabricIndex, internal.ChipErrorIncorrectState
+	}
+	fabricIndex := f.mFabricIndexWithPendingState
+	info, err := f.stagePendingFabricLocked(fabricIndex, noc, icac, opKeypair, isExistingOpKeyExternallyOwned, lib.KUndefinedFabricId)
+	if err != nil {
+		f.mMutex.Unlock()
+		return lib.KUndefinedFabricIndex, err
+	}
+	if err = f.mOpCertStore.AddNewOpCertsForFabric(fabricIndex, noc, icac); err != nil {
+		f.mMutex.Unlock()
+		return lib.KUndefinedFabricIndex, err
+	}
+	info.mVendorId = vendorId
+	f.mStates = append(f.mStates, info)
+	f.mIsAddPending = true
+	f.mMutex.Unlock()
+
+	log.Infof("FabricTable: added pending fabric %d, fabric id 0x%016X node id 0x%016X", fabricIndex, info.GetFabricId(), info.GetNodeId())
+	f.notifyDelegates(func(delegate FabricTableDelegate) {
+		delegate.OnFabricUpdated(f, fabricIndex)
+	})
+	return fabricIndex, nil
+}
+
+// UpdatePendingFabricWithOperationalKeystore 使用运行秘钥库中待提交的秘钥对更新 Fabric 的 NOC 和 ICAC
+func (f *FabricTable) UpdatePendingFabricWithOperationalKeystore(fabricIndex FabricIndex, noc, icac []byte) error {
+	return f.updatePendingFabric(fabricIndex, noc, icac, nil, false)
+}
+
+// UpdatePendingFabricWithProvidedOpKey 使用调用者提供的运行秘钥更新 Fabric 的 NOC 和 ICAC
+func (f *FabricTable) UpdatePendingFabricWithProvidedOpKey(fabricIndex FabricIndex, noc, icac []byte, opKeypair *crypto.P256Keypair,
+	isExistingOpKeyExternallyOwned bool) error {
+	if opKeypair == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	return f.updatePendingFabric(fabricIndex, noc, icac, opKeypair, isExistingOpKeyExternallyOwned)
+}
+
+func (f *FabricTable) updatePendingFabric(fabricIndex FabricIndex, noc, icac []byte, opKeypair *crypto.P256Keypair,
+	isExistingOpKeyExternallyOwned bool) error {
+	f.mMutex.Lock()
+	if f.mIsTrustedRootPending || f.mIsAddPending || f.mIsUpdatePending {
+		f.mMutex.Unlock()
+		return internal.ChipErrorIncorrectState
+	}
+	existing := f.findFabricWithIndexLocked(fabricIndex)
+	if existing == nil {
+		f.mMutex.Unlock()
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	info, err := f.stagePendingFabricLocked(fabricIndex, noc, icac, opKeypair, isExistingOpKeyExternallyOwned, existing.GetFabricId())
+	if err != nil {
+		f.mMutex.Unlock()
+		return err
+	}
+	if err = f.mOpCertStore.UpdateOpCertsForFabric(fabricIndex, noc, icac); err != nil {
+		f.mMutex.Unlock()
+		return err
+	}
+	info.mVendorId = existing.GetVendorId()
+	info.SetFabricLabel(existing.GetFabricLabel())
+	f.mPendingFabric = info
+	f.mFabricIndexWithPendingState = fabricIndex
+	f.mIsUpdatePending = true
+	f.mMutex.Unlock()
+
+	log.Infof("FabricTable: updated pending fabric %d, node id 0x%016X", fabricIndex, info.GetNodeId())
+	f.notifyDelegates(func(delegate FabricTableDelegate) {
+		delegate.OnFabricUpdated(f, fabricIndex)
+	})
+	return nil
+}
+
+// stagePendingFabricLocked 验证新的证书链并激活运行秘钥，返回待提交的 Fabric。
+// existingFabricId 不为 KUndefinedFabricId 时是更新，NOC 的 FabricId 不能改变
+func (f *FabricTable) stagePendingFabricLocked(fabricIndex FabricIndex, noc, icac []byte, opKeypair *crypto.P256Keypair,
+	isExistingOpKeyExternallyOwned bool, existingFabricId lib.FabricId) (FabricInfo, error) {
+	var info FabricInfo
+	if f.mOpCertStore == nil {
+		return info, internal.ChipErrorIncorrectState
+	}
+	if opKeypair == nil && (f.mOperationalKeystore == nil || !f.mOperationalKeystore.HasPendingOpKeypair()) {
+		return info, internal.ChipErrorKeyNotFound
+	}
+	rcac := f.mOpCertStore.GetCertificate(fabricIndex, CertChainElementRcac)
+	nodeId, fabricId, nocPubkey, rootPubkey, err := f.verifyCredentials(noc, icac, rcac, nil)
+	if err != nil {
+		return info, err
+	}
+	if existingFabricId != lib.KUndefinedFabricId {
+		if fabricId != existingFabricId {
+			return info, internal.ChipErrorInvalidArgument
+		}
+	} else if f.findFabricLocked(rootPubkey, fabricId) != nil {
+		return info, internal.ChipErrorFabricExists
+	}
+
+	if opKeypair != nil {
+		if opKeypair.Pubkey() != nocPubkey {
+			return info, internal.ChipErrorInvalidPublicKey
+		}
+	} else if err = f.mOperationalKeystore.ActivateOpKeypairForFabric(fabricIndex, nocPubkey); err != nil {
+		return info, err
+	}
+
+	compressedFabricId, err := GenerateCompressedFabricId(rootPubkey, fabricId)
+	if err != nil {
+		return info, err
+	}
+	err = info.Init(&FabricInfoInitParams{
+		NodeId:                    nodeId,
+		FabriceId:                 fabricId,
+		FabricIndex:               fabricIndex,
+		CompressedFabricId:        compressedFabricId,
+		RootPublicKey:             rootPubkey,
+		OperationalKeypair:        opKeypair,
+		HasExternallyOwnedKeypair: isExistingOpKeyExternallyOwned,
+	})
+	if err != nil {
+		return info, err
+	}
+
+	// 证书已经生效，最后已知的正确时间至少是证书链中最晚的 notBefore
+	notBefore, err := latestNotBefore(rcac, icac, noc)
+	if err != nil {
+		return info, err
+	}
+	return info, f.mLastKnownGoodTime.UpdatePendingLastKnownGoodChipEpochTime(notBefore)
+}
+
+// CommitPendingFabricData 提交待提交的 Fabric，只有待提交的根证书时不能提交
+func (f *FabricTable) CommitPendingFabricData() error {
+	f.mMutex.Lock()
+	if !f.mIsAddPending && !f.mIsUpdatePending {
+		pendingRoot := f.mIsTrustedRootPending
+		f.mMutex.Unlock()
+		if pendingRoot {
+			return internal.ChipErrorIncorrectState
+		}
+		return nil
+	}
+	fabricIndex := f.mFabricIndexWithPendingState
+	isAddition := f.mIsAddPending
+	certsCommitted, err := f.commitPendingFabricDataLocked(fabricIndex, isAddition)
+	f.mMutex.Unlock()
+	if err != nil {
+		log.Errorf("FabricTable: failed to commit fabric %d: %v", fabricIndex, err)
+		f.RevertPendingFabricData()
+		if isAddition {
+			if deleteErr := f.Delete(fabricIndex); deleteErr != nil && deleteErr != internal.ChipErrorNotFound {
+				log.Errorf("FabricTable: failed to remove fabric %d after commit failure: %v", fabricIndex, deleteErr)
+			}
+		}
+		// 更新时证书已经写入而运行秘钥没有写入，存储中的数据不一致，删除这个 Fabric 使内存与存储一致，
+		// 删除失败时保留提交标记由 Init 删除
+		if !isAddition && certsCommitted {
+			log.Errorf("FabricTable: fabric %d is inconsistent in storage and will be removed", fabricIndex)
+			if deleteErr := f.Delete(fabricIndex); deleteErr != nil {
+				log.Errorf("FabricTable: failed to remove fabric %d, it will be removed on next init: %v", fabricIndex, deleteErr)
+				return err
+			}
+		}
+		f.ClearCommitMarker()
+		return err
+	}
+
+	log.Infof("FabricTable: committed fabric %d", fabricIndex)
+	f.notifyDelegates(func(delegate FabricTableDelegate) {
+		delegate.OnFabricCommitted(f, fabricIndex)
+	})
+	return nil
+}
+
+// commitPendingFabricDataLocked 先写入 Fabric 的信息，最后提交证书和运行秘钥，certsCommitted 表示失败前证书已经写入存储
+func (f *FabricTable) commitPendingFabricDataLocked(fabricIndex FabricIndex, isAddition bool) (certsCommitted bool, err error) {
+	// 提交标记在所有数据写入之后才删除
+	marker := fabricTableCommitMarker{FabricIndex: uint8(fabricIndex), IsAddition: isAddition}
+	if err = f.writeLocked(storage.FabricTableCommitMarkerKey(), &marker); err != nil {
+		return false, err
+	}
+	info := f.findFabricWithIndexLocked(fabricIndex)
+	if info == nil {
+		return false, internal.ChipErrorIncorrectState
+	}
+	if err = f.storeFabricMetadataLocked(info); err != nil {
+		return false, err
+	}
+	if err = f.mLastKnownGoodTime.CommitPendingLastKnownGoodChipEpochTime(); err != nil {
+		return false, err
+	}
+	next := f.mNextAvailableFabricIndex
+	if isAddition {
+		next = f.nextAvailableFabricIndexLocked(fabricIndex)
+		if err = f.storeFabricIndexInfoLocked(next); err != nil {
+			return false, err
+		}
+	}
+	if err = f.mOpCertStore.CommitOpCertsForFabric(fabricIndex); err != nil {
+		return false, err
+	}
+	if f.mOperationalKeystore != nil && f.mOperationalKeystore.HasPendingOpKeypair() {
+		if err = f.mOperationalKeystore.CommitOpKeypairForFabric(fabricIndex); err != nil {
+			return true, err
+		}
+	}
+	if isAddition {
+		f.mNextAvailableFabricIndex = next
+	} else {
+		for i := range f.mStates {
+			if f.mStates[i].GetFabricIndex() == fabricIndex {
+				f.mStates[i] = f.mPendingFabric
+			}
+		}
+	}
+	f.resetPendingStateLocked()
+	if err := f.mStorage.SyncDeleteKeyValue(storage.FabricTableCommitMarkerKey()); err != nil {
+		log.Errorf("FabricTable: failed to clear commit marker: %v", err)
+	}
+	return true, nil
+}
+
+// RevertPendingFabricData 放弃所有待提交的根证书、NOC、运行秘钥和最后已知的正确时间
+func (f *FabricTable) RevertPendingFabricData() {
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	f.revertPendingOpCertsLocked()
+	if f.mOpCertStore != nil {
+		f.mOpCertStore.RevertPendingOpCerts()
+	}
+	f.resetPendingStateLocked()
+}
+
+// RevertPendingOpCertsExceptRoot 放弃待提交的 NOC 和运行秘钥，保留待提交的根证书
+func (f *FabricTable) RevertPendingOpCertsExceptRoot() {
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	f.revertPendingOpCertsLocked()
+	if f.mOpCertStore != nil {
+		f.mOpCertStore.RevertPendingOpCertsExceptRoot()
+	}
+	f.mPendingFabric.Reset()
+	f.mIsAddPending = false
+	f.mIsUpdatePending = false
+	if !f.mIsTrustedRootPending {
+		f.mFabricIndexWithPendingState = lib.KUndefinedFabricIndex
+	}
+}
+
+func (f *FabricTable) revertPendingOpCertsLocked() {
+	if f.mIsAddPending {
+		f.removeFabricLocked(f.mFabricIndexWithPendingState)
+	}
+	if f.mOperationalKeystore != nil {
+		f.mOperationalKeystore.RevertPendingKeypair()
+	}
+	if err := f.mLastKnownGoodTime.RevertPendingLastKnownGoodChipEpochTime(); err != nil && err != internal.ChipErrorIncorrectState {
+		log.Errorf("FabricTable: failed to revert last known good time: %v", err)
+	}
+}
+
+func (f *FabricTable) resetPendingStateLocked() {
+	f.mPendingFabric.Reset()
+	f.mFabricIndexWithPendingState = lib.KUndefinedFabricIndex
+	f.mIsTrustedRootPending = false
+	f.mIsAddPending = false
+	f.mIsUpdatePending = false
+}
+
+// Delete 删除 Fabric 以及它的元数据、证书和运行秘钥，Fabric 不存在时仍然清理存储并返回 ChipErrorNotFound
+func (f *FabricTable) Delete(fabricIndex FabricIndex) error {
+	if !fabricIndex.IsValidFabricIndex() {
+		return internal.ChipErrorInvalidArgument
+	}
+	f.mMutex.RLock()
+	hasPendingState := f.mFabricIndexWithPendingState == fabricIndex
+	f.mMutex.RUnlock()
+	if hasPendingState {
+		f.RevertPendingFabricData()
+	}
+
+	f.mMutex.RLock()
+	info := f.findFabricWithIndexLocked(fabricIndex)
+	initialized := info != nil && info.IsInitialized()
+	f.mMutex.RUnlock()
+	if initialized {
+		f.notifyDelegates(func(delegate FabricTableDelegate) {
+			delegate.FabricWillBeRemoved(f, fabricIndex)
+		})
+	}
+
+	f.mMutex.Lock()
+	err := f.deleteFromStorageLocked(fabricIndex)
+	if initialized {
+		f.removeFabricLocked(fabricIndex)
+		if f.mNextAvailableFabricIndex == lib.KUndefinedFabricIndex {
+			f.mNextAvailableFabricIndex = fabricIndex
+		}
+		if indexErr := f.storeFabricIndexInfoLocked(f.mNextAvailableFabricIndex); err == nil {
+			err = indexErr
+		}
+	}
+	f.mMutex.Unlock()
+	if !initialized {
+		return internal.ChipErrorNotFound
+	}
+
+	log.Infof("FabricTable: deleted fabric %d", fabricIndex)
+	f.notifyDelegates(func(delegate FabricTableDelegate) {
+		delegate.OnFabricRemoved(f, fabricIndex)
+	})
+	return err
+}
+
+func (f *FabricTable) deleteFromStorageLocked(fabricIndex FabricIndex) error {
+	var firstErr error
+	check := func(err error) {
+		if err != nil && err != internal.ChipErrorPersistedStorageValueNotFound && err != internal.ChipErrorNotFound &&
+			err != internal.ChipErrorInvalidFabricIndex && firstErr == nil {
+			firstErr = err
+		}
+	}
+	key := storage.FabricMetadata(uint8(fabricIndex))
+	if f.mStorage.SyncDoesKeyExist(key) {
+		check(f.mStorage.SyncDeleteKeyValue(key))
+	}
+	if f.mOpCertStore != nil {
+		check(f.mOpCertStore.RemoveOpCertsForFabric(fabricIndex))
+	}
+	if f.mOperationalKeystore != nil {
+		check(f.mOperationalKeystore.RemoveOpKeypairForFabric(fabricIndex))
+	}
+	return firstErr
+}
+
+func (f *FabricTable) removeFabricLocked(fabricIndex FabricIndex) {
+	for i := range f.mStates {
+		if f.mStates[i].GetFabricIndex() == fabricIndex {
+			f.mStates = append(f.mStates[:i], f.mStates[i+1:]...)
+			return
+		}
+	}
+}
+
+// DeleteAllFabrics 放弃待提交的数据并删除所有的 Fabric
+func (f *FabricTable) DeleteAllFabrics() error {
+	f.RevertPendingFabricData()
+	var firstErr error
+	for _, info := range f.GetFabricInfos() {
+		if err := f.Delete(info.GetFabricIndex()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Forget 只从内存中移除 Fabric，不修改存储
+func (f *FabricTable) Forget(fabricIndex FabricIndex) {
+	f.RevertPendingFabricData()
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	log.Infof("FabricTable: forgetting fabric %d", fabricIndex)
+	f.removeFabricLocked(fabricIndex)
+}
+
+// GetDeletedFabricFromCommitMarker 返回 Init 时因为提交没有完成而删除的 Fabric，只返回一次
+func (f *FabricTable) GetDeletedFabricFromCommitMarker() FabricIndex {
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	fabricIndex := f.mDeletedFabricIndexFromInit
+	f.mDeletedFabricIndexFromInit = lib.KUndefinedFabricIndex
+	return fabricIndex
+}
+
+func (f *FabricTable) ClearCommitMarker() {
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	if f.mStorage == nil {
+		return
+	}
+	if err := f.mStorage.SyncDeleteKeyValue(storage.FabricTableCommitMarkerKey()); err != nil && err != internal.ChipErrorPersistedStorageValueNotFound {
+		log.Errorf("FabricTable: failed to clear commit marker: %v", err)
+	}
+}
+
+// SetFabricLabel 设置 Fabric 的标签，待新增的 Fabric 在提交时保存
+func (f *FabricTable) SetFabricLabel(fabricIndex FabricIndex, label string) error {
+	if len(label) > KFabricLabelMaxLengthInBytes {
+		return internal.ChipErrorInvalidArgument
+	}
+	f.mMutex.Lock()
+	defer f.mMutex.Unlock()
+	info := f.findFabricWithIndexLocked(fabricIndex)
+	if info == nil || !info.IsInitialized() {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	info.SetFabricLabel(label)
+	if f.mIsUpdatePending && f.mFabricIndexWithPendingState == fabricIndex {
+		// 提交前同时修改已提交的数据，撤销更新时保留新的标签
+		for i := range f.mStates {
+			if f.mStates[i].GetFabricIndex() == fabricIndex {
+				f.mStates[i].SetFabricLabel(label)
+			}
+		}
+	}
+	if f.mIsAddPending && f.mFabricIndexWithPendingState == fabricIndex {
+		return nil
+	}
+	return f.storeFabricMetadataLocked(info)
+}
+
+func (f *FabricTable) GetFabricLabel(fabricIndex FabricIndex) (string, error) {
+	f.mMutex.RLock()
+	defer f.mMutex.RUnlock()
+	info := f.findFabricWithIndexLocked(fabricIndex)
+	if info == nil {
+		return "", internal.ChipErrorInvalidFabricIndex
+	}
+	return info.GetFabricLabel(), nil
+}
+
+func (f *FabricTable) FetchRootCert(fabricIndex FabricIndex) ([]byte, error) {
+	return f.fetchCert(fabricIndex, CertChainElementRcac)
+}
+
+// FetchPendingNonFabricAssociatedRootCert 还没有关联到 Fabric（没有添加 NOC）的待提交根证书
+func (f *FabricTable) FetchPendingNonFabricAssociatedRootCert() ([]byte, error) {
+	f.mMutex.RLock()
+	pending := f.mIsTrustedRootPending && !f.mIsAddPending
+	fabricIndex := f.mFabricIndexWithPendingState
+	f.mMutex.RUnlock()
+	if !pending {
+		return nil, internal.ChipErrorNotFound
+	}
+	return f.fetchCert(fabricIndex, CertChainElementRcac)
+}
+
+// FetchICACert Fabric 没有 ICAC 时返回空的证书
+func (f *FabricTable) FetchICACert(fabricIndex FabricIndex) ([]byte, error) {
+	if f.mOpCertStore == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	if !f.mOpCertStore.HasCertificateForFabric(fabricIndex, CertChainElementNoc) {
+		return nil, internal.ChipErrorNotFound
+	}
+	return f.mOpCertStore.GetCertificate(fabricIndex, CertChainElementIcac), nil
+}
+
+func (f *FabricTable) FetchNOCCert(fabricIndex FabricIndex) ([]byte, error) {
+	return f.fetchCert(fabricIndex, CertChainElementNoc)
+}
+
+func (f *FabricTable) fetchCert(fabricIndex FabricIndex, element uint8) ([]byte, error) {
+	if f.mOpCertStore == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	cert := f.mOpCertStore.GetCertificate(fabricIndex, element)
+	if len(cert) == 0 {
+		return nil, internal.ChipErrorNotFound
+	}
+	return cert, nil
+}
+
+func (f *FabricTable) FetchRootPubkey(fabricIndex FabricIndex) (crypto.P256PublicKey, error) {
+	info := f.FindFabricWithIndex(fabricIndex)
+	if info == nil {
+		return crypto.P256PublicKey{}, internal.ChipErrorInvalidFabricIndex
+	}
+	return info.GetRootPubkey(), nil
+}
+
+// FetchCATs 获取 Fabric 的 NOC 中的 CAT
+func (f *FabricTable) FetchCATs(fabricIndex FabricIndex) (lib.CATValues, error) {
+	noc, err := f.FetchNOCCert(fabricIndex)
+	if err != nil {
+		return lib.CATValues{}, err
+	}
+	return certs.ExtractCATsFromOpCert(noc)
+}
+
+// AllocateEphemeralKeypairForCASE 分配 CASE 使用的临时秘钥对，有运行秘钥库时由秘钥库分配，使用完后调用 ReleaseEphemeralKeypair 归还
+func (f *FabricTable) AllocateEphemeralKeypairForCASE() (*crypto.P256Keypair, error) {
+	f.mMutex.RLock()
+	keystore := f.mOperationalKeystore
+	f.mMutex.RUnlock()
+	if keystore != nil {
+		keypair := keystore.AllocateEphemeralKeypairForCASE()
+		if keypair == nil {
+			return nil, internal.ChipErrorNoMemory
+		}
+		return keypair, nil
+	}
+	keypair := crypto.NewP256Keypair()
+	if err := keypair.Initialize(); err != nil {
+		return nil, err
+	}
+	return keypair, nil
+}
+
+func (f *FabricTable) ReleaseEphemeralKeypair(keypair *crypto.P256Keypair) {
+	f.mMutex.RLock()
+	keystore := f.mOperationalKeystore
+	f.mMutex.RUnlock()
+	if keystore != nil {
+		keystore.ReleaseEphemeralKeypair(keypair)
+	}
+}
+
+// SignWithOpKeypair 使用 Fabric 的运行秘钥签名，Fabric 没有自己的秘钥时使用运行秘钥库
+func (f *FabricTable) SignWithOpKeypair(fabricIndex FabricIndex, message []byte) (crypto.P256ECDSASignature, error) {
+	f.mMutex.RLock()
+	info := f.findFabricWithIndexLocked(fabricIndex)
+	keystore := f.mOperationalKeystore
+	f.mMutex.RUnlock()
+	if info == nil {
+		return crypto.P256ECDSASignature{}, internal.ChipErrorKeyNotFound
+	}
+	if info.HasOperationalKey() {
+		return info.SignWithOpKeypair(message)
+	}
+	if keystore == nil {
+		return crypto.P256ECDSASignature{}, internal.ChipErrorKeyNotFound
+	}
+	return keystore.SignWithOpKeypair(fabricIndex, message)
+}
+
+// VerifyCredentials 使用 Fabric 的根证书验证对端的 NOC、ICAC，返回 NOC 中的节点ID、FabricID 和公钥
+func (f *FabricTable) VerifyCredentials(fabricIndex FabricIndex, noc, icac []byte) (lib.NodeId, lib.FabricId, crypto.P256PublicKey, error) {
+	rcac, err := f.FetchRootCert(fabricIndex)
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, crypto.P256PublicKey{}, err
+	}
+	f.mMutex.RLock()
+	policy := f.mValidityPolicy
+	f.mMutex.RUnlock()
+	nodeId, fabricId, nocPubkey, _, err := f.verifyCredentials(noc, icac, rcac, policy)
+	return nodeId, fabricId, nocPubkey, err
+}
+
+// ExtractPeerCATs 获取对端 NOC 中的 CAT
+func (f *FabricTable) ExtractPeerCATs(noc []byte) (lib.CATValues, error) {
+	return certs.ExtractCATsFromOpCert(noc)
+}
+
+// verifyCredentials 验证 NOC 证书链，ICAC 和 RCAC 包含 FabricId 时必须与 NOC 的相同
+func (f *FabricTable) verifyCredentials(noc, icac, rcac []byte, policy CertificateValidityPolicy) (lib.NodeId, lib.FabricId,
+	crypto.P256PublicKey, crypto.P256PublicKey, error) {
+	var nocPubkey, rootPubkey crypto.P256PublicKey
+	if len(noc) == 0 || len(rcac) == 0 {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, internal.ChipErrorInvalidArgument
+	}
+	certSet := certs.NewChipCertificateSet()
+	rcacData, err := certSet.LoadCert(rcac, certs.CertDecodeFlagIsTrustAnchor)
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, err
+	}
+	certChain := []*certs.ChipCertificateData{rcacData}
+	if len(icac) != 0 {
+		icacData, err := certSet.LoadCert(icac, 0)
+		if err != nil {
+			return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, err
+		}
+		certChain = append(certChain, icacData)
+	}
+	nocData, err := certSet.LoadCert(noc, 0)
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, err
+	}
+
+	context := certs.ValidationContext{
+		RequiredKeyUsages:   certs.KeyUsageDigitalSignature,
+		RequiredKeyPurposes: certs.KeyPurposeClientAuth.Flag() | certs.KeyPurposeServerAuth.Flag(),
+		RequiredCertType:    certs.CertTypeNode,
+		ValidityPolicy:      policy,
+	}
+	if err = f.SetValidationEffectiveTime(&context); err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, err
+	}
+	if err = certSet.ValidateCert(nocData, &context); err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, err
+	}
+
+	nodeId, fabricId, err := certs.ExtractNodeIdFabricIdFromOpCert(nocData)
+	if err != nil {
+		return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, err
+	}
+	for _, cert := range certChain {
+		certFabricId, err := certs.ExtractFabricIdFromCert(cert)
+		if err == internal.ChipErrorNotFound {
+			continue
+		}
+		if err != nil {
+			return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, err
+		}
+		if certFabricId != fabricId {
+			return lib.KUndefinedNodeId, lib.KUndefinedFabricId, nocPubkey, rootPubkey, internal.ChipErrorFabricMismatchOnICA
+		}
+	}
+	return nodeId, fabricId, nocData.PublicKey, context.TrustAnchor.PublicKey, nil
+}
+
+func (f *FabricTable) GetLastKnownGoodChipEpochTime() (time.Time, error) {
+	return f.mLastKnownGoodTime.GetLastKnownGoodChipEpochTime()
+}
+
+// SetLastKnownGoodChipEpochTime 设置最后已知的正确时间，不能早于任何 Fabric 证书的 notBefore
+func (f *FabricTable) SetLastKnownGoodChipEpochTime(lastKnownGoodTime time.Time) error {
+	var notBeforeCutoff time.Time
+	for _, fabric := range f.GetFabricInfos() {
+		var chain [][]byte
+		for _, fetch := range []func(FabricIndex) ([]byte, error){f.FetchRootCert, f.FetchICACert, f.FetchNOCCert} {
+			cert, err := fetch(fabric.GetFabricIndex())
+			if err != nil {
+				return err
+			}
+			chain = append(chain, cert)
+		}
+		notBefore, err := latestNotBefore(chain...)
+		if err != nil {
+			return err
+		}
+		if notBefore.After(notBeforeCutoff) {
+			notBeforeCutoff = notBefore
+		}
+	}
+	return f.mLastKnownGoodTime.SetLastKnownGoodChipEpochTime(lastKnownGoodTime, notBeforeCutoff)
+}
+
+// SetValidationEffectiveTime 设置检查证书有效期的时间，
+// 系统时间早于最后已知的正确时间说明系统时钟不可信，此时使用最后已知的正确时间
+func (f *FabricTable) SetValidationEffectiveTime(context *certs.ValidationContext) error {
+	lastKnownGoodTime, err := f.mLastKnownGoodTime.GetLastKnownGoodChipEpochTime()
+	if err != nil {
+		return err
+	}
+	if now := time.Now(); !now.Before(lastKnownGoodTime) {
+		context.SetEffectiveTime(now)
+	} else {
+		context.SetEffectiveTimeFromLastKnownGoodTime(lastKnownGoodTime)
+	}
+	return nil
+}
+
+// latestNotBefore 证书中最晚的 notBefore，忽略空的证书
+func latestNotBefore(chain ...[]byte) (time.Time, error) {
+	var latest time.Time
+	for _, cert := range chain {
+		if len(cert) == 0 {
+			continue
+		}
+		data, err := certs.DecodeChipCert(cert)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if notBefore := certs.ChipEpochToTime(data.NotBeforeTime); notBefore.After(latest) {
+			latest = notBefore
+		}
+	}
+	return latest, nil
+}
+
+// nextAvailableFabricIndexLocked 从 fabricIndex 的下一个开始查找没有使用的 FabricIndex，没有时返回 KUndefinedFabricIndex
+func (f *FabricTable) nextAvailableFabricIndexLocked(fabricIndex FabricIndex) FabricIndex {
+	candidate := fabricIndex
+	for i := 0; i < int(lib.KMaxValidFabricIndex); i++ {
+		if candidate >= lib.KMaxValidFabricIndex {
+			candidate = lib.KMinValidFabricIndex
+		} else {
+			candidate++
+		}
+		if f.findFabricWithIndexLocked(candidate) == nil {
+			return candidate
+		}
+	}
+	return lib.KUndefinedFabricIndex
+}
+
+func (f *FabricTable) storeFabricIndexInfoLocked(nextAvailableFabricIndex FabricIndex) error {
+	indexInfo := fabricIndexInfo{NextAvailableFabricIndex: uint8(nextAvailableFabricIndex), FabricIndices: make([]uint16, 0, len(f.mStates))}
+	for i := range f.mStates {
+		indexInfo.FabricIndices = append(indexInfo.FabricIndices, uint16(f.mStates[i].GetFabricIndex()))
+	}
+	return f.writeLocked(storage.FabricIndexInfo(), &indexInfo)
+}
+
+func (f *FabricTable) storeFabricMetadataLocked(info *FabricInfo) error {
+	metadata := fabricMetadata{VendorId: uint16(info.GetVendorId()), FabricLabel: info.GetFabricLabel()}
+	return f.writeLocked(storage.FabricMetadata(uint8(info.GetFabricIndex())), &metadata)
+}
+
+func (f *FabricTable) readLocked(key string, value any) error {
+	if !f.mStorage.SyncDoesKeyExist(key) {
+		return internal.ChipErrorPersistedStorageValueNotFound
+	}
+	data, err := f.mStorage.ReadValueBin(key)
+	if err != nil {
+		return err
+	}
+	return tlv.Unmarshal(data, value)
+}
+
+func (f *FabricTable) writeLocked(key string, value any) error {
+	data, err := tlv.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return f.mStorage.WriteValueBin(key, data)
 }
@@ -0,0 +1,632 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	testNodeId   lib.NodeId   = 0xDEDEDEDE00010001
+	testFabricId lib.FabricId = 0xFAB000000000001D
+)
+
+// testOperationalKeystore 在内存中保存运行秘钥
+type testOperationalKeystore struct {
+	mKeys         map[FabricIndex]*crypto.P256Keypair
+	mPendingKey   *crypto.P256Keypair
+	mPendingIndex FabricIndex
+	mActivated    bool
+	mCommitErr    error
+}
+
+func newTestOperationalKeystore() *testOperationalKeystore {
+	return &testOperationalKeystore{mKeys: make(map[FabricIndex]*crypto.P256Keypair)}
+}
+
+func (k *testOperationalKeystore) HasPendingOpKeypair() bool {
+	return k.mPendingKey != nil
+}
+
+func (k *testOperationalKeystore) HasOpKeypairForFabric(fabricIndex FabricIndex) bool {
+	return k.mKeys[fabricIndex] != nil
+}
+
+func (k *testOperationalKeystore) NewOpKeypairForFabric(fabricIndex FabricIndex) ([]byte, error) {
+	k.mPendingKey = crypto.NewP256Keypair()
+	if err := k.mPendingKey.Initialize(); err != nil {
+		return nil, err
+	}
+	k.mPendingIndex = fabricIndex
+	k.mActivated = false
+	return k.mPendingKey.Pubkey().Bytes(), nil
+}
+
+func (k *testOperationalKeystore) ActivateOpKeypairForFabric(fabricIndex FabricIndex, nocPublicKey crypto.P256PublicKey) error {
+	if k.mPendingKey == nil || fabricIndex != k.mPendingIndex {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if k.mPendingKey.Pubkey() != nocPublicKey {
+		return internal.ChipErrorInvalidPublicKey
+	}
+	k.mActivated = true
+	return nil
+}
+
+func (k *testOperationalKeystore) CommitOpKeypairForFabric(fabricIndex FabricIndex) error {
+	if k.mCommitErr != nil {
+		return k.mCommitErr
+	}
+	if !k.mActivated || fabricIndex != k.mPendingIndex {
+		return internal.ChipErrorIncorrectState
+	}
+	k.mKeys[fabricIndex] = k.mPendingKey
+	k.RevertPendingKeypair()
+	return nil
+}
+
+func (k *testOperationalKeystore) RemoveOpKeypairForFabric(fabricIndex FabricIndex) error {
+	if k.mKeys[fabricIndex] == nil {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	delete(k.mKeys, fabricIndex)
+	return nil
+}
+
+func (k *testOperationalKeystore) RevertPendingKeypair() {
+	k.mPendingKey = nil
+	k.mPendingIndex = lib.KUndefinedFabricIndex
+	k.mActivated = false
+}
+
+func (k *testOperationalKeystore) SignWithOpKeypair(fabricIndex FabricIndex, message []byte) (crypto.P256ECDSASignature, error) {
+	key := k.mKeys[fabricIndex]
+	if k.mActivated && fabricIndex == k.mPendingIndex {
+		key = k.mPendingKey
+	}
+	if key == nil {
+		return crypto.P256ECDSASignature{}, internal.ChipErrorKeyNotFound
+	}
+	return key.ECDSASignMsg(message)
+}
+
+func (k *testOperationalKeystore) AllocateEphemeralKeypairForCASE() *crypto.P256Keypair {
+	return crypto.NewP256Keypair()
+}
+
+func (k *testOperationalKeystore) ReleaseEphemeralKeypair(*crypto.P256Keypair) {}
+
+func (k *testOperationalKeystore) Init(storage.StorageDelegate) error { return nil }
+
+// testFabricTableDelegate 按顺序记录收到的通知
+type testFabricTableDelegate struct {
+	mEvents []string
+}
+
+func (d *testFabricTableDelegate) FabricWillBeRemoved(_ *FabricTable, fabricIndex FabricIndex) {
+	d.mEvents = append(d.mEvents, fmt.Sprintf("will-remove-%d", fabricIndex))
+}
+
+func (d *testFabricTableDelegate) OnFabricRemoved(_ *FabricTable, fabricIndex FabricIndex) {
+	d.mEvents = append(d.mEvents, fmt.Sprintf("removed-%d", fabricIndex))
+}
+
+func (d *testFabricTableDelegate) OnFabricCommitted(_ *FabricTable, fabricIndex FabricIndex) {
+	d.mEvents = append(d.mEvents, fmt.Sprintf("committed-%d", fabricIndex))
+}
+
+func (d *testFabricTableDelegate) OnFabricUpdated(_ *FabricTable, fabricIndex FabricIndex) {
+	d.mEvents = append(d.mEvents, fmt.Sprintf("updated-%d", fabricIndex))
+}
+
+type testFabricEnv struct {
+	mStorage  *storage.InMemoryPersistentStorage
+	mCerts    *PersistentStorageOpCertStoreImpl
+	mKeystore *testOperationalKeystore
+}
+
+func newTestFabricEnv() *testFabricEnv {
+	env := &testFabricEnv{
+		mStorage:  storage.NewInMemoryPersistentStorage(),
+		mCerts:    NewPersistentStorageOpCertStoreImpl(),
+		mKeystore: newTestOperationalKeystore(),
+	}
+	_ = env.mCerts.Init(env.mStorage)
+	return env
+}
+
+// newTable 使用同一个存储创建 FabricTable，模拟重启
+func (e *testFabricEnv) newTable(t *testing.T) *FabricTable {
+	t.Helper()
+	return e.newTableWith(t, e.mStorage)
+}
+
+// newTableWith FabricTable 通过 delegate 访问存储，证书和秘钥仍然使用 env 中的存储
+func (e *testFabricEnv) newTableWith(t *testing.T, delegate storage.PersistentStorageDelegate) *FabricTable {
+	t.Helper()
+	table := NewFabricTable()
+	params := NewFabricTableInitParams()
+	params.Storage = delegate
+	params.OpCertStore = e.mCerts
+	params.OperationalKeystore = e.mKeystore
+	params.FirmwareBuildTime = testFirmwareBuildTime
+	if err := table.Init(params); err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func newTestKeypair(t *testing.T) *crypto.P256Keypair {
+	t.Helper()
+	keypair := crypto.NewP256Keypair()
+	if err := keypair.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return keypair
+}
+
+func mustAdd(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestRCAC 生成 2021 年到 2031 年有效的 RCAC
+func newTestRCAC(t *testing.T, rootKeypair *crypto.P256Keypair, fabricId lib.FabricId) []byte {
+	t.Helper()
+	var rootDN certs.ChipDN
+	mustAdd(t, rootDN.AddAttribute(certs.AttributeTypeMatterRCACId, 0xCACACACA00000001))
+	mustAdd(t, rootDN.AddAttribute(certs.AttributeTypeMatterFabricId, uint64(fabricId)))
+	params := &certs.X509CertRequestParams{SerialNumber: 1, ValidityStart: testCertValidityStart(t), ValidityEnd: testCertValidityEnd(t),
+		SubjectDN: rootDN, IssuerDN: rootDN}
+	der, err := certs.NewRootX509Cert(params, rootKeypair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcac, err := certs.ConvertX509CertToChipCert(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rcac
+}
+
+// newTestNOC 生成由 RCAC 直接签发的 NOC
+func newTestNOC(t *testing.T, rootKeypair *crypto.P256Keypair, rcac []byte, nodePubkey crypto.P256PublicKey, nodeId lib.NodeId,
+	fabricId lib.FabricId, cats lib.CATValues) []byte {
+	t.Helper()
+	root, err := certs.DecodeChipCert(rcac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodeDN certs.ChipDN
+	mustAdd(t, nodeDN.AddAttribute(certs.AttributeTypeMatterNodeId, uint64(nodeId)))
+	mustAdd(t, nodeDN.AddAttribute(certs.AttributeTypeMatterFabricId, uint64(fabricId)))
+	mustAdd(t, nodeDN.AddCATs(cats))
+	params := &certs.X509CertRequestParams{SerialNumber: 2, ValidityStart: testCertValidityStart(t), ValidityEnd: testCertValidityEnd(t),
+		SubjectDN: nodeDN, IssuerDN: root.SubjectDN}
+	der, err := certs.NewNodeOperationalX509Cert(params, nodePubkey, rootKeypair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noc, err := certs.ConvertX509CertToChipCert(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return noc
+}
+
+func testCertValidityStart(t *testing.T) uint32 {
+	start, err := certs.TimeToChipEpoch(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	mustAdd(t, err)
+	return start
+}
+
+func testCertValidityEnd(t *testing.T) uint32 {
+	end, err := certs.TimeToChipEpoch(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+	mustAdd(t, err)
+	return end
+}
+
+// addTestFabric 使用运行秘钥库中新生成的秘钥对新增并提交一个 Fabric
+func addTestFabric(t *testing.T, env *testFabricEnv, table *FabricTable, rootKeypair *crypto.P256Keypair, fabricId lib.FabricId) FabricIndex {
+	t.Helper()
+	rcac := newTestRCAC(t, rootKeypair, fabricId)
+	mustAdd(t, table.AddNewPendingTrustedRootCert(rcac))
+	nextFabricIndex, err := table.PeekFabricIndexForNextAddition()
+	mustAdd(t, err)
+	pubkey, err := env.mKeystore.NewOpKeypairForFabric(nextFabricIndex)
+	mustAdd(t, err)
+	nodePubkey, err := crypto.NewP256PublicKey(pubkey)
+	mustAdd(t, err)
+	noc := newTestNOC(t, rootKeypair, rcac, nodePubkey, testNodeId, fabricId, lib.CATValues{0xABCD0001})
+	fabricIndex, err := table.AddNewPendingFabricWithOperationalKeystore(noc, nil, 0xFFF1)
+	mustAdd(t, err)
+	mustAdd(t, table.CommitPendingFabricData())
+	return fabricIndex
+}
+
+// 规范 4.3.2.2 的压缩FabricID测试向量
+func TestGenerateCompressedFabricId(t *testing.T) {
+	data, _ := hex.DecodeString("044a9f42b1ca4840d37292bbc7f6a7e11e22200c976fc900dbc98a7a383a641cb8254a2e56d4e295a847943b4e3897c4a773e930277b4d9fbede8a052686bfacfa")
+	rootPubkey, err := crypto.NewP256PublicKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedFabricId, err := GenerateCompressedFabricId(rootPubkey, 0x2906C908D115D362)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressedFabricId != 0x87E1B004E235A130 {
+		t.Errorf("got 0x%016X", uint64(compressedFabricId))
+	}
+}
+
+func TestFabricTableAddAndCommit(t *testing.T) {
+	env := newTestFabricEnv()
+	table := env.newTable(t)
+	delegate := &testFabricTableDelegate{}
+	mustAdd(t, table.AddFabricDelegate(delegate))
+
+	rootKeypair := newTestKeypair(t)
+	rcac := newTestRCAC(t, rootKeypair, testFabricId)
+	if err := table.CommitPendingFabricData(); err != nil {
+		t.Errorf("nothing pending must commit without error: %v", err)
+	}
+	mustAdd(t, table.AddNewPendingTrustedRootCert(rcac))
+	if err := table.AddNewPendingTrustedRootCert(rcac); err != internal.ChipErrorIncorrectState {
+		t.Errorf("second pending root must fail, got %v", err)
+	}
+	if pending, err := table.FetchPendingNonFabricAssociatedRootCert(); err != nil || !reflect.DeepEqual(pending, rcac) {
+		t.Errorf("pending root must be available: %v", err)
+	}
+	if err := table.CommitPendingFabricData(); err != internal.ChipErrorIncorrectState {
+		t.Errorf("root alone must not be committed, got %v", err)
+	}
+
+	// 运行秘钥库没有待提交的秘钥对
+	nodeKeypair := newTestKeypair(t)
+	noc := newTestNOC(t, rootKeypair, rcac, nodeKeypair.Pubkey(), testNodeId, testFabricId, lib.CATValues{0xABCD0001})
+	if _, err := table.AddNewPendingFabricWithOperationalKeystore(noc, nil, 0xFFF1); err != internal.ChipErrorKeyNotFound {
+		t.Errorf("missing pending keypair must fail, got %v", err)
+	}
+	// 提供的秘钥与 NOC 不匹配
+	if _, err := table.AddNewPendingFabricWithProvidedOpKey(noc, nil, 0xFFF1, newTestKeypair(t), false); err != internal.ChipErrorInvalidPublicKey {
+		t.Errorf("mismatched keypair must fail, got %v", err)
+	}
+
+	fabricIndex, err := table.AddNewPendingFabricWithProvidedOpKey(noc, nil, 0xFFF1, nodeKeypair, false)
+	if err != nil || fabricIndex != lib.KMinValidFabricIndex {
+		t.Fatalf("add fabric: %d %v", fabricIndex, err)
+	}
+	if _, err = table.FetchPendingNonFabricAssociatedRootCert(); err != internal.ChipErrorNotFound {
+		t.Errorf("root is associated with the fabric, got %v", err)
+	}
+	info := table.FindFabricWithIndex(fabricIndex)
+	if info == nil || info.GetNodeId() != testNodeId || info.GetFabricId() != testFabricId || info.GetVendorId() != 0xFFF1 {
+		t.Fatalf("unexpected pending fabric %+v", info)
+	}
+	compressedFabricId, _ := GenerateCompressedFabricId(rootKeypair.Pubkey(), testFabricId)
+	if info.GetCompressedFabricId() != compressedFabricId || table.FindFabricWithCompressedId(compressedFabricId) != info {
+		t.Errorf("compressed fabric id mismatch")
+	}
+	mustAdd(t, table.SetFabricLabel(fabricIndex, "living room"))
+	mustAdd(t, table.CommitPendingFabricData())
+
+	if !reflect.DeepEqual(delegate.mEvents, []string{"updated-1", "committed-1"}) {
+		t.Errorf("unexpected events %v", delegate.mEvents)
+	}
+	if cats, err := table.FetchCATs(fabricIndex); err != nil || cats[0] != 0xABCD0001 {
+		t.Errorf("unexpected CATs %v: %v", cats, err)
+	}
+	signature, err := table.SignWithOpKeypair(fabricIndex, []byte("message"))
+	mustAdd(t, err)
+	mustAdd(t, nodeKeypair.Pubkey().ECDSAValidateMsgSignature([]byte("message"), signature))
+	if lastKnownGoodTime, _ := table.GetLastKnownGoodChipEpochTime(); !lastKnownGoodTime.Equal(testFirmwareBuildTime) {
+		t.Errorf("certificates before firmware build time must not move the time, got %v", lastKnownGoodTime)
+	}
+
+	// 相同的根证书和 FabricId 不能重复添加
+	mustAdd(t, table.AddNewPendingTrustedRootCert(rcac))
+	if _, err = table.AddNewPendingFabricWithProvidedOpKey(noc, nil, 0xFFF1, nodeKeypair, false); err != internal.ChipErrorFabricExists {
+		t.Errorf("duplicate fabric must fail, got %v", err)
+	}
+	table.RevertPendingFabricData()
+
+	// 重启后从存储中恢复，运行秘钥不会保存
+	reloaded := env.newTable(t)
+	info = reloaded.FindFabricWithIndex(fabricIndex)
+	if reloaded.FabricCount() != 1 || info == nil || info.GetNodeId() != testNodeId || info.GetFabricLabel() != "living room" ||
+		info.GetCompressedFabricId() != compressedFabricId || info.GetVendorId() != 0xFFF1 || info.HasOperationalKey() {
+		t.Fatalf("unexpected reloaded fabric %+v", info)
+	}
+	if nodeId, fabricId, pubkey, err := reloaded.VerifyCredentials(fabricIndex, noc, nil); err != nil || nodeId != testNodeId ||
+		fabricId != testFabricId || pubkey != nodeKeypair.Pubkey() {
+		t.Errorf("credentials must verify against the fabric root: %v", err)
+	}
+	if _, _, _, err = reloaded.VerifyCredentials(fabricIndex, newTestNOC(t, newTestKeypair(t), rcac, nodeKeypair.Pubkey(),
+		testNodeId, testFabricId, lib.CATValues{}), nil); err != internal.ChipErrorCACertNotFound {
+		t.Errorf("NOC from another root must fail, got %v", err)
+	}
+}
+
+func TestFabricTableOperationalKeystore(t *testing.T) {
+	env := newTestFabricEnv()
+	table := env.newTable(t)
+	first := addTestFabric(t, env, table, newTestKeypair(t), testFabricId)
+	second := addTestFabric(t, env, table, newTestKeypair(t), testFabricId)
+	if first != 1 || second != 2 || table.FabricCount() != 2 {
+		t.Fatalf("unexpected fabric indices %d %d", first, second)
+	}
+	if !env.mKeystore.HasOpKeypairForFabric(second) {
+		t.Errorf("keypair must be committed to the keystore")
+	}
+	signature, err := table.SignWithOpKeypair(second, []byte("message"))
+	mustAdd(t, err)
+	mustAdd(t, env.mKeystore.mKeys[second].Pubkey().ECDSAValidateMsgSignature([]byte("message"), signature))
+
+	// 删除后 FabricIndex 不立即复用
+	mustAdd(t, table.Delete(first))
+	if env.mKeystore.HasOpKeypairForFabric(first) || env.mCerts.HasCertificateForFabric(first, CertChainElementRcac) {
+		t.Errorf("deleted fabric must remove keys and certificates")
+	}
+	if third := addTestFabric(t, env, table, newTestKeypair(t), testFabricId); third != 3 {
+		t.Errorf("expected fabric index 3, got %d", third)
+	}
+	reloaded := env.newTable(t)
+	if reloaded.FabricCount() != 2 || reloaded.FindFabricWithIndex(first) != nil || reloaded.mNextAvailableFabricIndex != 4 {
+		t.Errorf("unexpected reloaded table %d %d", reloaded.FabricCount(), reloaded.mNextAvailableFabricIndex)
+	}
+}
+
+func TestFabricTableRevert(t *testing.T) {
+	env := newTestFabricEnv()
+	table := env.newTable(t)
+	rootKeypair := newTestKeypair(t)
+	rcac := newTestRCAC(t, rootKeypair, testFabricId)
+	nodeKeypair := newTestKeypair(t)
+	noc := newTestNOC(t, rootKeypair, rcac, nodeKeypair.Pubkey(), testNodeId, testFabricId, lib.CATValues{})
+
+	mustAdd(t, table.AddNewPendingTrustedRootCert(rcac))
+	if _, err := table.AddNewPendingFabricWithProvidedOpKey(noc, nil, 0xFFF1, nodeKeypair, false); err != nil {
+		t.Fatal(err)
+	}
+	// 保留根证书，可以重新添加 NOC
+	table.RevertPendingOpCertsExceptRoot()
+	if table.FabricCount() != 0 {
+		t.Errorf("reverted fabric must be removed")
+	}
+	if _, err := table.FetchPendingNonFabricAssociatedRootCert(); err != nil {
+		t.Errorf("root must still be pending: %v", err)
+	}
+	if _, err := table.AddNewPendingFabricWithProvidedOpKey(noc, nil, 0xFFF1, nodeKeypair, false); err != nil {
+		t.Fatal(err)
+	}
+
+	table.RevertPendingFabricData()
+	if table.FabricCount() != 0 || env.mCerts.HasPendingRootCert() {
+		t.Errorf("revert must remove all pending data")
+	}
+	if _, err := table.FetchPendingNonFabricAssociatedRootCert(); err != internal.ChipErrorNotFound {
+		t.Errorf("root must not be pending, got %v", err)
+	}
+	if env.mStorage.SyncDoesKeyExist(storage.FabricIndexInfo()) || env.mStorage.SyncDoesKeyExist(storage.FabricMetadata(1)) {
+		t.Errorf("reverted fabric must not be stored")
+	}
+	if fabricIndex := addTestFabric(t, env, table, rootKeypair, testFabricId); fabricIndex != 1 {
+		t.Errorf("fabric index must be reused after revert, got %d", fabricIndex)
+	}
+}
+
+func TestFabricTableUpdate(t *testing.T) {
+	env := newTestFabricEnv()
+	table := env.newTable(t)
+	delegate := &testFabricTableDelegate{}
+	mustAdd(t, table.AddFabricDelegate(delegate))
+	rootKeypair := newTestKeypair(t)
+	fabricIndex := addTestFabric(t, env, table, rootKeypair, testFabricId)
+	mustAdd(t, table.SetFabricLabel(fabricIndex, "kitchen"))
+	rcac, err := table.FetchRootCert(fabricIndex)
+	mustAdd(t, err)
+
+	const newNodeId lib.NodeId = 0xDEDEDEDE00010002
+	nodeKeypair := newTestKeypair(t)
+	noc := newTestNOC(t, rootKeypair, rcac, nodeKeypair.Pubkey(), newNodeId, testFabricId, lib.CATValues{})
+	otherFabric := newTestNOC(t, rootKeypair, rcac, nodeKeypair.Pubkey(), newNodeId, testFabricId+1, lib.CATValues{})
+	if err = table.UpdatePendingFabricWithProvidedOpKey(fabricIndex, otherFabric, nil, nodeKeypair, false); err != internal.ChipErrorFabricMismatchOnICA {
+		t.Errorf("NOC with another fabric id must fail, got %v", err)
+	}
+	if err = table.UpdatePendingFabricWithProvidedOpKey(lib.FabricIndex(9), noc, nil, nodeKeypair, false); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("unknown fabric must fail, got %v", err)
+	}
+
+	mustAdd(t, table.UpdatePendingFabricWithProvidedOpKey(fabricIndex, noc, nil, nodeKeypair, false))
+	if info := table.FindFabricWithIndex(fabricIndex); info.GetNodeId() != newNodeId || info.GetFabricLabel() != "kitchen" {
+		t.Errorf("pending update must be visible, got %+v", info)
+	}
+	if infos := table.GetFabricInfos(); len(infos) != 1 || infos[0].GetNodeId() != newNodeId {
+		t.Errorf("pending update must be visible in fabric list")
+	}
+	table.RevertPendingFabricData()
+	if info := table.FindFabricWithIndex(fabricIndex); info.GetNodeId() != testNodeId {
+		t.Errorf("revert must restore the committed fabric, got %+v", info)
+	}
+
+	mustAdd(t, table.UpdatePendingFabricWithProvidedOpKey(fabricIndex, noc, nil, nodeKeypair, false))
+	mustAdd(t, table.CommitPendingFabricData())
+	if fetched, _ := table.FetchNOCCert(fabricIndex); !reflect.DeepEqual(fetched, noc) {
+		t.Errorf("updated NOC must be committed")
+	}
+	reloaded := env.newTable(t)
+	if info := reloaded.FindFabricWithIndex(fabricIndex); info == nil || info.GetNodeId() != newNodeId || info.GetFabricLabel() != "kitchen" {
+		t.Errorf("updated fabric must be stored, got %+v", info)
+	}
+	expected := []string{"updated-1", "committed-1", "updated-1", "updated-1", "committed-1"}
+	if !reflect.DeepEqual(delegate.mEvents, expected) {
+		t.Errorf("unexpected events %v", delegate.mEvents)
+	}
+}
+
+func TestFabricTableDelete(t *testing.T) {
+	env := newTestFabricEnv()
+	table := env.newTable(t)
+	delegate := &testFabricTableDelegate{}
+	fabricIndex := addTestFabric(t, env, table, newTestKeypair(t), testFabricId)
+	other := addTestFabric(t, env, table, newTestKeypair(t), testFabricId)
+	mustAdd(t, table.AddFabricDelegate(delegate))
+	mustAdd(t, table.AddFabricDelegate(delegate))
+
+	mustAdd(t, table.Delete(fabricIndex))
+	if !reflect.DeepEqual(delegate.mEvents, []string{"will-remove-1", "removed-1"}) {
+		t.Errorf("unexpected events %v", delegate.mEvents)
+	}
+	if err := table.Delete(fabricIndex); err != internal.ChipErrorNotFound {
+		t.Errorf("deleting twice must fail, got %v", err)
+	}
+	if err := table.Delete(lib.KUndefinedFabricIndex); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("invalid fabric index must fail, got %v", err)
+	}
+	if env.mStorage.SyncDoesKeyExist(storage.FabricMetadata(uint8(fabricIndex))) {
+		t.Errorf("metadata must be removed")
+	}
+
+	table.RemoveFabricDelegate(delegate)
+	table.Forget(other)
+	if table.FabricCount() != 0 || env.newTable(t).FabricCount() != 1 {
+		t.Errorf("forget must only remove the fabric from memory")
+	}
+
+	table = env.newTable(t)
+	mustAdd(t, table.DeleteAllFabrics())
+	if table.FabricCount() != 0 || env.newTable(t).FabricCount() != 0 {
+		t.Errorf("all fabrics must be removed")
+	}
+}
+
+func TestFabricTableCommitMarker(t *testing.T) {
+	env := newTestFabricEnv()
+	table := env.newTable(t)
+	kept := addTestFabric(t, env, table, newTestKeypair(t), testFabricId)
+	interrupted := addTestFabric(t, env, table, newTestKeypair(t), testFabricId)
+
+	// 模拟提交过程中断电
+	marker, err := tlv.Marshal(&fabricTableCommitMarker{FabricIndex: uint8(interrupted), IsAddition: true})
+	mustAdd(t, err)
+	mustAdd(t, env.mStorage.WriteValueBin(storage.FabricTableCommitMarkerKey(), marker))
+
+	reloaded := env.newTable(t)
+	if reloaded.FabricCount() != 1 || reloaded.FindFabricWithIndex(kept) == nil || reloaded.FindFabricWithIndex(interrupted) != nil {
+		t.Errorf("interrupted fabric must be removed")
+	}
+	if env.mCerts.HasCertificateForFabric(interrupted, CertChainElementNoc) || env.mKeystore.HasOpKeypairForFabric(interrupted) {
+		t.Errorf("interrupted fabric data must be removed")
+	}
+	if env.mStorage.SyncDoesKeyExist(storage.FabricTableCommitMarkerKey()) {
+		t.Errorf("commit marker must be cleared")
+	}
+	if deleted := reloaded.GetDeletedFabricFromCommitMarker(); deleted != interrupted {
+		t.Errorf("expected deleted fabric %d, got %d", interrupted, deleted)
+	}
+	if deleted := reloaded.GetDeletedFabricFromCommitMarker(); deleted != lib.KUndefinedFabricIndex {
+		t.Errorf("deleted fabric must only be reported once, got %d", deleted)
+	}
+	if env.newTable(t).FabricCount() != 1 {
+		t.Errorf("removal must be persisted")
+	}
+}
+
+func TestFabricTableFailedUpdateCommit(t *testing.T) {
+	env := newTestFabricEnv()
+	failing := &failingStorage{InMemoryPersistentStorage: env.mStorage}
+	env.mCerts = newTestOpCertStoreWith(t, failing)
+	table := env.newTable(t)
+	rootKeypair := newTestKeypair(t)
+	fabricIndex := addTestFabric(t, env, table, rootKeypair, testFabricId)
+	rcac, err := table.FetchRootCert(fabricIndex)
+	mustAdd(t, err)
+	oldNoc, err := table.FetchNOCCert(fabricIndex)
+	mustAdd(t, err)
+
+	// 写入 NOC 失败时证书存储已经回滚，Fabric 保持更新前的状态
+	const newNodeId lib.NodeId = 0xDEDEDEDE00010002
+	nodeKeypair := newTestKeypair(t)
+	noc := newTestNOC(t, rootKeypair, rcac, nodeKeypair.Pubkey(), newNodeId, testFabricId, lib.CATValues{})
+	failing.mFailKey = storage.FabricNOC(uint8(fabricIndex))
+	mustAdd(t, table.UpdatePendingFabricWithProvidedOpKey(fabricIndex, noc, nil, nodeKeypair, false))
+	if err = table.CommitPendingFabricData(); err != internal.ChipErrorPersistedStorageFailed {
+		t.Fatalf("expected storage failure, got %v", err)
+	}
+	failing.mFailKey = ""
+	if info := table.FindFabricWithIndex(fabricIndex); info == nil || info.GetNodeId() != testNodeId {
+		t.Errorf("failed update must keep the committed fabric, got %+v", info)
+	}
+	if env.mStorage.SyncDoesKeyExist(storage.FabricTableCommitMarkerKey()) {
+		t.Errorf("commit marker must be cleared when nothing was committed")
+	}
+	reloaded := env.newTable(t)
+	if info := reloaded.FindFabricWithIndex(fabricIndex); info == nil || info.GetNodeId() != testNodeId {
+		t.Errorf("stored fabric must be unchanged, got %+v", info)
+	}
+	if fetched, _ := reloaded.FetchNOCCert(fabricIndex); !reflect.DeepEqual(fetched, oldNoc) {
+		t.Errorf("stored NOC must be the previous NOC")
+	}
+	if _, _, _, err = reloaded.VerifyCredentials(fabricIndex, oldNoc, nil); err != nil {
+		t.Errorf("stored chain must still verify: %v", err)
+	}
+
+	// 写入最后已知的正确时间失败时证书还没有提交，内存和存储中都是更新前的 Fabric
+	table = env.newTableWith(t, failing)
+	nodeKeypair = newTestKeypair(t)
+	noc = newTestNOC(t, rootKeypair, rcac, nodeKeypair.Pubkey(), newNodeId, testFabricId, lib.CATValues{})
+	mustAdd(t, table.UpdatePendingFabricWithProvidedOpKey(fabricIndex, noc, nil, nodeKeypair, false))
+	failing.mFailKey = storage.LastKnownGoodTimeKey()
+	if err = table.CommitPendingFabricData(); err != internal.ChipErrorPersistedStorageFailed {
+		t.Fatalf("expected storage failure, got %v", err)
+	}
+	failing.mFailKey = ""
+	if info := table.FindFabricWithIndex(fabricIndex); info == nil || info.GetNodeId() != testNodeId {
+		t.Errorf("failed update must keep the committed fabric in memory, got %+v", info)
+	}
+	if fetched, _ := table.FetchNOCCert(fabricIndex); !reflect.DeepEqual(fetched, oldNoc) {
+		t.Errorf("stored NOC must be the previous NOC")
+	}
+	reloaded = env.newTable(t)
+	if info := reloaded.FindFabricWithIndex(fabricIndex); info == nil || info.GetNodeId() != testNodeId {
+		t.Errorf("stored fabric must be unchanged, got %+v", info)
+	}
+
+	// 证书已经写入而运行秘钥提交失败，立即删除不一致的 Fabric，内存与存储一致
+	table = reloaded
+	pubkey, err := env.mKeystore.NewOpKeypairForFabric(fabricIndex)
+	mustAdd(t, err)
+	nodePubkey, err := crypto.NewP256PublicKey(pubkey)
+	mustAdd(t, err)
+	noc = newTestNOC(t, rootKeypair, rcac, nodePubkey, newNodeId, testFabricId, lib.CATValues{})
+	mustAdd(t, table.UpdatePendingFabricWithOperationalKeystore(fabricIndex, noc, nil))
+	env.mKeystore.mCommitErr = internal.ChipErrorPersistedStorageFailed
+	if err = table.CommitPendingFabricData(); err != internal.ChipErrorPersistedStorageFailed {
+		t.Fatalf("expected keystore failure, got %v", err)
+	}
+	env.mKeystore.mCommitErr = nil
+	if table.FindFabricWithIndex(fabricIndex) != nil || table.FabricCount() != 0 {
+		t.Errorf("inconsistent fabric must be removed from memory")
+	}
+	if env.mStorage.SyncDoesKeyExist(storage.FabricTableCommitMarkerKey()) {
+		t.Errorf("commit marker must be cleared after the fabric is removed")
+	}
+	if env.mCerts.HasCertificateForFabric(fabricIndex, CertChainElementNoc) {
+		t.Errorf("certificates of the inconsistent fabric must be removed")
+	}
+	reloaded = env.newTable(t)
+	if reloaded.FindFabricWithIndex(fabricIndex) != nil || reloaded.GetDeletedFabricFromCommitMarker() != lib.KUndefinedFabricIndex {
+		t.Errorf("inconsistent fabric must stay removed after init")
+	}
+}
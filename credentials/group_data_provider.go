@@ -1,31 +1,852 @@
 package credentials
 
 import (
+	"encoding/binary"
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
 	"github.com/galenliu/chip/storage"
+	"sort"
+	"sync"
+	"time"
 )
 
+const (
+	// KIdentityProtectionKeySetId IPK 使用的 KeySet ID
+	KIdentityProtectionKeySetId uint16 = 0
+	// KGroupKeyLength 组秘钥和 IPK 的长度
+	KGroupKeyLength = 16
+	// KEpochKeysMax 一个 KeySet 最多包含的纪元秘钥数量
+	KEpochKeysMax = 3
+	// KGroupNameMaxLength 组名称的最大长度
+	KGroupNameMaxLength = 16
+	// KMaxGroupsPerFabric 每个 Fabric 最多的组数量
+	KMaxGroupsPerFabric = 12
+	// KMaxGroupKeysPerFabric 每个 Fabric 最多的组秘钥映射数量
+	KMaxGroupKeysPerFabric = 12
+	// KMaxKeySetsPerFabric 每个 Fabric 最多的 KeySet 数量，包括 IPK
+	KMaxKeySetsPerFabric = 4
+)
+
+var (
+	kGroupKeyInfo        = []byte("GroupKey v1.0")
+	kGroupKeyHashInfo    = []byte("GroupKeyHash")
+	kGroupPrivacyKeyInfo = []byte("PrivacyKey")
+)
+
+// SecurityPolicy KeySet 的纪元秘钥更新策略
+type SecurityPolicy uint8
+
+const (
+	SecurityPolicyTrustFirst SecurityPolicy = iota
+	SecurityPolicyCacheAndSync
+)
+
+// EpochKey 从 StartTime 开始生效的纪元秘钥，StartTime 为 Matter 纪元的微秒数
+type EpochKey struct {
+	StartTime uint64
+	Key       [KGroupKeyLength]byte
+}
+
+// KeySet 一组纪元秘钥，保存的是由纪元秘钥派生的运行组秘钥
+type KeySet struct {
+	KeySetId  uint16
+	Policy    SecurityPolicy
+	EpochKeys []EpochKey
+}
+
+// GroupInfo Fabric 中的一个组
+type GroupInfo struct {
+	GroupId lib.GroupId
+	Name    string
+}
+
+// GroupEndpoint 组与端点的映射
+type GroupEndpoint struct {
+	GroupId    lib.GroupId
+	EndpointId lib.EndpointId
+}
+
+// GroupKey 组秘钥映射，每个组只使用一个 KeySet
+type GroupKey struct {
+	GroupId  lib.GroupId
+	KeySetId uint16
+}
+
+// GroupSession 一个运行组秘钥，用于加解密组消息
+type GroupSession struct {
+	FabricIndex    lib.FabricIndex
+	GroupId        lib.GroupId
+	SecurityPolicy SecurityPolicy
+	// SessionId 由运行组秘钥派生的组会话ID
+	SessionId uint16
+	// Key 运行组秘钥，即组消息的加密秘钥
+	Key [KGroupKeyLength]byte
+}
+
 type GroupDataProvider interface {
 	SetStorageDelegate(delegate storage.StorageDelegate)
+	// Init 从存储加载组数据，没有设置存储时只保存在内存中
 	Init() error
 	SetListener(listener GroupDataProviderListener)
+
+	// SetGroupInfo 新增或者修改组的名称
+	SetGroupInfo(fabricIndex lib.FabricIndex, info GroupInfo) error
+	GetGroupInfo(fabricIndex lib.FabricIndex, groupId lib.GroupId) (GroupInfo, error)
+	GetGroupInfos(fabricIndex lib.FabricIndex) []GroupInfo
+	// RemoveGroupInfo 删除组以及它的端点映射
+	RemoveGroupInfo(fabricIndex lib.FabricIndex, groupId lib.GroupId) error
+
+	HasEndpoint(fabricIndex lib.FabricIndex, groupId lib.GroupId, endpointId lib.EndpointId) bool
+	// AddEndpoint 组不存在时创建组
+	AddEndpoint(fabricIndex lib.FabricIndex, groupId lib.GroupId, endpointId lib.EndpointId) error
+	// RemoveEndpoint 组没有端点之后删除组
+	RemoveEndpoint(fabricIndex lib.FabricIndex, groupId lib.GroupId, endpointId lib.EndpointId) error
+	RemoveEndpointAllGroups(fabricIndex lib.FabricIndex, endpointId lib.EndpointId) error
+	GetEndpoints(fabricIndex lib.FabricIndex) []GroupEndpoint
+
+	// SetGroupKey 设置组使用的 KeySet，替换原有的映射
+	SetGroupKey(fabricIndex lib.FabricIndex, groupKey GroupKey) error
+	GetGroupKeys(fabricIndex lib.FabricIndex) []GroupKey
+	RemoveGroupKey(fabricIndex lib.FabricIndex, groupId lib.GroupId) error
+	RemoveGroupKeys(fabricIndex lib.FabricIndex) error
+
+	// SetKeySet 保存 KeySet，纪元秘钥使用压缩FabricID派生为运行组秘钥
+	SetKeySet(fabricIndex lib.FabricIndex, compressedFabricId lib.CompressedFabricId, keySet KeySet) error
+	GetKeySet(fabricIndex lib.FabricIndex, keySetId uint16) (KeySet, error)
+	GetKeySetIds(fabricIndex lib.FabricIndex) []uint16
+	// RemoveKeySet 删除 KeySet 以及使用它的组秘钥映射
+	RemoveKeySet(fabricIndex lib.FabricIndex, keySetId uint16) error
+	// GetIpkKeySet 返回Fabric的 IPK，CASE 用来计算目的ID和会话秘钥
+	GetIpkKeySet(fabricIndex lib.FabricIndex) (KeySet, error)
+
+	// GetCurrentGroupSession 返回发送组消息使用的当前运行组秘钥
+	GetCurrentGroupSession(fabricIndex lib.FabricIndex, groupId lib.GroupId) (GroupSession, error)
+	// GetGroupSessions 返回所有组会话ID为 sessionId 的运行组秘钥，接收组消息时逐个尝试
+	GetGroupSessions(sessionId uint16) []GroupSession
+
+	// RemoveFabric 删除Fabric的所有组数据
+	RemoveFabric(fabricIndex lib.FabricIndex) error
+}
+
+// 持久化的组数据
+type (
+	groupData struct {
+		GroupId   uint16   `tlv:"1"`
+		Name      string   `tlv:"2"`
+		Endpoints []uint16 `tlv:"3,omitempty"`
+	}
+	groupKeyData struct {
+		GroupId  uint16 `tlv:"1"`
+		KeySetId uint16 `tlv:"2"`
+	}
+	fabricGroupsData struct {
+		Groups    []groupData    `tlv:"1,omitempty,list"`
+		GroupKeys []groupKeyData `tlv:"2,omitempty,list"`
+		KeySetIds []uint16       `tlv:"3,omitempty"`
+	}
+	epochKeyData struct {
+		StartTime uint64 `tlv:"1"`
+		Key       []byte `tlv:"2"`
+	}
+	keySetData struct {
+		KeySetId  uint16         `tlv:"1"`
+		Policy    uint8          `tlv:"2"`
+		EpochKeys []epochKeyData `tlv:"3,list"`
+	}
+	groupFabricList struct {
+		FabricIndices []uint16 `tlv:"1,omitempty"`
+	}
+)
+
+// storedKeySet 运行组秘钥以及由它们派生的组会话ID
+type storedKeySet struct {
+	mKeySet     KeySet
+	mSessionIds []uint16
+}
+
+type fabricGroupState struct {
+	mGroups    []groupData
+	mGroupKeys []GroupKey
+	mKeySets   map[uint16]*storedKeySet
+}
+
+type groupEvent struct {
+	mFabricIndex lib.FabricIndex
+	mGroup       GroupInfo
+	mAdded       bool
 }
 
 type GroupDataProviderImpl struct {
-	mStorage storage.StorageDelegate
+	mMutex    sync.Mutex
+	mStorage  storage.StorageDelegate
+	mListener GroupDataProviderListener
+	mFabrics  map[lib.FabricIndex]*fabricGroupState
+	mNow      func() time.Time
 }
 
 func NewGroupDataProviderImpl() *GroupDataProviderImpl {
-	return &GroupDataProviderImpl{}
+	return &GroupDataProviderImpl{mFabrics: make(map[lib.FabricIndex]*fabricGroupState), mNow: time.Now}
 }
 
-func (g GroupDataProviderImpl) SetListener(listener GroupDataProviderListener) {
-
+func (g *GroupDataProviderImpl) SetListener(listener GroupDataProviderListener) {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	g.mListener = listener
 }
 
 func (g *GroupDataProviderImpl) SetStorageDelegate(delegate storage.StorageDelegate) {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
 	g.mStorage = delegate
 }
 
-func (g GroupDataProviderImpl) Init() error {
+func (g *GroupDataProviderImpl) Init() error {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	g.mFabrics = make(map[lib.FabricIndex]*fabricGroupState)
+	if g.mStorage == nil {
+		return nil
+	}
+	var fabricList groupFabricList
+	if err := g.readLocked(storage.GroupFabricList(), &fabricList); err != nil {
+		if err == internal.ChipErrorPersistedStorageValueNotFound {
+			return nil
+		}
+		return err
+	}
+	for _, index := range fabricList.FabricIndices {
+		fabricIndex := lib.FabricIndex(index)
+		var data fabricGroupsData
+		if err := g.readLocked(storage.FabricGroups(uint8(fabricIndex)), &data); err != nil {
+			return err
+		}
+		state := newFabricGroupState()
+		state.mGroups = data.Groups
+		for _, groupKey := range data.GroupKeys {
+			state.mGroupKeys = append(state.mGroupKeys, GroupKey{GroupId: lib.GroupId(groupKey.GroupId), KeySetId: groupKey.KeySetId})
+		}
+		for _, keySetId := range data.KeySetIds {
+			var keySet keySetData
+			if err := g.readLocked(storage.FabricKeyset(uint8(fabricIndex), keySetId), &keySet); err != nil {
+				return err
+			}
+			stored, err := newStoredKeySet(keySetFromData(keySet))
+			if err != nil {
+				return err
+			}
+			state.mKeySets[keySetId] = stored
+		}
+		g.mFabrics[fabricIndex] = state
+	}
+	return nil
+}
+
+func (g *GroupDataProviderImpl) SetGroupInfo(fabricIndex lib.FabricIndex, info GroupInfo) error {
+	if !fabricIndex.IsValidFabricIndex() || info.GroupId == lib.KUndefinedGroupId || len(info.Name) > KGroupNameMaxLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	g.mMutex.Lock()
+	state := g.getOrCreateFabricLocked(fabricIndex)
+	var events []groupEvent
+	if group := state.findGroup(info.GroupId); group != nil {
+		group.Name = info.Name
+	} else {
+		if len(state.mGroups) >= KMaxGroupsPerFabric {
+			g.mMutex.Unlock()
+			return internal.ChipErrorNoMemory
+		}
+		state.mGroups = append(state.mGroups, groupData{GroupId: uint16(info.GroupId), Name: info.Name})
+		events = append(events, groupEvent{mFabricIndex: fabricIndex, mGroup: info, mAdded: true})
+	}
+	err := g.saveFabricLocked(fabricIndex)
+	g.mMutex.Unlock()
+	g.notify(events)
+	return err
+}
+
+func (g *GroupDataProviderImpl) GetGroupInfo(fabricIndex lib.FabricIndex, groupId lib.GroupId) (GroupInfo, error) {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	if state := g.mFabrics[fabricIndex]; state != nil {
+		if group := state.findGroup(groupId); group != nil {
+			return group.info(), nil
+		}
+	}
+	return GroupInfo{}, internal.ChipErrorNotFound
+}
+
+func (g *GroupDataProviderImpl) GetGroupInfos(fabricIndex lib.FabricIndex) []GroupInfo {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		return nil
+	}
+	infos := make([]GroupInfo, 0, len(state.mGroups))
+	for i := range state.mGroups {
+		infos = append(infos, state.mGroups[i].info())
+	}
+	return infos
+}
+
+func (g *GroupDataProviderImpl) RemoveGroupInfo(fabricIndex lib.FabricIndex, groupId lib.GroupId) error {
+	g.mMutex.Lock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil || state.findGroup(groupId) == nil {
+		g.mMutex.Unlock()
+		return internal.ChipErrorNotFound
+	}
+	events := []groupEvent{state.removeGroup(fabricIndex, groupId)}
+	err := g.saveFabricLocked(fabricIndex)
+	g.mMutex.Unlock()
+	g.notify(events)
+	return err
+}
+
+func (g *GroupDataProviderImpl) HasEndpoint(fabricIndex lib.FabricIndex, groupId lib.GroupId, endpointId lib.EndpointId) bool {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	if state := g.mFabrics[fabricIndex]; state != nil {
+		if group := state.findGroup(groupId); group != nil {
+			return group.hasEndpoint(endpointId)
+		}
+	}
+	return false
+}
+
+func (g *GroupDataProviderImpl) AddEndpoint(fabricIndex lib.FabricIndex, groupId lib.GroupId, endpointId lib.EndpointId) error {
+	if !fabricIndex.IsValidFabricIndex() || groupId == lib.KUndefinedGroupId {
+		return internal.ChipErrorInvalidArgument
+	}
+	g.mMutex.Lock()
+	state := g.getOrCreateFabricLocked(fabricIndex)
+	var events []groupEvent
+	group := state.findGroup(groupId)
+	if group == nil {
+		if len(state.mGroups) >= KMaxGroupsPerFabric {
+			g.mMutex.Unlock()
+			return internal.ChipErrorNoMemory
+		}
+		state.mGroups = append(state.mGroups, groupData{GroupId: uint16(groupId)})
+		group = &state.mGroups[len(state.mGroups)-1]
+		events = append(events, groupEvent{mFabricIndex: fabricIndex, mGroup: group.info(), mAdded: true})
+	}
+	if group.hasEndpoint(endpointId) {
+		g.mMutex.Unlock()
+		return nil
+	}
+	group.Endpoints = append(group.Endpoints, uint16(endpointId))
+	err := g.saveFabricLocked(fabricIndex)
+	g.mMutex.Unlock()
+	g.notify(events)
+	return err
+}
+
+func (g *GroupDataProviderImpl) RemoveEndpoint(fabricIndex lib.FabricIndex, groupId lib.GroupId, endpointId lib.EndpointId) error {
+	g.mMutex.Lock()
+	state := g.mFabrics[fabricIndex]
+	var group *groupData
+	if state != nil {
+		group = state.findGroup(groupId)
+	}
+	if group == nil || !group.hasEndpoint(endpointId) {
+		g.mMutex.Unlock()
+		return internal.ChipErrorNotFound
+	}
+	events := state.removeEndpoint(fabricIndex, group, endpointId)
+	err := g.saveFabricLocked(fabricIndex)
+	g.mMutex.Unlock()
+	g.notify(events)
+	return err
+}
+
+func (g *GroupDataProviderImpl) RemoveEndpointAllGroups(fabricIndex lib.FabricIndex, endpointId lib.EndpointId) error {
+	g.mMutex.Lock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		g.mMutex.Unlock()
+		return nil
+	}
+	var groupIds []lib.GroupId
+	for i := range state.mGroups {
+		if state.mGroups[i].hasEndpoint(endpointId) {
+			groupIds = append(groupIds, lib.GroupId(state.mGroups[i].GroupId))
+		}
+	}
+	var events []groupEvent
+	for _, groupId := range groupIds {
+		events = append(events, state.removeEndpoint(fabricIndex, state.findGroup(groupId), endpointId)...)
+	}
+	var err error
+	if len(groupIds) != 0 {
+		err = g.saveFabricLocked(fabricIndex)
+	}
+	g.mMutex.Unlock()
+	g.notify(events)
+	return err
+}
+
+func (g *GroupDataProviderImpl) GetEndpoints(fabricIndex lib.FabricIndex) []GroupEndpoint {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		return nil
+	}
+	var endpoints []GroupEndpoint
+	for _, group := range state.mGroups {
+		for _, endpointId := range group.Endpoints {
+			endpoints = append(endpoints, GroupEndpoint{GroupId: lib.GroupId(group.GroupId), EndpointId: lib.EndpointId(endpointId)})
+		}
+	}
+	return endpoints
+}
+
+func (g *GroupDataProviderImpl) SetGroupKey(fabricIndex lib.FabricIndex, groupKey GroupKey) error {
+	if !fabricIndex.IsValidFabricIndex() || groupKey.GroupId == lib.KUndefinedGroupId || groupKey.KeySetId == KIdentityProtectionKeySetId {
+		return internal.ChipErrorInvalidArgument
+	}
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.getOrCreateFabricLocked(fabricIndex)
+	for i := range state.mGroupKeys {
+		if state.mGroupKeys[i].GroupId == groupKey.GroupId {
+			state.mGroupKeys[i].KeySetId = groupKey.KeySetId
+			return g.saveFabricLocked(fabricIndex)
+		}
+	}
+	if len(state.mGroupKeys) >= KMaxGroupKeysPerFabric {
+		return internal.ChipErrorNoMemory
+	}
+	state.mGroupKeys = append(state.mGroupKeys, groupKey)
+	return g.saveFabricLocked(fabricIndex)
+}
+
+func (g *GroupDataProviderImpl) GetGroupKeys(fabricIndex lib.FabricIndex) []GroupKey {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		return nil
+	}
+	return append([]GroupKey(nil), state.mGroupKeys...)
+}
+
+func (g *GroupDataProviderImpl) RemoveGroupKey(fabricIndex lib.FabricIndex, groupId lib.GroupId) error {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		return internal.ChipErrorNotFound
+	}
+	for i := range state.mGroupKeys {
+		if state.mGroupKeys[i].GroupId == groupId {
+			state.mGroupKeys = append(state.mGroupKeys[:i], state.mGroupKeys[i+1:]...)
+			return g.saveFabricLocked(fabricIndex)
+		}
+	}
+	return internal.ChipErrorNotFound
+}
+
+func (g *GroupDataProviderImpl) RemoveGroupKeys(fabricIndex lib.FabricIndex) error {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil || len(state.mGroupKeys) == 0 {
+		return nil
+	}
+	state.mGroupKeys = nil
+	return g.saveFabricLocked(fabricIndex)
+}
+
+func (g *GroupDataProviderImpl) SetKeySet(fabricIndex lib.FabricIndex, compressedFabricId lib.CompressedFabricId, keySet KeySet) error {
+	if !fabricIndex.IsValidFabricIndex() || len(keySet.EpochKeys) == 0 || len(keySet.EpochKeys) > KEpochKeysMax ||
+		keySet.Policy > SecurityPolicyCacheAndSync {
+		return internal.ChipErrorInvalidArgument
+	}
+	operational := KeySet{KeySetId: keySet.KeySetId, Policy: keySet.Policy, EpochKeys: make([]EpochKey, len(keySet.EpochKeys))}
+	for i, epochKey := range keySet.EpochKeys {
+		key, err := DeriveGroupOperationalKey(epochKey.Key[:], compressedFabricId)
+		if err != nil {
+			return err
+		}
+		operational.EpochKeys[i].StartTime = epochKey.StartTime
+		copy(operational.EpochKeys[i].Key[:], key)
+	}
+	stored, err := newStoredKeySet(operational)
+	if err != nil {
+		return err
+	}
+
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.getOrCreateFabricLocked(fabricIndex)
+	if _, ok := state.mKeySets[keySet.KeySetId]; !ok && len(state.mKeySets) >= KMaxKeySetsPerFabric {
+		return internal.ChipErrorNoMemory
+	}
+	state.mKeySets[keySet.KeySetId] = stored
+	if g.mStorage != nil {
+		if err = g.writeLocked(storage.FabricKeyset(uint8(fabricIndex), keySet.KeySetId), keySetToData(stored.mKeySet)); err != nil {
+			return err
+		}
+	}
+	return g.saveFabricLocked(fabricIndex)
+}
+
+func (g *GroupDataProviderImpl) GetKeySet(fabricIndex lib.FabricIndex, keySetId uint16) (KeySet, error) {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	if state := g.mFabrics[fabricIndex]; state != nil {
+		if stored, ok := state.mKeySets[keySetId]; ok {
+			return stored.copyKeySet(), nil
+		}
+	}
+	return KeySet{}, internal.ChipErrorKeyNotFound
+}
+
+func (g *GroupDataProviderImpl) GetKeySetIds(fabricIndex lib.FabricIndex) []uint16 {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	if state := g.mFabrics[fabricIndex]; state != nil {
+		return state.keySetIds()
+	}
+	return nil
+}
+
+func (g *GroupDataProviderImpl) RemoveKeySet(fabricIndex lib.FabricIndex, keySetId uint16) error {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		return internal.ChipErrorKeyNotFound
+	}
+	if _, ok := state.mKeySets[keySetId]; !ok {
+		return internal.ChipErrorKeyNotFound
+	}
+	delete(state.mKeySets, keySetId)
+	groupKeys := state.mGroupKeys[:0]
+	for _, groupKey := range state.mGroupKeys {
+		if groupKey.KeySetId != keySetId {
+			groupKeys = append(groupKeys, groupKey)
+		}
+	}
+	state.mGroupKeys = groupKeys
+	if g.mStorage != nil {
+		_ = g.mStorage.ClearValue(storage.FabricKeyset(uint8(fabricIndex), keySetId))
+	}
+	return g.saveFabricLocked(fabricIndex)
+}
+
+func (g *GroupDataProviderImpl) GetIpkKeySet(fabricIndex lib.FabricIndex) (KeySet, error) {
+	return g.GetKeySet(fabricIndex, KIdentityProtectionKeySetId)
+}
+
+// GetCurrentGroupSession 当前秘钥是已经生效的纪元秘钥中开始时间最晚的一个，都没有生效时使用最早的一个
+func (g *GroupDataProviderImpl) GetCurrentGroupSession(fabricIndex lib.FabricIndex, groupId lib.GroupId) (GroupSession, error) {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		return GroupSession{}, internal.ChipErrorKeyNotFound
+	}
+	for _, groupKey := range state.mGroupKeys {
+		if groupKey.GroupId != groupId {
+			continue
+		}
+		stored, ok := state.mKeySets[groupKey.KeySetId]
+		if !ok {
+			return GroupSession{}, internal.ChipErrorKeyNotFound
+		}
+		now := toEpochKeyTime(g.mNow())
+		current := 0
+		for i, epochKey := range stored.mKeySet.EpochKeys {
+			if epochKey.StartTime <= now {
+				current = i
+			}
+		}
+		return stored.groupSession(fabricIndex, groupId, current), nil
+	}
+	return GroupSession{}, internal.ChipErrorKeyNotFound
+}
+
+func (g *GroupDataProviderImpl) GetGroupSessions(sessionId uint16) []GroupSession {
+	g.mMutex.Lock()
+	defer g.mMutex.Unlock()
+	fabricIndices := make([]lib.FabricIndex, 0, len(g.mFabrics))
+	for fabricIndex := range g.mFabrics {
+		fabricIndices = append(fabricIndices, fabricIndex)
+	}
+	sort.Slice(fabricIndices, func(i, j int) bool { return fabricIndices[i] < fabricIndices[j] })
+
+	var sessions []GroupSession
+	for _, fabricIndex := range fabricIndices {
+		state := g.mFabrics[fabricIndex]
+		for _, groupKey := range state.mGroupKeys {
+			stored, ok := state.mKeySets[groupKey.KeySetId]
+			if !ok {
+				continue
+			}
+			for i, id := range stored.mSessionIds {
+				if id == sessionId {
+					sessions = append(sessions, stored.groupSession(fabricIndex, groupKey.GroupId, i))
+				}
+			}
+		}
+	}
+	return sessions
+}
+
+func (g *GroupDataProviderImpl) RemoveFabric(fabricIndex lib.FabricIndex) error {
+	g.mMutex.Lock()
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		g.mMutex.Unlock()
+		return nil
+	}
+	var events []groupEvent
+	for i := range state.mGroups {
+		events = append(events, groupEvent{mFabricIndex: fabricIndex, mGroup: state.mGroups[i].info()})
+	}
+	delete(g.mFabrics, fabricIndex)
+	var err error
+	if g.mStorage != nil {
+		for keySetId := range state.mKeySets {
+			_ = g.mStorage.ClearValue(storage.FabricKeyset(uint8(fabricIndex), keySetId))
+		}
+		if g.mStorage.HasValue(storage.FabricGroups(uint8(fabricIndex))) {
+			_ = g.mStorage.ClearValue(storage.FabricGroups(uint8(fabricIndex)))
+		}
+		err = g.saveFabricListLocked()
+	}
+	g.mMutex.Unlock()
+	g.notify(events)
+	return err
+}
+
+func (g *GroupDataProviderImpl) getOrCreateFabricLocked(fabricIndex lib.FabricIndex) *fabricGroupState {
+	state := g.mFabrics[fabricIndex]
+	if state == nil {
+		state = newFabricGroupState()
+		g.mFabrics[fabricIndex] = state
+	}
+	return state
+}
+
+// saveFabricLocked 保存 Fabric 的组信息、组秘钥映射和 KeySet 列表，以及 Fabric 列表
+func (g *GroupDataProviderImpl) saveFabricLocked(fabricIndex lib.FabricIndex) error {
+	if g.mStorage == nil {
+		return nil
+	}
+	state := g.mFabrics[fabricIndex]
+	data := fabricGroupsData{Groups: state.mGroups, KeySetIds: state.keySetIds()}
+	for _, groupKey := range state.mGroupKeys {
+		data.GroupKeys = append(data.GroupKeys, groupKeyData{GroupId: uint16(groupKey.GroupId), KeySetId: groupKey.KeySetId})
+	}
+	if err := g.writeLocked(storage.FabricGroups(uint8(fabricIndex)), &data); err != nil {
+		return err
+	}
+	return g.saveFabricListLocked()
+}
+
+func (g *GroupDataProviderImpl) saveFabricListLocked() error {
+	var fabricList groupFabricList
+	for fabricIndex := range g.mFabrics {
+		fabricList.FabricIndices = append(fabricList.FabricIndices, uint16(fabricIndex))
+	}
+	sort.Slice(fabricList.FabricIndices, func(i, j int) bool { return fabricList.FabricIndices[i] < fabricList.FabricIndices[j] })
+	return g.writeLocked(storage.GroupFabricList(), &fabricList)
+}
+
+func (g *GroupDataProviderImpl) readLocked(key string, value any) error {
+	if !g.mStorage.HasValue(key) {
+		return internal.ChipErrorPersistedStorageValueNotFound
+	}
+	data, err := g.mStorage.ReadValueBin(key)
+	if err != nil {
+		return err
+	}
+	return tlv.Unmarshal(data, value)
+}
+
+func (g *GroupDataProviderImpl) writeLocked(key string, value any) error {
+	data, err := tlv.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return g.mStorage.WriteValueBin(key, data)
+}
+
+// notify 在释放锁之后通知监听者，监听者可以再调用 GroupDataProvider
+func (g *GroupDataProviderImpl) notify(events []groupEvent) {
+	if len(events) == 0 {
+		return
+	}
+	g.mMutex.Lock()
+	listener := g.mListener
+	g.mMutex.Unlock()
+	if listener == nil {
+		return
+	}
+	for _, event := range events {
+		if event.mAdded {
+			listener.OnGroupAdded(event.mFabricIndex, event.mGroup)
+		} else {
+			listener.OnGroupRemoved(event.mFabricIndex, event.mGroup)
+		}
+	}
+}
+
+func newFabricGroupState() *fabricGroupState {
+	return &fabricGroupState{mKeySets: make(map[uint16]*storedKeySet)}
+}
+
+func (s *fabricGroupState) findGroup(groupId lib.GroupId) *groupData {
+	for i := range s.mGroups {
+		if lib.GroupId(s.mGroups[i].GroupId) == groupId {
+			return &s.mGroups[i]
+		}
+	}
 	return nil
 }
+
+func (s *fabricGroupState) removeGroup(fabricIndex lib.FabricIndex, groupId lib.GroupId) groupEvent {
+	for i := range s.mGroups {
+		if lib.GroupId(s.mGroups[i].GroupId) == groupId {
+			event := groupEvent{mFabricIndex: fabricIndex, mGroup: s.mGroups[i].info()}
+			s.mGroups = append(s.mGroups[:i], s.mGroups[i+1:]...)
+			return event
+		}
+	}
+	return groupEvent{}
+}
+
+// removeEndpoint 组没有端点之后删除组
+func (s *fabricGroupState) removeEndpoint(fabricIndex lib.FabricIndex, group *groupData, endpointId lib.EndpointId) []groupEvent {
+	for i, id := range group.Endpoints {
+		if lib.EndpointId(id) == endpointId {
+			group.Endpoints = append(group.Endpoints[:i], group.Endpoints[i+1:]...)
+			break
+		}
+	}
+	if len(group.Endpoints) != 0 {
+		return nil
+	}
+	return []groupEvent{s.removeGroup(fabricIndex, lib.GroupId(group.GroupId))}
+}
+
+func (s *fabricGroupState) keySetIds() []uint16 {
+	ids := make([]uint16, 0, len(s.mKeySets))
+	for id := range s.mKeySets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (g *groupData) info() GroupInfo {
+	return GroupInfo{GroupId: lib.GroupId(g.GroupId), Name: g.Name}
+}
+
+func (g *groupData) hasEndpoint(endpointId lib.EndpointId) bool {
+	for _, id := range g.Endpoints {
+		if lib.EndpointId(id) == endpointId {
+			return true
+		}
+	}
+	return false
+}
+
+// newStoredKeySet 按开始时间排序纪元秘钥，GetCurrentGroupSession 依赖这个顺序，开始时间相同的秘钥无法区分，返回错误
+func newStoredKeySet(keySet KeySet) (*storedKeySet, error) {
+	keySet.EpochKeys = append([]EpochKey(nil), keySet.EpochKeys...)
+	sort.Slice(keySet.EpochKeys, func(i, j int) bool { return keySet.EpochKeys[i].StartTime < keySet.EpochKeys[j].StartTime })
+	for i := 1; i < len(keySet.EpochKeys); i++ {
+		if keySet.EpochKeys[i].StartTime == keySet.EpochKeys[i-1].StartTime {
+			return nil, internal.ChipErrorInvalidArgument
+		}
+	}
+	stored := &storedKeySet{mKeySet: keySet, mSessionIds: make([]uint16, len(keySet.EpochKeys))}
+	for i, epochKey := range keySet.EpochKeys {
+		sessionId, err := DeriveGroupSessionId(epochKey.Key[:])
+		if err != nil {
+			return nil, err
+		}
+		stored.mSessionIds[i] = sessionId
+	}
+	return stored, nil
+}
+
+func (s *storedKeySet) copyKeySet() KeySet {
+	keySet := s.mKeySet
+	keySet.EpochKeys = append([]EpochKey(nil), s.mKeySet.EpochKeys...)
+	return keySet
+}
+
+func (s *storedKeySet) groupSession(fabricIndex lib.FabricIndex, groupId lib.GroupId, index int) GroupSession {
+	return GroupSession{
+		FabricIndex:    fabricIndex,
+		GroupId:        groupId,
+		SecurityPolicy: s.mKeySet.Policy,
+		SessionId:      s.mSessionIds[index],
+		Key:            s.mKeySet.EpochKeys[index].Key,
+	}
+}
+
+func keySetToData(keySet KeySet) *keySetData {
+	data := &keySetData{KeySetId: keySet.KeySetId, Policy: uint8(keySet.Policy)}
+	for _, epochKey := range keySet.EpochKeys {
+		data.EpochKeys = append(data.EpochKeys, epochKeyData{StartTime: epochKey.StartTime, Key: append([]byte(nil), epochKey.Key[:]...)})
+	}
+	return data
+}
+
+func keySetFromData(data keySetData) KeySet {
+	keySet := KeySet{KeySetId: data.KeySetId, Policy: SecurityPolicy(data.Policy), EpochKeys: make([]EpochKey, len(data.EpochKeys))}
+	for i, epochKey := range data.EpochKeys {
+		keySet.EpochKeys[i].StartTime = epochKey.StartTime
+		copy(keySet.EpochKeys[i].Key[:], epochKey.Key)
+	}
+	return keySet
+}
+
+// toEpochKeyTime 纪元秘钥的开始时间为 Matter 纪元的微秒数
+func toEpochKeyTime(t time.Time) uint64 {
+	microseconds := t.UnixMicro() - certs.KChipEpochSecondsSinceUnixEpoch*1000000
+	if microseconds < 0 {
+		return 0
+	}
+	return uint64(microseconds)
+}
+
+// DeriveGroupOperationalKey 运行组秘钥 = HKDF(纪元秘钥, 压缩FabricID, "GroupKey v1.0")
+func DeriveGroupOperationalKey(epochKey []byte, compressedFabricId lib.CompressedFabricId) ([]byte, error) {
+	if len(epochKey) != KGroupKeyLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	var salt [8]byte
+	binary.BigEndian.PutUint64(salt[:], uint64(compressedFabricId))
+	return crypto.HKDFSHA256(epochKey, salt[:], kGroupKeyInfo, KGroupKeyLength)
+}
+
+// DeriveGroupSessionId 组会话ID = HKDF(运行组秘钥, [], "GroupKeyHash") 的前两个字节
+func DeriveGroupSessionId(operationalKey []byte) (uint16, error) {
+	if len(operationalKey) != KGroupKeyLength {
+		return 0, internal.ChipErrorInvalidArgument
+	}
+	hash, err := crypto.HKDFSHA256(operationalKey, nil, kGroupKeyHashInfo, 2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(hash), nil
+}
+
+// DeriveGroupPrivacyKey 组消息的隐私秘钥 = HKDF(运行组秘钥, [], "PrivacyKey")
+func DeriveGroupPrivacyKey(operationalKey []byte) ([]byte, error) {
+	if len(operationalKey) != KGroupKeyLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return crypto.HKDFSHA256(operationalKey, nil, kGroupPrivacyKeyInfo, KGroupKeyLength)
+}
@@ -1,16 +1,11 @@
 package credentials
 
-type GroupDataProviderListener interface {
-	Init(s ServerDelegate) error
-}
-
-type GroupDataProviderListenerImpl struct {
-}
+import "github.com/galenliu/chip/lib"
 
-func (g GroupDataProviderListenerImpl) Init(s ServerDelegate) error {
-	return nil
-}
-
-func NewGroupDataProviderListenerImpl() *GroupDataProviderListenerImpl {
-	return &GroupDataProviderListenerImpl{}
+// GroupDataProviderListener 组成员变化时的回调，在 GroupDataProvider 释放锁之后调用
+type GroupDataProviderListener interface {
+	// OnGroupAdded 新增组，通过 SetGroupInfo 或者向不存在的组添加端点
+	OnGroupAdded(fabricIndex lib.FabricIndex, group GroupInfo)
+	// OnGroupRemoved 删除组，包括组的最后一个端点被删除以及Fabric被删除
+	OnGroupRemoved(fabricIndex lib.FabricIndex, group GroupInfo)
 }
@@ -0,0 +1,363 @@
+package credentials
+
+import (
+	"bytes"
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/storage"
+	"testing"
+	"time"
+)
+
+const testCompressedFabricId lib.CompressedFabricId = 0x87e1b004e235a130
+
+type testGroupEvent struct {
+	fabricIndex lib.FabricIndex
+	group       GroupInfo
+	added       bool
+}
+
+// testGroupListener 记录回调，并在回调中再调用 GroupDataProvider 以检查没有持有锁
+type testGroupListener struct {
+	provider *GroupDataProviderImpl
+	events   []testGroupEvent
+}
+
+func (l *testGroupListener) OnGroupAdded(fabricIndex lib.FabricIndex, group GroupInfo) {
+	l.provider.GetGroupInfos(fabricIndex)
+	l.events = append(l.events, testGroupEvent{fabricIndex, group, true})
+}
+
+func (l *testGroupListener) OnGroupRemoved(fabricIndex lib.FabricIndex, group GroupInfo) {
+	l.provider.GetGroupInfos(fabricIndex)
+	l.events = append(l.events, testGroupEvent{fabricIndex, group, false})
+}
+
+func newTestGroupDataProvider(t *testing.T, delegate storage.StorageDelegate) *GroupDataProviderImpl {
+	t.Helper()
+	provider := NewGroupDataProviderImpl()
+	provider.SetStorageDelegate(delegate)
+	if err := provider.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func testEpochKey(startTime uint64, b byte) EpochKey {
+	key := EpochKey{StartTime: startTime}
+	for i := range key.Key {
+		key.Key[i] = b + byte(i)
+	}
+	return key
+}
+
+func TestDeriveGroupOperationalKey(t *testing.T) {
+	epochKey := testEpochKey(0, 0xd0).Key
+	key, err := DeriveGroupOperationalKey(epochKey[:], testCompressedFabricId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := crypto.HKDFSHA256(epochKey[:], []byte{0x87, 0xe1, 0xb0, 0x04, 0xe2, 0x35, 0xa1, 0x30}, []byte("GroupKey v1.0"), KGroupKeyLength)
+	if !bytes.Equal(key, expected) {
+		t.Errorf("unexpected operational key %x", key)
+	}
+	if other, _ := DeriveGroupOperationalKey(epochKey[:], testCompressedFabricId+1); bytes.Equal(key, other) {
+		t.Error("operational key must depend on the compressed fabric id")
+	}
+	sessionId, err := DeriveGroupSessionId(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := crypto.HKDFSHA256(key, nil, []byte("GroupKeyHash"), 2)
+	if sessionId != uint16(hash[0])<<8|uint16(hash[1]) {
+		t.Errorf("unexpected session id 0x%04X", sessionId)
+	}
+	if _, err = DeriveGroupOperationalKey(epochKey[:8], testCompressedFabricId); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("short epoch key must fail, got %v", err)
+	}
+}
+
+func TestGroupDataProviderGroupsAndEndpoints(t *testing.T) {
+	provider := newTestGroupDataProvider(t, nil)
+	listener := &testGroupListener{provider: provider}
+	provider.SetListener(listener)
+
+	if err := provider.SetGroupInfo(1, GroupInfo{GroupId: 0x101, Name: "Kitchen"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.SetGroupInfo(1, GroupInfo{GroupId: 0x101, Name: "Living Room"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.SetGroupInfo(1, GroupInfo{GroupId: 0x102, Name: "a very long group name"}); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("long name must fail, got %v", err)
+	}
+	if info, err := provider.GetGroupInfo(1, 0x101); err != nil || info.Name != "Living Room" {
+		t.Errorf("unexpected group info %+v, %v", info, err)
+	}
+
+	if err := provider.AddEndpoint(1, 0x101, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.AddEndpoint(1, 0x102, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.AddEndpoint(1, 0x102, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !provider.HasEndpoint(1, 0x102, 2) || provider.HasEndpoint(2, 0x102, 2) {
+		t.Error("HasEndpoint mismatch")
+	}
+	if endpoints := provider.GetEndpoints(1); len(endpoints) != 3 {
+		t.Errorf("expected 3 endpoints, got %v", endpoints)
+	}
+
+	if err := provider.RemoveEndpoint(1, 0x102, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.RemoveEndpoint(1, 0x102, 2); err != internal.ChipErrorNotFound {
+		t.Errorf("removing a missing endpoint must fail, got %v", err)
+	}
+	if err := provider.RemoveEndpointAllGroups(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if infos := provider.GetGroupInfos(1); len(infos) != 0 {
+		t.Errorf("groups without endpoints must be removed, got %v", infos)
+	}
+
+	expected := []testGroupEvent{
+		{1, GroupInfo{GroupId: 0x101, Name: "Kitchen"}, true},
+		{1, GroupInfo{GroupId: 0x102}, true},
+		{1, GroupInfo{GroupId: 0x101, Name: "Living Room"}, false},
+		{1, GroupInfo{GroupId: 0x102}, false},
+	}
+	if len(listener.events) != len(expected) {
+		t.Fatalf("unexpected events %+v", listener.events)
+	}
+	for i := range expected {
+		if listener.events[i] != expected[i] {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], listener.events[i])
+		}
+	}
+}
+
+func TestGroupDataProviderLimits(t *testing.T) {
+	provider := newTestGroupDataProvider(t, nil)
+	for i := 1; i <= KMaxGroupsPerFabric; i++ {
+		if err := provider.AddEndpoint(1, lib.GroupId(i), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := provider.AddEndpoint(1, KMaxGroupsPerFabric+1, 1); err != internal.ChipErrorNoMemory {
+		t.Errorf("expected NoMemory, got %v", err)
+	}
+	if err := provider.AddEndpoint(2, KMaxGroupsPerFabric+1, 1); err != nil {
+		t.Errorf("limits are per fabric, got %v", err)
+	}
+
+	for i := 0; i < KMaxKeySetsPerFabric; i++ {
+		keySet := KeySet{KeySetId: uint16(i), EpochKeys: []EpochKey{testEpochKey(0, byte(i))}}
+		if err := provider.SetKeySet(1, testCompressedFabricId, keySet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keySet := KeySet{KeySetId: KMaxKeySetsPerFabric, EpochKeys: []EpochKey{testEpochKey(0, 0)}}
+	if err := provider.SetKeySet(1, testCompressedFabricId, keySet); err != internal.ChipErrorNoMemory {
+		t.Errorf("expected NoMemory, got %v", err)
+	}
+	keySet.EpochKeys = make([]EpochKey, KEpochKeysMax+1)
+	if err := provider.SetKeySet(2, testCompressedFabricId, keySet); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("too many epoch keys must fail, got %v", err)
+	}
+	if err := provider.SetGroupKey(1, GroupKey{GroupId: 1, KeySetId: KIdentityProtectionKeySetId}); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("IPK must not be mapped to a group, got %v", err)
+	}
+}
+
+func TestGroupDataProviderPersistence(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	provider := newTestGroupDataProvider(t, kvs)
+	if err := provider.SetGroupInfo(1, GroupInfo{GroupId: 0x101, Name: "Kitchen"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.AddEndpoint(1, 0x101, 3); err != nil {
+		t.Fatal(err)
+	}
+	ipk := KeySet{KeySetId: KIdentityProtectionKeySetId, EpochKeys: []EpochKey{testEpochKey(0, 0x10)}}
+	if err := provider.SetKeySet(1, testCompressedFabricId, ipk); err != nil {
+		t.Fatal(err)
+	}
+	keySet := KeySet{KeySetId: 0x1a, Policy: SecurityPolicyCacheAndSync, EpochKeys: []EpochKey{testEpochKey(200, 0x20), testEpochKey(100, 0x30)}}
+	if err := provider.SetKeySet(1, testCompressedFabricId, keySet); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.SetGroupKey(1, GroupKey{GroupId: 0x101, KeySetId: 0x1a}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newTestGroupDataProvider(t, kvs)
+	if info, err := reloaded.GetGroupInfo(1, 0x101); err != nil || info.Name != "Kitchen" {
+		t.Errorf("unexpected group info %+v, %v", info, err)
+	}
+	if !reloaded.HasEndpoint(1, 0x101, 3) {
+		t.Error("endpoint was not persisted")
+	}
+	if keys := reloaded.GetGroupKeys(1); len(keys) != 1 || keys[0] != (GroupKey{GroupId: 0x101, KeySetId: 0x1a}) {
+		t.Errorf("unexpected group keys %v", keys)
+	}
+	if ids := reloaded.GetKeySetIds(1); len(ids) != 2 || ids[0] != 0 || ids[1] != 0x1a {
+		t.Errorf("unexpected keyset ids %v", ids)
+	}
+	stored, err := reloaded.GetKeySet(1, 0x1a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := provider.GetKeySet(1, 0x1a)
+	if stored.Policy != SecurityPolicyCacheAndSync || len(stored.EpochKeys) != 2 || stored.EpochKeys[0] != expected.EpochKeys[0] ||
+		stored.EpochKeys[1] != expected.EpochKeys[1] || stored.EpochKeys[0].StartTime != 100 {
+		t.Errorf("unexpected keyset %+v", stored)
+	}
+	operationalIpk, _ := DeriveGroupOperationalKey(ipk.EpochKeys[0].Key[:], testCompressedFabricId)
+	if got, err := reloaded.GetIpkKeySet(1); err != nil || !bytes.Equal(got.EpochKeys[0].Key[:], operationalIpk) {
+		t.Errorf("unexpected IPK %+v, %v", got, err)
+	}
+
+	if err = reloaded.RemoveKeySet(1, 0x1a); err != nil {
+		t.Fatal(err)
+	}
+	if keys := reloaded.GetGroupKeys(1); len(keys) != 0 {
+		t.Errorf("removing a keyset must remove its group keys, got %v", keys)
+	}
+	if kvs.HasValue(storage.FabricKeyset(1, 0x1a)) {
+		t.Error("keyset was not cleared from storage")
+	}
+}
+
+func TestGroupDataProviderGroupSessions(t *testing.T) {
+	provider := newTestGroupDataProvider(t, nil)
+	keySet := KeySet{KeySetId: 1, EpochKeys: []EpochKey{testEpochKey(1000, 0x40), testEpochKey(2000, 0x50), testEpochKey(3000, 0x60)}}
+	if err := provider.SetKeySet(1, testCompressedFabricId, keySet); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.SetGroupKey(1, GroupKey{GroupId: 0x200, KeySetId: 1}); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := provider.GetKeySet(1, 1)
+
+	at := func(microseconds int64) time.Time {
+		return time.UnixMicro(certs.KChipEpochSecondsSinceUnixEpoch*1000000 + microseconds)
+	}
+	for _, tc := range []struct {
+		now      int64
+		expected int
+	}{{500, 0}, {1000, 0}, {2500, 1}, {5000, 2}} {
+		provider.mNow = func() time.Time { return at(tc.now) }
+		session, err := provider.GetCurrentGroupSession(1, 0x200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Key != stored.EpochKeys[tc.expected].Key {
+			t.Errorf("at %d expected epoch key %d", tc.now, tc.expected)
+		}
+		sessions := provider.GetGroupSessions(session.SessionId)
+		if len(sessions) != 1 || sessions[0] != session {
+			t.Errorf("GetGroupSessions(0x%04X) = %+v", session.SessionId, sessions)
+		}
+	}
+	if _, err := provider.GetCurrentGroupSession(1, 0x201); err != internal.ChipErrorKeyNotFound {
+		t.Errorf("group without key must fail, got %v", err)
+	}
+}
+
+func TestGroupDataProviderEpochKeyOrder(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	provider := newTestGroupDataProvider(t, kvs)
+	at := func(microseconds int64) time.Time {
+		return time.UnixMicro(certs.KChipEpochSecondsSinceUnixEpoch*1000000 + microseconds)
+	}
+	provider.mNow = func() time.Time { return at(2500) }
+
+	// 乱序写入的纪元秘钥按开始时间排序，当前秘钥是开始时间为 2000 的秘钥
+	keySet := KeySet{KeySetId: 1, EpochKeys: []EpochKey{testEpochKey(3000, 0x60), testEpochKey(1000, 0x40), testEpochKey(2000, 0x50)}}
+	if err := provider.SetKeySet(1, testCompressedFabricId, keySet); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.SetGroupKey(1, GroupKey{GroupId: 0x200, KeySetId: 1}); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := provider.GetKeySet(1, 1)
+	if stored.EpochKeys[0].StartTime != 1000 || stored.EpochKeys[1].StartTime != 2000 || stored.EpochKeys[2].StartTime != 3000 {
+		t.Fatalf("epoch keys must be sorted by start time, got %+v", stored.EpochKeys)
+	}
+	expected, _ := DeriveGroupOperationalKey(keySet.EpochKeys[2].Key[:], testCompressedFabricId)
+	if session, err := provider.GetCurrentGroupSession(1, 0x200); err != nil || !bytes.Equal(session.Key[:], expected) {
+		t.Errorf("current session must use the latest started key, got %v", err)
+	}
+
+	duplicated := KeySet{KeySetId: 2, EpochKeys: []EpochKey{testEpochKey(1000, 0x40), testEpochKey(1000, 0x50)}}
+	if err := provider.SetKeySet(1, testCompressedFabricId, duplicated); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("epoch keys with the same start time must be rejected, got %v", err)
+	}
+
+	// 存储中乱序的纪元秘钥在恢复时同样被排序
+	unsorted := keySetToData(KeySet{KeySetId: 1, EpochKeys: []EpochKey{stored.EpochKeys[2], stored.EpochKeys[0], stored.EpochKeys[1]}})
+	data, err := tlv.Marshal(unsorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = kvs.WriteValueBin(storage.FabricKeyset(1, 1), data); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := newTestGroupDataProvider(t, kvs)
+	reloaded.mNow = provider.mNow
+	if session, err := reloaded.GetCurrentGroupSession(1, 0x200); err != nil || !bytes.Equal(session.Key[:], expected) {
+		t.Errorf("restored epoch keys must be sorted, got %v", err)
+	}
+}
+
+func TestGroupDataProviderRemoveFabric(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	provider := newTestGroupDataProvider(t, kvs)
+	listener := &testGroupListener{provider: provider}
+	provider.SetListener(listener)
+	for _, fabricIndex := range []lib.FabricIndex{1, 2} {
+		if err := provider.AddEndpoint(fabricIndex, 0x101, 1); err != nil {
+			t.Fatal(err)
+		}
+		keySet := KeySet{KeySetId: 1, EpochKeys: []EpochKey{testEpochKey(0, 0x70)}}
+		if err := provider.SetKeySet(fabricIndex, testCompressedFabricId, keySet); err != nil {
+			t.Fatal(err)
+		}
+		if err := provider.SetGroupKey(fabricIndex, GroupKey{GroupId: 0x101, KeySetId: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listener.events = nil
+
+	if err := provider.RemoveFabric(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(listener.events) != 1 || listener.events[0] != (testGroupEvent{1, GroupInfo{GroupId: 0x101}, false}) {
+		t.Errorf("unexpected events %+v", listener.events)
+	}
+	if kvs.HasValue(storage.FabricGroups(1)) || kvs.HasValue(storage.FabricKeyset(1, 1)) {
+		t.Error("fabric data was not cleared from storage")
+	}
+
+	reloaded := newTestGroupDataProvider(t, kvs)
+	if infos := reloaded.GetGroupInfos(1); len(infos) != 0 {
+		t.Errorf("fabric 1 must have no groups, got %v", infos)
+	}
+	if !reloaded.HasEndpoint(2, 0x101, 1) {
+		t.Error("fabric 2 groups must be kept")
+	}
+	session, err := reloaded.GetCurrentGroupSession(2, 0x101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions := reloaded.GetGroupSessions(session.SessionId); len(sessions) != 1 || sessions[0].FabricIndex != 2 {
+		t.Errorf("unexpected sessions %+v", sessions)
+	}
+}
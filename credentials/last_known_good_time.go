@@ -0,0 +1,156 @@
+package credentials
+
+import (
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/storage"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+type lastKnownGoodTimeData struct {
+	LastKnownGoodChipEpochTime uint32 `tlv:"1"`
+}
+
+// LastKnownGoodTime 最后已知的正确时间，供没有实时时钟的设备检查证书有效期。
+// 时间不会早于固件的编译时间，UpdatePending 只在内存中推进，Commit 后才写入存储
+type LastKnownGoodTime struct {
+	mMutex                      sync.Mutex
+	mStorage                    storage.PersistentStorageDelegate
+	mFirmwareBuildChipEpochTime uint32
+	mLastKnownGoodChipEpochTime uint32
+	mInitialized                bool
+}
+
+func NewLastKnownGoodTime() *LastKnownGoodTime {
+	return &LastKnownGoodTime{}
+}
+
+// Init 从存储中加载最后已知的正确时间，没有保存过或者早于固件编译时间时使用固件编译时间
+func (l *LastKnownGoodTime) Init(delegate storage.PersistentStorageDelegate, firmwareBuildTime time.Time) error {
+	if delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	l.mMutex.Lock()
+	defer l.mMutex.Unlock()
+	l.mStorage = delegate
+	l.mFirmwareBuildChipEpochTime = 0
+	if !firmwareBuildTime.IsZero() {
+		buildTime, err := certs.TimeToChipEpoch(firmwareBuildTime)
+		if err != nil {
+			return err
+		}
+		l.mFirmwareBuildChipEpochTime = buildTime
+	}
+	stored, err := l.loadLocked()
+	if err != nil && err != internal.ChipErrorPersistedStorageValueNotFound {
+		return err
+	}
+	l.mInitialized = true
+	if err == nil && stored >= l.mFirmwareBuildChipEpochTime {
+		l.mLastKnownGoodChipEpochTime = stored
+		return nil
+	}
+	log.Infof("LastKnownGoodTime: setting to firmware build time %v", certs.ChipEpochToTime(l.mFirmwareBuildChipEpochTime))
+	l.mLastKnownGoodChipEpochTime = l.mFirmwareBuildChipEpochTime
+	return l.storeLocked(l.mLastKnownGoodChipEpochTime)
+}
+
+func (l *LastKnownGoodTime) GetLastKnownGoodChipEpochTime() (time.Time, error) {
+	l.mMutex.Lock()
+	defer l.mMutex.Unlock()
+	if !l.mInitialized {
+		return time.Time{}, internal.ChipErrorIncorrectState
+	}
+	return certs.ChipEpochToTime(l.mLastKnownGoodChipEpochTime), nil
+}
+
+// SetLastKnownGoodChipEpochTime 设置并保存最后已知的正确时间，可以向后调整，
+// 但不能早于固件编译时间和 notBeforeCutoff（所有 Fabric 证书中最晚的 notBefore）
+func (l *LastKnownGoodTime) SetLastKnownGoodChipEpochTime(lastKnownGoodTime time.Time, notBeforeCutoff time.Time) error {
+	l.mMutex.Lock()
+	defer l.mMutex.Unlock()
+	if !l.mInitialized {
+		return internal.ChipErrorIncorrectState
+	}
+	value, err := certs.TimeToChipEpoch(lastKnownGoodTime)
+	if err != nil {
+		return err
+	}
+	if value < l.mFirmwareBuildChipEpochTime || lastKnownGoodTime.Before(notBeforeCutoff) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if err = l.storeLocked(value); err != nil {
+		return err
+	}
+	l.mLastKnownGoodChipEpochTime = value
+	return nil
+}
+
+// UpdatePendingLastKnownGoodChipEpochTime 在内存中把时间推进到 lastKnownGoodTime，比当前的值早时不做修改
+func (l *LastKnownGoodTime) UpdatePendingLastKnownGoodChipEpochTime(lastKnownGoodTime time.Time) error {
+	l.mMutex.Lock()
+	defer l.mMutex.Unlock()
+	if !l.mInitialized {
+		return internal.ChipErrorIncorrectState
+	}
+	value, err := certs.TimeToChipEpoch(lastKnownGoodTime)
+	if err != nil {
+		return err
+	}
+	if value > l.mLastKnownGoodChipEpochTime {
+		l.mLastKnownGoodChipEpochTime = value
+	}
+	return nil
+}
+
+// CommitPendingLastKnownGoodChipEpochTime 保存内存中的时间
+func (l *LastKnownGoodTime) CommitPendingLastKnownGoodChipEpochTime() error {
+	l.mMutex.Lock()
+	defer l.mMutex.Unlock()
+	if !l.mInitialized {
+		return internal.ChipErrorIncorrectState
+	}
+	return l.storeLocked(l.mLastKnownGoodChipEpochTime)
+}
+
+// RevertPendingLastKnownGoodChipEpochTime 放弃没有保存的修改，恢复为存储中的时间
+func (l *LastKnownGoodTime) RevertPendingLastKnownGoodChipEpochTime() error {
+	l.mMutex.Lock()
+	defer l.mMutex.Unlock()
+	if !l.mInitialized {
+		return internal.ChipErrorIncorrectState
+	}
+	stored, err := l.loadLocked()
+	if err != nil {
+		return err
+	}
+	l.mLastKnownGoodChipEpochTime = stored
+	return nil
+}
+
+func (l *LastKnownGoodTime) loadLocked() (uint32, error) {
+	key := storage.LastKnownGoodTimeKey()
+	if !l.mStorage.SyncDoesKeyExist(key) {
+		return 0, internal.ChipErrorPersistedStorageValueNotFound
+	}
+	value, err := l.mStorage.ReadValueBin(key)
+	if err != nil {
+		return 0, err
+	}
+	var data lastKnownGoodTimeData
+	if err = tlv.Unmarshal(value, &data); err != nil {
+		return 0, err
+	}
+	return data.LastKnownGoodChipEpochTime, nil
+}
+
+func (l *LastKnownGoodTime) storeLocked(value uint32) error {
+	data, err := tlv.Marshal(&lastKnownGoodTimeData{LastKnownGoodChipEpochTime: value})
+	if err != nil {
+		return err
+	}
+	return l.mStorage.WriteValueBin(storage.LastKnownGoodTimeKey(), data)
+}
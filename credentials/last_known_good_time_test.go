@@ -0,0 +1,140 @@
+package credentials
+
+import (
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/storage"
+	"testing"
+	"time"
+)
+
+var testFirmwareBuildTime = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestLastKnownGoodTime(t *testing.T) {
+	delegate := storage.NewInMemoryPersistentStorage()
+	lkgt := NewLastKnownGoodTime()
+	if _, err := lkgt.GetLastKnownGoodChipEpochTime(); err != internal.ChipErrorIncorrectState {
+		t.Errorf("uninitialized time must fail")
+	}
+	if err := lkgt.Init(delegate, testFirmwareBuildTime); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := lkgt.GetLastKnownGoodChipEpochTime(); err != nil || !value.Equal(testFirmwareBuildTime) {
+		t.Errorf("must start at firmware build time, got %v %v", value, err)
+	}
+
+	// 没有提交的推进在 Revert 后恢复
+	later := testFirmwareBuildTime.Add(24 * time.Hour)
+	if err := lkgt.UpdatePendingLastKnownGoodChipEpochTime(later); err != nil {
+		t.Fatal(err)
+	}
+	if err := lkgt.UpdatePendingLastKnownGoodChipEpochTime(testFirmwareBuildTime); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := lkgt.GetLastKnownGoodChipEpochTime(); !value.Equal(later) {
+		t.Errorf("pending time must only advance, got %v", value)
+	}
+	if err := lkgt.RevertPendingLastKnownGoodChipEpochTime(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := lkgt.GetLastKnownGoodChipEpochTime(); !value.Equal(testFirmwareBuildTime) {
+		t.Errorf("revert must restore the stored time, got %v", value)
+	}
+	if err := lkgt.UpdatePendingLastKnownGoodChipEpochTime(later); err != nil {
+		t.Fatal(err)
+	}
+	if err := lkgt.CommitPendingLastKnownGoodChipEpochTime(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新加载时使用保存的时间
+	reloaded := NewLastKnownGoodTime()
+	if err := reloaded.Init(delegate, testFirmwareBuildTime); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := reloaded.GetLastKnownGoodChipEpochTime(); !value.Equal(later) {
+		t.Errorf("committed time must persist, got %v", value)
+	}
+
+	// 不能早于固件编译时间和证书的 notBefore
+	if err := reloaded.SetLastKnownGoodChipEpochTime(testFirmwareBuildTime.Add(-time.Hour), time.Time{}); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("time before firmware build must be rejected, got %v", err)
+	}
+	cutoff := testFirmwareBuildTime.Add(2 * time.Hour)
+	if err := reloaded.SetLastKnownGoodChipEpochTime(testFirmwareBuildTime.Add(time.Hour), cutoff); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("time before certificate notBefore must be rejected, got %v", err)
+	}
+	if err := reloaded.SetLastKnownGoodChipEpochTime(cutoff, cutoff); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := reloaded.GetLastKnownGoodChipEpochTime(); !value.Equal(cutoff) {
+		t.Errorf("set may move the time backwards, got %v", value)
+	}
+
+	// 更新的固件编译时间晚于保存的时间
+	newer := testFirmwareBuildTime.Add(365 * 24 * time.Hour)
+	if err := reloaded.Init(delegate, newer); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := reloaded.GetLastKnownGoodChipEpochTime(); !value.Equal(newer) {
+		t.Errorf("newer firmware build time must win, got %v", value)
+	}
+}
+
+func TestFabricTableValidationEffectiveTime(t *testing.T) {
+	table := NewFabricTable()
+	params := NewFabricTableInitParams()
+	params.Storage = storage.NewInMemoryPersistentStorage()
+	params.FirmwareBuildTime = testFirmwareBuildTime
+	if err := table.Init(params); err != nil {
+		t.Fatal(err)
+	}
+	var context certs.ValidationContext
+	if err := table.SetValidationEffectiveTime(&context); err != nil {
+		t.Fatal(err)
+	}
+	if context.EffectiveTimeIsLastKnownGood || context.EffectiveTime.Before(testFirmwareBuildTime) {
+		t.Errorf("system time after the last known good time must be used")
+	}
+
+	// 系统时钟早于最后已知的正确时间
+	future := time.Now().Add(24 * time.Hour)
+	if err := table.SetLastKnownGoodChipEpochTime(future); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.SetValidationEffectiveTime(&context); err != nil {
+		t.Fatal(err)
+	}
+	if !context.EffectiveTimeIsLastKnownGood || context.EffectiveTime.Unix() != future.Unix() {
+		t.Errorf("last known good time must be used, got %v", context.EffectiveTime)
+	}
+}
+
+func TestCertificateValidityPolicies(t *testing.T) {
+	results := []certs.CertificateValidityResult{
+		certs.CertificateValidityValid,
+		certs.CertificateValidityNotYetValid,
+		certs.CertificateValidityExpired,
+		certs.CertificateValidityNotExpiredAtLastKnownGoodTime,
+		certs.CertificateValidityExpiredAtLastKnownGoodTime,
+		certs.CertificateValidityTimeUnknown,
+	}
+	tests := []struct {
+		name     string
+		policy   CertificateValidityPolicy
+		expected []error
+	}{
+		{"strict", NewStrictCertificateValidityPolicy(), []error{nil, internal.ChipErrorCertNotValidYet, internal.ChipErrorCertExpired,
+			internal.ChipErrorInvalidTime, internal.ChipErrorCertExpired, internal.ChipErrorInvalidTime}},
+		{"ignore expiry", NewIgnoreCertificateExpiryPolicy(), []error{nil, internal.ChipErrorCertNotValidYet, nil, nil, nil, nil}},
+		{"last known good time", NewLastKnownGoodTimeCertificateValidityPolicy(), []error{nil, internal.ChipErrorCertNotValidYet,
+			internal.ChipErrorCertExpired, nil, internal.ChipErrorCertExpired, nil}},
+	}
+	for _, test := range tests {
+		for i, result := range results {
+			if err := test.policy.ApplyCertificateValidityPolicy(&certs.ChipCertificateData{}, 0, result); err != test.expected[i] {
+				t.Errorf("%s: result %d got %v, expected %v", test.name, result, err, test.expected[i])
+			}
+		}
+	}
+}
@@ -1,12 +1,23 @@
 package credentials
 
 import (
+	"github.com/galenliu/chip/credentials/certs"
 	"github.com/galenliu/chip/device"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
 	"github.com/galenliu/chip/storage"
+	"sync"
+)
+
+// 证书链中的证书，用于 GetCertificate 和 HasCertificateForFabric
+const (
+	CertChainElementRcac uint8 = iota
+	CertChainElementIcac
+	CertChainElementNoc
 )
 
 type PersistentStorageOpCertStore interface {
-	Init(delegate storage.StorageDelegate)
+	Init(delegate storage.StorageDelegate) error
 
 	HasPendingRootCert() bool
 	HasPendingNocChain() bool
@@ -29,59 +40,314 @@ type PersistentStorageOpCertStore interface {
 	GetCertificate(fabricIndex device.FabricIndex, element uint8) []byte
 }
 
+// PersistentStorageOpCertStoreImpl 把每个 Fabric 的 RCAC、ICAC 和 NOC 分别保存在存储中。
+// AddTrustedRootCertificate、AddNOC 和 UpdateNOC 添加的证书在 CommitOpCertsForFabric 之前只保存在内存中，
+// 同一时间只能有一个 Fabric 有待提交的证书
 type PersistentStorageOpCertStoreImpl struct {
-	mPersistentStorage storage.StorageDelegate
+	mMutex              sync.Mutex
+	mStorage            storage.StorageDelegate
+	mPendingFabricIndex device.FabricIndex
+	mPendingRcac        []byte
+	mPendingIcac        []byte
+	mPendingNoc         []byte
+
+	mAddedTrustedRoot bool
+	mAddedNewOpCerts  bool
+	mUpdatedOpCerts   bool
 }
 
 func NewPersistentStorageOpCertStoreImpl() *PersistentStorageOpCertStoreImpl {
-	return &PersistentStorageOpCertStoreImpl{}
+	return &PersistentStorageOpCertStoreImpl{mPendingFabricIndex: lib.KUndefinedFabricIndex}
+}
+
+func (s *PersistentStorageOpCertStoreImpl) Init(delegate storage.StorageDelegate) error {
+	if delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage != nil {
+		return internal.ChipErrorIncorrectState
+	}
+	s.mStorage = delegate
+	s.revertPendingLocked()
+	return nil
 }
 
-func (s PersistentStorageOpCertStoreImpl) HasPendingRootCert() bool {
-	return true
+func (s *PersistentStorageOpCertStoreImpl) HasPendingRootCert() bool {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	return s.mAddedTrustedRoot
 }
 
-func (s PersistentStorageOpCertStoreImpl) HasPendingNocChain() bool {
-	return true
+func (s *PersistentStorageOpCertStoreImpl) HasPendingNocChain() bool {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	return s.hasPendingNocChainLocked()
 }
 
-func (s PersistentStorageOpCertStoreImpl) HasCertificateForFabric(fabricIndex device.FabricIndex, element uint8) bool {
-	return true
+// HasCertificateForFabric 优先查询待提交的证书
+func (s *PersistentStorageOpCertStoreImpl) HasCertificateForFabric(fabricIndex device.FabricIndex, element uint8) bool {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	return len(s.getCertificateLocked(fabricIndex, element)) != 0
 }
 
-func (s PersistentStorageOpCertStoreImpl) AddNewTrustedRootCertForFabric(fabricIndex device.FabricIndex, rcac []byte) error {
+// AddNewTrustedRootCertForFabric 对应 AddTrustedRootCertificate，必须在 AddNOC 之前调用，不能用于已有的 Fabric
+func (s *PersistentStorageOpCertStoreImpl) AddNewTrustedRootCertForFabric(fabricIndex device.FabricIndex, rcac []byte) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !isValidCertificate(rcac) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if !fabricIndex.IsValidFabricIndex() {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if s.mAddedTrustedRoot || s.mAddedNewOpCerts || s.mUpdatedOpCerts {
+		return internal.ChipErrorIncorrectState
+	}
+	if s.mStorage.HasValue(storage.FabricRCAC(uint8(fabricIndex))) {
+		return internal.ChipErrorIncorrectState
+	}
+	s.mPendingRcac = append([]byte(nil), rcac...)
+	s.mPendingFabricIndex = fabricIndex
+	s.mAddedTrustedRoot = true
 	return nil
 }
 
-func (s PersistentStorageOpCertStoreImpl) AddNewOpCertsForFabric(fabricIndex device.FabricIndex, noc []byte, icac []byte) error {
+// AddNewOpCertsForFabric 对应 AddNOC，需要同一个 Fabric 有待提交的根证书，icac 可以为空
+func (s *PersistentStorageOpCertStoreImpl) AddNewOpCertsForFabric(fabricIndex device.FabricIndex, noc []byte, icac []byte) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !isValidCertificate(noc) || (len(icac) != 0 && !isValidCertificate(icac)) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if !fabricIndex.IsValidFabricIndex() {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if !s.mAddedTrustedRoot || s.mAddedNewOpCerts || s.mUpdatedOpCerts {
+		return internal.ChipErrorIncorrectState
+	}
+	if fabricIndex != s.mPendingFabricIndex {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if s.mStorage.HasValue(storage.FabricNOC(uint8(fabricIndex))) || s.mStorage.HasValue(storage.FabricICAC(uint8(fabricIndex))) {
+		return internal.ChipErrorIncorrectState
+	}
+	s.mPendingNoc = append([]byte(nil), noc...)
+	s.mPendingIcac = append([]byte(nil), icac...)
+	s.mAddedNewOpCerts = true
 	return nil
 }
 
-func (s PersistentStorageOpCertStoreImpl) UpdateOpCertsForFabric(fabricIndex device.FabricIndex, noc []byte, icac []byte) error {
-	//TODO implement me
-	panic("implement me")
+// UpdateOpCertsForFabric 对应 UpdateNOC，只能用于已提交的 Fabric，根证书保持不变
+func (s *PersistentStorageOpCertStoreImpl) UpdateOpCertsForFabric(fabricIndex device.FabricIndex, noc []byte, icac []byte) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !isValidCertificate(noc) || (len(icac) != 0 && !isValidCertificate(icac)) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if !fabricIndex.IsValidFabricIndex() {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if s.mAddedTrustedRoot || s.mAddedNewOpCerts || s.mUpdatedOpCerts {
+		return internal.ChipErrorIncorrectState
+	}
+	if !s.mStorage.HasValue(storage.FabricRCAC(uint8(fabricIndex))) || !s.mStorage.HasValue(storage.FabricNOC(uint8(fabricIndex))) {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	s.mPendingNoc = append([]byte(nil), noc...)
+	s.mPendingIcac = append([]byte(nil), icac...)
+	s.mPendingFabricIndex = fabricIndex
+	s.mUpdatedOpCerts = true
+	return nil
 }
 
-func (s PersistentStorageOpCertStoreImpl) CommitOpCertsForFabric(fabricIndex device.FabricIndex) error {
+// CommitOpCertsForFabric 保存待提交的证书。写入失败时删除已写入的证书，
+// 中途断电由 FabricTable 的提交标记在下次启动时清理
+func (s *PersistentStorageOpCertStoreImpl) CommitOpCertsForFabric(fabricIndex device.FabricIndex) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !fabricIndex.IsValidFabricIndex() || fabricIndex != s.mPendingFabricIndex {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if !s.hasPendingNocChainLocked() {
+		return internal.ChipErrorIncorrectState
+	}
+	// 新增 Fabric 时根证书和 NOC 链必须一起提交
+	if s.mAddedTrustedRoot != s.mAddedNewOpCerts {
+		return internal.ChipErrorIncorrectState
+	}
+
+	index := uint8(fabricIndex)
+	if s.mAddedTrustedRoot {
+		if err := s.mStorage.WriteValueBin(storage.FabricRCAC(index), s.mPendingRcac); err != nil {
+			s.removeCertsLocked(fabricIndex)
+			s.revertPendingLocked()
+			return err
+		}
+	}
+	// 更新时先写 NOC 再写 ICAC，ICAC 写入失败时恢复原来的 NOC，存储中不会留下新 ICAC 和旧 NOC 组成的证书链
+	var previousNoc []byte
+	if s.mUpdatedOpCerts {
+		noc, err := s.mStorage.ReadValueBin(storage.FabricNOC(index))
+		if err != nil {
+			s.revertPendingLocked()
+			return err
+		}
+		previousNoc = noc
+	}
+	err := s.mStorage.WriteValueBin(storage.FabricNOC(index), s.mPendingNoc)
+	if err == nil {
+		if len(s.mPendingIcac) != 0 {
+			err = s.mStorage.WriteValueBin(storage.FabricICAC(index), s.mPendingIcac)
+		} else if s.mStorage.HasValue(storage.FabricICAC(index)) {
+			err = s.mStorage.ClearValue(storage.FabricICAC(index))
+		}
+		if err != nil && s.mUpdatedOpCerts {
+			_ = s.mStorage.WriteValueBin(storage.FabricNOC(index), previousNoc)
+		}
+	}
+	if err != nil {
+		if s.mAddedNewOpCerts {
+			s.removeCertsLocked(fabricIndex)
+		}
+		s.revertPendingLocked()
+		return err
+	}
+	s.revertPendingLocked()
 	return nil
 }
 
-func (s PersistentStorageOpCertStoreImpl) RemoveOpCertsForFabric(fabricIndex device.FabricIndex) error {
+// RemoveOpCertsForFabric 删除 Fabric 的所有证书，包括待提交的证书
+func (s *PersistentStorageOpCertStoreImpl) RemoveOpCertsForFabric(fabricIndex device.FabricIndex) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !fabricIndex.IsValidFabricIndex() {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if fabricIndex == s.mPendingFabricIndex {
+		s.revertPendingLocked()
+	}
+	if !s.removeCertsLocked(fabricIndex) {
+		return internal.ChipErrorInvalidFabricIndex
+	}
 	return nil
 }
 
-func (s PersistentStorageOpCertStoreImpl) RevertPendingOpCerts() {
+func (s *PersistentStorageOpCertStoreImpl) RevertPendingOpCerts() {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.revertPendingLocked()
+}
 
+// RevertPendingOpCertsExceptRoot 只撤销 NOC 链，待提交的根证书保留
+func (s *PersistentStorageOpCertStoreImpl) RevertPendingOpCertsExceptRoot() {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mPendingIcac = nil
+	s.mPendingNoc = nil
+	s.mAddedNewOpCerts = false
+	s.mUpdatedOpCerts = false
+	if !s.mAddedTrustedRoot {
+		s.mPendingFabricIndex = lib.KUndefinedFabricIndex
+	}
 }
 
-func (s PersistentStorageOpCertStoreImpl) RevertPendingOpCertsExceptRoot() {
+// GetCertificate 优先返回待提交的证书，没有证书时返回 nil
+func (s *PersistentStorageOpCertStoreImpl) GetCertificate(fabricIndex device.FabricIndex, element uint8) []byte {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	return s.getCertificateLocked(fabricIndex, element)
+}
 
+func (s *PersistentStorageOpCertStoreImpl) getCertificateLocked(fabricIndex device.FabricIndex, element uint8) []byte {
+	if s.mStorage == nil || !fabricIndex.IsValidFabricIndex() {
+		return nil
+	}
+	if fabricIndex == s.mPendingFabricIndex {
+		switch element {
+		case CertChainElementRcac:
+			if s.mAddedTrustedRoot {
+				return append([]byte(nil), s.mPendingRcac...)
+			}
+		case CertChainElementIcac:
+			// 待提交的 NOC 链可以没有 ICAC，此时不能返回已保存的 ICAC
+			if s.hasPendingNocChainLocked() {
+				if len(s.mPendingIcac) == 0 {
+					return nil
+				}
+				return append([]byte(nil), s.mPendingIcac...)
+			}
+		case CertChainElementNoc:
+			if s.hasPendingNocChainLocked() {
+				return append([]byte(nil), s.mPendingNoc...)
+			}
+		}
+	}
+	var key string
+	switch element {
+	case CertChainElementRcac:
+		key = storage.FabricRCAC(uint8(fabricIndex))
+	case CertChainElementIcac:
+		key = storage.FabricICAC(uint8(fabricIndex))
+	case CertChainElementNoc:
+		key = storage.FabricNOC(uint8(fabricIndex))
+	default:
+		return nil
+	}
+	if !s.mStorage.HasValue(key) {
+		return nil
+	}
+	cert, err := s.mStorage.ReadValueBin(key)
+	if err != nil {
+		return nil
+	}
+	return cert
 }
 
-func (s PersistentStorageOpCertStoreImpl) GetCertificate(fabricIndex device.FabricIndex, element uint8) []byte {
-	return nil
+func (s *PersistentStorageOpCertStoreImpl) hasPendingNocChainLocked() bool {
+	return s.mAddedNewOpCerts || s.mUpdatedOpCerts
+}
+
+// removeCertsLocked 删除保存的证书，返回是否存在证书
+func (s *PersistentStorageOpCertStoreImpl) removeCertsLocked(fabricIndex device.FabricIndex) bool {
+	found := false
+	index := uint8(fabricIndex)
+	for _, key := range []string{storage.FabricNOC(index), storage.FabricICAC(index), storage.FabricRCAC(index)} {
+		if s.mStorage.HasValue(key) {
+			found = true
+			_ = s.mStorage.ClearValue(key)
+		}
+	}
+	return found
+}
+
+func (s *PersistentStorageOpCertStoreImpl) revertPendingLocked() {
+	s.mPendingFabricIndex = lib.KUndefinedFabricIndex
+	s.mPendingRcac = nil
+	s.mPendingIcac = nil
+	s.mPendingNoc = nil
+	s.mAddedTrustedRoot = false
+	s.mAddedNewOpCerts = false
+	s.mUpdatedOpCerts = false
 }
 
-func (s PersistentStorageOpCertStoreImpl) Init(delegate storage.StorageDelegate) {
-	s.mPersistentStorage = delegate
+func isValidCertificate(cert []byte) bool {
+	return len(cert) != 0 && len(cert) <= certs.KMaxCHIPCertLength
 }
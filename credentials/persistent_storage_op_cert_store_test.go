@@ -0,0 +1,227 @@
+package credentials
+
+import (
+	"bytes"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/storage"
+	"testing"
+)
+
+var (
+	testRcac    = []byte("test rcac")
+	testIcac    = []byte("test icac")
+	testNoc     = []byte("test noc")
+	testNewIcac = []byte("test updated icac")
+	testNewNoc  = []byte("test updated noc")
+)
+
+// failingStorage 写入指定的键时返回错误，用于模拟提交过程中的存储失败
+type failingStorage struct {
+	*storage.InMemoryPersistentStorage
+	mFailKey string
+}
+
+func (s *failingStorage) WriteValueBin(key string, v []byte) error {
+	if key == s.mFailKey {
+		return internal.ChipErrorPersistedStorageFailed
+	}
+	return s.InMemoryPersistentStorage.WriteValueBin(key, v)
+}
+
+func newTestOpCertStoreWith(t *testing.T, delegate storage.StorageDelegate) *PersistentStorageOpCertStoreImpl {
+	t.Helper()
+	store := NewPersistentStorageOpCertStoreImpl()
+	if err := store.Init(delegate); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func expectCertificate(t *testing.T, store *PersistentStorageOpCertStoreImpl, fabricIndex FabricIndex, element uint8, expected []byte) {
+	t.Helper()
+	if cert := store.GetCertificate(fabricIndex, element); !bytes.Equal(cert, expected) {
+		t.Errorf("fabric %d element %d: expected %q, got %q", fabricIndex, element, expected, cert)
+	}
+	if store.HasCertificateForFabric(fabricIndex, element) != (len(expected) != 0) {
+		t.Errorf("fabric %d element %d: HasCertificateForFabric mismatch", fabricIndex, element)
+	}
+}
+
+func TestOpCertStoreAddAndCommit(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	store := newTestOpCertStoreWith(t, kvs)
+
+	if err := store.AddNewOpCertsForFabric(1, testNoc, testIcac); err != internal.ChipErrorIncorrectState {
+		t.Errorf("AddNOC before AddTrustedRootCertificate must fail, got %v", err)
+	}
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(1, testRcac))
+	if err := store.AddNewTrustedRootCertForFabric(1, testRcac); err != internal.ChipErrorIncorrectState {
+		t.Errorf("second root must fail, got %v", err)
+	}
+	if err := store.CommitOpCertsForFabric(1); err != internal.ChipErrorIncorrectState {
+		t.Errorf("commit without NOC must fail, got %v", err)
+	}
+	if err := store.AddNewOpCertsForFabric(2, testNoc, testIcac); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("AddNOC for another fabric must fail, got %v", err)
+	}
+	mustAdd(t, store.AddNewOpCertsForFabric(1, testNoc, testIcac))
+	if !store.HasPendingRootCert() || !store.HasPendingNocChain() {
+		t.Fatalf("expected pending certificates")
+	}
+	expectCertificate(t, store, 1, CertChainElementNoc, testNoc)
+	if kvs.HasValue(storage.FabricRCAC(1)) || kvs.HasValue(storage.FabricNOC(1)) {
+		t.Fatalf("pending certificates must not be persisted")
+	}
+
+	mustAdd(t, store.CommitOpCertsForFabric(1))
+	if store.HasPendingRootCert() || store.HasPendingNocChain() {
+		t.Errorf("pending state must be cleared after commit")
+	}
+
+	reloaded := newTestOpCertStoreWith(t, kvs)
+	expectCertificate(t, reloaded, 1, CertChainElementRcac, testRcac)
+	expectCertificate(t, reloaded, 1, CertChainElementIcac, testIcac)
+	expectCertificate(t, reloaded, 1, CertChainElementNoc, testNoc)
+	if err := reloaded.AddNewTrustedRootCertForFabric(1, testRcac); err != internal.ChipErrorIncorrectState {
+		t.Errorf("root for existing fabric must fail, got %v", err)
+	}
+
+	mustAdd(t, reloaded.RemoveOpCertsForFabric(1))
+	expectCertificate(t, reloaded, 1, CertChainElementRcac, nil)
+	expectCertificate(t, reloaded, 1, CertChainElementNoc, nil)
+	if err := reloaded.RemoveOpCertsForFabric(1); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("removing twice must fail, got %v", err)
+	}
+}
+
+func TestOpCertStoreUpdate(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	store := newTestOpCertStoreWith(t, kvs)
+	if err := store.UpdateOpCertsForFabric(1, testNewNoc, nil); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("UpdateNOC for missing fabric must fail, got %v", err)
+	}
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(1, testRcac))
+	mustAdd(t, store.AddNewOpCertsForFabric(1, testNoc, testIcac))
+	mustAdd(t, store.CommitOpCertsForFabric(1))
+
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(2, testRcac))
+	if err := store.UpdateOpCertsForFabric(1, testNewNoc, nil); err != internal.ChipErrorIncorrectState {
+		t.Errorf("UpdateNOC with pending root must fail, got %v", err)
+	}
+	store.RevertPendingOpCerts()
+
+	// 更新后的链没有 ICAC，不能再返回已保存的 ICAC
+	mustAdd(t, store.UpdateOpCertsForFabric(1, testNewNoc, nil))
+	if store.HasPendingRootCert() || !store.HasPendingNocChain() {
+		t.Fatalf("update must only stage the NOC chain")
+	}
+	expectCertificate(t, store, 1, CertChainElementRcac, testRcac)
+	expectCertificate(t, store, 1, CertChainElementIcac, nil)
+	expectCertificate(t, store, 1, CertChainElementNoc, testNewNoc)
+
+	store.RevertPendingOpCerts()
+	expectCertificate(t, store, 1, CertChainElementIcac, testIcac)
+	expectCertificate(t, store, 1, CertChainElementNoc, testNoc)
+
+	mustAdd(t, store.UpdateOpCertsForFabric(1, testNewNoc, nil))
+	mustAdd(t, store.CommitOpCertsForFabric(1))
+	reloaded := newTestOpCertStoreWith(t, kvs)
+	expectCertificate(t, reloaded, 1, CertChainElementRcac, testRcac)
+	expectCertificate(t, reloaded, 1, CertChainElementIcac, nil)
+	expectCertificate(t, reloaded, 1, CertChainElementNoc, testNewNoc)
+
+	mustAdd(t, reloaded.UpdateOpCertsForFabric(1, testNoc, testNewIcac))
+	mustAdd(t, reloaded.CommitOpCertsForFabric(1))
+	expectCertificate(t, reloaded, 1, CertChainElementIcac, testNewIcac)
+}
+
+func TestOpCertStoreRevertExceptRoot(t *testing.T) {
+	store := newTestOpCertStoreWith(t, storage.NewInMemoryPersistentStorage())
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(1, testRcac))
+	mustAdd(t, store.AddNewOpCertsForFabric(1, testNoc, testIcac))
+
+	store.RevertPendingOpCertsExceptRoot()
+	if !store.HasPendingRootCert() || store.HasPendingNocChain() {
+		t.Fatalf("only the NOC chain must be reverted")
+	}
+	expectCertificate(t, store, 1, CertChainElementRcac, testRcac)
+	expectCertificate(t, store, 1, CertChainElementNoc, nil)
+
+	// 根证书保留，可以重新 AddNOC
+	mustAdd(t, store.AddNewOpCertsForFabric(1, testNewNoc, nil))
+	mustAdd(t, store.CommitOpCertsForFabric(1))
+	expectCertificate(t, store, 1, CertChainElementNoc, testNewNoc)
+	expectCertificate(t, store, 1, CertChainElementIcac, nil)
+}
+
+func TestOpCertStoreCrashRecovery(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	store := newTestOpCertStoreWith(t, kvs)
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(1, testRcac))
+	mustAdd(t, store.AddNewOpCertsForFabric(1, testNoc, testIcac))
+	mustAdd(t, store.CommitOpCertsForFabric(1))
+
+	// AddTrustedRootCertificate 和 AddNOC 之后重启，未提交的证书丢失
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(2, testRcac))
+	mustAdd(t, store.AddNewOpCertsForFabric(2, testNoc, nil))
+	reloaded := newTestOpCertStoreWith(t, kvs)
+	if reloaded.HasPendingRootCert() || reloaded.HasPendingNocChain() {
+		t.Errorf("pending state must not survive a restart")
+	}
+	expectCertificate(t, reloaded, 2, CertChainElementRcac, nil)
+	expectCertificate(t, reloaded, 2, CertChainElementNoc, nil)
+
+	// UpdateNOC 之后重启，保留原来的证书
+	mustAdd(t, reloaded.UpdateOpCertsForFabric(1, testNewNoc, testNewIcac))
+	reloaded = newTestOpCertStoreWith(t, kvs)
+	expectCertificate(t, reloaded, 1, CertChainElementIcac, testIcac)
+	expectCertificate(t, reloaded, 1, CertChainElementNoc, testNoc)
+
+	// 新增 Fabric 时写入 NOC 失败，已写入的根证书和 ICAC 被删除
+	failing := &failingStorage{InMemoryPersistentStorage: kvs, mFailKey: storage.FabricNOC(2)}
+	store = newTestOpCertStoreWith(t, failing)
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(2, testRcac))
+	mustAdd(t, store.AddNewOpCertsForFabric(2, testNoc, testIcac))
+	if err := store.CommitOpCertsForFabric(2); err != internal.ChipErrorPersistedStorageFailed {
+		t.Fatalf("expected storage failure, got %v", err)
+	}
+	if kvs.HasValue(storage.FabricRCAC(2)) || kvs.HasValue(storage.FabricICAC(2)) || kvs.HasValue(storage.FabricNOC(2)) {
+		t.Errorf("partially committed fabric must be removed")
+	}
+	if store.HasPendingRootCert() || store.HasPendingNocChain() {
+		t.Errorf("pending state must be cleared after a failed commit")
+	}
+	expectCertificate(t, store, 1, CertChainElementNoc, testNoc)
+
+	// 中途断电留下的部分证书可以由 RemoveOpCertsForFabric 清理
+	mustAdd(t, kvs.WriteValueBin(storage.FabricRCAC(3), testRcac))
+	store = newTestOpCertStoreWith(t, kvs)
+	expectCertificate(t, store, 3, CertChainElementRcac, testRcac)
+	expectCertificate(t, store, 3, CertChainElementNoc, nil)
+	mustAdd(t, store.RemoveOpCertsForFabric(3))
+	expectCertificate(t, store, 3, CertChainElementRcac, nil)
+}
+
+func TestOpCertStoreFailedUpdateCommit(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	store := newTestOpCertStoreWith(t, kvs)
+	mustAdd(t, store.AddNewTrustedRootCertForFabric(1, testRcac))
+	mustAdd(t, store.AddNewOpCertsForFabric(1, testNoc, testIcac))
+	mustAdd(t, store.CommitOpCertsForFabric(1))
+
+	// NOC 或者 ICAC 写入失败时，存储中仍然是原来的证书链
+	for _, failKey := range []string{storage.FabricNOC(1), storage.FabricICAC(1)} {
+		store = newTestOpCertStoreWith(t, &failingStorage{InMemoryPersistentStorage: kvs, mFailKey: failKey})
+		mustAdd(t, store.UpdateOpCertsForFabric(1, testNewNoc, testNewIcac))
+		if err := store.CommitOpCertsForFabric(1); err != internal.ChipErrorPersistedStorageFailed {
+			t.Fatalf("%s: expected storage failure, got %v", failKey, err)
+		}
+		if store.HasPendingNocChain() {
+			t.Errorf("%s: pending state must be cleared after a failed commit", failKey)
+		}
+		reloaded := newTestOpCertStoreWith(t, kvs)
+		expectCertificate(t, reloaded, 1, CertChainElementRcac, testRcac)
+		expectCertificate(t, reloaded, 1, CertChainElementIcac, testIcac)
+		expectCertificate(t, reloaded, 1, CertChainElementNoc, testNoc)
+	}
+}
@@ -0,0 +1,221 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+)
+
+const (
+	// KAES128CCMKeyLength AES-CCM-128 的秘钥长度
+	KAES128CCMKeyLength = 16
+	// KAES128CCMNonceLength Matter 消息使用的 Nonce 长度
+	KAES128CCMNonceLength = 13
+	// KAES128CCMTagLength Matter 消息使用的 MIC 长度
+	KAES128CCMTagLength = 16
+)
+
+// ccm 按照 RFC 3610 实现的 CCM 模式，实现了 cipher.AEAD 接口
+type ccm struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+}
+
+// NewCCM 返回使用指定 Nonce 长度（7..13）和 Tag 长度（4..16 的偶数）的 CCM
+func NewCCM(block cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != aes.BlockSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if nonceSize < 7 || nonceSize > 13 {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return &ccm{block: block, nonceSize: nonceSize, tagSize: tagSize}, nil
+}
+
+func (c *ccm) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *ccm) Overhead() int {
+	return c.tagSize
+}
+
+func (c *ccm) maxLength() uint64 {
+	l := 15 - c.nonceSize
+	if l >= 8 {
+		return 1<<63 - 1
+	}
+	return 1<<(8*uint(l)) - 1
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("crypto/ccm: incorrect nonce length")
+	}
+	if uint64(len(plaintext)) > c.maxLength() {
+		panic("crypto/ccm: plaintext too large")
+	}
+	tag := c.mac(nonce, plaintext, additionalData)
+	ret, out := sliceForAppend(dst, len(plaintext)+c.tagSize)
+	c.ctr(nonce, out[:len(plaintext)], plaintext)
+
+	s0 := c.counterBlock(nonce, 0)
+	c.block.Encrypt(s0, s0)
+	xorBytes(out[len(plaintext):], tag[:c.tagSize], s0[:c.tagSize])
+	return ret
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if len(ciphertext) < c.tagSize {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if uint64(len(ciphertext)-c.tagSize) > c.maxLength() {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	data := ciphertext[:len(ciphertext)-c.tagSize]
+	receivedTag := ciphertext[len(ciphertext)-c.tagSize:]
+
+	plaintext := make([]byte, len(data))
+	c.ctr(nonce, plaintext, data)
+
+	s0 := c.counterBlock(nonce, 0)
+	c.block.Encrypt(s0, s0)
+	expectedTag := c.mac(nonce, plaintext, additionalData)
+	xorBytes(expectedTag[:c.tagSize], expectedTag[:c.tagSize], s0[:c.tagSize])
+	if subtle.ConstantTimeCompare(expectedTag[:c.tagSize], receivedTag) != 1 {
+		return nil, internal.ChipErrorIntegrityCheckFailed
+	}
+	ret, out := sliceForAppend(dst, len(plaintext))
+	copy(out, plaintext)
+	return ret, nil
+}
+
+// mac 计算 CBC-MAC
+func (c *ccm) mac(nonce, plaintext, additionalData []byte) []byte {
+	l := 15 - c.nonceSize
+	b := make([]byte, aes.BlockSize)
+	b[0] = byte(((c.tagSize-2)/2)<<3 | (l - 1))
+	if len(additionalData) > 0 {
+		b[0] |= 1 << 6
+	}
+	copy(b[1:], nonce)
+	putLength(b[1+c.nonceSize:], uint64(len(plaintext)))
+
+	mac := make([]byte, aes.BlockSize)
+	c.block.Encrypt(mac, b)
+
+	if len(additionalData) > 0 {
+		var header []byte
+		switch {
+		case len(additionalData) < 0xFF00:
+			header = make([]byte, 2)
+			binary.BigEndian.PutUint16(header, uint16(len(additionalData)))
+		case uint64(len(additionalData)) <= 0xFFFFFFFF:
+			header = make([]byte, 6)
+			header[0], header[1] = 0xFF, 0xFE
+			binary.BigEndian.PutUint32(header[2:], uint32(len(additionalData)))
+		default:
+			header = make([]byte, 10)
+			header[0], header[1] = 0xFF, 0xFF
+			binary.BigEndian.PutUint64(header[2:], uint64(len(additionalData)))
+		}
+		c.cbcMac(mac, append(header, additionalData...))
+	}
+	c.cbcMac(mac, plaintext)
+	return mac
+}
+
+// cbcMac 将 data 按块（不足补零）加入 CBC-MAC
+func (c *ccm) cbcMac(mac, data []byte) {
+	for len(data) > 0 {
+		n := len(data)
+		if n > aes.BlockSize {
+			n = aes.BlockSize
+		}
+		xorBytes(mac[:n], mac[:n], data[:n])
+		c.block.Encrypt(mac, mac)
+		data = data[n:]
+	}
+}
+
+// ctr 使用从 1 开始的计数器块加解密
+func (c *ccm) ctr(nonce, dst, src []byte) {
+	counter := c.counterBlock(nonce, 1)
+	stream := cipher.NewCTR(c.block, counter)
+	stream.XORKeyStream(dst, src)
+}
+
+func (c *ccm) counterBlock(nonce []byte, i uint64) []byte {
+	l := 15 - c.nonceSize
+	block := make([]byte, aes.BlockSize)
+	block[0] = byte(l - 1)
+	copy(block[1:], nonce)
+	putLength(block[1+c.nonceSize:], i)
+	return block
+}
+
+func xorBytes(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+
+func putLength(b []byte, v uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// AesCcmEncrypt 使用 AES-CCM-128 加密，返回密文和 tagLength 长度的 Tag
+func AesCcmEncrypt(plaintext, aad, key, nonce []byte, tagLength int) (ciphertext, tag []byte, err error) {
+	aead, err := newAesCcm(key, len(nonce), tagLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := aead.Seal(nil, nonce, plaintext, aad)
+	return out[:len(plaintext)], out[len(plaintext):], nil
+}
+
+// AesCcmDecrypt 使用 AES-CCM-128 解密并校验 Tag
+func AesCcmDecrypt(ciphertext, aad, tag, key, nonce []byte) ([]byte, error) {
+	aead, err := newAesCcm(key, len(nonce), len(tag))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, len(ciphertext)+len(tag))
+	data = append(data, ciphertext...)
+	data = append(data, tag...)
+	return aead.Open(nil, nonce, data, aad)
+}
+
+func newAesCcm(key []byte, nonceLength, tagLength int) (cipher.AEAD, error) {
+	if len(key) != KAES128CCMKeyLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewCCM(block, nonceLength, tagLength)
+}
@@ -0,0 +1,133 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/galenliu/chip/internal"
+	"testing"
+)
+
+// RFC 3610 第8节的 Packet Vector #1，8字节 Tag
+func TestAesCcmRFC3610Vector(t *testing.T) {
+	key := mustDecodeHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf")
+	nonce := mustDecodeHex(t, "00000003020100a0a1a2a3a4a5")
+	aad := mustDecodeHex(t, "0001020304050607")
+	plaintext := mustDecodeHex(t, "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e")
+	ciphertext, tag, err := AesCcmEncrypt(plaintext, aad, key, nonce, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(ciphertext) != "588c979a61c663d2f066d0c2c0f989806d5f6b61dac384" || hex.EncodeToString(tag) != "17e8d12cfdf926e0" {
+		t.Errorf("unexpected output %x %x", ciphertext, tag)
+	}
+	decrypted, err := AesCcmDecrypt(ciphertext, aad, tag, key, nonce)
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("decrypt failed: %v", err)
+	}
+}
+
+// Matter 使用 13 字节 nonce 和 16 字节 MIC。RFC 3610 的向量使用同样长度的 nonce，MIC 为 8 或 10 字节；
+// 16 字节 MIC 的向量由另一个独立的 AES-CCM 实现（通过了 RFC 3610 全部向量）计算得到
+func TestAesCcmKnownAnswer(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		key        string
+		nonce      string
+		aad        string
+		plaintext  string
+		ciphertext string
+		tag        string
+	}{
+		{
+			name:       "RFC 3610 Packet Vector #4",
+			key:        "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+			nonce:      "00000006050403a0a1a2a3a4a5",
+			aad:        "000102030405060708090a0b",
+			plaintext:  "0c0d0e0f101112131415161718191a1b1c1d1e",
+			ciphertext: "a28c6865939a9a79faaa5c4c2a9d4a91cdac8c",
+			tag:        "96c861b9c9e61ef1",
+		},
+		{
+			name:       "RFC 3610 Packet Vector #7",
+			key:        "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+			nonce:      "00000009080706a0a1a2a3a4a5",
+			aad:        "0001020304050607",
+			plaintext:  "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e",
+			ciphertext: "0135d1b2c95f41d5d1d4fec185d166b8094e999dfed96c",
+			tag:        "048c56602c97acbb7490",
+		},
+		{
+			name:       "RFC 3610 Packet Vector #1 with 16 byte MIC",
+			key:        "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+			nonce:      "00000003020100a0a1a2a3a4a5",
+			aad:        "0001020304050607",
+			plaintext:  "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e",
+			ciphertext: "588c979a61c663d2f066d0c2c0f989806d5f6b61dac384",
+			tag:        "509da654e32deac369c2dae7133cb08d",
+		},
+		{
+			// nonce = 安全标志 | 消息计数 | 源节点ID，AAD 为消息头
+			name:  "Matter message without payload",
+			key:   "5eded244e5532b3cdc23409dbad052d2",
+			nonce: "00392a00000100000000000000",
+			aad:   "00b8b3ab0100000000",
+			tag:   "84a5805f2e7d1116eb2f5fc693573b45",
+		},
+		{
+			name:       "Matter message",
+			key:        "5eded244e5532b3cdc23409dbad052d2",
+			nonce:      "00392a00000100000000000000",
+			aad:        "00b8b3ab0100000000",
+			plaintext:  "0520a0fe8ff415d3f06b000015280136",
+			ciphertext: "a7fd86c925a0f7b39b0fc2d04c2e81de",
+			tag:        "b9fb4ac02802926c686062020e21386b",
+		},
+	} {
+		key, nonce, aad := mustDecodeHex(t, tc.key), mustDecodeHex(t, tc.nonce), mustDecodeHex(t, tc.aad)
+		plaintext, expected := mustDecodeHex(t, tc.plaintext), mustDecodeHex(t, tc.tag)
+		ciphertext, tag, err := AesCcmEncrypt(plaintext, aad, key, nonce, len(expected))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if hex.EncodeToString(ciphertext) != tc.ciphertext || !bytes.Equal(tag, expected) {
+			t.Errorf("%s: unexpected output %x %x", tc.name, ciphertext, tag)
+		}
+		decrypted, err := AesCcmDecrypt(ciphertext, aad, tag, key, nonce)
+		if err != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%s: decrypt failed: %v", tc.name, err)
+		}
+	}
+}
+
+func TestAesCcmMatterParameters(t *testing.T) {
+	key := bytes.Repeat([]byte{0x5a}, KAES128CCMKeyLength)
+	nonce := bytes.Repeat([]byte{0x01}, KAES128CCMNonceLength)
+	aad := []byte("header")
+	for _, plaintext := range [][]byte{nil, []byte("payload")} {
+		ciphertext, tag, err := AesCcmEncrypt(plaintext, aad, key, nonce, KAES128CCMTagLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ciphertext) != len(plaintext) || len(tag) != KAES128CCMTagLength {
+			t.Fatalf("unexpected lengths %d %d", len(ciphertext), len(tag))
+		}
+		decrypted, err := AesCcmDecrypt(ciphertext, aad, tag, key, nonce)
+		if err != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("decrypt failed: %v", err)
+		}
+		tag[0] ^= 0x01
+		if _, err := AesCcmDecrypt(ciphertext, aad, tag, key, nonce); err != internal.ChipErrorIntegrityCheckFailed {
+			t.Errorf("tampered tag must fail, got %v", err)
+		}
+		tag[0] ^= 0x01
+		if _, err := AesCcmDecrypt(ciphertext, []byte("other"), tag, key, nonce); err != internal.ChipErrorIntegrityCheckFailed {
+			t.Errorf("different aad must fail, got %v", err)
+		}
+	}
+	if _, _, err := AesCcmEncrypt(nil, nil, key[:8], nonce, KAES128CCMTagLength); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("short key must be rejected")
+	}
+	if _, _, err := AesCcmEncrypt(nil, nil, key, nonce, 15); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("odd tag length must be rejected")
+	}
+}
@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/galenliu/chip/internal"
+)
+
+// KMaxCSRLength DER 编码的 CSR 的最大长度
+const KMaxCSRLength = 255
+
+// NewCertificateSigningRequest 生成 PKCS#10 格式的证书签名请求，主题为 O=CSR，
+// 运行证书的颁发者只使用其中的公钥
+func (k *P256Keypair) NewCertificateSigningRequest() ([]byte, error) {
+	if k.mPrivateKey == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	template := &x509.CertificateRequest{
+		Subject:            pkix.Name{Organization: []string{"CSR"}},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+	return x509.CreateCertificateRequest(rand.Reader, template, k.mPrivateKey)
+}
+
+// VerifyCertificateSigningRequest 验证 CSR 的签名，返回其中的公钥
+func VerifyCertificateSigningRequest(csr []byte) (P256PublicKey, error) {
+	if len(csr) > KMaxCSRLength {
+		return P256PublicKey{}, internal.ChipErrorInvalidArgument
+	}
+	request, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		return P256PublicKey{}, internal.ChipErrorInvalidArgument
+	}
+	if err = request.CheckSignature(); err != nil {
+		return P256PublicKey{}, internal.ChipErrorInvalidSignature
+	}
+	publicKey, ok := request.PublicKey.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return P256PublicKey{}, internal.ChipErrorUnsupportedEllipticCurve
+	}
+	return NewP256PublicKey(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+}
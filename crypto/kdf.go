@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+)
+
+const (
+	KSHA256HashLength = sha256.Size
+	// kHKDFMaxOutputLength HKDF-SHA256 最多输出 255 个块
+	kHKDFMaxOutputLength = 255 * sha256.Size
+)
+
+// PBKDF2SHA256 使用 HMAC-SHA256 的 PBKDF2 (RFC 8018)
+func PBKDF2SHA256(password, salt []byte, iterations uint32, keyLength int) ([]byte, error) {
+	if iterations == 0 || keyLength <= 0 {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	prf := hmac.New(sha256.New, password)
+	key := make([]byte, 0, keyLength+sha256.Size)
+	var blockIndex [4]byte
+	for block := uint32(1); len(key) < keyLength; block++ {
+		binary.BigEndian.PutUint32(blockIndex[:], block)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(blockIndex[:])
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := uint32(1); i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength], nil
+}
+
+// HKDFSHA256 使用 SHA256 的 HKDF (RFC 5869)，salt 为空时使用全0的盐
+func HKDFSHA256(secret, salt, info []byte, length int) ([]byte, error) {
+	if length <= 0 || length > kHKDFMaxOutputLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	output := make([]byte, 0, length+sha256.Size)
+	var previous []byte
+	for counter := byte(1); len(output) < length; counter++ {
+		expand.Reset()
+		expand.Write(previous)
+		expand.Write(info)
+		expand.Write([]byte{counter})
+		previous = expand.Sum(nil)
+		output = append(output, previous...)
+	}
+	return output[:length], nil
+}
+
+// HMACSHA256 计算消息认证码
+func HMACSHA256(key, message []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,39 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/galenliu/chip/internal"
+	"testing"
+)
+
+// RFC 7914 第11节的 PBKDF2-HMAC-SHA256 测试向量
+func TestPBKDF2SHA256(t *testing.T) {
+	key, err := PBKDF2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(key) != expected {
+		t.Errorf("unexpected key %x", key)
+	}
+}
+
+// RFC 5869 附录A.1 的 HKDF 测试向量
+func TestHKDFSHA256(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	okm, err := HKDFSHA256(secret, salt, info, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"
+	if hex.EncodeToString(okm) != expected {
+		t.Errorf("unexpected okm %x", okm)
+	}
+	if _, err := HKDFSHA256(secret, nil, nil, kHKDFMaxOutputLength+1); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("oversized output must fail")
+	}
+}
@@ -0,0 +1,133 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/galenliu/chip/internal"
+	"math/big"
+)
+
+const (
+	// KP256PublicKeyLength 未压缩格式的公钥长度
+	KP256PublicKeyLength = kP256PointLength
+	// KP256ECDSASignatureLength r || s 格式的签名长度
+	KP256ECDSASignatureLength = 2 * kp256FeLength
+	// KP256ECDHSecretLength ECDH 共享密钥长度
+	KP256ECDHSecretLength = kp256FeLength
+	// KP256PrivateKeyLength 私钥长度
+	KP256PrivateKeyLength = kp256FeLength
+	// KP256SerializedKeypairLength 序列化的秘钥对：公钥 || 私钥
+	KP256SerializedKeypairLength = KP256PublicKeyLength + KP256PrivateKeyLength
+)
+
+// P256PublicKey 未压缩格式的公钥 0x04 || X || Y
+type P256PublicKey [KP256PublicKeyLength]byte
+
+// NewP256PublicKey 检查数据是否为曲线上的点
+func NewP256PublicKey(data []byte) (P256PublicKey, error) {
+	var key P256PublicKey
+	if len(data) != KP256PublicKeyLength {
+		return key, internal.ChipErrorInvalidArgument
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), data); x == nil {
+		return key, internal.ChipErrorInvalidArgument
+	}
+	copy(key[:], data)
+	return key, nil
+}
+
+func (k P256PublicKey) Bytes() []byte {
+	return k[:]
+}
+
+// P256Keypair P256 秘钥对，用于运行证书签名和 CASE 的临时秘钥
+type P256Keypair struct {
+	mPrivateKey *ecdsa.PrivateKey
+	mPublicKey  P256PublicKey
+}
+
+func NewP256Keypair() *P256Keypair {
+	return &P256Keypair{}
+}
+
+// Initialize 生成新的秘钥对
+func (k *P256Keypair) Initialize() error {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	k.mPrivateKey = privateKey
+	copy(k.mPublicKey[:], elliptic.Marshal(elliptic.P256(), privateKey.X, privateKey.Y))
+	return nil
+}
+
+// Serialize 序列化为 公钥 || 私钥
+func (k *P256Keypair) Serialize() ([]byte, error) {
+	if k.mPrivateKey == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	data := make([]byte, KP256SerializedKeypairLength)
+	copy(data, k.mPublicKey[:])
+	k.mPrivateKey.D.FillBytes(data[KP256PublicKeyLength:])
+	return data, nil
+}
+
+// Deserialize 从 公钥 || 私钥 恢复秘钥对，公钥必须与私钥匹配
+func (k *P256Keypair) Deserialize(data []byte) error {
+	if len(data) != KP256SerializedKeypairLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(data[KP256PublicKeyLength:])
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return internal.ChipErrorInvalidArgument
+	}
+	x, y := curve.ScalarBaseMult(data[KP256PublicKeyLength:])
+	if !bytes.Equal(elliptic.Marshal(curve, x, y), data[:KP256PublicKeyLength]) {
+		return internal.ChipErrorInvalidArgument
+	}
+	k.mPrivateKey = &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
+	copy(k.mPublicKey[:], data[:KP256PublicKeyLength])
+	return nil
+}
+
+func (k *P256Keypair) IsInitialized() bool {
+	return k.mPrivateKey != nil
+}
+
+func (k *P256Keypair) Pubkey() P256PublicKey {
+	return k.mPublicKey
+}
+
+// ECDSASignMsg 对消息的 SHA256 摘要签名
+func (k *P256Keypair) ECDSASignMsg(message []byte) (P256ECDSASignature, error) {
+	var signature P256ECDSASignature
+	if k.mPrivateKey == nil {
+		return signature, internal.ChipErrorIncorrectState
+	}
+	digest := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(rand.Reader, k.mPrivateKey, digest[:])
+	if err != nil {
+		return signature, err
+	}
+	r.FillBytes(signature[:kp256FeLength])
+	s.FillBytes(signature[kp256FeLength:])
+	return signature, nil
+}
+
+// ECDHDeriveSecret 与对端公钥计算共享密钥，即共享点的X坐标
+func (k *P256Keypair) ECDHDeriveSecret(remotePublicKey P256PublicKey) ([]byte, error) {
+	if k.mPrivateKey == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, remotePublicKey[:])
+	if x == nil {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	sx, _ := curve.ScalarMult(x, y, k.mPrivateKey.D.Bytes())
+	return sx.FillBytes(make([]byte, KP256ECDHSecretLength)), nil
+}
@@ -0,0 +1,166 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/galenliu/chip/internal"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func deserializeTestKeypair(t *testing.T, privateKey string) *P256Keypair {
+	t.Helper()
+	d := mustDecodeHex(t, privateKey)
+	x, y := elliptic.P256().ScalarBaseMult(d)
+	keypair := NewP256Keypair()
+	if err := keypair.Deserialize(append(elliptic.Marshal(elliptic.P256(), x, y), d...)); err != nil {
+		t.Fatal(err)
+	}
+	return keypair
+}
+
+// RFC 5903 第8.1节的 P-256 ECDH 测试向量
+func TestP256ECDHDeriveSecret(t *testing.T) {
+	initiator := deserializeTestKeypair(t, "c88f01f510d9ac3f70a292daa2316de544e9aab8afe84049c62a9c57862d1433")
+	responder := deserializeTestKeypair(t, "c6ef9c5d78ae012a011164acb397ce2088685d8f06bf9be0b283ab46476bee53")
+	initiatorPubkey := initiator.Pubkey()
+	if hex.EncodeToString(initiatorPubkey.Bytes()) != "04dad0b65394221cf9b051e1feca5787d098dfe637fc90b9ef945d0c3772581180"+
+		"5271a0461cdb8252d61f1c456fa3e59ab1f45b33accf5f58389e0577b8990bb3" {
+		t.Errorf("unexpected public key %x", initiatorPubkey)
+	}
+	expected := "d6840f6b42f6edafd13116e0e12565202fef8e9ece7dce03812464d04b9442de"
+	for _, pair := range [][2]*P256Keypair{{initiator, responder}, {responder, initiator}} {
+		secret, err := pair[0].ECDHDeriveSecret(pair[1].Pubkey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(secret) != expected {
+			t.Errorf("unexpected shared secret %x", secret)
+		}
+	}
+	if _, err := NewP256Keypair().ECDHDeriveSecret(initiatorPubkey); err != internal.ChipErrorIncorrectState {
+		t.Errorf("uninitialized keypair must fail")
+	}
+}
+
+// RFC 6979 附录A.2.5 中 P-256、SHA-256、消息 "sample" 的签名
+func TestP256ECDSAValidateMsgSignature(t *testing.T) {
+	keypair := deserializeTestKeypair(t, "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+	var signature P256ECDSASignature
+	copy(signature[:], mustDecodeHex(t, "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716"+
+		"f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8"))
+	pubkey := keypair.Pubkey()
+	if err := pubkey.ECDSAValidateMsgSignature([]byte("sample"), signature); err != nil {
+		t.Errorf("known signature must verify: %v", err)
+	}
+	if err := pubkey.ECDSAValidateMsgSignature([]byte("test"), signature); err != internal.ChipErrorInvalidSignature {
+		t.Errorf("signature over another message must fail, got %v", err)
+	}
+
+	// DER 编码与 r || s 的互相转换
+	der, err := EcdsaRawSignatureToAsn1(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("sample"))
+	x, y := elliptic.Unmarshal(elliptic.P256(), pubkey.Bytes())
+	if !ecdsa.VerifyASN1(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], der) {
+		t.Errorf("DER signature must verify")
+	}
+	raw, err := EcdsaAsn1SignatureToRaw(der)
+	if err != nil || raw != signature {
+		t.Errorf("DER round trip failed: %v", err)
+	}
+	if _, err := EcdsaAsn1SignatureToRaw(der[:len(der)-1]); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("truncated DER must fail")
+	}
+
+	signed, err := keypair.ECDSASignMsg([]byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pubkey.ECDSAValidateMsgSignature([]byte("message"), signed); err != nil {
+		t.Errorf("own signature must verify: %v", err)
+	}
+}
+
+func TestP256KeypairSerialize(t *testing.T) {
+	keypair := NewP256Keypair()
+	if _, err := keypair.Serialize(); err != internal.ChipErrorIncorrectState {
+		t.Errorf("uninitialized keypair must not serialize")
+	}
+	if err := keypair.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := keypair.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewP256Keypair()
+	if err := restored.Deserialize(data); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Pubkey() != keypair.Pubkey() {
+		t.Errorf("public key mismatch after deserialize")
+	}
+	signature, err := restored.ECDSASignMsg([]byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkey := keypair.Pubkey()
+	if err := pubkey.ECDSAValidateMsgSignature([]byte("message"), signature); err != nil {
+		t.Errorf("restored keypair must sign with the same key")
+	}
+
+	data[1] ^= 0xFF
+	if err := restored.Deserialize(data); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("mismatched public key must be rejected")
+	}
+	zero := make([]byte, KP256SerializedKeypairLength)
+	if err := restored.Deserialize(zero); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("zero private key must be rejected")
+	}
+	if _, err := NewP256PublicKey(make([]byte, KP256PublicKeyLength)); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("invalid point must be rejected")
+	}
+	order := elliptic.P256().Params().N.Bytes()
+	if err := restored.Deserialize(append(make([]byte, KP256PublicKeyLength), order...)); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("private key out of range must be rejected")
+	}
+}
+
+func TestCertificateSigningRequest(t *testing.T) {
+	keypair := NewP256Keypair()
+	if _, err := keypair.NewCertificateSigningRequest(); err != internal.ChipErrorIncorrectState {
+		t.Errorf("uninitialized keypair must fail, got %v", err)
+	}
+	if err := keypair.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	csr, err := keypair.NewCertificateSigningRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(csr) > KMaxCSRLength {
+		t.Errorf("CSR too long: %d", len(csr))
+	}
+	pubkey, err := VerifyCertificateSigningRequest(csr)
+	if err != nil || pubkey != keypair.Pubkey() {
+		t.Errorf("CSR must contain the keypair public key: %v", err)
+	}
+	// 篡改签名
+	csr[len(csr)-1] ^= 0xFF
+	if _, err = VerifyCertificateSigningRequest(csr); err == nil {
+		t.Errorf("corrupted CSR must be rejected")
+	}
+}
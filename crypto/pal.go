@@ -9,25 +9,3 @@ const (
 
 	KSpake2pVerifierSerializedLength = kp256FeLength + kP256PointLength
 )
-
-type Spake2pVerifier struct {
-}
-
-func (v Spake2pVerifier) Deserialize(verifier []byte) error {
-	return nil
-}
-
-func (v Spake2pVerifier) Generate(count uint32, span []byte, passcode uint32) error {
-	return nil
-}
-
-func (v Spake2pVerifier) Serialize() ([]byte, error) {
-	return nil, nil
-}
-
-type P256ECDSASignature struct {
-}
-
-func SignP256ECDSASignature(plainTex, privateKeyFile []byte) (P256ECDSASignature, error) {
-	return P256ECDSASignature{}, nil
-}
@@ -1,83 +1,262 @@
 package persistent_storage
 
 import (
-	"crypto"
+	"github.com/galenliu/chip/crypto"
 	"github.com/galenliu/chip/device"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
 	"github.com/galenliu/chip/storage"
+	"sync"
+)
+
+const (
+	// kOpKeyVersion 保存的运行秘钥的格式版本
+	kOpKeyVersion uint16 = 1
+	// kMaxEphemeralKeypairs 缓存的 CASE 临时秘钥对的数量
+	kMaxEphemeralKeypairs = 4
 )
 
 type PersistentStorageOperationalKeystore interface {
 	HasPendingOpKeypair() bool
 	HasOpKeypairForFabric(fabricIndex device.FabricIndex) bool
+	// NewOpKeypairForFabric 生成待提交的运行秘钥对，返回 DER 编码的 CSR
 	NewOpKeypairForFabric(fabricIndex device.FabricIndex) ([]byte, error)
-	ActivateOpKeypairForFabric(fabricIndex device.FabricIndex, key crypto.PublicKey) error
+	// ActivateOpKeypairForFabric 确认待提交的秘钥对与 NOC 中的公钥匹配，之后可以用它签名
+	ActivateOpKeypairForFabric(fabricIndex device.FabricIndex, nocPublicKey crypto.P256PublicKey) error
 	CommitOpKeypairForFabric(fabricIndex device.FabricIndex) error
 	RemoveOpKeypairForFabric(fabricIndex device.FabricIndex) error
 	RevertPendingKeypair()
-	SignWithOpKeypair(fabricIndex device.FabricIndex, message []byte) ([]byte, error)
-	AllocateEphemeralKeypairForCASE() crypto.PrivateKey
-	ReleaseEphemeralKeypair(key crypto.PrivateKey)
-	Init(delegate storage.StorageDelegate)
+	SignWithOpKeypair(fabricIndex device.FabricIndex, message []byte) (crypto.P256ECDSASignature, error)
+	AllocateEphemeralKeypairForCASE() *crypto.P256Keypair
+	ReleaseEphemeralKeypair(keypair *crypto.P256Keypair)
+	Init(delegate storage.StorageDelegate) error
+}
+
+type opKeyData struct {
+	Version uint16 `tlv:"0"`
+	Keypair []byte `tlv:"1"`
 }
 
+// PersistentStorageOperationalKeystoreImpl 把每个 Fabric 的运行秘钥对保存在存储中，
+// 新生成的秘钥对在 CommitOpKeypairForFabric 之前只保存在内存中
 type PersistentStorageOperationalKeystoreImpl struct {
-	mPersistentStorage storage.StorageDelegate
+	mMutex                  sync.Mutex
+	mStorage                storage.StorageDelegate
+	mPendingFabricIndex     device.FabricIndex
+	mPendingKeypair         *crypto.P256Keypair
+	mIsPendingKeypairActive bool
+	mEphemeralKeypairs      []*crypto.P256Keypair
 }
 
 func NewPersistentStorageOperationalKeystoreImpl() *PersistentStorageOperationalKeystoreImpl {
 	return &PersistentStorageOperationalKeystoreImpl{}
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) HasPendingOpKeypair() bool {
-	//TODO implement me
-	panic("implement me")
+func (p *PersistentStorageOperationalKeystoreImpl) Init(delegate storage.StorageDelegate) error {
+	if delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mStorage != nil {
+		return internal.ChipErrorIncorrectState
+	}
+	p.mStorage = delegate
+	p.resetPendingKeyLocked()
+	return nil
+}
+
+func (p *PersistentStorageOperationalKeystoreImpl) HasPendingOpKeypair() bool {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	return p.mPendingKeypair != nil
+}
+
+// HasOpKeypairForFabric 已提交或者已激活的秘钥对
+func (p *PersistentStorageOperationalKeystoreImpl) HasOpKeypairForFabric(fabricIndex device.FabricIndex) bool {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mStorage == nil || !fabricIndex.IsValidFabricIndex() {
+		return false
+	}
+	if p.mPendingKeypair != nil && p.mPendingFabricIndex == fabricIndex && p.mIsPendingKeypairActive {
+		return true
+	}
+	return p.mStorage.HasValue(storage.FabricOpKey(uint8(fabricIndex)))
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) HasOpKeypairForFabric(fabricIndex device.FabricIndex) bool {
-	//TODO implement me
-	panic("implement me")
+// NewOpKeypairForFabric 同一时间只能有一个待提交的秘钥对，再次调用会替换同一个 Fabric 的秘钥对
+func (p *PersistentStorageOperationalKeystoreImpl) NewOpKeypairForFabric(fabricIndex device.FabricIndex) ([]byte, error) {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mStorage == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	if !fabricIndex.IsValidFabricIndex() {
+		return nil, internal.ChipErrorInvalidFabricIndex
+	}
+	if p.mPendingKeypair != nil && p.mPendingFabricIndex != fabricIndex {
+		return nil, internal.ChipErrorInvalidFabricIndex
+	}
+	keypair := crypto.NewP256Keypair()
+	if err := keypair.Initialize(); err != nil {
+		return nil, err
+	}
+	csr, err := keypair.NewCertificateSigningRequest()
+	if err != nil {
+		return nil, err
+	}
+	p.mPendingKeypair = keypair
+	p.mPendingFabricIndex = fabricIndex
+	p.mIsPendingKeypairActive = false
+	return csr, nil
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) NewOpKeypairForFabric(fabricIndex device.FabricIndex) ([]byte, error) {
-	//TODO implement me
-	panic("implement me")
+func (p *PersistentStorageOperationalKeystoreImpl) ActivateOpKeypairForFabric(fabricIndex device.FabricIndex, nocPublicKey crypto.P256PublicKey) error {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mStorage == nil || p.mPendingKeypair == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !fabricIndex.IsValidFabricIndex() || fabricIndex != p.mPendingFabricIndex {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if p.mPendingKeypair.Pubkey() != nocPublicKey {
+		return internal.ChipErrorInvalidPublicKey
+	}
+	p.mIsPendingKeypairActive = true
+	return nil
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) ActivateOpKeypairForFabric(fabricIndex device.FabricIndex, key crypto.PublicKey) error {
-	//TODO implement me
-	panic("implement me")
+// CommitOpKeypairForFabric 保存已激活的秘钥对，替换 Fabric 原有的秘钥对
+func (p *PersistentStorageOperationalKeystoreImpl) CommitOpKeypairForFabric(fabricIndex device.FabricIndex) error {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mStorage == nil || p.mPendingKeypair == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !fabricIndex.IsValidFabricIndex() || fabricIndex != p.mPendingFabricIndex {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if !p.mIsPendingKeypairActive {
+		return internal.ChipErrorIncorrectState
+	}
+	serialized, err := p.mPendingKeypair.Serialize()
+	if err != nil {
+		return err
+	}
+	data, err := tlv.Marshal(&opKeyData{Version: kOpKeyVersion, Keypair: serialized})
+	if err != nil {
+		return err
+	}
+	if err = p.mStorage.WriteValueBin(storage.FabricOpKey(uint8(fabricIndex)), data); err != nil {
+		return err
+	}
+	p.resetPendingKeyLocked()
+	return nil
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) CommitOpKeypairForFabric(fabricIndex device.FabricIndex) error {
-	//TODO implement me
-	panic("implement me")
+// RemoveOpKeypairForFabric 删除 Fabric 的秘钥对，包括待提交的秘钥对
+func (p *PersistentStorageOperationalKeystoreImpl) RemoveOpKeypairForFabric(fabricIndex device.FabricIndex) error {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !fabricIndex.IsValidFabricIndex() {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	if p.mPendingKeypair != nil && p.mPendingFabricIndex == fabricIndex {
+		p.resetPendingKeyLocked()
+	}
+	key := storage.FabricOpKey(uint8(fabricIndex))
+	if !p.mStorage.HasValue(key) {
+		return internal.ChipErrorInvalidFabricIndex
+	}
+	return p.mStorage.ClearValue(key)
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) RemoveOpKeypairForFabric(fabricIndex device.FabricIndex) error {
-	//TODO implement me
-	panic("implement me")
+func (p *PersistentStorageOperationalKeystoreImpl) RevertPendingKeypair() {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	p.resetPendingKeyLocked()
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) RevertPendingKeypair() {
-	//TODO implement me
-	panic("implement me")
+// SignWithOpKeypair 使用已激活的待提交秘钥对，或者存储中的秘钥对签名
+func (p *PersistentStorageOperationalKeystoreImpl) SignWithOpKeypair(fabricIndex device.FabricIndex, message []byte) (crypto.P256ECDSASignature, error) {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mStorage == nil {
+		return crypto.P256ECDSASignature{}, internal.ChipErrorIncorrectState
+	}
+	if !fabricIndex.IsValidFabricIndex() {
+		return crypto.P256ECDSASignature{}, internal.ChipErrorInvalidFabricIndex
+	}
+	if p.mPendingKeypair != nil && p.mPendingFabricIndex == fabricIndex && p.mIsPendingKeypairActive {
+		return p.mPendingKeypair.ECDSASignMsg(message)
+	}
+	keypair, err := p.loadKeypairLocked(fabricIndex)
+	if err != nil {
+		return crypto.P256ECDSASignature{}, err
+	}
+	return keypair.ECDSASignMsg(message)
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) SignWithOpKeypair(fabricIndex device.FabricIndex, message []byte) ([]byte, error) {
-	//TODO implement me
-	panic("implement me")
+// AllocateEphemeralKeypairForCASE 分配一个新生成的临时秘钥对，使用完后调用 ReleaseEphemeralKeypair 归还
+func (p *PersistentStorageOperationalKeystoreImpl) AllocateEphemeralKeypairForCASE() *crypto.P256Keypair {
+	p.mMutex.Lock()
+	var keypair *crypto.P256Keypair
+	if n := len(p.mEphemeralKeypairs); n > 0 {
+		keypair = p.mEphemeralKeypairs[n-1]
+		p.mEphemeralKeypairs = p.mEphemeralKeypairs[:n-1]
+	} else {
+		keypair = crypto.NewP256Keypair()
+	}
+	p.mMutex.Unlock()
+	// 临时秘钥不能重复使用，每次分配都重新生成
+	if err := keypair.Initialize(); err != nil {
+		return nil
+	}
+	return keypair
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) AllocateEphemeralKeypairForCASE() crypto.PrivateKey {
-	//TODO implement me
-	panic("implement me")
+func (p *PersistentStorageOperationalKeystoreImpl) ReleaseEphemeralKeypair(keypair *crypto.P256Keypair) {
+	if keypair == nil {
+		return
+	}
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if len(p.mEphemeralKeypairs) < kMaxEphemeralKeypairs {
+		p.mEphemeralKeypairs = append(p.mEphemeralKeypairs, keypair)
+	}
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) ReleaseEphemeralKeypair(key crypto.PrivateKey) {
-	//TODO implement me
-	panic("implement me")
+func (p *PersistentStorageOperationalKeystoreImpl) loadKeypairLocked(fabricIndex device.FabricIndex) (*crypto.P256Keypair, error) {
+	key := storage.FabricOpKey(uint8(fabricIndex))
+	if !p.mStorage.HasValue(key) {
+		return nil, internal.ChipErrorInvalidFabricIndex
+	}
+	data, err := p.mStorage.ReadValueBin(key)
+	if err != nil {
+		return nil, err
+	}
+	var opKey opKeyData
+	if err = tlv.Unmarshal(data, &opKey); err != nil {
+		return nil, err
+	}
+	if opKey.Version != kOpKeyVersion {
+		return nil, internal.ChipErrorVersionMismatch
+	}
+	keypair := crypto.NewP256Keypair()
+	if err = keypair.Deserialize(opKey.Keypair); err != nil {
+		return nil, err
+	}
+	return keypair, nil
 }
 
-func (p PersistentStorageOperationalKeystoreImpl) Init(delegate storage.StorageDelegate) {
-	p.mPersistentStorage = delegate
+func (p *PersistentStorageOperationalKeystoreImpl) resetPendingKeyLocked() {
+	p.mPendingKeypair = nil
+	p.mPendingFabricIndex = lib.KUndefinedFabricIndex
+	p.mIsPendingKeypairActive = false
 }
@@ -0,0 +1,160 @@
+package persistent_storage
+
+import (
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/storage"
+	"testing"
+)
+
+func newTestKeystore(t *testing.T) (*PersistentStorageOperationalKeystoreImpl, *storage.InMemoryPersistentStorage) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	keystore := NewPersistentStorageOperationalKeystoreImpl()
+	if err := keystore.Init(kvs); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return keystore, kvs
+}
+
+func TestOperationalKeystoreCommit(t *testing.T) {
+	keystore, kvs := newTestKeystore(t)
+
+	csr, err := keystore.NewOpKeypairForFabric(1)
+	if err != nil {
+		t.Fatalf("NewOpKeypairForFabric: %v", err)
+	}
+	publicKey, err := crypto.VerifyCertificateSigningRequest(csr)
+	if err != nil {
+		t.Fatalf("VerifyCertificateSigningRequest: %v", err)
+	}
+	if !keystore.HasPendingOpKeypair() || keystore.HasOpKeypairForFabric(1) {
+		t.Fatalf("pending keypair should not be usable before activation")
+	}
+	if _, err = keystore.NewOpKeypairForFabric(2); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("NewOpKeypairForFabric for another fabric: %v", err)
+	}
+	if err = keystore.CommitOpKeypairForFabric(1); err != internal.ChipErrorIncorrectState {
+		t.Errorf("commit before activation: %v", err)
+	}
+	if err = keystore.ActivateOpKeypairForFabric(1, crypto.P256PublicKey{}); err != internal.ChipErrorInvalidPublicKey {
+		t.Errorf("activate with wrong public key: %v", err)
+	}
+	if err = keystore.ActivateOpKeypairForFabric(1, publicKey); err != nil {
+		t.Fatalf("ActivateOpKeypairForFabric: %v", err)
+	}
+
+	message := []byte("operational keystore")
+	signature, err := keystore.SignWithOpKeypair(1, message)
+	if err != nil {
+		t.Fatalf("sign with pending keypair: %v", err)
+	}
+	if err = publicKey.ECDSAValidateMsgSignature(message, signature); err != nil {
+		t.Errorf("pending signature: %v", err)
+	}
+	if kvs.HasValue(storage.FabricOpKey(1)) {
+		t.Fatalf("pending keypair should not be persisted")
+	}
+
+	if err = keystore.CommitOpKeypairForFabric(1); err != nil {
+		t.Fatalf("CommitOpKeypairForFabric: %v", err)
+	}
+	if keystore.HasPendingOpKeypair() || !kvs.HasValue(storage.FabricOpKey(1)) {
+		t.Fatalf("committed keypair should be persisted")
+	}
+
+	// 重新加载后仍然可以用保存的秘钥签名
+	reloaded := NewPersistentStorageOperationalKeystoreImpl()
+	if err = reloaded.Init(kvs); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if !reloaded.HasOpKeypairForFabric(1) {
+		t.Fatalf("reloaded keystore should have fabric 1 keypair")
+	}
+	signature, err = reloaded.SignWithOpKeypair(1, message)
+	if err != nil {
+		t.Fatalf("sign with stored keypair: %v", err)
+	}
+	if err = publicKey.ECDSAValidateMsgSignature(message, signature); err != nil {
+		t.Errorf("stored signature: %v", err)
+	}
+	if _, err = reloaded.SignWithOpKeypair(2, message); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("sign without keypair: %v", err)
+	}
+
+	if err = reloaded.RemoveOpKeypairForFabric(1); err != nil {
+		t.Fatalf("RemoveOpKeypairForFabric: %v", err)
+	}
+	if reloaded.HasOpKeypairForFabric(1) {
+		t.Errorf("removed keypair still present")
+	}
+	if err = reloaded.RemoveOpKeypairForFabric(1); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("remove missing keypair: %v", err)
+	}
+}
+
+func TestOperationalKeystoreRevert(t *testing.T) {
+	keystore, kvs := newTestKeystore(t)
+
+	csr, err := keystore.NewOpKeypairForFabric(1)
+	if err != nil {
+		t.Fatalf("NewOpKeypairForFabric: %v", err)
+	}
+	original, _ := crypto.VerifyCertificateSigningRequest(csr)
+	if err = keystore.ActivateOpKeypairForFabric(1, original); err != nil {
+		t.Fatalf("ActivateOpKeypairForFabric: %v", err)
+	}
+	if err = keystore.CommitOpKeypairForFabric(1); err != nil {
+		t.Fatalf("CommitOpKeypairForFabric: %v", err)
+	}
+	stored, _ := kvs.ReadValueBin(storage.FabricOpKey(1))
+
+	// 更新时生成的新秘钥在回滚后不影响已保存的秘钥
+	csr, err = keystore.NewOpKeypairForFabric(1)
+	if err != nil {
+		t.Fatalf("NewOpKeypairForFabric: %v", err)
+	}
+	updated, _ := crypto.VerifyCertificateSigningRequest(csr)
+	if err = keystore.ActivateOpKeypairForFabric(1, updated); err != nil {
+		t.Fatalf("ActivateOpKeypairForFabric: %v", err)
+	}
+	keystore.RevertPendingKeypair()
+	if keystore.HasPendingOpKeypair() {
+		t.Fatalf("pending keypair not reverted")
+	}
+	current, _ := kvs.ReadValueBin(storage.FabricOpKey(1))
+	if string(current) != string(stored) {
+		t.Errorf("stored keypair changed after revert")
+	}
+	message := []byte("revert")
+	signature, err := keystore.SignWithOpKeypair(1, message)
+	if err != nil {
+		t.Fatalf("SignWithOpKeypair: %v", err)
+	}
+	if err = original.ECDSAValidateMsgSignature(message, signature); err != nil {
+		t.Errorf("signature should use the committed keypair: %v", err)
+	}
+
+	if _, err = keystore.NewOpKeypairForFabric(0); err != internal.ChipErrorInvalidFabricIndex {
+		t.Errorf("NewOpKeypairForFabric with invalid index: %v", err)
+	}
+}
+
+func TestOperationalKeystoreEphemeralKeypair(t *testing.T) {
+	keystore, _ := newTestKeystore(t)
+
+	first := keystore.AllocateEphemeralKeypairForCASE()
+	if first == nil || !first.IsInitialized() {
+		t.Fatalf("AllocateEphemeralKeypairForCASE returned uninitialized keypair")
+	}
+	publicKey := first.Pubkey()
+	keystore.ReleaseEphemeralKeypair(first)
+
+	second := keystore.AllocateEphemeralKeypairForCASE()
+	if second != first {
+		t.Errorf("released keypair should be reused")
+	}
+	if second.Pubkey() == publicKey {
+		t.Errorf("reused ephemeral keypair should be regenerated")
+	}
+	keystore.ReleaseEphemeralKeypair(second)
+}
@@ -0,0 +1,313 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/galenliu/chip/internal"
+	"io"
+	"math/big"
+)
+
+const (
+	// KSpake2pWSLength w0s、w1s 的长度，比群的阶多出64位以减少取模带来的偏差
+	KSpake2pWSLength = kp256FeLength + 8
+	// KSpake2pKeyConfirmLength 确认消息 cA、cB 的长度
+	KSpake2pKeyConfirmLength = sha256.Size
+	// KSpake2pSharedSecretLength 共享密钥 Ke 的长度
+	KSpake2pSharedSecretLength = 16
+)
+
+var (
+	// spake2p 使用的 P256 固定点 M、N，见 Matter 规范 3.10
+	spake2pM, _ = hex.DecodeString("02886e2f97ace46e55ba9dd7242579f2993b64e16ef3dcab95afd497333d8fa12f")
+	spake2pN, _ = hex.DecodeString("03d8bbd6c639c62937b04d997f38c3770719c629d7014d49a24b4f98baa1292b49")
+
+	spake2pConfirmationKeysInfo = []byte("ConfirmationKeys")
+)
+
+// Spake2pVerifier 设备保存的PASE验证数据 w0 和 L，不包含口令本身
+type Spake2pVerifier struct {
+	mW0 [kp256FeLength]byte
+	mL  [kP256PointLength]byte
+}
+
+// Generate 由配对码、盐和迭代次数生成验证数据
+func (v *Spake2pVerifier) Generate(iterations uint32, salt []byte, passcode uint32) error {
+	w0, w1, err := ComputeSpake2pW0W1(iterations, salt, passcode)
+	if err != nil {
+		return err
+	}
+	curve := elliptic.P256()
+	lx, ly := curve.ScalarBaseMult(w1)
+	copy(v.mW0[:], w0)
+	copy(v.mL[:], elliptic.Marshal(curve, lx, ly))
+	return nil
+}
+
+// Serialize 序列化为 w0 || L
+func (v *Spake2pVerifier) Serialize() ([]byte, error) {
+	data := make([]byte, 0, KSpake2pVerifierSerializedLength)
+	data = append(data, v.mW0[:]...)
+	data = append(data, v.mL[:]...)
+	return data, nil
+}
+
+func (v *Spake2pVerifier) Deserialize(verifier []byte) error {
+	if len(verifier) != KSpake2pVerifierSerializedLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), verifier[kp256FeLength:]); x == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	copy(v.mW0[:], verifier[:kp256FeLength])
+	copy(v.mL[:], verifier[kp256FeLength:])
+	return nil
+}
+
+func (v *Spake2pVerifier) GetW0() []byte {
+	return v.mW0[:]
+}
+
+func (v *Spake2pVerifier) GetL() []byte {
+	return v.mL[:]
+}
+
+// ComputeSpake2pW0W1 使用 PBKDF2 计算 w0s || w1s，再对群的阶取模得到 w0、w1
+func ComputeSpake2pW0W1(iterations uint32, salt []byte, passcode uint32) (w0, w1 []byte, err error) {
+	if len(salt) < KSpake2pMinPbkdfSaltLength || len(salt) > KSpake2pMaxPbkdfSaltLength {
+		return nil, nil, internal.ChipErrorInvalidArgument
+	}
+	if iterations == 0 || iterations > KSpake2pMaxPbkdfIterations {
+		return nil, nil, internal.ChipErrorInvalidArgument
+	}
+	var password [4]byte
+	binary.LittleEndian.PutUint32(password[:], passcode)
+	ws, err := PBKDF2SHA256(password[:], salt, iterations, 2*KSpake2pWSLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	order := elliptic.P256().Params().N
+	w0 = feBytes(new(big.Int).Mod(new(big.Int).SetBytes(ws[:KSpake2pWSLength]), order))
+	w1 = feBytes(new(big.Int).Mod(new(big.Int).SetBytes(ws[KSpake2pWSLength:]), order))
+	return w0, w1, nil
+}
+
+type Spake2pRole uint8
+
+const (
+	Spake2pRoleProver   Spake2pRole = iota // 配对发起方，知道配对码
+	Spake2pRoleVerifier                    // 设备，只保存验证数据
+)
+
+type spake2pState uint8
+
+const (
+	spake2pStateInit spake2pState = iota
+	spake2pStateStarted
+	spake2pStateR1
+	spake2pStateR2
+	spake2pStateKC
+)
+
+// Spake2p SPAKE2+ P256-SHA256-HKDF-HMAC，用于PASE会话的密钥交换
+type Spake2p struct {
+	mRole    Spake2pRole
+	mState   spake2pState
+	mContext []byte
+	mW0      *big.Int
+	mW1      *big.Int
+	mLx      *big.Int
+	mLy      *big.Int
+	mXy      *big.Int
+	mX       []byte
+	mY       []byte
+	mKe      []byte
+	mKcA     []byte
+	mKcB     []byte
+	mRand    io.Reader
+}
+
+func NewSpake2p() *Spake2p {
+	return &Spake2p{mRand: rand.Reader}
+}
+
+// BeginProver 发起方使用 w0、w1 开始协商
+func (s *Spake2p) BeginProver(context, w0, w1 []byte) error {
+	if s.mState != spake2pStateInit || len(w0) != kp256FeLength || len(w1) != kp256FeLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mRole = Spake2pRoleProver
+	s.mContext = append([]byte{}, context...)
+	s.mW0 = new(big.Int).SetBytes(w0)
+	s.mW1 = new(big.Int).SetBytes(w1)
+	s.mState = spake2pStateStarted
+	return nil
+}
+
+// BeginVerifier 设备使用 w0、L 开始协商
+func (s *Spake2p) BeginVerifier(context, w0, l []byte) error {
+	if s.mState != spake2pStateInit || len(w0) != kp256FeLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	lx, ly := elliptic.Unmarshal(elliptic.P256(), l)
+	if lx == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mRole = Spake2pRoleVerifier
+	s.mContext = append([]byte{}, context...)
+	s.mW0 = new(big.Int).SetBytes(w0)
+	s.mLx, s.mLy = lx, ly
+	s.mState = spake2pStateStarted
+	return nil
+}
+
+// ComputeRoundOne 发起方计算 X = x*G + w0*M，设备计算 Y = y*G + w0*N
+func (s *Spake2p) ComputeRoundOne() ([]byte, error) {
+	if s.mState != spake2pStateStarted {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	scalar, err := s.randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	mx, my := elliptic.UnmarshalCompressed(curve, s.blindingPoint())
+	px, py := curve.ScalarBaseMult(feBytes(scalar))
+	bx, by := curve.ScalarMult(mx, my, feBytes(s.mW0))
+	sx, sy := addPoints(px, py, bx, by)
+	share := elliptic.Marshal(curve, sx, sy)
+	s.mXy = scalar
+	if s.mRole == Spake2pRoleProver {
+		s.mX = share
+	} else {
+		s.mY = share
+	}
+	s.mState = spake2pStateR1
+	return share, nil
+}
+
+// ComputeRoundTwo 使用对方的公开值计算共享密钥，返回本方的确认消息
+func (s *Spake2p) ComputeRoundTwo(peerShare []byte) ([]byte, error) {
+	if s.mState != spake2pStateR1 {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	curve := elliptic.P256()
+	qx, qy := elliptic.Unmarshal(curve, peerShare)
+	if qx == nil {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	var peerBlinding []byte
+	if s.mRole == Spake2pRoleProver {
+		s.mY = append([]byte{}, peerShare...)
+		peerBlinding = spake2pN
+	} else {
+		s.mX = append([]byte{}, peerShare...)
+		peerBlinding = spake2pM
+	}
+	// 去掉对方的盲化点：Q - w0*M 或 Q - w0*N
+	bx, by := elliptic.UnmarshalCompressed(curve, peerBlinding)
+	bx, by = curve.ScalarMult(bx, by, feBytes(s.mW0))
+	by = new(big.Int).Sub(curve.Params().P, by)
+	ux, uy := addPoints(qx, qy, bx, by)
+
+	zx, zy := curve.ScalarMult(ux, uy, feBytes(s.mXy))
+	var vx, vy *big.Int
+	if s.mRole == Spake2pRoleProver {
+		vx, vy = curve.ScalarMult(ux, uy, feBytes(s.mW1))
+	} else {
+		vx, vy = curve.ScalarMult(s.mLx, s.mLy, feBytes(s.mXy))
+	}
+
+	tt := sha256.New()
+	for _, field := range [][]byte{
+		s.mContext, nil, nil, spake2pMUncompressed(), spake2pNUncompressed(), s.mX, s.mY,
+		elliptic.Marshal(curve, zx, zy), elliptic.Marshal(curve, vx, vy), feBytes(s.mW0),
+	} {
+		var length [8]byte
+		binary.LittleEndian.PutUint64(length[:], uint64(len(field)))
+		tt.Write(length[:])
+		tt.Write(field)
+	}
+	kaKe := tt.Sum(nil)
+	ka := kaKe[:sha256.Size/2]
+	s.mKe = append([]byte{}, kaKe[sha256.Size/2:]...)
+
+	kc, err := HKDFSHA256(ka, nil, spake2pConfirmationKeysInfo, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	s.mKcA = kc[:sha256.Size/2]
+	s.mKcB = kc[sha256.Size/2:]
+	s.mState = spake2pStateR2
+	if s.mRole == Spake2pRoleProver {
+		return HMACSHA256(s.mKcA, s.mY), nil
+	}
+	return HMACSHA256(s.mKcB, s.mX), nil
+}
+
+// KeyConfirm 校验对方的确认消息
+func (s *Spake2p) KeyConfirm(peerConfirm []byte) error {
+	if s.mState != spake2pStateR2 {
+		return internal.ChipErrorIncorrectState
+	}
+	var expected []byte
+	if s.mRole == Spake2pRoleProver {
+		expected = HMACSHA256(s.mKcB, s.mX)
+	} else {
+		expected = HMACSHA256(s.mKcA, s.mY)
+	}
+	if !hmac.Equal(expected, peerConfirm) {
+		return internal.ChipErrorIntegrityCheckFailed
+	}
+	s.mState = spake2pStateKC
+	return nil
+}
+
+// GetKeys 确认成功后返回共享密钥 Ke
+func (s *Spake2p) GetKeys() ([]byte, error) {
+	if s.mState != spake2pStateKC {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	return s.mKe, nil
+}
+
+func (s *Spake2p) blindingPoint() []byte {
+	if s.mRole == Spake2pRoleProver {
+		return spake2pM
+	}
+	return spake2pN
+}
+
+// randomScalar 生成 [1, n-1] 范围内的随机数
+func (s *Spake2p) randomScalar() (*big.Int, error) {
+	buf := make([]byte, KSpake2pWSLength)
+	if _, err := io.ReadFull(s.mRand, buf); err != nil {
+		return nil, err
+	}
+	n1 := new(big.Int).Sub(elliptic.P256().Params().N, big.NewInt(1))
+	k := new(big.Int).Mod(new(big.Int).SetBytes(buf), n1)
+	return k.Add(k, big.NewInt(1)), nil
+}
+
+func spake2pMUncompressed() []byte {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), spake2pM)
+	return elliptic.Marshal(elliptic.P256(), x, y)
+}
+
+func spake2pNUncompressed() []byte {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), spake2pN)
+	return elliptic.Marshal(elliptic.P256(), x, y)
+}
+
+func addPoints(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	return elliptic.P256().Add(x1, y1, x2, y2)
+}
+
+// feBytes 大端编码的32字节域元素
+func feBytes(v *big.Int) []byte {
+	return v.FillBytes(make([]byte, kp256FeLength))
+}
@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/galenliu/chip/internal"
+	"testing"
+)
+
+// 测试设备的默认参数：配对码 20202021，盐 "SPAKE2P Key Salt"，1000次迭代
+func TestSpake2pVerifierGenerate(t *testing.T) {
+	var verifier Spake2pVerifier
+	if err := verifier.Generate(1000, []byte("SPAKE2P Key Salt"), 20202021); err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := verifier.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "uWFwqugDNGiEck/po7KHwwMwwqZgN10XuyBajPGuyzUEV/iree4lOrao5GuwnlQ65CJzbeUB49s31EH+NEkg0JVI5MGCQGMMT/SRPFNRODm3wH/MBiehuFc6FJ/NH6Rmzw=="
+	if base64.StdEncoding.EncodeToString(serialized) != expected {
+		t.Errorf("unexpected verifier %s", base64.StdEncoding.EncodeToString(serialized))
+	}
+
+	var restored Spake2pVerifier
+	if err := restored.Deserialize(serialized); err != nil {
+		t.Fatal(err)
+	}
+	if restored != verifier {
+		t.Errorf("deserialized verifier mismatch")
+	}
+	serialized[kp256FeLength+1] ^= 0xFF
+	if err := restored.Deserialize(serialized); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("point not on the curve must be rejected")
+	}
+	if err := verifier.Generate(1000, []byte("short"), 20202021); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("short salt must be rejected")
+	}
+}
+
+func runSpake2p(t *testing.T, proverPasscode uint32) (prover, verifier *Spake2p, err error) {
+	salt := []byte("SPAKE2P Key Salt")
+	context := []byte("spake2p test context")
+	var data Spake2pVerifier
+	if err := data.Generate(1000, salt, 20202021); err != nil {
+		t.Fatal(err)
+	}
+	w0, w1, err := ComputeSpake2pW0W1(1000, salt, proverPasscode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prover, verifier = NewSpake2p(), NewSpake2p()
+	if err := prover.BeginProver(context, w0, w1); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.BeginVerifier(context, data.GetW0(), data.GetL()); err != nil {
+		t.Fatal(err)
+	}
+	pA, err := prover.ComputeRoundOne()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pB, err := verifier.ComputeRoundOne()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cB, err := verifier.ComputeRoundTwo(pA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cA, err := prover.ComputeRoundTwo(pB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prover.KeyConfirm(cB); err != nil {
+		return prover, verifier, err
+	}
+	return prover, verifier, verifier.KeyConfirm(cA)
+}
+
+func TestSpake2pRoundTrip(t *testing.T) {
+	prover, verifier, err := runSpake2p(t, 20202021)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proverKey, _ := prover.GetKeys()
+	verifierKey, _ := verifier.GetKeys()
+	if len(proverKey) != KSpake2pSharedSecretLength || !bytes.Equal(proverKey, verifierKey) {
+		t.Errorf("shared secrets mismatch: %x %x", proverKey, verifierKey)
+	}
+	if _, err := prover.ComputeRoundOne(); err != internal.ChipErrorIncorrectState {
+		t.Errorf("round one after confirmation must fail")
+	}
+}
+
+func TestSpake2pWrongPasscode(t *testing.T) {
+	prover, _, err := runSpake2p(t, 20202022)
+	if err != internal.ChipErrorIntegrityCheckFailed {
+		t.Fatalf("expected confirmation failure, got %v", err)
+	}
+	if _, err := prover.GetKeys(); err != internal.ChipErrorIncorrectState {
+		t.Errorf("keys must not be available without confirmation")
+	}
+}
@@ -1,6 +1,8 @@
 package device
 
 import (
+	"bytes"
+	"crypto/rand"
 	"github.com/galenliu/chip/config"
 	"github.com/galenliu/chip/crypto"
 	"github.com/galenliu/chip/internal"
@@ -109,7 +111,7 @@ func (c *CommissionableDataImpl) initCommissionableData(serializedSpake2pVerifie
 	var finalSerializedVerifier []byte
 	if havePaseVerifier {
 		if len(serializedSpake2pVerifier) != crypto.KSpake2pVerifierSerializedLength {
-			log.Error("PASE verifier size invalid: %d", len(serializedSpake2pVerifier))
+			log.Errorf("PASE verifier size invalid: %d", len(serializedSpake2pVerifier))
 			return internal.ChipErrorInvalidArgument
 		}
 		err := spake2pVerifier.Deserialize(serializedSpake2pVerifier)
@@ -150,8 +152,7 @@ func (c *CommissionableDataImpl) initCommissionableData(serializedSpake2pVerifie
 			log.Infof("Failed to generate PASE verifier from passcode: %s", err.Error())
 			return err
 		}
-		//TODO 这里需要确认
-		_, err = passcodeVerifier.Serialize()
+		serializedPasscodeVerifier, err = passcodeVerifier.Serialize()
 		if err != nil {
 			log.Infof("Failed to serialize PASE verifier from passcode: %s", err.Error())
 			return err
@@ -160,16 +161,15 @@ func (c *CommissionableDataImpl) initCommissionableData(serializedSpake2pVerifie
 	// Make sure we actually have a verifier
 	if !havePasscode && !havePaseVerifier {
 		log.Infof("Missing both externally provided verifier and passcode: cannot produce final verifier")
-		//return lib.CHIP_ERROR_INVALID_ARGUMENT
+		return internal.ChipErrorInvalidArgument
 	}
 
 	if havePasscode && havePaseVerifier {
-		//if (serializedPasscodeVerifier != serializedSpake2pVerifier.Value())
-		//{
-		//	ChipLogError(Support, "Mismatching verifier between passcode and external verifier. Validate inputs.");
-		//	return CHIP_ERROR_INVALID_ARGUMENT;
-		//}
-		//ChipLogProgress(Support, "Validated externally provided passcode matches the one generated from provided passcode.");
+		if !bytes.Equal(serializedPasscodeVerifier, serializedSpake2pVerifier) {
+			log.Infof("Mismatching verifier between passcode and external verifier. Validate inputs.")
+			return internal.ChipErrorInvalidArgument
+		}
+		log.Infof("Validated externally provided passcode matches the one generated from provided passcode.")
 	}
 
 	if havePaseVerifier {
@@ -237,6 +237,11 @@ func (c CommissionableDataImpl) SetSetupPasscode(uint322 uint32) error {
 	return internal.ChipErrorNotImplemented
 }
 
+// GeneratePaseSalt 生成最大长度的随机盐
 func GeneratePaseSalt() ([]byte, error) {
-	return []byte("Pase Salt 2022"), nil
+	salt := make([]byte, crypto.KSpake2pMaxPbkdfSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
 }
@@ -2,10 +2,11 @@ package device
 
 import (
 	"fmt"
+	"github.com/galenliu/chip/lib"
 )
 
 type InstanceName uint64
-type FabricIndex uint8
+type FabricIndex = lib.FabricIndex
 
 func (name InstanceName) String() string {
 	var v = uint(name)
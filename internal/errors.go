@@ -3,9 +3,57 @@ package internal
 import "fmt"
 
 var (
-	ChipErrorInvalidArgument      = fmt.Errorf("CHIP_ERROR_INVALID_ARGUMENT")
-	ChipErrorIncorrectState       = fmt.Errorf("CHIP_ERROR_INCORRECT_STATE")
-	ChipErrorNotImplemented       = fmt.Errorf("CHIP_ERROR_NOT_IMPLEMENTED")
-	ChipErrorInternal             = fmt.Errorf("CHIP_ERROR_INTERNAL")
-	ChipDeviceErrorConfigNotFound = fmt.Errorf("CHIP_DEVICE_ERROR_CONFIG_NOT_FOUND")
+	ChipErrorInvalidArgument               = fmt.Errorf("CHIP_ERROR_INVALID_ARGUMENT")
+	ChipErrorIncorrectState                = fmt.Errorf("CHIP_ERROR_INCORRECT_STATE")
+	ChipErrorNotImplemented                = fmt.Errorf("CHIP_ERROR_NOT_IMPLEMENTED")
+	ChipErrorInternal                      = fmt.Errorf("CHIP_ERROR_INTERNAL")
+	ChipErrorVersionMismatch               = fmt.Errorf("CHIP_ERROR_VERSION_MISMATCH")
+	ChipErrorBufferTooSmall                = fmt.Errorf("CHIP_ERROR_BUFFER_TOO_SMALL")
+	ChipErrorMessageTooLong                = fmt.Errorf("CHIP_ERROR_MESSAGE_TOO_LONG")
+	ChipErrorNoMessageHandler              = fmt.Errorf("CHIP_ERROR_NO_MESSAGE_HANDLER")
+	ChipErrorIntegrityCheckFailed          = fmt.Errorf("CHIP_ERROR_INTEGRITY_CHECK_FAILED")
+	ChipErrorDuplicateMessageReceived      = fmt.Errorf("CHIP_ERROR_DUPLICATE_MESSAGE_RECEIVED")
+	ChipErrorNoMemory                      = fmt.Errorf("CHIP_ERROR_NO_MEMORY")
+	ChipErrorKeyNotFound                   = fmt.Errorf("CHIP_ERROR_KEY_NOT_FOUND")
+	ChipErrorNotConnected                  = fmt.Errorf("CHIP_ERROR_NOT_CONNECTED")
+	ChipErrorPersistedStorageValueNotFound = fmt.Errorf("CHIP_ERROR_PERSISTED_STORAGE_VALUE_NOT_FOUND")
+	ChipErrorPersistedStorageFailed        = fmt.Errorf("CHIP_ERROR_PERSISTED_STORAGE_FAILED")
+	ChipErrorMessageCounterExhausted       = fmt.Errorf("CHIP_ERROR_MESSAGE_COUNTER_EXHAUSTED")
+	ChipErrorTooManyPeerNodes              = fmt.Errorf("CHIP_ERROR_TOO_MANY_PEER_NODES")
+	ChipErrorMessageNotAcknowledged        = fmt.Errorf("CHIP_ERROR_MESSAGE_NOT_ACKNOWLEDGED")
+	ChipErrorEndOfTLV                      = fmt.Errorf("CHIP_END_OF_TLV")
+	ChipErrorTLVUnderrun                   = fmt.Errorf("CHIP_ERROR_TLV_UNDERRUN")
+	ChipErrorInvalidTLVElement             = fmt.Errorf("CHIP_ERROR_INVALID_TLV_ELEMENT")
+	ChipErrorInvalidTLVTag                 = fmt.Errorf("CHIP_ERROR_INVALID_TLV_TAG")
+	ChipErrorWrongTLVType                  = fmt.Errorf("CHIP_ERROR_WRONG_TLV_TYPE")
+	ChipErrorTLVContainerOpen              = fmt.Errorf("CHIP_ERROR_TLV_CONTAINER_OPEN")
+	ChipErrorUnexpectedTLVElement          = fmt.Errorf("CHIP_ERROR_UNEXPECTED_TLV_ELEMENT")
+	ChipErrorTLVTagNotFound                = fmt.Errorf("CHIP_ERROR_TLV_TAG_NOT_FOUND")
+	ChipErrorInvalidMessageType            = fmt.Errorf("CHIP_ERROR_INVALID_MESSAGE_TYPE")
+	ChipErrorInvalidPASEParameter          = fmt.Errorf("CHIP_ERROR_INVALID_PASE_PARAMETER")
+	ChipErrorTimeout                       = fmt.Errorf("CHIP_ERROR_TIMEOUT")
+	ChipErrorInvalidSignature              = fmt.Errorf("CHIP_ERROR_INVALID_SIGNATURE")
+	ChipErrorInvalidCASEParameter          = fmt.Errorf("CHIP_ERROR_INVALID_CASE_PARAMETER")
+	ChipErrorUnsupportedCertFormat         = fmt.Errorf("CHIP_ERROR_UNSUPPORTED_CERT_FORMAT")
+	ChipErrorUnsupportedSignatureType      = fmt.Errorf("CHIP_ERROR_UNSUPPORTED_SIGNATURE_TYPE")
+	ChipErrorUnsupportedEllipticCurve      = fmt.Errorf("CHIP_ERROR_UNSUPPORTED_ELLIPTIC_CURVE")
+	ChipErrorWrongCertDN                   = fmt.Errorf("CHIP_ERROR_WRONG_CERT_DN")
+	ChipErrorWrongCertType                 = fmt.Errorf("CHIP_ERROR_WRONG_CERT_TYPE")
+	ChipErrorWrongNodeId                   = fmt.Errorf("CHIP_ERROR_WRONG_NODE_ID")
+	ChipErrorInvalidFabricIndex            = fmt.Errorf("CHIP_ERROR_INVALID_FABRIC_INDEX")
+	ChipErrorNotFound                      = fmt.Errorf("CHIP_ERROR_NOT_FOUND")
+	ChipErrorCertNotFound                  = fmt.Errorf("CHIP_ERROR_CERT_NOT_FOUND")
+	ChipErrorCACertNotFound                = fmt.Errorf("CHIP_ERROR_CA_CERT_NOT_FOUND")
+	ChipErrorCertNotTrusted                = fmt.Errorf("CHIP_ERROR_CERT_NOT_TRUSTED")
+	ChipErrorCertExpired                   = fmt.Errorf("CHIP_ERROR_CERT_EXPIRED")
+	ChipErrorCertNotValidYet               = fmt.Errorf("CHIP_ERROR_CERT_NOT_VALID_YET")
+	ChipErrorCertUsageNotAllowed           = fmt.Errorf("CHIP_ERROR_CERT_USAGE_NOT_ALLOWED")
+	ChipErrorCertPathLenConstraintExceeded = fmt.Errorf("CHIP_ERROR_CERT_PATH_LEN_CONSTRAINT_EXCEEDED")
+	ChipErrorInvalidTime                   = fmt.Errorf("CHIP_ERROR_INVALID_TIME")
+	ChipErrorCertPathTooLong               = fmt.Errorf("CHIP_ERROR_CERT_PATH_TOO_LONG")
+	ChipErrorFabricExists                  = fmt.Errorf("CHIP_ERROR_FABRIC_EXISTS")
+	ChipErrorFabricMismatchOnICA           = fmt.Errorf("CHIP_ERROR_FABRIC_MISMATCH_ON_ICA")
+	ChipErrorInvalidPublicKey              = fmt.Errorf("CHIP_ERROR_INVALID_PUBLIC_KEY")
+	ChipErrorAccessDenied                  = fmt.Errorf("CHIP_ERROR_ACCESS_DENIED")
+	ChipDeviceErrorConfigNotFound          = fmt.Errorf("CHIP_DEVICE_ERROR_CONFIG_NOT_FOUND")
 )
@@ -14,6 +14,12 @@ type ProductId uint16
 
 type GroupId uint16
 
+type EndpointId uint16
+
+type ClusterId uint32
+
+type DeviceTypeId uint32
+
 type UniversalGroupID uint16
 
 type NodeId uint64
@@ -24,5 +30,88 @@ type GroupNodeID uint64
 
 type TemporaryLocalNodeId uint64
 
+type FabricIndex uint8
+
+const (
+	KUndefinedNodeId NodeId = 0
+
+	// KUndefinedFabricId 无效的FabricId
+	KUndefinedFabricId FabricId = 0
+
+	// KUndefinedFabricIndex 无效的FabricIndex，有效的范围是 [1, 254]
+	KUndefinedFabricIndex FabricIndex = 0
+	KMinValidFabricIndex  FabricIndex = 1
+	KMaxValidFabricIndex  FabricIndex = 0xFE
+
+	// KUndefinedGroupId 无效的GroupId
+	KUndefinedGroupId GroupId = 0
+
+	kMinOperationalNodeId NodeId = 0x0000_0000_0000_0001
+	kMaxOperationalNodeId NodeId = 0xFFFF_FFEF_FFFF_FFFF
+
+	// CAT 和组使用保留的 NodeId 范围，低位分别是 CAT 和 GroupId
+	kMinCASEAuthTagNodeId NodeId = 0xFFFF_FFFD_0000_0000
+	kMaxCASEAuthTagNodeId NodeId = 0xFFFF_FFFD_FFFF_FFFF
+	kMinGroupNodeId       NodeId = 0xFFFF_FFFF_FFFF_0000
+	kMaxGroupNodeId       NodeId = 0xFFFF_FFFF_FFFF_FFFF
+)
+
+// IsOperationalNodeId 判断是否为有效的运行节点ID
+func (n NodeId) IsOperationalNodeId() bool {
+	return n >= kMinOperationalNodeId && n <= kMaxOperationalNodeId
+}
+
+// IsGroupId 判断是否为组的 NodeId
+func (n NodeId) IsGroupId() bool {
+	return n >= kMinGroupNodeId && n <= kMaxGroupNodeId
+}
+
+// IsCASEAuthTag 判断是否为 CAT 的 NodeId
+func (n NodeId) IsCASEAuthTag() bool {
+	return n >= kMinCASEAuthTagNodeId && n <= kMaxCASEAuthTagNodeId
+}
+
+// GroupId 组的 NodeId 的低16位为 GroupId
+func (n NodeId) GroupId() GroupId {
+	return GroupId(n)
+}
+
+// CASEAuthTag CAT 的 NodeId 的低32位为 CAT
+func (n NodeId) CASEAuthTag() CASEAuthTag {
+	return CASEAuthTag(n)
+}
+
+func NodeIdFromGroupId(groupId GroupId) NodeId {
+	return kMinGroupNodeId | NodeId(groupId)
+}
+
+func NodeIdFromCASEAuthTag(tag CASEAuthTag) NodeId {
+	return kMinCASEAuthTagNodeId | NodeId(tag)
+}
+
+// IsValidFabricIndex 判断是否为有效的FabricIndex
+func (f FabricIndex) IsValidFabricIndex() bool {
+	return f >= KMinValidFabricIndex && f <= KMaxValidFabricIndex
+}
+
+// ScopedNodeId 在某个Fabric范围内标识一个节点
 type ScopedNodeId struct {
+	mNodeId      NodeId
+	mFabricIndex FabricIndex
+}
+
+func NewScopedNodeId(nodeId NodeId, fabricIndex FabricIndex) ScopedNodeId {
+	return ScopedNodeId{mNodeId: nodeId, mFabricIndex: fabricIndex}
+}
+
+func (s ScopedNodeId) GetNodeId() NodeId {
+	return s.mNodeId
+}
+
+func (s ScopedNodeId) GetFabricIndex() FabricIndex {
+	return s.mFabricIndex
+}
+
+func (s ScopedNodeId) IsOperational() bool {
+	return s.mFabricIndex != KUndefinedFabricIndex && s.mNodeId.IsOperationalNodeId()
 }
@@ -0,0 +1,103 @@
+package lib
+
+// KMaxSubjectCATAttributeCount NOC 主题中最多携带的 CAT 数量
+const KMaxSubjectCATAttributeCount = 3
+
+const (
+	// KUndefinedCAT 未使用的 CAT
+	KUndefinedCAT CASEAuthTag = 0
+	// KAdminCATIdentifier 管理员使用的 CAT 标识
+	KAdminCATIdentifier uint16 = 0xFFFF
+	// KAnchorCATIdentifier 锚点管理员使用的 CAT 标识
+	KAnchorCATIdentifier uint16 = 0xFFFE
+
+	kTagIdentifierShift = 16
+	kTagVersionMask     = 0xFFFF
+)
+
+// CASEAuthTag CASE 认证标签，高16位为标识，低16位为版本
+type CASEAuthTag uint32
+
+func NewCASEAuthTag(identifier, version uint16) CASEAuthTag {
+	return CASEAuthTag(identifier)<<kTagIdentifierShift | CASEAuthTag(version)
+}
+
+func (t CASEAuthTag) GetIdentifier() uint16 {
+	return uint16(t >> kTagIdentifierShift)
+}
+
+func (t CASEAuthTag) GetVersion() uint16 {
+	return uint16(t & kTagVersionMask)
+}
+
+// IsValid 版本为0的 CAT 无效
+func (t CASEAuthTag) IsValid() bool {
+	return t.GetVersion() != 0
+}
+
+// CATValues 节点的 CAT，未使用的位置为 0
+type CATValues [KMaxSubjectCATAttributeCount]CASEAuthTag
+
+// GetNumTagsPresent 返回已使用的 CAT 数量
+func (c CATValues) GetNumTagsPresent() int {
+	count := 0
+	for _, tag := range c {
+		if tag != KUndefinedCAT {
+			count++
+		}
+	}
+	return count
+}
+
+func (c CATValues) Contains(tag CASEAuthTag) bool {
+	if tag == KUndefinedCAT {
+		return false
+	}
+	for _, t := range c {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CATValues) ContainsIdentifier(identifier uint16) bool {
+	for _, t := range c {
+		if t != KUndefinedCAT && t.GetIdentifier() == identifier {
+			return true
+		}
+	}
+	return false
+}
+
+// AreValid 所有 CAT 的版本都不为0，并且标识不重复
+func (c CATValues) AreValid() bool {
+	for i, t := range c {
+		if t == KUndefinedCAT {
+			continue
+		}
+		if !t.IsValid() {
+			return false
+		}
+		for _, other := range c[i+1:] {
+			if other != KUndefinedCAT && other.GetIdentifier() == t.GetIdentifier() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CheckSubjectAgainstCATs 主体是 CAT 时，标识相同并且版本不低于主体的版本即匹配
+func (c CATValues) CheckSubjectAgainstCATs(subject NodeId) bool {
+	if !subject.IsCASEAuthTag() {
+		return false
+	}
+	required := subject.CASEAuthTag()
+	for _, t := range c {
+		if t != KUndefinedCAT && t.GetIdentifier() == required.GetIdentifier() && t.GetVersion() >= required.GetVersion() {
+			return true
+		}
+	}
+	return false
+}
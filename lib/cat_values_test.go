@@ -0,0 +1,55 @@
+package lib
+
+import "testing"
+
+func TestCASEAuthTag(t *testing.T) {
+	tag := NewCASEAuthTag(0xABCD, 0x0002)
+	if tag != 0xABCD_0002 || tag.GetIdentifier() != 0xABCD || tag.GetVersion() != 0x0002 || !tag.IsValid() {
+		t.Errorf("unexpected tag 0x%08X", uint32(tag))
+	}
+	if NewCASEAuthTag(0xABCD, 0).IsValid() {
+		t.Error("tag with version 0 must be invalid")
+	}
+	node := NodeIdFromCASEAuthTag(tag)
+	if !node.IsCASEAuthTag() || node.CASEAuthTag() != tag {
+		t.Errorf("unexpected CAT subject 0x%016X", uint64(node))
+	}
+}
+
+func TestCATValuesAreValid(t *testing.T) {
+	for _, tc := range []struct {
+		cats     CATValues
+		expected bool
+	}{
+		{CATValues{}, true},
+		{CATValues{0xABCD_0001, 0x1234_0003}, true},
+		{CATValues{0xABCD_0000}, false},
+		{CATValues{0xABCD_0001, 0xABCD_0002}, false},
+	} {
+		if tc.cats.AreValid() != tc.expected {
+			t.Errorf("%v: expected %v", tc.cats, tc.expected)
+		}
+	}
+	cats := CATValues{0xABCD_0001, 0x1234_0003}
+	if cats.GetNumTagsPresent() != 2 || !cats.Contains(0x1234_0003) || cats.Contains(KUndefinedCAT) || !cats.ContainsIdentifier(0xABCD) {
+		t.Errorf("unexpected lookup results for %v", cats)
+	}
+}
+
+func TestCATValuesCheckSubject(t *testing.T) {
+	cats := CATValues{0xABCD_0002}
+	for _, tc := range []struct {
+		subject  NodeId
+		expected bool
+	}{
+		{NodeIdFromCASEAuthTag(0xABCD_0001), true},
+		{NodeIdFromCASEAuthTag(0xABCD_0002), true},
+		{NodeIdFromCASEAuthTag(0xABCD_0003), false},
+		{NodeIdFromCASEAuthTag(0x1234_0001), false},
+		{0x0000_0000_0000_0011, false},
+	} {
+		if cats.CheckSubjectAgainstCATs(tc.subject) != tc.expected {
+			t.Errorf("subject 0x%016X: expected %v", uint64(tc.subject), tc.expected)
+		}
+	}
+}
@@ -1,20 +1,247 @@
 package lib
 
-import "github.com/galenliu/chip/storage"
+import (
+	"encoding/base64"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/storage"
+	"sync"
+)
 
+const (
+	// KResumptionIdSize 会话恢复ID的长度
+	KResumptionIdSize = 16
+	// KDefaultSessionResumptionCacheSize 最多保存的会话恢复状态数量，超出后淘汰最久未使用的
+	KDefaultSessionResumptionCacheSize = 4 * 16
+)
+
+type ResumptionIdStorage [KResumptionIdSize]byte
+
+// SessionResumptionStorage 保存 CASE 会话恢复需要的恢复ID、共享密钥和对端的 CAT
 type SessionResumptionStorage interface {
 	Init(delegate storage.PersistentStorageDelegate) error
+	FindByScopedNodeId(node ScopedNodeId) (ResumptionIdStorage, []byte, CATValues, error)
+	FindByResumptionId(resumptionId ResumptionIdStorage) (ScopedNodeId, []byte, CATValues, error)
+	// Save 保存节点的会话恢复状态，同一个节点旧的状态会被替换
+	Save(node ScopedNodeId, resumptionId ResumptionIdStorage, sharedSecret []byte, peerCATs CATValues) error
+	Delete(node ScopedNodeId) error
+	// DeleteAll 删除Fabric下的所有会话恢复状态
+	DeleteAll(fabricIndex FabricIndex) error
 }
 
+type resumptionIndexEntry struct {
+	NodeId      uint64 `tlv:"1"`
+	FabricIndex uint8  `tlv:"2"`
+}
+
+type resumptionIndex struct {
+	Nodes []resumptionIndexEntry `tlv:"1"`
+}
+
+type resumptionState struct {
+	ResumptionId []byte   `tlv:"1"`
+	SharedSecret []byte   `tlv:"2"`
+	PeerCATs     []uint32 `tlv:"3,omitempty"`
+}
+
+// SessionResumptionStorageImpl 把会话恢复状态保存在持久化存储中，
+// 索引按使用顺序排列，最新保存的在最后
 type SessionResumptionStorageImpl struct {
+	mMutex   sync.Mutex
 	mStorage storage.PersistentStorageDelegate
+	mMaxSize int
+}
+
+func NewSimpleSessionResumptionStorage() *SessionResumptionStorageImpl {
+	return &SessionResumptionStorageImpl{mMaxSize: KDefaultSessionResumptionCacheSize}
 }
 
 func (s *SessionResumptionStorageImpl) Init(delegate storage.PersistentStorageDelegate) error {
+	if delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
 	s.mStorage = delegate
 	return nil
 }
 
-func NewSimpleSessionResumptionStorage() *SessionResumptionStorageImpl {
-	return &SessionResumptionStorageImpl{}
+func (s *SessionResumptionStorageImpl) FindByScopedNodeId(node ScopedNodeId) (ResumptionIdStorage, []byte, CATValues, error) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return ResumptionIdStorage{}, nil, CATValues{}, internal.ChipErrorIncorrectState
+	}
+	return s.loadStateLocked(node)
+}
+
+func (s *SessionResumptionStorageImpl) FindByResumptionId(resumptionId ResumptionIdStorage) (ScopedNodeId, []byte, CATValues, error) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return ScopedNodeId{}, nil, CATValues{}, internal.ChipErrorIncorrectState
+	}
+	var entry resumptionIndexEntry
+	if err := s.readLocked(storage.SessionResumption(encodeResumptionId(resumptionId)), &entry); err != nil {
+		return ScopedNodeId{}, nil, CATValues{}, err
+	}
+	node := NewScopedNodeId(NodeId(entry.NodeId), FabricIndex(entry.FabricIndex))
+	storedId, sharedSecret, peerCATs, err := s.loadStateLocked(node)
+	if err != nil {
+		return ScopedNodeId{}, nil, CATValues{}, err
+	}
+	// 节点的状态已被新的恢复ID替换
+	if storedId != resumptionId {
+		return ScopedNodeId{}, nil, CATValues{}, internal.ChipErrorKeyNotFound
+	}
+	return node, sharedSecret, peerCATs, nil
+}
+
+func (s *SessionResumptionStorageImpl) Save(node ScopedNodeId, resumptionId ResumptionIdStorage, sharedSecret []byte, peerCATs CATValues) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !node.IsOperational() || len(sharedSecret) == 0 {
+		return internal.ChipErrorInvalidArgument
+	}
+	index, err := s.loadIndexLocked()
+	if err != nil {
+		return err
+	}
+	// 先删除旧的状态，保存后节点移到索引的末尾
+	if i := index.find(node); i >= 0 {
+		s.deleteStateLocked(node)
+		index.Nodes = append(index.Nodes[:i], index.Nodes[i+1:]...)
+	}
+	for len(index.Nodes) >= s.mMaxSize {
+		oldest := index.Nodes[0]
+		s.deleteStateLocked(NewScopedNodeId(NodeId(oldest.NodeId), FabricIndex(oldest.FabricIndex)))
+		index.Nodes = index.Nodes[1:]
+	}
+
+	state := resumptionState{ResumptionId: resumptionId[:], SharedSecret: sharedSecret}
+	for _, cat := range peerCATs {
+		if cat != 0 {
+			state.PeerCATs = append(state.PeerCATs, uint32(cat))
+		}
+	}
+	entry := resumptionIndexEntry{NodeId: uint64(node.GetNodeId()), FabricIndex: uint8(node.GetFabricIndex())}
+	if err := s.writeLocked(storage.FabricSession(entry.FabricIndex, entry.NodeId), state); err != nil {
+		return err
+	}
+	if err := s.writeLocked(storage.SessionResumption(encodeResumptionId(resumptionId)), entry); err != nil {
+		_ = s.mStorage.SyncDeleteKeyValue(storage.FabricSession(entry.FabricIndex, entry.NodeId))
+		return err
+	}
+	index.Nodes = append(index.Nodes, entry)
+	return s.writeLocked(storage.SessionResumptionIndex(), index)
+}
+
+func (s *SessionResumptionStorageImpl) Delete(node ScopedNodeId) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	index, err := s.loadIndexLocked()
+	if err != nil {
+		return err
+	}
+	i := index.find(node)
+	if i < 0 {
+		return internal.ChipErrorKeyNotFound
+	}
+	s.deleteStateLocked(node)
+	index.Nodes = append(index.Nodes[:i], index.Nodes[i+1:]...)
+	return s.writeLocked(storage.SessionResumptionIndex(), index)
+}
+
+func (s *SessionResumptionStorageImpl) DeleteAll(fabricIndex FabricIndex) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	index, err := s.loadIndexLocked()
+	if err != nil {
+		return err
+	}
+	nodes := index.Nodes[:0]
+	for _, entry := range index.Nodes {
+		if FabricIndex(entry.FabricIndex) == fabricIndex {
+			s.deleteStateLocked(NewScopedNodeId(NodeId(entry.NodeId), fabricIndex))
+			continue
+		}
+		nodes = append(nodes, entry)
+	}
+	index.Nodes = nodes
+	return s.writeLocked(storage.SessionResumptionIndex(), index)
+}
+
+func (s *SessionResumptionStorageImpl) loadStateLocked(node ScopedNodeId) (ResumptionIdStorage, []byte, CATValues, error) {
+	var resumptionId ResumptionIdStorage
+	var peerCATs CATValues
+	var state resumptionState
+	if err := s.readLocked(storage.FabricSession(uint8(node.GetFabricIndex()), uint64(node.GetNodeId())), &state); err != nil {
+		return resumptionId, nil, peerCATs, err
+	}
+	if len(state.ResumptionId) != KResumptionIdSize || len(state.PeerCATs) > KMaxSubjectCATAttributeCount {
+		return resumptionId, nil, peerCATs, internal.ChipErrorIncorrectState
+	}
+	copy(resumptionId[:], state.ResumptionId)
+	for i, cat := range state.PeerCATs {
+		peerCATs[i] = CASEAuthTag(cat)
+	}
+	return resumptionId, state.SharedSecret, peerCATs, nil
+}
+
+// deleteStateLocked 删除节点的状态和恢复ID的映射，不修改索引
+func (s *SessionResumptionStorageImpl) deleteStateLocked(node ScopedNodeId) {
+	if resumptionId, _, _, err := s.loadStateLocked(node); err == nil {
+		_ = s.mStorage.SyncDeleteKeyValue(storage.SessionResumption(encodeResumptionId(resumptionId)))
+	}
+	_ = s.mStorage.SyncDeleteKeyValue(storage.FabricSession(uint8(node.GetFabricIndex()), uint64(node.GetNodeId())))
+}
+
+func (s *SessionResumptionStorageImpl) loadIndexLocked() (*resumptionIndex, error) {
+	index := &resumptionIndex{}
+	err := s.readLocked(storage.SessionResumptionIndex(), index)
+	if err == internal.ChipErrorPersistedStorageValueNotFound {
+		return index, nil
+	}
+	return index, err
+}
+
+func (s *SessionResumptionStorageImpl) readLocked(key string, v any) error {
+	if !s.mStorage.SyncDoesKeyExist(key) {
+		return internal.ChipErrorPersistedStorageValueNotFound
+	}
+	value, err := s.mStorage.ReadValueBin(key)
+	if err != nil {
+		return err
+	}
+	return tlv.Unmarshal(value, v)
+}
+
+func (s *SessionResumptionStorageImpl) writeLocked(key string, v any) error {
+	data, err := tlv.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.mStorage.WriteValueBin(key, data)
+}
+
+func (index *resumptionIndex) find(node ScopedNodeId) int {
+	for i, entry := range index.Nodes {
+		if NodeId(entry.NodeId) == node.GetNodeId() && FabricIndex(entry.FabricIndex) == node.GetFabricIndex() {
+			return i
+		}
+	}
+	return -1
+}
+
+func encodeResumptionId(resumptionId ResumptionIdStorage) string {
+	return base64.StdEncoding.EncodeToString(resumptionId[:])
 }
@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/storage"
+	"testing"
+)
+
+func newTestResumptionStorage(t *testing.T, maxSize int) *SessionResumptionStorageImpl {
+	t.Helper()
+	s := NewSimpleSessionResumptionStorage()
+	s.mMaxSize = maxSize
+	if err := s.Init(storage.NewInMemoryPersistentStorage()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testResumptionId(b byte) ResumptionIdStorage {
+	var id ResumptionIdStorage
+	for i := range id {
+		id[i] = b
+	}
+	return id
+}
+
+func TestSessionResumptionStorageSaveAndFind(t *testing.T) {
+	s := newTestResumptionStorage(t, KDefaultSessionResumptionCacheSize)
+	node := NewScopedNodeId(0x1234, 1)
+	cats := CATValues{0xABCD0001}
+	if err := s.Save(node, testResumptionId(1), []byte("secret"), cats); err != nil {
+		t.Fatal(err)
+	}
+	id, secret, peerCATs, err := s.FindByScopedNodeId(node)
+	if err != nil || id != testResumptionId(1) || string(secret) != "secret" || peerCATs != cats {
+		t.Fatalf("unexpected state %x %q %v %v", id, secret, peerCATs, err)
+	}
+	found, _, _, err := s.FindByResumptionId(testResumptionId(1))
+	if err != nil || found != node {
+		t.Fatalf("lookup by resumption id failed: %v %v", found, err)
+	}
+
+	// 新的恢复ID替换旧的
+	if err := s.Save(node, testResumptionId(2), []byte("secret2"), CATValues{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.FindByResumptionId(testResumptionId(1)); err == nil {
+		t.Errorf("stale resumption id must not be found")
+	}
+	if _, secret, _, err := s.FindByResumptionId(testResumptionId(2)); err != nil || string(secret) != "secret2" {
+		t.Errorf("new resumption id not found: %v", err)
+	}
+
+	if err := s.Delete(node); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.FindByScopedNodeId(node); err != internal.ChipErrorPersistedStorageValueNotFound {
+		t.Errorf("deleted state must not be found, got %v", err)
+	}
+	if err := s.Delete(node); err != internal.ChipErrorKeyNotFound {
+		t.Errorf("deleting twice must fail, got %v", err)
+	}
+}
+
+func TestSessionResumptionStorageEviction(t *testing.T) {
+	s := newTestResumptionStorage(t, 2)
+	a, b, c := NewScopedNodeId(1, 1), NewScopedNodeId(2, 1), NewScopedNodeId(3, 2)
+	for i, node := range []ScopedNodeId{a, b} {
+		if err := s.Save(node, testResumptionId(byte(i+1)), []byte{1}, CATValues{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 重新保存 a 后 b 成为最久未使用的
+	if err := s.Save(a, testResumptionId(3), []byte{1}, CATValues{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(c, testResumptionId(4), []byte{1}, CATValues{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.FindByScopedNodeId(b); err == nil {
+		t.Errorf("least recently used entry must be evicted")
+	}
+	if _, _, _, err := s.FindByResumptionId(testResumptionId(2)); err == nil {
+		t.Errorf("evicted resumption id must not be found")
+	}
+	for _, node := range []ScopedNodeId{a, c} {
+		if _, _, _, err := s.FindByScopedNodeId(node); err != nil {
+			t.Errorf("entry %v must be kept: %v", node, err)
+		}
+	}
+
+	if err := s.DeleteAll(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.FindByScopedNodeId(a); err == nil {
+		t.Errorf("fabric entries must be deleted")
+	}
+	if _, _, _, err := s.FindByScopedNodeId(c); err != nil {
+		t.Errorf("other fabrics must be kept: %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+package tlv
+
+import (
+	"github.com/galenliu/chip/internal"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Marshaler 自定义TLV编码的类型
+type Marshaler interface {
+	MarshalTLV(w *Writer, tag Tag) error
+}
+
+// Unmarshaler 自定义TLV解码的类型，调用时 Reader 位于该类型对应的元素上
+type Unmarshaler interface {
+	UnmarshalTLV(r *Reader) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// fieldInfo 结构体字段的标签，格式为 `tlv:"1,omitempty,list"`：
+// 数字是上下文标签，omitempty 表示可选字段，零值不编码；list 把切片编码为列表而不是数组。
+// 没有 tlv 标签的字段不参与编解码
+type fieldInfo struct {
+	mIndex     int
+	mTag       uint8
+	mOmitEmpty bool
+	mList      bool
+}
+
+func structFields(t reflect.Type) ([]fieldInfo, error) {
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value, ok := field.Tag.Lookup("tlv")
+		if !ok || value == "-" || !field.IsExported() {
+			continue
+		}
+		parts := strings.Split(value, ",")
+		number, err := strconv.ParseUint(parts[0], 10, 8)
+		if err != nil {
+			return nil, internal.ChipErrorInvalidTLVTag
+		}
+		info := fieldInfo{mIndex: i, mTag: uint8(number)}
+		for _, option := range parts[1:] {
+			switch option {
+			case "omitempty":
+				info.mOmitEmpty = true
+			case "list":
+				info.mList = true
+			}
+		}
+		fields = append(fields, info)
+	}
+	return fields, nil
+}
+
+// Marshal 把值编码为匿名标签的TLV元素
+func Marshal(v any) ([]byte, error) {
+	w := NewWriter()
+	if err := Encode(w, AnonymousTag(), v); err != nil {
+		return nil, err
+	}
+	return w.Finalize()
+}
+
+// Encode 使用指定的标签把值写入 Writer
+func Encode(w *Writer, tag Tag, v any) error {
+	return encodeValue(w, tag, reflect.ValueOf(v), false)
+}
+
+func encodeValue(w *Writer, tag Tag, v reflect.Value, asList bool) error {
+	if !v.IsValid() {
+		return w.PutNull(tag)
+	}
+	if v.Type().Implements(marshalerType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return w.PutNull(tag)
+		}
+		return v.Interface().(Marshaler).MarshalTLV(w, tag)
+	}
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(marshalerType) {
+		return v.Addr().Interface().(Marshaler).MarshalTLV(w, tag)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return w.PutNull(tag)
+		}
+		return encodeValue(w, tag, v.Elem(), asList)
+	case reflect.Bool:
+		return w.PutBool(tag, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return w.PutInt(tag, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return w.PutUint(tag, v.Uint())
+	case reflect.Float32:
+		return w.PutFloat32(tag, float32(v.Float()))
+	case reflect.Float64:
+		return w.PutFloat64(tag, v.Float())
+	case reflect.String:
+		return w.PutString(tag, v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return w.PutBytes(tag, data)
+		}
+		containerType := TypeArray
+		if asList {
+			containerType = TypeList
+		}
+		if err := w.StartContainer(tag, containerType); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(w, AnonymousTag(), v.Index(i), false); err != nil {
+				return err
+			}
+		}
+		return w.EndContainer()
+	case reflect.Struct:
+		return encodeStruct(w, tag, v)
+	default:
+		return internal.ChipErrorWrongTLVType
+	}
+}
+
+func encodeStruct(w *Writer, tag Tag, v reflect.Value) error {
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+	if err := w.StartStructure(tag); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		value := v.Field(field.mIndex)
+		if field.mOmitEmpty && isEmptyValue(value) {
+			continue
+		}
+		if err := encodeValue(w, ContextTag(field.mTag), value, field.mList); err != nil {
+			return err
+		}
+	}
+	return w.EndContainer()
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		return v.IsNil() || (v.Kind() == reflect.Slice && v.Len() == 0)
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Struct, reflect.Array:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
+// Unmarshal 解码一个TLV元素到 v 指向的值
+func Unmarshal(data []byte, v any) error {
+	r := NewReader(data)
+	if err := r.Next(); err != nil {
+		return err
+	}
+	return Decode(r, v)
+}
+
+// Decode 把 Reader 当前的元素解码到 v 指向的值
+func Decode(r *Reader, v any) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return internal.ChipErrorInvalidArgument
+	}
+	return decodeValue(r, value.Elem())
+}
+
+func decodeValue(r *Reader, v reflect.Value) error {
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(unmarshalerType) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalTLV(r)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if r.IsNull() {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(r, v.Elem())
+	case reflect.Bool:
+		value, err := r.GetBool()
+		if err != nil {
+			return err
+		}
+		v.SetBool(value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := getInt(r)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(value) {
+			return internal.ChipErrorInvalidTLVElement
+		}
+		v.SetInt(value)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		value, err := getUint(r)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(value) {
+			return internal.ChipErrorInvalidTLVElement
+		}
+		v.SetUint(value)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		value, err := r.GetFloat()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(value)
+		return nil
+	case reflect.String:
+		value, err := r.GetString()
+		if err != nil {
+			return err
+		}
+		v.SetString(value)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			value, err := r.GetBytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(value)
+			return nil
+		}
+		return decodeSlice(r, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return internal.ChipErrorWrongTLVType
+		}
+		value, err := r.GetBytes()
+		if err != nil {
+			return err
+		}
+		if len(value) != v.Len() {
+			return internal.ChipErrorInvalidTLVElement
+		}
+		reflect.Copy(v, reflect.ValueOf(value))
+		return nil
+	case reflect.Struct:
+		return decodeStruct(r, v)
+	default:
+		return internal.ChipErrorWrongTLVType
+	}
+}
+
+// getInt 有符号整数也可以从范围内的无符号整数解码
+func getInt(r *Reader) (int64, error) {
+	if r.GetType() == TypeUnsignedInteger {
+		value, err := r.GetUint()
+		if err != nil {
+			return 0, err
+		}
+		if value > 1<<63-1 {
+			return 0, internal.ChipErrorInvalidTLVElement
+		}
+		return int64(value), nil
+	}
+	return r.GetInt()
+}
+
+// getUint 无符号整数也可以从非负的有符号整数解码
+func getUint(r *Reader) (uint64, error) {
+	if r.GetType() == TypeSignedInteger {
+		value, err := r.GetInt()
+		if err != nil {
+			return 0, err
+		}
+		if value < 0 {
+			return 0, internal.ChipErrorInvalidTLVElement
+		}
+		return uint64(value), nil
+	}
+	return r.GetUint()
+}
+
+func decodeSlice(r *Reader, v reflect.Value) error {
+	if r.GetType() != TypeArray && r.GetType() != TypeList {
+		return internal.ChipErrorWrongTLVType
+	}
+	if err := r.EnterContainer(); err != nil {
+		return err
+	}
+	slice := reflect.MakeSlice(v.Type(), 0, 0)
+	for {
+		err := r.Next()
+		if err == internal.ChipErrorEndOfTLV {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeValue(r, elem); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	v.Set(slice)
+	return r.ExitContainer()
+}
+
+// decodeStruct 按上下文标签匹配字段，不认识的标签被跳过，缺少必选字段时返回 ChipErrorTLVTagNotFound
+func decodeStruct(r *Reader, v reflect.Value) error {
+	if r.GetType() != TypeStructure {
+		return internal.ChipErrorWrongTLVType
+	}
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+	if err := r.EnterContainer(); err != nil {
+		return err
+	}
+	found := make(map[uint8]bool)
+	for {
+		err := r.Next()
+		if err == internal.ChipErrorEndOfTLV {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !r.GetTag().IsContext() {
+			continue
+		}
+		number := uint8(r.GetTag().GetNumber())
+		for _, field := range fields {
+			if field.mTag != number {
+				continue
+			}
+			if err := decodeValue(r, v.Field(field.mIndex)); err != nil {
+				return err
+			}
+			found[number] = true
+			break
+		}
+	}
+	for _, field := range fields {
+		if !field.mOmitEmpty && !found[field.mTag] {
+			return internal.ChipErrorTLVTagNotFound
+		}
+	}
+	return r.ExitContainer()
+}
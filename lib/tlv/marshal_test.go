@@ -0,0 +1,148 @@
+package tlv
+
+import (
+	"encoding/hex"
+	"github.com/galenliu/chip/internal"
+	"reflect"
+	"testing"
+)
+
+type testInner struct {
+	Name  string `tlv:"0"`
+	Flags []bool `tlv:"1,list"`
+}
+
+type testRecord struct {
+	Id       uint16      `tlv:"1"`
+	Offset   int32       `tlv:"2"`
+	Enabled  bool        `tlv:"3"`
+	Ratio    float64     `tlv:"4"`
+	Key      []byte      `tlv:"5"`
+	Fixed    [4]byte     `tlv:"6"`
+	Values   []uint32    `tlv:"7"`
+	Inner    testInner   `tlv:"8"`
+	Inners   []testInner `tlv:"9"`
+	Nullable *uint8      `tlv:"10"`
+	Optional *string     `tlv:"11,omitempty"`
+	Comment  string      `tlv:"12,omitempty"`
+	Ignored  int
+	Skipped  int `tlv:"-"`
+}
+
+type testEpoch uint32
+
+// testCustom 使用 Marshaler 编码为单个无符号整数
+type testCustom struct {
+	mSeconds testEpoch
+}
+
+func (c testCustom) MarshalTLV(w *Writer, tag Tag) error {
+	return w.PutUint(tag, uint64(c.mSeconds))
+}
+
+func (c *testCustom) UnmarshalTLV(r *Reader) error {
+	value, err := r.GetUint()
+	if err != nil {
+		return err
+	}
+	c.mSeconds = testEpoch(value)
+	return nil
+}
+
+type testWithCustom struct {
+	NotBefore testCustom `tlv:"1"`
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	optional := "present"
+	record := testRecord{
+		Id:       0x1234,
+		Offset:   -170000,
+		Enabled:  true,
+		Ratio:    0.25,
+		Key:      []byte{1, 2, 3},
+		Fixed:    [4]byte{9, 8, 7, 6},
+		Values:   []uint32{1, 70000},
+		Inner:    testInner{Name: "inner", Flags: []bool{true, false}},
+		Inners:   []testInner{{Name: "a"}, {Name: "b", Flags: []bool{}}},
+		Optional: &optional,
+		Ignored:  5,
+		Skipped:  6,
+	}
+	data, err := Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded testRecord
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	record.Ignored, record.Skipped = 0, 0
+	// 没有元素的列表解码为长度为0的切片而不是 nil
+	record.Inners[0].Flags = []bool{}
+	if !reflect.DeepEqual(record, decoded) {
+		t.Errorf("round trip mismatch:\n%+v\n%+v", record, decoded)
+	}
+}
+
+func TestMarshalEncoding(t *testing.T) {
+	type pair struct {
+		A int8  `tlv:"0"`
+		B uint8 `tlv:"1,omitempty"`
+		C *bool `tlv:"2"`
+	}
+	data, err := Marshal(pair{A: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A=42，B 是零值被省略，C 为 null
+	if hex.EncodeToString(data) != "1520002a340218" {
+		t.Errorf("unexpected encoding %x", data)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	type required struct {
+		A uint8 `tlv:"0"`
+		B uint8 `tlv:"1"`
+	}
+	data, _ := hex.DecodeString("152000011803")
+	var value required
+	if err := Unmarshal(data[:4], &value); err != internal.ChipErrorTLVUnderrun {
+		t.Errorf("truncated structure: got %v", err)
+	}
+	data, _ = hex.DecodeString("15240001" + "18")
+	if err := Unmarshal(data, &value); err != internal.ChipErrorTLVTagNotFound {
+		t.Errorf("missing required field: got %v", err)
+	}
+	data, _ = hex.DecodeString("1524000124011225010001" + "18")
+	if err := Unmarshal(data, &value); err != internal.ChipErrorInvalidTLVElement {
+		t.Errorf("overflowing field: got %v", err)
+	}
+	data, _ = hex.DecodeString("152c000141" + "18")
+	if err := Unmarshal(data, &value); err != internal.ChipErrorWrongTLVType {
+		t.Errorf("wrong field type: got %v", err)
+	}
+	if err := Unmarshal(data, value); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("non pointer target: got %v", err)
+	}
+	// 不认识的字段被跳过
+	data, _ = hex.DecodeString("15240001240102" + "2409ff" + "18")
+	if err := Unmarshal(data, &value); err != nil || value.A != 1 || value.B != 2 {
+		t.Errorf("unknown fields must be ignored: %v %+v", err, value)
+	}
+}
+
+func TestMarshalCustom(t *testing.T) {
+	data, err := Marshal(testWithCustom{NotBefore: testCustom{mSeconds: 0x10000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(data) != "15260100000100"+"18" {
+		t.Errorf("unexpected encoding %x", data)
+	}
+	var decoded testWithCustom
+	if err := Unmarshal(data, &decoded); err != nil || decoded.NotBefore.mSeconds != 0x10000 {
+		t.Errorf("custom unmarshal failed: %v", err)
+	}
+}
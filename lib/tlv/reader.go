@@ -0,0 +1,293 @@
+package tlv
+
+import (
+	"github.com/galenliu/chip/internal"
+	"math"
+	"unicode/utf8"
+)
+
+// Reader 按顺序解码TLV元素，Next 移动到当前容器中的下一个元素，
+// 到达容器结尾或者数据结尾时返回 ChipErrorEndOfTLV
+type Reader struct {
+	mData []byte
+	// mPos 没有当前元素时下一个元素开始的位置
+	mPos int
+
+	mHaveElement bool
+	mAtEnd       bool
+	mElemStart   int
+	mValueStart  int
+	mValueEnd    int
+	mEncoded     uint8
+	mType        ElementType
+	mTag         Tag
+
+	mContainers []ElementType
+}
+
+func NewReader(data []byte) *Reader {
+	return &Reader{mData: data}
+}
+
+func (r *Reader) GetType() ElementType {
+	if !r.mHaveElement {
+		return TypeNotSpecified
+	}
+	return r.mType
+}
+
+func (r *Reader) GetTag() Tag {
+	return r.mTag
+}
+
+// GetContainerType 当前进入的容器类型，没有进入容器时返回 TypeNotSpecified
+func (r *Reader) GetContainerType() ElementType {
+	if len(r.mContainers) == 0 {
+		return TypeNotSpecified
+	}
+	return r.mContainers[len(r.mContainers)-1]
+}
+
+// Next 跳过当前元素（包括没有进入的容器），读取下一个元素的头部
+func (r *Reader) Next() error {
+	pos, err := r.nextPos()
+	if err != nil {
+		return err
+	}
+	r.mHaveElement = false
+	r.mPos = pos
+	if r.mAtEnd {
+		return internal.ChipErrorEndOfTLV
+	}
+	if pos >= len(r.mData) {
+		if len(r.mContainers) != 0 {
+			return internal.ChipErrorTLVUnderrun
+		}
+		return internal.ChipErrorEndOfTLV
+	}
+	if r.mData[pos] == kEndOfContainer {
+		if len(r.mContainers) == 0 {
+			return internal.ChipErrorInvalidTLVElement
+		}
+		r.mAtEnd = true
+		return internal.ChipErrorEndOfTLV
+	}
+	tag, encoded, valueStart, valueEnd, err := r.parseElement(pos)
+	if err != nil {
+		return err
+	}
+	r.mHaveElement = true
+	r.mElemStart = pos
+	r.mValueStart = valueStart
+	r.mValueEnd = valueEnd
+	r.mEncoded = encoded
+	r.mType = elementType(encoded)
+	r.mTag = tag
+	return nil
+}
+
+// NextExpect 读取下一个元素并检查类型和标签
+func (r *Reader) NextExpect(elementType ElementType, tag Tag) error {
+	if err := r.Next(); err != nil {
+		return err
+	}
+	if r.mType != elementType {
+		return internal.ChipErrorWrongTLVType
+	}
+	if r.mTag != tag {
+		return internal.ChipErrorUnexpectedTLVElement
+	}
+	return nil
+}
+
+// EnterContainer 进入当前的容器元素，之后 Next 读取容器中的元素
+func (r *Reader) EnterContainer() error {
+	if !r.mHaveElement || !r.mType.IsContainer() {
+		return internal.ChipErrorWrongTLVType
+	}
+	r.mContainers = append(r.mContainers, r.mType)
+	r.mPos = r.mValueStart
+	r.mHaveElement = false
+	return nil
+}
+
+// ExitContainer 跳过容器中剩余的元素，回到容器所在的层级
+func (r *Reader) ExitContainer() error {
+	if len(r.mContainers) == 0 {
+		return internal.ChipErrorIncorrectState
+	}
+	pos, err := r.nextPos()
+	if err != nil {
+		return err
+	}
+	end, err := r.skipContainer(pos)
+	if err != nil {
+		return err
+	}
+	r.mContainers = r.mContainers[:len(r.mContainers)-1]
+	r.mPos = end
+	r.mHaveElement = false
+	r.mAtEnd = false
+	return nil
+}
+
+func (r *Reader) GetInt() (int64, error) {
+	if !r.mHaveElement || r.mType != TypeSignedInteger {
+		return 0, internal.ChipErrorWrongTLVType
+	}
+	value := readLe(r.mData[r.mValueStart:r.mValueEnd])
+	switch r.mEncoded {
+	case kInt8:
+		return int64(int8(value)), nil
+	case kInt16:
+		return int64(int16(value)), nil
+	case kInt32:
+		return int64(int32(value)), nil
+	default:
+		return int64(value), nil
+	}
+}
+
+func (r *Reader) GetUint() (uint64, error) {
+	if !r.mHaveElement || r.mType != TypeUnsignedInteger {
+		return 0, internal.ChipErrorWrongTLVType
+	}
+	return readLe(r.mData[r.mValueStart:r.mValueEnd]), nil
+}
+
+func (r *Reader) GetBool() (bool, error) {
+	if !r.mHaveElement || r.mType != TypeBoolean {
+		return false, internal.ChipErrorWrongTLVType
+	}
+	return r.mEncoded == kTrue, nil
+}
+
+// GetFloat 单精度的值转换为 float64
+func (r *Reader) GetFloat() (float64, error) {
+	if !r.mHaveElement || r.mType != TypeFloatingPoint {
+		return 0, internal.ChipErrorWrongTLVType
+	}
+	value := readLe(r.mData[r.mValueStart:r.mValueEnd])
+	if r.mEncoded == kFloat32 {
+		return float64(math.Float32frombits(uint32(value))), nil
+	}
+	return math.Float64frombits(value), nil
+}
+
+func (r *Reader) GetString() (string, error) {
+	if !r.mHaveElement || r.mType != TypeUTF8String {
+		return "", internal.ChipErrorWrongTLVType
+	}
+	data := r.mData[r.mValueStart:r.mValueEnd]
+	if !utf8.Valid(data) {
+		return "", internal.ChipErrorInvalidTLVElement
+	}
+	return string(data), nil
+}
+
+// GetBytes 返回字节串的拷贝
+func (r *Reader) GetBytes() ([]byte, error) {
+	if !r.mHaveElement || r.mType != TypeByteString {
+		return nil, internal.ChipErrorWrongTLVType
+	}
+	return append([]byte{}, r.mData[r.mValueStart:r.mValueEnd]...), nil
+}
+
+func (r *Reader) IsNull() bool {
+	return r.mHaveElement && r.mType == TypeNull
+}
+
+// GetLength 字符串和字节串的长度
+func (r *Reader) GetLength() int {
+	if !r.mHaveElement || (r.mType != TypeUTF8String && r.mType != TypeByteString) {
+		return 0
+	}
+	return r.mValueEnd - r.mValueStart
+}
+
+// GetElementBytes 当前元素完整的编码，包括容器中的所有元素
+func (r *Reader) GetElementBytes() ([]byte, error) {
+	if !r.mHaveElement {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	end, err := r.nextPos()
+	if err != nil {
+		return nil, err
+	}
+	return r.mData[r.mElemStart:end], nil
+}
+
+// nextPos 当前元素之后下一个元素开始的位置
+func (r *Reader) nextPos() (int, error) {
+	switch {
+	case r.mAtEnd:
+		return r.mPos, nil
+	case !r.mHaveElement:
+		return r.mPos, nil
+	case r.mType.IsContainer():
+		return r.skipContainer(r.mValueStart)
+	default:
+		return r.mValueEnd, nil
+	}
+}
+
+// skipContainer 从容器内部的位置跳到容器结束标记之后
+func (r *Reader) skipContainer(pos int) (int, error) {
+	depth := 1
+	for {
+		if pos >= len(r.mData) {
+			return 0, internal.ChipErrorTLVUnderrun
+		}
+		if r.mData[pos] == kEndOfContainer {
+			pos++
+			depth--
+			if depth == 0 {
+				return pos, nil
+			}
+			continue
+		}
+		_, encoded, valueStart, valueEnd, err := r.parseElement(pos)
+		if err != nil {
+			return 0, err
+		}
+		if elementType(encoded).IsContainer() {
+			depth++
+			pos = valueStart
+		} else {
+			pos = valueEnd
+		}
+	}
+}
+
+// parseElement 解析元素头部，返回值的范围，容器的值从头部之后开始
+func (r *Reader) parseElement(pos int) (Tag, uint8, int, int, error) {
+	control := r.mData[pos]
+	encoded := control & kElementTypeMask
+	if elementType(encoded) == TypeNotSpecified {
+		return Tag{}, 0, 0, 0, internal.ChipErrorInvalidTLVElement
+	}
+	pos++
+	size := tagSize(control & kTagControlMask)
+	if pos+size > len(r.mData) {
+		return Tag{}, 0, 0, 0, internal.ChipErrorTLVUnderrun
+	}
+	tag := decodeTag(control&kTagControlMask, r.mData[pos:pos+size])
+	pos += size
+
+	var length uint64
+	switch elementType(encoded) {
+	case TypeSignedInteger, TypeUnsignedInteger, TypeFloatingPoint:
+		length = uint64(fieldSize(encoded))
+	case TypeUTF8String, TypeByteString:
+		lengthSize := fieldSize(encoded)
+		if pos+lengthSize > len(r.mData) {
+			return Tag{}, 0, 0, 0, internal.ChipErrorTLVUnderrun
+		}
+		length = readLe(r.mData[pos : pos+lengthSize])
+		pos += lengthSize
+	}
+	if length > uint64(len(r.mData)-pos) {
+		return Tag{}, 0, 0, 0, internal.ChipErrorTLVUnderrun
+	}
+	return tag, encoded, pos, pos + int(length), nil
+}
@@ -0,0 +1,179 @@
+package tlv
+
+import "fmt"
+
+type tagKind uint8
+
+const (
+	tagKindAnonymous tagKind = iota
+	tagKindContext
+	tagKindCommonProfile
+	tagKindImplicitProfile
+	tagKindFullyQualified
+)
+
+// 控制字节高3位的标签格式
+const (
+	kTagControlAnonymous             uint8 = 0x00
+	kTagControlContextSpecific       uint8 = 0x20
+	kTagControlCommonProfile2Bytes   uint8 = 0x40
+	kTagControlCommonProfile4Bytes   uint8 = 0x60
+	kTagControlImplicitProfile2Bytes uint8 = 0x80
+	kTagControlImplicitProfile4Bytes uint8 = 0xA0
+	kTagControlFullyQualified6Bytes  uint8 = 0xC0
+	kTagControlFullyQualified8Bytes  uint8 = 0xE0
+)
+
+// Tag TLV元素的标签，完整格式的标签包含厂商ID和协议编号
+type Tag struct {
+	mKind      tagKind
+	mVendorId  uint16
+	mProfileId uint16
+	mNumber    uint32
+}
+
+func AnonymousTag() Tag {
+	return Tag{mKind: tagKindAnonymous}
+}
+
+// ContextTag 只能在结构体和列表中使用的上下文标签
+func ContextTag(number uint8) Tag {
+	return Tag{mKind: tagKindContext, mNumber: uint32(number)}
+}
+
+// CommonTag Matter通用协议中的标签
+func CommonTag(number uint32) Tag {
+	return Tag{mKind: tagKindCommonProfile, mNumber: number}
+}
+
+// ImplicitProfileTag 协议由上下文确定的标签
+func ImplicitProfileTag(number uint32) Tag {
+	return Tag{mKind: tagKindImplicitProfile, mNumber: number}
+}
+
+// ProfileTag 包含厂商ID和协议编号的完整标签
+func ProfileTag(vendorId uint16, profileId uint16, number uint32) Tag {
+	return Tag{mKind: tagKindFullyQualified, mVendorId: vendorId, mProfileId: profileId, mNumber: number}
+}
+
+func (t Tag) IsAnonymous() bool {
+	return t.mKind == tagKindAnonymous
+}
+
+func (t Tag) IsContext() bool {
+	return t.mKind == tagKindContext
+}
+
+func (t Tag) IsCommonProfile() bool {
+	return t.mKind == tagKindCommonProfile
+}
+
+func (t Tag) IsImplicitProfile() bool {
+	return t.mKind == tagKindImplicitProfile
+}
+
+func (t Tag) IsFullyQualified() bool {
+	return t.mKind == tagKindFullyQualified
+}
+
+func (t Tag) GetNumber() uint32 {
+	return t.mNumber
+}
+
+func (t Tag) GetVendorId() uint16 {
+	return t.mVendorId
+}
+
+func (t Tag) GetProfileId() uint16 {
+	return t.mProfileId
+}
+
+func (t Tag) String() string {
+	switch t.mKind {
+	case tagKindAnonymous:
+		return "Anonymous"
+	case tagKindContext:
+		return fmt.Sprintf("Context(%d)", t.mNumber)
+	case tagKindCommonProfile:
+		return fmt.Sprintf("Common(%d)", t.mNumber)
+	case tagKindImplicitProfile:
+		return fmt.Sprintf("Implicit(%d)", t.mNumber)
+	default:
+		return fmt.Sprintf("Profile(0x%04X:0x%04X:%d)", t.mVendorId, t.mProfileId, t.mNumber)
+	}
+}
+
+// encode 返回标签控制位和标签字节
+func (t Tag) encode() (uint8, []byte) {
+	switch t.mKind {
+	case tagKindContext:
+		return kTagControlContextSpecific, []byte{uint8(t.mNumber)}
+	case tagKindCommonProfile:
+		if t.mNumber <= 0xFFFF {
+			return kTagControlCommonProfile2Bytes, le(uint64(t.mNumber), 2)
+		}
+		return kTagControlCommonProfile4Bytes, le(uint64(t.mNumber), 4)
+	case tagKindImplicitProfile:
+		if t.mNumber <= 0xFFFF {
+			return kTagControlImplicitProfile2Bytes, le(uint64(t.mNumber), 2)
+		}
+		return kTagControlImplicitProfile4Bytes, le(uint64(t.mNumber), 4)
+	case tagKindFullyQualified:
+		data := append(le(uint64(t.mVendorId), 2), le(uint64(t.mProfileId), 2)...)
+		if t.mNumber <= 0xFFFF {
+			return kTagControlFullyQualified6Bytes, append(data, le(uint64(t.mNumber), 2)...)
+		}
+		return kTagControlFullyQualified8Bytes, append(data, le(uint64(t.mNumber), 4)...)
+	default:
+		return kTagControlAnonymous, nil
+	}
+}
+
+// tagSize 标签控制位对应的标签字节数
+func tagSize(control uint8) int {
+	switch control {
+	case kTagControlContextSpecific:
+		return 1
+	case kTagControlCommonProfile2Bytes, kTagControlImplicitProfile2Bytes:
+		return 2
+	case kTagControlCommonProfile4Bytes, kTagControlImplicitProfile4Bytes:
+		return 4
+	case kTagControlFullyQualified6Bytes:
+		return 6
+	case kTagControlFullyQualified8Bytes:
+		return 8
+	default:
+		return 0
+	}
+}
+
+func decodeTag(control uint8, data []byte) Tag {
+	switch control {
+	case kTagControlContextSpecific:
+		return ContextTag(data[0])
+	case kTagControlCommonProfile2Bytes, kTagControlCommonProfile4Bytes:
+		return CommonTag(uint32(readLe(data)))
+	case kTagControlImplicitProfile2Bytes, kTagControlImplicitProfile4Bytes:
+		return ImplicitProfileTag(uint32(readLe(data)))
+	case kTagControlFullyQualified6Bytes, kTagControlFullyQualified8Bytes:
+		return ProfileTag(uint16(readLe(data[0:2])), uint16(readLe(data[2:4])), uint32(readLe(data[4:])))
+	default:
+		return AnonymousTag()
+	}
+}
+
+func le(value uint64, size int) []byte {
+	data := make([]byte, size)
+	for i := 0; i < size; i++ {
+		data[i] = uint8(value >> (8 * i))
+	}
+	return data
+}
+
+func readLe(data []byte) uint64 {
+	var value uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+	return value
+}
@@ -0,0 +1,242 @@
+package tlv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/galenliu/chip/internal"
+	"math"
+	"testing"
+)
+
+// 测试向量来自 Matter 规范附录 A 的编码示例
+func TestWriterEncodingVectors(t *testing.T) {
+	cases := []struct {
+		name     string
+		write    func(w *Writer) error
+		expected string
+	}{
+		{"false", func(w *Writer) error { return w.PutBool(AnonymousTag(), false) }, "08"},
+		{"true", func(w *Writer) error { return w.PutBool(AnonymousTag(), true) }, "09"},
+		{"int8 42", func(w *Writer) error { return w.PutInt(AnonymousTag(), 42) }, "002a"},
+		{"int8 -17", func(w *Writer) error { return w.PutInt(AnonymousTag(), -17) }, "00ef"},
+		{"uint8 42", func(w *Writer) error { return w.PutUint(AnonymousTag(), 42) }, "042a"},
+		{"int16 422", func(w *Writer) error { return w.PutInt(AnonymousTag(), 422) }, "01a601"},
+		{"int32 -170000", func(w *Writer) error { return w.PutInt(AnonymousTag(), -170000) }, "02f067fdff"},
+		{"int64 40000000000", func(w *Writer) error { return w.PutInt(AnonymousTag(), 40000000000) }, "0300902f5009000000"},
+		{"utf8", func(w *Writer) error { return w.PutString(AnonymousTag(), "Hello!") }, "0c0648656c6c6f21"},
+		{"utf8 multibyte", func(w *Writer) error { return w.PutString(AnonymousTag(), "Tschüs") }, "0c0754736368c3bc73"},
+		{"octets", func(w *Writer) error { return w.PutBytes(AnonymousTag(), []byte{0, 1, 2, 3, 4}) }, "10050001020304"},
+		{"null", func(w *Writer) error { return w.PutNull(AnonymousTag()) }, "14"},
+		{"float 0", func(w *Writer) error { return w.PutFloat32(AnonymousTag(), 0) }, "0a00000000"},
+		{"float 1/3", func(w *Writer) error { return w.PutFloat32(AnonymousTag(), 1.0/3) }, "0aabaaaa3e"},
+		{"float 17.9", func(w *Writer) error { return w.PutFloat32(AnonymousTag(), 17.9) }, "0a33338f41"},
+		{"float inf", func(w *Writer) error { return w.PutFloat32(AnonymousTag(), float32(math.Inf(1))) }, "0a0000807f"},
+		{"double 1/3", func(w *Writer) error { return w.PutFloat64(AnonymousTag(), 1.0/3) }, "0b555555555555d53f"},
+		{"empty structure", func(w *Writer) error {
+			_ = w.StartStructure(AnonymousTag())
+			return w.EndContainer()
+		}, "1518"},
+		{"empty array", func(w *Writer) error {
+			_ = w.StartArray(AnonymousTag())
+			return w.EndContainer()
+		}, "1618"},
+		{"empty list", func(w *Writer) error {
+			_ = w.StartList(AnonymousTag())
+			return w.EndContainer()
+		}, "1718"},
+		{"structure", func(w *Writer) error {
+			_ = w.StartStructure(AnonymousTag())
+			_ = w.PutInt(ContextTag(0), 42)
+			_ = w.PutInt(ContextTag(1), -17)
+			return w.EndContainer()
+		}, "1520002a2001ef18"},
+		{"array", func(w *Writer) error {
+			_ = w.StartArray(AnonymousTag())
+			for i := int64(0); i < 5; i++ {
+				_ = w.PutInt(AnonymousTag(), i)
+			}
+			return w.EndContainer()
+		}, "160000000100020003000418"},
+		{"common tag 2 bytes", func(w *Writer) error { return w.PutUint(CommonTag(1), 42) }, "4401002a"},
+		{"common tag 4 bytes", func(w *Writer) error { return w.PutUint(CommonTag(100000), 42) }, "64a08601002a"},
+		{"fully qualified 6 bytes", func(w *Writer) error { return w.PutUint(ProfileTag(0xFFF1, 0xDEED, 1), 42) }, "c4f1ffedde01002a"},
+		{"fully qualified 8 bytes", func(w *Writer) error { return w.PutUint(ProfileTag(0xFFF1, 0xDEED, 0xAA55FEED), 42) }, "e4f1ffeddeedfe55aa2a"},
+	}
+	for _, c := range cases {
+		w := NewWriter()
+		if err := c.write(w); err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+			continue
+		}
+		data, err := w.Finalize()
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+			continue
+		}
+		if hex.EncodeToString(data) != c.expected {
+			t.Errorf("%s: got %x, expected %s", c.name, data, c.expected)
+		}
+	}
+}
+
+func TestWriterTagRules(t *testing.T) {
+	w := NewWriter()
+	if err := w.PutUint(ContextTag(1), 1); err != internal.ChipErrorInvalidTLVTag {
+		t.Errorf("context tag outside a structure must fail")
+	}
+	_ = w.StartStructure(AnonymousTag())
+	if err := w.PutUint(AnonymousTag(), 1); err != internal.ChipErrorInvalidTLVTag {
+		t.Errorf("anonymous structure member must fail")
+	}
+	_ = w.StartArray(ContextTag(1))
+	if err := w.PutUint(ContextTag(2), 1); err != internal.ChipErrorInvalidTLVTag {
+		t.Errorf("tagged array element must fail")
+	}
+	if _, err := w.Finalize(); err != internal.ChipErrorTLVContainerOpen {
+		t.Errorf("finalize with open containers must fail")
+	}
+	_ = w.EndContainer()
+	_ = w.EndContainer()
+	if err := w.EndContainer(); err != internal.ChipErrorIncorrectState {
+		t.Errorf("end without a container must fail")
+	}
+}
+
+func TestWriterLongString(t *testing.T) {
+	w := NewWriter()
+	value := bytes.Repeat([]byte{0xAB}, 300)
+	if err := w.PutBytes(AnonymousTag(), value); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes()[:3], []byte{0x11, 0x2c, 0x01}) {
+		t.Errorf("expected 2 byte length field, got %x", w.Bytes()[:3])
+	}
+	r := NewReader(w.Bytes())
+	if err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := r.GetBytes(); err != nil || !bytes.Equal(data, value) {
+		t.Errorf("long octet string round trip failed")
+	}
+}
+
+func TestReaderNested(t *testing.T) {
+	w := NewWriter()
+	_ = w.StartStructure(AnonymousTag())
+	_ = w.PutUint(ContextTag(1), 0x1234)
+	_ = w.StartList(ContextTag(2))
+	_ = w.PutString(ContextTag(3), "inner")
+	_ = w.StartArray(AnonymousTag())
+	_ = w.PutBool(AnonymousTag(), true)
+	_ = w.EndContainer()
+	_ = w.EndContainer()
+	_ = w.PutFloat64(ContextTag(4), 1.5)
+	_ = w.PutNull(ContextTag(5))
+	_ = w.PutInt(ProfileTag(0xFFF1, 0xDEED, 7), -2)
+	_ = w.EndContainer()
+	data, err := w.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(data)
+	if err := r.NextExpect(TypeStructure, AnonymousTag()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EnterContainer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.NextExpect(TypeUnsignedInteger, ContextTag(1)); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := r.GetUint(); value != 0x1234 {
+		t.Errorf("unexpected value %x", value)
+	}
+	if _, err := r.GetInt(); err != internal.ChipErrorWrongTLVType {
+		t.Errorf("reading the wrong type must fail")
+	}
+	// 不进入列表时 Next 跳过整个容器
+	if err := r.NextExpect(TypeList, ContextTag(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.NextExpect(TypeFloatingPoint, ContextTag(4)); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := r.GetFloat(); value != 1.5 {
+		t.Errorf("unexpected float %v", value)
+	}
+	if err := r.Next(); err != nil || !r.IsNull() || r.GetTag() != ContextTag(5) {
+		t.Errorf("expected null element")
+	}
+	if err := r.NextExpect(TypeSignedInteger, ProfileTag(0xFFF1, 0xDEED, 7)); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := r.GetInt(); value != -2 {
+		t.Errorf("unexpected value %d", value)
+	}
+	if err := r.Next(); err != internal.ChipErrorEndOfTLV {
+		t.Errorf("expected end of container, got %v", err)
+	}
+	if err := r.ExitContainer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(); err != internal.ChipErrorEndOfTLV {
+		t.Errorf("expected end of data, got %v", err)
+	}
+
+	// 进入列表后提前退出
+	r = NewReader(data)
+	_ = r.Next()
+	_ = r.EnterContainer()
+	_ = r.Next()
+	_ = r.Next()
+	if err := r.EnterContainer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.NextExpect(TypeUTF8String, ContextTag(3)); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := r.GetString(); value != "inner" {
+		t.Errorf("unexpected string %q", value)
+	}
+	if err := r.ExitContainer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.NextExpect(TypeFloatingPoint, ContextTag(4)); err != nil {
+		t.Errorf("exit container must skip the remaining elements: %v", err)
+	}
+
+	element := NewReader(data)
+	_ = element.Next()
+	if encoded, err := element.GetElementBytes(); err != nil || !bytes.Equal(encoded, data) {
+		t.Errorf("element bytes must cover the whole structure")
+	}
+}
+
+func TestReaderMalformed(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"truncated int", "01a6", internal.ChipErrorTLVUnderrun},
+		{"truncated string", "0c0648656c", internal.ChipErrorTLVUnderrun},
+		{"truncated tag", "44", internal.ChipErrorTLVUnderrun},
+		{"invalid type", "19", internal.ChipErrorInvalidTLVElement},
+		{"stray end", "18", internal.ChipErrorInvalidTLVElement},
+	}
+	for _, c := range cases {
+		data, _ := hex.DecodeString(c.data)
+		if err := NewReader(data).Next(); err != c.err {
+			t.Errorf("%s: got %v, expected %v", c.name, err, c.err)
+		}
+	}
+
+	// 没有结束标记的容器
+	data, _ := hex.DecodeString("15200001")
+	r := NewReader(data)
+	_ = r.Next()
+	if err := r.Next(); err != internal.ChipErrorTLVUnderrun {
+		t.Errorf("unterminated container: got %v", err)
+	}
+}
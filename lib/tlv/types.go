@@ -0,0 +1,110 @@
+package tlv
+
+// ElementType TLV元素的类型，不区分整数和长度字段的宽度
+type ElementType uint8
+
+const (
+	TypeNotSpecified ElementType = iota
+	TypeSignedInteger
+	TypeUnsignedInteger
+	TypeBoolean
+	TypeFloatingPoint
+	TypeUTF8String
+	TypeByteString
+	TypeNull
+	TypeStructure
+	TypeArray
+	TypeList
+)
+
+func (t ElementType) String() string {
+	switch t {
+	case TypeSignedInteger:
+		return "signed integer"
+	case TypeUnsignedInteger:
+		return "unsigned integer"
+	case TypeBoolean:
+		return "boolean"
+	case TypeFloatingPoint:
+		return "floating point"
+	case TypeUTF8String:
+		return "utf8 string"
+	case TypeByteString:
+		return "octet string"
+	case TypeNull:
+		return "null"
+	case TypeStructure:
+		return "structure"
+	case TypeArray:
+		return "array"
+	case TypeList:
+		return "list"
+	default:
+		return "not specified"
+	}
+}
+
+func (t ElementType) IsContainer() bool {
+	return t == TypeStructure || t == TypeArray || t == TypeList
+}
+
+// 控制字节低5位的编码类型
+const (
+	kInt8           uint8 = 0x00
+	kInt16          uint8 = 0x01
+	kInt32          uint8 = 0x02
+	kInt64          uint8 = 0x03
+	kUInt8          uint8 = 0x04
+	kUInt16         uint8 = 0x05
+	kUInt32         uint8 = 0x06
+	kUInt64         uint8 = 0x07
+	kFalse          uint8 = 0x08
+	kTrue           uint8 = 0x09
+	kFloat32        uint8 = 0x0A
+	kFloat64        uint8 = 0x0B
+	kUTF8Len8       uint8 = 0x0C
+	kUTF8Len64      uint8 = 0x0F
+	kBytesLen8      uint8 = 0x10
+	kBytesLen64     uint8 = 0x13
+	kNull           uint8 = 0x14
+	kStructure      uint8 = 0x15
+	kArray          uint8 = 0x16
+	kList           uint8 = 0x17
+	kEndOfContainer uint8 = 0x18
+
+	kElementTypeMask uint8 = 0x1F
+	kTagControlMask  uint8 = 0xE0
+)
+
+// elementType 编码类型对应的元素类型，无效的编码返回 TypeNotSpecified
+func elementType(encoded uint8) ElementType {
+	switch {
+	case encoded <= kInt64:
+		return TypeSignedInteger
+	case encoded <= kUInt64:
+		return TypeUnsignedInteger
+	case encoded == kFalse || encoded == kTrue:
+		return TypeBoolean
+	case encoded == kFloat32 || encoded == kFloat64:
+		return TypeFloatingPoint
+	case encoded >= kUTF8Len8 && encoded <= kUTF8Len64:
+		return TypeUTF8String
+	case encoded >= kBytesLen8 && encoded <= kBytesLen64:
+		return TypeByteString
+	case encoded == kNull:
+		return TypeNull
+	case encoded == kStructure:
+		return TypeStructure
+	case encoded == kArray:
+		return TypeArray
+	case encoded == kList:
+		return TypeList
+	default:
+		return TypeNotSpecified
+	}
+}
+
+// fieldSize 整数、长度字段的宽度编码在类型的低两位
+func fieldSize(encoded uint8) int {
+	return 1 << (encoded & 0x03)
+}
@@ -0,0 +1,167 @@
+package tlv
+
+import (
+	"github.com/galenliu/chip/internal"
+	"math"
+)
+
+// Writer 按顺序编码TLV元素，容器需要成对调用 StartContainer 和 EndContainer
+type Writer struct {
+	mData       []byte
+	mContainers []ElementType
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// Bytes 已经编码的数据
+func (w *Writer) Bytes() []byte {
+	return w.mData
+}
+
+// Finalize 检查所有的容器都已经结束，返回编码的数据
+func (w *Writer) Finalize() ([]byte, error) {
+	if len(w.mContainers) != 0 {
+		return nil, internal.ChipErrorTLVContainerOpen
+	}
+	return w.mData, nil
+}
+
+func (w *Writer) PutInt(tag Tag, value int64) error {
+	switch {
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		return w.putElement(tag, kInt8, le(uint64(value), 1))
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		return w.putElement(tag, kInt16, le(uint64(value), 2))
+	case value >= math.MinInt32 && value <= math.MaxInt32:
+		return w.putElement(tag, kInt32, le(uint64(value), 4))
+	default:
+		return w.putElement(tag, kInt64, le(uint64(value), 8))
+	}
+}
+
+func (w *Writer) PutUint(tag Tag, value uint64) error {
+	switch {
+	case value <= math.MaxUint8:
+		return w.putElement(tag, kUInt8, le(value, 1))
+	case value <= math.MaxUint16:
+		return w.putElement(tag, kUInt16, le(value, 2))
+	case value <= math.MaxUint32:
+		return w.putElement(tag, kUInt32, le(value, 4))
+	default:
+		return w.putElement(tag, kUInt64, le(value, 8))
+	}
+}
+
+func (w *Writer) PutBool(tag Tag, value bool) error {
+	if value {
+		return w.putElement(tag, kTrue, nil)
+	}
+	return w.putElement(tag, kFalse, nil)
+}
+
+func (w *Writer) PutFloat32(tag Tag, value float32) error {
+	return w.putElement(tag, kFloat32, le(uint64(math.Float32bits(value)), 4))
+}
+
+func (w *Writer) PutFloat64(tag Tag, value float64) error {
+	return w.putElement(tag, kFloat64, le(math.Float64bits(value), 8))
+}
+
+func (w *Writer) PutString(tag Tag, value string) error {
+	return w.putString(tag, kUTF8Len8, []byte(value))
+}
+
+func (w *Writer) PutBytes(tag Tag, value []byte) error {
+	return w.putString(tag, kBytesLen8, value)
+}
+
+func (w *Writer) PutNull(tag Tag) error {
+	return w.putElement(tag, kNull, nil)
+}
+
+// StartContainer 开始结构体、数组或者列表
+func (w *Writer) StartContainer(tag Tag, containerType ElementType) error {
+	var encoded uint8
+	switch containerType {
+	case TypeStructure:
+		encoded = kStructure
+	case TypeArray:
+		encoded = kArray
+	case TypeList:
+		encoded = kList
+	default:
+		return internal.ChipErrorWrongTLVType
+	}
+	if err := w.putElement(tag, encoded, nil); err != nil {
+		return err
+	}
+	w.mContainers = append(w.mContainers, containerType)
+	return nil
+}
+
+func (w *Writer) StartStructure(tag Tag) error {
+	return w.StartContainer(tag, TypeStructure)
+}
+
+func (w *Writer) StartArray(tag Tag) error {
+	return w.StartContainer(tag, TypeArray)
+}
+
+func (w *Writer) StartList(tag Tag) error {
+	return w.StartContainer(tag, TypeList)
+}
+
+// EndContainer 结束最近开始的容器
+func (w *Writer) EndContainer() error {
+	if len(w.mContainers) == 0 {
+		return internal.ChipErrorIncorrectState
+	}
+	w.mContainers = w.mContainers[:len(w.mContainers)-1]
+	w.mData = append(w.mData, kEndOfContainer)
+	return nil
+}
+
+// PutPreEncoded 写入已经编码好的完整元素
+func (w *Writer) PutPreEncoded(data []byte) {
+	w.mData = append(w.mData, data...)
+}
+
+func (w *Writer) putString(tag Tag, lenType uint8, value []byte) error {
+	length := uint64(len(value))
+	var lengthBytes []byte
+	switch {
+	case length <= math.MaxUint8:
+		lengthBytes = le(length, 1)
+	case length <= math.MaxUint16:
+		lengthBytes, lenType = le(length, 2), lenType+1
+	case length <= math.MaxUint32:
+		lengthBytes, lenType = le(length, 4), lenType+2
+	default:
+		lengthBytes, lenType = le(length, 8), lenType+3
+	}
+	return w.putElement(tag, lenType, append(lengthBytes, value...))
+}
+
+// putElement 检查标签在当前容器中是否合法：数组中的元素必须是匿名的，结构体的成员不能是匿名的，
+// 上下文标签只能出现在结构体和列表中
+func (w *Writer) putElement(tag Tag, encoded uint8, value []byte) error {
+	container := TypeNotSpecified
+	if len(w.mContainers) != 0 {
+		container = w.mContainers[len(w.mContainers)-1]
+	}
+	switch {
+	case container == TypeArray && !tag.IsAnonymous():
+		return internal.ChipErrorInvalidTLVTag
+	case container == TypeStructure && tag.IsAnonymous():
+		return internal.ChipErrorInvalidTLVTag
+	case tag.IsContext() && container != TypeStructure && container != TypeList:
+		return internal.ChipErrorInvalidTLVTag
+	}
+	control, tagBytes := tag.encode()
+	w.mData = append(w.mData, control|encoded)
+	w.mData = append(w.mData, tagBytes...)
+	w.mData = append(w.mData, value...)
+	return nil
+}
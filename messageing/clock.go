@@ -0,0 +1,23 @@
+package messageing
+
+import "time"
+
+// Clock 消息层的计时器（重传、确认和响应超时）使用的时钟，测试中可以替换成手动推进的时钟
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,327 @@
+package messageing
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// SendFlags 发送消息时的选项
+type SendFlags uint8
+
+const (
+	// SendFlagExpectResponse 发送之后等待对端的响应，超时后通知 ExchangeDelegate
+	SendFlagExpectResponse SendFlags = 1 << iota
+	// SendFlagNoAutoRequestAck 不请求对端确认
+	SendFlagNoAutoRequestAck
+
+	SendFlagNone SendFlags = 0
+)
+
+func (f SendFlags) Has(flag SendFlags) bool {
+	return f&flag != 0
+}
+
+// ExchangeContext 一次请求响应交互的上下文，通过 Exchange ID、发起者标志和会话区分
+type ExchangeContext struct {
+	mMutex       sync.Mutex
+	mExchangeMgr *ExchangeManagerImpl
+	mExchangeId  uint16
+	mInitiator   bool
+	mSession     transport.Session
+	mDelegate    ExchangeDelegate
+
+	mResponseTimeout    time.Duration
+	mResponseTimer      Timer
+	mResponseGeneration uint64
+
+	mResponseExpected bool
+	mWillSendMessage  bool
+	mClosed           bool
+
+	// MRP 等待发送的确认以及对端最近一次发来消息的时间
+	mAckPending            bool
+	mPendingPeerAckCounter uint32
+	mAckTimer              Timer
+	mAckGeneration         uint64
+	mLastPeerActivity      time.Time
+}
+
+func newExchangeContext(mgr *ExchangeManagerImpl, exchangeId uint16, session transport.Session, initiator bool, delegate ExchangeDelegate) *ExchangeContext {
+	return &ExchangeContext{
+		mExchangeMgr: mgr,
+		mExchangeId:  exchangeId,
+		mInitiator:   initiator,
+		mSession:     session,
+		mDelegate:    delegate,
+	}
+}
+
+func (ec *ExchangeContext) GetExchangeId() uint16 {
+	return ec.mExchangeId
+}
+
+func (ec *ExchangeContext) IsInitiator() bool {
+	return ec.mInitiator
+}
+
+func (ec *ExchangeContext) GetSession() transport.Session {
+	return ec.mSession
+}
+
+func (ec *ExchangeContext) IsGroupExchange() bool {
+	return ec.mSession.IsGroupSession()
+}
+
+func (ec *ExchangeContext) GetExchangeMgr() ExchangeManager {
+	return ec.mExchangeMgr
+}
+
+func (ec *ExchangeContext) GetDelegate() ExchangeDelegate {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	return ec.mDelegate
+}
+
+func (ec *ExchangeContext) SetDelegate(delegate ExchangeDelegate) {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	ec.mDelegate = delegate
+}
+
+// SetResponseTimeout 设置等待响应的时间，0 表示一直等待
+func (ec *ExchangeContext) SetResponseTimeout(timeout time.Duration) {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	ec.mResponseTimeout = timeout
+}
+
+func (ec *ExchangeContext) IsResponseExpected() bool {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	return ec.mResponseExpected
+}
+
+func (ec *ExchangeContext) IsClosed() bool {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	return ec.mClosed
+}
+
+// WillSendMessage 处理消息时调用，表示之后会异步发送消息，Exchange不会在 OnMessageReceived 返回后自动关闭
+func (ec *ExchangeContext) WillSendMessage() {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	ec.mWillSendMessage = true
+}
+
+// SendMessage 在Exchange上发送消息，UDP上的单播消息默认请求对端确认，并捎带等待发送的确认
+func (ec *ExchangeContext) SendMessage(protocolId protocols.Id, msgType uint8, payload []byte, flags SendFlags) error {
+	ec.mMutex.Lock()
+	if ec.mClosed {
+		ec.mMutex.Unlock()
+		return internal.ChipErrorIncorrectState
+	}
+	if flags.Has(SendFlagExpectResponse) && ec.mSession.IsGroupSession() {
+		ec.mMutex.Unlock()
+		return internal.ChipErrorInvalidArgument
+	}
+	ec.mWillSendMessage = false
+	ec.mMutex.Unlock()
+
+	rm := ec.mExchangeMgr.GetReliableMessageMgr()
+	reliable := !flags.Has(SendFlagNoAutoRequestAck) && ec.isReliableTransmission()
+	if reliable && rm.hasRetransEntry(ec) {
+		return internal.ChipErrorIncorrectState
+	}
+
+	payloadHeader := message.NewPayloadHeader()
+	payloadHeader.SetExchangeId(ec.mExchangeId)
+	payloadHeader.SetInitiator(ec.mInitiator)
+	payloadHeader.SetVendorId(protocolId.GetVendorId())
+	payloadHeader.SetMessageType(protocolId.GetProtocolId(), msgType)
+	payloadHeader.SetNeedsAck(reliable)
+	ec.piggybackAck(payloadHeader)
+
+	sessions := ec.mExchangeMgr.GetSessionManager()
+	if sessions == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	prepared, err := sessions.PrepareMessage(ec.mSession, payloadHeader, payload)
+	if err != nil {
+		return err
+	}
+	var entry *retransEntry
+	if reliable {
+		if entry, err = rm.addToRetransTable(ec, prepared); err != nil {
+			return err
+		}
+	}
+	if flags.Has(SendFlagExpectResponse) {
+		ec.startResponseTimer()
+	}
+	if err := sessions.SendPreparedMessage(ec.mSession, prepared); err != nil {
+		if reliable {
+			rm.clearRetransTable(ec)
+		}
+		if flags.Has(SendFlagExpectResponse) {
+			ec.cancelResponseTimer()
+		}
+		return err
+	}
+	if entry != nil {
+		rm.startRetransmission(entry)
+	}
+	return nil
+}
+
+// Close 正常关闭Exchange，通知 ExchangeDelegate。等待发送的确认立即发送，
+// 还有消息等待对端确认时Exchange在确认之后才被释放
+func (ec *ExchangeContext) Close() {
+	ec.mMutex.Lock()
+	if ec.mClosed {
+		ec.mMutex.Unlock()
+		return
+	}
+	ec.mClosed = true
+	ec.mResponseExpected = false
+	ec.stopResponseTimerLocked()
+	delegate := ec.mDelegate
+	ec.mMutex.Unlock()
+
+	if delegate != nil {
+		delegate.OnExchangeClosing(ec)
+	}
+	if err := ec.flushAcks(); err != nil {
+		log.Infof("Exchange %d failed to send standalone ack: %s", ec.mExchangeId, err.Error())
+	}
+	ec.releaseIfDone()
+}
+
+// Abort 立即关闭并释放Exchange，不通知 ExchangeDelegate，放弃等待确认的消息
+func (ec *ExchangeContext) Abort() {
+	ec.mMutex.Lock()
+	ec.mClosed = true
+	ec.mResponseExpected = false
+	ec.stopResponseTimerLocked()
+	ec.mAckPending = false
+	ec.stopAckTimerLocked()
+	ec.mMutex.Unlock()
+
+	ec.mExchangeMgr.GetReliableMessageMgr().clearRetransTable(ec)
+	ec.mExchangeMgr.releaseContext(ec)
+}
+
+// matchExchange 对端发起的Exchange中，对端消息设置了发起者标志
+func (ec *ExchangeContext) matchExchange(session transport.Session, payloadHeader *message.PayloadHeader) bool {
+	return ec.mExchangeId == payloadHeader.GetExchangeId() &&
+		ec.mSession == session &&
+		ec.mInitiator != payloadHeader.IsInitiator()
+}
+
+// handleMessage 先处理MRP的确认，再把消息交给 ExchangeDelegate，处理完成后不再需要发送或接收消息时关闭Exchange
+func (ec *ExchangeContext) handleMessage(messageCounter uint32, payloadHeader *message.PayloadHeader, isDuplicate bool, payload []byte) {
+	if ackCounter, ok := payloadHeader.GetAckMessageCounter(); ok {
+		ec.handleRcvdAck(ackCounter)
+	}
+	if payloadHeader.NeedsAck() {
+		ec.handleNeedsAck(messageCounter, isDuplicate)
+	}
+
+	ec.mMutex.Lock()
+	ec.mLastPeerActivity = ec.mExchangeMgr.GetReliableMessageMgr().GetClock().Now()
+	if ec.mClosed || isDuplicate || isStandaloneAck(payloadHeader) {
+		ec.mMutex.Unlock()
+		ec.releaseIfDone()
+		return
+	}
+	ec.mResponseExpected = false
+	ec.stopResponseTimerLocked()
+	delegate := ec.mDelegate
+	ec.mMutex.Unlock()
+
+	if delegate == nil {
+		log.Infof("Exchange %d dropping message: no delegate", ec.mExchangeId)
+	} else if err := delegate.OnMessageReceived(ec, payloadHeader, payload); err != nil {
+		log.Infof("Exchange %d failed to handle message: %s", ec.mExchangeId, err.Error())
+	}
+
+	ec.mMutex.Lock()
+	done := !ec.mClosed && !ec.mResponseExpected && !ec.mWillSendMessage
+	ec.mMutex.Unlock()
+	if done {
+		ec.Close()
+	}
+}
+
+// onSessionReleased 会话被释放后Exchange不能再使用，等待响应时通知超时
+func (ec *ExchangeContext) onSessionReleased() {
+	ec.mMutex.Lock()
+	expected := ec.mResponseExpected && !ec.mClosed
+	ec.mResponseExpected = false
+	ec.stopResponseTimerLocked()
+	delegate := ec.mDelegate
+	ec.mMutex.Unlock()
+
+	if expected && delegate != nil {
+		delegate.OnResponseTimeout(ec)
+	}
+	ec.Abort()
+}
+
+func (ec *ExchangeContext) startResponseTimer() {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	ec.stopResponseTimerLocked()
+	ec.mResponseExpected = true
+	if ec.mResponseTimeout <= 0 {
+		return
+	}
+	generation := ec.mResponseGeneration
+	ec.mResponseTimer = ec.mExchangeMgr.GetReliableMessageMgr().GetClock().AfterFunc(ec.mResponseTimeout, func() {
+		ec.onResponseTimeout(generation)
+	})
+}
+
+func (ec *ExchangeContext) cancelResponseTimer() {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	ec.mResponseExpected = false
+	ec.stopResponseTimerLocked()
+}
+
+// stopResponseTimerLocked 停止计时器，已经触发的回调通过代数判断失效
+func (ec *ExchangeContext) stopResponseTimerLocked() {
+	ec.mResponseGeneration++
+	if ec.mResponseTimer != nil {
+		ec.mResponseTimer.Stop()
+		ec.mResponseTimer = nil
+	}
+}
+
+func (ec *ExchangeContext) onResponseTimeout(generation uint64) {
+	ec.mMutex.Lock()
+	if ec.mClosed || generation != ec.mResponseGeneration || !ec.mResponseExpected {
+		ec.mMutex.Unlock()
+		return
+	}
+	ec.mResponseExpected = false
+	ec.mResponseTimer = nil
+	delegate := ec.mDelegate
+	ec.mMutex.Unlock()
+
+	if delegate != nil {
+		delegate.OnResponseTimeout(ec)
+	}
+
+	ec.mMutex.Lock()
+	done := !ec.mClosed && !ec.mResponseExpected && !ec.mWillSendMessage
+	ec.mMutex.Unlock()
+	if done {
+		ec.Close()
+	}
+}
@@ -0,0 +1,29 @@
+package messageing
+
+import (
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+)
+
+// ExchangeDelegate 处理Exchange上收到的消息以及响应超时
+type ExchangeDelegate interface {
+	// OnMessageReceived Exchange收到消息，payload 不包含 PayloadHeader
+	OnMessageReceived(ec *ExchangeContext, payloadHeader *message.PayloadHeader, payload []byte) error
+	// OnResponseTimeout 等待响应超时，之后Exchange会被关闭
+	OnResponseTimeout(ec *ExchangeContext)
+	// OnExchangeClosing Exchange即将被关闭
+	OnExchangeClosing(ec *ExchangeContext)
+}
+
+// UnsolicitedMessageHandler 为对端发起的Exchange提供 ExchangeDelegate
+type UnsolicitedMessageHandler interface {
+	// OnUnsolicitedMessageReceived 收到了对端发起Exchange的第一条消息，返回处理该Exchange的 ExchangeDelegate
+	OnUnsolicitedMessageReceived(payloadHeader *message.PayloadHeader) (ExchangeDelegate, error)
+	// OnExchangeCreationFailed 返回的 ExchangeDelegate 没有被使用
+	OnExchangeCreationFailed(delegate ExchangeDelegate)
+}
+
+// SessionErrorDelegate 会话上的消息达到最大发送次数仍没有被确认，上层可以据此重新建立会话
+type SessionErrorDelegate interface {
+	OnSessionError(session transport.Session, err error)
+}
@@ -1,18 +1,306 @@
 package messageing
 
-import "github.com/galenliu/chip/transport"
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+const (
+	// KMaxExchangeContexts 同时存在的Exchange的最大数量
+	KMaxExchangeContexts = 16
+	// KMaxUnsolicitedMessageHandlers 可以注册的 UnsolicitedMessageHandler 的最大数量
+	KMaxUnsolicitedMessageHandlers = 8
+
+	// kAnyMessageType 注册处理整个协议的 UnsolicitedMessageHandler
+	kAnyMessageType int16 = -1
+)
 
 type ExchangeManager interface {
 	Init(sessions transport.SessionManager) error
+	Shutdown()
+	GetSessionManager() transport.SessionManager
+
+	// NewContext 作为发起者在会话上创建新的Exchange
+	NewContext(session transport.Session, delegate ExchangeDelegate) (*ExchangeContext, error)
+
+	RegisterUnsolicitedMessageHandlerForProtocol(protocolId protocols.Id, handler UnsolicitedMessageHandler) error
+	RegisterUnsolicitedMessageHandlerForType(protocolId protocols.Id, msgType uint8, handler UnsolicitedMessageHandler) error
+	UnregisterUnsolicitedMessageHandlerForProtocol(protocolId protocols.Id) error
+	UnregisterUnsolicitedMessageHandlerForType(protocolId protocols.Id, msgType uint8) error
+
+	GetNumActiveExchanges() int
+
+	GetReliableMessageMgr() *ReliableMessageMgr
+	SetSessionErrorDelegate(delegate SessionErrorDelegate)
+}
+
+type unsolicitedHandlerKey struct {
+	protocolId protocols.Id
+	msgType    int16
 }
 
 type ExchangeManagerImpl struct {
+	mMutex          sync.Mutex
+	mSessionManager transport.SessionManager
+	mInitialized    bool
+	mNextExchangeId uint16
+
+	mContexts            []*ExchangeContext
+	mUnsolicitedHandlers map[unsolicitedHandlerKey]UnsolicitedMessageHandler
+
+	mReliableMessageMgr   *ReliableMessageMgr
+	mSessionErrorDelegate SessionErrorDelegate
 }
 
 func NewExchangeManagerImpl() *ExchangeManagerImpl {
-	return &ExchangeManagerImpl{}
+	return &ExchangeManagerImpl{
+		mUnsolicitedHandlers: make(map[unsolicitedHandlerKey]UnsolicitedMessageHandler),
+		mReliableMessageMgr:  NewReliableMessageMgr(systemClock{}),
+	}
 }
 
-func (e ExchangeManagerImpl) Init(sessions transport.SessionManager) error {
+// Init 接收 SessionManager 解密后的消息以及会话释放的通知
+func (e *ExchangeManagerImpl) Init(sessions transport.SessionManager) error {
+	if sessions == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	e.mMutex.Lock()
+	if e.mInitialized {
+		e.mMutex.Unlock()
+		return internal.ChipErrorIncorrectState
+	}
+	var buf [2]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		e.mMutex.Unlock()
+		return err
+	}
+	e.mNextExchangeId = binary.LittleEndian.Uint16(buf[:])
+	e.mSessionManager = sessions
+	e.mInitialized = true
+	e.mMutex.Unlock()
+
+	sessions.SetMessageDelegate(e)
+	sessions.RegisterReleaseDelegate(e)
 	return nil
 }
+
+// Shutdown 关闭所有的Exchange并停止接收消息
+func (e *ExchangeManagerImpl) Shutdown() {
+	e.mMutex.Lock()
+	contexts := append([]*ExchangeContext(nil), e.mContexts...)
+	sessions := e.mSessionManager
+	e.mMutex.Unlock()
+
+	for _, ec := range contexts {
+		ec.Abort()
+	}
+	if sessions != nil {
+		sessions.SetMessageDelegate(nil)
+		sessions.UnregisterReleaseDelegate(e)
+	}
+
+	e.mMutex.Lock()
+	e.mSessionManager = nil
+	e.mUnsolicitedHandlers = make(map[unsolicitedHandlerKey]UnsolicitedMessageHandler)
+	e.mInitialized = false
+	e.mMutex.Unlock()
+}
+
+func (e *ExchangeManagerImpl) GetSessionManager() transport.SessionManager {
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	return e.mSessionManager
+}
+
+func (e *ExchangeManagerImpl) NewContext(session transport.Session, delegate ExchangeDelegate) (*ExchangeContext, error) {
+	if session == nil {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	if !e.mInitialized {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	exchangeId := e.mNextExchangeId
+	e.mNextExchangeId++
+	return e.allocateContextLocked(exchangeId, session, true, delegate)
+}
+
+func (e *ExchangeManagerImpl) GetReliableMessageMgr() *ReliableMessageMgr {
+	return e.mReliableMessageMgr
+}
+
+func (e *ExchangeManagerImpl) SetSessionErrorDelegate(delegate SessionErrorDelegate) {
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	e.mSessionErrorDelegate = delegate
+}
+
+func (e *ExchangeManagerImpl) notifySessionError(session transport.Session, err error) {
+	e.mMutex.Lock()
+	delegate := e.mSessionErrorDelegate
+	e.mMutex.Unlock()
+	if delegate != nil {
+		delegate.OnSessionError(session, err)
+	}
+}
+
+func (e *ExchangeManagerImpl) GetNumActiveExchanges() int {
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	return len(e.mContexts)
+}
+
+func (e *ExchangeManagerImpl) RegisterUnsolicitedMessageHandlerForProtocol(protocolId protocols.Id, handler UnsolicitedMessageHandler) error {
+	return e.registerUnsolicitedMessageHandler(unsolicitedHandlerKey{protocolId: protocolId, msgType: kAnyMessageType}, handler)
+}
+
+func (e *ExchangeManagerImpl) RegisterUnsolicitedMessageHandlerForType(protocolId protocols.Id, msgType uint8, handler UnsolicitedMessageHandler) error {
+	return e.registerUnsolicitedMessageHandler(unsolicitedHandlerKey{protocolId: protocolId, msgType: int16(msgType)}, handler)
+}
+
+func (e *ExchangeManagerImpl) UnregisterUnsolicitedMessageHandlerForProtocol(protocolId protocols.Id) error {
+	return e.unregisterUnsolicitedMessageHandler(unsolicitedHandlerKey{protocolId: protocolId, msgType: kAnyMessageType})
+}
+
+func (e *ExchangeManagerImpl) UnregisterUnsolicitedMessageHandlerForType(protocolId protocols.Id, msgType uint8) error {
+	return e.unregisterUnsolicitedMessageHandler(unsolicitedHandlerKey{protocolId: protocolId, msgType: int16(msgType)})
+}
+
+// registerUnsolicitedMessageHandler 同一个协议和消息类型重复注册时替换之前的处理者
+func (e *ExchangeManagerImpl) registerUnsolicitedMessageHandler(key unsolicitedHandlerKey, handler UnsolicitedMessageHandler) error {
+	if handler == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	if _, ok := e.mUnsolicitedHandlers[key]; !ok && len(e.mUnsolicitedHandlers) >= KMaxUnsolicitedMessageHandlers {
+		return internal.ChipErrorNoMemory
+	}
+	e.mUnsolicitedHandlers[key] = handler
+	return nil
+}
+
+func (e *ExchangeManagerImpl) unregisterUnsolicitedMessageHandler(key unsolicitedHandlerKey) error {
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	if _, ok := e.mUnsolicitedHandlers[key]; !ok {
+		return internal.ChipErrorNoMessageHandler
+	}
+	delete(e.mUnsolicitedHandlers, key)
+	return nil
+}
+
+// OnMessageReceived 把消息分发给已有的Exchange，或者为对端发起的Exchange创建新的上下文。
+// 不会被处理但是需要确认的消息也会回复确认，避免对端一直重传
+func (e *ExchangeManagerImpl) OnMessageReceived(packetHeader *message.Header, payloadHeader *message.PayloadHeader, session transport.Session, isDuplicate bool, payload []byte) {
+	e.mMutex.Lock()
+	ec := e.findContextLocked(session, payloadHeader)
+	e.mMutex.Unlock()
+	if ec != nil {
+		ec.handleMessage(packetHeader.GetMessageCounter(), payloadHeader, isDuplicate, payload)
+		return
+	}
+
+	if !payloadHeader.IsInitiator() || isDuplicate || isStandaloneAck(payloadHeader) {
+		log.Infof("ExchangeManager dropping message for unknown exchange %d", payloadHeader.GetExchangeId())
+		e.sendStandaloneAckIfNeeded(packetHeader, payloadHeader, session)
+		return
+	}
+
+	protocolId := protocols.NewId(payloadHeader.GetVendorId(), payloadHeader.GetProtocolId())
+	handler := e.findUnsolicitedHandler(protocolId, payloadHeader.GetMessageType())
+	if handler == nil {
+		log.Infof("ExchangeManager no handler for protocol %s type %d", protocolId.String(), payloadHeader.GetMessageType())
+		e.sendStandaloneAckIfNeeded(packetHeader, payloadHeader, session)
+		return
+	}
+	delegate, err := handler.OnUnsolicitedMessageReceived(payloadHeader)
+	if err != nil {
+		log.Infof("ExchangeManager unsolicited message rejected: %s", err.Error())
+		e.sendStandaloneAckIfNeeded(packetHeader, payloadHeader, session)
+		return
+	}
+
+	e.mMutex.Lock()
+	ec, err = e.allocateContextLocked(payloadHeader.GetExchangeId(), session, false, delegate)
+	e.mMutex.Unlock()
+	if err != nil {
+		log.Infof("ExchangeManager failed to allocate exchange: %s", err.Error())
+		handler.OnExchangeCreationFailed(delegate)
+		return
+	}
+	ec.handleMessage(packetHeader.GetMessageCounter(), payloadHeader, false, payload)
+}
+
+// sendStandaloneAckIfNeeded 使用临时的Exchange确认没有对应Exchange的消息
+func (e *ExchangeManagerImpl) sendStandaloneAckIfNeeded(packetHeader *message.Header, payloadHeader *message.PayloadHeader, session transport.Session) {
+	if !payloadHeader.NeedsAck() {
+		return
+	}
+	ec := newExchangeContext(e, payloadHeader.GetExchangeId(), session, !payloadHeader.IsInitiator(), nil)
+	ec.mAckPending = true
+	ec.mPendingPeerAckCounter = packetHeader.GetMessageCounter()
+	if err := ec.flushAcks(); err != nil {
+		log.Infof("ExchangeManager failed to send standalone ack: %s", err.Error())
+	}
+}
+
+// OnSessionReleased 关闭会话上所有的Exchange
+func (e *ExchangeManagerImpl) OnSessionReleased(session transport.Session) {
+	e.mMutex.Lock()
+	var contexts []*ExchangeContext
+	for _, ec := range e.mContexts {
+		if ec.mSession == session {
+			contexts = append(contexts, ec)
+		}
+	}
+	e.mMutex.Unlock()
+	for _, ec := range contexts {
+		ec.onSessionReleased()
+	}
+}
+
+func (e *ExchangeManagerImpl) findUnsolicitedHandler(protocolId protocols.Id, msgType uint8) UnsolicitedMessageHandler {
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	if handler, ok := e.mUnsolicitedHandlers[unsolicitedHandlerKey{protocolId: protocolId, msgType: int16(msgType)}]; ok {
+		return handler
+	}
+	return e.mUnsolicitedHandlers[unsolicitedHandlerKey{protocolId: protocolId, msgType: kAnyMessageType}]
+}
+
+func (e *ExchangeManagerImpl) findContextLocked(session transport.Session, payloadHeader *message.PayloadHeader) *ExchangeContext {
+	for _, ec := range e.mContexts {
+		if ec.matchExchange(session, payloadHeader) {
+			return ec
+		}
+	}
+	return nil
+}
+
+func (e *ExchangeManagerImpl) allocateContextLocked(exchangeId uint16, session transport.Session, initiator bool, delegate ExchangeDelegate) (*ExchangeContext, error) {
+	if len(e.mContexts) >= KMaxExchangeContexts {
+		return nil, internal.ChipErrorNoMemory
+	}
+	ec := newExchangeContext(e, exchangeId, session, initiator, delegate)
+	e.mContexts = append(e.mContexts, ec)
+	return ec, nil
+}
+
+func (e *ExchangeManagerImpl) releaseContext(ec *ExchangeContext) {
+	e.mMutex.Lock()
+	defer e.mMutex.Unlock()
+	for i, c := range e.mContexts {
+		if c == ec {
+			e.mContexts = append(e.mContexts[:i], e.mContexts[i+1:]...)
+			return
+		}
+	}
+}
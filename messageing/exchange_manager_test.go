@@ -0,0 +1,284 @@
+package messageing
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/storage"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testMsgTypeRequest  uint8 = 0x01
+	testMsgTypeResponse uint8 = 0x02
+)
+
+// loopbackTransportManager 把发送的消息直接交给另一端的 SessionManager，可以丢弃接下来的若干条消息
+type loopbackTransportManager struct {
+	mDelegate transport.TransportDelegate
+	mPeer     *loopbackTransportManager
+	mAddress  transport.PeerAddress
+	mSent     int
+	mDropNext int
+}
+
+func (l *loopbackTransportManager) Init(...transport.Transport) error { return nil }
+
+func (l *loopbackTransportManager) SetSessionManager(delegate transport.TransportDelegate) {
+	l.mDelegate = delegate
+}
+
+func (l *loopbackTransportManager) SendMessage(_ transport.PeerAddress, msg []byte) error {
+	l.mSent++
+	if l.mDropNext != 0 {
+		l.mDropNext--
+		return nil
+	}
+	if l.mPeer.mDelegate != nil {
+		l.mPeer.mDelegate.OnMessageReceived(l.mAddress, append([]byte(nil), msg...))
+	}
+	return nil
+}
+
+func (l *loopbackTransportManager) MulticastGroupJoinLeave(transport.PeerAddress, bool) error {
+	return nil
+}
+
+func (l *loopbackTransportManager) GetTransports() []transport.Transport { return nil }
+
+func (l *loopbackTransportManager) Close() {}
+
+type testExchangeDelegate struct {
+	mMutex    sync.Mutex
+	mMessages []uint8
+	mTimeouts int
+	mClosing  int
+	// mRespond 收到请求后在同一个Exchange上回复
+	mRespond bool
+	mTimeout chan struct{}
+}
+
+func newTestExchangeDelegate() *testExchangeDelegate {
+	return &testExchangeDelegate{mTimeout: make(chan struct{}, 1)}
+}
+
+func (d *testExchangeDelegate) OnMessageReceived(ec *ExchangeContext, payloadHeader *message.PayloadHeader, payload []byte) error {
+	d.mMutex.Lock()
+	d.mMessages = append(d.mMessages, payloadHeader.GetMessageType())
+	d.mMutex.Unlock()
+	if d.mRespond {
+		return ec.SendMessage(protocols.Echo, testMsgTypeResponse, payload, SendFlagNone)
+	}
+	return nil
+}
+
+func (d *testExchangeDelegate) OnResponseTimeout(*ExchangeContext) {
+	d.mMutex.Lock()
+	d.mTimeouts++
+	d.mMutex.Unlock()
+	d.mTimeout <- struct{}{}
+}
+
+func (d *testExchangeDelegate) OnExchangeClosing(*ExchangeContext) {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	d.mClosing++
+}
+
+type testUnsolicitedHandler struct {
+	mDelegate *testExchangeDelegate
+	mCount    int
+}
+
+func (h *testUnsolicitedHandler) OnUnsolicitedMessageReceived(*message.PayloadHeader) (ExchangeDelegate, error) {
+	h.mCount++
+	return h.mDelegate, nil
+}
+
+func (h *testUnsolicitedHandler) OnExchangeCreationFailed(ExchangeDelegate) {}
+
+type exchangeManagerPair struct {
+	a, b       *ExchangeManagerImpl
+	aAddress   transport.PeerAddress
+	bAddress   transport.PeerAddress
+	aSessions  *transport.SessionManagerImpl
+	initiator  transport.Session
+	aTransport *loopbackTransportManager
+	bTransport *loopbackTransportManager
+}
+
+func newExchangeManagerPair(t *testing.T) *exchangeManagerPair {
+	t.Helper()
+	aTransport := &loopbackTransportManager{mAddress: transport.NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5541"))}
+	bTransport := &loopbackTransportManager{mAddress: transport.NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5542"))}
+	aTransport.mPeer, bTransport.mPeer = bTransport, aTransport
+
+	p := &exchangeManagerPair{
+		a:          NewExchangeManagerImpl(),
+		b:          NewExchangeManagerImpl(),
+		aAddress:   aTransport.mAddress,
+		bAddress:   bTransport.mAddress,
+		aSessions:  transport.NewSessionManagerImpl(),
+		aTransport: aTransport,
+		bTransport: bTransport,
+	}
+	bSessions := transport.NewSessionManagerImpl()
+	if err := p.aSessions.Init(aTransport, storage.NewInMemoryPersistentStorage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bSessions.Init(bTransport, storage.NewInMemoryPersistentStorage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.a.Init(p.aSessions); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.b.Init(bSessions); err != nil {
+		t.Fatal(err)
+	}
+	session, err := p.aSessions.CreateUnauthenticatedSession(p.bAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.initiator = session
+	return p
+}
+
+func TestExchangeRequestResponse(t *testing.T) {
+	p := newExchangeManagerPair(t)
+	responder := newTestExchangeDelegate()
+	responder.mRespond = true
+	handler := &testUnsolicitedHandler{mDelegate: responder}
+	if err := p.b.RegisterUnsolicitedMessageHandlerForType(protocols.Echo, testMsgTypeRequest, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	initiator := newTestExchangeDelegate()
+	ec, err := p.a.NewContext(p.initiator, initiator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ec.IsInitiator() {
+		t.Errorf("new context must be the initiator")
+	}
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, []byte("ping"), SendFlagExpectResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	if handler.mCount != 1 || len(responder.mMessages) != 1 || responder.mMessages[0] != testMsgTypeRequest {
+		t.Errorf("request not delivered to the unsolicited handler")
+	}
+	if len(initiator.mMessages) != 1 || initiator.mMessages[0] != testMsgTypeResponse {
+		t.Errorf("response not delivered to the initiator exchange")
+	}
+	// 两端处理完消息后都不再需要该Exchange
+	if p.a.GetNumActiveExchanges() != 0 || p.b.GetNumActiveExchanges() != 0 {
+		t.Errorf("exchanges must be closed, got %d and %d", p.a.GetNumActiveExchanges(), p.b.GetNumActiveExchanges())
+	}
+	if initiator.mClosing != 1 || responder.mClosing != 1 || !ec.IsClosed() {
+		t.Errorf("delegates must be notified when the exchange closes")
+	}
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagNone); err != internal.ChipErrorIncorrectState {
+		t.Errorf("sending on a closed exchange must fail")
+	}
+}
+
+func TestExchangeResponseTimeout(t *testing.T) {
+	p := newExchangeManagerPair(t)
+	// B 收到请求但是不回复
+	responder := newTestExchangeDelegate()
+	if err := p.b.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, &testUnsolicitedHandler{mDelegate: responder}); err != nil {
+		t.Fatal(err)
+	}
+
+	initiator := newTestExchangeDelegate()
+	ec, err := p.a.NewContext(p.initiator, initiator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec.SetResponseTimeout(20 * time.Millisecond)
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagExpectResponse); err != nil {
+		t.Fatal(err)
+	}
+	if !ec.IsResponseExpected() {
+		t.Errorf("exchange must wait for a response")
+	}
+	select {
+	case <-initiator.mTimeout:
+	case <-time.After(2 * time.Second):
+		t.Fatal("response timeout not reported")
+	}
+	deadline := time.Now().Add(time.Second)
+	for p.a.GetNumActiveExchanges() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if p.a.GetNumActiveExchanges() != 0 || !ec.IsClosed() {
+		t.Errorf("exchange must be closed after the response timeout")
+	}
+}
+
+func TestExchangeUnsolicitedHandlerRegistration(t *testing.T) {
+	p := newExchangeManagerPair(t)
+	byProtocol := &testUnsolicitedHandler{mDelegate: newTestExchangeDelegate()}
+	byType := &testUnsolicitedHandler{mDelegate: newTestExchangeDelegate()}
+	if err := p.b.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, byProtocol); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.b.RegisterUnsolicitedMessageHandlerForType(protocols.Echo, testMsgTypeRequest, byType); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(msgType uint8) {
+		ec, err := p.a.NewContext(p.initiator, newTestExchangeDelegate())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ec.SendMessage(protocols.Echo, msgType, nil, SendFlagNone); err != nil {
+			t.Fatal(err)
+		}
+		ec.Close()
+	}
+	send(testMsgTypeRequest)
+	send(0x10)
+	if byType.mCount != 1 || byProtocol.mCount != 1 {
+		t.Errorf("type specific handler must take precedence, got %d and %d", byType.mCount, byProtocol.mCount)
+	}
+
+	if err := p.b.UnregisterUnsolicitedMessageHandlerForType(protocols.Echo, testMsgTypeRequest); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.b.UnregisterUnsolicitedMessageHandlerForType(protocols.Echo, testMsgTypeRequest); err == nil {
+		t.Errorf("expected error unregistering a missing handler")
+	}
+	send(testMsgTypeRequest)
+	if byProtocol.mCount != 2 {
+		t.Errorf("protocol handler must receive messages after the type handler is removed")
+	}
+
+	// 其他协议的消息没有处理者
+	ec, _ := p.a.NewContext(p.initiator, newTestExchangeDelegate())
+	_ = ec.SendMessage(protocols.InteractionModel, testMsgTypeRequest, nil, SendFlagNone)
+	ec.Close()
+	if p.b.GetNumActiveExchanges() != 0 {
+		t.Errorf("messages without a handler must not allocate exchanges")
+	}
+}
+
+func TestExchangeManagerShutdown(t *testing.T) {
+	p := newExchangeManagerPair(t)
+	delegate := newTestExchangeDelegate()
+	ec, err := p.a.NewContext(p.initiator, delegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.a.Shutdown()
+	if !ec.IsClosed() || p.a.GetNumActiveExchanges() != 0 {
+		t.Errorf("shutdown must close all exchanges")
+	}
+	if _, err := p.a.NewContext(p.initiator, delegate); err == nil {
+		t.Errorf("expected error creating an exchange after shutdown")
+	}
+}
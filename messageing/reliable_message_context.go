@@ -0,0 +1,173 @@
+package messageing
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// kStandaloneAckMsgType SecureChannel 协议中只携带确认的消息
+const kStandaloneAckMsgType uint8 = 0x10
+
+func isStandaloneAck(payloadHeader *message.PayloadHeader) bool {
+	return payloadHeader.HasMessageType(protocols.SecureChannel.GetVendorId(), protocols.SecureChannel.GetProtocolId(), kStandaloneAckMsgType)
+}
+
+// isReliableTransmission 只有UDP上的单播消息使用MRP，TCP和BLE本身是可靠的
+func (ec *ExchangeContext) isReliableTransmission() bool {
+	if ec.mSession.IsGroupSession() {
+		return false
+	}
+	return ec.mSession.GetPeerAddress().GetTransportType() == transport.TypeUdp
+}
+
+// getMRPBaseTimeout 最近收到过对端消息时使用对端的活跃重传间隔，否则使用空闲重传间隔
+func (ec *ExchangeContext) getMRPBaseTimeout() time.Duration {
+	config := GetRemoteMRPConfig(ec.mSession)
+	now := ec.mExchangeMgr.GetReliableMessageMgr().GetClock().Now()
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	if !ec.mLastPeerActivity.IsZero() && now.Sub(ec.mLastPeerActivity) < KMrpActiveThreshold {
+		return config.ActiveRetransTimeout
+	}
+	return config.IdleRetransTimeout
+}
+
+// piggybackAck 在发送的消息中捎带等待发送的确认
+func (ec *ExchangeContext) piggybackAck(payloadHeader *message.PayloadHeader) {
+	ec.mMutex.Lock()
+	defer ec.mMutex.Unlock()
+	if !ec.mAckPending {
+		return
+	}
+	payloadHeader.SetAckMessageCounter(ec.mPendingPeerAckCounter)
+	ec.mAckPending = false
+	ec.stopAckTimerLocked()
+}
+
+func (ec *ExchangeContext) handleRcvdAck(ackMessageCounter uint32) {
+	if !ec.mExchangeMgr.GetReliableMessageMgr().checkAndRemRetransTable(ec, ackMessageCounter) {
+		log.Infof("Exchange %d received ack for unknown message %d", ec.mExchangeId, ackMessageCounter)
+	}
+}
+
+// handleNeedsAck 记录需要确认的消息，重复消息或者已关闭的Exchange立即发送确认，
+// 否则等待捎带确认，超时后发送单独的确认
+func (ec *ExchangeContext) handleNeedsAck(messageCounter uint32, isDuplicate bool) {
+	ec.mMutex.Lock()
+	if ec.mAckPending && ec.mPendingPeerAckCounter != messageCounter {
+		ec.mMutex.Unlock()
+		if err := ec.flushAcks(); err != nil {
+			log.Infof("Exchange %d failed to send standalone ack: %s", ec.mExchangeId, err.Error())
+		}
+		ec.mMutex.Lock()
+	}
+	ec.mAckPending = true
+	ec.mPendingPeerAckCounter = messageCounter
+	if isDuplicate || ec.mClosed {
+		ec.mMutex.Unlock()
+		if err := ec.flushAcks(); err != nil {
+			log.Infof("Exchange %d failed to send standalone ack: %s", ec.mExchangeId, err.Error())
+		}
+		return
+	}
+	ec.stopAckTimerLocked()
+	generation := ec.mAckGeneration
+	ec.mAckTimer = ec.mExchangeMgr.GetReliableMessageMgr().GetClock().AfterFunc(KMrpStandaloneAckTimeout, func() {
+		ec.onAckTimeout(generation)
+	})
+	ec.mMutex.Unlock()
+}
+
+// flushAcks 把等待发送的确认作为单独的确认消息发送
+func (ec *ExchangeContext) flushAcks() error {
+	ec.mMutex.Lock()
+	if !ec.mAckPending {
+		ec.mMutex.Unlock()
+		return nil
+	}
+	counter := ec.mPendingPeerAckCounter
+	ec.mAckPending = false
+	ec.stopAckTimerLocked()
+	ec.mMutex.Unlock()
+
+	payloadHeader := message.NewPayloadHeader()
+	payloadHeader.SetExchangeId(ec.mExchangeId)
+	payloadHeader.SetInitiator(ec.mInitiator)
+	payloadHeader.SetVendorId(protocols.SecureChannel.GetVendorId())
+	payloadHeader.SetMessageType(protocols.SecureChannel.GetProtocolId(), kStandaloneAckMsgType)
+	payloadHeader.SetAckMessageCounter(counter)
+
+	sessions := ec.mExchangeMgr.GetSessionManager()
+	if sessions == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	prepared, err := sessions.PrepareMessage(ec.mSession, payloadHeader, nil)
+	if err != nil {
+		return err
+	}
+	return sessions.SendPreparedMessage(ec.mSession, prepared)
+}
+
+func (ec *ExchangeContext) onAckTimeout(generation uint64) {
+	ec.mMutex.Lock()
+	if generation != ec.mAckGeneration {
+		ec.mMutex.Unlock()
+		return
+	}
+	ec.mMutex.Unlock()
+	if err := ec.flushAcks(); err != nil {
+		log.Infof("Exchange %d failed to send standalone ack: %s", ec.mExchangeId, err.Error())
+	}
+	ec.releaseIfDone()
+}
+
+func (ec *ExchangeContext) stopAckTimerLocked() {
+	ec.mAckGeneration++
+	if ec.mAckTimer != nil {
+		ec.mAckTimer.Stop()
+		ec.mAckTimer = nil
+	}
+}
+
+func (ec *ExchangeContext) resendMessage(prepared *transport.PreparedMessage) error {
+	sessions := ec.mExchangeMgr.GetSessionManager()
+	if sessions == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	return sessions.SendPreparedMessage(ec.mSession, prepared)
+}
+
+// onMessageNotAcknowledged 消息达到最大发送次数，报告会话错误，等待响应的Exchange通知超时后关闭
+func (ec *ExchangeContext) onMessageNotAcknowledged() {
+	ec.mMutex.Lock()
+	expected := ec.mResponseExpected && !ec.mClosed
+	closed := ec.mClosed
+	ec.mResponseExpected = false
+	ec.stopResponseTimerLocked()
+	delegate := ec.mDelegate
+	ec.mMutex.Unlock()
+
+	ec.mExchangeMgr.notifySessionError(ec.mSession, internal.ChipErrorMessageNotAcknowledged)
+	if expected && delegate != nil {
+		delegate.OnResponseTimeout(ec)
+	}
+	if closed {
+		ec.releaseIfDone()
+	} else {
+		ec.Close()
+	}
+}
+
+// releaseIfDone 已关闭的Exchange在确认全部完成后释放
+func (ec *ExchangeContext) releaseIfDone() {
+	ec.mMutex.Lock()
+	done := ec.mClosed && !ec.mAckPending
+	ec.mMutex.Unlock()
+	if done && !ec.mExchangeMgr.GetReliableMessageMgr().hasRetransEntry(ec) {
+		ec.mExchangeMgr.releaseContext(ec)
+	}
+}
@@ -0,0 +1,187 @@
+package messageing
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/transport"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// KMaxRetransTableSize 每个Exchange同时只能有一条等待确认的消息
+const KMaxRetransTableSize = KMaxExchangeContexts
+
+// retransEntry 重传表中等待对端确认的消息
+type retransEntry struct {
+	mExchange  *ExchangeContext
+	mMessage   *transport.PreparedMessage
+	mSendCount int
+	mTimer     Timer
+}
+
+// ReliableMessageMgr MRP的重传表，按照指数退避重传没有被确认的消息，超过最大发送次数后通知Exchange
+type ReliableMessageMgr struct {
+	mMutex        sync.Mutex
+	mClock        Clock
+	mRandom       func() float64
+	mRetransTable []*retransEntry
+}
+
+func NewReliableMessageMgr(clock Clock) *ReliableMessageMgr {
+	return &ReliableMessageMgr{
+		mClock:  clock,
+		mRandom: rand.Float64,
+	}
+}
+
+func (r *ReliableMessageMgr) SetClock(clock Clock) {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	r.mClock = clock
+}
+
+func (r *ReliableMessageMgr) GetClock() Clock {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	return r.mClock
+}
+
+// SetRandom 设置退避抖动使用的随机数来源，返回值在[0,1)之间
+func (r *ReliableMessageMgr) SetRandom(random func() float64) {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	r.mRandom = random
+}
+
+// GetBackoff 计算第 sendCount 次发送之后等待确认的时间:
+// baseInterval * 1.1 * 1.6^max(0, sendCount-1-1) * (1 + random*0.25)
+func (r *ReliableMessageMgr) GetBackoff(baseInterval time.Duration, sendCount int) time.Duration {
+	r.mMutex.Lock()
+	random := r.mRandom
+	r.mMutex.Unlock()
+	return getBackoff(baseInterval, sendCount, random())
+}
+
+func getBackoff(baseInterval time.Duration, sendCount int, random float64) time.Duration {
+	exponent := sendCount - 1 - KMrpBackoffThreshold
+	if exponent < 0 {
+		exponent = 0
+	}
+	backoff := float64(baseInterval) * KMrpBackoffMargin * math.Pow(KMrpBackoffBase, float64(exponent))
+	return time.Duration(backoff * (1 + random*KMrpBackoffJitter))
+}
+
+// GetRetransTableCount 重传表中等待确认的消息数量
+func (r *ReliableMessageMgr) GetRetransTableCount() int {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	return len(r.mRetransTable)
+}
+
+// addToRetransTable 保存已经第一次发送的消息，在 startRetransmission 之后开始计时
+func (r *ReliableMessageMgr) addToRetransTable(ec *ExchangeContext, message *transport.PreparedMessage) (*retransEntry, error) {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	if r.findEntryLocked(ec) >= 0 {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	if len(r.mRetransTable) >= KMaxRetransTableSize {
+		return nil, internal.ChipErrorNoMemory
+	}
+	entry := &retransEntry{mExchange: ec, mMessage: message, mSendCount: 1}
+	r.mRetransTable = append(r.mRetransTable, entry)
+	return entry, nil
+}
+
+// startRetransmission 消息发送后开始等待确认，同步收到确认的消息已经不在重传表中
+func (r *ReliableMessageMgr) startRetransmission(entry *retransEntry) {
+	timeout := r.GetBackoff(entry.mExchange.getMRPBaseTimeout(), entry.mSendCount)
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	if !r.containsLocked(entry) {
+		return
+	}
+	entry.mTimer = r.mClock.AfterFunc(timeout, func() {
+		r.onRetransTimeout(entry)
+	})
+}
+
+// checkAndRemRetransTable 收到确认时移除Exchange上对应消息计数的重传
+func (r *ReliableMessageMgr) checkAndRemRetransTable(ec *ExchangeContext, ackMessageCounter uint32) bool {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	index := r.findEntryLocked(ec)
+	if index < 0 || r.mRetransTable[index].mMessage.GetMessageCounter() != ackMessageCounter {
+		return false
+	}
+	r.removeLocked(index)
+	return true
+}
+
+// clearRetransTable 放弃Exchange上所有等待确认的消息
+func (r *ReliableMessageMgr) clearRetransTable(ec *ExchangeContext) {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	if index := r.findEntryLocked(ec); index >= 0 {
+		r.removeLocked(index)
+	}
+}
+
+func (r *ReliableMessageMgr) hasRetransEntry(ec *ExchangeContext) bool {
+	r.mMutex.Lock()
+	defer r.mMutex.Unlock()
+	return r.findEntryLocked(ec) >= 0
+}
+
+func (r *ReliableMessageMgr) onRetransTimeout(entry *retransEntry) {
+	r.mMutex.Lock()
+	if !r.containsLocked(entry) {
+		r.mMutex.Unlock()
+		return
+	}
+	ec := entry.mExchange
+	if entry.mSendCount >= KMrpMaxTransmissions {
+		r.removeLocked(r.findEntryLocked(ec))
+		r.mMutex.Unlock()
+		log.Infof("MRP message %d on exchange %d not acknowledged after %d transmissions",
+			entry.mMessage.GetMessageCounter(), ec.GetExchangeId(), entry.mSendCount)
+		ec.onMessageNotAcknowledged()
+		return
+	}
+	entry.mSendCount++
+	r.mMutex.Unlock()
+
+	log.Infof("MRP retransmitting message %d on exchange %d, send count %d",
+		entry.mMessage.GetMessageCounter(), ec.GetExchangeId(), entry.mSendCount)
+	if err := ec.resendMessage(entry.mMessage); err != nil {
+		log.Infof("MRP failed to retransmit message %d: %s", entry.mMessage.GetMessageCounter(), err.Error())
+	}
+	r.startRetransmission(entry)
+}
+
+func (r *ReliableMessageMgr) findEntryLocked(ec *ExchangeContext) int {
+	for i, entry := range r.mRetransTable {
+		if entry.mExchange == ec {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *ReliableMessageMgr) containsLocked(entry *retransEntry) bool {
+	for _, e := range r.mRetransTable {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ReliableMessageMgr) removeLocked(index int) {
+	if timer := r.mRetransTable[index].mTimer; timer != nil {
+		timer.Stop()
+	}
+	r.mRetransTable = append(r.mRetransTable[:index], r.mRetransTable[index+1:]...)
+}
@@ -0,0 +1,337 @@
+package messageing
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟，到期的计时器在 Advance 中同步触发
+type fakeClock struct {
+	mMutex  sync.Mutex
+	mNow    time.Time
+	mTimers []*fakeTimer
+}
+
+type fakeTimer struct {
+	mClock    *fakeClock
+	mDeadline time.Time
+	mFunc     func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{mNow: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	return c.mNow
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	timer := &fakeTimer{mClock: c, mDeadline: c.mNow.Add(d), mFunc: f}
+	c.mTimers = append(c.mTimers, timer)
+	return timer
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.mClock.mMutex.Lock()
+	defer t.mClock.mMutex.Unlock()
+	for i, timer := range t.mClock.mTimers {
+		if timer == t {
+			t.mClock.mTimers = append(t.mClock.mTimers[:i], t.mClock.mTimers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance 推进时间，按到期时间依次触发计时器，回调中新建的计时器到期也会触发
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mMutex.Lock()
+	end := c.mNow.Add(d)
+	c.mMutex.Unlock()
+	for {
+		c.mMutex.Lock()
+		sort.SliceStable(c.mTimers, func(i, j int) bool {
+			return c.mTimers[i].mDeadline.Before(c.mTimers[j].mDeadline)
+		})
+		if len(c.mTimers) == 0 || c.mTimers[0].mDeadline.After(end) {
+			c.mNow = end
+			c.mMutex.Unlock()
+			return
+		}
+		timer := c.mTimers[0]
+		c.mTimers = c.mTimers[1:]
+		c.mNow = timer.mDeadline
+		c.mMutex.Unlock()
+		timer.mFunc()
+	}
+}
+
+type testSessionErrorDelegate struct {
+	mErrors []error
+}
+
+func (d *testSessionErrorDelegate) OnSessionError(_ transport.Session, err error) {
+	d.mErrors = append(d.mErrors, err)
+}
+
+// willSendDelegate 收到消息后不立即回复，确认只能通过单独的确认消息发送
+type willSendDelegate struct {
+	*testExchangeDelegate
+}
+
+func (d *willSendDelegate) OnMessageReceived(ec *ExchangeContext, payloadHeader *message.PayloadHeader, payload []byte) error {
+	ec.WillSendMessage()
+	return d.testExchangeDelegate.OnMessageReceived(ec, payloadHeader, payload)
+}
+
+type willSendHandler struct {
+	mDelegate *willSendDelegate
+}
+
+func (h *willSendHandler) OnUnsolicitedMessageReceived(*message.PayloadHeader) (ExchangeDelegate, error) {
+	return h.mDelegate, nil
+}
+
+func (h *willSendHandler) OnExchangeCreationFailed(ExchangeDelegate) {}
+
+func newMRPTestPair(t *testing.T) (*exchangeManagerPair, *fakeClock) {
+	p := newExchangeManagerPair(t)
+	clock := newFakeClock()
+	for _, mgr := range []*ExchangeManagerImpl{p.a, p.b} {
+		mgr.GetReliableMessageMgr().SetClock(clock)
+		mgr.GetReliableMessageMgr().SetRandom(func() float64 { return 0 })
+	}
+	p.initiator.SetRemoteMRPConfig(ReliableMessageProtocolConfig{
+		IdleRetransTimeout:   500 * time.Millisecond,
+		ActiveRetransTimeout: 100 * time.Millisecond,
+	})
+	return p, clock
+}
+
+func TestMRPBackoff(t *testing.T) {
+	base := 300 * time.Millisecond
+	cases := []struct {
+		sendCount int
+		random    float64
+		expected  time.Duration
+	}{
+		{1, 0, 330 * time.Millisecond},
+		{2, 0, 330 * time.Millisecond},
+		{3, 0, 528 * time.Millisecond},
+		{4, 0, 844800 * time.Microsecond},
+		{1, 1, 412500 * time.Microsecond},
+	}
+	for _, c := range cases {
+		backoff := getBackoff(base, c.sendCount, c.random)
+		if diff := backoff - c.expected; diff > time.Microsecond || diff < -time.Microsecond {
+			t.Errorf("backoff for send count %d: got %s, expected %s", c.sendCount, backoff, c.expected)
+		}
+	}
+}
+
+func TestMRPConfigDefaults(t *testing.T) {
+	local := GetLocalMRPConfig()
+	if local.IdleRetransTimeout != 5000*time.Millisecond || local.ActiveRetransTimeout != 300*time.Millisecond {
+		t.Errorf("unexpected local MRP config %+v", *local)
+	}
+	p := newExchangeManagerPair(t)
+	p.initiator.SetRemoteMRPConfig(ReliableMessageProtocolConfig{ActiveRetransTimeout: time.Second})
+	remote := GetRemoteMRPConfig(p.initiator)
+	if remote.IdleRetransTimeout != local.IdleRetransTimeout || remote.ActiveRetransTimeout != time.Second {
+		t.Errorf("missing peer parameters must use the defaults, got %+v", remote)
+	}
+}
+
+func TestMRPRetransmitUntilAcked(t *testing.T) {
+	p, clock := newMRPTestPair(t)
+	responder := newTestExchangeDelegate()
+	if err := p.b.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, &testUnsolicitedHandler{mDelegate: responder}); err != nil {
+		t.Fatal(err)
+	}
+
+	ec, err := p.a.NewContext(p.initiator, newTestExchangeDelegate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.aTransport.mDropNext = 2
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagNone); err != nil {
+		t.Fatal(err)
+	}
+	// 等待确认的Exchange关闭后仍然保留
+	ec.Close()
+	if p.a.GetReliableMessageMgr().GetRetransTableCount() != 1 || p.a.GetNumActiveExchanges() != 1 {
+		t.Fatalf("unacknowledged message must stay in the retransmission table")
+	}
+
+	// 没有收到过对端的消息，使用空闲重传间隔 500ms * 1.1
+	clock.Advance(549 * time.Millisecond)
+	if p.aTransport.mSent != 1 {
+		t.Fatalf("retransmitted too early")
+	}
+	clock.Advance(time.Millisecond)
+	if p.aTransport.mSent != 2 {
+		t.Fatalf("expected first retransmission, sent %d", p.aTransport.mSent)
+	}
+	clock.Advance(550 * time.Millisecond)
+	if p.aTransport.mSent != 3 || len(responder.mMessages) != 1 {
+		t.Fatalf("expected second retransmission to be delivered, sent %d", p.aTransport.mSent)
+	}
+	if p.a.GetReliableMessageMgr().GetRetransTableCount() != 0 || p.a.GetNumActiveExchanges() != 0 {
+		t.Errorf("acknowledged message must be removed and the exchange released")
+	}
+	clock.Advance(10 * time.Second)
+	if p.aTransport.mSent != 3 {
+		t.Errorf("no retransmissions expected after the ack")
+	}
+}
+
+func TestMRPPiggybackedAck(t *testing.T) {
+	p, _ := newMRPTestPair(t)
+	responder := newTestExchangeDelegate()
+	responder.mRespond = true
+	if err := p.b.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, &testUnsolicitedHandler{mDelegate: responder}); err != nil {
+		t.Fatal(err)
+	}
+
+	initiator := newTestExchangeDelegate()
+	ec, err := p.a.NewContext(p.initiator, initiator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagExpectResponse); err != nil {
+		t.Fatal(err)
+	}
+	// B 的响应捎带了请求的确认，A 关闭Exchange时发送单独的确认
+	if p.bTransport.mSent != 1 || p.aTransport.mSent != 2 {
+		t.Errorf("unexpected message count: a sent %d, b sent %d", p.aTransport.mSent, p.bTransport.mSent)
+	}
+	if len(initiator.mMessages) != 1 || initiator.mMessages[0] != testMsgTypeResponse {
+		t.Errorf("standalone acks must not be delivered to the delegate")
+	}
+	if p.a.GetReliableMessageMgr().GetRetransTableCount() != 0 || p.b.GetReliableMessageMgr().GetRetransTableCount() != 0 {
+		t.Errorf("both messages must be acknowledged")
+	}
+	if p.a.GetNumActiveExchanges() != 0 || p.b.GetNumActiveExchanges() != 0 {
+		t.Errorf("exchanges must be released")
+	}
+}
+
+func TestMRPStandaloneAckTimer(t *testing.T) {
+	p, clock := newMRPTestPair(t)
+	responder := &willSendDelegate{testExchangeDelegate: newTestExchangeDelegate()}
+	if err := p.b.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, &willSendHandler{mDelegate: responder}); err != nil {
+		t.Fatal(err)
+	}
+
+	ec, err := p.a.NewContext(p.initiator, newTestExchangeDelegate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagExpectResponse); err != nil {
+		t.Fatal(err)
+	}
+	if p.bTransport.mSent != 0 {
+		t.Fatalf("ack must wait for a piggyback opportunity")
+	}
+	clock.Advance(KMrpStandaloneAckTimeout - time.Millisecond)
+	if p.bTransport.mSent != 0 {
+		t.Fatalf("standalone ack sent too early")
+	}
+	clock.Advance(time.Millisecond)
+	if p.bTransport.mSent != 1 {
+		t.Fatalf("standalone ack not sent after the ack timeout")
+	}
+	if p.a.GetReliableMessageMgr().GetRetransTableCount() != 0 {
+		t.Errorf("standalone ack must clear the retransmission")
+	}
+	if !ec.IsResponseExpected() || len(ec.GetDelegate().(*testExchangeDelegate).mMessages) != 0 {
+		t.Errorf("standalone ack must not satisfy the response")
+	}
+}
+
+func TestMRPDuplicateAcked(t *testing.T) {
+	p, clock := newMRPTestPair(t)
+	responder := newTestExchangeDelegate()
+	if err := p.b.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, &testUnsolicitedHandler{mDelegate: responder}); err != nil {
+		t.Fatal(err)
+	}
+
+	ec, err := p.a.NewContext(p.initiator, newTestExchangeDelegate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// B 的第一个确认丢失，A 重传后 B 收到重复的消息只回复确认
+	p.bTransport.mDropNext = 1
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagNone); err != nil {
+		t.Fatal(err)
+	}
+	if p.a.GetReliableMessageMgr().GetRetransTableCount() != 1 {
+		t.Fatalf("lost ack must leave the message unacknowledged")
+	}
+	clock.Advance(550 * time.Millisecond)
+	if p.aTransport.mSent != 2 || p.bTransport.mSent != 2 {
+		t.Errorf("unexpected message count: a sent %d, b sent %d", p.aTransport.mSent, p.bTransport.mSent)
+	}
+	if len(responder.mMessages) != 1 {
+		t.Errorf("duplicate must not be delivered, got %d messages", len(responder.mMessages))
+	}
+	if p.a.GetReliableMessageMgr().GetRetransTableCount() != 0 {
+		t.Errorf("duplicate must be acknowledged")
+	}
+}
+
+func TestMRPMaxRetransmissions(t *testing.T) {
+	p, clock := newMRPTestPair(t)
+	errors := &testSessionErrorDelegate{}
+	p.a.SetSessionErrorDelegate(errors)
+
+	initiator := newTestExchangeDelegate()
+	ec, err := p.a.NewContext(p.initiator, initiator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.aTransport.mDropNext = KMrpMaxTransmissions
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagExpectResponse); err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagNone); err != internal.ChipErrorIncorrectState {
+		t.Errorf("only one unacknowledged message is allowed per exchange")
+	}
+
+	clock.Advance(time.Minute)
+	if p.aTransport.mSent != KMrpMaxTransmissions {
+		t.Errorf("expected %d transmissions, got %d", KMrpMaxTransmissions, p.aTransport.mSent)
+	}
+	if len(errors.mErrors) != 1 || errors.mErrors[0] != internal.ChipErrorMessageNotAcknowledged {
+		t.Errorf("expected a session error, got %v", errors.mErrors)
+	}
+	if initiator.mTimeouts != 1 || !ec.IsClosed() || p.a.GetNumActiveExchanges() != 0 {
+		t.Errorf("exchange waiting for a response must time out and close")
+	}
+}
+
+func TestMRPNotUsedForTcp(t *testing.T) {
+	p, _ := newMRPTestPair(t)
+	p.initiator.SetPeerAddress(transport.NewTcpPeerAddress(p.bAddress.GetAddrPort()))
+	ec, err := p.a.NewContext(p.initiator, newTestExchangeDelegate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendMessage(protocols.Echo, testMsgTypeRequest, nil, SendFlagNone); err != nil {
+		t.Fatal(err)
+	}
+	if p.a.GetReliableMessageMgr().GetRetransTableCount() != 0 {
+		t.Errorf("messages over TCP must not be retransmitted")
+	}
+}
@@ -1,23 +1,36 @@
 package messageing
 
 import (
+	"github.com/galenliu/chip/transport"
 	"sync"
 	"time"
 )
 
+// ConfigMrpDefaultIdleRetryInterval 本端空闲时的重传间隔，单位毫秒
 var ConfigMrpDefaultIdleRetryInterval int64 = 5000
+
+// ConfigMrpDefaultActiveRetryInterval 本端活跃时的重传间隔，单位毫秒
 var ConfigMrpDefaultActiveRetryInterval int64 = 300
 
-type ReliableMessageProtocolConfig struct {
-	IdleRetransTimeout   time.Duration
-	ActiveRetransTimeout time.Duration
-}
+const (
+	// KMrpMaxTransmissions 一条消息最多发送的次数（包括第一次发送）
+	KMrpMaxTransmissions = 5
+	// KMrpActiveThreshold 收到对端消息之后的这段时间内认为对端处于活跃状态
+	KMrpActiveThreshold = 4000 * time.Millisecond
+	// KMrpStandaloneAckTimeout 收到需要确认的消息后，等待捎带确认的最长时间
+	KMrpStandaloneAckTimeout = 200 * time.Millisecond
 
-func (c ReliableMessageProtocolConfig) Init() *ReliableMessageProtocolConfig {
-	c.ActiveRetransTimeout = time.Duration(0)
-	c.ActiveRetransTimeout = time.Duration(0)
-	return &c
-}
+	// KMrpBackoffBase 指数退避的底数
+	KMrpBackoffBase = 1.6
+	// KMrpBackoffMargin 重传间隔的余量系数
+	KMrpBackoffMargin = 1.1
+	// KMrpBackoffJitter 随机抖动的最大比例
+	KMrpBackoffJitter = 0.25
+	// KMrpBackoffThreshold 前几次重传不做指数退避
+	KMrpBackoffThreshold = 1
+)
+
+type ReliableMessageProtocolConfig = transport.ReliableMessageProtocolConfig
 
 var _rmpc *ReliableMessageProtocolConfig
 var rmpcOnce = sync.Once{}
@@ -32,7 +45,20 @@ func GetLocalMRPConfig() *ReliableMessageProtocolConfig {
 
 func newReliableMessageProtocolConfig() *ReliableMessageProtocolConfig {
 	rmpc := &ReliableMessageProtocolConfig{}
-	rmpc.IdleRetransTimeout = time.Duration(ConfigMrpDefaultIdleRetryInterval)
-	rmpc.ActiveRetransTimeout = time.Duration(ConfigMrpDefaultActiveRetryInterval)
+	rmpc.IdleRetransTimeout = time.Duration(ConfigMrpDefaultIdleRetryInterval) * time.Millisecond
+	rmpc.ActiveRetransTimeout = time.Duration(ConfigMrpDefaultActiveRetryInterval) * time.Millisecond
 	return rmpc
 }
+
+// GetRemoteMRPConfig 对端没有提供的参数使用默认值
+func GetRemoteMRPConfig(session transport.Session) ReliableMessageProtocolConfig {
+	config := session.GetRemoteMRPConfig()
+	defaults := newReliableMessageProtocolConfig()
+	if config.IdleRetransTimeout <= 0 {
+		config.IdleRetransTimeout = defaults.IdleRetransTimeout
+	}
+	if config.ActiveRetransTimeout <= 0 {
+		config.ActiveRetransTimeout = defaults.ActiveRetransTimeout
+	}
+	return config
+}
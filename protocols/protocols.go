@@ -0,0 +1,52 @@
+package protocols
+
+import (
+	"fmt"
+	"github.com/galenliu/chip/lib"
+)
+
+// KVendorIdCommon 标准协议使用的厂商ID
+const KVendorIdCommon lib.VendorId = 0x0000
+
+// Id 由厂商ID和协议ID组成的协议标识
+type Id struct {
+	mVendorId   lib.VendorId
+	mProtocolId uint16
+}
+
+func NewId(vendorId lib.VendorId, protocolId uint16) Id {
+	return Id{mVendorId: vendorId, mProtocolId: protocolId}
+}
+
+func (id Id) GetVendorId() lib.VendorId {
+	return id.mVendorId
+}
+
+func (id Id) GetProtocolId() uint16 {
+	return id.mProtocolId
+}
+
+func (id Id) String() string {
+	if name, ok := protocolNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("%04X:%04X", uint16(id.mVendorId), id.mProtocolId)
+}
+
+// Matter 规范定义的标准协议
+var (
+	SecureChannel             = NewId(KVendorIdCommon, 0x0000)
+	InteractionModel          = NewId(KVendorIdCommon, 0x0001)
+	BDX                       = NewId(KVendorIdCommon, 0x0002)
+	UserDirectedCommissioning = NewId(KVendorIdCommon, 0x0003)
+	Echo                      = NewId(KVendorIdCommon, 0x0004)
+	NotSpecified              = NewId(0xFFFF, 0xFFFF)
+)
+
+var protocolNames = map[Id]string{
+	SecureChannel:             "SecureChannel",
+	InteractionModel:          "IM",
+	BDX:                       "BDX",
+	UserDirectedCommissioning: "UDC",
+	Echo:                      "Echo",
+}
@@ -0,0 +1,111 @@
+package securechannel
+
+import (
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+// CASEServer 监听 Sigma1，每次只处理一个 CASE 会话建立
+type CASEServer struct {
+	mMutex             sync.Mutex
+	mExchangeMgr       messageing.ExchangeManager
+	mFabrics           CASEFabricTable
+	mGroupData         credentials.GroupDataProvider
+	mResumptionStorage lib.SessionResumptionStorage
+	mLocalMRPConfig    *messageing.ReliableMessageProtocolConfig
+	mDelegate          SessionEstablishmentDelegate
+	mPairingSession    *CASESession
+}
+
+func NewCASEServer() *CASEServer {
+	return &CASEServer{}
+}
+
+// ListenForSessionEstablishment 注册 Sigma1 处理，resumptionStorage 为空时不支持会话恢复，delegate 可以为空
+func (s *CASEServer) ListenForSessionEstablishment(exchangeMgr messageing.ExchangeManager, fabrics CASEFabricTable,
+	groupData credentials.GroupDataProvider, resumptionStorage lib.SessionResumptionStorage,
+	mrpConfig *messageing.ReliableMessageProtocolConfig, delegate SessionEstablishmentDelegate) error {
+	if exchangeMgr == nil || fabrics == nil || groupData == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.Lock()
+	s.mExchangeMgr = exchangeMgr
+	s.mFabrics = fabrics
+	s.mGroupData = groupData
+	s.mResumptionStorage = resumptionStorage
+	s.mLocalMRPConfig = mrpConfig
+	s.mDelegate = delegate
+	s.mMutex.Unlock()
+	return exchangeMgr.RegisterUnsolicitedMessageHandlerForType(protocols.SecureChannel, MsgTypeCASESigma1, s)
+}
+
+func (s *CASEServer) Shutdown() {
+	s.mMutex.Lock()
+	exchangeMgr := s.mExchangeMgr
+	session := s.mPairingSession
+	s.mExchangeMgr = nil
+	s.mPairingSession = nil
+	s.mMutex.Unlock()
+
+	if session != nil {
+		session.Clear()
+	}
+	if exchangeMgr != nil {
+		_ = exchangeMgr.UnregisterUnsolicitedMessageHandlerForType(protocols.SecureChannel, MsgTypeCASESigma1)
+	}
+}
+
+func (s *CASEServer) OnUnsolicitedMessageReceived(*message.PayloadHeader) (messageing.ExchangeDelegate, error) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mExchangeMgr == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	if s.mPairingSession != nil {
+		log.Infof("CASE server busy, dropping Sigma1")
+		return nil, internal.ChipErrorIncorrectState
+	}
+	session := NewCASESession()
+	if err := session.PrepareForSessionEstablishment(s.mExchangeMgr, s.mFabrics, s.mGroupData, s.mResumptionStorage, s.mLocalMRPConfig, s); err != nil {
+		return nil, err
+	}
+	s.mPairingSession = session
+	return session, nil
+}
+
+func (s *CASEServer) OnExchangeCreationFailed(delegate messageing.ExchangeDelegate) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mPairingSession == delegate {
+		s.mPairingSession = nil
+	}
+}
+
+func (s *CASEServer) OnSessionEstablishmentError(err error) {
+	s.mMutex.Lock()
+	delegate := s.mDelegate
+	s.mPairingSession = nil
+	s.mMutex.Unlock()
+
+	if delegate != nil {
+		delegate.OnSessionEstablishmentError(err)
+	}
+}
+
+func (s *CASEServer) OnSessionEstablished(session *transport.SecureSession) {
+	s.mMutex.Lock()
+	delegate := s.mDelegate
+	s.mPairingSession = nil
+	s.mMutex.Unlock()
+
+	if delegate != nil {
+		delegate.OnSessionEstablished(session)
+	}
+}
@@ -0,0 +1,861 @@
+package securechannel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	log "github.com/sirupsen/logrus"
+	"hash"
+	"sync"
+)
+
+const (
+	kSigmaParamRandomNumberSize = 32
+	// KCASEResumptionIdSize 会话恢复ID的长度
+	KCASEResumptionIdSize  = lib.KResumptionIdSize
+	kCASEResumeMICSize     = crypto.KAES128CCMTagLength
+	kCASEDestinationIdSize = sha256.Size
+)
+
+var (
+	kTBEData2Nonce = []byte("NCASE_Sigma2N")
+	kTBEData3Nonce = []byte("NCASE_Sigma3N")
+	kKDFSR2Info    = []byte("Sigma2")
+	kKDFSR3Info    = []byte("Sigma3")
+
+	kResume1MICNonce       = []byte("NCASE_SigmaS1")
+	kResume2MICNonce       = []byte("NCASE_SigmaS2")
+	kKDFS1RKeyInfo         = []byte("Sigma1_Resume")
+	kKDFS2RKeyInfo         = []byte("Sigma2_Resume")
+	kKDFResumptionKeysInfo = []byte("SessionResumptionKeys")
+)
+
+// CASEFabricTable CASE 使用的本端Fabric身份、运行凭证以及对端证书链的验证
+type CASEFabricTable interface {
+	GetFabricInfos() []credentials.FabricInfo
+	FindFabricWithIndex(fabricIndex lib.FabricIndex) *credentials.FabricInfo
+	FetchNOCCert(fabricIndex lib.FabricIndex) ([]byte, error)
+	// FetchICACert 没有中间证书时返回空
+	FetchICACert(fabricIndex lib.FabricIndex) ([]byte, error)
+	SignWithOpKeypair(fabricIndex lib.FabricIndex, message []byte) (crypto.P256ECDSASignature, error)
+	// VerifyCredentials 使用Fabric的根证书验证对端的 NOC、ICAC，返回 NOC 中的节点ID、FabricID 和公钥
+	VerifyCredentials(fabricIndex lib.FabricIndex, noc, icac []byte) (lib.NodeId, lib.FabricId, crypto.P256PublicKey, error)
+	// ExtractPeerCATs 获取已验证的对端 NOC 中的 CAT
+	ExtractPeerCATs(noc []byte) (lib.CATValues, error)
+	// AllocateEphemeralKeypairForCASE 分配临时秘钥对，会话重置时通过 ReleaseEphemeralKeypair 归还
+	AllocateEphemeralKeypairForCASE() (*crypto.P256Keypair, error)
+	ReleaseEphemeralKeypair(keypair *crypto.P256Keypair)
+}
+
+type sigma1 struct {
+	InitiatorRandom    []byte             `tlv:"1"`
+	InitiatorSessionId uint16             `tlv:"2"`
+	DestinationId      []byte             `tlv:"3"`
+	InitiatorEphPubKey []byte             `tlv:"4"`
+	SessionParameters  *sessionParameters `tlv:"5,omitempty"`
+	ResumptionId       []byte             `tlv:"6,omitempty"`
+	InitiatorResumeMIC []byte             `tlv:"7,omitempty"`
+}
+
+type sigma2 struct {
+	ResponderRandom    []byte             `tlv:"1"`
+	ResponderSessionId uint16             `tlv:"2"`
+	ResponderEphPubKey []byte             `tlv:"3"`
+	Encrypted2         []byte             `tlv:"4"`
+	SessionParameters  *sessionParameters `tlv:"5,omitempty"`
+}
+
+type sigma2Resume struct {
+	ResumptionId       []byte             `tlv:"1"`
+	Sigma2ResumeMIC    []byte             `tlv:"2"`
+	ResponderSessionId uint16             `tlv:"3"`
+	SessionParameters  *sessionParameters `tlv:"4,omitempty"`
+}
+
+type sigma3 struct {
+	Encrypted3 []byte `tlv:"1"`
+}
+
+// sigmaTBSData 被签名的数据，TBSData2 和 TBSData3 的格式相同
+type sigmaTBSData struct {
+	SenderNOC         []byte `tlv:"1"`
+	SenderICAC        []byte `tlv:"2,omitempty"`
+	SenderEphPubKey   []byte `tlv:"3"`
+	ReceiverEphPubKey []byte `tlv:"4"`
+}
+
+// sigmaTBEData 被加密的数据，TBEData3 没有会话恢复ID
+type sigmaTBEData struct {
+	SenderNOC    []byte `tlv:"1"`
+	SenderICAC   []byte `tlv:"2,omitempty"`
+	Signature    []byte `tlv:"3"`
+	ResumptionId []byte `tlv:"4,omitempty"`
+}
+
+// CASESession 使用运行证书建立会话：发起方调用 EstablishSession，设备由 CASEServer 在收到 Sigma1 时创建。
+// 提供了 SessionResumptionStorage 时，双方保存共享密钥，之后可以用 Sigma1 和 Sigma2_Resume 恢复会话而不再交换证书
+type CASESession struct {
+	mMutex             sync.Mutex
+	mRole              transport.SessionRole
+	mExchangeMgr       messageing.ExchangeManager
+	mFabrics           CASEFabricTable
+	mGroupData         credentials.GroupDataProvider
+	mResumptionStorage lib.SessionResumptionStorage
+	mDelegate          SessionEstablishmentDelegate
+	mLocalMRPConfig    *messageing.ReliableMessageProtocolConfig
+	mExchange          *messageing.ExchangeContext
+	mNextExpectedMsg   MsgType
+
+	mSecureSession *transport.SecureSession
+	mPeerSessionId uint16
+	mPeerMRPConfig messageing.ReliableMessageProtocolConfig
+
+	mFabricIndex   lib.FabricIndex
+	mLocalNodeId   lib.NodeId
+	mPeerNodeId    lib.NodeId
+	mPeerCATs      lib.CATValues
+	mIpk           []byte
+	mEphemeralKey  *crypto.P256Keypair
+	mPeerEphPubKey crypto.P256PublicKey
+	mSharedSecret  []byte
+	mResumptionId  []byte
+	// mInitiatorRandom 会话恢复时用于派生秘钥
+	mInitiatorRandom []byte
+	// mSessionResumption 本次使用 Sigma2_Resume 恢复会话
+	mSessionResumption bool
+	// mTranscript Sigma1、Sigma2、Sigma3 的摘要
+	mTranscript hash.Hash
+}
+
+func NewCASESession() *CASESession {
+	return &CASESession{}
+}
+
+// EstablishSession 发起方在未认证会话上向 peer 发送 Sigma1，resumptionStorage 中有 peer 的状态时请求恢复会话
+func (c *CASESession) EstablishSession(exchangeMgr messageing.ExchangeManager, session transport.Session, fabrics CASEFabricTable,
+	groupData credentials.GroupDataProvider, resumptionStorage lib.SessionResumptionStorage, peer lib.ScopedNodeId,
+	mrpConfig *messageing.ReliableMessageProtocolConfig, delegate SessionEstablishmentDelegate) error {
+	if exchangeMgr == nil || session == nil || fabrics == nil || groupData == nil || delegate == nil || !peer.IsOperational() {
+		return internal.ChipErrorInvalidArgument
+	}
+	fabric := fabrics.FindFabricWithIndex(peer.GetFabricIndex())
+	if fabric == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	ipkKeySet, err := groupData.GetIpkKeySet(peer.GetFabricIndex())
+	if err != nil {
+		return err
+	}
+	c.Clear()
+
+	ephemeralKey, err := fabrics.AllocateEphemeralKeypairForCASE()
+	if err != nil {
+		return err
+	}
+	// 保存到会话之前失败时归还临时秘钥，之后由 resetLocked 归还
+	ephemeralKeyOwned := false
+	defer func() {
+		if !ephemeralKeyOwned {
+			fabrics.ReleaseEphemeralKeypair(ephemeralKey)
+		}
+	}()
+	random, err := newRandom(kSigmaParamRandomNumberSize)
+	if err != nil {
+		return err
+	}
+	// 使用当前的 IPK
+	ipk := ipkKeySet.EpochKeys[0].Key[:]
+	destinationId := computeDestinationId(ipk, random, fabric.GetRootPubkey(), fabric.GetFabricId(), peer.GetNodeId())
+
+	secureSession, err := exchangeMgr.GetSessionManager().AllocateSession(transport.SecureSessionTypeCASE, peer)
+	if err != nil {
+		return err
+	}
+	ephemeralPubKey := ephemeralKey.Pubkey()
+	request := sigma1{
+		InitiatorRandom:    random,
+		InitiatorSessionId: secureSession.GetLocalSessionId(),
+		DestinationId:      destinationId,
+		InitiatorEphPubKey: ephemeralPubKey.Bytes(),
+		SessionParameters:  newSessionParameters(mrpConfig),
+	}
+	var sharedSecret []byte
+	var peerCATs lib.CATValues
+	if resumptionStorage != nil {
+		if resumptionId, secret, cats, err := resumptionStorage.FindByScopedNodeId(peer); err == nil {
+			if mic, err := computeResumeMIC(secret, random, resumptionId[:], kKDFS1RKeyInfo, kResume1MICNonce); err == nil {
+				request.ResumptionId = resumptionId[:]
+				request.InitiatorResumeMIC = mic
+				sharedSecret, peerCATs = secret, cats
+			}
+		}
+	}
+	msg, err := tlv.Marshal(request)
+	if err != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(secureSession)
+		return err
+	}
+	ec, err := exchangeMgr.NewContext(session, c)
+	if err != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(secureSession)
+		return err
+	}
+	ec.SetResponseTimeout(KSessionEstablishmentTimeout)
+
+	c.mMutex.Lock()
+	c.mRole = transport.SessionRoleInitiator
+	c.mExchangeMgr = exchangeMgr
+	c.mFabrics = fabrics
+	c.mGroupData = groupData
+	c.mResumptionStorage = resumptionStorage
+	c.mDelegate = delegate
+	c.mLocalMRPConfig = mrpConfig
+	c.mExchange = ec
+	c.mSecureSession = secureSession
+	c.mFabricIndex = peer.GetFabricIndex()
+	c.mLocalNodeId = fabric.GetNodeId()
+	c.mPeerNodeId = peer.GetNodeId()
+	c.mIpk = append([]byte(nil), ipk...)
+	c.mPeerCATs = peerCATs
+	c.mEphemeralKey = ephemeralKey
+	ephemeralKeyOwned = true
+	c.mResumptionId = request.ResumptionId
+	c.mSharedSecret = sharedSecret
+	c.mInitiatorRandom = random
+	c.mTranscript = sha256.New()
+	c.mTranscript.Write(msg)
+	c.mNextExpectedMsg = MsgTypeCASESigma2
+	c.mMutex.Unlock()
+
+	if err := ec.SendMessage(protocols.SecureChannel, MsgTypeCASESigma1, msg, messageing.SendFlagExpectResponse); err != nil {
+		ec.Abort()
+		c.Clear()
+		return err
+	}
+	log.Infof("CASE sent Sigma1 to %016X, local session %d", uint64(peer.GetNodeId()), secureSession.GetLocalSessionId())
+	return nil
+}
+
+// PrepareForSessionEstablishment 设备准备处理对端发来的 Sigma1
+func (c *CASESession) PrepareForSessionEstablishment(exchangeMgr messageing.ExchangeManager, fabrics CASEFabricTable,
+	groupData credentials.GroupDataProvider, resumptionStorage lib.SessionResumptionStorage,
+	mrpConfig *messageing.ReliableMessageProtocolConfig, delegate SessionEstablishmentDelegate) error {
+	if exchangeMgr == nil || fabrics == nil || groupData == nil || delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	c.Clear()
+
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	c.mRole = transport.SessionRoleResponder
+	c.mExchangeMgr = exchangeMgr
+	c.mFabrics = fabrics
+	c.mGroupData = groupData
+	c.mResumptionStorage = resumptionStorage
+	c.mDelegate = delegate
+	c.mLocalMRPConfig = mrpConfig
+	c.mNextExpectedMsg = MsgTypeCASESigma1
+	return nil
+}
+
+// Clear 放弃进行中的会话建立
+func (c *CASESession) Clear() {
+	c.mMutex.Lock()
+	exchangeMgr := c.mExchangeMgr
+	session := c.resetLocked()
+	c.mExchangeMgr = nil
+	c.mResumptionStorage = nil
+	c.mDelegate = nil
+	c.mMutex.Unlock()
+
+	if exchangeMgr != nil && session != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(session)
+	}
+}
+
+func (c *CASESession) resetLocked() *transport.SecureSession {
+	var session *transport.SecureSession
+	if c.mSecureSession != nil && c.mSecureSession.IsEstablishing() {
+		session = c.mSecureSession
+	}
+	c.mSecureSession = nil
+	c.mExchange = nil
+	c.mPeerSessionId = 0
+	c.mPeerMRPConfig = messageing.ReliableMessageProtocolConfig{}
+	c.mFabricIndex = lib.KUndefinedFabricIndex
+	c.mLocalNodeId = lib.KUndefinedNodeId
+	c.mPeerNodeId = lib.KUndefinedNodeId
+	c.mPeerCATs = lib.CATValues{}
+	c.mIpk = nil
+	if c.mEphemeralKey != nil && c.mFabrics != nil {
+		c.mFabrics.ReleaseEphemeralKeypair(c.mEphemeralKey)
+	}
+	c.mEphemeralKey = nil
+	c.mPeerEphPubKey = crypto.P256PublicKey{}
+	c.mSharedSecret = nil
+	c.mResumptionId = nil
+	c.mInitiatorRandom = nil
+	c.mSessionResumption = false
+	c.mTranscript = nil
+	c.mNextExpectedMsg = MsgTypeCASESigma1
+	return session
+}
+
+func (c *CASESession) OnMessageReceived(ec *messageing.ExchangeContext, payloadHeader *message.PayloadHeader, payload []byte) error {
+	c.mMutex.Lock()
+	reply, err := c.handleMessageLocked(ec, payloadHeader, payload)
+	session := c.mSecureSession
+	c.mMutex.Unlock()
+
+	if err != nil {
+		if !payloadHeader.HasMessageType(protocols.KVendorIdCommon, protocols.SecureChannel.GetProtocolId(), MsgTypeStatusReport) {
+			protocolCode := ProtocolCodeInvalidParam
+			if err == internal.ChipErrorKeyNotFound {
+				protocolCode = ProtocolCodeNoSharedRoot
+			}
+			_ = sendFailureStatusReport(ec, protocolCode)
+		}
+		c.onSessionEstablishmentFailed(ec, err)
+		return err
+	}
+	if reply.mPayload != nil {
+		flags := messageing.SendFlagExpectResponse
+		if reply.mDone {
+			flags = messageing.SendFlagNone
+		}
+		if err := ec.SendMessage(protocols.SecureChannel, reply.mMsgType, reply.mPayload, flags); err != nil {
+			c.onSessionEstablishmentFailed(ec, err)
+			return err
+		}
+	}
+	if reply.mDone {
+		c.onSessionEstablished(session)
+	}
+	return nil
+}
+
+func (c *CASESession) OnResponseTimeout(ec *messageing.ExchangeContext) {
+	log.Infof("CASE timed out waiting for the peer")
+	c.onSessionEstablishmentFailed(ec, internal.ChipErrorTimeout)
+}
+
+func (c *CASESession) OnExchangeClosing(ec *messageing.ExchangeContext) {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	if c.mExchange == ec {
+		c.mExchange = nil
+	}
+}
+
+func (c *CASESession) handleMessageLocked(ec *messageing.ExchangeContext, payloadHeader *message.PayloadHeader, payload []byte) (establishmentReply, error) {
+	if c.mDelegate == nil {
+		return establishmentReply{}, internal.ChipErrorIncorrectState
+	}
+	if c.mExchange == nil && c.mRole == transport.SessionRoleResponder && c.mNextExpectedMsg == MsgTypeCASESigma1 {
+		c.mExchange = ec
+		ec.SetResponseTimeout(KSessionEstablishmentTimeout)
+	}
+	if ec != c.mExchange {
+		return establishmentReply{}, internal.ChipErrorIncorrectState
+	}
+	if payloadHeader.GetVendorId() != protocols.KVendorIdCommon || payloadHeader.GetProtocolId() != protocols.SecureChannel.GetProtocolId() {
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+	msgType := payloadHeader.GetMessageType()
+	if msgType == MsgTypeStatusReport {
+		return c.handleStatusReportLocked(ec, payload)
+	}
+	// 请求了会话恢复时，设备可能回复 Sigma2_Resume
+	if msgType == MsgTypeCASESigma2Resume && c.mNextExpectedMsg == MsgTypeCASESigma2 && c.mResumptionId != nil {
+		return c.handleSigma2ResumeLocked(ec, payload)
+	}
+	if msgType != c.mNextExpectedMsg {
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+	switch msgType {
+	case MsgTypeCASESigma1:
+		return c.handleSigma1Locked(ec, payload)
+	case MsgTypeCASESigma2:
+		return c.handleSigma2Locked(ec, payload)
+	case MsgTypeCASESigma3:
+		return c.handleSigma3Locked(ec, payload)
+	default:
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+}
+
+func (c *CASESession) handleSigma1Locked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	var msg sigma1
+	if err := tlv.Unmarshal(payload, &msg); err != nil {
+		return establishmentReply{}, err
+	}
+	if len(msg.InitiatorRandom) != kSigmaParamRandomNumberSize || len(msg.DestinationId) != kCASEDestinationIdSize {
+		return establishmentReply{}, internal.ChipErrorInvalidCASEParameter
+	}
+	peerEphPubKey, err := crypto.NewP256PublicKey(msg.InitiatorEphPubKey)
+	if err != nil {
+		return establishmentReply{}, internal.ChipErrorInvalidCASEParameter
+	}
+	if reply, ok := c.tryResumeSessionLocked(ec, &msg); ok {
+		return reply, nil
+	}
+	if err := c.findLocalNodeFromDestinationIdLocked(msg.DestinationId, msg.InitiatorRandom); err != nil {
+		log.Infof("CASE Sigma1 destination id does not match any fabric")
+		return establishmentReply{}, err
+	}
+	secureSession, err := c.mExchangeMgr.GetSessionManager().AllocateSession(transport.SecureSessionTypeCASE, lib.ScopedNodeId{})
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	c.mSecureSession = secureSession
+	c.mPeerSessionId = msg.InitiatorSessionId
+	c.mPeerEphPubKey = peerEphPubKey
+	c.setPeerMRPConfigLocked(ec, msg.SessionParameters)
+	c.mTranscript = sha256.New()
+	c.mTranscript.Write(payload)
+
+	if c.mEphemeralKey, err = c.mFabrics.AllocateEphemeralKeypairForCASE(); err != nil {
+		return establishmentReply{}, err
+	}
+	if c.mSharedSecret, err = c.mEphemeralKey.ECDHDeriveSecret(peerEphPubKey); err != nil {
+		return establishmentReply{}, err
+	}
+	random, err := newRandom(kSigmaParamRandomNumberSize)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	if c.mResumptionId, err = newRandom(KCASEResumptionIdSize); err != nil {
+		return establishmentReply{}, err
+	}
+
+	ephemeralPubKey := c.mEphemeralKey.Pubkey()
+	salt := append(append([]byte{}, c.mIpk...), random...)
+	salt = append(salt, ephemeralPubKey.Bytes()...)
+	salt = append(salt, c.mTranscript.Sum(nil)...)
+	sr2k, err := crypto.HKDFSHA256(c.mSharedSecret, salt, kKDFSR2Info, crypto.KAES128CCMKeyLength)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	encrypted2, err := c.encryptSigmaTBEDataLocked(sr2k, kTBEData2Nonce, c.mResumptionId)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	data, err := tlv.Marshal(sigma2{
+		ResponderRandom:    random,
+		ResponderSessionId: secureSession.GetLocalSessionId(),
+		ResponderEphPubKey: ephemeralPubKey.Bytes(),
+		Encrypted2:         encrypted2,
+		SessionParameters:  newSessionParameters(c.mLocalMRPConfig),
+	})
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	c.mTranscript.Write(data)
+	c.mNextExpectedMsg = MsgTypeCASESigma3
+	log.Infof("CASE received Sigma1 for fabric %d, peer session %d", c.mFabricIndex, msg.InitiatorSessionId)
+	return establishmentReply{mMsgType: MsgTypeCASESigma2, mPayload: data}, nil
+}
+
+func (c *CASESession) handleSigma2Locked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	var msg sigma2
+	if err := tlv.Unmarshal(payload, &msg); err != nil {
+		return establishmentReply{}, err
+	}
+	if len(msg.ResponderRandom) != kSigmaParamRandomNumberSize {
+		return establishmentReply{}, internal.ChipErrorInvalidCASEParameter
+	}
+	peerEphPubKey, err := crypto.NewP256PublicKey(msg.ResponderEphPubKey)
+	if err != nil {
+		return establishmentReply{}, internal.ChipErrorInvalidCASEParameter
+	}
+	c.mPeerEphPubKey = peerEphPubKey
+	// 设备没有接受会话恢复，重新建立会话
+	c.mResumptionId = nil
+	if c.mSharedSecret, err = c.mEphemeralKey.ECDHDeriveSecret(peerEphPubKey); err != nil {
+		return establishmentReply{}, err
+	}
+
+	salt := append(append([]byte{}, c.mIpk...), msg.ResponderRandom...)
+	salt = append(salt, msg.ResponderEphPubKey...)
+	salt = append(salt, c.mTranscript.Sum(nil)...)
+	sr2k, err := crypto.HKDFSHA256(c.mSharedSecret, salt, kKDFSR2Info, crypto.KAES128CCMKeyLength)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	tbeData, err := c.decryptAndVerifySigmaTBEDataLocked(sr2k, kTBEData2Nonce, msg.Encrypted2)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	if len(tbeData.ResumptionId) != KCASEResumptionIdSize {
+		return establishmentReply{}, internal.ChipErrorInvalidCASEParameter
+	}
+	c.mResumptionId = tbeData.ResumptionId
+	c.mPeerSessionId = msg.ResponderSessionId
+	c.setPeerMRPConfigLocked(ec, msg.SessionParameters)
+	c.mTranscript.Write(payload)
+
+	sr3k, err := crypto.HKDFSHA256(c.mSharedSecret, append(append([]byte{}, c.mIpk...), c.mTranscript.Sum(nil)...), kKDFSR3Info, crypto.KAES128CCMKeyLength)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	encrypted3, err := c.encryptSigmaTBEDataLocked(sr3k, kTBEData3Nonce, nil)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	data, err := tlv.Marshal(sigma3{Encrypted3: encrypted3})
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	c.mTranscript.Write(data)
+	c.mNextExpectedMsg = MsgTypeStatusReport
+	return establishmentReply{mMsgType: MsgTypeCASESigma3, mPayload: data}, nil
+}
+
+func (c *CASESession) handleSigma3Locked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	var msg sigma3
+	if err := tlv.Unmarshal(payload, &msg); err != nil {
+		return establishmentReply{}, err
+	}
+	sr3k, err := crypto.HKDFSHA256(c.mSharedSecret, append(append([]byte{}, c.mIpk...), c.mTranscript.Sum(nil)...), kKDFSR3Info, crypto.KAES128CCMKeyLength)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	if _, err := c.decryptAndVerifySigmaTBEDataLocked(sr3k, kTBEData3Nonce, msg.Encrypted3); err != nil {
+		return establishmentReply{}, err
+	}
+	c.mTranscript.Write(payload)
+	// 先激活会话再发送状态报告，发起方收到后可以立即使用该会话
+	if err := c.activateSecureSessionLocked(ec); err != nil {
+		return establishmentReply{}, err
+	}
+	report := NewStatusReport(GeneralStatusSuccess, protocols.SecureChannel, ProtocolCodeSessionEstablishmentSuccess)
+	return establishmentReply{mMsgType: MsgTypeStatusReport, mPayload: report.Encode(), mDone: true}, nil
+}
+
+func (c *CASESession) handleStatusReportLocked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	report, err := DecodeStatusReport(payload)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	if !report.IsSuccess() {
+		log.Infof("CASE received failure status report: general %d, protocol code %d", report.GeneralCode, report.ProtocolCode)
+		switch report.ProtocolCode {
+		case ProtocolCodeNoSharedRoot:
+			return establishmentReply{}, internal.ChipErrorKeyNotFound
+		case ProtocolCodeInvalidParam:
+			return establishmentReply{}, internal.ChipErrorInvalidCASEParameter
+		default:
+			return establishmentReply{}, internal.ChipErrorInternal
+		}
+	}
+	if c.mNextExpectedMsg != MsgTypeStatusReport {
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+	if err := c.activateSecureSessionLocked(ec); err != nil {
+		return establishmentReply{}, err
+	}
+	return establishmentReply{mDone: true}, nil
+}
+
+// findLocalNodeFromDestinationIdLocked 使用每个Fabric的每个 IPK 计算目的ID，找到对端要连接的本端节点
+func (c *CASESession) findLocalNodeFromDestinationIdLocked(destinationId, initiatorRandom []byte) error {
+	for _, fabric := range c.mFabrics.GetFabricInfos() {
+		ipkKeySet, err := c.mGroupData.GetIpkKeySet(fabric.GetFabricIndex())
+		if err != nil {
+			continue
+		}
+		for _, epochKey := range ipkKeySet.EpochKeys {
+			candidate := computeDestinationId(epochKey.Key[:], initiatorRandom, fabric.GetRootPubkey(), fabric.GetFabricId(), fabric.GetNodeId())
+			if hmac.Equal(candidate, destinationId) {
+				c.mFabricIndex = fabric.GetFabricIndex()
+				c.mLocalNodeId = fabric.GetNodeId()
+				c.mIpk = append([]byte(nil), epochKey.Key[:]...)
+				return nil
+			}
+		}
+	}
+	return internal.ChipErrorKeyNotFound
+}
+
+// encryptSigmaTBEDataLocked 签名本端的 NOC、ICAC 和双方的临时公钥，加密后附带16字节的MIC
+func (c *CASESession) encryptSigmaTBEDataLocked(key, nonce, resumptionId []byte) ([]byte, error) {
+	noc, err := c.mFabrics.FetchNOCCert(c.mFabricIndex)
+	if err != nil {
+		return nil, err
+	}
+	icac, err := c.mFabrics.FetchICACert(c.mFabricIndex)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPubKey := c.mEphemeralKey.Pubkey()
+	tbsData, err := tlv.Marshal(sigmaTBSData{
+		SenderNOC:         noc,
+		SenderICAC:        icac,
+		SenderEphPubKey:   ephemeralPubKey.Bytes(),
+		ReceiverEphPubKey: c.mPeerEphPubKey.Bytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	signature, err := c.mFabrics.SignWithOpKeypair(c.mFabricIndex, tbsData)
+	if err != nil {
+		return nil, err
+	}
+	tbeData, err := tlv.Marshal(sigmaTBEData{SenderNOC: noc, SenderICAC: icac, Signature: signature[:], ResumptionId: resumptionId})
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, tag, err := crypto.AesCcmEncrypt(tbeData, nil, key, nonce, crypto.KAES128CCMTagLength)
+	if err != nil {
+		return nil, err
+	}
+	return append(ciphertext, tag...), nil
+}
+
+// decryptAndVerifySigmaTBEDataLocked 解密对端的数据，验证证书链和签名，确认对端的节点ID
+func (c *CASESession) decryptAndVerifySigmaTBEDataLocked(key, nonce, encrypted []byte) (*sigmaTBEData, error) {
+	if len(encrypted) <= crypto.KAES128CCMTagLength {
+		return nil, internal.ChipErrorInvalidCASEParameter
+	}
+	split := len(encrypted) - crypto.KAES128CCMTagLength
+	plaintext, err := crypto.AesCcmDecrypt(encrypted[:split], nil, encrypted[split:], key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	var tbeData sigmaTBEData
+	if err := tlv.Unmarshal(plaintext, &tbeData); err != nil {
+		return nil, err
+	}
+	if len(tbeData.Signature) != crypto.KP256ECDSASignatureLength {
+		return nil, internal.ChipErrorInvalidCASEParameter
+	}
+	peerNodeId, peerFabricId, peerPubKey, err := c.mFabrics.VerifyCredentials(c.mFabricIndex, tbeData.SenderNOC, tbeData.SenderICAC)
+	if err != nil {
+		return nil, err
+	}
+	fabric := c.mFabrics.FindFabricWithIndex(c.mFabricIndex)
+	if fabric == nil || fabric.GetFabricId() != peerFabricId {
+		return nil, internal.ChipErrorInvalidCASEParameter
+	}
+	// 发起方知道要连接的节点，设备从 NOC 得到对端的节点ID
+	if c.mRole == transport.SessionRoleInitiator && peerNodeId != c.mPeerNodeId {
+		return nil, internal.ChipErrorInvalidCASEParameter
+	}
+	c.mPeerNodeId = peerNodeId
+
+	ephemeralPubKey := c.mEphemeralKey.Pubkey()
+	tbsData, err := tlv.Marshal(sigmaTBSData{
+		SenderNOC:         tbeData.SenderNOC,
+		SenderICAC:        tbeData.SenderICAC,
+		SenderEphPubKey:   c.mPeerEphPubKey.Bytes(),
+		ReceiverEphPubKey: ephemeralPubKey.Bytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var signature crypto.P256ECDSASignature
+	copy(signature[:], tbeData.Signature)
+	if err := peerPubKey.ECDSAValidateMsgSignature(tbsData, signature); err != nil {
+		return nil, err
+	}
+	peerCATs, err := c.mFabrics.ExtractPeerCATs(tbeData.SenderNOC)
+	if err != nil {
+		return nil, err
+	}
+	c.mPeerCATs = peerCATs
+	return &tbeData, nil
+}
+
+// activateSecureSessionLocked 会话秘钥 = HKDF(共享密钥, IPK || 消息摘要, "SessionKeys")，
+// 恢复会话时为 HKDF(共享密钥, 发起方随机数 || 新的恢复ID, "SessionResumptionKeys")
+func (c *CASESession) activateSecureSessionLocked(ec *messageing.ExchangeContext) error {
+	var salt, info []byte
+	if c.mSessionResumption {
+		salt = append(append([]byte{}, c.mInitiatorRandom...), c.mResumptionId...)
+		info = kKDFResumptionKeysInfo
+	} else {
+		salt = append(append([]byte{}, c.mIpk...), c.mTranscript.Sum(nil)...)
+		info = []byte(kSessionKeysInfo)
+	}
+	keys, err := crypto.HKDFSHA256(c.mSharedSecret, salt, info, 2*transport.KSessionKeyLength+transport.KAttestationChallengeLength)
+	if err != nil {
+		return err
+	}
+	cryptoContext, err := transport.NewCryptoContext(keys[:transport.KSessionKeyLength],
+		keys[transport.KSessionKeyLength:2*transport.KSessionKeyLength], keys[2*transport.KSessionKeyLength:], c.mRole)
+	if err != nil {
+		return err
+	}
+	localNode := lib.NewScopedNodeId(c.mLocalNodeId, c.mFabricIndex)
+	peerNode := lib.NewScopedNodeId(c.mPeerNodeId, c.mFabricIndex)
+	if err := c.mSecureSession.Activate(localNode, peerNode, c.mPeerCATs, c.mPeerSessionId, cryptoContext, ec.GetSession().GetPeerAddress()); err != nil {
+		return err
+	}
+	c.mSecureSession.SetRemoteMRPConfig(c.mPeerMRPConfig)
+	c.saveResumptionStateLocked(peerNode)
+	return nil
+}
+
+// saveResumptionStateLocked 保存对端的恢复ID和共享密钥，失败时只影响下次能否恢复会话
+func (c *CASESession) saveResumptionStateLocked(peerNode lib.ScopedNodeId) {
+	if c.mResumptionStorage == nil || len(c.mResumptionId) != KCASEResumptionIdSize {
+		return
+	}
+	var resumptionId lib.ResumptionIdStorage
+	copy(resumptionId[:], c.mResumptionId)
+	if err := c.mResumptionStorage.Save(peerNode, resumptionId, c.mSharedSecret, c.mPeerCATs); err != nil {
+		log.Errorf("CASE failed to save session resumption state: %s", err.Error())
+	}
+}
+
+// tryResumeSessionLocked Sigma1 带有恢复ID和有效的 MIC 时回复 Sigma2_Resume，否则继续完整的 CASE
+func (c *CASESession) tryResumeSessionLocked(ec *messageing.ExchangeContext, msg *sigma1) (establishmentReply, bool) {
+	if c.mResumptionStorage == nil || len(msg.ResumptionId) != KCASEResumptionIdSize || len(msg.InitiatorResumeMIC) != kCASEResumeMICSize {
+		return establishmentReply{}, false
+	}
+	var resumptionId lib.ResumptionIdStorage
+	copy(resumptionId[:], msg.ResumptionId)
+	peerNode, sharedSecret, peerCATs, err := c.mResumptionStorage.FindByResumptionId(resumptionId)
+	if err != nil {
+		return establishmentReply{}, false
+	}
+	mic, err := computeResumeMIC(sharedSecret, msg.InitiatorRandom, msg.ResumptionId, kKDFS1RKeyInfo, kResume1MICNonce)
+	if err != nil || !hmac.Equal(mic, msg.InitiatorResumeMIC) {
+		log.Infof("CASE Sigma1 resume MIC mismatch, falling back to full CASE")
+		return establishmentReply{}, false
+	}
+	fabric := c.mFabrics.FindFabricWithIndex(peerNode.GetFabricIndex())
+	if fabric == nil {
+		return establishmentReply{}, false
+	}
+	newResumptionId, err := newRandom(KCASEResumptionIdSize)
+	if err != nil {
+		return establishmentReply{}, false
+	}
+	mic, err = computeResumeMIC(sharedSecret, msg.InitiatorRandom, newResumptionId, kKDFS2RKeyInfo, kResume2MICNonce)
+	if err != nil {
+		return establishmentReply{}, false
+	}
+	secureSession, err := c.mExchangeMgr.GetSessionManager().AllocateSession(transport.SecureSessionTypeCASE, lib.ScopedNodeId{})
+	if err != nil {
+		return establishmentReply{}, false
+	}
+	data, err := tlv.Marshal(sigma2Resume{
+		ResumptionId:       newResumptionId,
+		Sigma2ResumeMIC:    mic,
+		ResponderSessionId: secureSession.GetLocalSessionId(),
+		SessionParameters:  newSessionParameters(c.mLocalMRPConfig),
+	})
+	if err != nil {
+		c.mExchangeMgr.GetSessionManager().ExpireSession(secureSession)
+		return establishmentReply{}, false
+	}
+	c.mSecureSession = secureSession
+	c.mSessionResumption = true
+	c.mFabricIndex = peerNode.GetFabricIndex()
+	c.mLocalNodeId = fabric.GetNodeId()
+	c.mPeerNodeId = peerNode.GetNodeId()
+	c.mPeerCATs = peerCATs
+	c.mPeerSessionId = msg.InitiatorSessionId
+	c.mSharedSecret = sharedSecret
+	c.mInitiatorRandom = msg.InitiatorRandom
+	c.mResumptionId = newResumptionId
+	c.setPeerMRPConfigLocked(ec, msg.SessionParameters)
+	c.mNextExpectedMsg = MsgTypeStatusReport
+	log.Infof("CASE resuming session with %016X on fabric %d", uint64(c.mPeerNodeId), c.mFabricIndex)
+	return establishmentReply{mMsgType: MsgTypeCASESigma2Resume, mPayload: data}, true
+}
+
+// handleSigma2ResumeLocked 验证设备的 MIC 后使用保存的共享密钥激活会话
+func (c *CASESession) handleSigma2ResumeLocked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	var msg sigma2Resume
+	if err := tlv.Unmarshal(payload, &msg); err != nil {
+		return establishmentReply{}, err
+	}
+	if len(msg.ResumptionId) != KCASEResumptionIdSize || len(msg.Sigma2ResumeMIC) != kCASEResumeMICSize {
+		return establishmentReply{}, internal.ChipErrorInvalidCASEParameter
+	}
+	mic, err := computeResumeMIC(c.mSharedSecret, c.mInitiatorRandom, msg.ResumptionId, kKDFS2RKeyInfo, kResume2MICNonce)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	if !hmac.Equal(mic, msg.Sigma2ResumeMIC) {
+		return establishmentReply{}, internal.ChipErrorIntegrityCheckFailed
+	}
+	c.mSessionResumption = true
+	c.mResumptionId = msg.ResumptionId
+	c.mPeerSessionId = msg.ResponderSessionId
+	c.setPeerMRPConfigLocked(ec, msg.SessionParameters)
+	if err := c.activateSecureSessionLocked(ec); err != nil {
+		return establishmentReply{}, err
+	}
+	report := NewStatusReport(GeneralStatusSuccess, protocols.SecureChannel, ProtocolCodeSessionEstablishmentSuccess)
+	return establishmentReply{mMsgType: MsgTypeStatusReport, mPayload: report.Encode(), mDone: true}, nil
+}
+
+func (c *CASESession) setPeerMRPConfigLocked(ec *messageing.ExchangeContext, params *sessionParameters) {
+	c.mPeerMRPConfig = params.mrpConfig()
+	ec.GetSession().SetRemoteMRPConfig(c.mPeerMRPConfig)
+}
+
+func (c *CASESession) onSessionEstablished(session *transport.SecureSession) {
+	c.mMutex.Lock()
+	delegate := c.mDelegate
+	c.resetLocked()
+	c.mMutex.Unlock()
+
+	peer := session.GetPeer()
+	log.Infof("CASE session established with %016X on fabric %d, local session %d", uint64(peer.GetNodeId()), peer.GetFabricIndex(), session.GetLocalSessionId())
+	if delegate != nil {
+		delegate.OnSessionEstablished(session)
+	}
+}
+
+func (c *CASESession) onSessionEstablishmentFailed(ec *messageing.ExchangeContext, err error) {
+	c.mMutex.Lock()
+	if c.mExchange != nil && c.mExchange != ec {
+		c.mMutex.Unlock()
+		return
+	}
+	delegate := c.mDelegate
+	exchangeMgr := c.mExchangeMgr
+	session := c.resetLocked()
+	c.mMutex.Unlock()
+
+	log.Infof("CASE session establishment failed: %s", err.Error())
+	if session != nil && exchangeMgr != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(session)
+	}
+	if delegate != nil {
+		delegate.OnSessionEstablishmentError(err)
+	}
+}
+
+// computeResumeMIC 恢复秘钥 = HKDF(共享密钥, 发起方随机数 || 恢复ID, info)，MIC 为加密空数据得到的标签
+func computeResumeMIC(sharedSecret, initiatorRandom, resumptionId, info, nonce []byte) ([]byte, error) {
+	salt := append(append([]byte{}, initiatorRandom...), resumptionId...)
+	key, err := crypto.HKDFSHA256(sharedSecret, salt, info, crypto.KAES128CCMKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	_, tag, err := crypto.AesCcmEncrypt(nil, nil, key, nonce, kCASEResumeMICSize)
+	return tag, err
+}
+
+// computeDestinationId 目的ID = HMAC(IPK, 发起方随机数 || 根公钥 || FabricID || 节点ID)
+func computeDestinationId(ipk, initiatorRandom []byte, rootPubKey crypto.P256PublicKey, fabricId lib.FabricId, nodeId lib.NodeId) []byte {
+	var ids [16]byte
+	binary.LittleEndian.PutUint64(ids[0:], uint64(fabricId))
+	binary.LittleEndian.PutUint64(ids[8:], uint64(nodeId))
+	message := append(append([]byte{}, initiatorRandom...), rootPubKey.Bytes()...)
+	return crypto.HMACSHA256(ipk, append(message, ids[:]...))
+}
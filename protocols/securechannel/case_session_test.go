@@ -0,0 +1,401 @@
+package securechannel
+
+import (
+	"encoding/hex"
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/storage"
+	"testing"
+)
+
+const (
+	testFabricIndex        lib.FabricIndex        = 1
+	testFabricId           lib.FabricId           = 0xFAB000000000001D
+	testCompressedFabricId lib.CompressedFabricId = 0x87E1B004E235A130
+	testCommissionerNodeId lib.NodeId             = 0x000000000001B669
+	testDeviceNodeId       lib.NodeId             = 0xDEDEDEDE00010001
+)
+
+// testCert 测试用的简化证书，由根秘钥签名
+type testCert struct {
+	NodeId    uint64   `tlv:"1"`
+	FabricId  uint64   `tlv:"2"`
+	PublicKey []byte   `tlv:"3"`
+	Signature []byte   `tlv:"4,omitempty"`
+	Cats      []uint32 `tlv:"5,omitempty"`
+}
+
+// testFabricTable 只有一个Fabric的 CASEFabricTable
+type testFabricTable struct {
+	mInfo  credentials.FabricInfo
+	mNOC   []byte
+	mOpKey *crypto.P256Keypair
+	// mVerifyCount 验证证书链的次数，恢复会话时不验证
+	mVerifyCount int
+	// mEphemeralKeys 分配后还没有归还的临时秘钥数量
+	mEphemeralKeys int
+}
+
+func newTestFabricTable(t *testing.T, root *crypto.P256Keypair, issuer *crypto.P256Keypair, nodeId lib.NodeId, cats ...lib.CASEAuthTag) *testFabricTable {
+	t.Helper()
+	f := &testFabricTable{mOpKey: crypto.NewP256Keypair()}
+	if err := f.mOpKey.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	err := f.mInfo.Init(&credentials.FabricInfoInitParams{
+		NodeId:             nodeId,
+		FabriceId:          testFabricId,
+		FabricIndex:        testFabricIndex,
+		CompressedFabricId: testCompressedFabricId,
+		RootPublicKey:      root.Pubkey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkey := f.mOpKey.Pubkey()
+	cert := testCert{NodeId: uint64(nodeId), FabricId: uint64(testFabricId), PublicKey: pubkey.Bytes()}
+	for _, cat := range cats {
+		cert.Cats = append(cert.Cats, uint32(cat))
+	}
+	tbs, err := tlv.Marshal(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := issuer.ECDSASignMsg(tbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Signature = signature[:]
+	if f.mNOC, err = tlv.Marshal(cert); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *testFabricTable) GetFabricInfos() []credentials.FabricInfo {
+	return []credentials.FabricInfo{f.mInfo}
+}
+
+func (f *testFabricTable) FindFabricWithIndex(fabricIndex lib.FabricIndex) *credentials.FabricInfo {
+	if fabricIndex != f.mInfo.GetFabricIndex() {
+		return nil
+	}
+	return &f.mInfo
+}
+
+func (f *testFabricTable) FetchNOCCert(lib.FabricIndex) ([]byte, error) {
+	return f.mNOC, nil
+}
+
+func (f *testFabricTable) FetchICACert(lib.FabricIndex) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *testFabricTable) SignWithOpKeypair(_ lib.FabricIndex, message []byte) (crypto.P256ECDSASignature, error) {
+	return f.mOpKey.ECDSASignMsg(message)
+}
+
+func (f *testFabricTable) VerifyCredentials(_ lib.FabricIndex, noc, _ []byte) (lib.NodeId, lib.FabricId, crypto.P256PublicKey, error) {
+	f.mVerifyCount++
+	var cert testCert
+	if err := tlv.Unmarshal(noc, &cert); err != nil {
+		return 0, 0, crypto.P256PublicKey{}, err
+	}
+	var signature crypto.P256ECDSASignature
+	copy(signature[:], cert.Signature)
+	cert.Signature = nil
+	tbs, err := tlv.Marshal(cert)
+	if err != nil {
+		return 0, 0, crypto.P256PublicKey{}, err
+	}
+	if err := f.mInfo.GetRootPubkey().ECDSAValidateMsgSignature(tbs, signature); err != nil {
+		return 0, 0, crypto.P256PublicKey{}, err
+	}
+	pubkey, err := crypto.NewP256PublicKey(cert.PublicKey)
+	return lib.NodeId(cert.NodeId), lib.FabricId(cert.FabricId), pubkey, err
+}
+
+func (f *testFabricTable) ExtractPeerCATs(noc []byte) (lib.CATValues, error) {
+	var cert testCert
+	if err := tlv.Unmarshal(noc, &cert); err != nil {
+		return lib.CATValues{}, err
+	}
+	var cats lib.CATValues
+	for i, cat := range cert.Cats {
+		cats[i] = lib.CASEAuthTag(cat)
+	}
+	return cats, nil
+}
+
+func (f *testFabricTable) AllocateEphemeralKeypairForCASE() (*crypto.P256Keypair, error) {
+	keypair := crypto.NewP256Keypair()
+	if err := keypair.Initialize(); err != nil {
+		return nil, err
+	}
+	f.mEphemeralKeys++
+	return keypair, nil
+}
+
+func (f *testFabricTable) ReleaseEphemeralKeypair(*crypto.P256Keypair) {
+	f.mEphemeralKeys--
+}
+
+func newTestKeypair(t *testing.T) *crypto.P256Keypair {
+	t.Helper()
+	keypair := crypto.NewP256Keypair()
+	if err := keypair.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return keypair
+}
+
+func newTestGroupData(t *testing.T, epochKey byte) credentials.GroupDataProvider {
+	t.Helper()
+	groupData := credentials.NewGroupDataProviderImpl()
+	keySet := credentials.KeySet{KeySetId: credentials.KIdentityProtectionKeySetId, EpochKeys: make([]credentials.EpochKey, 1)}
+	for i := range keySet.EpochKeys[0].Key {
+		keySet.EpochKeys[0].Key[i] = epochKey + byte(i)
+	}
+	if err := groupData.SetKeySet(testFabricIndex, testCompressedFabricId, keySet); err != nil {
+		t.Fatal(err)
+	}
+	return groupData
+}
+
+func TestCASESessionEstablishment(t *testing.T) {
+	p := newPASETestPair(t)
+	root := newTestKeypair(t)
+	deviceDelegate := &testEstablishmentDelegate{}
+	server := NewCASEServer()
+	deviceFabrics := newTestFabricTable(t, root, root, testDeviceNodeId)
+	err := server.ListenForSessionEstablishment(p.device, deviceFabrics, newTestGroupData(t, 0x10), nil, nil, deviceDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+
+	commissionerDelegate := &testEstablishmentDelegate{}
+	const cat lib.CASEAuthTag = 0xABCD_0002
+	commissionerFabrics := newTestFabricTable(t, root, root, testCommissionerNodeId, cat)
+	err = NewCASESession().EstablishSession(p.commissioner, p.unsecured, commissionerFabrics, newTestGroupData(t, 0x10), nil,
+		lib.NewScopedNodeId(testDeviceNodeId, testFabricIndex), nil, commissionerDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deviceDelegate.mErr != nil || commissionerDelegate.mErr != nil {
+		t.Fatalf("CASE failed: %v %v", deviceDelegate.mErr, commissionerDelegate.mErr)
+	}
+	a, b := commissionerDelegate.mSession, deviceDelegate.mSession
+	if a == nil || b == nil || !a.IsActiveSession() || !b.IsActiveSession() || !a.IsCASESession() {
+		t.Fatalf("both sides must have an active CASE session")
+	}
+	if a.GetPeer() != lib.NewScopedNodeId(testDeviceNodeId, testFabricIndex) || b.GetPeer() != lib.NewScopedNodeId(testCommissionerNodeId, testFabricIndex) {
+		t.Errorf("unexpected peers %v %v", a.GetPeer(), b.GetPeer())
+	}
+	if a.GetPeerSessionId() != b.GetLocalSessionId() || b.GetPeerSessionId() != a.GetLocalSessionId() {
+		t.Errorf("session ids not exchanged")
+	}
+	// 设备的会话携带发起方 NOC 中的 CAT
+	subject := b.GetSubjectDescriptor()
+	if subject.AuthMode != access.AuthModeCase || subject.Subject != testCommissionerNodeId || subject.FabricIndex != testFabricIndex ||
+		subject.Cats != (lib.CATValues{cat}) {
+		t.Errorf("unexpected subject descriptor %+v", subject)
+	}
+	if a.GetPeerCATs() != (lib.CATValues{}) {
+		t.Errorf("device NOC has no CAT, got %v", a.GetPeerCATs())
+	}
+	if deviceFabrics.mEphemeralKeys != 0 || commissionerFabrics.mEphemeralKeys != 0 {
+		t.Errorf("ephemeral keys must be released, %d %d outstanding", deviceFabrics.mEphemeralKeys, commissionerFabrics.mEphemeralKeys)
+	}
+	if p.commissioner.GetNumActiveExchanges() != 0 || p.device.GetNumActiveExchanges() != 0 {
+		t.Errorf("sigma exchanges must be closed")
+	}
+
+	echo := &testEchoDelegate{}
+	if err := p.device.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, echo); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := p.commissioner.NewContext(a, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendMessage(protocols.Echo, 0x01, []byte("operational"), messageing.SendFlagNone); err != nil {
+		t.Fatal(err)
+	}
+	if len(echo.mPayloads) != 1 || string(echo.mPayloads[0]) != "operational" {
+		t.Errorf("message over the CASE session not delivered")
+	}
+}
+
+func TestCASESessionNoSharedRoot(t *testing.T) {
+	p := newPASETestPair(t)
+	root := newTestKeypair(t)
+	deviceDelegate := &testEstablishmentDelegate{}
+	server := NewCASEServer()
+	err := server.ListenForSessionEstablishment(p.device, newTestFabricTable(t, root, root, testDeviceNodeId), newTestGroupData(t, 0x10), nil, nil, deviceDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+
+	// IPK 不同时设备找不到目的ID对应的Fabric
+	commissionerDelegate := &testEstablishmentDelegate{}
+	err = NewCASESession().EstablishSession(p.commissioner, p.unsecured, newTestFabricTable(t, root, root, testCommissionerNodeId), newTestGroupData(t, 0x20), nil,
+		lib.NewScopedNodeId(testDeviceNodeId, testFabricIndex), nil, commissionerDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commissionerDelegate.mErr != internal.ChipErrorKeyNotFound || deviceDelegate.mErr != internal.ChipErrorKeyNotFound {
+		t.Errorf("expected no shared root, got %v %v", commissionerDelegate.mErr, deviceDelegate.mErr)
+	}
+	if commissionerDelegate.mSession != nil || deviceDelegate.mSession != nil {
+		t.Errorf("no session may be established")
+	}
+}
+
+func TestCASESessionUntrustedResponder(t *testing.T) {
+	p := newPASETestPair(t)
+	root := newTestKeypair(t)
+	deviceDelegate := &testEstablishmentDelegate{}
+	server := NewCASEServer()
+	// 设备的 NOC 不是由 Fabric 的根秘钥签发的
+	err := server.ListenForSessionEstablishment(p.device, newTestFabricTable(t, root, newTestKeypair(t), testDeviceNodeId), newTestGroupData(t, 0x10), nil, nil, deviceDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+
+	commissionerDelegate := &testEstablishmentDelegate{}
+	err = NewCASESession().EstablishSession(p.commissioner, p.unsecured, newTestFabricTable(t, root, root, testCommissionerNodeId), newTestGroupData(t, 0x10), nil,
+		lib.NewScopedNodeId(testDeviceNodeId, testFabricIndex), nil, commissionerDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commissionerDelegate.mErr != internal.ChipErrorInvalidSignature {
+		t.Errorf("initiator must reject the responder credentials, got %v", commissionerDelegate.mErr)
+	}
+	if deviceDelegate.mErr != internal.ChipErrorInvalidCASEParameter {
+		t.Errorf("responder must receive the failure status report, got %v", deviceDelegate.mErr)
+	}
+
+	// 失败后服务端可以处理新的 Sigma1
+	server.Shutdown()
+	deviceDelegate = &testEstablishmentDelegate{}
+	err = server.ListenForSessionEstablishment(p.device, newTestFabricTable(t, root, root, testDeviceNodeId), newTestGroupData(t, 0x10), nil, nil, deviceDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commissionerDelegate = &testEstablishmentDelegate{}
+	err = NewCASESession().EstablishSession(p.commissioner, p.unsecured, newTestFabricTable(t, root, root, testCommissionerNodeId), newTestGroupData(t, 0x10), nil,
+		lib.NewScopedNodeId(testDeviceNodeId, testFabricIndex), nil, commissionerDelegate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commissionerDelegate.mSession == nil || deviceDelegate.mSession == nil {
+		t.Errorf("retry must succeed: %v %v", commissionerDelegate.mErr, deviceDelegate.mErr)
+	}
+}
+
+func TestCASEDestinationId(t *testing.T) {
+	ipk, _ := hex.DecodeString("9bc61cd9c62a2df6d64dfcaa9dc472d4")
+	random, _ := hex.DecodeString("7e171231568dfa17206b3accf8faec2f4d21b580113196f47c7c4deb810a73dc")
+	root, _ := hex.DecodeString("044a9f42b1ca4840d37292bbc7f6a7e11e22200c976fc900dbc98a7a383a641cb8254a2e56d4e295a847943b4e3897c4a773e930277b4d9fbede8a052686bfacfa")
+	rootPubKey, err := crypto.NewP256PublicKey(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destinationId := computeDestinationId(ipk, random, rootPubKey, 0x2906C908D115D362, 0xCD5544AA7B13EF14)
+	if hex.EncodeToString(destinationId) != "dc35dd5fc9134cc5544538c9c3fc4297c1ec3370c839136a80e10796451d4c53" {
+		t.Errorf("unexpected destination id %x", destinationId)
+	}
+}
+
+func TestCASESessionResumption(t *testing.T) {
+	p := newPASETestPair(t)
+	root := newTestKeypair(t)
+	deviceFabrics := newTestFabricTable(t, root, root, testDeviceNodeId)
+	commissionerFabrics := newTestFabricTable(t, root, root, testCommissionerNodeId)
+	deviceResumption, commissionerResumption := lib.NewSimpleSessionResumptionStorage(), lib.NewSimpleSessionResumptionStorage()
+	if err := deviceResumption.Init(storage.NewInMemoryPersistentStorage()); err != nil {
+		t.Fatal(err)
+	}
+	if err := commissionerResumption.Init(storage.NewInMemoryPersistentStorage()); err != nil {
+		t.Fatal(err)
+	}
+	deviceDelegate := &testEstablishmentDelegate{}
+	server := NewCASEServer()
+	if err := server.ListenForSessionEstablishment(p.device, deviceFabrics, newTestGroupData(t, 0x10), deviceResumption, nil, deviceDelegate); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+	deviceNode := lib.NewScopedNodeId(testDeviceNodeId, testFabricIndex)
+	commissionerGroups := newTestGroupData(t, 0x10)
+	establish := func() *testEstablishmentDelegate {
+		t.Helper()
+		delegate := &testEstablishmentDelegate{}
+		deviceDelegate.mSession, deviceDelegate.mErr = nil, nil
+		if err := NewCASESession().EstablishSession(p.commissioner, p.unsecured, commissionerFabrics, commissionerGroups, commissionerResumption, deviceNode, nil, delegate); err != nil {
+			t.Fatal(err)
+		}
+		if delegate.mSession == nil || deviceDelegate.mSession == nil {
+			t.Fatalf("CASE failed: %v %v", delegate.mErr, deviceDelegate.mErr)
+		}
+		return delegate
+	}
+
+	establish()
+	firstId, _, _, err := commissionerResumption.FindByScopedNodeId(deviceNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := deviceResumption.FindByResumptionId(firstId); err != nil {
+		t.Fatalf("both sides must save the resumption state: %v", err)
+	}
+
+	// 第二次使用 Sigma2_Resume，不再验证证书
+	verifyCount := commissionerFabrics.mVerifyCount + deviceFabrics.mVerifyCount
+	delegate := establish()
+	if commissionerFabrics.mVerifyCount+deviceFabrics.mVerifyCount != verifyCount {
+		t.Errorf("resumed session must skip the certificate exchange")
+	}
+	a, b := delegate.mSession, deviceDelegate.mSession
+	if a.GetPeer() != deviceNode || b.GetPeer() != lib.NewScopedNodeId(testCommissionerNodeId, testFabricIndex) {
+		t.Errorf("unexpected peers %v %v", a.GetPeer(), b.GetPeer())
+	}
+	secondId, _, _, err := commissionerResumption.FindByScopedNodeId(deviceNode)
+	if err != nil || secondId == firstId {
+		t.Errorf("resumption must rotate the resumption id")
+	}
+	if node, _, _, err := deviceResumption.FindByResumptionId(secondId); err != nil || node != lib.NewScopedNodeId(testCommissionerNodeId, testFabricIndex) {
+		t.Errorf("device must save the new resumption id: %v", err)
+	}
+	echo := &testEchoDelegate{}
+	if err := p.device.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, echo); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := p.commissioner.NewContext(a, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendMessage(protocols.Echo, 0x01, []byte("resumed"), messageing.SendFlagNone); err != nil {
+		t.Fatal(err)
+	}
+	if len(echo.mPayloads) != 1 || string(echo.mPayloads[0]) != "resumed" {
+		t.Errorf("message over the resumed session not delivered")
+	}
+
+	// 共享密钥不一致时 MIC 验证失败，回退到完整的 CASE
+	if err := commissionerResumption.Save(deviceNode, secondId, []byte("wrong secret"), lib.CATValues{}); err != nil {
+		t.Fatal(err)
+	}
+	establish()
+	if commissionerFabrics.mVerifyCount+deviceFabrics.mVerifyCount != verifyCount+2 {
+		t.Errorf("invalid resume MIC must fall back to full CASE")
+	}
+}
@@ -0,0 +1,89 @@
+package securechannel
+
+import (
+	"crypto/rand"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/transport"
+	"time"
+)
+
+// MsgType 安全通道协议的消息类型
+type MsgType = uint8
+
+const (
+	MsgTypeMsgCounterSyncReq MsgType = 0x00
+	MsgTypeMsgCounterSyncRsp MsgType = 0x01
+
+	MsgTypeStandaloneAck MsgType = 0x10
+
+	MsgTypePBKDFParamRequest  MsgType = 0x20
+	MsgTypePBKDFParamResponse MsgType = 0x21
+	MsgTypePASEPake1          MsgType = 0x22
+	MsgTypePASEPake2          MsgType = 0x23
+	MsgTypePASEPake3          MsgType = 0x24
+
+	MsgTypeCASESigma1       MsgType = 0x30
+	MsgTypeCASESigma2       MsgType = 0x31
+	MsgTypeCASESigma3       MsgType = 0x32
+	MsgTypeCASESigma2Resume MsgType = 0x33
+
+	MsgTypeStatusReport MsgType = 0x40
+)
+
+const (
+	// KSessionEstablishmentTimeout 会话建立过程中等待对端每一条消息的时间
+	KSessionEstablishmentTimeout = 30 * time.Second
+
+	kPBKDFParamRandomNumberSize = 32
+)
+
+// SessionEstablishmentDelegate 接收PASE、CASE会话建立的结果
+type SessionEstablishmentDelegate interface {
+	OnSessionEstablishmentError(err error)
+	OnSessionEstablished(session *transport.SecureSession)
+}
+
+// establishmentReply 处理消息后需要回复的消息，mDone 表示会话已经建立
+type establishmentReply struct {
+	mMsgType MsgType
+	mPayload []byte
+	mDone    bool
+}
+
+// sessionParameters 会话建立时交换的MRP参数，单位为毫秒
+type sessionParameters struct {
+	IdleRetransTimeout   *uint32 `tlv:"1,omitempty"`
+	ActiveRetransTimeout *uint32 `tlv:"2,omitempty"`
+}
+
+func newSessionParameters(config *messageing.ReliableMessageProtocolConfig) *sessionParameters {
+	if config == nil {
+		return nil
+	}
+	idle := uint32(config.IdleRetransTimeout.Milliseconds())
+	active := uint32(config.ActiveRetransTimeout.Milliseconds())
+	return &sessionParameters{IdleRetransTimeout: &idle, ActiveRetransTimeout: &active}
+}
+
+// mrpConfig 对端没有提供的参数为0，使用默认值
+func (p *sessionParameters) mrpConfig() messageing.ReliableMessageProtocolConfig {
+	var config messageing.ReliableMessageProtocolConfig
+	if p == nil {
+		return config
+	}
+	if p.IdleRetransTimeout != nil {
+		config.IdleRetransTimeout = time.Duration(*p.IdleRetransTimeout) * time.Millisecond
+	}
+	if p.ActiveRetransTimeout != nil {
+		config.ActiveRetransTimeout = time.Duration(*p.ActiveRetransTimeout) * time.Millisecond
+	}
+	return config
+}
+
+func newRandom(size int) ([]byte, error) {
+	random := make([]byte, size)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return random, nil
+}
@@ -0,0 +1,552 @@
+package securechannel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	log "github.com/sirupsen/logrus"
+	"hash"
+	"sync"
+)
+
+const (
+	// KDefaultCommissioningPasscodeId 默认的配对码
+	KDefaultCommissioningPasscodeId uint16 = 0
+
+	kSpake2pContextPrefix = "CHIP PAKE V1 Commissioning"
+	kSessionKeysInfo      = "SessionKeys"
+)
+
+type pbkdfParamRequest struct {
+	InitiatorRandom    []byte             `tlv:"1"`
+	InitiatorSessionId uint16             `tlv:"2"`
+	PasscodeId         uint16             `tlv:"3"`
+	HasPBKDFParameters bool               `tlv:"4"`
+	SessionParameters  *sessionParameters `tlv:"5,omitempty"`
+}
+
+type pbkdfParameters struct {
+	Iterations uint32 `tlv:"1"`
+	Salt       []byte `tlv:"2"`
+}
+
+type pbkdfParamResponse struct {
+	InitiatorRandom    []byte             `tlv:"1"`
+	ResponderRandom    []byte             `tlv:"2"`
+	ResponderSessionId uint16             `tlv:"3"`
+	PBKDFParameters    *pbkdfParameters   `tlv:"4,omitempty"`
+	SessionParameters  *sessionParameters `tlv:"5,omitempty"`
+}
+
+type pake1 struct {
+	PA []byte `tlv:"1"`
+}
+
+type pake2 struct {
+	PB []byte `tlv:"1"`
+	CB []byte `tlv:"2"`
+}
+
+type pake3 struct {
+	CA []byte `tlv:"1"`
+}
+
+// PASESession 使用配对码建立会话：配对发起方调用 Pair，设备调用 WaitForPairing 等待 PBKDFParamRequest
+type PASESession struct {
+	mMutex           sync.Mutex
+	mRole            transport.SessionRole
+	mExchangeMgr     messageing.ExchangeManager
+	mDelegate        SessionEstablishmentDelegate
+	mLocalMRPConfig  *messageing.ReliableMessageProtocolConfig
+	mExchange        *messageing.ExchangeContext
+	mNextExpectedMsg MsgType
+	mListening       bool
+
+	mSecureSession *transport.SecureSession
+	mPeerSessionId uint16
+	mPeerMRPConfig messageing.ReliableMessageProtocolConfig
+
+	// 设备使用的验证数据
+	mVerifier       crypto.Spake2pVerifier
+	mIterationCount uint32
+	mSalt           []byte
+	// 发起方使用的配对码
+	mPasscode uint32
+
+	mLocalRandom       []byte
+	mCommissioningHash hash.Hash
+	mSpake2p           *crypto.Spake2p
+}
+
+func NewPASESession() *PASESession {
+	return &PASESession{}
+}
+
+// WaitForPairing 设备等待配对发起方的 PBKDFParamRequest，会话建立成功后不再继续等待
+func (p *PASESession) WaitForPairing(exchangeMgr messageing.ExchangeManager, verifier crypto.Spake2pVerifier, iterations uint32, salt []byte,
+	mrpConfig *messageing.ReliableMessageProtocolConfig, delegate SessionEstablishmentDelegate) error {
+	if exchangeMgr == nil || delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	if len(salt) < crypto.KSpake2pMinPbkdfSaltLength || len(salt) > crypto.KSpake2pMaxPbkdfSaltLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	if iterations == 0 || iterations > crypto.KSpake2pMaxPbkdfIterations {
+		return internal.ChipErrorInvalidArgument
+	}
+	p.Clear()
+
+	p.mMutex.Lock()
+	p.mRole = transport.SessionRoleResponder
+	p.mExchangeMgr = exchangeMgr
+	p.mDelegate = delegate
+	p.mLocalMRPConfig = mrpConfig
+	p.mVerifier = verifier
+	p.mIterationCount = iterations
+	p.mSalt = append([]byte(nil), salt...)
+	p.mNextExpectedMsg = MsgTypePBKDFParamRequest
+	p.mMutex.Unlock()
+
+	if err := exchangeMgr.RegisterUnsolicitedMessageHandlerForType(protocols.SecureChannel, MsgTypePBKDFParamRequest, p); err != nil {
+		return err
+	}
+	p.mMutex.Lock()
+	p.mListening = true
+	p.mMutex.Unlock()
+	log.Infof("PASE waiting for pairing")
+	return nil
+}
+
+// Pair 配对发起方在未认证会话上发送 PBKDFParamRequest 开始建立会话
+func (p *PASESession) Pair(exchangeMgr messageing.ExchangeManager, session transport.Session, passcode uint32,
+	mrpConfig *messageing.ReliableMessageProtocolConfig, delegate SessionEstablishmentDelegate) error {
+	if exchangeMgr == nil || session == nil || delegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	p.Clear()
+
+	secureSession, err := exchangeMgr.GetSessionManager().AllocateSession(transport.SecureSessionTypePASE, lib.ScopedNodeId{})
+	if err != nil {
+		return err
+	}
+	random, err := newPBKDFRandom()
+	if err != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(secureSession)
+		return err
+	}
+	request, err := tlv.Marshal(pbkdfParamRequest{
+		InitiatorRandom:    random,
+		InitiatorSessionId: secureSession.GetLocalSessionId(),
+		PasscodeId:         KDefaultCommissioningPasscodeId,
+		SessionParameters:  newSessionParameters(mrpConfig),
+	})
+	if err != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(secureSession)
+		return err
+	}
+	ec, err := exchangeMgr.NewContext(session, p)
+	if err != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(secureSession)
+		return err
+	}
+	ec.SetResponseTimeout(KSessionEstablishmentTimeout)
+
+	p.mMutex.Lock()
+	p.mRole = transport.SessionRoleInitiator
+	p.mExchangeMgr = exchangeMgr
+	p.mDelegate = delegate
+	p.mLocalMRPConfig = mrpConfig
+	p.mPasscode = passcode
+	p.mSecureSession = secureSession
+	p.mExchange = ec
+	p.mLocalRandom = random
+	p.mCommissioningHash = newCommissioningHash()
+	p.mCommissioningHash.Write(request)
+	p.mNextExpectedMsg = MsgTypePBKDFParamResponse
+	p.mMutex.Unlock()
+
+	if err := ec.SendMessage(protocols.SecureChannel, MsgTypePBKDFParamRequest, request, messageing.SendFlagExpectResponse); err != nil {
+		ec.Abort()
+		p.Clear()
+		return err
+	}
+	log.Infof("PASE sent PBKDFParamRequest, local session %d", secureSession.GetLocalSessionId())
+	return nil
+}
+
+// Clear 放弃进行中的会话建立，设备端不再等待 PBKDFParamRequest
+func (p *PASESession) Clear() {
+	p.mMutex.Lock()
+	exchangeMgr := p.mExchangeMgr
+	listening := p.mListening
+	p.mListening = false
+	session := p.resetLocked()
+	p.mExchangeMgr = nil
+	p.mDelegate = nil
+	p.mMutex.Unlock()
+
+	if exchangeMgr == nil {
+		return
+	}
+	if listening {
+		_ = exchangeMgr.UnregisterUnsolicitedMessageHandlerForType(protocols.SecureChannel, MsgTypePBKDFParamRequest)
+	}
+	if session != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(session)
+	}
+}
+
+// resetLocked 清除本次会话建立的状态，返回需要释放的未完成的会话
+func (p *PASESession) resetLocked() *transport.SecureSession {
+	var session *transport.SecureSession
+	if p.mSecureSession != nil && p.mSecureSession.IsEstablishing() {
+		session = p.mSecureSession
+	}
+	p.mSecureSession = nil
+	p.mExchange = nil
+	p.mPeerSessionId = 0
+	p.mPeerMRPConfig = messageing.ReliableMessageProtocolConfig{}
+	p.mLocalRandom = nil
+	p.mCommissioningHash = nil
+	p.mSpake2p = nil
+	p.mNextExpectedMsg = MsgTypePBKDFParamRequest
+	return session
+}
+
+func (p *PASESession) OnUnsolicitedMessageReceived(*message.PayloadHeader) (messageing.ExchangeDelegate, error) {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mExchange != nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	return p, nil
+}
+
+func (p *PASESession) OnExchangeCreationFailed(messageing.ExchangeDelegate) {}
+
+func (p *PASESession) OnMessageReceived(ec *messageing.ExchangeContext, payloadHeader *message.PayloadHeader, payload []byte) error {
+	p.mMutex.Lock()
+	reply, err := p.handleMessageLocked(ec, payloadHeader, payload)
+	session := p.mSecureSession
+	p.mMutex.Unlock()
+
+	if err != nil {
+		// 对端的失败状态报告不需要再回复
+		if !payloadHeader.HasMessageType(protocols.KVendorIdCommon, protocols.SecureChannel.GetProtocolId(), MsgTypeStatusReport) {
+			_ = sendFailureStatusReport(ec, ProtocolCodeInvalidParam)
+		}
+		p.onPairingFailed(ec, err)
+		return err
+	}
+	if reply.mPayload != nil {
+		flags := messageing.SendFlagExpectResponse
+		if reply.mDone {
+			flags = messageing.SendFlagNone
+		}
+		if err := ec.SendMessage(protocols.SecureChannel, reply.mMsgType, reply.mPayload, flags); err != nil {
+			p.onPairingFailed(ec, err)
+			return err
+		}
+	}
+	if reply.mDone {
+		p.onPairingComplete(session)
+	}
+	return nil
+}
+
+func (p *PASESession) OnResponseTimeout(ec *messageing.ExchangeContext) {
+	log.Infof("PASE timed out waiting for the peer")
+	p.onPairingFailed(ec, internal.ChipErrorTimeout)
+}
+
+func (p *PASESession) OnExchangeClosing(ec *messageing.ExchangeContext) {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mExchange == ec {
+		p.mExchange = nil
+	}
+}
+
+func (p *PASESession) handleMessageLocked(ec *messageing.ExchangeContext, payloadHeader *message.PayloadHeader, payload []byte) (establishmentReply, error) {
+	if p.mDelegate == nil {
+		return establishmentReply{}, internal.ChipErrorIncorrectState
+	}
+	if p.mExchange == nil && p.mRole == transport.SessionRoleResponder {
+		p.mExchange = ec
+		ec.SetResponseTimeout(KSessionEstablishmentTimeout)
+	}
+	if ec != p.mExchange {
+		return establishmentReply{}, internal.ChipErrorIncorrectState
+	}
+	if payloadHeader.GetVendorId() != protocols.KVendorIdCommon || payloadHeader.GetProtocolId() != protocols.SecureChannel.GetProtocolId() {
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+	msgType := payloadHeader.GetMessageType()
+	if msgType == MsgTypeStatusReport {
+		return p.handleStatusReportLocked(ec, payload)
+	}
+	if msgType != p.mNextExpectedMsg {
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+	switch msgType {
+	case MsgTypePBKDFParamRequest:
+		return p.handlePBKDFParamRequestLocked(ec, payload)
+	case MsgTypePBKDFParamResponse:
+		return p.handlePBKDFParamResponseLocked(ec, payload)
+	case MsgTypePASEPake1:
+		return p.handlePake1Locked(payload)
+	case MsgTypePASEPake2:
+		return p.handlePake2Locked(payload)
+	case MsgTypePASEPake3:
+		return p.handlePake3Locked(ec, payload)
+	default:
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+}
+
+func (p *PASESession) handlePBKDFParamRequestLocked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	var request pbkdfParamRequest
+	if err := tlv.Unmarshal(payload, &request); err != nil {
+		return establishmentReply{}, err
+	}
+	if len(request.InitiatorRandom) != kPBKDFParamRandomNumberSize || request.PasscodeId != KDefaultCommissioningPasscodeId {
+		return establishmentReply{}, internal.ChipErrorInvalidPASEParameter
+	}
+	secureSession, err := p.mExchangeMgr.GetSessionManager().AllocateSession(transport.SecureSessionTypePASE, lib.ScopedNodeId{})
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	p.mSecureSession = secureSession
+	p.mPeerSessionId = request.InitiatorSessionId
+	p.setPeerMRPConfigLocked(ec, request.SessionParameters)
+
+	random, err := newPBKDFRandom()
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	response := pbkdfParamResponse{
+		InitiatorRandom:    request.InitiatorRandom,
+		ResponderRandom:    random,
+		ResponderSessionId: secureSession.GetLocalSessionId(),
+		SessionParameters:  newSessionParameters(p.mLocalMRPConfig),
+	}
+	if !request.HasPBKDFParameters {
+		response.PBKDFParameters = &pbkdfParameters{Iterations: p.mIterationCount, Salt: p.mSalt}
+	}
+	data, err := tlv.Marshal(response)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	p.mLocalRandom = random
+	p.mCommissioningHash = newCommissioningHash()
+	p.mCommissioningHash.Write(payload)
+	p.mCommissioningHash.Write(data)
+	p.mNextExpectedMsg = MsgTypePASEPake1
+	log.Infof("PASE received PBKDFParamRequest, peer session %d", request.InitiatorSessionId)
+	return establishmentReply{mMsgType: MsgTypePBKDFParamResponse, mPayload: data}, nil
+}
+
+func (p *PASESession) handlePBKDFParamResponseLocked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	var response pbkdfParamResponse
+	if err := tlv.Unmarshal(payload, &response); err != nil {
+		return establishmentReply{}, err
+	}
+	if !bytes.Equal(response.InitiatorRandom, p.mLocalRandom) || len(response.ResponderRandom) != kPBKDFParamRandomNumberSize {
+		return establishmentReply{}, internal.ChipErrorInvalidPASEParameter
+	}
+	// 请求中没有提供PBKDF参数，设备必须在响应中提供
+	if response.PBKDFParameters == nil {
+		return establishmentReply{}, internal.ChipErrorInvalidPASEParameter
+	}
+	w0, w1, err := crypto.ComputeSpake2pW0W1(response.PBKDFParameters.Iterations, response.PBKDFParameters.Salt, p.mPasscode)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	p.mPeerSessionId = response.ResponderSessionId
+	p.setPeerMRPConfigLocked(ec, response.SessionParameters)
+	p.mCommissioningHash.Write(payload)
+
+	p.mSpake2p = crypto.NewSpake2p()
+	if err := p.mSpake2p.BeginProver(p.mCommissioningHash.Sum(nil), w0, w1); err != nil {
+		return establishmentReply{}, err
+	}
+	pA, err := p.mSpake2p.ComputeRoundOne()
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	data, err := tlv.Marshal(pake1{PA: pA})
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	p.mNextExpectedMsg = MsgTypePASEPake2
+	return establishmentReply{mMsgType: MsgTypePASEPake1, mPayload: data}, nil
+}
+
+func (p *PASESession) handlePake1Locked(payload []byte) (establishmentReply, error) {
+	var msg pake1
+	if err := tlv.Unmarshal(payload, &msg); err != nil {
+		return establishmentReply{}, err
+	}
+	p.mSpake2p = crypto.NewSpake2p()
+	if err := p.mSpake2p.BeginVerifier(p.mCommissioningHash.Sum(nil), p.mVerifier.GetW0(), p.mVerifier.GetL()); err != nil {
+		return establishmentReply{}, err
+	}
+	pB, err := p.mSpake2p.ComputeRoundOne()
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	cB, err := p.mSpake2p.ComputeRoundTwo(msg.PA)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	data, err := tlv.Marshal(pake2{PB: pB, CB: cB})
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	p.mNextExpectedMsg = MsgTypePASEPake3
+	return establishmentReply{mMsgType: MsgTypePASEPake2, mPayload: data}, nil
+}
+
+func (p *PASESession) handlePake2Locked(payload []byte) (establishmentReply, error) {
+	var msg pake2
+	if err := tlv.Unmarshal(payload, &msg); err != nil {
+		return establishmentReply{}, err
+	}
+	cA, err := p.mSpake2p.ComputeRoundTwo(msg.PB)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	if err := p.mSpake2p.KeyConfirm(msg.CB); err != nil {
+		return establishmentReply{}, err
+	}
+	data, err := tlv.Marshal(pake3{CA: cA})
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	// 等待设备的状态报告
+	p.mNextExpectedMsg = MsgTypeStatusReport
+	return establishmentReply{mMsgType: MsgTypePASEPake3, mPayload: data}, nil
+}
+
+func (p *PASESession) handlePake3Locked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	var msg pake3
+	if err := tlv.Unmarshal(payload, &msg); err != nil {
+		return establishmentReply{}, err
+	}
+	if err := p.mSpake2p.KeyConfirm(msg.CA); err != nil {
+		return establishmentReply{}, err
+	}
+	// 先激活会话再发送状态报告，发起方收到后可以立即使用该会话
+	if err := p.activateSecureSessionLocked(ec); err != nil {
+		return establishmentReply{}, err
+	}
+	report := NewStatusReport(GeneralStatusSuccess, protocols.SecureChannel, ProtocolCodeSessionEstablishmentSuccess)
+	return establishmentReply{mMsgType: MsgTypeStatusReport, mPayload: report.Encode(), mDone: true}, nil
+}
+
+func (p *PASESession) handleStatusReportLocked(ec *messageing.ExchangeContext, payload []byte) (establishmentReply, error) {
+	report, err := DecodeStatusReport(payload)
+	if err != nil {
+		return establishmentReply{}, err
+	}
+	if !report.IsSuccess() {
+		log.Infof("PASE received failure status report: general %d, protocol code %d", report.GeneralCode, report.ProtocolCode)
+		if report.ProtocolCode == ProtocolCodeInvalidParam {
+			return establishmentReply{}, internal.ChipErrorInvalidPASEParameter
+		}
+		return establishmentReply{}, internal.ChipErrorInternal
+	}
+	// 只有发起方在发送 Pake3 之后等待成功的状态报告
+	if p.mRole != transport.SessionRoleInitiator || p.mNextExpectedMsg != MsgTypeStatusReport {
+		return establishmentReply{}, internal.ChipErrorInvalidMessageType
+	}
+	if err := p.activateSecureSessionLocked(ec); err != nil {
+		return establishmentReply{}, err
+	}
+	return establishmentReply{mDone: true}, nil
+}
+
+// activateSecureSessionLocked 从共享密钥派生 I2R、R2I 和证明挑战，激活安全会话
+func (p *PASESession) activateSecureSessionLocked(ec *messageing.ExchangeContext) error {
+	ke, err := p.mSpake2p.GetKeys()
+	if err != nil {
+		return err
+	}
+	keys, err := crypto.HKDFSHA256(ke, nil, []byte(kSessionKeysInfo), 2*transport.KSessionKeyLength+transport.KAttestationChallengeLength)
+	if err != nil {
+		return err
+	}
+	cryptoContext, err := transport.NewCryptoContext(keys[:transport.KSessionKeyLength],
+		keys[transport.KSessionKeyLength:2*transport.KSessionKeyLength], keys[2*transport.KSessionKeyLength:], p.mRole)
+	if err != nil {
+		return err
+	}
+	// PASE会话不属于任何Fabric，本端和对端的节点ID都未定义
+	if err := p.mSecureSession.Activate(lib.ScopedNodeId{}, lib.ScopedNodeId{}, lib.CATValues{}, p.mPeerSessionId, cryptoContext, ec.GetSession().GetPeerAddress()); err != nil {
+		return err
+	}
+	p.mSecureSession.SetRemoteMRPConfig(p.mPeerMRPConfig)
+	return nil
+}
+
+// setPeerMRPConfigLocked 对端的MRP参数立即用于会话建立使用的未认证会话
+func (p *PASESession) setPeerMRPConfigLocked(ec *messageing.ExchangeContext, params *sessionParameters) {
+	p.mPeerMRPConfig = params.mrpConfig()
+	ec.GetSession().SetRemoteMRPConfig(p.mPeerMRPConfig)
+}
+
+func (p *PASESession) onPairingComplete(session *transport.SecureSession) {
+	p.mMutex.Lock()
+	delegate := p.mDelegate
+	exchangeMgr := p.mExchangeMgr
+	listening := p.mListening
+	p.mListening = false
+	p.resetLocked()
+	p.mMutex.Unlock()
+
+	if listening {
+		_ = exchangeMgr.UnregisterUnsolicitedMessageHandlerForType(protocols.SecureChannel, MsgTypePBKDFParamRequest)
+	}
+	log.Infof("PASE session established, local session %d, peer session %d", session.GetLocalSessionId(), session.GetPeerSessionId())
+	if delegate != nil {
+		delegate.OnSessionEstablished(session)
+	}
+}
+
+// onPairingFailed 释放未完成的会话，设备端继续等待新的 PBKDFParamRequest
+func (p *PASESession) onPairingFailed(ec *messageing.ExchangeContext, err error) {
+	p.mMutex.Lock()
+	if p.mExchange != nil && p.mExchange != ec {
+		p.mMutex.Unlock()
+		return
+	}
+	delegate := p.mDelegate
+	exchangeMgr := p.mExchangeMgr
+	session := p.resetLocked()
+	p.mMutex.Unlock()
+
+	log.Infof("PASE session establishment failed: %s", err.Error())
+	if session != nil && exchangeMgr != nil {
+		exchangeMgr.GetSessionManager().ExpireSession(session)
+	}
+	if delegate != nil {
+		delegate.OnSessionEstablishmentError(err)
+	}
+}
+
+func newCommissioningHash() hash.Hash {
+	h := sha256.New()
+	h.Write([]byte(kSpake2pContextPrefix))
+	return h
+}
+
+func newPBKDFRandom() ([]byte, error) {
+	return newRandom(kPBKDFParamRandomNumberSize)
+}
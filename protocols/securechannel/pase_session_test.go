@@ -0,0 +1,253 @@
+package securechannel
+
+import (
+	"encoding/hex"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols"
+	"github.com/galenliu/chip/storage"
+	"github.com/galenliu/chip/transport"
+	"github.com/galenliu/chip/transport/message"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+const (
+	testPasscode   uint32 = 20202021
+	testIterations uint32 = 1000
+	testSalt              = "SPAKE2P Key Salt"
+)
+
+// loopbackTransportManager 把发送的消息直接交给另一端的 SessionManager
+type loopbackTransportManager struct {
+	mDelegate transport.TransportDelegate
+	mPeer     *loopbackTransportManager
+	mAddress  transport.PeerAddress
+}
+
+func (l *loopbackTransportManager) Init(...transport.Transport) error { return nil }
+
+func (l *loopbackTransportManager) SetSessionManager(delegate transport.TransportDelegate) {
+	l.mDelegate = delegate
+}
+
+func (l *loopbackTransportManager) SendMessage(_ transport.PeerAddress, msg []byte) error {
+	if l.mPeer.mDelegate != nil {
+		l.mPeer.mDelegate.OnMessageReceived(l.mAddress, append([]byte(nil), msg...))
+	}
+	return nil
+}
+
+func (l *loopbackTransportManager) MulticastGroupJoinLeave(transport.PeerAddress, bool) error {
+	return nil
+}
+
+func (l *loopbackTransportManager) GetTransports() []transport.Transport { return nil }
+
+func (l *loopbackTransportManager) Close() {}
+
+type testEstablishmentDelegate struct {
+	mSession *transport.SecureSession
+	mErr     error
+}
+
+func (d *testEstablishmentDelegate) OnSessionEstablishmentError(err error) {
+	d.mErr = err
+}
+
+func (d *testEstablishmentDelegate) OnSessionEstablished(session *transport.SecureSession) {
+	d.mSession = session
+}
+
+// testEchoDelegate 记录在安全会话上收到的消息
+type testEchoDelegate struct {
+	mPayloads [][]byte
+}
+
+func (d *testEchoDelegate) OnUnsolicitedMessageReceived(*message.PayloadHeader) (messageing.ExchangeDelegate, error) {
+	return d, nil
+}
+
+func (d *testEchoDelegate) OnExchangeCreationFailed(messageing.ExchangeDelegate) {}
+
+func (d *testEchoDelegate) OnMessageReceived(_ *messageing.ExchangeContext, _ *message.PayloadHeader, payload []byte) error {
+	d.mPayloads = append(d.mPayloads, payload)
+	return nil
+}
+
+func (d *testEchoDelegate) OnResponseTimeout(*messageing.ExchangeContext) {}
+
+func (d *testEchoDelegate) OnExchangeClosing(*messageing.ExchangeContext) {}
+
+type paseTestPair struct {
+	commissioner         *messageing.ExchangeManagerImpl
+	device               *messageing.ExchangeManagerImpl
+	commissionerSessions *transport.SessionManagerImpl
+	deviceSessions       *transport.SessionManagerImpl
+	unsecured            transport.Session
+}
+
+func newPASETestPair(t *testing.T) *paseTestPair {
+	t.Helper()
+	aTransport := &loopbackTransportManager{mAddress: transport.NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5541"))}
+	bTransport := &loopbackTransportManager{mAddress: transport.NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5540"))}
+	aTransport.mPeer, bTransport.mPeer = bTransport, aTransport
+
+	p := &paseTestPair{
+		commissioner:         messageing.NewExchangeManagerImpl(),
+		device:               messageing.NewExchangeManagerImpl(),
+		commissionerSessions: transport.NewSessionManagerImpl(),
+		deviceSessions:       transport.NewSessionManagerImpl(),
+	}
+	if err := p.commissionerSessions.Init(aTransport, storage.NewInMemoryPersistentStorage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.deviceSessions.Init(bTransport, storage.NewInMemoryPersistentStorage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.commissioner.Init(p.commissionerSessions); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.device.Init(p.deviceSessions); err != nil {
+		t.Fatal(err)
+	}
+	session, err := p.commissionerSessions.CreateUnauthenticatedSession(bTransport.mAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.unsecured = session
+	return p
+}
+
+func newTestVerifier(t *testing.T) crypto.Spake2pVerifier {
+	t.Helper()
+	var verifier crypto.Spake2pVerifier
+	if err := verifier.Generate(testIterations, []byte(testSalt), testPasscode); err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func TestPASESessionEstablishment(t *testing.T) {
+	p := newPASETestPair(t)
+	deviceMRP := &messageing.ReliableMessageProtocolConfig{IdleRetransTimeout: 800 * time.Millisecond, ActiveRetransTimeout: 400 * time.Millisecond}
+	commissionerMRP := &messageing.ReliableMessageProtocolConfig{IdleRetransTimeout: 600 * time.Millisecond, ActiveRetransTimeout: 200 * time.Millisecond}
+
+	deviceDelegate := &testEstablishmentDelegate{}
+	device := NewPASESession()
+	if err := device.WaitForPairing(p.device, newTestVerifier(t), testIterations, []byte(testSalt), deviceMRP, deviceDelegate); err != nil {
+		t.Fatal(err)
+	}
+	commissionerDelegate := &testEstablishmentDelegate{}
+	commissioner := NewPASESession()
+	if err := commissioner.Pair(p.commissioner, p.unsecured, testPasscode, commissionerMRP, commissionerDelegate); err != nil {
+		t.Fatal(err)
+	}
+
+	if deviceDelegate.mErr != nil || commissionerDelegate.mErr != nil {
+		t.Fatalf("pairing failed: %v %v", deviceDelegate.mErr, commissionerDelegate.mErr)
+	}
+	a, b := commissionerDelegate.mSession, deviceDelegate.mSession
+	if a == nil || b == nil || !a.IsActiveSession() || !b.IsActiveSession() || !a.IsPASESession() {
+		t.Fatalf("both sides must have an active PASE session")
+	}
+	if a.GetPeerSessionId() != b.GetLocalSessionId() || b.GetPeerSessionId() != a.GetLocalSessionId() {
+		t.Errorf("session ids not exchanged")
+	}
+	if a.GetRemoteMRPConfig() != *deviceMRP || b.GetRemoteMRPConfig() != *commissionerMRP {
+		t.Errorf("session parameters not applied: %+v %+v", a.GetRemoteMRPConfig(), b.GetRemoteMRPConfig())
+	}
+	if p.commissioner.GetNumActiveExchanges() != 0 || p.device.GetNumActiveExchanges() != 0 {
+		t.Errorf("pairing exchanges must be closed")
+	}
+
+	// 两端派生的会话秘钥可以互相解密
+	echo := &testEchoDelegate{}
+	if err := p.device.RegisterUnsolicitedMessageHandlerForProtocol(protocols.Echo, echo); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := p.commissioner.NewContext(a, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.SendMessage(protocols.Echo, 0x01, []byte("secure"), messageing.SendFlagNone); err != nil {
+		t.Fatal(err)
+	}
+	if len(echo.mPayloads) != 1 || string(echo.mPayloads[0]) != "secure" {
+		t.Errorf("message over the PASE session not delivered")
+	}
+
+	// 会话建立成功后设备不再处理新的 PBKDFParamRequest
+	again := &testEstablishmentDelegate{}
+	if err := NewPASESession().Pair(p.commissioner, p.unsecured, testPasscode, nil, again); err != nil {
+		t.Fatal(err)
+	}
+	if again.mSession != nil {
+		t.Errorf("device must stop listening after a successful pairing")
+	}
+}
+
+func TestPASESessionWrongPasscode(t *testing.T) {
+	p := newPASETestPair(t)
+	deviceDelegate := &testEstablishmentDelegate{}
+	device := NewPASESession()
+	if err := device.WaitForPairing(p.device, newTestVerifier(t), testIterations, []byte(testSalt), nil, deviceDelegate); err != nil {
+		t.Fatal(err)
+	}
+	commissionerDelegate := &testEstablishmentDelegate{}
+	commissioner := NewPASESession()
+	if err := commissioner.Pair(p.commissioner, p.unsecured, testPasscode+1, nil, commissionerDelegate); err != nil {
+		t.Fatal(err)
+	}
+	if commissionerDelegate.mErr != internal.ChipErrorIntegrityCheckFailed {
+		t.Errorf("commissioner must fail key confirmation, got %v", commissionerDelegate.mErr)
+	}
+	if deviceDelegate.mErr != internal.ChipErrorInvalidPASEParameter {
+		t.Errorf("device must receive the failure status report, got %v", deviceDelegate.mErr)
+	}
+	if commissionerDelegate.mSession != nil || deviceDelegate.mSession != nil {
+		t.Errorf("no session may be established")
+	}
+
+	// 失败后设备继续等待配对
+	deviceDelegate.mErr = nil
+	commissionerDelegate = &testEstablishmentDelegate{}
+	if err := commissioner.Pair(p.commissioner, p.unsecured, testPasscode, nil, commissionerDelegate); err != nil {
+		t.Fatal(err)
+	}
+	if commissionerDelegate.mSession == nil || deviceDelegate.mSession == nil {
+		t.Errorf("retry with the right passcode must succeed: %v %v", commissionerDelegate.mErr, deviceDelegate.mErr)
+	}
+}
+
+func TestWaitForPairingInvalidArguments(t *testing.T) {
+	p := newPASETestPair(t)
+	device := NewPASESession()
+	delegate := &testEstablishmentDelegate{}
+	if err := device.WaitForPairing(p.device, newTestVerifier(t), testIterations, []byte("short"), nil, delegate); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("short salt must be rejected")
+	}
+	if err := device.WaitForPairing(p.device, newTestVerifier(t), crypto.KSpake2pMaxPbkdfIterations+1, []byte(testSalt), nil, delegate); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("too many iterations must be rejected")
+	}
+}
+
+func TestStatusReportEncoding(t *testing.T) {
+	report := NewStatusReport(GeneralStatusFailure, protocols.SecureChannel, ProtocolCodeInvalidParam)
+	if hex.EncodeToString(report.Encode()) != "0100000000000200" {
+		t.Errorf("unexpected encoding %x", report.Encode())
+	}
+	data, _ := hex.DecodeString("0000f1ff0100000001")
+	decoded, err := DecodeStatusReport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IsSuccess() || decoded.ProtocolId != protocols.NewId(0x0001, 0xfff1) || decoded.ProtocolData[0] != 0x01 {
+		t.Errorf("unexpected report %+v", decoded)
+	}
+	if _, err := DecodeStatusReport(data[:7]); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("truncated report must fail")
+	}
+}
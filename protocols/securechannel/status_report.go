@@ -0,0 +1,83 @@
+package securechannel
+
+import (
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols"
+)
+
+// GeneralStatusCode StatusReport 中与协议无关的状态码
+type GeneralStatusCode uint16
+
+const (
+	GeneralStatusSuccess           GeneralStatusCode = 0
+	GeneralStatusFailure           GeneralStatusCode = 1
+	GeneralStatusBadPrecondition   GeneralStatusCode = 2
+	GeneralStatusOutOfRange        GeneralStatusCode = 3
+	GeneralStatusBadRequest        GeneralStatusCode = 4
+	GeneralStatusUnsupported       GeneralStatusCode = 5
+	GeneralStatusUnexpected        GeneralStatusCode = 6
+	GeneralStatusResourceExhausted GeneralStatusCode = 7
+	GeneralStatusBusy              GeneralStatusCode = 8
+	GeneralStatusTimeout           GeneralStatusCode = 9
+)
+
+// 安全通道协议的状态码
+const (
+	ProtocolCodeSessionEstablishmentSuccess uint16 = 0x0000
+	ProtocolCodeNoSharedRoot                uint16 = 0x0001
+	ProtocolCodeInvalidParam                uint16 = 0x0002
+	ProtocolCodeCloseSession                uint16 = 0x0003
+	ProtocolCodeBusy                        uint16 = 0x0004
+)
+
+const kStatusReportMinLength = 8
+
+// StatusReport 安全通道协议的状态报告消息
+type StatusReport struct {
+	GeneralCode  GeneralStatusCode
+	ProtocolId   protocols.Id
+	ProtocolCode uint16
+	ProtocolData []byte
+}
+
+func NewStatusReport(generalCode GeneralStatusCode, protocolId protocols.Id, protocolCode uint16) *StatusReport {
+	return &StatusReport{GeneralCode: generalCode, ProtocolId: protocolId, ProtocolCode: protocolCode}
+}
+
+func (s *StatusReport) IsSuccess() bool {
+	return s.GeneralCode == GeneralStatusSuccess
+}
+
+// Encode 编码为 GeneralCode(2) || ProtocolId(4) || ProtocolCode(2) || ProtocolData
+func (s *StatusReport) Encode() []byte {
+	data := make([]byte, kStatusReportMinLength, kStatusReportMinLength+len(s.ProtocolData))
+	binary.LittleEndian.PutUint16(data[0:], uint16(s.GeneralCode))
+	binary.LittleEndian.PutUint32(data[2:], uint32(s.ProtocolId.GetVendorId())<<16|uint32(s.ProtocolId.GetProtocolId()))
+	binary.LittleEndian.PutUint16(data[6:], s.ProtocolCode)
+	return append(data, s.ProtocolData...)
+}
+
+func DecodeStatusReport(data []byte) (*StatusReport, error) {
+	if len(data) < kStatusReportMinLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	protocolId := binary.LittleEndian.Uint32(data[2:])
+	report := &StatusReport{
+		GeneralCode:  GeneralStatusCode(binary.LittleEndian.Uint16(data[0:])),
+		ProtocolId:   protocols.NewId(lib.VendorId(protocolId>>16), uint16(protocolId)),
+		ProtocolCode: binary.LittleEndian.Uint16(data[6:]),
+	}
+	if len(data) > kStatusReportMinLength {
+		report.ProtocolData = append([]byte(nil), data[kStatusReportMinLength:]...)
+	}
+	return report, nil
+}
+
+// sendFailureStatusReport 会话建立失败时通知对端
+func sendFailureStatusReport(ec *messageing.ExchangeContext, protocolCode uint16) error {
+	report := NewStatusReport(GeneralStatusFailure, protocols.SecureChannel, protocolCode)
+	return ec.SendMessage(protocols.SecureChannel, MsgTypeStatusReport, report.Encode(), messageing.SendFlagNone)
+}
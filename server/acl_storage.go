@@ -1,21 +1,258 @@
 package server
 
 import (
+	"github.com/galenliu/chip/access"
 	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
 	"github.com/galenliu/chip/storage"
+	log "github.com/sirupsen/logrus"
+	"sync"
 )
 
+// KMaxExtensionDataLength ACL 扩展数据的最大长度
+const KMaxExtensionDataLength = 128
+
+// AclStorage 持久化 AccessControl 中的条目和 ACL 扩展，Fabric 被删除时清理它的数据
 type AclStorage interface {
+	// Init 把已保存的条目加载到 AccessControl，之后条目的修改会写入存储
 	Init(storage storage.StorageDelegate, fabrics *credentials.FabricTable) error
+	credentials.FabricTableDelegate
+
+	GetExtension(fabricIndex lib.FabricIndex) ([]byte, error)
+	SetExtension(fabricIndex lib.FabricIndex, data []byte) error
+	RemoveExtension(fabricIndex lib.FabricIndex) error
 }
 
+// 持久化的 ACL 数据
+type (
+	aclTargetData struct {
+		Flags      uint8  `tlv:"0"`
+		Cluster    uint32 `tlv:"1"`
+		Endpoint   uint16 `tlv:"2"`
+		DeviceType uint32 `tlv:"3"`
+	}
+	aclEntryData struct {
+		Privilege uint8           `tlv:"1"`
+		AuthMode  uint8           `tlv:"2"`
+		Subjects  []uint64        `tlv:"3,omitempty"`
+		Targets   []aclTargetData `tlv:"4,omitempty,list"`
+	}
+	aclEntriesData struct {
+		Entries []aclEntryData `tlv:"1,omitempty,list"`
+	}
+	aclExtensionData struct {
+		Data []byte `tlv:"1"`
+	}
+)
+
 type AclStorageImpl struct {
+	mMutex         sync.Mutex
+	mStorage       storage.StorageDelegate
+	mAccessControl access.AccessControler
 }
 
 func NewAclStorageImpl() *AclStorageImpl {
 	return &AclStorageImpl{}
 }
 
-func (d AclStorageImpl) Init(storage storage.StorageDelegate, fabrics *credentials.FabricTable) error {
-	return nil
+func (d *AclStorageImpl) Init(storage storage.StorageDelegate, fabrics *credentials.FabricTable) error {
+	if storage == nil || fabrics == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	accessControl := access.GetAccessControl()
+	if accessControl == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	d.mMutex.Lock()
+	d.mStorage = storage
+	d.mAccessControl = accessControl
+	d.mMutex.Unlock()
+
+	// 加载时还没有注册监听者，不会再写回存储
+	count := 0
+	for _, fabric := range fabrics.GetFabricInfos() {
+		entries, err := d.loadEntries(fabric.GetFabricIndex())
+		if err != nil {
+			log.Errorf("AclStorage: failed to load entries of fabric %d: %v", fabric.GetFabricIndex(), err)
+			continue
+		}
+		for _, entry := range entries {
+			if _, err = accessControl.CreateEntry(nil, entry); err != nil {
+				log.Errorf("AclStorage: failed to restore entry of fabric %d: %v", fabric.GetFabricIndex(), err)
+				continue
+			}
+			count++
+		}
+	}
+	log.Infof("AclStorage: loaded %d entries", count)
+
+	accessControl.AddEntryListener(d)
+	return fabrics.AddFabricDelegate(d)
+}
+
+// OnEntryChanged 重新保存条目所在 Fabric 的所有条目
+func (d *AclStorageImpl) OnEntryChanged(_ *access.SubjectDescriptor, fabricIndex lib.FabricIndex, _ int, _ *access.Entry, _ access.ChangeType) {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	if d.mStorage == nil {
+		return
+	}
+	if err := d.saveEntriesLocked(fabricIndex); err != nil {
+		log.Errorf("AclStorage: failed to save entries of fabric %d: %v", fabricIndex, err)
+	}
+}
+
+func (d *AclStorageImpl) FabricWillBeRemoved(*credentials.FabricTable, lib.FabricIndex) {}
+
+// OnFabricRemoved 删除 Fabric 的所有条目和扩展，条目从后往前删除以保持其它条目的索引
+func (d *AclStorageImpl) OnFabricRemoved(_ *credentials.FabricTable, fabricIndex lib.FabricIndex) {
+	d.mMutex.Lock()
+	accessControl := d.mAccessControl
+	d.mMutex.Unlock()
+	if accessControl == nil {
+		return
+	}
+	for index := accessControl.GetEntryCount(fabricIndex) - 1; index >= 0; index-- {
+		if err := accessControl.DeleteEntry(nil, fabricIndex, index); err != nil {
+			log.Errorf("AclStorage: failed to delete entry %d of fabric %d: %v", index, fabricIndex, err)
+		}
+	}
+
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	d.clearLocked(storage.FabricAccessControlEntries(uint8(fabricIndex)))
+	d.clearLocked(storage.FabricAccessControlExtension(uint8(fabricIndex)))
+}
+
+func (d *AclStorageImpl) OnFabricCommitted(*credentials.FabricTable, lib.FabricIndex) {}
+
+func (d *AclStorageImpl) OnFabricUpdated(*credentials.FabricTable, lib.FabricIndex) {}
+
+func (d *AclStorageImpl) GetExtension(fabricIndex lib.FabricIndex) ([]byte, error) {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	if d.mStorage == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	key := storage.FabricAccessControlExtension(uint8(fabricIndex))
+	if !d.mStorage.HasValue(key) {
+		return nil, internal.ChipErrorNotFound
+	}
+	data, err := d.mStorage.ReadValueBin(key)
+	if err != nil {
+		return nil, err
+	}
+	var extension aclExtensionData
+	if err = tlv.Unmarshal(data, &extension); err != nil {
+		return nil, err
+	}
+	return extension.Data, nil
+}
+
+func (d *AclStorageImpl) SetExtension(fabricIndex lib.FabricIndex, data []byte) error {
+	if !fabricIndex.IsValidFabricIndex() || len(data) > KMaxExtensionDataLength {
+		return internal.ChipErrorInvalidArgument
+	}
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	if d.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	value, err := tlv.Marshal(&aclExtensionData{Data: data})
+	if err != nil {
+		return err
+	}
+	return d.mStorage.WriteValueBin(storage.FabricAccessControlExtension(uint8(fabricIndex)), value)
+}
+
+func (d *AclStorageImpl) RemoveExtension(fabricIndex lib.FabricIndex) error {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	if d.mStorage == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	key := storage.FabricAccessControlExtension(uint8(fabricIndex))
+	if !d.mStorage.HasValue(key) {
+		return internal.ChipErrorNotFound
+	}
+	return d.mStorage.ClearValue(key)
+}
+
+func (d *AclStorageImpl) loadEntries(fabricIndex lib.FabricIndex) ([]access.Entry, error) {
+	d.mMutex.Lock()
+	defer d.mMutex.Unlock()
+	key := storage.FabricAccessControlEntries(uint8(fabricIndex))
+	if !d.mStorage.HasValue(key) {
+		return nil, nil
+	}
+	value, err := d.mStorage.ReadValueBin(key)
+	if err != nil {
+		return nil, err
+	}
+	var data aclEntriesData
+	if err = tlv.Unmarshal(value, &data); err != nil {
+		return nil, err
+	}
+	entries := make([]access.Entry, 0, len(data.Entries))
+	for _, entryData := range data.Entries {
+		entry := access.Entry{
+			FabricIndex: fabricIndex,
+			Privilege:   access.Privilege(entryData.Privilege),
+			AuthMode:    access.AuthMode(entryData.AuthMode),
+		}
+		for _, subject := range entryData.Subjects {
+			entry.Subjects = append(entry.Subjects, lib.NodeId(subject))
+		}
+		for _, target := range entryData.Targets {
+			entry.Targets = append(entry.Targets, access.Target{
+				Flags:      access.TargetFlags(target.Flags),
+				Cluster:    lib.ClusterId(target.Cluster),
+				Endpoint:   lib.EndpointId(target.Endpoint),
+				DeviceType: lib.DeviceTypeId(target.DeviceType),
+			})
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (d *AclStorageImpl) saveEntriesLocked(fabricIndex lib.FabricIndex) error {
+	key := storage.FabricAccessControlEntries(uint8(fabricIndex))
+	entries := d.mAccessControl.Entries(fabricIndex)
+	if len(entries) == 0 {
+		d.clearLocked(key)
+		return nil
+	}
+	var data aclEntriesData
+	for _, entry := range entries {
+		entryData := aclEntryData{Privilege: uint8(entry.Privilege), AuthMode: uint8(entry.AuthMode)}
+		for _, subject := range entry.Subjects {
+			entryData.Subjects = append(entryData.Subjects, uint64(subject))
+		}
+		for _, target := range entry.Targets {
+			entryData.Targets = append(entryData.Targets, aclTargetData{
+				Flags:      uint8(target.Flags),
+				Cluster:    uint32(target.Cluster),
+				Endpoint:   uint16(target.Endpoint),
+				DeviceType: uint32(target.DeviceType),
+			})
+		}
+		data.Entries = append(data.Entries, entryData)
+	}
+	value, err := tlv.Marshal(&data)
+	if err != nil {
+		return err
+	}
+	return d.mStorage.WriteValueBin(key, value)
+}
+
+func (d *AclStorageImpl) clearLocked(key string) {
+	if !d.mStorage.HasValue(key) {
+		return
+	}
+	if err := d.mStorage.ClearValue(key); err != nil {
+		log.Errorf("AclStorage: failed to clear %s: %v", key, err)
+	}
 }
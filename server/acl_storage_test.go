@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bytes"
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/crypto/persistent_storage"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/storage"
+	"testing"
+	"time"
+)
+
+const testNodeId lib.NodeId = 0x0000_0000_0000_0011
+
+func mustSucceed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestFabricTable 使用同一个存储创建 FabricTable，模拟重启
+func newTestFabricTable(t *testing.T, kvs *storage.InMemoryPersistentStorage) *credentials.FabricTable {
+	t.Helper()
+	keystore := persistent_storage.NewPersistentStorageOperationalKeystoreImpl()
+	mustSucceed(t, keystore.Init(kvs))
+	certStore := credentials.NewPersistentStorageOpCertStoreImpl()
+	mustSucceed(t, certStore.Init(kvs))
+	params := credentials.NewFabricTableInitParams()
+	params.Storage = kvs
+	params.OperationalKeystore = keystore
+	params.OpCertStore = certStore
+	params.FirmwareBuildTime = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	table := credentials.NewFabricTable()
+	mustSucceed(t, table.Init(params))
+	return table
+}
+
+// addTestFabric 新增并提交一个由 RCAC 直接签发 NOC 的 Fabric
+func addTestFabric(t *testing.T, table *credentials.FabricTable, fabricId lib.FabricId) lib.FabricIndex {
+	t.Helper()
+	rootKeypair := crypto.NewP256Keypair()
+	mustSucceed(t, rootKeypair.Initialize())
+	nodeKeypair := crypto.NewP256Keypair()
+	mustSucceed(t, nodeKeypair.Initialize())
+	start, err := certs.TimeToChipEpoch(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	mustSucceed(t, err)
+	end, err := certs.TimeToChipEpoch(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+	mustSucceed(t, err)
+
+	var rootDN, nodeDN certs.ChipDN
+	mustSucceed(t, rootDN.AddAttribute(certs.AttributeTypeMatterRCACId, 1))
+	mustSucceed(t, nodeDN.AddAttribute(certs.AttributeTypeMatterNodeId, uint64(testNodeId)))
+	mustSucceed(t, nodeDN.AddAttribute(certs.AttributeTypeMatterFabricId, uint64(fabricId)))
+	rootDer, err := certs.NewRootX509Cert(&certs.X509CertRequestParams{SerialNumber: 1, ValidityStart: start, ValidityEnd: end,
+		SubjectDN: rootDN, IssuerDN: rootDN}, rootKeypair)
+	mustSucceed(t, err)
+	nocDer, err := certs.NewNodeOperationalX509Cert(&certs.X509CertRequestParams{SerialNumber: 2, ValidityStart: start, ValidityEnd: end,
+		SubjectDN: nodeDN, IssuerDN: rootDN}, nodeKeypair.Pubkey(), rootKeypair)
+	mustSucceed(t, err)
+	rcac, err := certs.ConvertX509CertToChipCert(rootDer)
+	mustSucceed(t, err)
+	noc, err := certs.ConvertX509CertToChipCert(nocDer)
+	mustSucceed(t, err)
+
+	mustSucceed(t, table.AddNewPendingTrustedRootCert(rcac))
+	fabricIndex, err := table.AddNewPendingFabricWithProvidedOpKey(noc, nil, 0xFFF1, nodeKeypair, true)
+	mustSucceed(t, err)
+	mustSucceed(t, table.CommitPendingFabricData())
+	return fabricIndex
+}
+
+// newTestAclStorage 创建 AccessControl 并加载已保存的条目
+func newTestAclStorage(t *testing.T, kvs *storage.InMemoryPersistentStorage, table *credentials.FabricTable) (*access.AccessControl, *AclStorageImpl) {
+	t.Helper()
+	accessControl := access.NewAccessControl()
+	mustSucceed(t, accessControl.Init(access.NewExampleAccessControlDelegate(), nil))
+	access.SetAccessControl(accessControl)
+	t.Cleanup(func() { access.SetAccessControl(nil) })
+	aclStorage := NewAclStorageImpl()
+	mustSucceed(t, aclStorage.Init(kvs, table))
+	return accessControl, aclStorage
+}
+
+type testEntryListener struct {
+	mChanges []access.ChangeType
+}
+
+func (l *testEntryListener) OnEntryChanged(_ *access.SubjectDescriptor, _ lib.FabricIndex, _ int, _ *access.Entry, changeType access.ChangeType) {
+	l.mChanges = append(l.mChanges, changeType)
+}
+
+func TestAclStoragePersistence(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	table := newTestFabricTable(t, kvs)
+	fabricIndex := addTestFabric(t, table, 0x1001)
+	accessControl, _ := newTestAclStorage(t, kvs, table)
+	listener := &testEntryListener{}
+	accessControl.AddEntryListener(listener)
+
+	admin := access.Entry{FabricIndex: fabricIndex, Privilege: access.PrivilegeAdminister, AuthMode: access.AuthModeCase,
+		Subjects: []lib.NodeId{testNodeId}}
+	operator := access.Entry{FabricIndex: fabricIndex, Privilege: access.PrivilegeOperate, AuthMode: access.AuthModeGroup,
+		Subjects: []lib.NodeId{lib.NodeIdFromGroupId(0x0101)},
+		Targets:  []access.Target{{Flags: access.TargetFlagCluster | access.TargetFlagEndpoint, Cluster: 0x0006, Endpoint: 1}}}
+	_, err := accessControl.CreateEntry(nil, admin)
+	mustSucceed(t, err)
+	_, err = accessControl.CreateEntry(nil, operator)
+	mustSucceed(t, err)
+	operator.Privilege = access.PrivilegeView
+	mustSucceed(t, accessControl.UpdateEntry(nil, 1, operator))
+	if len(listener.mChanges) != 3 || listener.mChanges[2] != access.ChangeTypeChanged {
+		t.Errorf("unexpected changes %v", listener.mChanges)
+	}
+
+	reloaded, _ := newTestAclStorage(t, kvs, newTestFabricTable(t, kvs))
+	entries := reloaded.Entries(fabricIndex)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Privilege != access.PrivilegeAdminister || entries[0].Subjects[0] != testNodeId {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+	if entries[1].Privilege != access.PrivilegeView || entries[1].AuthMode != access.AuthModeGroup ||
+		len(entries[1].Targets) != 1 || entries[1].Targets[0] != operator.Targets[0] {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+
+	mustSucceed(t, reloaded.DeleteEntry(nil, fabricIndex, 0))
+	reloaded, _ = newTestAclStorage(t, kvs, newTestFabricTable(t, kvs))
+	if entries = reloaded.Entries(fabricIndex); len(entries) != 1 || entries[0].Privilege != access.PrivilegeView {
+		t.Errorf("unexpected entries after delete %+v", entries)
+	}
+}
+
+func TestAclStorageExtension(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	table := newTestFabricTable(t, kvs)
+	_, aclStorage := newTestAclStorage(t, kvs, table)
+
+	if _, err := aclStorage.GetExtension(1); err != internal.ChipErrorNotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	if err := aclStorage.SetExtension(1, make([]byte, KMaxExtensionDataLength+1)); err != internal.ChipErrorInvalidArgument {
+		t.Errorf("oversized extension must fail, got %v", err)
+	}
+	mustSucceed(t, aclStorage.SetExtension(1, []byte{0x15, 0x18}))
+	if data, err := aclStorage.GetExtension(1); err != nil || !bytes.Equal(data, []byte{0x15, 0x18}) {
+		t.Errorf("unexpected extension %x, %v", data, err)
+	}
+	mustSucceed(t, aclStorage.RemoveExtension(1))
+	if _, err := aclStorage.GetExtension(1); err != internal.ChipErrorNotFound {
+		t.Errorf("expected NotFound after remove, got %v", err)
+	}
+}
+
+func TestAclStorageFabricRemoved(t *testing.T) {
+	kvs := storage.NewInMemoryPersistentStorage()
+	table := newTestFabricTable(t, kvs)
+	fabric1 := addTestFabric(t, table, 0x1001)
+	fabric2 := addTestFabric(t, table, 0x1002)
+	accessControl, aclStorage := newTestAclStorage(t, kvs, table)
+	listener := &testEntryListener{}
+	accessControl.AddEntryListener(listener)
+
+	for _, fabricIndex := range []lib.FabricIndex{fabric1, fabric1, fabric2} {
+		_, err := accessControl.CreateEntry(nil, access.Entry{FabricIndex: fabricIndex, Privilege: access.PrivilegeView, AuthMode: access.AuthModeCase})
+		mustSucceed(t, err)
+	}
+	mustSucceed(t, aclStorage.SetExtension(fabric1, []byte{0x01}))
+	listener.mChanges = nil
+
+	mustSucceed(t, table.Delete(fabric1))
+	if accessControl.GetEntryCount(fabric1) != 0 || accessControl.GetEntryCount(fabric2) != 1 {
+		t.Errorf("only entries of the removed fabric must be deleted")
+	}
+	if len(listener.mChanges) != 2 || listener.mChanges[0] != access.ChangeTypeRemoved {
+		t.Errorf("unexpected changes %v", listener.mChanges)
+	}
+	if kvs.HasValue(storage.FabricAccessControlEntries(uint8(fabric1))) || kvs.HasValue(storage.FabricAccessControlExtension(uint8(fabric1))) {
+		t.Error("ACL data of the removed fabric was not cleared")
+	}
+	if !kvs.HasValue(storage.FabricAccessControlEntries(uint8(fabric2))) {
+		t.Error("ACL data of other fabrics must be kept")
+	}
+}
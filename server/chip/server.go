@@ -6,18 +6,28 @@ import (
 	"github.com/galenliu/chip/credentials"
 	storage2 "github.com/galenliu/chip/crypto/persistent_storage"
 	"github.com/galenliu/chip/device"
+	"github.com/galenliu/chip/internal"
 	"github.com/galenliu/chip/lib"
 	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols/securechannel"
 	"github.com/galenliu/chip/server"
 	"github.com/galenliu/chip/server/dnssd"
 	"github.com/galenliu/chip/storage"
 	"github.com/galenliu/chip/transport"
 	log "github.com/sirupsen/logrus"
 	"net"
+	"net/netip"
 	"sync"
 )
 
-var sDeviceTypeResolver = access.DeviceTypeResolver{}
+// deviceTypeResolver 数据模型还没有记录端点的设备类型，设置了设备类型的 ACL Target 都不会匹配
+type deviceTypeResolver struct{}
+
+func (deviceTypeResolver) IsDeviceTypeOnEndpoint(lib.DeviceTypeId, lib.EndpointId) bool {
+	return false
+}
+
+var sDeviceTypeResolver = deviceTypeResolver{}
 
 type AppDelegate interface {
 	OnCommissioningSessionStarted()
@@ -33,7 +43,7 @@ type Server struct {
 	mDnssd                         dnssd.DnssdServer
 	mFabricTable                   *credentials.FabricTable
 	mCommissioningWindowManager    dnssd.CommissioningWindowManager
-	mDeviceStorage                 storage.StorageDelegate //unknown
+	mDeviceStorage                 storage.PersistentStorageDelegate
 	mAccessControl                 access.AccessControler
 	mOpCerStore                    credentials.PersistentStorageOpCertStore
 	mOperationalKeystore           storage2.PersistentStorageOperationalKeystore
@@ -41,14 +51,16 @@ type Server struct {
 
 	mGroupsProvider           credentials.GroupDataProvider
 	mTestEventTriggerDelegate server.TestEventTriggerDelegate
-	mFabricDelegate           credentials.ServerFabricDelegate
-	mSessionResumptionStorage any
+	mFabricDelegate           credentials.FabricTableDelegate
+	mSessionResumptionStorage lib.SessionResumptionStorage
 	mExchangeMgr              messageing.ExchangeManager
+	mCASEServer               *securechannel.CASEServer
 	mAttributePersister       lib.AttributePersistenceProvider //unknown
 	mAclStorage               server.AclStorage
-	mTransports               transport.Transport
+	mTransports               transport.TransportManager
+	mUdpPort                  uint16 // IPv6 UDP 实际绑定的端口，运行服务和组播都使用这个端口
 	mSessions                 transport.SessionManager
-	mListener                 credentials.GroupDataProviderListener
+	mListener                 *serverGroupListener
 	mInitialized              bool
 }
 
@@ -104,6 +116,7 @@ func (s *Server) Init(initParams *InitParams) (*Server, error) {
 		fabricTableInitParams.Storage = s.mDeviceStorage
 		fabricTableInitParams.OperationalKeystore = s.mOperationalKeystore
 		fabricTableInitParams.OpCertStore = s.mOpCerStore
+		fabricTableInitParams.CertificateValidityPolicy = s.mCertificateValidityPolicy
 
 		s.mFabricTable = credentials.NewFabricTable()
 		err := s.mFabricTable.Init(fabricTableInitParams)
@@ -135,29 +148,33 @@ func (s *Server) Init(initParams *InitParams) (*Server, error) {
 		deviceInfoProvider.SetStorageDelegate(s.mDeviceStorage)
 	}
 
-	s.mTransports = transport.NewUdbTransportImpl()
-	err = s.mTransports.Init()
-
-	s.mListener = credentials.NewGroupDataProviderListenerImpl()
-	err = s.mListener.Init(s) // TODO
+	s.mTransports, err = s.initTransports()
 	if err != nil {
 		return nil, err
 	}
-	s.mGroupsProvider.SetListener(s.mListener)
 
 	s.mSessions = transport.NewSessionManagerImpl()
 	err = s.mSessions.Init(s.mTransports, s.mDeviceStorage, s.GetFabricTable())
 	if err != nil {
 		return nil, err
 	}
+	s.mSessions.SetGroupKeyProvider(transport.NewGroupDataKeyProvider(s.mGroupsProvider))
 
-	s.mFabricDelegate = credentials.NewServerFabricDelegateImpl()
-	err = s.mFabricDelegate.Init(s)
+	s.mFabricDelegate = newServerFabricDelegate(s)
+	err = s.mFabricTable.AddFabricDelegate(s.mFabricDelegate)
 	if err != nil {
 		return nil, err
 	}
+	// 上次提交Fabric时中断，FabricTable 已经删除了它，这里清理其它 Fabric 范围的数据
+	if deletedFabricIndex := s.mFabricTable.GetDeletedFabricFromCommitMarker(); deletedFabricIndex != lib.KUndefinedFabricIndex {
+		log.Infof("Server: cleaning up data of fabric %d removed by commit marker", deletedFabricIndex)
+		s.mFabricDelegate.OnFabricRemoved(s.mFabricTable, deletedFabricIndex)
+		s.mAclStorage.OnFabricRemoved(s.mFabricTable, deletedFabricIndex)
+	}
 
-	s.mFabricTable.AddFabricDelegate(s.mFabricDelegate)
+	s.mListener = newServerGroupListener(s)
+	s.mGroupsProvider.SetListener(s.mListener)
+	s.mListener.JoinExistingGroups()
 
 	s.mExchangeMgr = messageing.NewExchangeManagerImpl()
 	err = s.mExchangeMgr.Init(s.mSessions)
@@ -165,6 +182,14 @@ func (s *Server) Init(initParams *InitParams) (*Server, error) {
 		return nil, err
 	}
 
+	// 已经配对的设备通过 CASE 建立运行会话
+	s.mCASEServer = securechannel.NewCASEServer()
+	err = s.mCASEServer.ListenForSessionEstablishment(s.mExchangeMgr, s.mFabricTable, s.mGroupsProvider,
+		s.mSessionResumptionStorage, messageing.GetLocalMRPConfig(), nil)
+	if err != nil {
+		return nil, err
+	}
+
 	//err = mMessageCounterManager.initCommissionableData(&mExchangeMgr);
 	//SuccessOrExit(err);
 
@@ -217,7 +242,7 @@ func (s *Server) Init(initParams *InitParams) (*Server, error) {
 	// a valid port at bind time), that will result in two possible ports being provided back from the resultant endpoint
 	// initializations. Since IPv6 is POR for Matter, let's go ahead and pick that port.
 
-	//discoveryService.SetSecuredPort(s.mTransports.GetTransport().GetImplAtIndex().GetBoundPort())
+	discoveryService.SetSecuredPort(s.mUdpPort)
 	discoveryService.SetUnsecuredPort(s.mUserDirectedCommissioningPort)
 	discoveryService.SetInterfaceId(s.mInterfaceId)
 
@@ -233,7 +258,9 @@ func (s *Server) Init(initParams *InitParams) (*Server, error) {
 
 	//如果设备开启了自动配对模式，进入模式
 	if config.ChipDeviceConfigEnablePairingAutostart {
-		s.GetFabricTable().DeleteAllFabrics()
+		if err = s.GetFabricTable().DeleteAllFabrics(); err != nil {
+			log.Errorf("Server: failed to delete fabrics: %v", err)
+		}
 		err = s.mCommissioningWindowManager.OpenBasicCommissioningWindow()
 		if err != nil {
 			log.Panic(err.Error())
@@ -244,13 +271,96 @@ func (s *Server) Init(initParams *InitParams) (*Server, error) {
 	return s, nil
 }
 
+// initTransports 初始化 IPv6 UDP，以及根据配置初始化 IPv4 UDP 和 TCP，并记录 IPv6 UDP 绑定的端口
+func (s *Server) initTransports() (transport.TransportManager, error) {
+	var transports []transport.Transport
+	closeAll := func() {
+		for _, t := range transports {
+			t.Close()
+		}
+	}
+
+	udpV6 := transport.NewUdbTransportImpl()
+	udpV6.SetInterface(&s.mInterfaceId)
+	if err := udpV6.Init(netip.AddrPortFrom(netip.IPv6Unspecified(), s.mOperationalServicePort)); err != nil {
+		return nil, err
+	}
+	transports = append(transports, udpV6)
+
+	if config.InetConfigEnableIpv4 {
+		udpV4 := transport.NewUdbTransportImpl()
+		if err := udpV4.Init(netip.AddrPortFrom(netip.IPv4Unspecified(), s.mOperationalServicePort)); err != nil {
+			closeAll()
+			return nil, err
+		}
+		transports = append(transports, udpV4)
+	}
+
+	if config.InetConfigEnableTcpEndpoint != 0 {
+		tcp := transport.NewTcpTransportImpl()
+		if err := tcp.Init(netip.AddrPortFrom(netip.IPv6Unspecified(), s.mOperationalServicePort)); err != nil {
+			closeAll()
+			return nil, err
+		}
+		transports = append(transports, tcp)
+	}
+
+	manager := transport.NewTransportManagerImpl()
+	if err := manager.Init(transports...); err != nil {
+		closeAll()
+		return nil, err
+	}
+	s.mUdpPort = udpV6.GetBoundPort()
+	return manager, nil
+}
+
 // GetFabricTable 返回CHIP服务中的Fabric
 func (s Server) GetFabricTable() *credentials.FabricTable {
 	return s.mFabricTable
 }
 
-func (s Server) Shutdown() {
+func (s *Server) GetExchangeManager() messageing.ExchangeManager {
+	return s.mExchangeMgr
+}
+
+func (s *Server) GetSecureSessionManager() transport.SessionManager {
+	return s.mSessions
+}
+
+// NewGroupSession 向 Fabric 中的组发送消息的会话，消息发送到组的组播地址
+func (s *Server) NewGroupSession(fabricIndex lib.FabricIndex, groupId lib.GroupId) (*transport.GroupSession, error) {
+	fabric := s.mFabricTable.FindFabricWithIndex(fabricIndex)
+	if fabric == nil {
+		return nil, internal.ChipErrorInvalidFabricIndex
+	}
+	if groupId == lib.KUndefinedGroupId {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	port, err := s.getUdpPort()
+	if err != nil {
+		return nil, err
+	}
+	peer := transport.NewGroupPeerAddress(fabric.GetFabricId(), groupId, port)
+	return transport.NewOutgoingGroupSession(groupId, fabricIndex, fabric.GetNodeId(), peer), nil
+}
 
+// getUdpPort 组播消息发送到 IPv6 UDP 的端口，没有 IPv6 UDP 传输时返回错误
+func (s *Server) getUdpPort() (uint16, error) {
+	if s.mTransports == nil || s.mUdpPort == 0 {
+		return 0, internal.ChipErrorIncorrectState
+	}
+	return s.mUdpPort, nil
+}
+
+func (s *Server) Shutdown() {
+	if s.mCASEServer != nil {
+		s.mCASEServer.Shutdown()
+	}
+	if s.mTransports != nil {
+		s.mTransports.Close()
+	}
+	s.mUdpPort = 0
+	s.mInitialized = false
 }
 
 func (s *Server) StartServer() error {
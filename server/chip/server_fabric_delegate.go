@@ -0,0 +1,55 @@
+package chip
+
+import (
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/lib"
+	log "github.com/sirupsen/logrus"
+)
+
+// serverFabricDelegate Fabric 被删除或者更新时清理服务中 Fabric 范围的数据
+type serverFabricDelegate struct {
+	mServer *Server
+}
+
+func newServerFabricDelegate(s *Server) *serverFabricDelegate {
+	return &serverFabricDelegate{mServer: s}
+}
+
+func (d *serverFabricDelegate) FabricWillBeRemoved(*credentials.FabricTable, lib.FabricIndex) {}
+
+// OnFabricRemoved 释放Fabric的会话，删除组消息对端计数、会话恢复状态和组数据，没有Fabric时重新打开配对窗口
+func (d *serverFabricDelegate) OnFabricRemoved(fabricTable *credentials.FabricTable, fabricIndex lib.FabricIndex) {
+	s := d.mServer
+	if s.mSessions != nil {
+		s.mSessions.ExpireAllSessionsForFabric(fabricIndex)
+		s.mSessions.RemoveFabric(fabricIndex)
+	}
+	d.clearSessionResumptionStorage(fabricIndex)
+	if s.mGroupsProvider != nil {
+		if err := s.mGroupsProvider.RemoveFabric(fabricIndex); err != nil {
+			log.Errorf("Server: failed to remove group data for fabric %d: %v", fabricIndex, err)
+		}
+	}
+	if fabricTable.FabricCount() == 0 && s.mCommissioningWindowManager != nil {
+		log.Infof("Server: no fabrics left, opening commissioning window")
+		if err := s.mCommissioningWindowManager.OpenBasicCommissioningWindow(); err != nil {
+			log.Errorf("Server: failed to open commissioning window: %v", err)
+		}
+	}
+}
+
+func (d *serverFabricDelegate) OnFabricCommitted(*credentials.FabricTable, lib.FabricIndex) {}
+
+// OnFabricUpdated NOC 更新后旧的会话恢复状态不再有效
+func (d *serverFabricDelegate) OnFabricUpdated(_ *credentials.FabricTable, fabricIndex lib.FabricIndex) {
+	d.clearSessionResumptionStorage(fabricIndex)
+}
+
+func (d *serverFabricDelegate) clearSessionResumptionStorage(fabricIndex lib.FabricIndex) {
+	if d.mServer.mSessionResumptionStorage == nil {
+		return
+	}
+	if err := d.mServer.mSessionResumptionStorage.DeleteAll(fabricIndex); err != nil {
+		log.Errorf("Server: failed to clear session resumption state for fabric %d: %v", fabricIndex, err)
+	}
+}
@@ -0,0 +1,92 @@
+package chip
+
+import (
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/transport"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+type groupMembershipKey struct {
+	fabricIndex lib.FabricIndex
+	groupId     lib.GroupId
+}
+
+// serverGroupListener 根据组成员变化加入或离开组播组
+type serverGroupListener struct {
+	mServer *Server
+	mMutex  sync.Mutex
+	// mJoined 已加入的组播地址，Fabric 删除之后仍然可以用它离开组播组
+	mJoined map[groupMembershipKey]transport.PeerAddress
+}
+
+func newServerGroupListener(s *Server) *serverGroupListener {
+	return &serverGroupListener{mServer: s, mJoined: make(map[groupMembershipKey]transport.PeerAddress)}
+}
+
+// JoinExistingGroups 启动时加入所有已保存的组
+func (l *serverGroupListener) JoinExistingGroups() {
+	s := l.mServer
+	for _, fabric := range s.mFabricTable.GetFabricInfos() {
+		for _, group := range s.mGroupsProvider.GetGroupInfos(fabric.GetFabricIndex()) {
+			l.OnGroupAdded(fabric.GetFabricIndex(), group)
+		}
+	}
+}
+
+func (l *serverGroupListener) OnGroupAdded(fabricIndex lib.FabricIndex, group credentials.GroupInfo) {
+	s := l.mServer
+	fabric := s.mFabricTable.FindFabricWithIndex(fabricIndex)
+	if fabric == nil {
+		return
+	}
+	port, err := s.getUdpPort()
+	if err != nil {
+		log.Errorf("Server: no UDP transport to join group 0x%04X on fabric %d: %v", uint16(group.GroupId), fabricIndex, err)
+		return
+	}
+	peer := transport.NewGroupPeerAddress(fabric.GetFabricId(), group.GroupId, port)
+	key := groupMembershipKey{fabricIndex: fabricIndex, groupId: group.GroupId}
+
+	l.mMutex.Lock()
+	_, joined := l.mJoined[key]
+	shared := l.isJoinedLocked(peer)
+	l.mJoined[key] = peer
+	l.mMutex.Unlock()
+	if joined || shared {
+		return
+	}
+	if err := s.mTransports.MulticastGroupJoinLeave(peer, true); err != nil {
+		log.Errorf("Server: failed to join multicast group %s for group 0x%04X: %v", peer.GetIPAddress(), uint16(group.GroupId), err)
+		return
+	}
+	log.Infof("Server: joined multicast group %s for group 0x%04X on fabric %d", peer.GetIPAddress(), uint16(group.GroupId), fabricIndex)
+}
+
+func (l *serverGroupListener) OnGroupRemoved(fabricIndex lib.FabricIndex, group credentials.GroupInfo) {
+	key := groupMembershipKey{fabricIndex: fabricIndex, groupId: group.GroupId}
+	l.mMutex.Lock()
+	peer, joined := l.mJoined[key]
+	delete(l.mJoined, key)
+	shared := joined && l.isJoinedLocked(peer)
+	l.mMutex.Unlock()
+	if !joined || shared || l.mServer.mTransports == nil {
+		return
+	}
+	if err := l.mServer.mTransports.MulticastGroupJoinLeave(peer, false); err != nil {
+		log.Errorf("Server: failed to leave multicast group %s for group 0x%04X: %v", peer.GetIPAddress(), uint16(group.GroupId), err)
+		return
+	}
+	log.Infof("Server: left multicast group %s for group 0x%04X on fabric %d", peer.GetIPAddress(), uint16(group.GroupId), fabricIndex)
+}
+
+// isJoinedLocked 不同 Fabric 的 FabricID 可能相同，组播地址仍被使用时不能离开
+func (l *serverGroupListener) isJoinedLocked(peer transport.PeerAddress) bool {
+	for _, joined := range l.mJoined {
+		if joined == peer {
+			return true
+		}
+	}
+	return false
+}
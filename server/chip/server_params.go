@@ -15,14 +15,6 @@ type CommonCaseDeviceServerInitParams struct {
 	InitParams
 }
 
-type IgnoreCertificateValidityPolicy struct {
-	credentials.CertificateValidityPolicy
-}
-
-func NewIgnoreCertificateValidityPolicy() *IgnoreCertificateValidityPolicy {
-	return &IgnoreCertificateValidityPolicy{}
-}
-
 type InitParams struct {
 	OperationalServicePort        uint16
 	UserDirectedCommissioningPort uint16
@@ -96,7 +88,7 @@ func (this *InitParams) InitializeStaticResourcesBeforeServerInit() error {
 	var sPersistentStorageOperationalKeystore = storage2.NewPersistentStorageOperationalKeystoreImpl()
 	var sPersistentStorageOpCertStore = credentials.NewPersistentStorageOpCertStoreImpl()
 	var sGroupDataProvider = credentials.NewGroupDataProviderImpl()
-	var sDefaultCertValidityPolicy = NewIgnoreCertificateValidityPolicy()
+	var sDefaultCertValidityPolicy = credentials.NewIgnoreCertificateExpiryPolicy()
 
 	var sSessionResumptionStorage = lib.NewSimpleSessionResumptionStorage()
 
@@ -106,12 +98,16 @@ func (this *InitParams) InitializeStaticResourcesBeforeServerInit() error {
 	}
 
 	if this.OperationalKeystore == nil {
-		sPersistentStorageOperationalKeystore.Init(this.PersistentStorageDelegate)
+		if err := sPersistentStorageOperationalKeystore.Init(this.PersistentStorageDelegate); err != nil {
+			return err
+		}
 		this.OperationalKeystore = sPersistentStorageOperationalKeystore
 	}
 
 	if this.OpCertStore == nil {
-		sPersistentStorageOpCertStore.Init(this.PersistentStorageDelegate)
+		if err := sPersistentStorageOpCertStore.Init(this.PersistentStorageDelegate); err != nil {
+			return err
+		}
 		this.OpCertStore = sPersistentStorageOpCertStore
 	}
 
@@ -137,10 +133,7 @@ func (this *InitParams) InitializeStaticResourcesBeforeServerInit() error {
 
 	this.AccessDelegate = access.GetAccessControlDelegate()
 
-	{
-		//TODO 未实现
-		this.AclStorage = server.NewAclStorageImpl()
-	}
+	this.AclStorage = server.NewAclStorageImpl()
 
 	this.CertificateValidityPolicy = sDefaultCertValidityPolicy
 
@@ -153,7 +146,7 @@ func (p *CommonCaseDeviceServerInitParams) InitializeStaticResourcesBeforeServer
 	var sPersistentStorageOperationalKeystore storage2.PersistentStorageOperationalKeystore
 	var sPersistentStorageOpCertStore credentials.PersistentStorageOpCertStore
 	var sGroupDataProvider credentials.GroupDataProvider
-	var sDefaultCertValidityPolicy = NewIgnoreCertificateValidityPolicy()
+	var sDefaultCertValidityPolicy = credentials.NewIgnoreCertificateExpiryPolicy()
 
 	if p.PersistentStorageDelegate == nil {
 		sKvsPersistentStorageDelegate = storage.KeyValueStoreMgr()
@@ -161,11 +154,16 @@ func (p *CommonCaseDeviceServerInitParams) InitializeStaticResourcesBeforeServer
 	}
 	if p.OperationalKeystore == nil {
 		sPersistentStorageOperationalKeystore = storage2.NewPersistentStorageOperationalKeystoreImpl()
-		sPersistentStorageOperationalKeystore.Init(p.PersistentStorageDelegate)
+		if err := sPersistentStorageOperationalKeystore.Init(p.PersistentStorageDelegate); err != nil {
+			return err
+		}
+		p.OperationalKeystore = sPersistentStorageOperationalKeystore
 	}
 	if p.OpCertStore == nil {
 		sPersistentStorageOpCertStore = credentials.NewPersistentStorageOpCertStoreImpl()
-		sPersistentStorageOpCertStore.Init(p.PersistentStorageDelegate)
+		if err := sPersistentStorageOpCertStore.Init(p.PersistentStorageDelegate); err != nil {
+			return err
+		}
 		p.OpCertStore = sPersistentStorageOpCertStore
 	}
 
@@ -184,10 +182,7 @@ func (p *CommonCaseDeviceServerInitParams) InitializeStaticResourcesBeforeServer
 
 	p.AccessDelegate = access.GetAccessControlDelegate()
 
-	{
-		//TODO 未实现
-		p.AclStorage = server.NewAclStorageImpl()
-	}
+	p.AclStorage = server.NewAclStorageImpl()
 
 	p.CertificateValidityPolicy = sDefaultCertValidityPolicy
 
@@ -1,9 +1,29 @@
 package chip
 
 import (
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/credentials/certs"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/crypto/persistent_storage"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols/securechannel"
+	"github.com/galenliu/chip/server"
+	"github.com/galenliu/chip/storage"
+	"github.com/galenliu/chip/transport"
 	"log"
 	"math/rand"
+	"net/netip"
 	"testing"
+	"time"
+)
+
+const (
+	testFabricId         lib.FabricId = 0x0000_0000_0000_1001
+	testDeviceNodeId     lib.NodeId   = 0x0000_0000_0000_0011
+	testControllerNodeId lib.NodeId   = 0x0000_0000_0001_B669
 )
 
 func TestServer_Init(t *testing.T) {
@@ -13,3 +33,189 @@ func TestServer_Init(t *testing.T) {
 	//s := sd.makeInstanceName(core.PeerId{}.initCommissionableData(core.CompressedFabricId(cid), core.NodeId(nid)))
 	//log.Printf("string: %s", s)
 }
+
+func mustSucceed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFabricCerts 同一个根证书签发的 RCAC 和 NOC
+func testFabricCerts(t *testing.T, root *crypto.P256Keypair, nodeKey *crypto.P256Keypair, nodeId lib.NodeId) (rcac, noc []byte) {
+	t.Helper()
+	start, err := certs.TimeToChipEpoch(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	mustSucceed(t, err)
+	end, err := certs.TimeToChipEpoch(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+	mustSucceed(t, err)
+
+	var rootDN, nodeDN certs.ChipDN
+	mustSucceed(t, rootDN.AddAttribute(certs.AttributeTypeMatterRCACId, 1))
+	mustSucceed(t, nodeDN.AddAttribute(certs.AttributeTypeMatterNodeId, uint64(nodeId)))
+	mustSucceed(t, nodeDN.AddAttribute(certs.AttributeTypeMatterFabricId, uint64(testFabricId)))
+	rootDer, err := certs.NewRootX509Cert(&certs.X509CertRequestParams{SerialNumber: 1, ValidityStart: start, ValidityEnd: end,
+		SubjectDN: rootDN, IssuerDN: rootDN}, root)
+	mustSucceed(t, err)
+	nocDer, err := certs.NewNodeOperationalX509Cert(&certs.X509CertRequestParams{SerialNumber: int64(nodeId), ValidityStart: start, ValidityEnd: end,
+		SubjectDN: nodeDN, IssuerDN: rootDN}, nodeKey.Pubkey(), root)
+	mustSucceed(t, err)
+	rcac, err = certs.ConvertX509CertToChipCert(rootDer)
+	mustSucceed(t, err)
+	noc, err = certs.ConvertX509CertToChipCert(nocDer)
+	mustSucceed(t, err)
+	return rcac, noc
+}
+
+// addTestFabric 提交节点的 Fabric，并设置双方相同的 IPK
+func addTestFabric(t *testing.T, table *credentials.FabricTable, groupData credentials.GroupDataProvider,
+	root *crypto.P256Keypair, nodeId lib.NodeId) lib.FabricIndex {
+	t.Helper()
+	nodeKey := crypto.NewP256Keypair()
+	mustSucceed(t, nodeKey.Initialize())
+	rcac, noc := testFabricCerts(t, root, nodeKey, nodeId)
+	mustSucceed(t, table.AddNewPendingTrustedRootCert(rcac))
+	fabricIndex, err := table.AddNewPendingFabricWithProvidedOpKey(noc, nil, 0xFFF1, nodeKey, true)
+	mustSucceed(t, err)
+	mustSucceed(t, table.CommitPendingFabricData())
+
+	ipk := credentials.KeySet{KeySetId: credentials.KIdentityProtectionKeySetId, EpochKeys: make([]credentials.EpochKey, 1)}
+	for i := range ipk.EpochKeys[0].Key {
+		ipk.EpochKeys[0].Key[i] = byte(0x40 + i)
+	}
+	mustSucceed(t, groupData.SetKeySet(fabricIndex, table.FindFabricWithIndex(fabricIndex).GetCompressedFabricId(), ipk))
+	return fabricIndex
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	kvs := storage.NewInMemoryPersistentStorage()
+	keystore := persistent_storage.NewPersistentStorageOperationalKeystoreImpl()
+	mustSucceed(t, keystore.Init(kvs))
+	certStore := credentials.NewPersistentStorageOpCertStoreImpl()
+	mustSucceed(t, certStore.Init(kvs))
+	groupData := credentials.NewGroupDataProviderImpl()
+	groupData.SetStorageDelegate(kvs)
+	mustSucceed(t, groupData.Init())
+
+	params := NewServerInitParams()
+	params.PersistentStorageDelegate = kvs
+	params.OperationalKeystore = keystore
+	params.OpCertStore = certStore
+	params.GroupDataProvider = groupData
+	params.AccessDelegate = access.NewExampleAccessControlDelegate()
+	params.AclStorage = server.NewAclStorageImpl()
+	params.CertificateValidityPolicy = credentials.NewIgnoreCertificateExpiryPolicy()
+
+	s, err := (&Server{}).Init(params)
+	mustSucceed(t, err)
+	t.Cleanup(func() {
+		s.Shutdown()
+		access.SetAccessControl(nil)
+	})
+	return s
+}
+
+// testController 通过 UDP 连接设备的控制器
+type testController struct {
+	mFabrics     *credentials.FabricTable
+	mGroupData   credentials.GroupDataProvider
+	mSessions    *transport.SessionManagerImpl
+	mExchangeMgr *messageing.ExchangeManagerImpl
+}
+
+func newTestController(t *testing.T) *testController {
+	t.Helper()
+	kvs := storage.NewInMemoryPersistentStorage()
+	keystore := persistent_storage.NewPersistentStorageOperationalKeystoreImpl()
+	mustSucceed(t, keystore.Init(kvs))
+	certStore := credentials.NewPersistentStorageOpCertStoreImpl()
+	mustSucceed(t, certStore.Init(kvs))
+	params := credentials.NewFabricTableInitParams()
+	params.Storage = kvs
+	params.OperationalKeystore = keystore
+	params.OpCertStore = certStore
+	params.CertificateValidityPolicy = credentials.NewIgnoreCertificateExpiryPolicy()
+	c := &testController{
+		mFabrics:     credentials.NewFabricTable(),
+		mGroupData:   credentials.NewGroupDataProviderImpl(),
+		mSessions:    transport.NewSessionManagerImpl(),
+		mExchangeMgr: messageing.NewExchangeManagerImpl(),
+	}
+	mustSucceed(t, c.mFabrics.Init(params))
+	c.mGroupData.SetStorageDelegate(kvs)
+	mustSucceed(t, c.mGroupData.Init())
+
+	udp := transport.NewUdbTransportImpl()
+	mustSucceed(t, udp.Init(netip.AddrPortFrom(netip.IPv6Loopback(), 0)))
+	transports := transport.NewTransportManagerImpl()
+	mustSucceed(t, transports.Init(udp))
+	mustSucceed(t, c.mSessions.Init(transports, kvs, c.mFabrics))
+	mustSucceed(t, c.mExchangeMgr.Init(c.mSessions))
+	t.Cleanup(transports.Close)
+	return c
+}
+
+type testCASEDelegate struct {
+	mSession chan *transport.SecureSession
+	mErr     chan error
+}
+
+func (d *testCASEDelegate) OnSessionEstablishmentError(err error) {
+	d.mErr <- err
+}
+
+func (d *testCASEDelegate) OnSessionEstablished(session *transport.SecureSession) {
+	d.mSession <- session
+}
+
+func TestServerCASESessionEstablishment(t *testing.T) {
+	s := newTestServer(t)
+	controller := newTestController(t)
+	root := crypto.NewP256Keypair()
+	mustSucceed(t, root.Initialize())
+	deviceFabricIndex := addTestFabric(t, s.GetFabricTable(), s.mGroupsProvider, root, testDeviceNodeId)
+	controllerFabricIndex := addTestFabric(t, controller.mFabrics, controller.mGroupData, root, testControllerNodeId)
+
+	devicePort := s.mTransports.GetTransports()[0].GetBoundPort()
+	unsecured, err := controller.mSessions.CreateUnauthenticatedSession(
+		transport.NewUdpPeerAddress(netip.AddrPortFrom(netip.IPv6Loopback(), devicePort)))
+	mustSucceed(t, err)
+	delegate := &testCASEDelegate{mSession: make(chan *transport.SecureSession, 1), mErr: make(chan error, 1)}
+	err = securechannel.NewCASESession().EstablishSession(controller.mExchangeMgr, unsecured, controller.mFabrics, controller.mGroupData, nil,
+		lib.NewScopedNodeId(testDeviceNodeId, controllerFabricIndex), nil, delegate)
+	mustSucceed(t, err)
+
+	select {
+	case session := <-delegate.mSession:
+		if !session.IsCASESession() || session.GetPeer() != lib.NewScopedNodeId(testDeviceNodeId, controllerFabricIndex) {
+			t.Errorf("unexpected controller session peer %v", session.GetPeer())
+		}
+	case err := <-delegate.mErr:
+		t.Fatalf("CASE failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("CASE timed out")
+	}
+	peer := lib.NewScopedNodeId(testControllerNodeId, deviceFabricIndex)
+	if _, ok := s.GetSecureSessionManager().FindSecureSessionForNode(peer, transport.SecureSessionTypeCASE); !ok {
+		t.Error("device has no CASE session with the controller")
+	}
+}
+
+func TestServerNewGroupSessionPort(t *testing.T) {
+	s := newTestServer(t)
+	root := crypto.NewP256Keypair()
+	mustSucceed(t, root.Initialize())
+	fabricIndex := addTestFabric(t, s.GetFabricTable(), s.mGroupsProvider, root, testDeviceNodeId)
+
+	session, err := s.NewGroupSession(fabricIndex, 0x0101)
+	mustSucceed(t, err)
+	if port := session.GetPeerAddress().GetPort(); port == 0 || port != s.mUdpPort {
+		t.Errorf("group session port %d, want the IPv6 UDP port %d", port, s.mUdpPort)
+	}
+
+	// 没有 IPv6 UDP 传输时不能选择其它传输的端口
+	s.mUdpPort = 0
+	if _, err = s.NewGroupSession(fabricIndex, 0x0101); err != internal.ChipErrorIncorrectState {
+		t.Errorf("expected incorrect state without a UDP transport, got %v", err)
+	}
+}
@@ -341,14 +341,14 @@ func (d *AdvertiseImpl) AddCommonTxtEntries(params params.BaseAdvertisingParams)
 			log.Infof("MRP retry interval idle value exceeds allowed range of 1 hour, using maximum available")
 			mrp.IdleRetransTimeout = kMaxRetryInterval
 		}
-		sleepyIdleIntervalBuf := fmt.Sprintf("SII=%d", mrp.IdleRetransTimeout)
+		sleepyIdleIntervalBuf := fmt.Sprintf("SII=%d", mrp.IdleRetransTimeout.Milliseconds())
 		list = append(list, sleepyIdleIntervalBuf)
 
 		if mrp.ActiveRetransTimeout > kMaxRetryInterval {
 			log.Infof("MRP retry interval active value exceeds allowed range of 1 hour, using maximum available")
 			mrp.ActiveRetransTimeout = kMaxRetryInterval
 		}
-		sleepyActiveIntervalBuf := fmt.Sprintf("SAI=%d", mrp.ActiveRetransTimeout)
+		sleepyActiveIntervalBuf := fmt.Sprintf("SAI=%d", mrp.ActiveRetransTimeout.Milliseconds())
 		list = append(list, sleepyActiveIntervalBuf)
 	}
 
@@ -1,6 +1,18 @@
 package dnssd
 
-import "github.com/galenliu/chip/config"
+import (
+	"github.com/galenliu/chip/config"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/device"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/messageing"
+	"github.com/galenliu/chip/protocols/securechannel"
+	"github.com/galenliu/chip/transport"
+	log "github.com/sirupsen/logrus"
+)
+
+// kMaxFailedCommissioningAttempts PASE失败次数达到上限后关闭配对窗口
+const kMaxFailedCommissioningAttempts uint8 = 10
 
 type AppDelegate interface {
 	OnCommissioningSessionStarted()
@@ -9,13 +21,17 @@ type AppDelegate interface {
 	OnCommissioningWindowClosed()
 }
 
+// ServerDelegate 配对窗口使用的服务接口
 type ServerDelegate interface {
+	GetExchangeManager() messageing.ExchangeManager
+	GetSecureSessionManager() transport.SessionManager
 }
 
 type CommissioningWindowManager interface {
 	Init(s ServerDelegate) error
 	SetAppDelegate(delegate AppDelegate)
 	OpenBasicCommissioningWindow() error
+	CloseCommissioningWindow()
 	GetCommissioningMode() int
 }
 
@@ -24,13 +40,21 @@ type CommissioningWindowManagerImpl struct {
 	mAppDelegate                 AppDelegate
 	mFailedCommissioningAttempts uint8
 	mUseECM                      bool
+	mCommissioningMode           int
+	mPairingSession              *securechannel.PASESession
 }
 
 func NewCommissioningWindowManagerImpl() *CommissioningWindowManagerImpl {
-	return &CommissioningWindowManagerImpl{}
+	return &CommissioningWindowManagerImpl{
+		mCommissioningMode: CommissioningMode_Disabled,
+		mPairingSession:    securechannel.NewPASESession(),
+	}
 }
 
-func (m CommissioningWindowManagerImpl) Init(s ServerDelegate) error {
+func (m *CommissioningWindowManagerImpl) Init(s ServerDelegate) error {
+	if s == nil {
+		return internal.ChipErrorInvalidArgument
+	}
 	m.mServer = s
 	return nil
 }
@@ -56,13 +80,74 @@ func (m *CommissioningWindowManagerImpl) OpenBasicCommissioningWindow() error {
 }
 
 func (m *CommissioningWindowManagerImpl) GetCommissioningMode() int {
-	return CommissioningMode_Disabled
+	return m.mCommissioningMode
 }
 
+// OpenCommissioningWindow 使用设备的PASE验证数据等待配对
 func (m *CommissioningWindowManagerImpl) OpenCommissioningWindow() error {
+	if m.mServer == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	provider := device.GetCommissionableDateProvider()
+	serializedVerifier, err := provider.GetSpake2pVerifier()
+	if err != nil {
+		return err
+	}
+	iterations, err := provider.GetSpake2pIterationCount()
+	if err != nil {
+		return err
+	}
+	salt, err := provider.GetSpake2pSalt()
+	if err != nil {
+		return err
+	}
+	var verifier crypto.Spake2pVerifier
+	if err := verifier.Deserialize(serializedVerifier); err != nil {
+		return err
+	}
+	err = m.mPairingSession.WaitForPairing(m.mServer.GetExchangeManager(), verifier, iterations, salt, messageing.GetLocalMRPConfig(), m)
+	if err != nil {
+		return err
+	}
+	m.mCommissioningMode = CommissioningMode_EnableBasic
+	if m.mAppDelegate != nil {
+		m.mAppDelegate.OnCommissioningWindowOpened()
+	}
 	return nil
 }
 
-func (m *CommissioningWindowManagerImpl) Cleanup() {
+func (m *CommissioningWindowManagerImpl) CloseCommissioningWindow() {
+	if m.mCommissioningMode == CommissioningMode_Disabled {
+		return
+	}
+	log.Infof("Closing pairing window")
+	m.Cleanup()
+}
+
+// OnSessionEstablishmentError PASE失败后继续等待，失败次数过多时关闭配对窗口
+func (m *CommissioningWindowManagerImpl) OnSessionEstablishmentError(err error) {
+	m.mFailedCommissioningAttempts++
+	log.Infof("Failed PASE session establishment (%d): %s", m.mFailedCommissioningAttempts, err.Error())
+	if m.mFailedCommissioningAttempts >= kMaxFailedCommissioningAttempts {
+		log.Infof("Too many failed commissioning attempts")
+		m.CloseCommissioningWindow()
+	}
+}
+
+// OnSessionEstablished PASE会话建立后不再接受新的配对
+func (m *CommissioningWindowManagerImpl) OnSessionEstablished(session *transport.SecureSession) {
+	log.Infof("Commissioning session established, local session %d", session.GetLocalSessionId())
+	m.mCommissioningMode = CommissioningMode_Disabled
+	if m.mAppDelegate != nil {
+		m.mAppDelegate.OnCommissioningSessionStarted()
+	}
+}
 
+func (m *CommissioningWindowManagerImpl) Cleanup() {
+	m.mPairingSession.Clear()
+	wasOpen := m.mCommissioningMode != CommissioningMode_Disabled
+	m.mCommissioningMode = CommissioningMode_Disabled
+	if wasOpen && m.mAppDelegate != nil {
+		m.mAppDelegate.OnCommissioningWindowClosed()
+	}
 }
@@ -0,0 +1,105 @@
+package storage
+
+import "fmt"
+
+// 持久化存储使用的键，与 connectedhomeip 的 DefaultStorageKeyAllocator 保持一致
+
+// GroupDataCounterKey 组数据消息的全局计数
+func GroupDataCounterKey() string {
+	return "g/gdc"
+}
+
+// GroupControlCounterKey 组控制消息的全局计数
+func GroupControlCounterKey() string {
+	return "g/gcc"
+}
+
+// SessionResumptionIndex 会话恢复状态的 LRU 索引
+func SessionResumptionIndex() string {
+	return "g/sri"
+}
+
+// SessionResumption 由恢复ID找到对端节点
+func SessionResumption(resumptionIdBase64 string) string {
+	return "g/s/" + resumptionIdBase64
+}
+
+// FabricSession 对端节点的会话恢复状态
+func FabricSession(fabricIndex uint8, nodeId uint64) string {
+	return fmt.Sprintf("f/%x/s/%016X", fabricIndex, nodeId)
+}
+
+// LastKnownGoodTimeKey 最后已知的正确时间
+func LastKnownGoodTimeKey() string {
+	return "g/lkgt"
+}
+
+// FabricIndexInfo 已提交的 FabricIndex 列表和下一个可用的 FabricIndex
+func FabricIndexInfo() string {
+	return "g/fidx"
+}
+
+// FabricMetadata Fabric 的 VendorId 和标签
+func FabricMetadata(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/m", fabricIndex)
+}
+
+// FabricTableCommitMarkerKey 提交 Fabric 数据的过程中保存的标记，用于启动时清理没有完成的提交
+func FabricTableCommitMarkerKey() string {
+	return "g/fs/c"
+}
+
+// FabricOpKey Fabric 的运行秘钥对
+func FabricOpKey(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/k", fabricIndex)
+}
+
+// FabricNOC Fabric 的运行证书
+func FabricNOC(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/n", fabricIndex)
+}
+
+// FabricICAC Fabric 的中间证书
+func FabricICAC(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/i", fabricIndex)
+}
+
+// FabricRCAC Fabric 的根证书
+func FabricRCAC(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/r", fabricIndex)
+}
+
+// GroupFabricList 有组数据的 Fabric 列表
+func GroupFabricList() string {
+	return "g/gfl"
+}
+
+// FabricGroups Fabric 的组信息、端点和组秘钥映射
+func FabricGroups(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/g", fabricIndex)
+}
+
+// FabricKeyset Fabric 的组秘钥集合
+func FabricKeyset(fabricIndex uint8, keysetId uint16) string {
+	return fmt.Sprintf("f/%x/k/%x", fabricIndex, keysetId)
+}
+
+// GroupPeerFabricList 保存了组消息对端计数的 Fabric 列表
+func GroupPeerFabricList() string {
+	return "g/gpfl"
+}
+
+// FabricGroupPeerCounters Fabric 中组消息发送者的计数
+func FabricGroupPeerCounters(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/gpc", fabricIndex)
+}
+
+// FabricAccessControlEntries Fabric 的 ACL 条目列表
+func FabricAccessControlEntries(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/ac/0", fabricIndex)
+}
+
+// FabricAccessControlExtension Fabric 的 ACL 扩展
+func FabricAccessControlExtension(fabricIndex uint8) string {
+	return fmt.Sprintf("f/%x/ac/1", fabricIndex)
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+	"sort"
+	"sync"
+)
+
+// InMemoryPersistentStorage 保存在内存中的存储，用于测试以及不需要持久化的场景
+type InMemoryPersistentStorage struct {
+	mMutex  sync.RWMutex
+	mValues map[string][]byte
+}
+
+func NewInMemoryPersistentStorage() *InMemoryPersistentStorage {
+	return &InMemoryPersistentStorage{mValues: make(map[string][]byte)}
+}
+
+func (s *InMemoryPersistentStorage) Init(string) error {
+	return nil
+}
+
+func (s *InMemoryPersistentStorage) SyncGetKeyValue(key string) (any, error) {
+	return s.ReadValueBin(key)
+}
+
+func (s *InMemoryPersistentStorage) SyncSetKeyValue(key string, value any) error {
+	switch v := value.(type) {
+	case []byte:
+		return s.WriteValueBin(key, v)
+	case string:
+		return s.WriteValueStr(key, v)
+	case bool:
+		return s.WriteValueBool(key, v)
+	case uint8:
+		return s.WriteValueUint16(key, uint16(v))
+	case uint16:
+		return s.WriteValueUint16(key, v)
+	case uint32:
+		return s.WriteValueUint32(key, v)
+	case uint64:
+		return s.WriteValueUint64(key, v)
+	default:
+		return internal.ChipErrorInvalidArgument
+	}
+}
+
+func (s *InMemoryPersistentStorage) SyncDeleteKeyValue(key string) error {
+	return s.ClearValue(key)
+}
+
+func (s *InMemoryPersistentStorage) SyncDoesKeyExist(key string) bool {
+	return s.HasValue(key)
+}
+
+func (s *InMemoryPersistentStorage) ReadBoolValue(key string) (bool, error) {
+	value, err := s.ReadValueBin(key)
+	if err != nil {
+		return false, err
+	}
+	return len(value) == 1 && value[0] != 0, nil
+}
+
+func (s *InMemoryPersistentStorage) ReadValueUint16(key string) (uint16, error) {
+	value, err := s.ReadValueUint64(key)
+	return uint16(value), err
+}
+
+func (s *InMemoryPersistentStorage) ReadValueUint32(key string) (uint32, error) {
+	value, err := s.ReadValueUint64(key)
+	return uint32(value), err
+}
+
+func (s *InMemoryPersistentStorage) ReadValueUint64(key string) (uint64, error) {
+	value, err := s.ReadValueBin(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, internal.ChipErrorIncorrectState
+	}
+	return binary.LittleEndian.Uint64(value), nil
+}
+
+func (s *InMemoryPersistentStorage) ReadValueStr(key string) (string, error) {
+	value, err := s.ReadValueBin(key)
+	return string(value), err
+}
+
+func (s *InMemoryPersistentStorage) ReadValueBin(key string) ([]byte, error) {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	value, ok := s.mValues[key]
+	if !ok {
+		return nil, internal.ChipErrorPersistedStorageValueNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (s *InMemoryPersistentStorage) WriteValueBool(key string, v bool) error {
+	if v {
+		return s.WriteValueBin(key, []byte{1})
+	}
+	return s.WriteValueBin(key, []byte{0})
+}
+
+func (s *InMemoryPersistentStorage) WriteValueUint16(key string, v uint16) error {
+	return s.WriteValueUint64(key, uint64(v))
+}
+
+func (s *InMemoryPersistentStorage) WriteValueUint32(key string, v uint32) error {
+	return s.WriteValueUint64(key, uint64(v))
+}
+
+func (s *InMemoryPersistentStorage) WriteValueUint64(key string, v uint64) error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return s.WriteValueBin(key, buf)
+}
+
+func (s *InMemoryPersistentStorage) WriteValueStr(key string, v string) error {
+	return s.WriteValueBin(key, []byte(v))
+}
+
+func (s *InMemoryPersistentStorage) WriteValueBin(key string, v []byte) error {
+	if key == "" {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mValues[key] = append([]byte(nil), v...)
+	return nil
+}
+
+func (s *InMemoryPersistentStorage) ClearValue(key string) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if _, ok := s.mValues[key]; !ok {
+		return internal.ChipErrorPersistedStorageValueNotFound
+	}
+	delete(s.mValues, key)
+	return nil
+}
+
+func (s *InMemoryPersistentStorage) ClearAll() error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mValues = make(map[string][]byte)
+	return nil
+}
+
+func (s *InMemoryPersistentStorage) Commit() error {
+	return nil
+}
+
+func (s *InMemoryPersistentStorage) HasValue(key string) bool {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	_, ok := s.mValues[key]
+	return ok
+}
+
+// Keys 返回所有的键，按字典序排列
+func (s *InMemoryPersistentStorage) Keys() []string {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	keys := make([]string, 0, len(s.mValues))
+	for key := range s.mValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
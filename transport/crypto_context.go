@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"encoding/binary"
+	"github.com/galenliu/chip/crypto"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/transport/message"
+)
+
+// KSessionKeyLength 会话秘钥的长度（I2R、R2I）
+const KSessionKeyLength = crypto.KAES128CCMKeyLength
+
+// KAttestationChallengeLength 证明挑战的长度
+const KAttestationChallengeLength = 16
+
+// CryptoContext 会话的加解密上下文，保存了该会话使用的对称秘钥
+type CryptoContext struct {
+	mEncryptionKey        []byte
+	mDecryptionKey        []byte
+	mAttestationChallenge []byte
+}
+
+// NewCryptoContext 根据本端的角色选择加密和解密的秘钥：发起者使用 I2R 加密，使用 R2I 解密
+func NewCryptoContext(i2rKey, r2iKey, attestationChallenge []byte, role SessionRole) (*CryptoContext, error) {
+	if len(i2rKey) != KSessionKeyLength || len(r2iKey) != KSessionKeyLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	c := &CryptoContext{
+		mAttestationChallenge: append([]byte(nil), attestationChallenge...),
+	}
+	if role == SessionRoleInitiator {
+		c.mEncryptionKey = append([]byte(nil), i2rKey...)
+		c.mDecryptionKey = append([]byte(nil), r2iKey...)
+	} else {
+		c.mEncryptionKey = append([]byte(nil), r2iKey...)
+		c.mDecryptionKey = append([]byte(nil), i2rKey...)
+	}
+	return c, nil
+}
+
+// NewSymmetricCryptoContext 组会话中加密和解密使用同一个秘钥
+func NewSymmetricCryptoContext(key []byte) (*CryptoContext, error) {
+	if len(key) != KSessionKeyLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	return &CryptoContext{
+		mEncryptionKey: append([]byte(nil), key...),
+		mDecryptionKey: append([]byte(nil), key...),
+	}, nil
+}
+
+func (c *CryptoContext) GetAttestationChallenge() []byte {
+	return c.mAttestationChallenge
+}
+
+// BuildNonce 构建消息的 Nonce：Security Flags(1) | Message Counter(4) | Source Node ID(8)，均为小端
+func BuildNonce(securityFlags uint8, messageCounter uint32, nodeId lib.NodeId) []byte {
+	nonce := make([]byte, crypto.KAES128CCMNonceLength)
+	nonce[0] = securityFlags
+	binary.LittleEndian.PutUint32(nonce[1:5], messageCounter)
+	binary.LittleEndian.PutUint64(nonce[5:13], uint64(nodeId))
+	return nonce
+}
+
+// Encrypt 使用消息头作为附加数据加密，返回 密文|MIC
+func (c *CryptoContext) Encrypt(plaintext []byte, header *message.Header, headerBytes []byte, sourceNodeId lib.NodeId) ([]byte, error) {
+	nonce := BuildNonce(header.GetSecurityFlags(), header.GetMessageCounter(), sourceNodeId)
+	ciphertext, tag, err := crypto.AesCcmEncrypt(plaintext, headerBytes, c.mEncryptionKey, nonce, int(message.KMICTagLength))
+	if err != nil {
+		return nil, err
+	}
+	return append(ciphertext, tag...), nil
+}
+
+// Decrypt 解密 密文|MIC，headerBytes 为收到的原始消息头
+func (c *CryptoContext) Decrypt(data []byte, header *message.Header, headerBytes []byte, sourceNodeId lib.NodeId) ([]byte, error) {
+	micLength := int(header.MICTagLength())
+	if len(data) < micLength {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	nonce := BuildNonce(header.GetSecurityFlags(), header.GetMessageCounter(), sourceNodeId)
+	return crypto.AesCcmDecrypt(data[:len(data)-micLength], headerBytes, data[len(data)-micLength:], c.mDecryptionKey, nonce)
+}
@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/lib"
+	log "github.com/sirupsen/logrus"
+)
+
+// GroupDataKeyProvider 使用 GroupDataProvider 中的运行组秘钥加解密组消息
+type GroupDataKeyProvider struct {
+	mProvider credentials.GroupDataProvider
+}
+
+func NewGroupDataKeyProvider(provider credentials.GroupDataProvider) *GroupDataKeyProvider {
+	return &GroupDataKeyProvider{mProvider: provider}
+}
+
+// GetIncomingGroupSessionKeys 不同的组或者Fabric可能派生出相同的会话ID，接收时需要逐个尝试
+func (p *GroupDataKeyProvider) GetIncomingGroupSessionKeys(sessionId uint16) []GroupSessionKey {
+	sessions := p.mProvider.GetGroupSessions(sessionId)
+	keys := make([]GroupSessionKey, 0, len(sessions))
+	for _, session := range sessions {
+		key, err := NewSymmetricCryptoContext(session.Key[:])
+		if err != nil {
+			log.Infof("GroupDataKeyProvider invalid key for group %d: %s", session.GroupId, err.Error())
+			continue
+		}
+		keys = append(keys, GroupSessionKey{FabricIndex: session.FabricIndex, GroupId: session.GroupId, Key: key})
+	}
+	return keys
+}
+
+// GetOutgoingGroupSessionKey 发送时使用组当前的纪元秘钥
+func (p *GroupDataKeyProvider) GetOutgoingGroupSessionKey(fabricIndex lib.FabricIndex, groupId lib.GroupId) (uint16, *CryptoContext, error) {
+	session, err := p.mProvider.GetCurrentGroupSession(fabricIndex, groupId)
+	if err != nil {
+		return 0, nil, err
+	}
+	key, err := NewSymmetricCryptoContext(session.Key[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return session.SessionId, key, nil
+}
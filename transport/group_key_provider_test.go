@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/lib"
+	"net/netip"
+	"testing"
+)
+
+func TestGroupMulticastAddress(t *testing.T) {
+	addr := GroupMulticastAddress(0x1122334455667788, 0xABCD)
+	if addr != netip.MustParseAddr("ff35:40:fd11:2233:4455:6677:8800:abcd") {
+		t.Errorf("unexpected multicast address %s", addr)
+	}
+	peer := NewGroupPeerAddress(0x1122334455667788, 0xABCD, 5540)
+	if !peer.IsMulticast() || peer.GetPort() != 5540 {
+		t.Errorf("unexpected peer address %s", peer)
+	}
+}
+
+func TestSessionManagerGroupDataKeyProvider(t *testing.T) {
+	const compressedFabricId lib.CompressedFabricId = 0x0102030405060708
+	groups := credentials.NewGroupDataProviderImpl()
+	if err := groups.Init(); err != nil {
+		t.Fatal(err)
+	}
+	epochKey := credentials.EpochKey{}
+	for i := range epochKey.Key {
+		epochKey.Key[i] = byte(i)
+	}
+	keySet := credentials.KeySet{KeySetId: 1, EpochKeys: []credentials.EpochKey{epochKey}}
+	if err := groups.SetKeySet(testFabricIndex, compressedFabricId, keySet); err != nil {
+		t.Fatal(err)
+	}
+	if err := groups.SetGroupKey(testFabricIndex, credentials.GroupKey{GroupId: testGroupId, KeySetId: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newSessionManagerPair(t)
+	provider := NewGroupDataKeyProvider(groups)
+	p.a.SetGroupKeyProvider(provider)
+	p.b.SetGroupKeyProvider(provider)
+	p.b.mLocalNodeIdLookup = func(lib.FabricIndex) (lib.NodeId, bool) { return testNodeB, true }
+
+	session := NewOutgoingGroupSession(testGroupId, testFabricIndex, testNodeA, p.bTransport.mAddress)
+	prepared, err := p.a.PrepareMessage(session, newTestPayloadHeader(), []byte("scene"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.a.SendPreparedMessage(session, prepared); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.bDelegate.mMessages) != 1 || string(p.bDelegate.mMessages[0].payload) != "scene" {
+		t.Fatalf("expected the group message to be decrypted, got %d messages", len(p.bDelegate.mMessages))
+	}
+	current, _ := groups.GetCurrentGroupSession(testFabricIndex, testGroupId)
+	if p.bDelegate.mMessages[0].packetHeader.GetSessionId() != current.SessionId {
+		t.Errorf("group message must use the group session id")
+	}
+
+	// 没有组秘钥映射的组不能发送
+	other := NewOutgoingGroupSession(testGroupId+1, testFabricIndex, testNodeA, p.bTransport.mAddress)
+	if _, err = p.a.PrepareMessage(other, newTestPayloadHeader(), []byte("scene")); err == nil {
+		t.Error("sending to a group without a key must fail")
+	}
+}
@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"encoding/binary"
+	"github.com/galenliu/chip/lib"
+	"net/netip"
+)
+
+// GroupMulticastAddress 组播地址为基于单播前缀的 IPv6 组播地址 FF35:0040:FD<FabricID>00:<GroupID>
+func GroupMulticastAddress(fabricId lib.FabricId, groupId lib.GroupId) netip.Addr {
+	var addr [16]byte
+	addr[0], addr[1] = 0xFF, 0x35
+	// 保留位为0，前缀长度为64位
+	addr[2], addr[3] = 0x00, 0x40
+	// ULA 前缀 FD 后面是 FabricID
+	addr[4] = 0xFD
+	binary.BigEndian.PutUint64(addr[5:13], uint64(fabricId))
+	addr[13] = 0x00
+	binary.BigEndian.PutUint16(addr[14:], uint16(groupId))
+	return netip.AddrFrom16(addr)
+}
+
+// NewGroupPeerAddress 发送和接收组消息的 UDP 组播地址
+func NewGroupPeerAddress(fabricId lib.FabricId, groupId lib.GroupId, port uint16) PeerAddress {
+	return NewUdpPeerAddress(netip.AddrPortFrom(GroupMulticastAddress(fabricId, groupId), port))
+}
@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/lib/tlv"
+	"github.com/galenliu/chip/storage"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+)
+
+// KMaxGroupPeersPerFabric 每个Fabric保存计数的组消息发送者的最大数量
+const KMaxGroupPeersPerFabric = 32
+
+// groupPeerCounters 某个组消息发送者的数据和控制消息计数
+type groupPeerCounters struct {
+	mDataCounter    PeerMessageCounter
+	mControlCounter PeerMessageCounter
+}
+
+type groupPeerKey struct {
+	fabricIndex lib.FabricIndex
+	nodeId      lib.NodeId
+}
+
+// groupPeerCounterData 持久化的对端计数，只保存已经同步的计数
+type groupPeerCounterData struct {
+	NodeId         uint64 `tlv:"1"`
+	DataSynced     bool   `tlv:"2"`
+	DataCounter    uint32 `tlv:"3"`
+	DataWindow     uint32 `tlv:"4"`
+	ControlSynced  bool   `tlv:"5"`
+	ControlCounter uint32 `tlv:"6"`
+	ControlWindow  uint32 `tlv:"7"`
+}
+
+type groupPeerFabricData struct {
+	Peers []groupPeerCounterData `tlv:"1,omitempty,list"`
+}
+
+type groupPeerFabricList struct {
+	FabricIndices []uint16 `tlv:"1,omitempty"`
+}
+
+// GroupPeerTable 按照 Fabric 和源节点保存组消息的对端计数，设置存储后已同步的计数会被持久化，
+// 重启后继续检测重放的组消息
+type GroupPeerTable struct {
+	mMutex    sync.Mutex
+	mPeers    map[groupPeerKey]*groupPeerCounters
+	mMaxPeers int
+	mStorage  storage.PersistentStorageDelegate
+	// mStoredFabrics 存储中有对端计数的 Fabric
+	mStoredFabrics map[lib.FabricIndex]bool
+}
+
+func NewGroupPeerTable(maxPeersPerFabric int) *GroupPeerTable {
+	return &GroupPeerTable{
+		mPeers:         make(map[groupPeerKey]*groupPeerCounters),
+		mMaxPeers:      maxPeersPerFabric,
+		mStoredFabrics: make(map[lib.FabricIndex]bool),
+	}
+}
+
+// Init 保存存储并恢复持久化的对端计数，无法读取的 Fabric 计数会被忽略
+func (t *GroupPeerTable) Init(storageDelegate storage.PersistentStorageDelegate) error {
+	if storageDelegate == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	t.mStorage = storageDelegate
+	var fabricList groupPeerFabricList
+	if err := t.readLocked(storage.GroupPeerFabricList(), &fabricList); err != nil {
+		if err == internal.ChipErrorPersistedStorageValueNotFound {
+			return nil
+		}
+		return err
+	}
+	for _, index := range fabricList.FabricIndices {
+		fabricIndex := lib.FabricIndex(index)
+		var data groupPeerFabricData
+		if err := t.readLocked(storage.FabricGroupPeerCounters(uint8(fabricIndex)), &data); err != nil {
+			log.Errorf("GroupPeerTable: failed to restore peer counters of fabric %d: %v", fabricIndex, err)
+			continue
+		}
+		t.mStoredFabrics[fabricIndex] = true
+		for _, peer := range data.Peers {
+			nodeId := lib.NodeId(peer.NodeId)
+			if !nodeId.IsOperationalNodeId() || t.fabricPeerCount(fabricIndex) >= t.mMaxPeers {
+				continue
+			}
+			counters := &groupPeerCounters{}
+			if peer.DataSynced {
+				counters.mDataCounter.restore(peer.DataCounter, peer.DataWindow)
+			}
+			if peer.ControlSynced {
+				counters.mControlCounter.restore(peer.ControlCounter, peer.ControlWindow)
+			}
+			t.mPeers[groupPeerKey{fabricIndex: fabricIndex, nodeId: nodeId}] = counters
+		}
+	}
+	return nil
+}
+
+// WithPeerCounter 在持有锁的情况下访问对端的计数，对端不存在时创建，fn 成功后持久化已同步的计数
+func (t *GroupPeerTable) WithPeerCounter(fabricIndex lib.FabricIndex, nodeId lib.NodeId, isControl bool, fn func(counter *PeerMessageCounter) error) error {
+	if fabricIndex == lib.KUndefinedFabricIndex || !nodeId.IsOperationalNodeId() {
+		return internal.ChipErrorInvalidArgument
+	}
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	key := groupPeerKey{fabricIndex: fabricIndex, nodeId: nodeId}
+	peer, ok := t.mPeers[key]
+	if !ok {
+		if t.fabricPeerCount(fabricIndex) >= t.mMaxPeers {
+			return internal.ChipErrorTooManyPeerNodes
+		}
+		peer = &groupPeerCounters{}
+		t.mPeers[key] = peer
+	}
+	counter := &peer.mDataCounter
+	if isControl {
+		counter = &peer.mControlCounter
+	}
+	if err := fn(counter); err != nil {
+		return err
+	}
+	if counter.IsSynchronized() {
+		// 消息已经被接受，持久化失败不影响处理，只是重启后可能接受重放的消息
+		if err := t.storeFabricLocked(fabricIndex); err != nil {
+			log.Errorf("GroupPeerTable: failed to store peer counters of fabric %d: %v", fabricIndex, err)
+		}
+	}
+	return nil
+}
+
+// RemovePeer 移除对端的计数
+func (t *GroupPeerTable) RemovePeer(fabricIndex lib.FabricIndex, nodeId lib.NodeId) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	delete(t.mPeers, groupPeerKey{fabricIndex: fabricIndex, nodeId: nodeId})
+	if err := t.storeFabricLocked(fabricIndex); err != nil {
+		log.Errorf("GroupPeerTable: failed to store peer counters of fabric %d: %v", fabricIndex, err)
+	}
+}
+
+// RemoveFabric 移除某个Fabric所有对端的计数，包括存储中的计数
+func (t *GroupPeerTable) RemoveFabric(fabricIndex lib.FabricIndex) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	for key := range t.mPeers {
+		if key.fabricIndex == fabricIndex {
+			delete(t.mPeers, key)
+		}
+	}
+	if err := t.storeFabricLocked(fabricIndex); err != nil {
+		log.Errorf("GroupPeerTable: failed to remove peer counters of fabric %d: %v", fabricIndex, err)
+	}
+}
+
+func (t *GroupPeerTable) fabricPeerCount(fabricIndex lib.FabricIndex) int {
+	count := 0
+	for key := range t.mPeers {
+		if key.fabricIndex == fabricIndex {
+			count++
+		}
+	}
+	return count
+}
+
+// storeFabricLocked 保存 Fabric 已同步的对端计数，没有已同步的计数时删除存储中的计数
+func (t *GroupPeerTable) storeFabricLocked(fabricIndex lib.FabricIndex) error {
+	if t.mStorage == nil {
+		return nil
+	}
+	var data groupPeerFabricData
+	for key, peer := range t.mPeers {
+		if key.fabricIndex != fabricIndex || (!peer.mDataCounter.IsSynchronized() && !peer.mControlCounter.IsSynchronized()) {
+			continue
+		}
+		entry := groupPeerCounterData{NodeId: uint64(key.nodeId)}
+		if peer.mDataCounter.IsSynchronized() {
+			entry.DataSynced, entry.DataCounter, entry.DataWindow = true, peer.mDataCounter.mMaxCounter, peer.mDataCounter.mWindow
+		}
+		if peer.mControlCounter.IsSynchronized() {
+			entry.ControlSynced, entry.ControlCounter, entry.ControlWindow = true, peer.mControlCounter.mMaxCounter, peer.mControlCounter.mWindow
+		}
+		data.Peers = append(data.Peers, entry)
+	}
+	key := storage.FabricGroupPeerCounters(uint8(fabricIndex))
+	if len(data.Peers) == 0 {
+		if !t.mStoredFabrics[fabricIndex] {
+			return nil
+		}
+		if err := t.mStorage.SyncDeleteKeyValue(key); err != nil {
+			return err
+		}
+		delete(t.mStoredFabrics, fabricIndex)
+		return t.storeFabricListLocked()
+	}
+	sort.Slice(data.Peers, func(i, j int) bool { return data.Peers[i].NodeId < data.Peers[j].NodeId })
+	if err := t.writeLocked(key, &data); err != nil {
+		return err
+	}
+	if t.mStoredFabrics[fabricIndex] {
+		return nil
+	}
+	t.mStoredFabrics[fabricIndex] = true
+	return t.storeFabricListLocked()
+}
+
+func (t *GroupPeerTable) storeFabricListLocked() error {
+	if len(t.mStoredFabrics) == 0 {
+		return t.mStorage.SyncDeleteKeyValue(storage.GroupPeerFabricList())
+	}
+	var fabricList groupPeerFabricList
+	for fabricIndex := range t.mStoredFabrics {
+		fabricList.FabricIndices = append(fabricList.FabricIndices, uint16(fabricIndex))
+	}
+	sort.Slice(fabricList.FabricIndices, func(i, j int) bool { return fabricList.FabricIndices[i] < fabricList.FabricIndices[j] })
+	return t.writeLocked(storage.GroupPeerFabricList(), &fabricList)
+}
+
+func (t *GroupPeerTable) readLocked(key string, value any) error {
+	if !t.mStorage.HasValue(key) {
+		return internal.ChipErrorPersistedStorageValueNotFound
+	}
+	data, err := t.mStorage.ReadValueBin(key)
+	if err != nil {
+		return err
+	}
+	return tlv.Unmarshal(data, value)
+}
+
+func (t *GroupPeerTable) writeLocked(key string, value any) error {
+	data, err := tlv.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return t.mStorage.WriteValueBin(key, data)
+}
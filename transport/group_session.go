@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/lib"
+	"sync"
+	"time"
+)
+
+// KMaxGroupPeers 保存的组会话（组、源节点）的最大数量
+const KMaxGroupPeers = 32
+
+// GroupSessionKey 可以解密某个组会话ID的秘钥
+type GroupSessionKey struct {
+	FabricIndex lib.FabricIndex
+	GroupId     lib.GroupId
+	Key         *CryptoContext
+}
+
+// GroupKeyProvider 提供组消息加解密使用的秘钥，由 GroupDataProvider 实现
+type GroupKeyProvider interface {
+	// GetIncomingGroupSessionKeys 返回所有会话ID为 sessionId 的候选秘钥
+	GetIncomingGroupSessionKeys(sessionId uint16) []GroupSessionKey
+	// GetOutgoingGroupSessionKey 返回发送组消息使用的会话ID和秘钥
+	GetOutgoingGroupSessionKey(fabricIndex lib.FabricIndex, groupId lib.GroupId) (uint16, *CryptoContext, error)
+}
+
+// GroupSession 组播会话，接收时通过 Fabric、组ID 和源节点区分
+type GroupSession struct {
+	sessionBase
+	mSessionType  SessionType
+	mGroupId      lib.GroupId
+	mFabricIndex  lib.FabricIndex
+	mSourceNodeId lib.NodeId
+}
+
+// NewOutgoingGroupSession 发送组消息使用的会话，peerAddress 为组播地址
+func NewOutgoingGroupSession(groupId lib.GroupId, fabricIndex lib.FabricIndex, sourceNodeId lib.NodeId, peerAddress PeerAddress) *GroupSession {
+	s := &GroupSession{
+		mSessionType:  SessionTypeGroupOutgoing,
+		mGroupId:      groupId,
+		mFabricIndex:  fabricIndex,
+		mSourceNodeId: sourceNodeId,
+	}
+	s.mPeerAddress = peerAddress
+	s.mLastActivity = time.Now()
+	return s
+}
+
+func newIncomingGroupSession(groupId lib.GroupId, fabricIndex lib.FabricIndex, sourceNodeId lib.NodeId) *GroupSession {
+	s := &GroupSession{
+		mSessionType:  SessionTypeGroupIncoming,
+		mGroupId:      groupId,
+		mFabricIndex:  fabricIndex,
+		mSourceNodeId: sourceNodeId,
+	}
+	s.mLastActivity = time.Now()
+	return s
+}
+
+func (s *GroupSession) GetSessionType() SessionType {
+	return s.mSessionType
+}
+
+// GetPeer 接收的组会话的对端为发送消息的节点
+func (s *GroupSession) GetPeer() lib.ScopedNodeId {
+	if s.mSessionType == SessionTypeGroupIncoming {
+		return lib.NewScopedNodeId(s.mSourceNodeId, s.mFabricIndex)
+	}
+	return lib.NewScopedNodeId(lib.KUndefinedNodeId, s.mFabricIndex)
+}
+
+func (s *GroupSession) GetFabricIndex() lib.FabricIndex {
+	return s.mFabricIndex
+}
+
+func (s *GroupSession) GetGroupId() lib.GroupId {
+	return s.mGroupId
+}
+
+func (s *GroupSession) GetSourceNodeId() lib.NodeId {
+	return s.mSourceNodeId
+}
+
+// GetSubjectDescriptor 组会话的主体为组
+func (s *GroupSession) GetSubjectDescriptor() access.SubjectDescriptor {
+	return access.SubjectDescriptor{
+		FabricIndex: s.mFabricIndex,
+		AuthMode:    access.AuthModeGroup,
+		Subject:     lib.NodeIdFromGroupId(s.mGroupId),
+	}
+}
+
+func (s *GroupSession) IsGroupSession() bool {
+	return true
+}
+
+func (s *GroupSession) IsSecureSession() bool {
+	return false
+}
+
+func (s *GroupSession) IsActiveSession() bool {
+	return true
+}
+
+type groupSessionKey struct {
+	fabricIndex  lib.FabricIndex
+	groupId      lib.GroupId
+	sourceNodeId lib.NodeId
+}
+
+// GroupSessionTable 接收组消息的会话表，满了之后淘汰最久未活动的会话
+type GroupSessionTable struct {
+	mMutex       sync.Mutex
+	mSessions    map[groupSessionKey]*GroupSession
+	mMaxSessions int
+}
+
+func NewGroupSessionTable(maxSessions int) *GroupSessionTable {
+	return &GroupSessionTable{
+		mSessions:    make(map[groupSessionKey]*GroupSession),
+		mMaxSessions: maxSessions,
+	}
+}
+
+// FindOrAllocate 查找或者创建接收组消息的会话
+func (t *GroupSessionTable) FindOrAllocate(fabricIndex lib.FabricIndex, groupId lib.GroupId, sourceNodeId lib.NodeId) *GroupSession {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	key := groupSessionKey{fabricIndex: fabricIndex, groupId: groupId, sourceNodeId: sourceNodeId}
+	if s, ok := t.mSessions[key]; ok {
+		return s
+	}
+	if len(t.mSessions) >= t.mMaxSessions {
+		var oldestKey groupSessionKey
+		var oldest *GroupSession
+		for k, s := range t.mSessions {
+			if oldest == nil || s.GetLastActivityTime().Before(oldest.GetLastActivityTime()) {
+				oldestKey, oldest = k, s
+			}
+		}
+		delete(t.mSessions, oldestKey)
+	}
+	s := newIncomingGroupSession(groupId, fabricIndex, sourceNodeId)
+	t.mSessions[key] = s
+	return s
+}
+
+// RemoveFabric 移除某个Fabric的所有组会话
+func (t *GroupSessionTable) RemoveFabric(fabricIndex lib.FabricIndex) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	for k := range t.mSessions {
+		if k.fabricIndex == fabricIndex {
+			delete(t.mSessions, k)
+		}
+	}
+}
@@ -12,29 +12,47 @@ const (
 	SessionTypeUnicast uint8 = 0
 	SessionTypeGroup   uint8 = 1
 
+	kMsgHeaderVersion uint8 = 0x00
+
 	//MsgFlagValues
-	kSourceNodeIdPresent       = 0b00000100
-	kDestinationNodeIdPresent  = 0b00000001
-	kDestinationGroupIdPresent = 0b00000010
-	kDSIZReserved              = 0b00000011
+	kVersionMask               uint8 = 0b11110000
+	kVersionShift                    = 4
+	kSourceNodeIdPresent       uint8 = 0b00000100
+	kDSIZMask                  uint8 = 0b00000011
+	kDestinationNodeIdPresent  uint8 = 0b00000001
+	kDestinationGroupIdPresent uint8 = 0b00000010
+	kDSIZReserved              uint8 = 0b00000011
 
 	//SecFlagValues
-	kPrivacyFlag      = 0b10000000
-	kControlMsgFlag   = 0b01000000
-	kMsgExtensionFlag = 0b00100000
+	kPrivacyFlag      uint8 = 0b10000000
+	kControlMsgFlag   uint8 = 0b01000000
+	kMsgExtensionFlag uint8 = 0b00100000
+	kSessionTypeMask  uint8 = 0b00000011
+
+	// kFixedLengthBytes 固定长度部分：Message Flags, Session ID, Security Flags, Message Counter
+	kFixedLengthBytes = 1 + 2 + 1 + 4
+	kNodeIdSizeBytes  = 8
+	kGroupIdSizeBytes = 2
+
+	// KPrivacyHeaderMinLength 开启Privacy时，被混淆的头部最少需要的长度
+	KPrivacyHeaderMinLength = 4
+	// KMICTagLength AES-CCM 的 MIC 长度
+	KMICTagLength uint16 = 16
+	// KMaxHeaderSize 最大的消息头长度（不包含消息扩展）
+	KMaxHeaderSize = kFixedLengthBytes + kNodeIdSizeBytes + kNodeIdSizeBytes
 )
 
 type PacketHeader interface {
 	GetMessageCounter() uint32
-	GetSourceNodeId() lib.NodeId
-	GetDestinationNodeId() lib.NodeId
-
-	GetDestinationGroupId() lib.GroupId
+	GetSourceNodeId() (lib.NodeId, bool)
+	GetDestinationNodeId() (lib.NodeId, bool)
+	GetDestinationGroupId() (lib.GroupId, bool)
 	GetSessionId() uint16
 
 	GetSessionType() uint8
-	GetMessageFlags()
-	GetSecurityFlags()
+	GetMessageFlags() uint8
+	GetSecurityFlags() uint8
+	GetMessageExtensions() []byte
 	HasPrivacyFlag() bool
 
 	IsGroupSession() bool
@@ -50,172 +68,341 @@ type PacketHeader interface {
 	SetSourceNodeId(lib.NodeId)
 	ClearSourceNodeId()
 	SetDestinationNodeId(id lib.NodeId)
+	ClearDestinationNodeId()
+	SetDestinationGroupId(id lib.GroupId)
 	ClearDestinationGroupId()
+	SetMessageExtensions(data []byte)
 
-	SetSessionType(uint82 uint8)
-	SetSessionId(uint162 uint16)
+	SetSessionType(uint8)
+	SetSessionId(uint16)
 	SetMessageCounter(uint32)
 	SetUnsecured()
-	EncodeSizeBytes()
-	Decode(data []byte) []byte
+	EncodeSizeBytes() int
+	Encode() ([]byte, error)
+	Decode(data []byte) (int, error)
 }
 
+// Header Matter消息的PacketHeader，未加密部分
 type Header struct {
 	mMessageFlags uint8
 	mSecFlags     uint8
 
-	mSourceNodeId       lib.NodeId
-	mDestinationNodeId  lib.NodeId
-	mDestinationGroupId lib.GroupId
+	mSourceNodeId       *lib.NodeId
+	mDestinationNodeId  *lib.NodeId
+	mDestinationGroupId *lib.GroupId
 
-	mSecFlagMask uint8
+	mMessageCounter    uint32
+	mSessionId         uint16
+	mMessageExtensions []byte
+	mLength            int
+}
 
-	mMessageCounter uint32
-	mSessionType    uint8
-	mSessionFlags   uint8
+func NewHeader() *Header {
+	return &Header{}
+}
 
-	mSessionId uint16
-	mLength    uint8
+func (h *Header) GetMessageCounter() uint32 {
+	return h.mMessageCounter
 }
 
-func (h Header) GetMessageCounter() uint32 {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) GetSourceNodeId() (lib.NodeId, bool) {
+	if h.mSourceNodeId == nil {
+		return 0, false
+	}
+	return *h.mSourceNodeId, true
 }
 
-func (h Header) GetSourceNodeId() lib.NodeId {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) GetDestinationNodeId() (lib.NodeId, bool) {
+	if h.mDestinationNodeId == nil {
+		return 0, false
+	}
+	return *h.mDestinationNodeId, true
 }
 
-func (h Header) GetDestinationNodeId() lib.NodeId {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) GetDestinationGroupId() (lib.GroupId, bool) {
+	if h.mDestinationGroupId == nil {
+		return 0, false
+	}
+	return *h.mDestinationGroupId, true
 }
 
-func (h Header) GetDestinationGroupId() lib.GroupId {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) GetSessionId() uint16 {
+	return h.mSessionId
 }
 
-func (h Header) GetSessionId() uint16 {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) GetSessionType() uint8 {
+	return h.mSecFlags & kSessionTypeMask
 }
 
-func (h Header) GetSessionType() uint8 {
-	//TODO implement me
-	panic("implement me")
+// GetMessageFlags 返回根据当前字段计算出的 Message Flags
+func (h *Header) GetMessageFlags() uint8 {
+	flags := kMsgHeaderVersion << kVersionShift
+	if h.mSourceNodeId != nil {
+		flags |= kSourceNodeIdPresent
+	}
+	if h.mDestinationNodeId != nil {
+		flags |= kDestinationNodeIdPresent
+	} else if h.mDestinationGroupId != nil {
+		flags |= kDestinationGroupIdPresent
+	}
+	return flags
 }
 
-func (h Header) GetMessageFlags() {
-	//TODO implement me
-	panic("implement me")
+// GetSecurityFlags 返回根据当前字段计算出的 Security Flags
+func (h *Header) GetSecurityFlags() uint8 {
+	flags := h.mSecFlags &^ kMsgExtensionFlag
+	if len(h.mMessageExtensions) > 0 {
+		flags |= kMsgExtensionFlag
+	}
+	return flags
 }
 
-func (h Header) GetSecurityFlags() {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) GetMessageExtensions() []byte {
+	return h.mMessageExtensions
 }
 
-func (h Header) HasPrivacyFlag() bool {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) HasPrivacyFlag() bool {
+	return h.mSecFlags&kPrivacyFlag != 0
 }
 
-func (h Header) IsGroupSession() bool {
-	return h.mSessionType == SessionTypeGroup
+func (h *Header) IsGroupSession() bool {
+	return h.GetSessionType() == SessionTypeGroup
 }
 
-func (h Header) IsUnicastSession() bool {
-	return h.mSessionType == SessionTypeUnicast
+func (h *Header) IsUnicastSession() bool {
+	return h.GetSessionType() == SessionTypeUnicast
 }
 
-func (h Header) IsSessionTypeValid() bool {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) IsSessionTypeValid() bool {
+	switch h.GetSessionType() {
+	case SessionTypeUnicast:
+		return true
+	case SessionTypeGroup:
+		return true
+	default:
+		return false
+	}
 }
 
-func (h Header) IsValidGroupMsg() bool {
-	//TODO implement me
-	panic("implement me")
+// IsValidGroupMsg 组播消息必须携带源节点ID和目标组ID，设置了控制消息标志的组播消息需要先通过MCSP同步计数
+func (h *Header) IsValidGroupMsg() bool {
+	return h.IsGroupSession() && h.mSourceNodeId != nil && h.mDestinationGroupId != nil
 }
 
-func (h Header) IsValidMCSPMsg() bool {
-	//TODO implement me
-	panic("implement me")
+// IsValidMCSPMsg 消息计数同步协议（MCSP）消息必须携带源节点ID和目标节点ID，并设置控制消息标志
+func (h *Header) IsValidMCSPMsg() bool {
+	return h.mSourceNodeId != nil && h.mDestinationNodeId != nil && h.IsSecureSessionControlMsg()
 }
 
-func (h Header) IsEncrypted() bool {
+func (h *Header) IsEncrypted() bool {
 	return !(h.mSessionId == kMsgUnicastSessionIdUnsecured && h.IsUnicastSession())
 }
 
-func (h Header) MICTagLength() uint16 {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) MICTagLength() uint16 {
+	if h.IsEncrypted() {
+		return KMICTagLength
+	}
+	return 0
+}
+
+func (h *Header) IsSecureSessionControlMsg() bool {
+	return h.mSecFlags&kControlMsgFlag != 0
+}
+
+func (h *Header) SetSecureSessionControlMsg(value bool) {
+	if value {
+		h.mSecFlags |= kControlMsgFlag
+	} else {
+		h.mSecFlags &^= kControlMsgFlag
+	}
+}
+
+func (h *Header) SetPrivacyFlag(value bool) {
+	if value {
+		h.mSecFlags |= kPrivacyFlag
+	} else {
+		h.mSecFlags &^= kPrivacyFlag
+	}
 }
 
-func (h Header) IsSecureSessionControlMsg() bool {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) SetSourceNodeId(id lib.NodeId) {
+	h.mSourceNodeId = &id
 }
 
-func (h Header) SetSecureSessionControlMsg(value bool) {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) ClearSourceNodeId() {
+	h.mSourceNodeId = nil
 }
 
-func (h Header) SetSourceNodeId(id lib.NodeId) {
-	//TODO implement me
-	panic("implement me")
+// SetDestinationNodeId 设置目标节点ID，目标节点与目标组是互斥的（DSIZ）
+func (h *Header) SetDestinationNodeId(id lib.NodeId) {
+	h.mDestinationNodeId = &id
+	h.mDestinationGroupId = nil
 }
 
-func (h Header) ClearSourceNodeId() {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) ClearDestinationNodeId() {
+	h.mDestinationNodeId = nil
 }
 
-func (h Header) SetDestinationNodeId(id lib.NodeId) {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) SetDestinationGroupId(id lib.GroupId) {
+	h.mDestinationGroupId = &id
+	h.mDestinationNodeId = nil
 }
 
-func (h Header) ClearDestinationGroupId() {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) ClearDestinationGroupId() {
+	h.mDestinationGroupId = nil
 }
 
-func (h Header) SetSessionType(uint82 uint8) {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) SetMessageExtensions(data []byte) {
+	h.mMessageExtensions = data
 }
 
-func (h Header) SetSessionId(uint162 uint16) {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) SetSessionType(sessionType uint8) {
+	h.mSecFlags = (h.mSecFlags &^ kSessionTypeMask) | (sessionType & kSessionTypeMask)
 }
 
-func (h Header) SetMessageCounter(u uint32) {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) SetSessionId(id uint16) {
+	h.mSessionId = id
 }
 
-func (h Header) SetUnsecured() {
-	//TODO implement me
-	panic("implement me")
+func (h *Header) SetMessageCounter(u uint32) {
+	h.mMessageCounter = u
+}
+
+func (h *Header) SetUnsecured() {
+	h.mSessionId = kMsgUnicastSessionIdUnsecured
+	h.SetSessionType(SessionTypeUnicast)
+}
+
+// EncodeSizeBytes 返回编码后的消息头长度
+func (h *Header) EncodeSizeBytes() int {
+	size := kFixedLengthBytes
+	if h.mSourceNodeId != nil {
+		size += kNodeIdSizeBytes
+	}
+	if h.mDestinationNodeId != nil {
+		size += kNodeIdSizeBytes
+	} else if h.mDestinationGroupId != nil {
+		size += kGroupIdSizeBytes
+	}
+	if len(h.mMessageExtensions) > 0 {
+		size += 2 + len(h.mMessageExtensions)
+	}
+	return size
 }
 
-func (h Header) EncodeSizeBytes() {
-	//TODO implement me
-	panic("implement me")
+// Encode 将消息头编码为字节
+func (h *Header) Encode() ([]byte, error) {
+	if !h.IsSessionTypeValid() {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	if len(h.mMessageExtensions) > 0xFFFF {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	data := make([]byte, h.EncodeSizeBytes())
+	data[0] = h.GetMessageFlags()
+	binary.LittleEndian.PutUint16(data[1:3], h.mSessionId)
+	data[3] = h.GetSecurityFlags()
+	binary.LittleEndian.PutUint32(data[4:8], h.mMessageCounter)
+	offset := kFixedLengthBytes
+	if h.mSourceNodeId != nil {
+		binary.LittleEndian.PutUint64(data[offset:], uint64(*h.mSourceNodeId))
+		offset += kNodeIdSizeBytes
+	}
+	if h.mDestinationNodeId != nil {
+		binary.LittleEndian.PutUint64(data[offset:], uint64(*h.mDestinationNodeId))
+		offset += kNodeIdSizeBytes
+	} else if h.mDestinationGroupId != nil {
+		binary.LittleEndian.PutUint16(data[offset:], uint16(*h.mDestinationGroupId))
+		offset += kGroupIdSizeBytes
+	}
+	if len(h.mMessageExtensions) > 0 {
+		binary.LittleEndian.PutUint16(data[offset:], uint16(len(h.mMessageExtensions)))
+		offset += 2
+		offset += copy(data[offset:], h.mMessageExtensions)
+	}
+	h.mMessageFlags = data[0]
+	h.mSecFlags = data[3]
+	h.mLength = offset
+	return data, nil
 }
 
-func (h Header) Decode(data []byte) []byte {
-	//TODO implement me
-	panic("implement me")
+// Decode 从data中解码消息头，返回消息头所占的字节数
+func (h *Header) Decode(data []byte) (int, error) {
+	if len(data) < kFixedLengthBytes {
+		return 0, internal.ChipErrorInvalidArgument
+	}
+	messageFlags := data[0]
+	if (messageFlags&kVersionMask)>>kVersionShift != kMsgHeaderVersion {
+		return 0, internal.ChipErrorVersionMismatch
+	}
+	sessionId := binary.LittleEndian.Uint16(data[1:3])
+	secFlags := data[3]
+	messageCounter := binary.LittleEndian.Uint32(data[4:8])
+	offset := kFixedLengthBytes
+
+	var sourceNodeId *lib.NodeId
+	if messageFlags&kSourceNodeIdPresent != 0 {
+		if len(data) < offset+kNodeIdSizeBytes {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		id := lib.NodeId(binary.LittleEndian.Uint64(data[offset:]))
+		sourceNodeId = &id
+		offset += kNodeIdSizeBytes
+	}
+
+	var destinationNodeId *lib.NodeId
+	var destinationGroupId *lib.GroupId
+	switch messageFlags & kDSIZMask {
+	case kDestinationNodeIdPresent:
+		if len(data) < offset+kNodeIdSizeBytes {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		id := lib.NodeId(binary.LittleEndian.Uint64(data[offset:]))
+		destinationNodeId = &id
+		offset += kNodeIdSizeBytes
+	case kDestinationGroupIdPresent:
+		if len(data) < offset+kGroupIdSizeBytes {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		id := lib.GroupId(binary.LittleEndian.Uint16(data[offset:]))
+		destinationGroupId = &id
+		offset += kGroupIdSizeBytes
+	case kDSIZReserved:
+		return 0, internal.ChipErrorInvalidArgument
+	}
+
+	var extensions []byte
+	if secFlags&kMsgExtensionFlag != 0 {
+		if len(data) < offset+2 {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		length := int(binary.LittleEndian.Uint16(data[offset:]))
+		offset += 2
+		if len(data) < offset+length {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		extensions = make([]byte, length)
+		copy(extensions, data[offset:offset+length])
+		offset += length
+	}
+
+	h.mMessageFlags = messageFlags
+	h.mSecFlags = secFlags
+	h.mSessionId = sessionId
+	h.mMessageCounter = messageCounter
+	h.mSourceNodeId = sourceNodeId
+	h.mDestinationNodeId = destinationNodeId
+	h.mDestinationGroupId = destinationGroupId
+	h.mMessageExtensions = extensions
+	h.mLength = offset
+
+	if !h.IsSessionTypeValid() {
+		return 0, internal.ChipErrorInvalidArgument
+	}
+	return offset, nil
 }
 
-func (h Header) Len() uint8 {
+func (h *Header) Len() int {
 	return h.mLength
 }
 
@@ -223,19 +410,24 @@ func (h Header) Len() uint8 {
  * Header format (little endian):
  *
  * -------- Unencrypted header -----------------------------------------------------
- *[0:1]   8 bit:  | Message Flags: VERSION: 4 bit | S: 1 bit | RESERVED: 1 bit | DSIZ: 2 bit |
- *[1:2]   8 bit:  | Security Flags: P: 1 bit | C: 1 bit | MX: 1 bit | RESERVED: 3 bit | Session Type: 2 bit |
- *[2:4]   16 bit: | Session ID                                                           |
- *[4:8]   32 bit: | Message Counter                                                      |
- *[8:16]  64 bit: | SOURCE_NODE_ID (iff source node flag is set)                         |
- *[16:24] 64 bit: | DEST_NODE_ID (iff destination node flag is set)                      |
+ *  8 bit:  | Message Flags: VERSION: 4 bit | S: 1 bit | RESERVED: 1 bit | DSIZ: 2 bit |
+ * 16 bit:  | Session ID                                                           |
+ *  8 bit:  | Security Flags: P: 1 bit | C: 1 bit | MX: 1 bit | RESERVED: 3 bit | Session Type: 2 bit |
+ * 32 bit:  | Message Counter                                                      |
+ * 64 bit:  | SOURCE_NODE_ID (iff source node flag is set)                         |
+ * 64 bit:  | DEST_NODE_ID (iff DSIZ = 1)                                          |
+ * 16 bit:  | DEST_GROUP_ID (iff DSIZ = 2)                                         |
+ * 16 bit:  | Message Extensions Length (iff MX flag is set)                       |
+ *  <var>:  | Message Extensions (iff MX flag is set)                              |
  * -------- Encrypted header -------------------------------------------------------
  *  8 bit:  | Exchange Flags: RESERVED: 3 bit | V: 1 bit | SX: 1 bit | R: 1 bit | A: 1 bit | I: 1 bit |
  *  8 bit:  | Protocol Opcode                                                      |
  * 16 bit:  | Exchange ID                                                          |
- * 16 bit:  | Protocol ID                                                          |
  * 16 bit:  | Optional Vendor ID                                                   |
+ * 16 bit:  | Protocol ID                                                          |
  * 32 bit:  | Acknowledged Message Counter (if A flag in the Header is set)        |
+ * 16 bit:  | Secured Extensions Length (if SX flag is set)                        |
+ *  <var>:  | Secured Extensions (if SX flag is set)                               |
  * -------- Encrypted Application Data Start ---------------------------------------
  *  <var>:  | Encrypted Data                                                       |
  * -------- Encrypted Application Data End -----------------------------------------
@@ -243,31 +435,12 @@ func (h Header) Len() uint8 {
  *
  **********************************************/
 
+// DecodeHeader 解码消息头
 func DecodeHeader(data []byte) (*Header, error) {
-
-	if len(data) < 36 {
-		return nil, internal.ChipErrorInvalidArgument
-	}
 	header := &Header{}
-	header.mLength = 0
-	header.mMessageFlags = data[0]
-	header.mLength = header.mLength + 1
-
-	header.mSessionFlags = data[1]
-	header.mLength = header.mLength + 1
-
-	header.mSessionId = binary.LittleEndian.Uint16(data[2:4])
-	header.mLength = header.mLength + 2
-
-	header.mMessageCounter = binary.LittleEndian.Uint32(data[4:8])
-	header.mLength = header.mLength + 4
-	if header.mMessageFlags&kSourceNodeIdPresent != 0 {
-		header.mSourceNodeId = lib.NodeId(binary.LittleEndian.Uint64(data[8:16]))
-		header.mLength = header.mLength + 8
-	}
-	if header.mMessageFlags&kDestinationNodeIdPresent != 0 {
-		header.mDestinationNodeId = lib.NodeId(binary.LittleEndian.Uint64(data[8:16]))
-		header.mLength = header.mLength + 8
+	_, err := header.Decode(data)
+	if err != nil {
+		return nil, err
 	}
 	return header, nil
 }
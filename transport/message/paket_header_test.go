@@ -0,0 +1,209 @@
+package message
+
+import (
+	"bytes"
+	"github.com/galenliu/chip/lib"
+	"testing"
+)
+
+type headerTestVector struct {
+	name               string
+	data               []byte
+	sessionId          uint16
+	sessionType        uint8
+	messageCounter     uint32
+	sourceNodeId       *lib.NodeId
+	destinationNodeId  *lib.NodeId
+	destinationGroupId *lib.GroupId
+	control            bool
+	extensions         []byte
+}
+
+func nodeIdPtr(id lib.NodeId) *lib.NodeId {
+	return &id
+}
+
+func groupIdPtr(id lib.GroupId) *lib.GroupId {
+	return &id
+}
+
+// 测试向量参考 Matter Core Specification 4.4 Message Frame Format
+var headerTestVectors = []headerTestVector{
+	{
+		name:           "secure unicast message",
+		data:           []byte{0x00, 0x88, 0x77, 0x00, 0x44, 0x33, 0x22, 0x11},
+		sessionId:      0x7788,
+		sessionType:    SessionTypeUnicast,
+		messageCounter: 0x11223344,
+	},
+	{
+		name:           "non-secure unicast message",
+		data:           []byte{0x04, 0x00, 0x00, 0x00, 0x44, 0x33, 0x22, 0x11, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		sessionId:      0x0000,
+		sessionType:    SessionTypeUnicast,
+		messageCounter: 0x11223344,
+		sourceNodeId:   nodeIdPtr(0x0807060504030201),
+	},
+	{
+		name:               "secure group message",
+		data:               []byte{0x06, 0x88, 0x77, 0x01, 0x44, 0x33, 0x22, 0x11, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0xFF, 0xEE},
+		sessionId:          0x7788,
+		sessionType:        SessionTypeGroup,
+		messageCounter:     0x11223344,
+		sourceNodeId:       nodeIdPtr(0x0807060504030201),
+		destinationGroupId: groupIdPtr(0xEEFF),
+	},
+	{
+		name: "secure MCSP message",
+		data: []byte{0x05, 0x88, 0x77, 0x41, 0x44, 0x33, 0x22, 0x11,
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+			0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18},
+		sessionId:         0x7788,
+		sessionType:       SessionTypeGroup,
+		messageCounter:    0x11223344,
+		sourceNodeId:      nodeIdPtr(0x0807060504030201),
+		destinationNodeId: nodeIdPtr(0x1817161514131211),
+		control:           true,
+	},
+	{
+		name: "secure unicast message with extensions",
+		data: []byte{0x01, 0x34, 0x12, 0x20, 0x01, 0x00, 0x00, 0x00,
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+			0x03, 0x00, 0xAA, 0xBB, 0xCC},
+		sessionId:         0x1234,
+		sessionType:       SessionTypeUnicast,
+		messageCounter:    1,
+		destinationNodeId: nodeIdPtr(0x0807060504030201),
+		extensions:        []byte{0xAA, 0xBB, 0xCC},
+	},
+}
+
+func TestHeaderDecode(t *testing.T) {
+	for _, v := range headerTestVectors {
+		header := NewHeader()
+		n, err := header.Decode(v.data)
+		if err != nil {
+			t.Fatalf("%s: decode failed: %s", v.name, err.Error())
+		}
+		if n != len(v.data) || header.Len() != len(v.data) {
+			t.Errorf("%s: decoded %d bytes, want %d", v.name, n, len(v.data))
+		}
+		if header.GetSessionId() != v.sessionId {
+			t.Errorf("%s: session id %04x, want %04x", v.name, header.GetSessionId(), v.sessionId)
+		}
+		if header.GetSessionType() != v.sessionType {
+			t.Errorf("%s: session type %d, want %d", v.name, header.GetSessionType(), v.sessionType)
+		}
+		if header.GetMessageCounter() != v.messageCounter {
+			t.Errorf("%s: message counter %08x, want %08x", v.name, header.GetMessageCounter(), v.messageCounter)
+		}
+		if header.IsSecureSessionControlMsg() != v.control {
+			t.Errorf("%s: control flag %v, want %v", v.name, header.IsSecureSessionControlMsg(), v.control)
+		}
+		if !bytes.Equal(header.GetMessageExtensions(), v.extensions) {
+			t.Errorf("%s: extensions %x, want %x", v.name, header.GetMessageExtensions(), v.extensions)
+		}
+		checkNodeId(t, v.name+": source node id", header.GetSourceNodeId, v.sourceNodeId)
+		checkNodeId(t, v.name+": destination node id", header.GetDestinationNodeId, v.destinationNodeId)
+		groupId, ok := header.GetDestinationGroupId()
+		if ok != (v.destinationGroupId != nil) || (ok && groupId != *v.destinationGroupId) {
+			t.Errorf("%s: destination group id mismatch", v.name)
+		}
+	}
+}
+
+func TestHeaderEncode(t *testing.T) {
+	for _, v := range headerTestVectors {
+		header := NewHeader()
+		header.SetSessionId(v.sessionId)
+		header.SetSessionType(v.sessionType)
+		header.SetMessageCounter(v.messageCounter)
+		header.SetSecureSessionControlMsg(v.control)
+		header.SetMessageExtensions(v.extensions)
+		if v.sourceNodeId != nil {
+			header.SetSourceNodeId(*v.sourceNodeId)
+		}
+		if v.destinationNodeId != nil {
+			header.SetDestinationNodeId(*v.destinationNodeId)
+		}
+		if v.destinationGroupId != nil {
+			header.SetDestinationGroupId(*v.destinationGroupId)
+		}
+		if header.EncodeSizeBytes() != len(v.data) {
+			t.Errorf("%s: encode size %d, want %d", v.name, header.EncodeSizeBytes(), len(v.data))
+		}
+		data, err := header.Encode()
+		if err != nil {
+			t.Fatalf("%s: encode failed: %s", v.name, err.Error())
+		}
+		if !bytes.Equal(data, v.data) {
+			t.Errorf("%s: encoded %x, want %x", v.name, data, v.data)
+		}
+	}
+}
+
+func TestHeaderDecodeInvalid(t *testing.T) {
+	invalid := [][]byte{
+		{},
+		{0x00, 0x88, 0x77, 0x00, 0x44, 0x33, 0x22},
+		// 版本号不为0
+		{0x10, 0x88, 0x77, 0x00, 0x44, 0x33, 0x22, 0x11},
+		// DSIZ 为保留值
+		{0x03, 0x88, 0x77, 0x00, 0x44, 0x33, 0x22, 0x11, 0x01, 0x02},
+		// 源节点ID被截断
+		{0x04, 0x00, 0x00, 0x00, 0x44, 0x33, 0x22, 0x11, 0x01, 0x02, 0x03},
+		// 组ID被截断
+		{0x02, 0x88, 0x77, 0x01, 0x44, 0x33, 0x22, 0x11, 0xFF},
+		// 会话类型为保留值
+		{0x00, 0x88, 0x77, 0x02, 0x44, 0x33, 0x22, 0x11},
+		// 消息扩展长度超出
+		{0x00, 0x88, 0x77, 0x20, 0x44, 0x33, 0x22, 0x11, 0x05, 0x00, 0x01},
+	}
+	for i, data := range invalid {
+		if _, err := DecodeHeader(data); err == nil {
+			t.Errorf("vector %d: expected decode error for %x", i, data)
+		}
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	header := NewHeader()
+	header.SetUnsecured()
+	if header.IsEncrypted() || header.MICTagLength() != 0 {
+		t.Errorf("unsecured header must not be encrypted")
+	}
+	header.SetSessionId(1)
+	if !header.IsEncrypted() || header.MICTagLength() != KMICTagLength {
+		t.Errorf("secured header must be encrypted")
+	}
+
+	header.SetSessionType(SessionTypeGroup)
+	header.SetSourceNodeId(1)
+	header.SetDestinationGroupId(2)
+	if !header.IsValidGroupMsg() {
+		t.Errorf("expected a valid group message")
+	}
+	header.SetDestinationNodeId(3)
+	if _, ok := header.GetDestinationGroupId(); ok {
+		t.Errorf("destination node id must clear destination group id")
+	}
+	header.SetSecureSessionControlMsg(true)
+	if !header.IsValidMCSPMsg() || header.IsValidGroupMsg() {
+		t.Errorf("expected a valid MCSP message")
+	}
+	header.ClearSourceNodeId()
+	if header.IsValidMCSPMsg() {
+		t.Errorf("MCSP message requires a source node id")
+	}
+}
+
+func checkNodeId(t *testing.T, name string, get func() (lib.NodeId, bool), want *lib.NodeId) {
+	id, ok := get()
+	if ok != (want != nil) {
+		t.Errorf("%s: present %v, want %v", name, ok, want != nil)
+		return
+	}
+	if ok && id != *want {
+		t.Errorf("%s: %016x, want %016x", name, id, *want)
+	}
+}
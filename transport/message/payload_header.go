@@ -1,6 +1,10 @@
 package message
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+)
 
 const (
 	//ExFlagValues
@@ -13,35 +17,40 @@ const (
 	kExchangeFlagSecuredExtension uint8 = 0b1000
 	/// Set when a vendor id is prepended to the Message Protocol Id field.
 	kExchangeFlagVendorIdPresent uint8 = 0b10000
+
+	// kPayloadHeaderFixedLength Exchange Flags, Protocol Opcode, Exchange ID, Protocol ID
+	kPayloadHeaderFixedLength = 1 + 1 + 2 + 2
+	kVendorIdSizeBytes        = 2
+	kAckMessageCounterBytes   = 4
+
+	// KVendorIdCommon 标准协议使用的厂商ID
+	KVendorIdCommon lib.VendorId = 0x0000
 )
 
+// PayloadHeader Matter消息的ProtocolHeader，加密部分
 type PayloadHeader struct {
 	mExchangeFlags     uint8
 	mExchangeID        uint16
 	mProtocolID        uint16
-	mVendorId          uint16
+	mVendorId          lib.VendorId
 	mAckMessageCounter uint32
-	mLength            uint8
+	mSecuredExtensions []byte
+	mLength            int
 	mProtocolOpcode    uint8
 }
 
-func NewPayloadHeader(data []byte) *PayloadHeader {
+func NewPayloadHeader() *PayloadHeader {
+	return &PayloadHeader{}
+}
 
+// DecodePayloadHeader 解码ProtocolHeader
+func DecodePayloadHeader(data []byte) (*PayloadHeader, error) {
 	header := &PayloadHeader{}
-
-	header.mExchangeFlags = data[0]
-	header.mProtocolOpcode = data[1]
-	header.mExchangeID = binary.LittleEndian.Uint16(data[2:4])
-	header.mProtocolID = binary.LittleEndian.Uint16(data[4:6])
-	header.mLength = 6
-	if header.HaveVendorId() {
-		header.mVendorId = binary.LittleEndian.Uint16(data[header.mLength : header.mLength+2])
-	}
-	if header.IsAckMsg() {
-		header.mVendorId = binary.LittleEndian.Uint16(data[header.mLength : header.mLength+2])
+	_, err := header.Decode(data)
+	if err != nil {
+		return nil, err
 	}
-
-	return header
+	return header, nil
 }
 
 func (header *PayloadHeader) IsInitiator() bool {
@@ -59,3 +68,178 @@ func (header *PayloadHeader) NeedsAck() bool {
 func (header *PayloadHeader) HaveVendorId() bool {
 	return header.mExchangeFlags&kExchangeFlagVendorIdPresent != 0
 }
+
+func (header *PayloadHeader) HaveSecuredExtensions() bool {
+	return header.mExchangeFlags&kExchangeFlagSecuredExtension != 0
+}
+
+func (header *PayloadHeader) GetExchangeFlags() uint8 {
+	return header.mExchangeFlags
+}
+
+func (header *PayloadHeader) GetExchangeId() uint16 {
+	return header.mExchangeID
+}
+
+func (header *PayloadHeader) GetProtocolId() uint16 {
+	return header.mProtocolID
+}
+
+func (header *PayloadHeader) GetVendorId() lib.VendorId {
+	return header.mVendorId
+}
+
+func (header *PayloadHeader) GetMessageType() uint8 {
+	return header.mProtocolOpcode
+}
+
+// GetAckMessageCounter 只有设置了A标志时，返回值才有效
+func (header *PayloadHeader) GetAckMessageCounter() (uint32, bool) {
+	return header.mAckMessageCounter, header.IsAckMsg()
+}
+
+func (header *PayloadHeader) GetSecuredExtensions() []byte {
+	return header.mSecuredExtensions
+}
+
+// HasMessageType 判断消息是否属于指定的协议和操作码
+func (header *PayloadHeader) HasMessageType(vendorId lib.VendorId, protocolId uint16, opcode uint8) bool {
+	return header.mVendorId == vendorId && header.mProtocolID == protocolId && header.mProtocolOpcode == opcode
+}
+
+func (header *PayloadHeader) SetInitiator(initiator bool) {
+	header.setFlag(kExchangeFlagInitiator, initiator)
+}
+
+func (header *PayloadHeader) SetNeedsAck(needsAck bool) {
+	header.setFlag(kExchangeFlagNeedsAck, needsAck)
+}
+
+func (header *PayloadHeader) SetExchangeId(id uint16) {
+	header.mExchangeID = id
+}
+
+func (header *PayloadHeader) SetMessageType(protocolId uint16, opcode uint8) {
+	header.mProtocolID = protocolId
+	header.mProtocolOpcode = opcode
+}
+
+// SetVendorId 厂商ID为 KVendorIdCommon 时不需要在消息中携带
+func (header *PayloadHeader) SetVendorId(id lib.VendorId) {
+	header.mVendorId = id
+	header.setFlag(kExchangeFlagVendorIdPresent, id != KVendorIdCommon)
+}
+
+func (header *PayloadHeader) SetAckMessageCounter(counter uint32) {
+	header.mAckMessageCounter = counter
+	header.setFlag(kExchangeFlagAckMsg, true)
+}
+
+func (header *PayloadHeader) ClearAckMessageCounter() {
+	header.mAckMessageCounter = 0
+	header.setFlag(kExchangeFlagAckMsg, false)
+}
+
+func (header *PayloadHeader) SetSecuredExtensions(data []byte) {
+	header.mSecuredExtensions = data
+	header.setFlag(kExchangeFlagSecuredExtension, len(data) > 0)
+}
+
+func (header *PayloadHeader) EncodeSizeBytes() int {
+	size := kPayloadHeaderFixedLength
+	if header.HaveVendorId() {
+		size += kVendorIdSizeBytes
+	}
+	if header.IsAckMsg() {
+		size += kAckMessageCounterBytes
+	}
+	if header.HaveSecuredExtensions() {
+		size += 2 + len(header.mSecuredExtensions)
+	}
+	return size
+}
+
+// Encode 将ProtocolHeader编码为字节
+func (header *PayloadHeader) Encode() ([]byte, error) {
+	if len(header.mSecuredExtensions) > 0xFFFF {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	data := make([]byte, header.EncodeSizeBytes())
+	data[0] = header.mExchangeFlags
+	data[1] = header.mProtocolOpcode
+	binary.LittleEndian.PutUint16(data[2:4], header.mExchangeID)
+	offset := 4
+	if header.HaveVendorId() {
+		binary.LittleEndian.PutUint16(data[offset:], uint16(header.mVendorId))
+		offset += kVendorIdSizeBytes
+	}
+	binary.LittleEndian.PutUint16(data[offset:], header.mProtocolID)
+	offset += 2
+	if header.IsAckMsg() {
+		binary.LittleEndian.PutUint32(data[offset:], header.mAckMessageCounter)
+		offset += kAckMessageCounterBytes
+	}
+	if header.HaveSecuredExtensions() {
+		binary.LittleEndian.PutUint16(data[offset:], uint16(len(header.mSecuredExtensions)))
+		offset += 2
+		offset += copy(data[offset:], header.mSecuredExtensions)
+	}
+	header.mLength = offset
+	return data, nil
+}
+
+// Decode 从data中解码ProtocolHeader，返回所占的字节数
+func (header *PayloadHeader) Decode(data []byte) (int, error) {
+	if len(data) < kPayloadHeaderFixedLength {
+		return 0, internal.ChipErrorInvalidArgument
+	}
+	result := PayloadHeader{}
+	result.mExchangeFlags = data[0]
+	result.mProtocolOpcode = data[1]
+	result.mExchangeID = binary.LittleEndian.Uint16(data[2:4])
+	offset := 4
+	if result.HaveVendorId() {
+		if len(data) < offset+kVendorIdSizeBytes+2 {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		result.mVendorId = lib.VendorId(binary.LittleEndian.Uint16(data[offset:]))
+		offset += kVendorIdSizeBytes
+	}
+	result.mProtocolID = binary.LittleEndian.Uint16(data[offset:])
+	offset += 2
+	if result.IsAckMsg() {
+		if len(data) < offset+kAckMessageCounterBytes {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		result.mAckMessageCounter = binary.LittleEndian.Uint32(data[offset:])
+		offset += kAckMessageCounterBytes
+	}
+	if result.HaveSecuredExtensions() {
+		if len(data) < offset+2 {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		length := int(binary.LittleEndian.Uint16(data[offset:]))
+		offset += 2
+		if len(data) < offset+length {
+			return 0, internal.ChipErrorInvalidArgument
+		}
+		result.mSecuredExtensions = make([]byte, length)
+		copy(result.mSecuredExtensions, data[offset:offset+length])
+		offset += length
+	}
+	result.mLength = offset
+	*header = result
+	return offset, nil
+}
+
+func (header *PayloadHeader) Len() int {
+	return header.mLength
+}
+
+func (header *PayloadHeader) setFlag(flag uint8, value bool) {
+	if value {
+		header.mExchangeFlags |= flag
+	} else {
+		header.mExchangeFlags &^= flag
+	}
+}
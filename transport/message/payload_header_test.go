@@ -0,0 +1,101 @@
+package message
+
+import (
+	"bytes"
+	"github.com/galenliu/chip/lib"
+	"testing"
+)
+
+func TestPayloadHeaderDecode(t *testing.T) {
+	// Secure Channel 协议的 StandaloneAck，携带 Ack 计数并要求对端回复确认
+	data := []byte{0x07, 0x10, 0x34, 0x12, 0x00, 0x00, 0x78, 0x56, 0x34, 0x12, 0xDE, 0xAD}
+	header, err := DecodePayloadHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Len() != 10 {
+		t.Errorf("decoded length %d, want 10", header.Len())
+	}
+	if !header.IsInitiator() || !header.NeedsAck() || !header.IsAckMsg() || header.HaveVendorId() {
+		t.Errorf("unexpected exchange flags %02x", header.GetExchangeFlags())
+	}
+	if header.GetExchangeId() != 0x1234 || header.GetProtocolId() != 0x0000 || header.GetMessageType() != 0x10 {
+		t.Errorf("unexpected exchange %04x protocol %04x opcode %02x",
+			header.GetExchangeId(), header.GetProtocolId(), header.GetMessageType())
+	}
+	if counter, ok := header.GetAckMessageCounter(); !ok || counter != 0x12345678 {
+		t.Errorf("unexpected ack counter %08x", counter)
+	}
+}
+
+func TestPayloadHeaderVendorId(t *testing.T) {
+	data := []byte{0x10, 0x02, 0x01, 0x00, 0xF1, 0xFF, 0x05, 0x00}
+	header, err := DecodePayloadHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.GetVendorId() != 0xFFF1 || header.GetProtocolId() != 0x0005 {
+		t.Errorf("unexpected vendor %04x protocol %04x", header.GetVendorId(), header.GetProtocolId())
+	}
+	if !header.HasMessageType(0xFFF1, 0x0005, 0x02) {
+		t.Errorf("HasMessageType mismatch")
+	}
+}
+
+func TestPayloadHeaderRoundTrip(t *testing.T) {
+	header := NewPayloadHeader()
+	header.SetInitiator(true)
+	header.SetNeedsAck(true)
+	header.SetExchangeId(0xBEEF)
+	header.SetVendorId(lib.VendorId(0xFFF2))
+	header.SetMessageType(0x0001, 0x05)
+	header.SetAckMessageCounter(42)
+	header.SetSecuredExtensions([]byte{0x01, 0x02})
+
+	data, err := header.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x1F, 0x05, 0xEF, 0xBE, 0xF2, 0xFF, 0x01, 0x00, 0x2A, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01, 0x02}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("encoded %x, want %x", data, want)
+	}
+
+	decoded := NewPayloadHeader()
+	n, err := decoded.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Errorf("decoded %d bytes, want %d", n, len(data))
+	}
+	if decoded.GetExchangeFlags() != header.GetExchangeFlags() || decoded.GetExchangeId() != header.GetExchangeId() ||
+		decoded.GetVendorId() != header.GetVendorId() || decoded.GetProtocolId() != header.GetProtocolId() ||
+		decoded.GetMessageType() != header.GetMessageType() ||
+		!bytes.Equal(decoded.GetSecuredExtensions(), header.GetSecuredExtensions()) {
+		t.Errorf("round trip mismatch")
+	}
+	if counter, ok := decoded.GetAckMessageCounter(); !ok || counter != 42 {
+		t.Errorf("unexpected ack counter %d", counter)
+	}
+	header.ClearAckMessageCounter()
+	header.SetVendorId(KVendorIdCommon)
+	header.SetSecuredExtensions(nil)
+	if header.EncodeSizeBytes() != kPayloadHeaderFixedLength {
+		t.Errorf("encode size %d, want %d", header.EncodeSizeBytes(), kPayloadHeaderFixedLength)
+	}
+}
+
+func TestPayloadHeaderDecodeInvalid(t *testing.T) {
+	invalid := [][]byte{
+		{0x00, 0x01, 0x02},
+		{0x10, 0x01, 0x02, 0x00, 0xF1, 0xFF},
+		{0x02, 0x01, 0x02, 0x00, 0x00, 0x00, 0x01},
+		{0x08, 0x01, 0x02, 0x00, 0x00, 0x00, 0x04, 0x00, 0x01},
+	}
+	for i, data := range invalid {
+		if _, err := DecodePayloadHeader(data); err == nil {
+			t.Errorf("vector %d: expected decode error for %x", i, data)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/storage"
+	"sync"
+)
+
+// KGroupCounterEpoch 组消息计数每次持久化时预留的增量，重启后从持久化的值继续，不会重复使用计数
+const KGroupCounterEpoch uint32 = 1000
+
+// kMessageCounterRandomInitMask 本地消息计数的初始值为 [1, 2^28] 范围内的随机数
+const kMessageCounterRandomInitMask uint32 = 0x0FFFFFFF
+
+// MessageCounter 本地发送消息使用的计数
+type MessageCounter interface {
+	// AdvanceAndConsume 返回当前的计数并前进
+	AdvanceAndConsume() (uint32, error)
+}
+
+// GlobalUnencryptedMessageCounter 所有未加密消息共享的计数，初始值随机，不需要持久化
+type GlobalUnencryptedMessageCounter struct {
+	mMutex sync.Mutex
+	mValue uint32
+}
+
+func NewGlobalUnencryptedMessageCounter() *GlobalUnencryptedMessageCounter {
+	return &GlobalUnencryptedMessageCounter{mValue: randomMessageCounter()}
+}
+
+// AdvanceAndConsume 未加密消息的计数允许回绕
+func (c *GlobalUnencryptedMessageCounter) AdvanceAndConsume() (uint32, error) {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	value := c.mValue
+	c.mValue++
+	return value, nil
+}
+
+// LocalSessionMessageCounter 安全会话的本地计数，初始值为 [1, 2^28] 内的随机数，用尽后会话必须重新建立
+type LocalSessionMessageCounter struct {
+	mMutex sync.Mutex
+	mValue uint32
+}
+
+func NewLocalSessionMessageCounter() *LocalSessionMessageCounter {
+	return &LocalSessionMessageCounter{mValue: randomMessageCounter()}
+}
+
+func (c *LocalSessionMessageCounter) AdvanceAndConsume() (uint32, error) {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	if c.mValue == 0 {
+		return 0, internal.ChipErrorMessageCounterExhausted
+	}
+	value := c.mValue
+	c.mValue++
+	return value, nil
+}
+
+// PersistedMessageCounter 持久化的全局计数，每 KGroupCounterEpoch 个计数写一次存储
+type PersistedMessageCounter struct {
+	mMutex   sync.Mutex
+	mStorage storage.PersistentStorageDelegate
+	mKey     string
+	mValue   uint32
+	mLimit   uint32
+}
+
+// Init 从存储中恢复计数，没有保存的值时使用随机的初始值
+func (c *PersistedMessageCounter) Init(storageDelegate storage.PersistentStorageDelegate, key string) error {
+	if storageDelegate == nil || key == "" {
+		return internal.ChipErrorInvalidArgument
+	}
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	c.mStorage = storageDelegate
+	c.mKey = key
+	if storageDelegate.HasValue(key) {
+		value, err := storageDelegate.ReadValueUint32(key)
+		if err != nil {
+			return err
+		}
+		c.mValue = value
+	} else {
+		c.mValue = randomMessageCounter()
+	}
+	return c.persistNextEpoch()
+}
+
+func (c *PersistedMessageCounter) Value() uint32 {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	return c.mValue
+}
+
+// AdvanceAndConsume 组消息的计数允许回绕，到达持久化的上限之前先写入下一个上限
+func (c *PersistedMessageCounter) AdvanceAndConsume() (uint32, error) {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	if c.mStorage == nil {
+		return 0, internal.ChipErrorIncorrectState
+	}
+	if c.mValue == c.mLimit {
+		if err := c.persistNextEpoch(); err != nil {
+			return 0, err
+		}
+	}
+	value := c.mValue
+	c.mValue++
+	return value, nil
+}
+
+func (c *PersistedMessageCounter) persistNextEpoch() error {
+	limit := c.mValue + KGroupCounterEpoch
+	if err := c.mStorage.WriteValueUint32(c.mKey, limit); err != nil {
+		return err
+	}
+	c.mLimit = limit
+	return nil
+}
+
+// GroupOutgoingCounters 发送组消息使用的全局计数，数据消息和控制消息分别计数
+type GroupOutgoingCounters struct {
+	mDataCounter    PersistedMessageCounter
+	mControlCounter PersistedMessageCounter
+}
+
+func NewGroupOutgoingCounters() *GroupOutgoingCounters {
+	return &GroupOutgoingCounters{}
+}
+
+func (c *GroupOutgoingCounters) Init(storageDelegate storage.PersistentStorageDelegate) error {
+	if err := c.mDataCounter.Init(storageDelegate, storage.GroupDataCounterKey()); err != nil {
+		return err
+	}
+	return c.mControlCounter.Init(storageDelegate, storage.GroupControlCounterKey())
+}
+
+func (c *GroupOutgoingCounters) GetCounter(isControl bool) uint32 {
+	if isControl {
+		return c.mControlCounter.Value()
+	}
+	return c.mDataCounter.Value()
+}
+
+func (c *GroupOutgoingCounters) AdvanceAndConsume(isControl bool) (uint32, error) {
+	if isControl {
+		return c.mControlCounter.AdvanceAndConsume()
+	}
+	return c.mDataCounter.AdvanceAndConsume()
+}
+
+func randomMessageCounter() uint32 {
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 1
+	}
+	return (binary.LittleEndian.Uint32(buf[:]) & kMessageCounterRandomInitMask) + 1
+}
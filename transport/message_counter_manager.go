@@ -0,0 +1,157 @@
+package transport
+
+import (
+	"crypto/rand"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/storage"
+	"sync"
+	"time"
+)
+
+const (
+	// KMessageCounterSyncTimeout 等待MCSP响应的时间，超时后重新发起同步
+	KMessageCounterSyncTimeout = 500 * time.Millisecond
+	// KMaxPendingGroupMessages 等待计数同步的组控制消息的最大数量
+	KMaxPendingGroupMessages = 8
+
+	kProtocolSecureChannel uint16 = 0x0000
+	kMsgCounterSyncReq     uint8  = 0x00
+	kMsgCounterSyncRsp     uint8  = 0x01
+
+	// kMsgCounterSyncRspLength Synchronized Counter(4) | Response(8)
+	kMsgCounterSyncRspLength = 4 + KMessageCounterSyncChallengeLength
+)
+
+// pendingGroupMessage 等待计数同步完成后再处理的组控制消息
+type pendingGroupMessage struct {
+	mFabricIndex lib.FabricIndex
+	mNodeId      lib.NodeId
+	mPeerAddress PeerAddress
+	mData        []byte
+}
+
+// MessageCounterManager 管理组消息对端计数，对未同步的组控制消息发起消息计数同步（MCSP）
+type MessageCounterManager struct {
+	mMutex   sync.Mutex
+	mPeers   *GroupPeerTable
+	mPending []pendingGroupMessage
+	mNow     func() time.Time
+}
+
+func NewMessageCounterManager() *MessageCounterManager {
+	return &MessageCounterManager{
+		mPeers: NewGroupPeerTable(KMaxGroupPeersPerFabric),
+		mNow:   time.Now,
+	}
+}
+
+// Init 恢复持久化的组消息对端计数
+func (m *MessageCounterManager) Init(storageDelegate storage.PersistentStorageDelegate) error {
+	return m.mPeers.Init(storageDelegate)
+}
+
+func (m *MessageCounterManager) GetGroupPeerTable() *GroupPeerTable {
+	return m.mPeers
+}
+
+// VerifyGroupMessage 检查并提交组消息的计数，数据消息在未同步时信任第一个计数，
+// 控制消息在未同步时返回 ChipErrorIncorrectState，需要先调用 QueueAndStartSync
+func (m *MessageCounterManager) VerifyGroupMessage(fabricIndex lib.FabricIndex, nodeId lib.NodeId, isControl bool, counter uint32) error {
+	return m.mPeers.WithPeerCounter(fabricIndex, nodeId, isControl, func(peerCounter *PeerMessageCounter) error {
+		var err error
+		if isControl {
+			err = peerCounter.VerifyGroup(counter)
+		} else {
+			err = peerCounter.VerifyOrTrustFirstGroup(counter)
+		}
+		if err != nil {
+			return err
+		}
+		peerCounter.CommitGroup(counter)
+		return nil
+	})
+}
+
+// QueueAndStartSync 保存未同步的组控制消息，需要发送同步请求时返回新的Challenge
+func (m *MessageCounterManager) QueueAndStartSync(fabricIndex lib.FabricIndex, nodeId lib.NodeId, peerAddress PeerAddress, data []byte) (challenge [KMessageCounterSyncChallengeLength]byte, startSync bool, err error) {
+	m.mMutex.Lock()
+	defer m.mMutex.Unlock()
+	if len(m.mPending) >= KMaxPendingGroupMessages {
+		return challenge, false, internal.ChipErrorNoMemory
+	}
+	err = m.mPeers.WithPeerCounter(fabricIndex, nodeId, true, func(peerCounter *PeerMessageCounter) error {
+		if peerCounter.IsSynchronized() {
+			return internal.ChipErrorIncorrectState
+		}
+		if peerCounter.IsSynchronizing() && m.mNow().Sub(peerCounter.SyncStartTime()) < KMessageCounterSyncTimeout {
+			return nil
+		}
+		if _, err := rand.Read(challenge[:]); err != nil {
+			return err
+		}
+		peerCounter.StartSync(challenge, m.mNow())
+		startSync = true
+		return nil
+	})
+	if err != nil {
+		return challenge, false, err
+	}
+	if startSync {
+		// 重新发起同步时丢弃之前等待的消息
+		m.removePending(fabricIndex, nodeId)
+	}
+	m.mPending = append(m.mPending, pendingGroupMessage{
+		mFabricIndex: fabricIndex,
+		mNodeId:      nodeId,
+		mPeerAddress: peerAddress,
+		mData:        append([]byte(nil), data...),
+	})
+	return challenge, startSync, nil
+}
+
+// OnSyncResponse 校验响应中的Challenge并同步对端的控制消息计数，返回等待同步的消息
+func (m *MessageCounterManager) OnSyncResponse(fabricIndex lib.FabricIndex, nodeId lib.NodeId, syncCounter uint32, response []byte) ([]pendingGroupMessage, error) {
+	m.mMutex.Lock()
+	defer m.mMutex.Unlock()
+	err := m.mPeers.WithPeerCounter(fabricIndex, nodeId, true, func(peerCounter *PeerMessageCounter) error {
+		challenge, inProgress := peerCounter.GetSyncChallenge()
+		if !inProgress || string(challenge[:]) != string(response) {
+			return internal.ChipErrorInvalidArgument
+		}
+		peerCounter.SetCounter(syncCounter)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.removePending(fabricIndex, nodeId), nil
+}
+
+func (m *MessageCounterManager) removePending(fabricIndex lib.FabricIndex, nodeId lib.NodeId) []pendingGroupMessage {
+	var removed []pendingGroupMessage
+	remaining := m.mPending[:0]
+	for _, pending := range m.mPending {
+		if pending.mFabricIndex == fabricIndex && pending.mNodeId == nodeId {
+			removed = append(removed, pending)
+		} else {
+			remaining = append(remaining, pending)
+		}
+	}
+	m.mPending = remaining
+	return removed
+}
+
+// RemoveFabric 移除某个Fabric的对端计数（包括持久化的计数）和等待同步的消息
+func (m *MessageCounterManager) RemoveFabric(fabricIndex lib.FabricIndex) {
+	m.mMutex.Lock()
+	defer m.mMutex.Unlock()
+	m.mPeers.RemoveFabric(fabricIndex)
+	remaining := m.mPending[:0]
+	for _, pending := range m.mPending {
+		if pending.mFabricIndex != fabricIndex {
+			remaining = append(remaining, pending)
+		}
+	}
+	m.mPending = remaining
+}
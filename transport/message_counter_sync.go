@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/transport/message"
+	log "github.com/sirupsen/logrus"
+)
+
+// startMessageCounterSync 保存未同步的组控制消息，必要时向发送者发送 MsgCounterSyncReq
+func (s *SessionManagerImpl) startMessageCounterSync(key *GroupSessionKey, sessionId uint16, peerNodeId lib.NodeId, peer PeerAddress, data []byte) {
+	challenge, startSync, err := s.mMessageCounterManager.QueueAndStartSync(key.FabricIndex, peerNodeId, peer, data)
+	if err != nil {
+		log.Infof("SessionManager failed to queue group control message from node %d: %s", peerNodeId, err.Error())
+		return
+	}
+	if !startSync {
+		return
+	}
+	var exchangeId [2]byte
+	if _, err := rand.Read(exchangeId[:]); err != nil {
+		log.Infof("SessionManager failed to generate exchange id: %s", err.Error())
+		return
+	}
+	err = s.sendMessageCounterSyncMessage(key, sessionId, peerNodeId, peer, kMsgCounterSyncReq,
+		binary.LittleEndian.Uint16(exchangeId[:]), true, func(uint32) []byte { return challenge[:] })
+	if err != nil {
+		log.Infof("SessionManager failed to send MsgCounterSyncReq to node %d: %s", peerNodeId, err.Error())
+	}
+}
+
+// sendMessageCounterSyncMessage 使用组秘钥向某个节点发送MCSP消息，payload 根据消息计数生成
+func (s *SessionManagerImpl) sendMessageCounterSyncMessage(key *GroupSessionKey, sessionId uint16, peerNodeId lib.NodeId, peer PeerAddress,
+	opcode uint8, exchangeId uint16, initiator bool, payload func(counter uint32) []byte) error {
+	localNodeId, ok := s.mLocalNodeIdLookup(key.FabricIndex)
+	if !ok {
+		return internal.ChipErrorKeyNotFound
+	}
+	s.mMutex.RLock()
+	transports := s.mTransports
+	s.mMutex.RUnlock()
+	if transports == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	counter, err := s.mGroupCounters.AdvanceAndConsume(true)
+	if err != nil {
+		return err
+	}
+
+	packetHeader := message.NewHeader()
+	packetHeader.SetSessionType(message.SessionTypeGroup)
+	packetHeader.SetSessionId(sessionId)
+	packetHeader.SetSecureSessionControlMsg(true)
+	packetHeader.SetSourceNodeId(localNodeId)
+	packetHeader.SetDestinationNodeId(peerNodeId)
+	packetHeader.SetMessageCounter(counter)
+
+	payloadHeader := message.NewPayloadHeader()
+	payloadHeader.SetMessageType(kProtocolSecureChannel, opcode)
+	payloadHeader.SetExchangeId(exchangeId)
+	payloadHeader.SetInitiator(initiator)
+	plaintext, err := payloadHeader.Encode()
+	if err != nil {
+		return err
+	}
+	plaintext = append(plaintext, payload(counter)...)
+
+	data, err := sealMessage(packetHeader, key.Key, localNodeId, plaintext)
+	if err != nil {
+		return err
+	}
+	return transports.SendMessage(peer, data)
+}
+
+// messageCounterSyncDispatch 处理使用组秘钥加密、发送给本节点的MCSP消息
+func (s *SessionManagerImpl) messageCounterSyncDispatch(packetHeader *message.Header, headerBytes []byte, peer PeerAddress, payload []byte) {
+	s.mMutex.RLock()
+	provider := s.mGroupKeyProvider
+	s.mMutex.RUnlock()
+	if provider == nil {
+		log.Infof("SessionManager dropping MCSP message: no group key provider")
+		return
+	}
+	sourceNodeId, _ := packetHeader.GetSourceNodeId()
+	destinationNodeId, _ := packetHeader.GetDestinationNodeId()
+	matched, plaintext := decryptGroupMessage(provider, packetHeader, headerBytes, payload, func(key GroupSessionKey) bool {
+		localNodeId, ok := s.mLocalNodeIdLookup(key.FabricIndex)
+		return ok && localNodeId == destinationNodeId
+	})
+	if matched == nil {
+		log.Infof("SessionManager failed to decrypt MCSP message from node %d", sourceNodeId)
+		return
+	}
+	payloadHeader, err := message.DecodePayloadHeader(plaintext)
+	if err != nil || payloadHeader.GetProtocolId() != kProtocolSecureChannel {
+		log.Infof("SessionManager dropping invalid MCSP message from node %d", sourceNodeId)
+		return
+	}
+	body := plaintext[payloadHeader.Len():]
+
+	switch payloadHeader.GetMessageType() {
+	case kMsgCounterSyncReq:
+		if len(body) != KMessageCounterSyncChallengeLength {
+			log.Infof("SessionManager dropping MsgCounterSyncReq with invalid length %d", len(body))
+			return
+		}
+		challenge := append([]byte(nil), body...)
+		err = s.sendMessageCounterSyncMessage(matched, packetHeader.GetSessionId(), sourceNodeId, peer, kMsgCounterSyncRsp,
+			payloadHeader.GetExchangeId(), false, func(counter uint32) []byte {
+				response := make([]byte, kMsgCounterSyncRspLength)
+				binary.LittleEndian.PutUint32(response, counter)
+				copy(response[4:], challenge)
+				return response
+			})
+		if err != nil {
+			log.Infof("SessionManager failed to send MsgCounterSyncRsp to node %d: %s", sourceNodeId, err.Error())
+		}
+	case kMsgCounterSyncRsp:
+		if len(body) != kMsgCounterSyncRspLength {
+			log.Infof("SessionManager dropping MsgCounterSyncRsp with invalid length %d", len(body))
+			return
+		}
+		syncCounter := binary.LittleEndian.Uint32(body)
+		pending, err := s.mMessageCounterManager.OnSyncResponse(matched.FabricIndex, sourceNodeId, syncCounter, body[4:])
+		if err != nil {
+			log.Infof("SessionManager dropping unexpected MsgCounterSyncRsp from node %d: %s", sourceNodeId, err.Error())
+			return
+		}
+		for _, msg := range pending {
+			s.OnMessageReceived(msg.mPeerAddress, msg.mData)
+		}
+	default:
+		log.Infof("SessionManager dropping unknown MCSP message type %d", payloadHeader.GetMessageType())
+	}
+}
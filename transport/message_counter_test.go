@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/storage"
+	"testing"
+)
+
+func TestPersistedMessageCounter(t *testing.T) {
+	store := storage.NewInMemoryPersistentStorage()
+	var counter PersistedMessageCounter
+	if err := counter.Init(store, storage.GroupDataCounterKey()); err != nil {
+		t.Fatal(err)
+	}
+	start := counter.Value()
+	persisted, err := store.ReadValueUint32(storage.GroupDataCounterKey())
+	if err != nil || persisted != start+KGroupCounterEpoch {
+		t.Fatalf("expected persisted limit %d, got %d (%v)", start+KGroupCounterEpoch, persisted, err)
+	}
+
+	var last uint32
+	for i := uint32(0); i < KGroupCounterEpoch+10; i++ {
+		value, err := counter.AdvanceAndConsume()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != start+i {
+			t.Fatalf("unexpected counter %d, want %d", value, start+i)
+		}
+		last = value
+	}
+	persisted, _ = store.ReadValueUint32(storage.GroupDataCounterKey())
+	if persisted != start+2*KGroupCounterEpoch {
+		t.Errorf("expected the next epoch to be persisted, got %d", persisted)
+	}
+
+	// 重启后的计数不会与之前使用过的重复
+	var restarted PersistedMessageCounter
+	if err := restarted.Init(store, storage.GroupDataCounterKey()); err != nil {
+		t.Fatal(err)
+	}
+	value, err := restarted.AdvanceAndConsume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value <= last {
+		t.Errorf("counter %d after restart must be greater than %d", value, last)
+	}
+}
+
+func TestGroupOutgoingCountersAreIndependent(t *testing.T) {
+	counters := NewGroupOutgoingCounters()
+	if err := counters.Init(storage.NewInMemoryPersistentStorage()); err != nil {
+		t.Fatal(err)
+	}
+	data := counters.GetCounter(false)
+	control := counters.GetCounter(true)
+	if _, err := counters.AdvanceAndConsume(true); err != nil {
+		t.Fatal(err)
+	}
+	if counters.GetCounter(false) != data || counters.GetCounter(true) != control+1 {
+		t.Errorf("data and control counters must advance independently")
+	}
+}
+
+func TestLocalSessionMessageCounterExhausted(t *testing.T) {
+	counter := &LocalSessionMessageCounter{mValue: 0xFFFFFFFF}
+	if value, err := counter.AdvanceAndConsume(); err != nil || value != 0xFFFFFFFF {
+		t.Fatalf("unexpected counter %d (%v)", value, err)
+	}
+	if _, err := counter.AdvanceAndConsume(); err == nil {
+		t.Errorf("exhausted session counter must fail")
+	}
+}
+
+func TestGroupPeerCountersPersisted(t *testing.T) {
+	store := storage.NewInMemoryPersistentStorage()
+	newManager := func() *MessageCounterManager {
+		manager := NewMessageCounterManager()
+		if err := manager.Init(store); err != nil {
+			t.Fatal(err)
+		}
+		return manager
+	}
+	manager := newManager()
+	if err := manager.VerifyGroupMessage(testFabricIndex, testNodeA, false, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.VerifyGroupMessage(2, testNodeA, false, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后已经收到的计数仍然被当作重复消息，窗口内没有收到的计数可以接受
+	restarted := newManager()
+	if err := restarted.VerifyGroupMessage(testFabricIndex, testNodeA, false, 100); err != internal.ChipErrorDuplicateMessageReceived {
+		t.Errorf("replayed group message must be rejected after restart, got %v", err)
+	}
+	if err := restarted.VerifyGroupMessage(testFabricIndex, testNodeA, false, 99); err != nil {
+		t.Errorf("unseen counter in the window must be accepted, got %v", err)
+	}
+	if err := newManager().VerifyGroupMessage(testFabricIndex, testNodeA, false, 99); err != internal.ChipErrorDuplicateMessageReceived {
+		t.Errorf("window must be persisted, got %v", err)
+	}
+	if err := restarted.VerifyGroupMessage(testFabricIndex, testNodeA, true, 5); err != internal.ChipErrorIncorrectState {
+		t.Errorf("control counter must still need synchronization, got %v", err)
+	}
+
+	restarted.RemoveFabric(testFabricIndex)
+	if store.HasValue(storage.FabricGroupPeerCounters(uint8(testFabricIndex))) {
+		t.Errorf("removed fabric counters must be deleted from storage")
+	}
+	restarted = newManager()
+	if err := restarted.VerifyGroupMessage(testFabricIndex, testNodeA, false, 100); err != nil {
+		t.Errorf("counters of a removed fabric must not be restored, got %v", err)
+	}
+	if err := restarted.VerifyGroupMessage(2, testNodeA, false, 7); err != internal.ChipErrorDuplicateMessageReceived {
+		t.Errorf("other fabrics must keep their counters, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Type 对端地址使用的传输类型
+type Type uint8
+
+const (
+	TypeUndefined Type = iota
+	TypeUdp
+	TypeBle
+	TypeTcp
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeUdp:
+		return "UDP"
+	case TypeBle:
+		return "BLE"
+	case TypeTcp:
+		return "TCP"
+	default:
+		return "Undefined"
+	}
+}
+
+// PeerAddress 描述如何到达一个对端：传输类型、IP地址端口以及网络接口
+type PeerAddress struct {
+	mTransportType Type
+	mAddr          netip.AddrPort
+	mInterface     int
+}
+
+func NewUdpPeerAddress(addr netip.AddrPort) PeerAddress {
+	return PeerAddress{mTransportType: TypeUdp, mAddr: addr}
+}
+
+func NewTcpPeerAddress(addr netip.AddrPort) PeerAddress {
+	return PeerAddress{mTransportType: TypeTcp, mAddr: addr}
+}
+
+func NewBlePeerAddress() PeerAddress {
+	return PeerAddress{mTransportType: TypeBle}
+}
+
+// WithInterface 返回使用指定网络接口的地址，用于链路本地地址和组播
+func (p PeerAddress) WithInterface(index int) PeerAddress {
+	p.mInterface = index
+	return p
+}
+
+func (p PeerAddress) GetTransportType() Type {
+	return p.mTransportType
+}
+
+func (p PeerAddress) GetAddrPort() netip.AddrPort {
+	return p.mAddr
+}
+
+func (p PeerAddress) GetIPAddress() netip.Addr {
+	return p.mAddr.Addr()
+}
+
+func (p PeerAddress) GetPort() uint16 {
+	return p.mAddr.Port()
+}
+
+func (p PeerAddress) GetInterface() int {
+	return p.mInterface
+}
+
+func (p PeerAddress) IsInitialized() bool {
+	return p.mTransportType != TypeUndefined
+}
+
+func (p PeerAddress) IsMulticast() bool {
+	return p.mTransportType == TypeUdp && p.mAddr.Addr().IsMulticast()
+}
+
+func (p PeerAddress) String() string {
+	if p.mTransportType == TypeBle || !p.mAddr.IsValid() {
+		return p.mTransportType.String()
+	}
+	return fmt.Sprintf("%s:%s", p.mTransportType.String(), p.mAddr.String())
+}
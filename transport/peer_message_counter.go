@@ -0,0 +1,218 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/internal"
+	"time"
+)
+
+// KMessageCounterWindowSize 重复消息检测窗口的大小
+const KMessageCounterWindowSize = 32
+
+// KMessageCounterSyncChallengeLength MCSP 请求中 Challenge 的长度
+const KMessageCounterSyncChallengeLength = 8
+
+type peerMessageCounterStatus uint8
+
+const (
+	peerMessageCounterNotSynced peerMessageCounterStatus = iota
+	peerMessageCounterSyncInProgress
+	peerMessageCounterSynced
+)
+
+type counterPosition uint8
+
+const (
+	// counterPositionBeyondWindow 比最大计数大，是新消息
+	counterPositionBeyondWindow counterPosition = iota
+	// counterPositionInWindow 在窗口内，需要检查是否已经收到
+	counterPositionInWindow
+	// counterPositionMaxCounter 等于最大计数，是重复消息
+	counterPositionMaxCounter
+	// counterPositionBehindWindow 比窗口还要旧
+	counterPositionBehindWindow
+)
+
+// PeerMessageCounter 记录从对端收到的最大消息计数以及之前 32 个计数的接收情况，用于检测重复消息
+type PeerMessageCounter struct {
+	mStatus     peerMessageCounterStatus
+	mMaxCounter uint32
+	// mWindow 第 i 位表示计数 mMaxCounter-(i+1) 已经收到
+	mWindow uint32
+
+	mSyncChallenge [KMessageCounterSyncChallengeLength]byte
+	mSyncStart     time.Time
+}
+
+func (c *PeerMessageCounter) IsSynchronized() bool {
+	return c.mStatus == peerMessageCounterSynced
+}
+
+func (c *PeerMessageCounter) IsSynchronizing() bool {
+	return c.mStatus == peerMessageCounterSyncInProgress
+}
+
+// Reset 回到未同步的状态
+func (c *PeerMessageCounter) Reset() {
+	*c = PeerMessageCounter{}
+}
+
+// SetCounter 同步对端的计数，之前的计数都视为未收到
+func (c *PeerMessageCounter) SetCounter(counter uint32) {
+	c.mStatus = peerMessageCounterSynced
+	c.mMaxCounter = counter
+	c.mWindow = 0
+	c.mSyncChallenge = [KMessageCounterSyncChallengeLength]byte{}
+}
+
+// GetCounter 返回收到的最大计数
+func (c *PeerMessageCounter) GetCounter() uint32 {
+	return c.mMaxCounter
+}
+
+// restore 恢复持久化的已同步计数和接收窗口
+func (c *PeerMessageCounter) restore(counter uint32, window uint32) {
+	c.SetCounter(counter)
+	c.mWindow = window
+}
+
+// StartSync 开始MCSP同步，保存发送的Challenge
+func (c *PeerMessageCounter) StartSync(challenge [KMessageCounterSyncChallengeLength]byte, now time.Time) {
+	c.mStatus = peerMessageCounterSyncInProgress
+	c.mSyncChallenge = challenge
+	c.mSyncStart = now
+}
+
+// GetSyncChallenge 返回正在进行的同步使用的Challenge
+func (c *PeerMessageCounter) GetSyncChallenge() ([KMessageCounterSyncChallengeLength]byte, bool) {
+	return c.mSyncChallenge, c.mStatus == peerMessageCounterSyncInProgress
+}
+
+// SyncStartTime 返回同步开始的时间
+func (c *PeerMessageCounter) SyncStartTime() time.Time {
+	return c.mSyncStart
+}
+
+// VerifyEncryptedUnicast 检查单播加密消息的计数，单播会话的计数不允许回绕
+func (c *PeerMessageCounter) VerifyEncryptedUnicast(counter uint32) error {
+	if c.mStatus != peerMessageCounterSynced {
+		// 会话建立后信任收到的第一个计数
+		return nil
+	}
+	return c.verifyPosition(c.encryptedUnicastPosition(counter), counter)
+}
+
+// CommitEncryptedUnicast 单播加密消息认证通过之后提交计数
+func (c *PeerMessageCounter) CommitEncryptedUnicast(counter uint32) {
+	if c.mStatus != peerMessageCounterSynced {
+		c.SetCounter(counter)
+		return
+	}
+	c.commitPosition(c.encryptedUnicastPosition(counter), counter)
+}
+
+// VerifyGroup 检查组消息的计数，组消息计数允许回绕，必须先与对端同步
+func (c *PeerMessageCounter) VerifyGroup(counter uint32) error {
+	if c.mStatus != peerMessageCounterSynced {
+		return internal.ChipErrorIncorrectState
+	}
+	return c.verifyPosition(c.rolloverPosition(counter), counter)
+}
+
+// VerifyOrTrustFirstGroup 组数据消息在未同步时信任收到的第一个计数
+func (c *PeerMessageCounter) VerifyOrTrustFirstGroup(counter uint32) error {
+	if c.mStatus != peerMessageCounterSynced {
+		c.SetCounter(counter)
+		return nil
+	}
+	return c.VerifyGroup(counter)
+}
+
+// CommitGroup 组消息认证通过之后提交计数
+func (c *PeerMessageCounter) CommitGroup(counter uint32) {
+	c.commitPosition(c.rolloverPosition(counter), counter)
+}
+
+// VerifyUnencrypted 检查未加密消息的计数，窗口之外的旧计数视为对端重启，重新开始计数
+func (c *PeerMessageCounter) VerifyUnencrypted(counter uint32) error {
+	if c.mStatus != peerMessageCounterSynced {
+		return nil
+	}
+	position := c.rolloverPosition(counter)
+	if position == counterPositionBehindWindow {
+		return nil
+	}
+	return c.verifyPosition(position, counter)
+}
+
+// CommitUnencrypted 提交未加密消息的计数
+func (c *PeerMessageCounter) CommitUnencrypted(counter uint32) {
+	if c.mStatus != peerMessageCounterSynced {
+		c.SetCounter(counter)
+		return
+	}
+	position := c.rolloverPosition(counter)
+	if position == counterPositionBehindWindow {
+		c.SetCounter(counter)
+		return
+	}
+	c.commitPosition(position, counter)
+}
+
+func (c *PeerMessageCounter) encryptedUnicastPosition(counter uint32) counterPosition {
+	switch {
+	case counter > c.mMaxCounter:
+		return counterPositionBeyondWindow
+	case counter == c.mMaxCounter:
+		return counterPositionMaxCounter
+	case c.mMaxCounter-counter > KMessageCounterWindowSize:
+		return counterPositionBehindWindow
+	default:
+		return counterPositionInWindow
+	}
+}
+
+// rolloverPosition 按照模 2^32 比较，与最大计数相差 2^31 以内的较大计数视为新计数
+func (c *PeerMessageCounter) rolloverPosition(counter uint32) counterPosition {
+	delta := counter - c.mMaxCounter
+	switch {
+	case delta == 0:
+		return counterPositionMaxCounter
+	case delta < 1<<31:
+		return counterPositionBeyondWindow
+	case c.mMaxCounter-counter > KMessageCounterWindowSize:
+		return counterPositionBehindWindow
+	default:
+		return counterPositionInWindow
+	}
+}
+
+func (c *PeerMessageCounter) verifyPosition(position counterPosition, counter uint32) error {
+	switch position {
+	case counterPositionBeyondWindow:
+		return nil
+	case counterPositionInWindow:
+		offset := c.mMaxCounter - counter
+		if c.mWindow&(1<<(offset-1)) != 0 {
+			return internal.ChipErrorDuplicateMessageReceived
+		}
+		return nil
+	default:
+		return internal.ChipErrorDuplicateMessageReceived
+	}
+}
+
+func (c *PeerMessageCounter) commitPosition(position counterPosition, counter uint32) {
+	switch position {
+	case counterPositionBeyondWindow:
+		shift := counter - c.mMaxCounter
+		if shift > KMessageCounterWindowSize {
+			c.mWindow = 0
+		} else {
+			c.mWindow = c.mWindow<<shift | 1<<(shift-1)
+		}
+		c.mMaxCounter = counter
+	case counterPositionInWindow:
+		offset := c.mMaxCounter - counter
+		c.mWindow |= 1 << (offset - 1)
+	}
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/internal"
+	"testing"
+)
+
+func TestPeerMessageCounterEncryptedUnicast(t *testing.T) {
+	var counter PeerMessageCounter
+	if err := counter.VerifyEncryptedUnicast(100); err != nil {
+		t.Fatalf("first counter must be trusted: %v", err)
+	}
+	counter.CommitEncryptedUnicast(100)
+
+	for _, c := range []uint32{100, 67, 1} {
+		if err := counter.VerifyEncryptedUnicast(c); err != internal.ChipErrorDuplicateMessageReceived {
+			t.Errorf("counter %d must be rejected", c)
+		}
+	}
+	// 窗口内未收到的计数可以接收一次
+	for _, c := range []uint32{69, 99} {
+		if err := counter.VerifyEncryptedUnicast(c); err != nil {
+			t.Errorf("counter %d inside the window must be accepted", c)
+		}
+		counter.CommitEncryptedUnicast(c)
+		if err := counter.VerifyEncryptedUnicast(c); err == nil {
+			t.Errorf("counter %d must be rejected the second time", c)
+		}
+	}
+
+	// 前进 3 之后，窗口随之移动
+	counter.CommitEncryptedUnicast(103)
+	for c, duplicate := range map[uint32]bool{103: true, 102: false, 101: false, 100: true, 99: true, 98: false, 72: false, 71: false, 70: true} {
+		err := counter.VerifyEncryptedUnicast(c)
+		if duplicate != (err != nil) {
+			t.Errorf("counter %d: duplicate %v, got %v", c, duplicate, err)
+		}
+	}
+
+	// 前进超过窗口大小时清空窗口
+	counter.CommitEncryptedUnicast(200)
+	if err := counter.VerifyEncryptedUnicast(199); err != nil {
+		t.Errorf("counter 199 must be accepted")
+	}
+	if err := counter.VerifyEncryptedUnicast(0xFFFFFFF0); err != nil {
+		t.Errorf("encrypted unicast counters are compared without rollover")
+	}
+}
+
+func TestPeerMessageCounterGroupRollover(t *testing.T) {
+	var counter PeerMessageCounter
+	if err := counter.VerifyGroup(1); err != internal.ChipErrorIncorrectState {
+		t.Errorf("unsynchronized group counter must require synchronization")
+	}
+	if err := counter.VerifyOrTrustFirstGroup(0xFFFFFFFE); err != nil {
+		t.Fatal(err)
+	}
+	counter.CommitGroup(0xFFFFFFFE)
+	if err := counter.VerifyGroup(0xFFFFFFFE); err == nil {
+		t.Errorf("trusted first counter must be committed")
+	}
+	for _, c := range []uint32{0xFFFFFFFF, 0, 1} {
+		if err := counter.VerifyGroup(c); err != nil {
+			t.Errorf("counter %#x must be accepted across rollover", c)
+		}
+		counter.CommitGroup(c)
+	}
+	if counter.GetCounter() != 1 {
+		t.Errorf("unexpected max counter %#x", counter.GetCounter())
+	}
+	for c, duplicate := range map[uint32]bool{0: true, 0xFFFFFFFF: true, 0xFFFFFFFE: true, 0xFFFFFFFD: false, 0xFFFFFFE1: false, 0xFFFFFFE0: true, 0x80000001: true, 0x80000000: false} {
+		err := counter.VerifyGroup(c)
+		if duplicate != (err != nil) {
+			t.Errorf("counter %#x: duplicate %v, got %v", c, duplicate, err)
+		}
+	}
+}
+
+func TestPeerMessageCounterUnencrypted(t *testing.T) {
+	var counter PeerMessageCounter
+	counter.CommitUnencrypted(1000)
+	if err := counter.VerifyUnencrypted(1000); err == nil {
+		t.Errorf("duplicate unencrypted counter must be rejected")
+	}
+	// 窗口之外的旧计数视为对端重启
+	if err := counter.VerifyUnencrypted(10); err != nil {
+		t.Errorf("counter behind the window must be accepted")
+	}
+	counter.CommitUnencrypted(10)
+	if counter.GetCounter() != 10 {
+		t.Errorf("counter must restart from the new value")
+	}
+	if err := counter.VerifyUnencrypted(10); err == nil {
+		t.Errorf("duplicate unencrypted counter must be rejected")
+	}
+}
@@ -0,0 +1,225 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"time"
+)
+
+// SecureSessionType 安全会话的建立方式
+type SecureSessionType uint8
+
+const (
+	SecureSessionTypePASE SecureSessionType = iota + 1
+	SecureSessionTypeCASE
+)
+
+func (t SecureSessionType) String() string {
+	switch t {
+	case SecureSessionTypePASE:
+		return "PASE"
+	case SecureSessionTypeCASE:
+		return "CASE"
+	default:
+		return "unknown"
+	}
+}
+
+type secureSessionState uint8
+
+const (
+	// secureSessionStateEstablishing 已分配了本地会话ID，正在进行会话建立
+	secureSessionStateEstablishing secureSessionState = iota
+	// secureSessionStateActive 会话建立完成，可以收发加密消息
+	secureSessionStateActive
+	// secureSessionStateDefunct 会话已经被移除，不能再使用
+	secureSessionStateDefunct
+)
+
+// SecureSession 通过PASE或者CASE建立的加密单播会话
+type SecureSession struct {
+	sessionBase
+	mSecureSessionType SecureSessionType
+	mState             secureSessionState
+
+	mLocalSessionId uint16
+	mPeerSessionId  uint16
+	mLocalNodeId    lib.NodeId
+	mPeerNodeId     lib.NodeId
+	mPeerCATs       lib.CATValues
+	mFabricIndex    lib.FabricIndex
+
+	mCryptoContext       *CryptoContext
+	mLocalMessageCounter *LocalSessionMessageCounter
+	mPeerMessageCounter  PeerMessageCounter
+}
+
+func newSecureSession(secureSessionType SecureSessionType, localSessionId uint16) *SecureSession {
+	s := &SecureSession{
+		mSecureSessionType:   secureSessionType,
+		mState:               secureSessionStateEstablishing,
+		mLocalSessionId:      localSessionId,
+		mLocalMessageCounter: NewLocalSessionMessageCounter(),
+	}
+	s.mLastActivity = time.Now()
+	return s
+}
+
+// Activate 会话建立完成后设置对端信息和秘钥，peerCATs 为 CASE 对端 NOC 中的 CAT
+func (s *SecureSession) Activate(localNode, peerNode lib.ScopedNodeId, peerCATs lib.CATValues, peerSessionId uint16,
+	cryptoContext *CryptoContext, peerAddress PeerAddress) error {
+	if cryptoContext == nil || localNode.GetFabricIndex() != peerNode.GetFabricIndex() {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	if s.mState != secureSessionStateEstablishing {
+		return internal.ChipErrorIncorrectState
+	}
+	s.mLocalNodeId = localNode.GetNodeId()
+	s.mPeerNodeId = peerNode.GetNodeId()
+	s.mPeerCATs = peerCATs
+	s.mFabricIndex = localNode.GetFabricIndex()
+	s.mPeerSessionId = peerSessionId
+	s.mCryptoContext = cryptoContext
+	s.mPeerAddress = peerAddress
+	s.mLastActivity = time.Now()
+	s.mState = secureSessionStateActive
+	return nil
+}
+
+func (s *SecureSession) GetSessionType() SessionType {
+	return SessionTypeSecure
+}
+
+func (s *SecureSession) GetSecureSessionType() SecureSessionType {
+	return s.mSecureSessionType
+}
+
+func (s *SecureSession) IsPASESession() bool {
+	return s.mSecureSessionType == SecureSessionTypePASE
+}
+
+func (s *SecureSession) IsCASESession() bool {
+	return s.mSecureSessionType == SecureSessionTypeCASE
+}
+
+func (s *SecureSession) GetPeer() lib.ScopedNodeId {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return lib.NewScopedNodeId(s.mPeerNodeId, s.mFabricIndex)
+}
+
+func (s *SecureSession) GetPeerCATs() lib.CATValues {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mPeerCATs
+}
+
+// GetSubjectDescriptor CASE 会话的主体为对端节点和它的 CAT，PASE 会话只用于配对，没有主体
+func (s *SecureSession) GetSubjectDescriptor() access.SubjectDescriptor {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	if s.mState != secureSessionStateActive {
+		return access.SubjectDescriptor{}
+	}
+	if s.mSecureSessionType == SecureSessionTypePASE {
+		return access.SubjectDescriptor{FabricIndex: s.mFabricIndex, AuthMode: access.AuthModePase, IsCommissioning: true}
+	}
+	return access.SubjectDescriptor{
+		FabricIndex: s.mFabricIndex,
+		AuthMode:    access.AuthModeCase,
+		Subject:     s.mPeerNodeId,
+		Cats:        s.mPeerCATs,
+	}
+}
+
+func (s *SecureSession) GetLocalScopedNodeId() lib.ScopedNodeId {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return lib.NewScopedNodeId(s.mLocalNodeId, s.mFabricIndex)
+}
+
+func (s *SecureSession) GetFabricIndex() lib.FabricIndex {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mFabricIndex
+}
+
+// SetFabricIndex PASE会话在添加了NOC之后关联到新的Fabric
+func (s *SecureSession) SetFabricIndex(fabricIndex lib.FabricIndex) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mFabricIndex = fabricIndex
+}
+
+func (s *SecureSession) GetLocalSessionId() uint16 {
+	return s.mLocalSessionId
+}
+
+func (s *SecureSession) GetPeerSessionId() uint16 {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mPeerSessionId
+}
+
+func (s *SecureSession) GetCryptoContext() *CryptoContext {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mCryptoContext
+}
+
+func (s *SecureSession) IsGroupSession() bool {
+	return false
+}
+
+func (s *SecureSession) IsSecureSession() bool {
+	return true
+}
+
+func (s *SecureSession) IsActiveSession() bool {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mState == secureSessionStateActive
+}
+
+func (s *SecureSession) IsEstablishing() bool {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mState == secureSessionStateEstablishing
+}
+
+// nonceNodeId 计算Nonce使用的源节点ID，PASE会话使用未指定的节点ID
+func (s *SecureSession) nonceNodeId(local bool) lib.NodeId {
+	if s.mSecureSessionType == SecureSessionTypePASE {
+		return lib.KUndefinedNodeId
+	}
+	if local {
+		return s.mLocalNodeId
+	}
+	return s.mPeerNodeId
+}
+
+// nextMessageCounter 返回下一条发送消息使用的计数
+func (s *SecureSession) nextMessageCounter() (uint32, error) {
+	return s.mLocalMessageCounter.AdvanceAndConsume()
+}
+
+func (s *SecureSession) verifyPeerMessageCounter(counter uint32) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	return s.mPeerMessageCounter.VerifyEncryptedUnicast(counter)
+}
+
+func (s *SecureSession) commitPeerMessageCounter(counter uint32) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mPeerMessageCounter.CommitEncryptedUnicast(counter)
+}
+
+func (s *SecureSession) markDefunct() {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mState = secureSessionStateDefunct
+}
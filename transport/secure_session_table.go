@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"sync"
+)
+
+// KMaxSecureSessions 同时存在的安全会话的最大数量
+const KMaxSecureSessions = 16
+
+// kUnsecuredSessionId 会话ID 0 保留给未加密的会话
+const kUnsecuredSessionId uint16 = 0
+
+// SecureSessionTable 通过本地会话ID索引的安全会话表
+type SecureSessionTable struct {
+	mMutex         sync.Mutex
+	mSessions      map[uint16]*SecureSession
+	mMaxSessions   int
+	mNextSessionId uint16
+}
+
+func NewSecureSessionTable(maxSessions int) *SecureSessionTable {
+	t := &SecureSessionTable{
+		mSessions:    make(map[uint16]*SecureSession),
+		mMaxSessions: maxSessions,
+	}
+	var buf [2]byte
+	if _, err := rand.Read(buf[:]); err == nil {
+		t.mNextSessionId = binary.LittleEndian.Uint16(buf[:])
+	}
+	if t.mNextSessionId == kUnsecuredSessionId {
+		t.mNextSessionId = 1
+	}
+	return t
+}
+
+// CreateNewSecureSession 分配一个新的会话ID并创建会话，表满时按照 sessionEvictionHint 淘汰一个会话，返回被淘汰的会话
+func (t *SecureSessionTable) CreateNewSecureSession(secureSessionType SecureSessionType, sessionEvictionHint lib.ScopedNodeId) (*SecureSession, *SecureSession, error) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	if t.mMaxSessions <= 0 {
+		return nil, nil, internal.ChipErrorNoMemory
+	}
+	var evicted *SecureSession
+	if len(t.mSessions) >= t.mMaxSessions {
+		evicted = t.evictionCandidate(sessionEvictionHint)
+		delete(t.mSessions, evicted.mLocalSessionId)
+		evicted.markDefunct()
+	}
+	sessionId, err := t.nextSessionId()
+	if err != nil {
+		return nil, evicted, err
+	}
+	session := newSecureSession(secureSessionType, sessionId)
+	t.mSessions[sessionId] = session
+	return session, evicted, nil
+}
+
+func (t *SecureSessionTable) FindSecureSessionByLocalKey(localSessionId uint16) *SecureSession {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	return t.mSessions[localSessionId]
+}
+
+// ForEachSession 遍历所有的会话，返回 false 时停止
+func (t *SecureSessionTable) ForEachSession(fn func(session *SecureSession) bool) {
+	t.mMutex.Lock()
+	sessions := make([]*SecureSession, 0, len(t.mSessions))
+	for _, s := range t.mSessions {
+		sessions = append(sessions, s)
+	}
+	t.mMutex.Unlock()
+	for _, s := range sessions {
+		if !fn(s) {
+			return
+		}
+	}
+}
+
+// ReleaseSession 从表中移除会话
+func (t *SecureSessionTable) ReleaseSession(session *SecureSession) bool {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	if t.mSessions[session.mLocalSessionId] != session {
+		return false
+	}
+	delete(t.mSessions, session.mLocalSessionId)
+	session.markDefunct()
+	return true
+}
+
+func (t *SecureSessionTable) Count() int {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	return len(t.mSessions)
+}
+
+// nextSessionId 从上一次分配的位置开始查找未使用的会话ID，跳过 0
+func (t *SecureSessionTable) nextSessionId() (uint16, error) {
+	candidate := t.mNextSessionId
+	for i := 0; i <= 0xFFFF; i++ {
+		if candidate != kUnsecuredSessionId {
+			if _, used := t.mSessions[candidate]; !used {
+				t.mNextSessionId = candidate + 1
+				if t.mNextSessionId == kUnsecuredSessionId {
+					t.mNextSessionId = 1
+				}
+				return candidate, nil
+			}
+		}
+		candidate++
+	}
+	return 0, internal.ChipErrorNoMemory
+}
+
+// evictionCandidate 优先淘汰同一个对端最久未活动的会话，其次是最久未活动的已建立会话，避免打断正在进行的会话建立
+func (t *SecureSessionTable) evictionCandidate(hint lib.ScopedNodeId) *SecureSession {
+	var samePeer, active, oldest *SecureSession
+	older := func(a, b *SecureSession) bool {
+		return b == nil || a.GetLastActivityTime().Before(b.GetLastActivityTime())
+	}
+	for _, s := range t.mSessions {
+		if s.IsActiveSession() {
+			if s.GetPeer() == hint && older(s, samePeer) {
+				samePeer = s
+			}
+			if older(s, active) {
+				active = s
+			}
+		}
+		if older(s, oldest) {
+			oldest = s
+		}
+	}
+	if samePeer != nil {
+		return samePeer
+	}
+	if active != nil {
+		return active
+	}
+	return oldest
+}
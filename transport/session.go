@@ -0,0 +1,121 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/transport/message"
+	"sync"
+	"time"
+)
+
+type SessionType uint8
+
+const (
+	SessionTypeUndefined SessionType = iota
+	SessionTypeUnauthenticated
+	SessionTypeSecure
+	SessionTypeGroupIncoming
+	SessionTypeGroupOutgoing
+)
+
+func (t SessionType) String() string {
+	switch t {
+	case SessionTypeUnauthenticated:
+		return "unauthenticated"
+	case SessionTypeSecure:
+		return "secure"
+	case SessionTypeGroupIncoming:
+		return "incoming group"
+	case SessionTypeGroupOutgoing:
+		return "outgoing group"
+	default:
+		return "undefined"
+	}
+}
+
+// SessionRole 会话建立时本端的角色
+type SessionRole uint8
+
+const (
+	SessionRoleInitiator SessionRole = iota
+	SessionRoleResponder
+)
+
+// Session 消息层使用的会话，可能是未认证会话、安全单播会话或者组会话
+type Session interface {
+	GetSessionType() SessionType
+	GetPeer() lib.ScopedNodeId
+	GetFabricIndex() lib.FabricIndex
+	// GetSubjectDescriptor 访问控制检查使用的主体
+	GetSubjectDescriptor() access.SubjectDescriptor
+	GetPeerAddress() PeerAddress
+	SetPeerAddress(address PeerAddress)
+	IsGroupSession() bool
+	IsSecureSession() bool
+	IsActiveSession() bool
+	GetLastActivityTime() time.Time
+	MarkActive()
+	GetRemoteMRPConfig() ReliableMessageProtocolConfig
+	SetRemoteMRPConfig(config ReliableMessageProtocolConfig)
+}
+
+// ReliableMessageProtocolConfig MRP的重传间隔，对端的参数来自 DNS-SD 的 SII/SAI 或者会话建立时交换的参数，
+// 为0的字段表示未知，使用默认值
+type ReliableMessageProtocolConfig struct {
+	IdleRetransTimeout   time.Duration
+	ActiveRetransTimeout time.Duration
+}
+
+// SessionReleaseDelegate 会话被释放时的回调，消息层用来关闭该会话上的Exchange
+type SessionReleaseDelegate interface {
+	OnSessionReleased(session Session)
+}
+
+// SessionMessageDelegate 接收SessionManager解密后的消息
+type SessionMessageDelegate interface {
+	OnMessageReceived(packetHeader *message.Header, payloadHeader *message.PayloadHeader, session Session, isDuplicate bool, payload []byte)
+}
+
+// sessionBase 会话的公共部分
+type sessionBase struct {
+	mMutex        sync.RWMutex
+	mPeerAddress  PeerAddress
+	mLastActivity time.Time
+	mRemoteMRP    ReliableMessageProtocolConfig
+}
+
+func (s *sessionBase) GetPeerAddress() PeerAddress {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mPeerAddress
+}
+
+func (s *sessionBase) SetPeerAddress(address PeerAddress) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mPeerAddress = address
+}
+
+func (s *sessionBase) GetLastActivityTime() time.Time {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mLastActivity
+}
+
+func (s *sessionBase) MarkActive() {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mLastActivity = time.Now()
+}
+
+func (s *sessionBase) GetRemoteMRPConfig() ReliableMessageProtocolConfig {
+	s.mMutex.RLock()
+	defer s.mMutex.RUnlock()
+	return s.mRemoteMRP
+}
+
+func (s *sessionBase) SetRemoteMRPConfig(config ReliableMessageProtocolConfig) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mRemoteMRP = config
+}
@@ -1,38 +1,572 @@
 package transport
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"github.com/galenliu/chip/credentials"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
 	"github.com/galenliu/chip/storage"
 	"github.com/galenliu/chip/transport/message"
 	log "github.com/sirupsen/logrus"
-	"net/netip"
+	"sync"
 )
 
 type SessionManager interface {
-	Init(transports Transport, storage storage.StorageDelegate, table *credentials.FabricTable) error
+	Init(transports TransportManager, storage storage.PersistentStorageDelegate, table *credentials.FabricTable) error
+	TransportDelegate
+
+	SetMessageDelegate(delegate SessionMessageDelegate)
+	SetGroupKeyProvider(provider GroupKeyProvider)
+	RegisterReleaseDelegate(delegate SessionReleaseDelegate)
+	UnregisterReleaseDelegate(delegate SessionReleaseDelegate)
+
+	PrepareMessage(session Session, payloadHeader *message.PayloadHeader, payload []byte) (*PreparedMessage, error)
+	SendPreparedMessage(session Session, preparedMessage *PreparedMessage) error
+
+	AllocateSession(secureSessionType SecureSessionType, sessionEvictionHint lib.ScopedNodeId) (*SecureSession, error)
+	CreateUnauthenticatedSession(peerAddress PeerAddress) (*UnauthenticatedSession, error)
+	GetSecureSession(localSessionId uint16) (*SecureSession, bool)
+	FindSecureSessionForNode(peer lib.ScopedNodeId, secureSessionType SecureSessionType) (*SecureSession, bool)
+
+	ExpireSession(session Session)
+	ExpireAllSessions(peer lib.ScopedNodeId)
+	ExpireAllSessionsForFabric(fabricIndex lib.FabricIndex)
+	ExpireAllPASESessions()
+	RemoveFabric(fabricIndex lib.FabricIndex)
+	Shutdown()
+}
+
+// PreparedMessage 编码（加密）完成、可以直接交给传输层发送的消息，重传时使用同样的数据
+type PreparedMessage struct {
+	mData           []byte
+	mMessageCounter uint32
+}
+
+func (m *PreparedMessage) GetMessageCounter() uint32 {
+	return m.mMessageCounter
+}
+
+func (m *PreparedMessage) Data() []byte {
+	return m.mData
 }
 
 type SessionManagerImpl struct {
+	mMutex       sync.RWMutex
+	mTransports  TransportManager
+	mStorage     storage.PersistentStorageDelegate
+	mFabricTable *credentials.FabricTable
+	mInitialized bool
+
+	mUnsecuredCounter      *GlobalUnencryptedMessageCounter
+	mGroupCounters         *GroupOutgoingCounters
+	mMessageCounterManager *MessageCounterManager
+	// mLocalNodeIdLookup 查找本端在某个Fabric中的节点ID，MCSP消息需要
+	mLocalNodeIdLookup func(fabricIndex lib.FabricIndex) (lib.NodeId, bool)
+
+	mUnauthenticatedSessions *UnauthenticatedSessionTable
+	mSecureSessions          *SecureSessionTable
+	mGroupSessions           *GroupSessionTable
+
+	mMessageDelegate  SessionMessageDelegate
+	mGroupKeyProvider GroupKeyProvider
+	mReleaseDelegates []SessionReleaseDelegate
+}
+
+func NewSessionManagerImpl() *SessionManagerImpl {
+	s := &SessionManagerImpl{
+		mUnsecuredCounter:        NewGlobalUnencryptedMessageCounter(),
+		mGroupCounters:           NewGroupOutgoingCounters(),
+		mMessageCounterManager:   NewMessageCounterManager(),
+		mUnauthenticatedSessions: NewUnauthenticatedSessionTable(KMaxUnauthenticatedSessions),
+		mSecureSessions:          NewSecureSessionTable(KMaxSecureSessions),
+		mGroupSessions:           NewGroupSessionTable(KMaxGroupPeers),
+	}
+	s.mLocalNodeIdLookup = s.fabricLocalNodeId
+	return s
 }
 
-func (s SessionManagerImpl) Init(transports Transport, storage storage.StorageDelegate, table *credentials.FabricTable) error {
+// Init 保存传输、存储和FabricTable，恢复持久化的组消息计数，并接收传输层收到的消息
+func (s *SessionManagerImpl) Init(transports TransportManager, storage storage.PersistentStorageDelegate, table *credentials.FabricTable) error {
+	if transports == nil || storage == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.Lock()
+	if s.mInitialized {
+		s.mMutex.Unlock()
+		return internal.ChipErrorIncorrectState
+	}
+	if err := s.mGroupCounters.Init(storage); err != nil {
+		s.mMutex.Unlock()
+		return err
+	}
+	if err := s.mMessageCounterManager.Init(storage); err != nil {
+		s.mMutex.Unlock()
+		return err
+	}
+	s.mTransports = transports
+	s.mStorage = storage
+	s.mFabricTable = table
+	s.mInitialized = true
+	s.mMutex.Unlock()
+
+	transports.SetSessionManager(s)
 	return nil
 }
 
-func NewSessionManagerImpl() *SessionManagerImpl {
-	return &SessionManagerImpl{}
+func (s *SessionManagerImpl) fabricLocalNodeId(fabricIndex lib.FabricIndex) (lib.NodeId, bool) {
+	s.mMutex.RLock()
+	table := s.mFabricTable
+	s.mMutex.RUnlock()
+	if table == nil {
+		return lib.KUndefinedNodeId, false
+	}
+	info := table.FindFabricWithIndex(fabricIndex)
+	if info == nil {
+		return lib.KUndefinedNodeId, false
+	}
+	return info.GetNodeId(), true
+}
+
+// Shutdown 释放所有的会话并停止接收消息
+func (s *SessionManagerImpl) Shutdown() {
+	var released []Session
+	s.mSecureSessions.ForEachSession(func(session *SecureSession) bool {
+		if s.mSecureSessions.ReleaseSession(session) {
+			released = append(released, session)
+		}
+		return true
+	})
+	s.notifyReleased(released)
+
+	s.mMutex.Lock()
+	transports := s.mTransports
+	s.mTransports = nil
+	s.mInitialized = false
+	s.mMutex.Unlock()
+	if transports != nil {
+		transports.SetSessionManager(nil)
+	}
+}
+
+func (s *SessionManagerImpl) SetMessageDelegate(delegate SessionMessageDelegate) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mMessageDelegate = delegate
+}
+
+func (s *SessionManagerImpl) SetGroupKeyProvider(provider GroupKeyProvider) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mGroupKeyProvider = provider
+}
+
+func (s *SessionManagerImpl) RegisterReleaseDelegate(delegate SessionReleaseDelegate) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	for _, d := range s.mReleaseDelegates {
+		if d == delegate {
+			return
+		}
+	}
+	s.mReleaseDelegates = append(s.mReleaseDelegates, delegate)
+}
+
+func (s *SessionManagerImpl) UnregisterReleaseDelegate(delegate SessionReleaseDelegate) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	for i, d := range s.mReleaseDelegates {
+		if d == delegate {
+			s.mReleaseDelegates = append(s.mReleaseDelegates[:i], s.mReleaseDelegates[i+1:]...)
+			return
+		}
+	}
+}
+
+// AllocateSession 为会话建立分配一个新的本地会话ID
+func (s *SessionManagerImpl) AllocateSession(secureSessionType SecureSessionType, sessionEvictionHint lib.ScopedNodeId) (*SecureSession, error) {
+	session, evicted, err := s.mSecureSessions.CreateNewSecureSession(secureSessionType, sessionEvictionHint)
+	if evicted != nil {
+		log.Infof("SessionManager evicted session %d to make room", evicted.GetLocalSessionId())
+		s.notifyReleased([]Session{evicted})
+	}
+	return session, err
+}
+
+// CreateUnauthenticatedSession 作为发起者创建未认证的会话，使用随机的临时节点ID
+func (s *SessionManagerImpl) CreateUnauthenticatedSession(peerAddress PeerAddress) (*UnauthenticatedSession, error) {
+	for {
+		var buf [8]byte
+		if _, err := rand.Read(buf[:]); err != nil {
+			return nil, err
+		}
+		ephemeralId := lib.NodeId(binary.LittleEndian.Uint64(buf[:]))
+		if !ephemeralId.IsOperationalNodeId() {
+			continue
+		}
+		session, err := s.mUnauthenticatedSessions.AllocInitiator(ephemeralId, peerAddress)
+		if err == internal.ChipErrorIncorrectState {
+			continue
+		}
+		return session, err
+	}
+}
+
+func (s *SessionManagerImpl) GetSecureSession(localSessionId uint16) (*SecureSession, bool) {
+	session := s.mSecureSessions.FindSecureSessionByLocalKey(localSessionId)
+	return session, session != nil
+}
+
+// FindSecureSessionForNode 查找与对端最近活动的已建立会话
+func (s *SessionManagerImpl) FindSecureSessionForNode(peer lib.ScopedNodeId, secureSessionType SecureSessionType) (*SecureSession, bool) {
+	var found *SecureSession
+	s.mSecureSessions.ForEachSession(func(session *SecureSession) bool {
+		if session.IsActiveSession() && session.GetSecureSessionType() == secureSessionType && session.GetPeer() == peer {
+			if found == nil || found.GetLastActivityTime().Before(session.GetLastActivityTime()) {
+				found = session
+			}
+		}
+		return true
+	})
+	return found, found != nil
 }
 
-func (s SessionManagerImpl) OnMessageReceived(port netip.AddrPort, data []byte) {
-	packetHeadr, err := message.DecodeHeader(data)
+// ExpireSession 释放会话，之后该会话不能再收发消息
+func (s *SessionManagerImpl) ExpireSession(session Session) {
+	switch sess := session.(type) {
+	case *SecureSession:
+		if s.mSecureSessions.ReleaseSession(sess) {
+			s.notifyReleased([]Session{sess})
+		}
+	case *UnauthenticatedSession:
+		s.mUnauthenticatedSessions.Release(sess)
+	}
+}
+
+// ExpireAllSessions 释放与对端的所有安全会话
+func (s *SessionManagerImpl) ExpireAllSessions(peer lib.ScopedNodeId) {
+	s.expireSecureSessions(func(session *SecureSession) bool {
+		return session.GetPeer() == peer
+	})
+}
+
+// ExpireAllSessionsForFabric 释放某个Fabric的所有安全会话和组会话
+func (s *SessionManagerImpl) ExpireAllSessionsForFabric(fabricIndex lib.FabricIndex) {
+	s.expireSecureSessions(func(session *SecureSession) bool {
+		return session.GetFabricIndex() == fabricIndex
+	})
+	s.mGroupSessions.RemoveFabric(fabricIndex)
+}
+
+// RemoveFabric Fabric 被删除后清除它的组消息对端计数，包括持久化的计数
+func (s *SessionManagerImpl) RemoveFabric(fabricIndex lib.FabricIndex) {
+	s.mMessageCounterManager.RemoveFabric(fabricIndex)
+}
+
+func (s *SessionManagerImpl) ExpireAllPASESessions() {
+	s.expireSecureSessions(func(session *SecureSession) bool {
+		return session.IsPASESession()
+	})
+}
+
+func (s *SessionManagerImpl) expireSecureSessions(match func(session *SecureSession) bool) {
+	var released []Session
+	s.mSecureSessions.ForEachSession(func(session *SecureSession) bool {
+		if match(session) && s.mSecureSessions.ReleaseSession(session) {
+			released = append(released, session)
+		}
+		return true
+	})
+	s.notifyReleased(released)
+}
+
+// notifyReleased 在不持有锁的情况下通知会话被释放
+func (s *SessionManagerImpl) notifyReleased(sessions []Session) {
+	if len(sessions) == 0 {
+		return
+	}
+	s.mMutex.RLock()
+	delegates := append([]SessionReleaseDelegate(nil), s.mReleaseDelegates...)
+	s.mMutex.RUnlock()
+	for _, session := range sessions {
+		for _, delegate := range delegates {
+			delegate.OnSessionReleased(session)
+		}
+	}
+}
+
+// PrepareMessage 根据会话类型填写消息头，分配消息计数并加密
+func (s *SessionManagerImpl) PrepareMessage(session Session, payloadHeader *message.PayloadHeader, payload []byte) (*PreparedMessage, error) {
+	if session == nil || payloadHeader == nil {
+		return nil, internal.ChipErrorInvalidArgument
+	}
+	payloadHeaderBytes, err := payloadHeader.Encode()
 	if err != nil {
-		log.Printf("failed to decode packet header: %s", err.Error())
+		return nil, err
+	}
+	plaintext := make([]byte, 0, len(payloadHeaderBytes)+len(payload))
+	plaintext = append(plaintext, payloadHeaderBytes...)
+	plaintext = append(plaintext, payload...)
+
+	packetHeader := message.NewHeader()
+	var cryptoContext *CryptoContext
+	var nonceNodeId lib.NodeId
+
+	switch sess := session.(type) {
+	case *UnauthenticatedSession:
+		packetHeader.SetUnsecured()
+		if sess.GetSessionRole() == SessionRoleInitiator {
+			packetHeader.SetSourceNodeId(sess.GetEphemeralInitiatorNodeId())
+		} else {
+			packetHeader.SetDestinationNodeId(sess.GetEphemeralInitiatorNodeId())
+		}
+		counter, err := s.mUnsecuredCounter.AdvanceAndConsume()
+		if err != nil {
+			return nil, err
+		}
+		packetHeader.SetMessageCounter(counter)
+	case *SecureSession:
+		if !sess.IsActiveSession() {
+			return nil, internal.ChipErrorNotConnected
+		}
+		counter, err := sess.nextMessageCounter()
+		if err != nil {
+			return nil, err
+		}
+		packetHeader.SetSessionType(message.SessionTypeUnicast)
+		packetHeader.SetSessionId(sess.GetPeerSessionId())
+		packetHeader.SetMessageCounter(counter)
+		cryptoContext = sess.GetCryptoContext()
+		nonceNodeId = sess.nonceNodeId(true)
+	case *GroupSession:
+		if sess.GetSessionType() != SessionTypeGroupOutgoing {
+			return nil, internal.ChipErrorInvalidArgument
+		}
+		s.mMutex.RLock()
+		provider := s.mGroupKeyProvider
+		s.mMutex.RUnlock()
+		if provider == nil {
+			return nil, internal.ChipErrorKeyNotFound
+		}
+		sessionId, key, err := provider.GetOutgoingGroupSessionKey(sess.GetFabricIndex(), sess.GetGroupId())
+		if err != nil {
+			return nil, err
+		}
+		packetHeader.SetSessionType(message.SessionTypeGroup)
+		packetHeader.SetSessionId(sessionId)
+		packetHeader.SetSourceNodeId(sess.GetSourceNodeId())
+		packetHeader.SetDestinationGroupId(sess.GetGroupId())
+		counter, err := s.mGroupCounters.AdvanceAndConsume(false)
+		if err != nil {
+			return nil, err
+		}
+		packetHeader.SetMessageCounter(counter)
+		cryptoContext = key
+		nonceNodeId = sess.GetSourceNodeId()
+	default:
+		return nil, internal.ChipErrorInvalidArgument
+	}
+
+	data, err := sealMessage(packetHeader, cryptoContext, nonceNodeId, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedMessage{mData: data, mMessageCounter: packetHeader.GetMessageCounter()}, nil
+}
+
+// sealMessage 编码消息头，存在秘钥时以消息头作为附加数据加密 PayloadHeader 和负载
+func sealMessage(packetHeader *message.Header, cryptoContext *CryptoContext, nonceNodeId lib.NodeId, plaintext []byte) ([]byte, error) {
+	headerBytes, err := packetHeader.Encode()
+	if err != nil {
+		return nil, err
+	}
+	if cryptoContext != nil {
+		plaintext, err = cryptoContext.Encrypt(plaintext, packetHeader, headerBytes, nonceNodeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data := make([]byte, 0, len(headerBytes)+len(plaintext))
+	data = append(data, headerBytes...)
+	data = append(data, plaintext...)
+	return data, nil
+}
+
+// SendPreparedMessage 把准备好的消息发送到会话的对端地址
+func (s *SessionManagerImpl) SendPreparedMessage(session Session, preparedMessage *PreparedMessage) error {
+	if session == nil || preparedMessage == nil {
+		return internal.ChipErrorInvalidArgument
+	}
+	s.mMutex.RLock()
+	transports := s.mTransports
+	s.mMutex.RUnlock()
+	if transports == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if session.GetSessionType() == SessionTypeSecure && !session.IsActiveSession() {
+		return internal.ChipErrorNotConnected
+	}
+	peerAddress := session.GetPeerAddress()
+	if !peerAddress.IsInitialized() {
+		return internal.ChipErrorNotConnected
+	}
+	session.MarkActive()
+	return transports.SendMessage(peerAddress, preparedMessage.mData)
+}
+
+// OnMessageReceived 解析消息头，根据会话类型分发消息
+func (s *SessionManagerImpl) OnMessageReceived(peer PeerAddress, data []byte) {
+	packetHeader, err := message.DecodeHeader(data)
+	if err != nil {
+		log.Infof("SessionManager failed to decode packet header: %s", err.Error())
 		return
 	}
-	if packetHeadr.IsEncrypted() {
-		if packetHeadr.IsGroupSession() {
+	if !packetHeader.IsSessionTypeValid() {
+		log.Infof("SessionManager dropping message with invalid session type")
+		return
+	}
+	headerBytes := data[:packetHeader.Len()]
+	payload := data[packetHeader.Len():]
+	switch {
+	case !packetHeader.IsEncrypted():
+		s.unsecuredMessageDispatch(packetHeader, peer, payload)
+	case packetHeader.IsGroupSession() && packetHeader.IsValidMCSPMsg():
+		s.messageCounterSyncDispatch(packetHeader, headerBytes, peer, payload)
+	case packetHeader.IsGroupSession():
+		s.secureGroupMessageDispatch(packetHeader, headerBytes, peer, payload)
+	default:
+		s.secureUnicastMessageDispatch(packetHeader, headerBytes, peer, payload)
+	}
+}
 
+func (s *SessionManagerImpl) unsecuredMessageDispatch(packetHeader *message.Header, peer PeerAddress, payload []byte) {
+	var session *UnauthenticatedSession
+	sourceNodeId, hasSource := packetHeader.GetSourceNodeId()
+	destinationNodeId, hasDestination := packetHeader.GetDestinationNodeId()
+	switch {
+	case hasSource && !hasDestination:
+		var err error
+		session, err = s.mUnauthenticatedSessions.FindOrAllocateResponder(sourceNodeId, peer)
+		if err != nil {
+			log.Infof("SessionManager failed to allocate unauthenticated session: %s", err.Error())
+			return
+		}
+	case hasDestination && !hasSource:
+		session = s.mUnauthenticatedSessions.FindInitiator(destinationNodeId)
+		if session == nil {
+			log.Infof("SessionManager dropping unsecured message for unknown node %d", destinationNodeId)
+			return
 		}
+	default:
+		log.Infof("SessionManager dropping unsecured message with invalid node ids")
+		return
+	}
+
+	isDuplicate := session.verifyPeerMessageCounter(packetHeader.GetMessageCounter()) != nil
+	if !isDuplicate {
+		session.commitPeerMessageCounter(packetHeader.GetMessageCounter())
 	}
+	session.SetPeerAddress(peer)
+	session.MarkActive()
+	s.dispatch(packetHeader, session, isDuplicate, payload)
+}
 
+func (s *SessionManagerImpl) secureUnicastMessageDispatch(packetHeader *message.Header, headerBytes []byte, peer PeerAddress, payload []byte) {
+	session, ok := s.GetSecureSession(packetHeader.GetSessionId())
+	if !ok {
+		log.Infof("SessionManager dropping message for unknown session %d", packetHeader.GetSessionId())
+		return
+	}
+	if !session.IsActiveSession() {
+		log.Infof("SessionManager dropping message for inactive session %d", session.GetLocalSessionId())
+		return
+	}
+	if _, ok := packetHeader.GetDestinationGroupId(); ok {
+		log.Infof("SessionManager dropping unicast message with group destination")
+		return
+	}
+	plaintext, err := session.GetCryptoContext().Decrypt(payload, packetHeader, headerBytes, session.nonceNodeId(false))
+	if err != nil {
+		log.Infof("SessionManager failed to decrypt message on session %d: %s", session.GetLocalSessionId(), err.Error())
+		return
+	}
+	isDuplicate := session.verifyPeerMessageCounter(packetHeader.GetMessageCounter()) != nil
+	if !isDuplicate {
+		session.commitPeerMessageCounter(packetHeader.GetMessageCounter())
+	}
+	session.SetPeerAddress(peer)
+	session.MarkActive()
+	s.dispatch(packetHeader, session, isDuplicate, plaintext)
+}
+
+func (s *SessionManagerImpl) secureGroupMessageDispatch(packetHeader *message.Header, headerBytes []byte, peer PeerAddress, payload []byte) {
+	if !packetHeader.IsValidGroupMsg() {
+		log.Infof("SessionManager dropping invalid group message")
+		return
+	}
+	s.mMutex.RLock()
+	provider := s.mGroupKeyProvider
+	s.mMutex.RUnlock()
+	if provider == nil {
+		log.Infof("SessionManager dropping group message: no group key provider")
+		return
+	}
+	sourceNodeId, _ := packetHeader.GetSourceNodeId()
+	groupId, _ := packetHeader.GetDestinationGroupId()
+
+	matched, plaintext := decryptGroupMessage(provider, packetHeader, headerBytes, payload, func(key GroupSessionKey) bool {
+		return key.GroupId == groupId
+	})
+	if matched == nil {
+		log.Infof("SessionManager failed to decrypt group message for group %d", groupId)
+		return
+	}
+
+	isControl := packetHeader.IsSecureSessionControlMsg()
+	err := s.mMessageCounterManager.VerifyGroupMessage(matched.FabricIndex, sourceNodeId, isControl, packetHeader.GetMessageCounter())
+	if isControl && err == internal.ChipErrorIncorrectState {
+		// 控制消息需要先与发送者同步计数，同步完成后再处理
+		s.startMessageCounterSync(matched, packetHeader.GetSessionId(), sourceNodeId, peer, append(append([]byte(nil), headerBytes...), payload...))
+		return
+	}
+	if err != nil {
+		log.Infof("SessionManager dropping group message from node %d: %s", sourceNodeId, err.Error())
+		return
+	}
+
+	session := s.mGroupSessions.FindOrAllocate(matched.FabricIndex, groupId, sourceNodeId)
+	session.SetPeerAddress(peer)
+	session.MarkActive()
+	s.dispatch(packetHeader, session, false, plaintext)
+}
+
+// decryptGroupMessage 依次尝试会话ID对应的候选秘钥
+func decryptGroupMessage(provider GroupKeyProvider, packetHeader *message.Header, headerBytes, payload []byte, match func(key GroupSessionKey) bool) (*GroupSessionKey, []byte) {
+	sourceNodeId, _ := packetHeader.GetSourceNodeId()
+	for _, key := range provider.GetIncomingGroupSessionKeys(packetHeader.GetSessionId()) {
+		if key.Key == nil || !match(key) {
+			continue
+		}
+		plaintext, err := key.Key.Decrypt(payload, packetHeader, headerBytes, sourceNodeId)
+		if err == nil {
+			return &key, plaintext
+		}
+	}
+	return nil, nil
+}
+
+func (s *SessionManagerImpl) dispatch(packetHeader *message.Header, session Session, isDuplicate bool, data []byte) {
+	payloadHeader, err := message.DecodePayloadHeader(data)
+	if err != nil {
+		log.Infof("SessionManager failed to decode payload header: %s", err.Error())
+		return
+	}
+	s.mMutex.RLock()
+	delegate := s.mMessageDelegate
+	s.mMutex.RUnlock()
+	if delegate == nil {
+		log.Infof("SessionManager dropping message: no message delegate")
+		return
+	}
+	delegate.OnMessageReceived(packetHeader, payloadHeader, session, isDuplicate, data[payloadHeader.Len():])
 }
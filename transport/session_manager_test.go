@@ -0,0 +1,444 @@
+package transport
+
+import (
+	"bytes"
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"github.com/galenliu/chip/storage"
+	"github.com/galenliu/chip/transport/message"
+	"net/netip"
+	"testing"
+)
+
+// loopbackTransportManager 把发送的消息直接交给另一端的 SessionManager
+type loopbackTransportManager struct {
+	mDelegate TransportDelegate
+	mPeer     *loopbackTransportManager
+	mAddress  PeerAddress
+	mSent     [][]byte
+}
+
+func (l *loopbackTransportManager) Init(...Transport) error { return nil }
+
+func (l *loopbackTransportManager) SetSessionManager(delegate TransportDelegate) {
+	l.mDelegate = delegate
+}
+
+func (l *loopbackTransportManager) SendMessage(_ PeerAddress, msg []byte) error {
+	l.mSent = append(l.mSent, msg)
+	if l.mPeer.mDelegate != nil {
+		l.mPeer.mDelegate.OnMessageReceived(l.mAddress, append([]byte(nil), msg...))
+	}
+	return nil
+}
+
+func (l *loopbackTransportManager) MulticastGroupJoinLeave(PeerAddress, bool) error { return nil }
+
+func (l *loopbackTransportManager) GetTransports() []Transport { return nil }
+
+func (l *loopbackTransportManager) Close() {}
+
+type testSessionMessage struct {
+	packetHeader  *message.Header
+	payloadHeader *message.PayloadHeader
+	session       Session
+	isDuplicate   bool
+	payload       []byte
+}
+
+type testSessionMessageDelegate struct {
+	mMessages []testSessionMessage
+}
+
+func (d *testSessionMessageDelegate) OnMessageReceived(packetHeader *message.Header, payloadHeader *message.PayloadHeader, session Session, isDuplicate bool, payload []byte) {
+	d.mMessages = append(d.mMessages, testSessionMessage{packetHeader, payloadHeader, session, isDuplicate, payload})
+}
+
+type testReleaseDelegate struct {
+	mReleased []Session
+}
+
+func (d *testReleaseDelegate) OnSessionReleased(session Session) {
+	d.mReleased = append(d.mReleased, session)
+}
+
+type sessionManagerPair struct {
+	a, b                   *SessionManagerImpl
+	aTransport, bTransport *loopbackTransportManager
+	aDelegate, bDelegate   *testSessionMessageDelegate
+}
+
+func newSessionManagerPair(t *testing.T) *sessionManagerPair {
+	t.Helper()
+	p := &sessionManagerPair{
+		a:          NewSessionManagerImpl(),
+		b:          NewSessionManagerImpl(),
+		aTransport: &loopbackTransportManager{mAddress: NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5541"))},
+		bTransport: &loopbackTransportManager{mAddress: NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5542"))},
+		aDelegate:  &testSessionMessageDelegate{},
+		bDelegate:  &testSessionMessageDelegate{},
+	}
+	p.aTransport.mPeer, p.bTransport.mPeer = p.bTransport, p.aTransport
+	if err := p.a.Init(p.aTransport, storage.NewInMemoryPersistentStorage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.b.Init(p.bTransport, storage.NewInMemoryPersistentStorage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	p.a.SetMessageDelegate(p.aDelegate)
+	p.b.SetMessageDelegate(p.bDelegate)
+	return p
+}
+
+// establishCASE 在两端建立一对互相关联的CASE会话
+func (p *sessionManagerPair) establishCASE(t *testing.T) (*SecureSession, *SecureSession) {
+	t.Helper()
+	i2r := bytes.Repeat([]byte{0x11}, KSessionKeyLength)
+	r2i := bytes.Repeat([]byte{0x22}, KSessionKeyLength)
+	aNode := lib.NewScopedNodeId(0x0000_0000_0000_0A0A, 1)
+	bNode := lib.NewScopedNodeId(0x0000_0000_0000_0B0B, 1)
+
+	aSession, err := p.a.AllocateSession(SecureSessionTypeCASE, bNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bSession, err := p.b.AllocateSession(SecureSessionTypeCASE, aNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aContext, _ := NewCryptoContext(i2r, r2i, nil, SessionRoleInitiator)
+	bContext, _ := NewCryptoContext(i2r, r2i, nil, SessionRoleResponder)
+	if err := aSession.Activate(aNode, bNode, lib.CATValues{}, bSession.GetLocalSessionId(), aContext, p.bTransport.mAddress); err != nil {
+		t.Fatal(err)
+	}
+	if err := bSession.Activate(bNode, aNode, lib.CATValues{}, aSession.GetLocalSessionId(), bContext, p.aTransport.mAddress); err != nil {
+		t.Fatal(err)
+	}
+	return aSession, bSession
+}
+
+func newTestPayloadHeader() *message.PayloadHeader {
+	header := message.NewPayloadHeader()
+	header.SetInitiator(true)
+	header.SetExchangeId(0x1234)
+	header.SetMessageType(0x0001, 0x02)
+	return header
+}
+
+func TestSessionManagerSecureRoundTrip(t *testing.T) {
+	p := newSessionManagerPair(t)
+	aSession, bSession := p.establishCASE(t)
+
+	payload := []byte("secure payload")
+	prepared, err := p.a.PrepareMessage(aSession, newTestPayloadHeader(), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(prepared.Data(), payload) {
+		t.Errorf("payload must be encrypted")
+	}
+	if err := p.a.SendPreparedMessage(aSession, prepared); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.bDelegate.mMessages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(p.bDelegate.mMessages))
+	}
+	msg := p.bDelegate.mMessages[0]
+	if msg.session != bSession || msg.isDuplicate {
+		t.Errorf("unexpected session or duplicate flag")
+	}
+	if !bytes.Equal(msg.payload, payload) || msg.payloadHeader.GetExchangeId() != 0x1234 {
+		t.Errorf("unexpected payload %x", msg.payload)
+	}
+	if msg.packetHeader.GetMessageCounter() != prepared.GetMessageCounter() {
+		t.Errorf("unexpected message counter")
+	}
+	if bSession.GetPeerAddress() != p.aTransport.mAddress {
+		t.Errorf("peer address must be updated from the received message")
+	}
+
+	// 重传同样的数据会被标记为重复消息
+	if err := p.a.SendPreparedMessage(aSession, prepared); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.bDelegate.mMessages) != 2 || !p.bDelegate.mMessages[1].isDuplicate {
+		t.Errorf("retransmitted message must be flagged as duplicate")
+	}
+
+	// 回复
+	reply, err := p.b.PrepareMessage(bSession, message.NewPayloadHeader(), []byte("reply"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.b.SendPreparedMessage(bSession, reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.aDelegate.mMessages) != 1 || string(p.aDelegate.mMessages[0].payload) != "reply" {
+		t.Errorf("reply not received")
+	}
+}
+
+func TestSessionManagerRejectsTamperedMessage(t *testing.T) {
+	p := newSessionManagerPair(t)
+	aSession, _ := p.establishCASE(t)
+
+	prepared, err := p.a.PrepareMessage(aSession, newTestPayloadHeader(), []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int{4, len(prepared.Data()) - 1} {
+		tampered := append([]byte(nil), prepared.Data()...)
+		tampered[offset] ^= 0x01
+		p.b.OnMessageReceived(p.aTransport.mAddress, tampered)
+	}
+	if len(p.bDelegate.mMessages) != 0 {
+		t.Errorf("tampered messages must be dropped")
+	}
+
+	unknown := append([]byte(nil), prepared.Data()...)
+	unknown[1] ^= 0xFF
+	p.b.OnMessageReceived(p.aTransport.mAddress, unknown)
+	if len(p.bDelegate.mMessages) != 0 {
+		t.Errorf("messages for unknown sessions must be dropped")
+	}
+}
+
+func TestSessionManagerUnauthenticated(t *testing.T) {
+	p := newSessionManagerPair(t)
+	initiator, err := p.a.CreateUnauthenticatedSession(p.bTransport.mAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prepared, err := p.a.PrepareMessage(initiator, newTestPayloadHeader(), []byte("pbkdf request"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.a.SendPreparedMessage(initiator, prepared); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.bDelegate.mMessages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(p.bDelegate.mMessages))
+	}
+	responder, ok := p.bDelegate.mMessages[0].session.(*UnauthenticatedSession)
+	if !ok || responder.GetSessionRole() != SessionRoleResponder ||
+		responder.GetEphemeralInitiatorNodeId() != initiator.GetEphemeralInitiatorNodeId() {
+		t.Fatalf("unexpected responder session")
+	}
+
+	reply, err := p.b.PrepareMessage(responder, message.NewPayloadHeader(), []byte("pbkdf response"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := message.DecodeHeader(reply.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if destination, ok := header.GetDestinationNodeId(); !ok || destination != initiator.GetEphemeralInitiatorNodeId() {
+		t.Errorf("responder must address the initiator ephemeral node id")
+	}
+	if err := p.b.SendPreparedMessage(responder, reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.aDelegate.mMessages) != 1 || p.aDelegate.mMessages[0].session != initiator {
+		t.Errorf("reply must be delivered on the initiator session")
+	}
+}
+
+func TestSessionManagerExpire(t *testing.T) {
+	p := newSessionManagerPair(t)
+	releaseDelegate := &testReleaseDelegate{}
+	p.a.RegisterReleaseDelegate(releaseDelegate)
+	aSession, _ := p.establishCASE(t)
+
+	if found, ok := p.a.FindSecureSessionForNode(aSession.GetPeer(), SecureSessionTypeCASE); !ok || found != aSession {
+		t.Errorf("session not found for peer")
+	}
+	p.a.ExpireAllSessionsForFabric(2)
+	if len(releaseDelegate.mReleased) != 0 {
+		t.Errorf("sessions on other fabrics must not be released")
+	}
+	p.a.ExpireAllSessionsForFabric(1)
+	if len(releaseDelegate.mReleased) != 1 || releaseDelegate.mReleased[0] != aSession {
+		t.Errorf("session not released")
+	}
+	if _, ok := p.a.GetSecureSession(aSession.GetLocalSessionId()); ok {
+		t.Errorf("released session must be removed")
+	}
+	if _, err := p.a.PrepareMessage(aSession, newTestPayloadHeader(), nil); err == nil {
+		t.Errorf("expected error preparing a message on a released session")
+	}
+}
+
+func TestSecureSessionTableAllocation(t *testing.T) {
+	table := NewSecureSessionTable(2)
+	table.mNextSessionId = 0xFFFF
+	first, _, err := table.CreateNewSecureSession(SecureSessionTypePASE, lib.ScopedNodeId{})
+	if err != nil || first.GetLocalSessionId() != 0xFFFF {
+		t.Fatalf("unexpected first session id")
+	}
+	second, _, err := table.CreateNewSecureSession(SecureSessionTypePASE, lib.ScopedNodeId{})
+	if err != nil || second.GetLocalSessionId() != 1 {
+		t.Fatalf("session id 0 must be skipped, got %d", second.GetLocalSessionId())
+	}
+	third, evicted, err := table.CreateNewSecureSession(SecureSessionTypePASE, lib.ScopedNodeId{})
+	if err != nil || evicted == nil || table.Count() != 2 {
+		t.Fatalf("a session must be evicted when the table is full")
+	}
+	if evicted.IsActiveSession() || evicted.IsEstablishing() {
+		t.Errorf("evicted session must be defunct")
+	}
+	if third.GetLocalSessionId() == 0 {
+		t.Errorf("unexpected session id 0")
+	}
+}
+
+const (
+	testGroupSessionId uint16      = 0x5555
+	testGroupId        lib.GroupId = 0x0101
+	testFabricIndex                = lib.FabricIndex(1)
+	testNodeA          lib.NodeId  = 0x0A
+	testNodeB          lib.NodeId  = 0x0B
+)
+
+type testGroupKeyProvider struct {
+	mKey *CryptoContext
+}
+
+func (p *testGroupKeyProvider) GetIncomingGroupSessionKeys(sessionId uint16) []GroupSessionKey {
+	if sessionId != testGroupSessionId {
+		return nil
+	}
+	return []GroupSessionKey{{FabricIndex: testFabricIndex, GroupId: testGroupId, Key: p.mKey}}
+}
+
+func (p *testGroupKeyProvider) GetOutgoingGroupSessionKey(lib.FabricIndex, lib.GroupId) (uint16, *CryptoContext, error) {
+	return testGroupSessionId, p.mKey, nil
+}
+
+func (p *sessionManagerPair) setupGroups(t *testing.T) {
+	t.Helper()
+	key, err := NewSymmetricCryptoContext(bytes.Repeat([]byte{0x33}, KSessionKeyLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &testGroupKeyProvider{mKey: key}
+	p.a.SetGroupKeyProvider(provider)
+	p.b.SetGroupKeyProvider(provider)
+	p.a.mLocalNodeIdLookup = func(lib.FabricIndex) (lib.NodeId, bool) { return testNodeA, true }
+	p.b.mLocalNodeIdLookup = func(lib.FabricIndex) (lib.NodeId, bool) { return testNodeB, true }
+}
+
+func TestSessionManagerGroupDataMessage(t *testing.T) {
+	p := newSessionManagerPair(t)
+	p.setupGroups(t)
+	session := NewOutgoingGroupSession(testGroupId, testFabricIndex, testNodeA, p.bTransport.mAddress)
+
+	prepared, err := p.a.PrepareMessage(session, newTestPayloadHeader(), []byte("group"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.a.SendPreparedMessage(session, prepared); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.bDelegate.mMessages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(p.bDelegate.mMessages))
+	}
+	incoming, ok := p.bDelegate.mMessages[0].session.(*GroupSession)
+	if !ok || incoming.GetSessionType() != SessionTypeGroupIncoming || incoming.GetPeer() != lib.NewScopedNodeId(testNodeA, testFabricIndex) {
+		t.Fatalf("unexpected incoming group session")
+	}
+
+	// 重复的组消息直接丢弃
+	if err := p.a.SendPreparedMessage(session, prepared); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.bDelegate.mMessages) != 1 {
+		t.Errorf("duplicate group messages must be dropped")
+	}
+}
+
+func TestSessionManagerGroupControlMessageSync(t *testing.T) {
+	p := newSessionManagerPair(t)
+	p.setupGroups(t)
+
+	counter, err := p.a.mGroupCounters.AdvanceAndConsume(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := message.NewHeader()
+	header.SetSessionType(message.SessionTypeGroup)
+	header.SetSessionId(testGroupSessionId)
+	header.SetSecureSessionControlMsg(true)
+	header.SetSourceNodeId(testNodeA)
+	header.SetDestinationGroupId(testGroupId)
+	header.SetMessageCounter(counter)
+	plaintext, _ := newTestPayloadHeader().Encode()
+	plaintext = append(plaintext, []byte("control")...)
+	key, _ := NewSymmetricCryptoContext(bytes.Repeat([]byte{0x33}, KSessionKeyLength))
+	data, err := sealMessage(header, key, testNodeA, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// B 收到未同步的控制消息后发起MCSP，A 的响应到达之后处理等待的消息
+	p.b.OnMessageReceived(p.aTransport.mAddress, data)
+	if len(p.bTransport.mSent) != 1 || len(p.aTransport.mSent) != 1 {
+		t.Fatalf("expected a MsgCounterSyncReq and a MsgCounterSyncRsp, got %d and %d", len(p.bTransport.mSent), len(p.aTransport.mSent))
+	}
+	request, err := message.DecodeHeader(p.bTransport.mSent[0])
+	if err != nil || !request.IsValidMCSPMsg() {
+		t.Fatalf("sync request must be a valid MCSP message")
+	}
+	if destination, _ := request.GetDestinationNodeId(); destination != testNodeA {
+		t.Errorf("sync request must be sent to the group message source")
+	}
+	if len(p.bDelegate.mMessages) != 1 || string(p.bDelegate.mMessages[0].payload) != "control" {
+		t.Fatalf("queued control message must be delivered after synchronization")
+	}
+	if len(p.aDelegate.mMessages) != 0 {
+		t.Errorf("MCSP messages must not reach the message delegate")
+	}
+
+	// 同步之后重复的控制消息会被丢弃，新的控制消息直接处理
+	p.b.OnMessageReceived(p.aTransport.mAddress, data)
+	if len(p.bDelegate.mMessages) != 1 {
+		t.Errorf("duplicate control message must be dropped")
+	}
+	counter, _ = p.a.mGroupCounters.AdvanceAndConsume(true)
+	header.SetMessageCounter(counter)
+	data, _ = sealMessage(header, key, testNodeA, plaintext)
+	p.b.OnMessageReceived(p.aTransport.mAddress, data)
+	if len(p.bDelegate.mMessages) != 2 || len(p.bTransport.mSent) != 1 {
+		t.Errorf("control messages from a synchronized peer must be delivered without a new sync")
+	}
+}
+
+func TestSecureSessionSubjectDescriptorAccess(t *testing.T) {
+	ac := access.NewAccessControl()
+	if err := ac.Init(access.NewExampleAccessControlDelegate(), nil); err != nil {
+		t.Fatal(err)
+	}
+	path := access.RequestPath{Cluster: 0x0030, Endpoint: 0}
+
+	table := NewSecureSessionTable(2)
+	pase, _, err := table.CreateNewSecureSession(SecureSessionTypePASE, lib.ScopedNodeId{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ac.Check(pase.GetSubjectDescriptor(), path, access.PrivilegeView); err != internal.ChipErrorAccessDenied {
+		t.Errorf("establishing PASE session must be denied, got %v", err)
+	}
+	cryptoContext, _ := NewCryptoContext(bytes.Repeat([]byte{0x11}, KSessionKeyLength), bytes.Repeat([]byte{0x22}, KSessionKeyLength), nil, SessionRoleResponder)
+	if err = pase.Activate(lib.ScopedNodeId{}, lib.ScopedNodeId{}, lib.CATValues{}, 1, cryptoContext, NewUdpPeerAddress(netip.AddrPortFrom(netip.IPv6Loopback(), 5540))); err != nil {
+		t.Fatal(err)
+	}
+	// 配对过程中的 PASE 会话拥有隐式的 Administer 权限
+	if err = ac.Check(pase.GetSubjectDescriptor(), path, access.PrivilegeAdminister); err != nil {
+		t.Errorf("commissioning PASE session must be granted, got %v", err)
+	}
+	pase.SetFabricIndex(1)
+	if err = ac.Check(pase.GetSubjectDescriptor(), path, access.PrivilegeAdminister); err != nil {
+		t.Errorf("PASE session with a new fabric must be granted, got %v", err)
+	}
+}
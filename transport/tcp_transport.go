@@ -0,0 +1,310 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/galenliu/chip/internal"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// KTcpPacketHeaderBytes TCP 上每个 Matter 消息前的长度前缀（小端 32 位）
+	KTcpPacketHeaderBytes = 4
+	// KMaxTcpMessageSize 单个 TCP 消息允许的最大长度
+	KMaxTcpMessageSize = 64 * 1024
+
+	KDefaultTcpIdleTimeout    = 5 * time.Minute
+	KDefaultTcpConnectTimeout = 10 * time.Second
+)
+
+type TcpTransport interface {
+	Transport
+	Disconnect(peer PeerAddress)
+	SetIdleTimeout(timeout time.Duration)
+	ActiveConnectionCount() int
+}
+
+type tcpConnection struct {
+	mConn       net.Conn
+	mPeer       netip.AddrPort
+	mWriteMutex sync.Mutex
+	mMutex      sync.Mutex
+	mLastActive time.Time
+}
+
+func (c *tcpConnection) touch() {
+	c.mMutex.Lock()
+	c.mLastActive = time.Now()
+	c.mMutex.Unlock()
+}
+
+func (c *tcpConnection) idleSince() time.Time {
+	c.mMutex.Lock()
+	defer c.mMutex.Unlock()
+	return c.mLastActive
+}
+
+// TcpTransportImpl 使用长度前缀帧格式的 TCP 传输，连接按对端地址放入连接池复用
+type TcpTransportImpl struct {
+	mListener       *net.TCPListener
+	mAddr           netip.AddrPort
+	mDelegate       TransportDelegate
+	mConnections    map[netip.AddrPort]*tcpConnection
+	mIdleTimeout    time.Duration
+	mConnectTimeout time.Duration
+	mMutex          sync.RWMutex
+	mWaitGroup      sync.WaitGroup
+	mInitialized    bool
+}
+
+func NewTcpTransportImpl() *TcpTransportImpl {
+	return &TcpTransportImpl{
+		mConnections:    make(map[netip.AddrPort]*tcpConnection),
+		mIdleTimeout:    KDefaultTcpIdleTimeout,
+		mConnectTimeout: KDefaultTcpConnectTimeout,
+	}
+}
+
+// Init 监听 addr，端口为 0 时由系统分配
+func (t *TcpTransportImpl) Init(addr netip.AddrPort) error {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	if t.mInitialized {
+		return internal.ChipErrorIncorrectState
+	}
+	network := "tcp6"
+	if addr.Addr().Is4() {
+		network = "tcp4"
+	}
+	listener, err := net.ListenTCP(network, net.TCPAddrFromAddrPort(addr))
+	if err != nil {
+		log.Errorf("TcpTransport listen %s err: %s", addr.String(), err.Error())
+		return err
+	}
+	t.mListener = listener
+	t.mAddr = addr
+	t.mInitialized = true
+	t.mWaitGroup.Add(1)
+	go t.acceptConnections(listener)
+	log.Infof("TcpTransport listening on %s", listener.Addr().String())
+	return nil
+}
+
+func (t *TcpTransportImpl) SetDelegate(delegate TransportDelegate) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	t.mDelegate = delegate
+}
+
+// SetIdleTimeout 设置空闲连接的超时时间，超过该时间没有收发数据的连接会被关闭
+func (t *TcpTransportImpl) SetIdleTimeout(timeout time.Duration) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	t.mIdleTimeout = timeout
+}
+
+func (t *TcpTransportImpl) GetBoundPort() uint16 {
+	t.mMutex.RLock()
+	defer t.mMutex.RUnlock()
+	if t.mListener == nil {
+		return 0
+	}
+	addr, ok := t.mListener.Addr().(*net.TCPAddr)
+	if !ok {
+		return 0
+	}
+	return uint16(addr.Port)
+}
+
+func (t *TcpTransportImpl) CanSendToPeer(peer PeerAddress) bool {
+	t.mMutex.RLock()
+	defer t.mMutex.RUnlock()
+	if !t.mInitialized || peer.GetTransportType() != TypeTcp || !peer.GetAddrPort().IsValid() {
+		return false
+	}
+	return peer.GetIPAddress().Unmap().Is4() == t.mAddr.Addr().Is4()
+}
+
+func (t *TcpTransportImpl) ActiveConnectionCount() int {
+	t.mMutex.RLock()
+	defer t.mMutex.RUnlock()
+	return len(t.mConnections)
+}
+
+// SendMessage 发送消息，如果连接池中没有到对端的连接，则新建连接
+func (t *TcpTransportImpl) SendMessage(peer PeerAddress, msg []byte) error {
+	if !t.CanSendToPeer(peer) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if len(msg) > KMaxTcpMessageSize {
+		return internal.ChipErrorMessageTooLong
+	}
+	connection, err := t.getOrConnect(peer.GetAddrPort())
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, KTcpPacketHeaderBytes+len(msg))
+	binary.LittleEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[KTcpPacketHeaderBytes:], msg)
+
+	connection.mWriteMutex.Lock()
+	_, err = connection.mConn.Write(frame)
+	connection.mWriteMutex.Unlock()
+	if err != nil {
+		t.closeConnection(connection)
+		return err
+	}
+	connection.touch()
+	return nil
+}
+
+// Disconnect 关闭到对端的连接
+func (t *TcpTransportImpl) Disconnect(peer PeerAddress) {
+	t.mMutex.RLock()
+	connection := t.mConnections[peer.GetAddrPort()]
+	t.mMutex.RUnlock()
+	if connection != nil {
+		t.closeConnection(connection)
+	}
+}
+
+func (t *TcpTransportImpl) Close() {
+	t.mMutex.Lock()
+	listener := t.mListener
+	t.mListener = nil
+	t.mInitialized = false
+	connections := make([]*tcpConnection, 0, len(t.mConnections))
+	for _, c := range t.mConnections {
+		connections = append(connections, c)
+	}
+	t.mMutex.Unlock()
+	if listener == nil {
+		return
+	}
+	_ = listener.Close()
+	for _, c := range connections {
+		t.closeConnection(c)
+	}
+	t.mWaitGroup.Wait()
+}
+
+func (t *TcpTransportImpl) getOrConnect(peer netip.AddrPort) (*tcpConnection, error) {
+	t.mMutex.RLock()
+	connection := t.mConnections[peer]
+	timeout := t.mConnectTimeout
+	t.mMutex.RUnlock()
+	if connection != nil {
+		return connection, nil
+	}
+	conn, err := net.DialTimeout("tcp", peer.String(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	connection, ok := t.addConnection(conn, peer)
+	if !ok {
+		// 在连接建立的过程中已经有了到对端的连接，使用已有的连接
+		_ = conn.Close()
+	}
+	if connection == nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	return connection, nil
+}
+
+func (t *TcpTransportImpl) acceptConnections(listener *net.TCPListener) {
+	defer t.mWaitGroup.Done()
+	var retryDelay time.Duration
+	for {
+		conn, err := listener.AcceptTCP()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// 例如文件描述符耗尽，等待一段时间再接受新的连接
+			retryDelay = nextRetryDelay(retryDelay)
+			log.Infof("TcpTransport accept err: %s; retrying in %v", err.Error(), retryDelay)
+			time.Sleep(retryDelay)
+			continue
+		}
+		retryDelay = 0
+		peer := conn.RemoteAddr().(*net.TCPAddr).AddrPort()
+		peer = netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port())
+		if _, ok := t.addConnection(conn, peer); !ok {
+			_ = conn.Close()
+		}
+	}
+}
+
+// addConnection 将连接放入连接池并开始读取，已存在到该对端的连接时返回已有连接和 false
+func (t *TcpTransportImpl) addConnection(conn net.Conn, peer netip.AddrPort) (*tcpConnection, bool) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	if existing := t.mConnections[peer]; existing != nil {
+		return existing, false
+	}
+	if !t.mInitialized {
+		return nil, false
+	}
+	connection := &tcpConnection{mConn: conn, mPeer: peer, mLastActive: time.Now()}
+	t.mConnections[peer] = connection
+	t.mWaitGroup.Add(1)
+	go t.readConnection(connection)
+	return connection, true
+}
+
+func (t *TcpTransportImpl) closeConnection(connection *tcpConnection) {
+	t.mMutex.Lock()
+	if t.mConnections[connection.mPeer] == connection {
+		delete(t.mConnections, connection.mPeer)
+	}
+	t.mMutex.Unlock()
+	_ = connection.mConn.Close()
+}
+
+func (t *TcpTransportImpl) readConnection(connection *tcpConnection) {
+	defer t.mWaitGroup.Done()
+	defer t.closeConnection(connection)
+	header := make([]byte, KTcpPacketHeaderBytes)
+	for {
+		t.mMutex.RLock()
+		idleTimeout := t.mIdleTimeout
+		t.mMutex.RUnlock()
+		_ = connection.mConn.SetReadDeadline(connection.idleSince().Add(idleTimeout))
+
+		n, err := io.ReadFull(connection.mConn, header)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if n == 0 && time.Since(connection.idleSince()) < idleTimeout {
+					// 超时期间有数据发送，连接仍然活跃
+					continue
+				}
+				log.Infof("TcpTransport closing idle connection to %s", connection.mPeer.String())
+			}
+			return
+		}
+		_ = connection.mConn.SetReadDeadline(time.Time{})
+		length := binary.LittleEndian.Uint32(header)
+		if length > KMaxTcpMessageSize {
+			log.Infof("TcpTransport message from %s too long: %d", connection.mPeer.String(), length)
+			return
+		}
+		data := make([]byte, length)
+		if _, err = io.ReadFull(connection.mConn, data); err != nil {
+			return
+		}
+		connection.touch()
+
+		t.mMutex.RLock()
+		delegate := t.mDelegate
+		t.mMutex.RUnlock()
+		if delegate != nil {
+			delegate.OnMessageReceived(NewTcpPeerAddress(connection.mPeer), data)
+		}
+	}
+}
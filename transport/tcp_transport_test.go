@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func newLoopbackTcpTransport(t *testing.T) (*TcpTransportImpl, *testTransportDelegate) {
+	t.Helper()
+	tcp := NewTcpTransportImpl()
+	if err := tcp.Init(netip.AddrPortFrom(netip.IPv6Loopback(), 0)); err != nil {
+		t.Skipf("unable to listen on loopback: %s", err.Error())
+	}
+	delegate := newTestTransportDelegate()
+	tcp.SetDelegate(delegate)
+	t.Cleanup(tcp.Close)
+	return tcp, delegate
+}
+
+func TestTcpTransportLargeMessage(t *testing.T) {
+	client, clientDelegate := newLoopbackTcpTransport(t)
+	server, serverDelegate := newLoopbackTcpTransport(t)
+
+	// 超过 UDP MTU 的消息
+	payload := make([]byte, 4*KMaxUdpPacketSize)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	serverAddr := NewTcpPeerAddress(netip.AddrPortFrom(netip.IPv6Loopback(), server.GetBoundPort()))
+	if err := client.SendMessage(serverAddr, payload); err != nil {
+		t.Fatal(err)
+	}
+	msg := serverDelegate.wait(t)
+	if !bytes.Equal(msg.data, payload) {
+		t.Fatalf("received %d bytes, want %d", len(msg.data), len(payload))
+	}
+
+	// 服务端通过同一个连接回复
+	if err := server.SendMessage(msg.peer, []byte{0x01, 0x02}); err != nil {
+		t.Fatal(err)
+	}
+	reply := clientDelegate.wait(t)
+	if !bytes.Equal(reply.data, []byte{0x01, 0x02}) {
+		t.Errorf("unexpected reply %x", reply.data)
+	}
+	if client.ActiveConnectionCount() != 1 || server.ActiveConnectionCount() != 1 {
+		t.Errorf("expected a single pooled connection, got client %d server %d",
+			client.ActiveConnectionCount(), server.ActiveConnectionCount())
+	}
+
+	// 第二个消息复用连接池中的连接
+	if err := client.SendMessage(serverAddr, []byte{0x03}); err != nil {
+		t.Fatal(err)
+	}
+	serverDelegate.wait(t)
+	if client.ActiveConnectionCount() != 1 {
+		t.Errorf("expected connection reuse, got %d connections", client.ActiveConnectionCount())
+	}
+}
+
+func TestTcpTransportIdleTimeout(t *testing.T) {
+	client, _ := newLoopbackTcpTransport(t)
+	server, serverDelegate := newLoopbackTcpTransport(t)
+	client.SetIdleTimeout(100 * time.Millisecond)
+
+	serverAddr := NewTcpPeerAddress(netip.AddrPortFrom(netip.IPv6Loopback(), server.GetBoundPort()))
+	if err := client.SendMessage(serverAddr, []byte{0x00}); err != nil {
+		t.Fatal(err)
+	}
+	serverDelegate.wait(t)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for client.ActiveConnectionCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle connection was not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTcpTransportRejectsOversizedMessage(t *testing.T) {
+	tcp, _ := newLoopbackTcpTransport(t)
+	peer := NewTcpPeerAddress(netip.AddrPortFrom(netip.IPv6Loopback(), tcp.GetBoundPort()))
+	if err := tcp.SendMessage(peer, make([]byte, KMaxTcpMessageSize+1)); err == nil {
+		t.Errorf("expected error for oversized message")
+	}
+	if tcp.CanSendToPeer(NewTcpPeerAddress(netip.MustParseAddrPort("127.0.0.1:5540"))) {
+		t.Errorf("IPv6 endpoint must not send to IPv4 peers")
+	}
+}
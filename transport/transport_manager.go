@@ -1,11 +1,139 @@
 package transport
 
+import (
+	"github.com/galenliu/chip/internal"
+	log "github.com/sirupsen/logrus"
+	"net/netip"
+	"sync"
+)
+
+// Transport 传输层的抽象，UDP、TCP 以及 BLE 都实现了该接口
 type Transport interface {
+	Init(addr netip.AddrPort) error
+	GetBoundPort() uint16
+	SendMessage(peer PeerAddress, msg []byte) error
+	CanSendToPeer(peer PeerAddress) bool
+	SetDelegate(delegate TransportDelegate)
+	Close()
+}
+
+// MulticastTransport 支持组播的传输
+type MulticastTransport interface {
+	Transport
+	MulticastGroupJoinLeave(peer PeerAddress, joined bool) error
+	CanListenMulticast() bool
 }
 
-type TransportImpl struct {
+// TransportDelegate 接收传输层收到的原始消息
+type TransportDelegate interface {
+	OnMessageReceived(peer PeerAddress, data []byte)
 }
 
-func (t TransportImpl) Init() error {
+// TransportManager 组合多个传输，根据对端地址选择发送使用的传输，并把所有收到的消息交给同一个处理者
+type TransportManager interface {
+	Init(transports ...Transport) error
+	SetSessionManager(delegate TransportDelegate)
+	SendMessage(peer PeerAddress, msg []byte) error
+	MulticastGroupJoinLeave(peer PeerAddress, joined bool) error
+	GetTransports() []Transport
+	Close()
+}
+
+type TransportManagerImpl struct {
+	mTransports     []Transport
+	mSessionManager TransportDelegate
+	mMutex          sync.RWMutex
+}
+
+func NewTransportManagerImpl() *TransportManagerImpl {
+	return &TransportManagerImpl{}
+}
+
+// Init 传入的传输必须已经初始化，发送时按照传入的顺序选择第一个可以到达对端的传输
+func (t *TransportManagerImpl) Init(transports ...Transport) error {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	if len(t.mTransports) != 0 {
+		return internal.ChipErrorIncorrectState
+	}
+	if len(transports) == 0 {
+		return internal.ChipErrorInvalidArgument
+	}
+	for _, transport := range transports {
+		if transport == nil {
+			return internal.ChipErrorInvalidArgument
+		}
+	}
+	t.mTransports = transports
+	for _, transport := range t.mTransports {
+		transport.SetDelegate(t)
+	}
 	return nil
 }
+
+func (t *TransportManagerImpl) SetSessionManager(delegate TransportDelegate) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	t.mSessionManager = delegate
+}
+
+func (t *TransportManagerImpl) GetTransports() []Transport {
+	t.mMutex.RLock()
+	defer t.mMutex.RUnlock()
+	return t.mTransports
+}
+
+func (t *TransportManagerImpl) SendMessage(peer PeerAddress, msg []byte) error {
+	t.mMutex.RLock()
+	transports := t.mTransports
+	t.mMutex.RUnlock()
+	for _, transport := range transports {
+		if transport.CanSendToPeer(peer) {
+			return transport.SendMessage(peer, msg)
+		}
+	}
+	log.Infof("TransportManager no transport for peer %s", peer.String())
+	return internal.ChipErrorNoMessageHandler
+}
+
+// MulticastGroupJoinLeave 在所有支持组播的传输上加入或离开组播组
+func (t *TransportManagerImpl) MulticastGroupJoinLeave(peer PeerAddress, joined bool) error {
+	t.mMutex.RLock()
+	transports := t.mTransports
+	t.mMutex.RUnlock()
+	var err = internal.ChipErrorNotImplemented
+	for _, transport := range transports {
+		multicast, ok := transport.(MulticastTransport)
+		if !ok || !multicast.CanListenMulticast() {
+			continue
+		}
+		if e := multicast.MulticastGroupJoinLeave(peer, joined); e != nil {
+			return e
+		}
+		err = nil
+	}
+	return err
+}
+
+// OnMessageReceived 各个传输收到的消息都交给 SessionManager 处理
+func (t *TransportManagerImpl) OnMessageReceived(peer PeerAddress, data []byte) {
+	t.mMutex.RLock()
+	delegate := t.mSessionManager
+	t.mMutex.RUnlock()
+	if delegate == nil {
+		log.Infof("TransportManager dropping message from %s: no session manager", peer.String())
+		return
+	}
+	delegate.OnMessageReceived(peer, data)
+}
+
+// Close 关闭所有的传输
+func (t *TransportManagerImpl) Close() {
+	t.mMutex.Lock()
+	transports := t.mTransports
+	t.mTransports = nil
+	t.mMutex.Unlock()
+	for _, transport := range transports {
+		transport.Close()
+	}
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestTransportManagerRouting(t *testing.T) {
+	udp6 := NewUdbTransportImpl()
+	udp4 := NewUdbTransportImpl()
+	tcp := NewTcpTransportImpl()
+	if udp6.Init(netip.AddrPortFrom(netip.IPv6Loopback(), 0)) != nil ||
+		udp4.Init(netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), 0)) != nil ||
+		tcp.Init(netip.AddrPortFrom(netip.IPv6Loopback(), 0)) != nil {
+		t.Skip("unable to listen on loopback")
+	}
+	manager := NewTransportManagerImpl()
+	if err := manager.Init(udp6, udp4, tcp); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	delegate := newTestTransportDelegate()
+	manager.SetSessionManager(delegate)
+
+	peers := []PeerAddress{
+		NewUdpPeerAddress(netip.AddrPortFrom(netip.IPv6Loopback(), udp6.GetBoundPort())),
+		NewUdpPeerAddress(netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), udp4.GetBoundPort())),
+		NewTcpPeerAddress(netip.AddrPortFrom(netip.IPv6Loopback(), tcp.GetBoundPort())),
+	}
+	for i, peer := range peers {
+		payload := []byte{byte(i), 0xAA}
+		if err := manager.SendMessage(peer, payload); err != nil {
+			t.Fatalf("%s: %s", peer.String(), err.Error())
+		}
+		msg := delegate.wait(t)
+		if !bytes.Equal(msg.data, payload) || msg.peer.GetTransportType() != peer.GetTransportType() {
+			t.Errorf("%s: received %x from %s", peer.String(), msg.data, msg.peer.String())
+		}
+	}
+
+	if err := manager.SendMessage(NewBlePeerAddress(), []byte{0}); err == nil {
+		t.Errorf("expected error for a peer without transport")
+	}
+	if err := manager.MulticastGroupJoinLeave(NewTcpPeerAddress(netip.MustParseAddrPort("[ff35::1]:5540")), true); err == nil {
+		t.Errorf("expected error joining a TCP multicast peer")
+	}
+}
+
+func TestTransportManagerInit(t *testing.T) {
+	manager := NewTransportManagerImpl()
+	if err := manager.Init(); err == nil {
+		t.Errorf("expected error without transports")
+	}
+	if err := manager.Init(nil); err == nil {
+		t.Errorf("expected error for nil transport")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package transport
+
+import (
+	"net/netip"
+	"syscall"
+)
+
+func multicastJoinLeave(fd uintptr, addr netip.Addr, ifIndex int, join bool) error {
+	if addr.Is4() {
+		mreq := &syscall.IPMreq{Multiaddr: addr.As4()}
+		opt := syscall.IP_ADD_MEMBERSHIP
+		if !join {
+			opt = syscall.IP_DROP_MEMBERSHIP
+		}
+		return syscall.SetsockoptIPMreq(int(fd), syscall.IPPROTO_IP, opt, mreq)
+	}
+	mreq := &syscall.IPv6Mreq{Multiaddr: addr.As16(), Interface: uint32(ifIndex)}
+	opt := syscall.IPV6_JOIN_GROUP
+	if !join {
+		opt = syscall.IPV6_LEAVE_GROUP
+	}
+	return syscall.SetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IPV6, opt, mreq)
+}
@@ -1,55 +1,234 @@
 package transport
 
 import (
+	"errors"
+	"github.com/galenliu/chip/internal"
 	log "github.com/sirupsen/logrus"
 	"net"
 	"net/netip"
+	"sync"
+	"time"
 )
 
+// KMaxUdpPacketSize Matter 消息在 UDP 上的最大长度（IPv6 最小 MTU 1280 减去 IP/UDP 头）
+const KMaxUdpPacketSize = 1280 - 40 - 8
+
+// kUdpReceiveBufferSize 接收缓冲区大小，大于 KMaxUdpPacketSize，以便检测出超长的报文
+const kUdpReceiveBufferSize = 1500
+
+// 读取或者接受连接出错时的重试间隔，与 net/http 相同从 5ms 开始加倍，最长 1s
+const (
+	kMinRetryDelay = 5 * time.Millisecond
+	kMaxRetryDelay = time.Second
+)
+
+// nextRetryDelay 返回下一次重试前等待的时间
+func nextRetryDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return kMinRetryDelay
+	}
+	if delay *= 2; delay > kMaxRetryDelay {
+		return kMaxRetryDelay
+	}
+	return delay
+}
+
 type UdpTransport interface {
-	GetBoundPort() uint16
-	Close()
-	SendMessage(port netip.AddrPort, msg []byte) error
-	MulticastGroupJoinLeave(port netip.AddrPort, joined bool) error
-	CanListenMulticast() bool
-	CanSendToPeer(port netip.AddrPort) bool
-	OnUdpReceive(port netip.AddrPort)
-	OnUdpError(endPoint netip.AddrPort)
+	MulticastTransport
+	SetInterface(i *net.Interface)
 }
 
+// UdpTransportImpl 每个实例绑定一个地址族（IPv6 或 IPv4）的 UDP 端点
 type UdpTransportImpl struct {
+	mConn        *net.UDPConn
+	mAddr        netip.AddrPort
+	mInterface   *net.Interface
+	mDelegate    TransportDelegate
+	mMutex       sync.RWMutex
+	mWaitGroup   sync.WaitGroup
+	mInitialized bool
 }
 
 func NewUdbTransportImpl() *UdpTransportImpl {
 	return &UdpTransportImpl{}
 }
 
+// Init 绑定到 addr，端口为 0 时由系统分配，可以通过 GetBoundPort 获取实际端口
 func (p *UdpTransportImpl) Init(addr netip.AddrPort) error {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	if p.mInitialized {
+		return internal.ChipErrorIncorrectState
+	}
 	network := "udp6"
 	if addr.Addr().Is4() {
 		network = "udp4"
 	}
-	go func() {
-		for {
-			udpConn, err := net.ListenUDP(network, &net.UDPAddr{
-				IP:   addr.Addr().AsSlice(),
-				Port: int(addr.Port()),
-			})
-			if err != nil {
-				log.Error("UdpTransport err : %s", err.Error())
-				p.Close()
+	udpConn, err := net.ListenUDP(network, net.UDPAddrFromAddrPort(addr))
+	if err != nil {
+		log.Errorf("UdpTransport listen %s err: %s", addr.String(), err.Error())
+		return err
+	}
+	p.mConn = udpConn
+	p.mAddr = addr
+	p.mInitialized = true
+	p.mWaitGroup.Add(1)
+	go p.ReadConnection(udpConn)
+	log.Infof("UdpTransport listening on %s", udpConn.LocalAddr().String())
+	return nil
+}
+
+// SetInterface 设置加入组播时使用的网络接口，为 nil 时由系统选择
+func (p *UdpTransportImpl) SetInterface(i *net.Interface) {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	p.mInterface = i
+}
+
+func (p *UdpTransportImpl) SetDelegate(delegate TransportDelegate) {
+	p.mMutex.Lock()
+	defer p.mMutex.Unlock()
+	p.mDelegate = delegate
+}
+
+func (p *UdpTransportImpl) GetBoundPort() uint16 {
+	p.mMutex.RLock()
+	defer p.mMutex.RUnlock()
+	if p.mConn == nil {
+		return 0
+	}
+	addr, ok := p.mConn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return 0
+	}
+	return uint16(addr.Port)
+}
+
+func (p *UdpTransportImpl) ReadConnection(conn *net.UDPConn) {
+	defer p.mWaitGroup.Done()
+	buf := make([]byte, kUdpReceiveBufferSize)
+	var retryDelay time.Duration
+	for {
+		n, peer, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
 				return
 			}
-			go p.ReadConnection(udpConn)
+			p.OnUdpError(peer, err)
+			// 持续出错时避免空转
+			retryDelay = nextRetryDelay(retryDelay)
+			time.Sleep(retryDelay)
+			continue
 		}
-	}()
-	return nil
+		retryDelay = 0
+		if n > KMaxUdpPacketSize {
+			log.Infof("UdpTransport dropping oversized packet (%d bytes) from %s", n, peer.String())
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		p.OnUdpReceive(NewUdpPeerAddress(netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port())), data)
+	}
 }
 
-func (p *UdpTransportImpl) ReadConnection(conn *net.UDPConn) {
+func (p *UdpTransportImpl) OnUdpReceive(peer PeerAddress, data []byte) {
+	p.mMutex.RLock()
+	delegate := p.mDelegate
+	p.mMutex.RUnlock()
+	if delegate == nil {
+		log.Infof("UdpTransport dropping packet from %s: no delegate", peer.String())
+		return
+	}
+	delegate.OnMessageReceived(peer, data)
+}
 
+func (p *UdpTransportImpl) OnUdpError(peer netip.AddrPort, err error) {
+	log.Infof("UdpTransport receive error from %s: %s", peer.String(), err.Error())
 }
 
-func (p *UdpTransportImpl) Close() {
+func (p *UdpTransportImpl) SendMessage(peer PeerAddress, msg []byte) error {
+	p.mMutex.RLock()
+	conn := p.mConn
+	p.mMutex.RUnlock()
+	if conn == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	if !p.CanSendToPeer(peer) {
+		return internal.ChipErrorInvalidArgument
+	}
+	if len(msg) > KMaxUdpPacketSize {
+		return internal.ChipErrorMessageTooLong
+	}
+	addr := peer.GetAddrPort()
+	if addr.Addr().Is6() && addr.Addr().Zone() == "" && peer.GetInterface() != 0 &&
+		(addr.Addr().IsLinkLocalUnicast() || addr.Addr().IsMulticast()) {
+		if ifi, err := net.InterfaceByIndex(peer.GetInterface()); err == nil {
+			addr = netip.AddrPortFrom(addr.Addr().WithZone(ifi.Name), addr.Port())
+		}
+	}
+	_, err := conn.WriteToUDPAddrPort(msg, addr)
+	return err
+}
 
+// MulticastGroupJoinLeave 加入或离开组播组，Matter 仅使用 IPv6 组播
+func (p *UdpTransportImpl) MulticastGroupJoinLeave(peer PeerAddress, joined bool) error {
+	p.mMutex.RLock()
+	conn := p.mConn
+	ifi := p.mInterface
+	p.mMutex.RUnlock()
+	if conn == nil {
+		return internal.ChipErrorIncorrectState
+	}
+	addr := peer.GetIPAddress()
+	if peer.GetTransportType() != TypeUdp || !addr.IsMulticast() || addr.Is4() != p.mAddr.Addr().Is4() {
+		return internal.ChipErrorInvalidArgument
+	}
+	ifIndex := peer.GetInterface()
+	if ifIndex == 0 && ifi != nil {
+		ifIndex = ifi.Index
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockErr = multicastJoinLeave(fd, addr, ifIndex, joined)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		log.Infof("UdpTransport multicast join(%v) %s failed: %s", joined, addr.String(), sockErr.Error())
+	}
+	return sockErr
+}
+
+func (p *UdpTransportImpl) CanListenMulticast() bool {
+	p.mMutex.RLock()
+	defer p.mMutex.RUnlock()
+	return p.mInitialized && p.mAddr.Addr().Is6()
+}
+
+// CanSendToPeer 只能向与本端点相同地址族的对端发送
+func (p *UdpTransportImpl) CanSendToPeer(peer PeerAddress) bool {
+	p.mMutex.RLock()
+	defer p.mMutex.RUnlock()
+	if !p.mInitialized || peer.GetTransportType() != TypeUdp || !peer.GetAddrPort().IsValid() {
+		return false
+	}
+	return peer.GetIPAddress().Unmap().Is4() == p.mAddr.Addr().Is4()
+}
+
+func (p *UdpTransportImpl) Close() {
+	p.mMutex.Lock()
+	conn := p.mConn
+	p.mConn = nil
+	p.mInitialized = false
+	p.mMutex.Unlock()
+	if conn == nil {
+		return
+	}
+	_ = conn.Close()
+	p.mWaitGroup.Wait()
 }
@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type testTransportDelegate struct {
+	received chan testReceivedMessage
+}
+
+type testReceivedMessage struct {
+	peer PeerAddress
+	data []byte
+}
+
+func newTestTransportDelegate() *testTransportDelegate {
+	return &testTransportDelegate{received: make(chan testReceivedMessage, 16)}
+}
+
+func (d *testTransportDelegate) OnMessageReceived(peer PeerAddress, data []byte) {
+	d.received <- testReceivedMessage{peer: peer, data: data}
+}
+
+func (d *testTransportDelegate) wait(t *testing.T) testReceivedMessage {
+	t.Helper()
+	select {
+	case msg := <-d.received:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return testReceivedMessage{}
+}
+
+func newLoopbackUdpTransport(t *testing.T, addr netip.Addr) (*UdpTransportImpl, *testTransportDelegate) {
+	t.Helper()
+	udp := NewUdbTransportImpl()
+	if err := udp.Init(netip.AddrPortFrom(addr, 0)); err != nil {
+		t.Skipf("unable to listen on %s: %s", addr.String(), err.Error())
+	}
+	delegate := newTestTransportDelegate()
+	udp.SetDelegate(delegate)
+	t.Cleanup(udp.Close)
+	return udp, delegate
+}
+
+func TestUdpTransportLoopback(t *testing.T) {
+	for _, addr := range []netip.Addr{netip.IPv6Loopback(), netip.MustParseAddr("127.0.0.1")} {
+		a, _ := newLoopbackUdpTransport(t, addr)
+		b, delegate := newLoopbackUdpTransport(t, addr)
+		if a.GetBoundPort() == 0 || b.GetBoundPort() == 0 {
+			t.Fatalf("%s: expected bound ports", addr.String())
+		}
+
+		payload := []byte{0x00, 0x88, 0x77, 0x00, 0x44, 0x33, 0x22, 0x11}
+		if err := a.SendMessage(NewUdpPeerAddress(netip.AddrPortFrom(addr, b.GetBoundPort())), payload); err != nil {
+			t.Fatal(err)
+		}
+		msg := delegate.wait(t)
+		if !bytes.Equal(msg.data, payload) {
+			t.Errorf("%s: received %x, want %x", addr.String(), msg.data, payload)
+		}
+		if msg.peer.GetTransportType() != TypeUdp || msg.peer.GetPort() != a.GetBoundPort() || msg.peer.GetIPAddress() != addr {
+			t.Errorf("%s: unexpected peer %s", addr.String(), msg.peer.String())
+		}
+	}
+}
+
+func TestUdpTransportAddressFamily(t *testing.T) {
+	udp, _ := newLoopbackUdpTransport(t, netip.IPv6Loopback())
+	if udp.CanSendToPeer(NewUdpPeerAddress(netip.MustParseAddrPort("127.0.0.1:5540"))) {
+		t.Errorf("IPv6 endpoint must not send to IPv4 peers")
+	}
+	if !udp.CanSendToPeer(NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5540"))) {
+		t.Errorf("IPv6 endpoint must send to IPv6 peers")
+	}
+	if udp.CanSendToPeer(NewTcpPeerAddress(netip.MustParseAddrPort("[::1]:5540"))) {
+		t.Errorf("UDP endpoint must not send to TCP peers")
+	}
+	if !udp.CanListenMulticast() {
+		t.Errorf("IPv6 endpoint must support multicast")
+	}
+	if err := udp.SendMessage(NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5540")), make([]byte, KMaxUdpPacketSize+1)); err == nil {
+		t.Errorf("expected error for oversized message")
+	}
+	if err := udp.MulticastGroupJoinLeave(NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5540")), true); err == nil {
+		t.Errorf("expected error for non multicast address")
+	}
+}
+
+func TestUdpTransportClose(t *testing.T) {
+	udp := NewUdbTransportImpl()
+	if err := udp.Init(netip.AddrPortFrom(netip.IPv6Loopback(), 0)); err != nil {
+		t.Skip(err.Error())
+	}
+	if err := udp.Init(netip.AddrPortFrom(netip.IPv6Loopback(), 0)); err == nil {
+		t.Errorf("expected error for double init")
+	}
+	udp.Close()
+	udp.Close()
+	if udp.GetBoundPort() != 0 {
+		t.Errorf("closed endpoint must not report a bound port")
+	}
+	if err := udp.SendMessage(NewUdpPeerAddress(netip.MustParseAddrPort("[::1]:5540")), []byte{0}); err == nil {
+		t.Errorf("expected error sending on a closed endpoint")
+	}
+}
+
+func TestNextRetryDelay(t *testing.T) {
+	var delay time.Duration
+	var delays []time.Duration
+	for i := 0; i < 10; i++ {
+		delay = nextRetryDelay(delay)
+		delays = append(delays, delay)
+	}
+	if delays[0] != 5*time.Millisecond || delays[1] != 10*time.Millisecond || delays[7] != 640*time.Millisecond {
+		t.Errorf("retry delay must start at 5ms and double, got %v", delays)
+	}
+	if delays[8] != time.Second || delays[9] != time.Second {
+		t.Errorf("retry delay must be capped at 1s, got %v", delays)
+	}
+}
@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"github.com/galenliu/chip/access"
+	"github.com/galenliu/chip/internal"
+	"github.com/galenliu/chip/lib"
+	"sync"
+	"time"
+)
+
+// KMaxUnauthenticatedSessions 同时存在的未认证会话的最大数量
+const KMaxUnauthenticatedSessions = 4
+
+// UnauthenticatedSession 未加密的会话，只用于会话建立（PASE、CASE）过程，通过发起者的临时节点ID区分
+type UnauthenticatedSession struct {
+	sessionBase
+	mRole                     SessionRole
+	mEphemeralInitiatorNodeId lib.NodeId
+	mPeerMessageCounter       PeerMessageCounter
+}
+
+func newUnauthenticatedSession(role SessionRole, ephemeralInitiatorNodeId lib.NodeId, peerAddress PeerAddress) *UnauthenticatedSession {
+	s := &UnauthenticatedSession{
+		mRole:                     role,
+		mEphemeralInitiatorNodeId: ephemeralInitiatorNodeId,
+	}
+	s.mPeerAddress = peerAddress
+	s.mLastActivity = time.Now()
+	return s
+}
+
+func (s *UnauthenticatedSession) GetSessionType() SessionType {
+	return SessionTypeUnauthenticated
+}
+
+// GetPeer 未认证的会话没有Fabric，作为发起者时对端节点ID未知
+func (s *UnauthenticatedSession) GetPeer() lib.ScopedNodeId {
+	if s.mRole == SessionRoleResponder {
+		return lib.NewScopedNodeId(s.mEphemeralInitiatorNodeId, lib.KUndefinedFabricIndex)
+	}
+	return lib.NewScopedNodeId(lib.KUndefinedNodeId, lib.KUndefinedFabricIndex)
+}
+
+func (s *UnauthenticatedSession) GetFabricIndex() lib.FabricIndex {
+	return lib.KUndefinedFabricIndex
+}
+
+// GetSubjectDescriptor 未认证的会话没有主体
+func (s *UnauthenticatedSession) GetSubjectDescriptor() access.SubjectDescriptor {
+	return access.SubjectDescriptor{}
+}
+
+func (s *UnauthenticatedSession) IsGroupSession() bool {
+	return false
+}
+
+func (s *UnauthenticatedSession) IsSecureSession() bool {
+	return false
+}
+
+func (s *UnauthenticatedSession) IsActiveSession() bool {
+	return true
+}
+
+func (s *UnauthenticatedSession) GetSessionRole() SessionRole {
+	return s.mRole
+}
+
+func (s *UnauthenticatedSession) GetEphemeralInitiatorNodeId() lib.NodeId {
+	return s.mEphemeralInitiatorNodeId
+}
+
+func (s *UnauthenticatedSession) verifyPeerMessageCounter(counter uint32) error {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	return s.mPeerMessageCounter.VerifyUnencrypted(counter)
+}
+
+func (s *UnauthenticatedSession) commitPeerMessageCounter(counter uint32) {
+	s.mMutex.Lock()
+	defer s.mMutex.Unlock()
+	s.mPeerMessageCounter.CommitUnencrypted(counter)
+}
+
+// UnauthenticatedSessionTable 保存未认证的会话，满了之后淘汰最久未活动的会话
+type UnauthenticatedSessionTable struct {
+	mMutex       sync.Mutex
+	mSessions    []*UnauthenticatedSession
+	mMaxSessions int
+}
+
+func NewUnauthenticatedSessionTable(maxSessions int) *UnauthenticatedSessionTable {
+	return &UnauthenticatedSessionTable{mMaxSessions: maxSessions}
+}
+
+// FindOrAllocateResponder 收到发起者的消息时查找或创建作为响应者的会话
+func (t *UnauthenticatedSessionTable) FindOrAllocateResponder(ephemeralInitiatorNodeId lib.NodeId, peerAddress PeerAddress) (*UnauthenticatedSession, error) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	if s := t.find(SessionRoleResponder, ephemeralInitiatorNodeId); s != nil {
+		return s, nil
+	}
+	return t.alloc(SessionRoleResponder, ephemeralInitiatorNodeId, peerAddress)
+}
+
+// FindInitiator 收到响应者的消息时查找本端发起的会话
+func (t *UnauthenticatedSessionTable) FindInitiator(ephemeralInitiatorNodeId lib.NodeId) *UnauthenticatedSession {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	return t.find(SessionRoleInitiator, ephemeralInitiatorNodeId)
+}
+
+// AllocInitiator 作为发起者创建会话
+func (t *UnauthenticatedSessionTable) AllocInitiator(ephemeralInitiatorNodeId lib.NodeId, peerAddress PeerAddress) (*UnauthenticatedSession, error) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	if t.find(SessionRoleInitiator, ephemeralInitiatorNodeId) != nil {
+		return nil, internal.ChipErrorIncorrectState
+	}
+	return t.alloc(SessionRoleInitiator, ephemeralInitiatorNodeId, peerAddress)
+}
+
+// Release 移除会话
+func (t *UnauthenticatedSessionTable) Release(session *UnauthenticatedSession) {
+	t.mMutex.Lock()
+	defer t.mMutex.Unlock()
+	for i, s := range t.mSessions {
+		if s == session {
+			t.mSessions = append(t.mSessions[:i], t.mSessions[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *UnauthenticatedSessionTable) find(role SessionRole, ephemeralInitiatorNodeId lib.NodeId) *UnauthenticatedSession {
+	for _, s := range t.mSessions {
+		if s.mRole == role && s.mEphemeralInitiatorNodeId == ephemeralInitiatorNodeId {
+			return s
+		}
+	}
+	return nil
+}
+
+func (t *UnauthenticatedSessionTable) alloc(role SessionRole, ephemeralInitiatorNodeId lib.NodeId, peerAddress PeerAddress) (*UnauthenticatedSession, error) {
+	if t.mMaxSessions <= 0 {
+		return nil, internal.ChipErrorNoMemory
+	}
+	if len(t.mSessions) >= t.mMaxSessions {
+		oldest := 0
+		for i, s := range t.mSessions {
+			if s.GetLastActivityTime().Before(t.mSessions[oldest].GetLastActivityTime()) {
+				oldest = i
+			}
+		}
+		t.mSessions = append(t.mSessions[:oldest], t.mSessions[oldest+1:]...)
+	}
+	s := newUnauthenticatedSession(role, ephemeralInitiatorNodeId, peerAddress)
+	t.mSessions = append(t.mSessions, s)
+	return s, nil
+}